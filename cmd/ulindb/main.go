@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io"
 	"os"
@@ -10,30 +11,49 @@ import (
 	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/zakazai/ulin-db"
+	"github.com/zakazai/ulin-db/internal/audit"
+	"github.com/zakazai/ulin-db/internal/formatter"
 	"github.com/zakazai/ulin-db/internal/parser"
 	"github.com/zakazai/ulin-db/internal/storage"
 	"github.com/zakazai/ulin-db/internal/types"
 )
 
 func main() {
+	// ulindb serve [flags] is the server mode, listening on :5433 unless
+	// --listen says otherwise
+	args := os.Args[1:]
+	serve := len(args) > 0 && args[0] == "serve"
+	if serve {
+		args = args[1:]
+	}
+
+	dsn := flag.String("dsn", "", "connection string, e.g. ulindb://hybrid?btree=data/ulindb.btree&parquet=data/parquet&sync=5m (replaces the defaults and ULINDB_LOG_LEVEL)")
+	thorough := flag.Bool("thorough", false, "after an unclean shutdown, check every data page instead of a sample")
+	force := flag.Bool("force", false, "allow writes even if recovery finds unrecoverable corruption")
+	allowUnmasked := flag.Bool("allow-unmasked", false, "let sessions see masked columns with SET show_masked_data = true")
+	listen := flag.String("listen", "", "serve SQL over TCP on this address (e.g. :5433) instead of reading stdin; SIGINT shuts down")
+	logLevelFlag := flag.String("log-level", "", "log level: debug, info, warn, error or none (default info; overrides ULINDB_LOG_LEVEL and the DSN)")
+	dataDir := flag.String("data", "", "directory holding ulindb.btree and parquet/ (default data)")
+	flag.CommandLine.Parse(args)
+	if serve && *listen == "" {
+		*listen = ":5433"
+	}
+
 	// Print the welcome message
 	fmt.Println("UlinDB SQL Server")
 	fmt.Println("Type 'exit' to quit")
 
-	// Determine log level from environment variable or command line args
+	// Determine log level from environment variable or command line args.
+	// Storage code logs per row only at debug, so info keeps logs from
+	// interleaving with query results.
 	logLevel := types.LogLevelInfo
 	if logLevelStr := os.Getenv("ULINDB_LOG_LEVEL"); logLevelStr != "" {
-		switch strings.ToLower(logLevelStr) {
-		case "debug":
-			logLevel = types.LogLevelDebug
-		case "info":
-			logLevel = types.LogLevelInfo
-		case "warning":
-			logLevel = types.LogLevelWarning
-		case "error":
-			logLevel = types.LogLevelError
-		case "none":
-			logLevel = types.LogLevelNone
+		level, err := types.ParseLogLevel(logLevelStr)
+		if err != nil {
+			fmt.Printf("ignoring ULINDB_LOG_LEVEL: %v\n", err)
+		} else {
+			logLevel = level
 		}
 	}
 
@@ -46,9 +66,40 @@ func main() {
 		LogLevel:     logLevel,
 	}
 
+	if *dataDir != "" {
+		if *dsn != "" {
+			fmt.Println("--data and --dsn cannot be used together")
+			os.Exit(2)
+		}
+		config.FilePath = filepath.Join(*dataDir, "ulindb.btree")
+		config.DataDir = filepath.Join(*dataDir, "parquet")
+	}
+	if *dsn != "" {
+		parsed, err := ulindb.ParseDSN(*dsn)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if !parsed.Hybrid || parsed.ReadOnly {
+			fmt.Println("invalid DSN: the CLI requires a writable ulindb://hybrid DSN")
+			os.Exit(2)
+		}
+		config = parsed.Config
+	}
+	if *logLevelFlag != "" {
+		level, err := types.ParseLogLevel(*logLevelFlag)
+		if err != nil {
+			fmt.Printf("invalid --log-level: %v\n", err)
+			os.Exit(2)
+		}
+		config.LogLevel = level
+	}
+
+	config.Recovery = storage.RecoveryOptions{Thorough: *thorough, Force: *force}
+
 	// Make sure the data directories exist
-	os.MkdirAll("data", 0755)
-	os.MkdirAll("data/parquet", 0755)
+	os.MkdirAll(filepath.Dir(config.FilePath), 0755)
+	os.MkdirAll(config.DataDir, 0755)
 
 	// Create hybrid storage
 	hybridStorage, err := storage.CreateHybridStorage(config)
@@ -57,18 +108,34 @@ func main() {
 		return
 	}
 
-	// Log storage status
-	types.GlobalLogger.Info("Hybrid storage initialized successfully")
-	types.GlobalLogger.Info("OLTP storage type: %T", hybridStorage.GetOLTPStorage())
-	types.GlobalLogger.Info("OLAP storage type: %T", hybridStorage.GetOLAPStorage())
-
 	// User-facing info (always display)
 	fmt.Println("Hybrid storage initialized successfully")
 	fmt.Println("OLTP storage type:", fmt.Sprintf("%T", hybridStorage.GetOLTPStorage()))
 	fmt.Println("OLAP storage type:", fmt.Sprintf("%T", hybridStorage.GetOLAPStorage()))
 
+	// Report the integrity pass run if the last shutdown was unclean
+	if report := hybridStorage.LastRecovery(); report != nil {
+		fmt.Printf("%s was not closed cleanly (%s)\n", config.FilePath, report.Marker)
+		fmt.Printf("Recovery checked %d pages: %d corrupt, %d repaired, %d rows dropped\n",
+			report.PagesChecked, report.CorruptPages, report.RepairedPages, report.RowsDropped)
+		if report.Unrecoverable != "" {
+			fmt.Printf("Unrecoverable corruption: %s\n", report.Unrecoverable)
+			if !report.Forced {
+				fmt.Println("Writes are disabled; restart with --force to allow them")
+			}
+		}
+	}
+
+	// Remove files left behind by crashes and interrupted syncs before the
+	// first sync writes new ones
+	if report, err := hybridStorage.Cleanup(storage.CleanupOptions{}); err != nil {
+		types.GlobalLogger.Warning("Startup cleanup failed: %v", err)
+	} else if len(report.Files) > 0 {
+		fmt.Printf("Cleanup removed %d stray files (%d bytes)\n", len(report.Files), report.Bytes)
+	}
+
 	// Force initial sync to ensure data is available in Parquet
-	err = hybridStorage.SyncNow()
+	_, err = hybridStorage.SyncNow()
 	if err != nil {
 		types.GlobalLogger.Warning("Initial sync failed: %v", err)
 		fmt.Printf("Warning: Initial sync failed: %v\n", err)
@@ -78,6 +145,29 @@ func main() {
 	// Use hybrid storage for all operations
 	s := hybridStorage
 
+	// Open the write audit log. ULINDB_AUDIT_ALL=true audits every table;
+	// otherwise tables opt in with ALTER TABLE ... SET AUDIT = true.
+	auditLog, err := audit.Open(filepath.Join(filepath.Dir(config.FilePath), "audit.log"), audit.Options{
+		AllTables: strings.EqualFold(os.Getenv("ULINDB_AUDIT_ALL"), "true"),
+		Sync:      true,
+	})
+	if err != nil {
+		types.GlobalLogger.Error("Error opening audit log: %v", err)
+		s.Close()
+		return
+	}
+	defer auditLog.Close()
+
+	if *listen != "" {
+		if err := runServer(*listen, s, auditLog, *allowUnmasked); err != nil {
+			fmt.Printf("Server error: %v\n", err)
+		}
+		if err := s.Close(); err != nil {
+			fmt.Printf("Error closing storage: %v\n", err)
+		}
+		return
+	}
+
 	// Check if we're in interactive mode or piped input
 	isInteractive := true
 	stat, _ := os.Stdin.Stat()
@@ -88,10 +178,10 @@ func main() {
 
 	if isInteractive {
 		// Interactive mode with command history
-		executeInteractiveMode(s)
+		executeInteractiveMode(s, auditLog, *allowUnmasked)
 	} else {
 		// Non-interactive mode (piped input)
-		executePipedMode(s)
+		executePipedMode(s, auditLog, *allowUnmasked)
 	}
 
 	// Close storage to ensure all data is saved
@@ -101,7 +191,7 @@ func main() {
 }
 
 // executeInteractiveMode handles interactive mode with command history
-func executeInteractiveMode(s *storage.HybridStorage) {
+func executeInteractiveMode(s *storage.HybridStorage, auditLog *audit.Log, allowUnmasked bool) {
 	// Create history file path in user's home directory
 	historyFile := getHistoryFilePath()
 
@@ -118,7 +208,12 @@ func executeInteractiveMode(s *storage.HybridStorage) {
 	}
 	defer rl.Close()
 
-	// Process commands in a loop
+	// Session variables live for the duration of the REPL
+	session := parser.NewSession()
+	session.AllowUnmasked(allowUnmasked)
+
+	// Process commands in a loop, printing results as .format says
+	format := formatter.FormatTable
 	multilineBuffer := ""
 	for {
 		// Read a line of input
@@ -149,6 +244,16 @@ func executeInteractiveMode(s *storage.HybridStorage) {
 			break
 		}
 
+		// .format and other dot commands are a line of their own
+		if multilineBuffer == "" {
+			if sql, ok := handleDotCommand(trimmedLine, &format); ok {
+				if sql != "" {
+					processCommand(os.Stdout, format, s, session, auditLog, sql)
+				}
+				continue
+			}
+		}
+
 		// Append the line to the multiline buffer
 		if multilineBuffer != "" {
 			multilineBuffer += "\n"
@@ -165,15 +270,20 @@ func executeInteractiveMode(s *storage.HybridStorage) {
 		rl.SetPrompt("> ")
 
 		// Process the completed command
-		processCommand(s, multilineBuffer)
+		processCommand(os.Stdout, format, s, session, auditLog, multilineBuffer)
 
 		// Clear the buffer for the next command
 		multilineBuffer = ""
 	}
+
+	if session.InTransaction() {
+		fmt.Println("Transaction not committed, rolling back")
+		processCommand(os.Stdout, format, s, session, auditLog, "ROLLBACK;")
+	}
 }
 
 // executePipedMode handles non-interactive mode with piped input
-func executePipedMode(s *storage.HybridStorage) {
+func executePipedMode(s *storage.HybridStorage, auditLog *audit.Log, allowUnmasked bool) {
 	// Read all input at once
 	input, err := io.ReadAll(os.Stdin)
 	if err != nil {
@@ -191,9 +301,23 @@ func executePipedMode(s *storage.HybridStorage) {
 	// Split by semicolon to find statement boundaries
 	parts := strings.Split(inputStr, ";")
 
+	// All piped statements share one session
+	session := parser.NewSession()
+	session.AllowUnmasked(allowUnmasked)
+	format := formatter.FormatTable
+
 	for _, part := range parts {
 		// Trim whitespace but preserve internal structure
 		stmt := strings.TrimSpace(part)
+
+		// Dot commands are whole lines before the statement
+		for strings.HasPrefix(stmt, ".") {
+			line, rest, _ := strings.Cut(stmt, "\n")
+			if sql, _ := handleDotCommand(line, &format); sql != "" {
+				processCommand(os.Stdout, format, s, session, auditLog, sql)
+			}
+			stmt = strings.TrimSpace(rest)
+		}
 		if stmt == "" {
 			continue
 		}
@@ -230,12 +354,17 @@ func executePipedMode(s *storage.HybridStorage) {
 		}
 
 		// Process the statement
-		processCommand(s, stmt)
+		processCommand(os.Stdout, format, s, session, auditLog, stmt)
+	}
+
+	if session.InTransaction() {
+		fmt.Println("Transaction not committed, rolling back")
+		processCommand(os.Stdout, format, s, session, auditLog, "ROLLBACK;")
 	}
 }
 
 // processCommand handles a single complete SQL command
-func processCommand(s *storage.HybridStorage, input string) {
+func processCommand(out io.Writer, format formatter.Format, s *storage.HybridStorage, session *parser.Session, auditLog *audit.Log, input string) {
 	// Trim whitespace
 	input = strings.TrimSpace(input)
 	if input == "" {
@@ -250,38 +379,79 @@ func processCommand(s *storage.HybridStorage, input string) {
 
 	// Special command to force sync from BTree to Parquet
 	if strings.ToUpper(input) == "FORCE_SYNC;" {
-		fmt.Println("Forcing sync from BTree to Parquet storage...")
-		startTime := time.Now()
-		err := s.SyncNow()
-		duration := time.Since(startTime)
+		fmt.Fprintln(out, "Forcing sync from BTree to Parquet storage...")
+		stats, err := s.SyncNow()
 		if err != nil {
-			fmt.Printf("Error during sync: %v\n", err)
+			fmt.Fprintf(out, "Error during sync: %v\n", err)
 		} else {
-			fmt.Printf("Sync completed in %v\n", duration)
+			fmt.Fprintf(out, "Sync completed: %s\n", stats)
 		}
 		return
 	}
 
+	// Handle SHOW ROUTING HISTORY and RESET ROUTING HISTORY
+	switch strings.ToUpper(input) {
+	case "SHOW ROUTING HISTORY;":
+		decisions := s.RoutingHistory()
+		mapRows := make([]map[string]interface{}, len(decisions))
+		for i, d := range decisions {
+			mapRows[i] = d.Row()
+		}
+		fmt.Fprintf(out, "Found %d routing decisions\n", len(mapRows))
+		printFormattedResults(out, format, mapRows)
+		return
+	case "SHOW RECOVERY;":
+		report := s.LastRecovery()
+		if report == nil {
+			fmt.Fprintln(out, "The last shutdown was clean")
+			return
+		}
+		printFormattedResults(out, format, []map[string]interface{}{report.Row()})
+		return
+	case "SHOW CAPABILITIES;":
+		printFormattedResults(out, format, s.Capabilities().Rows())
+		return
+	case "RESET ROUTING HISTORY;":
+		s.ResetRoutingHistory()
+		fmt.Fprintln(out, "Routing history cleared")
+		return
+	case "CLEANUP;", "CLEANUP DRY RUN;":
+		report, err := s.Cleanup(storage.CleanupOptions{DryRun: strings.Contains(strings.ToUpper(input), "DRY RUN")})
+		if err != nil {
+			fmt.Fprintf(out, "Error during cleanup: %v\n", err)
+			return
+		}
+		rows := report.Rows()
+		mapRows := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			mapRows[i] = row
+		}
+		printFormattedResults(out, format, mapRows)
+		verb := map[bool]string{true: "Would reclaim", false: "Reclaimed"}[report.DryRun]
+		fmt.Fprintf(out, "%s %d bytes from %d files\n", verb, report.Bytes, len(report.Files))
+		return
+	}
+
 	// Handle SHOW TABLES command to list all tables
 	if strings.ToUpper(input) == "SHOW TABLES;" {
-		fmt.Println("Fetching all tables...")
+		fmt.Fprintln(out, "Fetching all tables...")
 		startTime := time.Now()
 		tables, err := s.ShowTables()
 		duration := time.Since(startTime)
 
 		if err != nil {
-			fmt.Printf("Error getting tables: %v\n", err)
+			fmt.Fprintf(out, "Error getting tables: %v\n", err)
 		} else {
 			// Sort tables alphabetically for consistent output
 			sort.Strings(tables)
 
-			fmt.Println("Results:")
-			fmt.Println("TABLE_NAME")
-			fmt.Println("---------")
+			fmt.Fprintln(out, "Results:")
+			fmt.Fprintln(out, "TABLE_NAME")
+			fmt.Fprintln(out, "---------")
 			for _, tableName := range tables {
-				fmt.Println(tableName)
+				fmt.Fprintln(out, tableName)
 			}
-			fmt.Printf("\nFound %d tables in %v\n", len(tables), duration)
+			fmt.Fprintf(out, "\nFound %d tables in %v\n", len(tables), duration)
 		}
 		return
 	}
@@ -291,12 +461,12 @@ func processCommand(s *storage.HybridStorage, input string) {
 		// Extract the table name
 		parts := strings.Split(strings.TrimSpace(input), " ")
 		if len(parts) < 3 {
-			fmt.Println("Error: Invalid SHOW TABLE command. Usage: SHOW TABLE <table_name>;")
+			fmt.Fprintln(out, "Error: Invalid SHOW TABLE command. Usage: SHOW TABLE <table_name>;")
 			return
 		}
 
 		tableName := strings.TrimSuffix(parts[2], ";")
-		fmt.Printf("Fetching schema for table '%s'...\n", tableName)
+		fmt.Fprintf(out, "Fetching schema for table '%s'...\n", tableName)
 		startTime := time.Now()
 
 		// Get the table definition
@@ -304,68 +474,236 @@ func processCommand(s *storage.HybridStorage, input string) {
 		duration := time.Since(startTime)
 
 		if table == nil {
-			fmt.Printf("Error: Table '%s' does not exist\n", tableName)
+			fmt.Fprintf(out, "Error: Table '%s' does not exist\n", tableName)
 			return
 		}
 
 		// Print table schema
-		fmt.Printf("Table: %s\n", table.Name)
-		fmt.Println("\nCOLUMN_NAME  | TYPE    | NULLABLE")
-		fmt.Println("-------------+---------+---------")
+		fmt.Fprintf(out, "Table: %s\n", table.Name)
+		fmt.Fprintln(out, "\nCOLUMN_NAME  | TYPE    | NULLABLE | MASKED")
+		fmt.Fprintln(out, "-------------+---------+----------+-----------")
 
 		for _, col := range table.Columns {
 			nullable := "YES"
 			if !col.Nullable {
 				nullable = "NO"
 			}
-			fmt.Printf("%-12s | %-7s | %s\n", col.Name, col.Type, nullable)
+			fmt.Fprintf(out, "%-12s | %-7s | %-8s | %s\n", col.Name, col.Type, nullable, col.Mask)
+		}
+
+		if quota := table.Quota; quota != nil {
+			usage, err := s.QuotaUsage(tableName)
+			if err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+				return
+			}
+			limit := func(max int64) string {
+				if max == 0 {
+					return "unlimited"
+				}
+				return fmt.Sprint(max)
+			}
+			onFull := map[bool]string{true: "DELETE OLDEST", false: "ERROR"}[quota.EvictOldest]
+			fmt.Fprintf(out, "\nQuota: %d / %s rows, %d / %s bytes, ON FULL %s\n",
+				usage.Rows, limit(quota.MaxRows), usage.Bytes, limit(quota.MaxBytes), onFull)
 		}
 
-		fmt.Printf("\nSchema retrieved in %v\n", duration)
+		fmt.Fprintf(out, "\nSchema retrieved in %v\n", duration)
 		return
 	}
 
-	// Handle EXPLAIN command for query execution plan
-	if strings.HasPrefix(strings.ToUpper(input), "EXPLAIN ") {
-		// Extract the actual query
-		query := strings.TrimSpace(input[8:])
-		fmt.Printf("Explaining query: %s\n", query)
+	// Parse the SQL statement
+	stmt, err := parser.Parse(input)
+	if err != nil {
+		fmt.Fprintf(out, "Error parsing statement: %v\n", err)
+		return
+	}
+	if err := stmt.CheckSupported(s.Capabilities()); err != nil {
+		fmt.Fprintf(out, "Error executing statement: %v\n", err)
+		return
+	}
 
-		// Parse the query
-		stmt, err := parser.Parse(query)
+	// EXPLAIN [ANALYZE] [FORMAT JSON] prints the planner's description of
+	// the statement it wraps
+	if stmt.Type == "EXPLAIN" {
+		rendered, err := explainStatement(session, stmt.ExplainStatement, s, auditLog, input)
 		if err != nil {
-			fmt.Printf("Error parsing statement: %v\n", err)
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
 			return
 		}
+		fmt.Fprint(out, rendered)
+		return
+	}
 
-		// Only support EXPLAIN for SELECT statements
-		if stmt.SelectStatement != nil {
-			selectStmt := stmt.SelectStatement
-			isOLAP := storage.IsOLAPQuery(selectStmt.Columns, selectStmt.Where)
-			fmt.Println("======= Query Execution Plan =======")
-			fmt.Printf("Query Type: %s\n", map[bool]string{true: "OLAP (Analytical)", false: "OLTP (Transactional)"}[isOLAP])
-			fmt.Printf("Storage Engine: %s\n", map[bool]string{true: "Parquet", false: "BTree"}[isOLAP])
-			fmt.Printf("Table: %s\n", selectStmt.Table)
-			fmt.Printf("Columns: %v\n", selectStmt.Columns)
-			if len(selectStmt.Where) > 0 {
-				fmt.Println("Filters:")
-				for col, val := range selectStmt.Where {
-					fmt.Printf("  %s = %v\n", col, val)
-				}
+	// BEGIN, COMMIT and ROLLBACK start and end the session's transaction,
+	// and the statements in between run against it, so writes stay
+	// buffered until COMMIT and reads see them
+	if stmt.Type == "BEGIN" || stmt.Type == "COMMIT" || stmt.Type == "ROLLBACK" || session.InTransaction() {
+		result, err := session.Execute(stmt, s)
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		switch stmt.Type {
+		case "BEGIN":
+			fmt.Fprintln(out, "Transaction started")
+		case "COMMIT":
+			fmt.Fprintln(out, "Transaction committed")
+		case "ROLLBACK":
+			fmt.Fprintln(out, "Transaction rolled back")
+		}
+		if rows, ok := result.([]types.Row); ok {
+			mapRows := make([]map[string]interface{}, len(rows))
+			for i, row := range rows {
+				mapRows[i] = row
+			}
+			printFormattedResults(out, format, mapRows)
+		}
+		return
+	}
+
+	// SET @var and SELECT @var only touch the session, not storage. WITH
+	// queries also run through the session, which materializes the CTEs,
+	// and so do TABLESAMPLE queries, which skip the OLTP/OLAP routing, and
+	// queries with || expressions, which the session evaluates. EXPORT runs
+	// its query there too, so masked columns stay masked in the file.
+	if stmt.Type == "SET" || stmt.Type == "EXPORT" || (stmt.SelectStatement != nil && (stmt.SelectStatement.Table == "" || len(stmt.SelectStatement.With) > 0 || stmt.SelectStatement.Sample != nil || stmt.SelectStatement.HasExpressions())) {
+		result, err := session.Execute(stmt, s)
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		if rows, ok := result.([]types.Row); ok {
+			mapRows := make([]map[string]interface{}, len(rows))
+			for i, row := range rows {
+				mapRows[i] = row
+			}
+			printFormattedResults(out, format, mapRows)
+		}
+		return
+	}
+
+	// ALTER TABLE ... SET AUDIT and AUDIT LOG FOR only touch the audit log
+	switch stmt.Type {
+	case "ALTER":
+		alterStmt := stmt.AlterStatement
+		if s.GetTable(alterStmt.Table) == nil {
+			fmt.Fprintf(out, "Error executing statement: table %s does not exist\n", alterStmt.Table)
+			return
+		}
+		if alterStmt.Option == "TYPE" {
+			fmt.Fprintf(out, "Converting column %s of table '%s'...\n", alterStmt.Column, alterStmt.Table)
+			err := alterStmt.ChangeColumnType(s, func(converted int) {
+				fmt.Fprintf(out, "  %d rows converted\n", converted)
+			})
+			if err != nil {
+				fmt.Fprintf(out, "Error executing statement: %v\n", err)
+				return
+			}
+			fmt.Fprintf(out, "Column %s of table %s changed to %s\n", alterStmt.Column, alterStmt.Table, alterStmt.Value)
+			return
+		}
+		if alterStmt.Option == "MASK" {
+			if _, err := alterStmt.Execute(s); err != nil {
+				fmt.Fprintf(out, "Error executing statement: %v\n", err)
+				return
+			}
+			if alterStmt.Value == "" {
+				fmt.Fprintf(out, "Column %s of table %s is no longer masked\n", alterStmt.Column, alterStmt.Table)
 			} else {
-				fmt.Println("Filters: None (Full Table Scan)")
+				fmt.Fprintf(out, "Column %s of table %s masked using %s\n", alterStmt.Column, alterStmt.Table, alterStmt.Value)
 			}
-			fmt.Println("===================================")
-		} else {
-			fmt.Println("EXPLAIN is currently only supported for SELECT statements")
+			return
+		}
+		if alterStmt.Option == "ADD" {
+			if _, err := alterStmt.Execute(s); err != nil {
+				fmt.Fprintf(out, "Error executing statement: %v\n", err)
+				return
+			}
+			fmt.Fprintf(out, "Column %s added to table %s\n", alterStmt.Column, alterStmt.Table)
+			return
+		}
+		if alterStmt.Option != "AUDIT" {
+			if _, err := alterStmt.Execute(s); err != nil {
+				fmt.Fprintf(out, "Error executing statement: %v\n", err)
+				return
+			}
+			fmt.Fprintf(out, "Quota updated for table %s\n", alterStmt.Table)
+			return
 		}
+		enabled := alterStmt.Value.(bool)
+		if err := auditLog.SetEnabled(alterStmt.Table, enabled, input); err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		fmt.Fprintf(out, "Audit %s for table %s\n", map[bool]string{true: "enabled", false: "disabled"}[enabled], alterStmt.Table)
+		return
+	case "AUDIT":
+		entries, err := auditLog.Entries(stmt.AuditStatement.Table, stmt.AuditStatement.Limit)
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		mapRows := make([]map[string]interface{}, len(entries))
+		for i, entry := range entries {
+			mapRows[i] = entry.Row()
+		}
+		printFormattedResults(out, format, mapRows)
 		return
 	}
 
-	// Parse the SQL statement
-	stmt, err := parser.Parse(input)
+	// CHECK TABLE streams through the rows, so report progress as it goes
+	if stmt.Type == "CHECK" {
+		checkStmt := stmt.CheckStatement
+		fmt.Fprintf(out, "Checking table '%s'...\n", checkStmt.Table)
+		report, err := s.CheckTable(checkStmt.Table, checkStmt.Repair, func(scanned int) {
+			fmt.Fprintf(out, "  %d rows checked\n", scanned)
+		})
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		printFormattedResults(out, format, []map[string]interface{}{report.Row()})
+		return
+	}
+
+	// ATTACH, DETACH and the index statements only change the catalog, so
+	// the audit log has nothing to record
+	switch stmt.Type {
+	case "ATTACH":
+		result, err := stmt.Execute(s)
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		rows := result.([]types.Row)
+		mapRows := make([]map[string]interface{}, len(rows))
+		for i, row := range rows {
+			mapRows[i] = row
+		}
+		fmt.Fprintf(out, "Attached %s as table %s\n", stmt.AttachStatement.Path, stmt.AttachStatement.Table)
+		printFormattedResults(out, format, mapRows)
+		return
+	case "DETACH", "CREATE INDEX", "DROP INDEX":
+		result, err := stmt.Execute(s)
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
+		}
+		fmt.Fprintln(out, result)
+		return
+	}
+
+	// Writes go through the audit log so audited tables record them
+	target := auditLog.Wrap(s, input)
+
+	// Substitute session variables before the statement reaches storage
+	stmt, err = session.Bind(stmt)
+	if err == nil {
+		err = session.CheckCoercions(stmt, s)
+	}
 	if err != nil {
-		fmt.Printf("Error parsing statement: %v\n", err)
+		fmt.Fprintf(out, "Error executing statement: %v\n", err)
 		return
 	}
 
@@ -373,63 +711,49 @@ func processCommand(s *storage.HybridStorage, input string) {
 	if stmt.InsertStatement != nil {
 		insertStmt := stmt.InsertStatement
 		// Debug
-		fmt.Println("DEBUG: Executing INSERT Statement")
-		fmt.Printf("DEBUG: Table name = %s\n", insertStmt.Table)
-		fmt.Printf("DEBUG: Raw values = %v\n", insertStmt.Values)
-
-		// Show all available tables
-		tables, _ := s.ShowTables()
-		fmt.Printf("DEBUG: Available tables = %v\n", tables)
+		types.GlobalLogger.Debug("Executing INSERT Statement")
+		types.GlobalLogger.Debug("Table name = %s", insertStmt.Table)
+		types.GlobalLogger.Debug("Raw values = %v", insertStmt.Rows)
 
 		// Get the table definition to map column names
 		table := s.GetTable(insertStmt.Table)
 		if table == nil {
-			fmt.Printf("Error executing statement: table %s does not exist\n", insertStmt.Table)
-			// Try direct OLTP query to see if table exists there
-			oltpTable := s.GetOLTPStorage().GetTable(insertStmt.Table)
-			if oltpTable != nil {
-				fmt.Printf("DEBUG: Table found in OLTP but not in hybrid - schema: %v\n", oltpTable.Columns)
-			} else {
-				fmt.Println("DEBUG: Table not found in OLTP storage either")
-			}
+			fmt.Fprintf(out, "Error executing statement: table %s does not exist\n", insertStmt.Table)
 			return
 		}
 
-		fmt.Printf("DEBUG: Table columns = %v\n", table.Columns)
+		types.GlobalLogger.Debug("Table columns = %v", table.Columns)
 
-		// Map values to column names based on their position
-		values := make(map[string]interface{})
-
-		// The values in insertStmt.Values are stored with keys like "column1", "column2"
-		// We need to extract them in order
-		for i := 1; i <= len(table.Columns); i++ {
-			columnKey := fmt.Sprintf("column%d", i)
-			if val, ok := insertStmt.Values[columnKey]; ok && i-1 < len(table.Columns) {
-				colName := table.Columns[i-1].Name
-				values[colName] = val
-				fmt.Printf("DEBUG: Mapping %s -> %s = %v\n", columnKey, colName, val)
-			}
+		rows, err := insertStmt.TableRows(table)
+		if err != nil {
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+			return
 		}
 
 		// Execute the INSERT with timing
-		fmt.Printf("Executing INSERT operation on BTree storage...\n")
+		fmt.Fprintf(out, "Executing INSERT operation on BTree storage...\n")
 		startTime := time.Now()
-		err = s.Insert(insertStmt.Table, values)
+		err = types.InsertRows(target, insertStmt.Table, rows)
 		duration := time.Since(startTime)
 
 		if err != nil {
-			fmt.Printf("Error executing statement: %v\n", err)
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
+		} else if len(rows) == 1 {
+			fmt.Fprintf(out, "Successfully inserted record in %v\n", duration)
 		} else {
-			fmt.Printf("Successfully inserted record in %v\n", duration)
+			fmt.Fprintf(out, "Successfully inserted %d records in %v\n", len(rows), duration)
 		}
 		return
 	}
 
 	// Execute other statement types with timing
-	fmt.Printf("Executing statement...\n")
+	fmt.Fprintf(out, "Executing statement...\n")
 	startTime := time.Now()
 
-	// For SELECT statements, handle specially
+	// For SELECT statements, handle specially. The hybrid storage routes
+	// the query and brings the Parquet copy of the table up to date first
+	// if it is to read it, and records where the query went in the routing
+	// history.
 	if stmt.SelectStatement != nil {
 		selectStmt := stmt.SelectStatement
 		isOLAP := storage.IsOLAPQuery(selectStmt.Columns, selectStmt.Where)
@@ -437,132 +761,76 @@ func processCommand(s *storage.HybridStorage, input string) {
 		if isOLAP {
 			storageType = "Parquet (OLAP)"
 		}
-
-		// First always try OLTP storage directly for freshest data
-		fmt.Println("Always trying OLTP storage first for most up-to-date data...")
-		oltpRows, oltpErr := s.GetOLTPStorage().Select(selectStmt.Table, selectStmt.Columns, selectStmt.Where)
-
-		if oltpErr == nil && len(oltpRows) > 0 {
-			// Found data in OLTP, display it
-			mapRows := make([]map[string]interface{}, len(oltpRows))
-			for i, row := range oltpRows {
-				mapRows[i] = row
-			}
-			fmt.Printf("Retrieved %d rows from OLTP storage\n", len(mapRows))
-			printFormattedResults(mapRows)
-			duration := time.Since(startTime)
-			fmt.Printf("Execution completed in %v\n", duration)
-			return
-		}
-
-		// If OLTP storage returned no rows, continue with regular query
-		if oltpErr != nil {
-			fmt.Printf("OLTP storage error: %v\n", oltpErr)
-		} else {
-			fmt.Println("OLTP storage returned no rows, trying hybrid...")
-		}
-
-		fmt.Printf("Query classified as %s, using %s storage\n",
+		fmt.Fprintf(out, "Query classified as %s, using %s storage\n",
 			map[bool]string{true: "analytical", false: "transactional"}[isOLAP],
 			storageType)
 
-		// Execute the SELECT statement
-		result, err := stmt.Execute(s)
+		rows, err := s.Select(selectStmt.Table, selectStmt.Columns, selectStmt.Where)
 		duration := time.Since(startTime)
-
 		if err != nil {
-			fmt.Printf("Error executing statement: %v\n", err)
+			fmt.Fprintf(out, "Error executing statement: %v\n", err)
 			return
 		}
+		rows = session.MaskRows(s, selectStmt.Table, rows)
+		fmt.Fprintf(out, "Execution completed in %v\n", duration)
 
-		// For SELECT statements, also try to retrieve table directly to display rows
-		table := s.GetTable(selectStmt.Table)
-		rowsEmpty := true
-
-		// Check if result set is empty
-		if result != nil {
-			if rows, ok := result.([]map[string]interface{}); ok {
-				rowsEmpty = len(rows) == 0
-			} else if typedRows, ok := result.([]types.Row); ok {
-				rowsEmpty = len(typedRows) == 0
-				if !rowsEmpty {
-					// Convert typed rows to interface rows
-					mapRows := make([]map[string]interface{}, len(typedRows))
-					for i, row := range typedRows {
-						mapRows[i] = row
-					}
-					result = mapRows
-				}
+		if len(rows) > 0 {
+			mapRows := make([]map[string]interface{}, len(rows))
+			for i, row := range rows {
+				mapRows[i] = row
 			}
+			fmt.Fprintf(out, "Retrieved %d rows\n", len(mapRows))
+			printFormattedResults(out, format, mapRows)
+			return
 		}
 
-		// Print the result with timing information
-		fmt.Printf("Execution completed in %v\n", duration)
-
-		// Display results or table schema
-		if rowsEmpty && table != nil {
-			// Try direct OLTP query to see what's there (diagnostic measure)
-			fmt.Println("Trying direct OLTP query as a diagnostic...")
-			oltpRows, _ := s.GetOLTPStorage().Select(selectStmt.Table, selectStmt.Columns, selectStmt.Where)
-			if len(oltpRows) > 0 {
-				// Found data in OLTP, display it
-				mapRows := make([]map[string]interface{}, len(oltpRows))
-				for i, row := range oltpRows {
-					mapRows[i] = row
-				}
-				fmt.Printf("Retrieved %d rows directly from OLTP storage\n", len(mapRows))
-				printFormattedResults(mapRows)
-				return
-			} else {
-				fmt.Println("Direct OLTP query also returned no rows.")
-			}
-
-			// If SELECT returned no results but table exists, provide some info about the table
-			fmt.Printf("Table '%s' exists but has no rows or no rows match your query.\n", selectStmt.Table)
-			fmt.Println("Table schema:")
+		// If SELECT returned no results but table exists, provide some info about the table
+		if table := s.GetTable(selectStmt.Table); table != nil {
+			fmt.Fprintf(out, "Table '%s' exists but has no rows or no rows match your query.\n", selectStmt.Table)
+			fmt.Fprintln(out, "Table schema:")
 			for _, col := range table.Columns {
-				fmt.Printf("  %s (%s)\n", col.Name, col.Type)
+				fmt.Fprintf(out, "  %s (%s)\n", col.Name, col.Type)
 			}
-		} else if !rowsEmpty {
-			// Display rows if we have them
-			if rows, ok := result.([]map[string]interface{}); ok {
-				fmt.Printf("Retrieved %d rows\n", len(rows))
-				printFormattedResults(rows)
-			} else {
-				fmt.Println(result)
-			}
-		} else {
-			fmt.Println("Empty result set")
+			return
 		}
-
+		fmt.Fprintln(out, "Empty result set")
 		return
 	}
 
 	// For non-SELECT statements
-	result, err := stmt.Execute(s)
+	result, err := stmt.Execute(target)
 	duration := time.Since(startTime)
 
 	if err != nil {
-		fmt.Printf("Error executing statement: %v\n", err)
+		fmt.Fprintf(out, "Error executing statement: %v\n", err)
 		return
 	}
 
 	// Print the result with timing information
-	fmt.Printf("Execution completed in %v\n", duration)
+	fmt.Fprintf(out, "Execution completed in %v\n", duration)
+	if res, ok := result.(parser.ExecResult); ok {
+		verb := map[string]string{"INSERT": "inserted", "UPDATE": "updated", "DELETE": "deleted"}[stmt.Type]
+		noun := "records"
+		if res.RowsAffected == 1 {
+			noun = "record"
+		}
+		fmt.Fprintf(out, "Successfully %s %d %s\n", verb, res.RowsAffected, noun)
+		return
+	}
 	if result != nil {
 		if rows, ok := result.([]map[string]interface{}); ok {
-			fmt.Printf("Retrieved %d rows\n", len(rows))
-			printFormattedResults(rows)
+			fmt.Fprintf(out, "Retrieved %d rows\n", len(rows))
+			printFormattedResults(out, format, rows)
 		} else if typedRows, ok := result.([]types.Row); ok {
-			fmt.Printf("Retrieved %d rows\n", len(typedRows))
+			fmt.Fprintf(out, "Retrieved %d rows\n", len(typedRows))
 			// Convert typed rows to interface rows
 			mapRows := make([]map[string]interface{}, len(typedRows))
 			for i, row := range typedRows {
 				mapRows[i] = row
 			}
-			printFormattedResults(mapRows)
+			printFormattedResults(out, format, mapRows)
 		} else {
-			fmt.Println(result)
+			fmt.Fprintln(out, result)
 		}
 	}
 }
@@ -577,84 +845,73 @@ func getHistoryFilePath() string {
 	return filepath.Join(homeDir, ".ulindb_history")
 }
 
-// printFormattedResults formats and prints the results of a SELECT query in a tabular format
-func printFormattedResults(rows []map[string]interface{}) {
-	if len(rows) == 0 {
-		fmt.Println("Empty result set")
-		return
-	}
-
-	// Get column names and calculate their max width
-	columns := make([]string, 0)
-	columnWidths := make(map[string]int)
-
-	// First, gather all column names from all rows
+// printFormattedResults prints result rows in the given format
+func printFormattedResults(out io.Writer, format formatter.Format, rows []map[string]interface{}) {
+	w := formatter.NewWriter(format, out)
 	for _, row := range rows {
-		for col := range row {
-			if !contains(columns, col) {
-				columns = append(columns, col)
-				columnWidths[col] = len(col)
-			}
-		}
-	}
-
-	// Sort columns for consistent display
-	sort.Strings(columns)
-
-	// Calculate maximum width for each column
-	for _, row := range rows {
-		for _, col := range columns {
-			if val, ok := row[col]; ok {
-				valStr := fmt.Sprintf("%v", val)
-				if len(valStr) > columnWidths[col] {
-					columnWidths[col] = len(valStr)
-				}
-			}
-		}
+		w.WriteRow(row)
 	}
+	w.Flush()
+}
 
-	// Print header
-	for i, col := range columns {
-		if i > 0 {
-			fmt.Print(" | ")
-		}
-		fmt.Printf("%-*s", columnWidths[col], col)
+// handleDotCommand runs a REPL command starting with a period and reports
+// whether line was one. .format table|json|csv sets the format of the
+// results of later queries; .format alone prints it. .import [--abort]
+// <file> <table> returns the IMPORT CSV statement for the caller to run,
+// which skips the lines that do not fit the table, or with --abort stops
+// at the first one. .export [--format csv|json] <table> <file> likewise
+// returns an EXPORT of the whole table, in the format the file extension
+// names unless --format says otherwise.
+func handleDotCommand(line string, format *formatter.Format) (string, bool) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], ".") {
+		return "", false
 	}
-	fmt.Println()
-
-	// Print separator
-	for i, col := range columns {
-		if i > 0 {
-			fmt.Print("-+-")
+	if fields[0] == ".import" {
+		onError := "SKIP"
+		if len(fields) > 1 && fields[1] == "--abort" {
+			onError = "ABORT"
+			fields = fields[1:]
 		}
-		for j := 0; j < columnWidths[col]; j++ {
-			fmt.Print("-")
+		if len(fields) != 3 || strings.Contains(fields[1], "'") {
+			fmt.Println("Usage: .import [--abort] <file.csv> <table> (the file name cannot contain ')")
+			return "", true
 		}
+		return fmt.Sprintf("IMPORT CSV '%s' INTO %s ON ERROR %s;", fields[1], fields[2], onError), true
 	}
-	fmt.Println()
-
-	// Print data rows
-	for _, row := range rows {
-		for i, col := range columns {
-			if i > 0 {
-				fmt.Print(" | ")
-			}
-			val, ok := row[col]
-			if !ok {
-				val = "NULL"
+	if fields[0] == ".export" {
+		var format string
+		if len(fields) > 2 && fields[1] == "--format" {
+			format = strings.ToUpper(fields[2])
+			fields = append(fields[:1], fields[3:]...)
+		}
+		if len(fields) != 3 || strings.Contains(fields[2], "'") {
+			fmt.Println("Usage: .export [--format csv|json] <table> <file> (the file name cannot contain ')")
+			return "", true
+		}
+		if format == "" {
+			var err error
+			if format, err = parser.ExportFormat(fields[2]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return "", true
 			}
-			fmt.Printf("%-*v", columnWidths[col], val)
 		}
-		fmt.Println()
+		return fmt.Sprintf("EXPORT (SELECT * FROM %s) TO '%s' FORMAT %s;", fields[1], fields[2], format), true
 	}
-}
-
-// contains checks if a string slice contains a specific string
-func contains(slice []string, str string) bool {
-	for _, s := range slice {
-		if s == str {
-			return true
-		}
+	if fields[0] != ".format" || len(fields) > 2 {
+		fmt.Printf("Unknown command: %s (expected .format table|json|csv, .import or .export)\n", strings.TrimSpace(line))
+		return "", true
+	}
+	if len(fields) == 1 {
+		fmt.Printf("Output format: %s\n", *format)
+		return "", true
+	}
+	f, err := formatter.ParseFormat(fields[1])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return "", true
 	}
-	return false
+	*format = f
+	fmt.Printf("Output format set to %s\n", f)
+	return "", true
 }
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/zakazai/ulin-db/internal/audit"
+	"github.com/zakazai/ulin-db/internal/formatter"
+	"github.com/zakazai/ulin-db/internal/parser"
+	"github.com/zakazai/ulin-db/internal/planner"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// server runs SQL sent over TCP connections against a shared storage. The
+// protocol is line based: a command is the lines up to one ending in a
+// semicolon, as in the REPL, and exit closes the connection.
+//
+// A connection starts in the text format, where the response to a command
+// is its rows as a table and a status line, ended by a line holding a
+// single period; response lines starting with a period get a second one,
+// which clients remove. FORMAT JSON; switches the connection to line
+// delimited JSON, a {"row": {...}} line per row followed by a status line,
+// {"ok": true, ...} or {"ok": false, "error": "..."}, that ends the
+// response. FORMAT TEXT; switches back.
+//
+// Commands go only through the types.Storage interface, so the hybrid
+// storage routes and locks every one of them; the REPL's diagnostics that
+// read the OLTP storage directly are not available.
+type server struct {
+	listener      net.Listener
+	storage       types.Storage
+	auditLog      *audit.Log
+	allowUnmasked bool
+
+	mu     sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// runServer serves connections on addr until SIGINT or SIGTERM, then
+// waits for the connections to end. The caller closes the storage.
+func runServer(addr string, s types.Storage, auditLog *audit.Log, allowUnmasked bool) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &server{
+		listener:      listener,
+		storage:       s,
+		auditLog:      auditLog,
+		allowUnmasked: allowUnmasked,
+		conns:         make(map[net.Conn]bool),
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		if _, ok := <-signals; ok {
+			fmt.Println("Shutting down")
+			srv.shutdown()
+		}
+	}()
+
+	fmt.Printf("Listening on %s\n", listener.Addr())
+	err = srv.serve()
+	srv.wg.Wait()
+	return err
+}
+
+// serve accepts connections until the listener is closed
+func (srv *server) serve() error {
+	for {
+		conn, err := srv.listener.Accept()
+		if err != nil {
+			srv.mu.Lock()
+			closed := srv.closed
+			srv.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		srv.mu.Lock()
+		if srv.closed {
+			srv.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		srv.conns[conn] = true
+		srv.wg.Add(1)
+		srv.mu.Unlock()
+
+		go srv.handle(conn)
+	}
+}
+
+// shutdown stops accepting connections and closes the open ones. A
+// command already running finishes first; only its response is lost.
+func (srv *server) shutdown() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return
+	}
+	srv.closed = true
+	srv.listener.Close()
+	for conn := range srv.conns {
+		conn.Close()
+	}
+}
+
+// handle runs the commands of one connection in a session of its own. A
+// transaction left open when the connection ends is rolled back.
+func (srv *server) handle(conn net.Conn) {
+	defer srv.wg.Done()
+	defer func() {
+		srv.mu.Lock()
+		delete(srv.conns, conn)
+		srv.mu.Unlock()
+		conn.Close()
+	}()
+
+	session := parser.NewSession()
+	session.AllowUnmasked(srv.allowUnmasked)
+	defer func() {
+		if session.InTransaction() {
+			srv.execute(session, "ROLLBACK;")
+		}
+	}()
+
+	reader := bufio.NewReader(conn)
+	asJSON := false
+	command := ""
+	for {
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+		if strings.EqualFold(trimmed, "exit") {
+			return
+		}
+		if trimmed != "" {
+			if command != "" {
+				command += "\n"
+			}
+			command += strings.TrimRight(line, "\r\n")
+		}
+
+		if command != "" && (strings.HasSuffix(trimmed, ";") || err != nil) {
+			var res result
+			switch strings.ToUpper(strings.Join(strings.Fields(command), " ")) {
+			case "FORMAT JSON;":
+				asJSON = true
+				res.status = "Format JSON"
+			case "FORMAT TEXT;":
+				asJSON = false
+				res.status = "Format TEXT"
+			default:
+				res = srv.execute(session, command)
+			}
+			command = ""
+
+			var werr error
+			if asJSON {
+				werr = writeJSONResponse(conn, res)
+			} else {
+				werr = writeTextResponse(conn, res)
+			}
+			if werr != nil {
+				types.GlobalLogger.Debug("Dropping connection from %s: %v", conn.RemoteAddr(), werr)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// result is the outcome of a command: the rows it returned, if any, and
+// a short status, or the error that stopped it
+type result struct {
+	rows         []types.Row
+	rowsAffected int
+	status       string
+	err          error
+}
+
+// execute runs one command in the session against the shared storage.
+// Writes go through the audit log, so audited tables record them.
+func (srv *server) execute(session *parser.Session, command string) result {
+	if strings.EqualFold(strings.Join(strings.Fields(command), " "), "SHOW TABLES;") {
+		tables, err := srv.storage.ShowTables()
+		if err != nil {
+			return result{err: err}
+		}
+		sort.Strings(tables)
+		rows := make([]types.Row, len(tables))
+		for i, table := range tables {
+			rows[i] = types.Row{"table_name": table}
+		}
+		return result{rows: rows, status: fmt.Sprintf("%d rows", len(rows))}
+	}
+
+	stmt, err := parser.Parse(command)
+	if err != nil {
+		return result{err: err}
+	}
+	if err := stmt.CheckSupported(srv.storage.Capabilities()); err != nil {
+		return result{err: err}
+	}
+
+	// ALTER TABLE ... SET AUDIT and AUDIT LOG FOR only touch the audit log
+	switch {
+	case stmt.Type == "ALTER" && stmt.AlterStatement.Option == "AUDIT":
+		alterStmt := stmt.AlterStatement
+		if srv.storage.GetTable(alterStmt.Table) == nil {
+			return result{err: fmt.Errorf("table %s does not exist", alterStmt.Table)}
+		}
+		if err := srv.auditLog.SetEnabled(alterStmt.Table, alterStmt.Value.(bool), command); err != nil {
+			return result{err: err}
+		}
+		return result{status: "OK"}
+	case stmt.Type == "AUDIT":
+		entries, err := srv.auditLog.Entries(stmt.AuditStatement.Table, stmt.AuditStatement.Limit)
+		if err != nil {
+			return result{err: err}
+		}
+		rows := make([]types.Row, len(entries))
+		for i, entry := range entries {
+			rows[i] = entry.Row()
+		}
+		return result{rows: rows, status: fmt.Sprintf("%d rows", len(rows))}
+	}
+
+	if stmt.Type == "EXPLAIN" {
+		rendered, err := explainStatement(session, stmt.ExplainStatement, srv.storage, srv.auditLog, command)
+		if err != nil {
+			return result{err: err}
+		}
+		return result{status: strings.TrimSuffix(rendered, "\n")}
+	}
+
+	// Only the statements that write rows go through the audit log. The
+	// wrapper hides the storage's optional interfaces, which DDL, CHECK
+	// TABLE and the pushed down LIMIT and SAMPLE of reads need.
+	target := srv.storage
+	switch stmt.Type {
+	case "INSERT", "UPDATE", "DELETE", "LOAD", "IMPORT", "CREATE":
+		target = srv.auditLog.Wrap(srv.storage, command)
+	}
+	out, err := session.Execute(stmt, target)
+	if err != nil {
+		return result{err: err}
+	}
+
+	if res, ok := out.(parser.ExecResult); ok {
+		if stmt.Type == "INSERT" {
+			return result{rowsAffected: res.RowsAffected, status: fmt.Sprintf("%d rows inserted", res.RowsAffected)}
+		}
+		return result{rowsAffected: res.RowsAffected, status: fmt.Sprintf("%d rows affected", res.RowsAffected)}
+	}
+	rows, _ := out.([]types.Row)
+	if stmt.Type == "SELECT" || rows != nil {
+		if rows == nil {
+			rows = []types.Row{}
+		}
+		return result{rows: rows, status: fmt.Sprintf("%d rows", len(rows))}
+	}
+	return result{status: "OK"}
+}
+
+// writeTextResponse writes a result as the REPL would format its rows,
+// then the status or error and the line that ends a response
+func writeTextResponse(w io.Writer, res result) error {
+	var out bytes.Buffer
+	if res.err != nil {
+		fmt.Fprintf(&out, "Error: %v\n", res.err)
+	} else {
+		if len(res.rows) > 0 {
+			mapRows := make([]map[string]interface{}, len(res.rows))
+			for i, row := range res.rows {
+				mapRows[i] = row
+			}
+			printFormattedResults(&out, formatter.FormatTable, mapRows)
+		}
+		fmt.Fprintln(&out, res.status)
+	}
+	return writeResponse(w, out.Bytes())
+}
+
+// writeJSONResponse writes a result as a JSON line per row followed by a
+// status line
+func writeJSONResponse(w io.Writer, res result) error {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	if res.err != nil {
+		if err := enc.Encode(map[string]interface{}{"ok": false, "error": res.err.Error()}); err != nil {
+			return err
+		}
+		_, err := w.Write(out.Bytes())
+		return err
+	}
+
+	for _, row := range res.rows {
+		if err := enc.Encode(map[string]interface{}{"row": row}); err != nil {
+			return err
+		}
+	}
+	status := map[string]interface{}{"ok": true, "status": res.status}
+	if res.rows != nil {
+		status["rows"] = len(res.rows)
+	} else {
+		status["rows_affected"] = res.rowsAffected
+	}
+	if err := enc.Encode(status); err != nil {
+		return err
+	}
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writeResponse writes the output of a command followed by the line that
+// ends a response, doubling the period of lines that start with one
+func writeResponse(w io.Writer, output []byte) error {
+	var buf bytes.Buffer
+	for _, line := range strings.SplitAfter(string(output), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ".") {
+			buf.WriteByte('.')
+		}
+		buf.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteString(".\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// explainStatement describes the statement an EXPLAIN wraps, bound to the
+// session's variables, as EXPLAIN prints it. SELECTs are planned against
+// the hybrid storage, which routes them; EXPLAIN ANALYZE really executes
+// writes, so they are audited.
+func explainStatement(session *parser.Session, explainStmt *parser.ExplainStatement, s types.Storage, auditLog *audit.Log, command string) (string, error) {
+	inner, err := session.Bind(explainStmt.Statement)
+	if err != nil {
+		return "", err
+	}
+	plan, err := planner.CreatePlan(inner, auditLog.Wrap(s, command))
+	if err != nil {
+		return "", fmt.Errorf("failed to plan statement: %w", err)
+	}
+	if plan.Type == "SELECT" {
+		plan.Storage = s
+	}
+	desc, err := plan.Describe(explainStmt.Analyze)
+	if err != nil {
+		return "", err
+	}
+
+	if explainStmt.JSON {
+		return planner.RenderDescriptionJSON(desc)
+	}
+	return "======= Query Execution Plan =======\n" +
+		planner.RenderDescription(desc) +
+		"===================================\n", nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/audit"
+	"github.com/zakazai/ulin-db/internal/formatter"
+	"github.com/zakazai/ulin-db/internal/parser"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// newTestServer returns a server over a fresh hybrid storage whose
+// commands are run with execute, without listening
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := storage.CreateHybridStorage(storage.StorageConfig{
+		Type:         storage.BTreeStorageType,
+		FilePath:     filepath.Join(dir, "ulindb.btree"),
+		DataDir:      filepath.Join(dir, "parquet"),
+		SyncInterval: time.Hour,
+		LogLevel:     types.LogLevelError,
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"), audit.Options{AllTables: true})
+	assert.NoError(t, err)
+	t.Cleanup(func() { auditLog.Close() })
+	return &server{storage: s, auditLog: auditLog}
+}
+
+func TestServerRunsDDL(t *testing.T) {
+	srv := newTestServer(t)
+	session := parser.NewSession()
+	for _, command := range []string{
+		"CREATE TABLE users (id INT, name STRING, email STRING);",
+		"INSERT INTO users VALUES (1, 'alice', 'alice@x.com');",
+		"ALTER TABLE users ADD COLUMN phone STRING;",
+		"ALTER TABLE users ALTER COLUMN id TYPE STRING;",
+		"ALTER TABLE users ALTER COLUMN email SET MASKED;",
+		"ALTER TABLE users SET MAX_ROWS = 100;",
+		"CHECK TABLE users;",
+	} {
+		res := srv.execute(session, command)
+		assert.NoError(t, res.err, command)
+	}
+
+	res := srv.execute(session, "SELECT * FROM users;")
+	assert.NoError(t, res.err)
+	if assert.Len(t, res.rows, 1) {
+		assert.Equal(t, "1", res.rows[0]["id"])
+		assert.Contains(t, res.rows[0], "phone")
+		assert.NotEqual(t, "alice@x.com", res.rows[0]["email"])
+	}
+
+	// Only the INSERT wrote rows to audit
+	entries, err := srv.auditLog.Entries("users", 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestServerExplain(t *testing.T) {
+	srv := newTestServer(t)
+	session := parser.NewSession()
+	assert.NoError(t, srv.execute(session, "CREATE TABLE t (id INT, name STRING);").err)
+	assert.NoError(t, srv.execute(session, "INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c');").err)
+
+	res := srv.execute(session, "EXPLAIN SELECT * FROM t;")
+	assert.NoError(t, res.err)
+	assert.Contains(t, res.status, "Query Execution Plan")
+	assert.Contains(t, res.status, "Estimated Rows: 3")
+
+	res = srv.execute(session, "EXPLAIN ANALYZE FORMAT JSON SELECT * FROM t WHERE id = 2;")
+	assert.NoError(t, res.err)
+	assert.Contains(t, res.status, `"estimated_rows": 1`)
+
+	// EXPLAIN ANALYZE of a write executes it
+	res = srv.execute(session, "EXPLAIN ANALYZE DELETE FROM t WHERE id = 3;")
+	assert.NoError(t, res.err)
+	res = srv.execute(session, "SELECT * FROM t;")
+	assert.NoError(t, res.err)
+	assert.Len(t, res.rows, 2)
+}
+
+func TestREPLExplain(t *testing.T) {
+	srv := newTestServer(t)
+	s := srv.storage.(*storage.HybridStorage)
+	session := parser.NewSession()
+	var out bytes.Buffer
+	for _, cmd := range []string{
+		"CREATE TABLE t (id INT, name STRING);",
+		"INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c');",
+	} {
+		processCommand(&out, formatter.FormatTable, s, session, srv.auditLog, cmd)
+	}
+
+	// Analytical queries are estimated on a freshly synced Parquet copy
+	out.Reset()
+	processCommand(&out, formatter.FormatTable, s, session, srv.auditLog, "EXPLAIN SELECT COUNT(*) FROM t;")
+	assert.Contains(t, out.String(), "Query Execution Plan")
+	assert.Contains(t, out.String(), "Estimated Rows: 3")
+}
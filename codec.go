@@ -0,0 +1,217 @@
+package ulindb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// EncodeFunc converts a Go value to the value stored in a column
+type EncodeFunc func(value interface{}) (interface{}, error)
+
+// DecodeFunc converts a stored column value back to the Go type it was
+// registered for
+type DecodeFunc func(value interface{}) (interface{}, error)
+
+type valueCodec struct {
+	sqlType ColumnType
+	encode  EncodeFunc
+	decode  DecodeFunc
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byType map[reflect.Type]valueCodec
+}{byType: make(map[reflect.Type]valueCodec)}
+
+// RegisterValueCodec lets values of goType be written to columns of sqlType
+// by Insert and Update, and read back into struct fields of goType by
+// ScanStruct. encode receives a non-nil value of goType; decode receives a
+// non-NULL column value and must return a goType.
+//
+//	ulindb.RegisterValueCodec(reflect.TypeOf(time.Time{}), ulindb.String,
+//		func(v interface{}) (interface{}, error) { return v.(time.Time).Format(time.RFC3339Nano), nil },
+//		func(v interface{}) (interface{}, error) { return time.Parse(time.RFC3339Nano, v.(string)) })
+func RegisterValueCodec(goType reflect.Type, sqlType ColumnType, encode EncodeFunc, decode DecodeFunc) error {
+	if goType == nil || encode == nil || decode == nil {
+		return fmt.Errorf("value codec requires a Go type, an encoder and a decoder")
+	}
+	switch sqlType {
+	case Int, String, Text:
+	default:
+		return fmt.Errorf("value codec for %s: unsupported type %q", goType, sqlType)
+	}
+
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, exists := codecs.byType[goType]; exists {
+		return fmt.Errorf("value codec for %s is already registered", goType)
+	}
+	codecs.byType[goType] = valueCodec{sqlType: sqlType, encode: encode, decode: decode}
+	return nil
+}
+
+func lookupCodec(goType reflect.Type) (valueCodec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.byType[goType]
+	return codec, ok
+}
+
+// isNative reports whether the storage engines accept v as is
+func isNative(v interface{}) bool {
+	switch v.(type) {
+	case nil, string, bool, float32, float64,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// sameSQLType treats STRING and TEXT as the same type
+func sameSQLType(a, b ColumnType) bool {
+	text := func(t ColumnType) bool { return t == String || t == Text }
+	return a == b || (text(a) && text(b))
+}
+
+// encodeValues returns values with every Go value of a registered type
+// encoded for its column. Columns the table does not have are passed
+// through for the storage to reject.
+func encodeValues(table *Table, values map[string]interface{}) (map[string]interface{}, error) {
+	if table == nil || values == nil {
+		return values, nil
+	}
+	columns := make(map[string]ColumnType, len(table.Columns))
+	for _, col := range table.Columns {
+		columns[col.Name] = ColumnType(strings.ToUpper(col.Type))
+	}
+
+	encoded := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		colType, known := columns[name]
+		if !known || isNative(value) {
+			encoded[name] = value
+			continue
+		}
+
+		// A nil pointer is NULL; any other pointer stores what it points to
+		v := reflect.ValueOf(value)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				encoded[name] = nil
+				continue
+			}
+			if value = v.Elem().Interface(); isNative(value) {
+				encoded[name] = value
+				continue
+			}
+		}
+
+		codec, ok := lookupCodec(reflect.TypeOf(value))
+		if !ok {
+			return nil, fmt.Errorf("column %s: no value codec registered for Go type %T", name, value)
+		}
+		if !sameSQLType(codec.sqlType, colType) {
+			return nil, fmt.Errorf("column %s: Go type %T encodes to %s, column is %s", name, value, codec.sqlType, colType)
+		}
+		stored, err := codec.encode(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: encoding %T: %w", name, value, err)
+		}
+		encoded[name] = stored
+	}
+	return encoded, nil
+}
+
+// ScanStruct copies a result row into the struct dest points to. A field
+// is filled from the column named by its `ulindb:"name"` tag, or else the
+// column matching its name case-insensitively; a tag of "-" skips it.
+// Fields of a registered Go type are decoded with its codec, and NULL
+// leaves a field at its zero value (nil for a pointer field).
+func ScanStruct(row Row, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct requires a non-nil pointer to a struct, got %T", dest)
+	}
+	v = v.Elem()
+
+	columns := make(map[string]string, len(row))
+	for name := range row {
+		columns[strings.ToLower(name)] = name
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name := field.Tag.Get("ulindb")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		column, ok := columns[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		if err := scanValue(v.Field(i), row[column]); err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// scanValue stores a column value in a struct field
+func scanValue(field reflect.Value, value interface{}) error {
+	if value == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := scanValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if codec, ok := lookupCodec(field.Type()); ok {
+		decoded, err := codec.decode(value)
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", field.Type(), err)
+		}
+		dv := reflect.ValueOf(decoded)
+		if !dv.IsValid() || dv.Type() != field.Type() {
+			return fmt.Errorf("codec for %s decoded a %T", field.Type(), decoded)
+		}
+		field.Set(dv)
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Type().AssignableTo(field.Type()):
+		field.Set(v)
+	case isNumber(v.Kind()) && isNumber(field.Kind()):
+		// INT columns come back as int64, counts as int and averages as float64
+		field.Set(v.Convert(field.Type()))
+	default:
+		return fmt.Errorf("cannot scan %T into %s", value, field.Type())
+	}
+	return nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
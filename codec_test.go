@@ -0,0 +1,120 @@
+package ulindb
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testUUID stands in for a third-party UUID type
+type testUUID [16]byte
+
+func (u testUUID) String() string { return hex.EncodeToString(u[:]) }
+
+var registerTestCodecs sync.Once
+
+func openCodecDB(t *testing.T) *DB {
+	t.Helper()
+	registerTestCodecs.Do(func() {
+		assert.NoError(t, RegisterValueCodec(reflect.TypeOf(testUUID{}), String,
+			func(v interface{}) (interface{}, error) { return v.(testUUID).String(), nil },
+			func(v interface{}) (interface{}, error) {
+				s, ok := v.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected a string, got %T", v)
+				}
+				var u testUUID
+				_, err := hex.Decode(u[:], []byte(s))
+				return u, err
+			}))
+		assert.NoError(t, RegisterValueCodec(reflect.TypeOf(time.Time{}), String,
+			func(v interface{}) (interface{}, error) { return v.(time.Time).UTC().Format(time.RFC3339Nano), nil },
+			func(v interface{}) (interface{}, error) { return time.Parse(time.RFC3339Nano, v.(string)) }))
+	})
+
+	db, err := Open(Config{Type: MemoryStorage})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { db.Close() })
+
+	schema, err := NewTable("sessions").
+		Column("id", String, NotNull).
+		Column("user_id", Int).
+		Column("started", Text).
+		Column("ended", String).
+		Build()
+	assert.NoError(t, err)
+	assert.NoError(t, db.CreateTable(schema))
+	return db
+}
+
+type session struct {
+	ID      testUUID   `ulindb:"id"`
+	UserID  int        `ulindb:"user_id"`
+	Started time.Time  `ulindb:"started"`
+	Ended   *time.Time `ulindb:"ended"`
+	Note    string     `ulindb:"-"`
+}
+
+func TestValueCodecRoundTrip(t *testing.T) {
+	db := openCodecDB(t)
+	id := testUUID{0xde, 0xad, 0xbe, 0xef}
+	started := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	var noEnd *time.Time
+	assert.NoError(t, db.Insert("sessions", map[string]interface{}{
+		"id": id, "user_id": 7, "started": started, "ended": noEnd,
+	}))
+
+	rows, err := db.Select("sessions", []string{"*"}, map[string]interface{}{"id": id})
+	assert.NoError(t, err)
+	if !assert.Len(t, rows, 1) {
+		return
+	}
+	assert.Equal(t, id.String(), rows[0]["id"])
+	assert.Nil(t, rows[0]["ended"])
+
+	var got session
+	assert.NoError(t, ScanStruct(rows[0], &got))
+	assert.Equal(t, session{ID: id, UserID: 7, Started: started}, got)
+
+	// Update encodes both the new values and the WHERE values
+	ended := started.Add(time.Hour)
+	updated, err := db.Update("sessions", map[string]interface{}{"ended": &ended}, map[string]interface{}{"id": id})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+	rows, err = db.Select("sessions", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, ScanStruct(rows[0], &got))
+	if assert.NotNil(t, got.Ended) {
+		assert.True(t, ended.Equal(*got.Ended))
+	}
+}
+
+func TestValueCodecErrors(t *testing.T) {
+	db := openCodecDB(t)
+	type point struct{ X, Y int }
+
+	err := db.Insert("sessions", map[string]interface{}{"id": point{1, 2}})
+	assert.EqualError(t, err, "column id: no value codec registered for Go type ulindb.point")
+
+	err = db.Insert("sessions", map[string]interface{}{"id": "a", "user_id": testUUID{}})
+	assert.EqualError(t, err, "column user_id: Go type ulindb.testUUID encodes to STRING, column is INT")
+
+	err = RegisterValueCodec(reflect.TypeOf(testUUID{}), String,
+		func(v interface{}) (interface{}, error) { return nil, nil },
+		func(v interface{}) (interface{}, error) { return nil, nil })
+	assert.EqualError(t, err, "value codec for ulindb.testUUID is already registered")
+
+	var got session
+	err = ScanStruct(Row{"id": "not hex"}, &got)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "column id: decoding ulindb.testUUID")
+	assert.EqualError(t, ScanStruct(Row{}, got), "ScanStruct requires a non-nil pointer to a struct, got ulindb.session")
+}
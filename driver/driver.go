@@ -0,0 +1,192 @@
+// Package driver registers UlinDB with database/sql under the name
+// "ulindb". The data source name is a UlinDB connection string (see
+// ulindb.ParseDSN):
+//
+//	db, err := sql.Open("ulindb", "btree:///var/lib/ulindb/db.btree")
+//	db, err := sql.Open("ulindb", "memory://")
+//	db, err := sql.Open("ulindb", "data/db.btree")
+//
+// A name without a scheme is the path of a B-tree file, taken as is, with
+// no URL escaping.
+//
+// Statements are UlinDB SQL with ? placeholders for arguments. Every
+// connection of a sql.DB shares one storage, which is closed with the
+// sql.DB, and has its own session for @variables and settings.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+
+	ulindb "github.com/zakazai/ulin-db"
+	"github.com/zakazai/ulin-db/internal/parser"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func init() {
+	sql.Register("ulindb", &Driver{})
+}
+
+// Driver implements driver.Driver and driver.DriverContext
+type Driver struct{}
+
+// Open implements driver.Driver. The connection has a storage of its own,
+// closed with it; sql.DB uses OpenConnector instead, sharing the storage.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, err := d.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{connector: c.(*connector), session: parser.NewSession(), owner: true}, nil
+}
+
+// OpenConnector implements driver.DriverContext by opening the storage the
+// connections of a sql.DB share
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	dsn, err := parseName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var store storage.Storage
+	if dsn.Hybrid {
+		store, err = storage.CreateHybridStorage(dsn.Config)
+	} else {
+		store, err = storage.NewStorage(dsn.Config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &connector{driver: d, store: store, readOnly: dsn.ReadOnly}, nil
+}
+
+// parseName parses a data source name. A name without a scheme is used
+// as the path as is: read as a URL, a # or ? would end it and %20 would be
+// unescaped.
+func parseName(name string) (*ulindb.DSN, error) {
+	if strings.Contains(name, "://") {
+		return ulindb.ParseDSN(name)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("invalid DSN: empty data source name")
+	}
+	return &ulindb.DSN{Config: ulindb.Config{
+		Type:     ulindb.BTreeStorage,
+		FilePath: name,
+		LogLevel: types.LogLevelInfo,
+	}}, nil
+}
+
+// connector implements driver.Connector. It implements io.Closer too, so
+// closing the sql.DB closes the storage.
+type connector struct {
+	driver   *Driver
+	store    storage.Storage
+	readOnly bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Connect implements driver.Connector
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{connector: c, session: parser.NewSession()}, nil
+}
+
+// Driver implements driver.Connector
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close closes the storage once
+func (c *connector) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.store.Close()
+	})
+	return c.closeErr
+}
+
+// conn implements driver.Conn. Its session runs the statements, so
+// BEGIN ... COMMIT and @variables apply to the one connection.
+type conn struct {
+	connector *connector
+	session   *parser.Session
+	owner     bool // the connection closes the storage (Driver.Open)
+	closed    bool
+}
+
+// Prepare implements driver.Conn
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if c.closed {
+		return nil, driver.ErrBadConn
+	}
+	prepared, err := parser.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, prepared: prepared}, nil
+}
+
+// Close implements driver.Conn. A transaction left open is rolled back.
+func (c *conn) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.session.InTransaction() {
+		c.run("ROLLBACK")
+	}
+	if c.owner {
+		return c.connector.Close()
+	}
+	return nil
+}
+
+// Begin implements driver.Conn with the session's BEGIN ... COMMIT
+func (c *conn) Begin() (driver.Tx, error) {
+	if err := c.run("BEGIN"); err != nil {
+		return nil, err
+	}
+	return &tx{conn: c}, nil
+}
+
+// run executes a statement without arguments or results
+func (c *conn) run(query string) error {
+	stmt, err := parser.Parse(query)
+	if err != nil {
+		return err
+	}
+	_, err = c.session.Execute(stmt, c.connector.store)
+	return err
+}
+
+// tx implements driver.Tx
+type tx struct {
+	conn *conn
+}
+
+// Commit implements driver.Tx
+func (t *tx) Commit() error {
+	return t.conn.run("COMMIT")
+}
+
+// Rollback implements driver.Tx
+func (t *tx) Rollback() error {
+	return t.conn.run("ROLLBACK")
+}
+
+// checkWritable rejects a write through a connection opened with
+// readonly=true, the way ulindb.DB does
+func (c *conn) checkWritable(stmt *parser.Statement) error {
+	if !c.connector.readOnly {
+		return nil
+	}
+	caps := c.connector.store.Capabilities()
+	caps.ReadOnly = true
+	return stmt.CheckSupported(caps)
+}
@@ -0,0 +1,192 @@
+package driver_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "github.com/zakazai/ulin-db/driver"
+)
+
+type employee struct {
+	id     int
+	name   string
+	dept   sql.NullString
+	salary float64
+}
+
+func scanEmployees(t *testing.T, db *sql.DB, query string, args ...interface{}) []employee {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if !assert.NoError(t, err, query) {
+		return nil
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name", "dept", "salary"}, columns)
+
+	var got []employee
+	for rows.Next() {
+		var e employee
+		assert.NoError(t, rows.Scan(&e.id, &e.name, &e.dept, &e.salary))
+		got = append(got, e)
+	}
+	assert.NoError(t, rows.Err())
+	return got
+}
+
+func TestDriver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "driver.btree")
+	db, err := sql.Open("ulindb", "btree://"+path+"?log=error")
+	assert.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE employees (id INT PRIMARY KEY, name STRING, dept STRING, salary INT)")
+	assert.NoError(t, err)
+	result, err := db.Exec("INSERT INTO employees VALUES (?, ?, ?, ?), (2, 'Bob', NULL, 50000)", 1, "Ann", "Sales", 72000)
+	assert.NoError(t, err)
+	affected, err := result.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+
+	// SELECT * follows the schema order, whatever the order of the row map
+	got := scanEmployees(t, db, "SELECT * FROM employees WHERE id = ?", 1)
+	assert.Equal(t, []employee{{1, "Ann", sql.NullString{String: "Sales", Valid: true}, 72000}}, got)
+	got = scanEmployees(t, db, "SELECT id, name, dept, salary FROM employees WHERE id = 2")
+	assert.Equal(t, []employee{{2, "Bob", sql.NullString{}, 50000}}, got)
+
+	result, err = db.Exec("UPDATE employees SET salary = ? WHERE salary < ?", 60000, 100000)
+	assert.NoError(t, err)
+	affected, err = result.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), affected)
+
+	// A rolled back transaction leaves no trace
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec("DELETE FROM employees WHERE id = 1")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM employees").Scan(&count))
+	assert.Equal(t, 2, count)
+
+	_, err = db.Exec("INSERT INTO employees VALUES (?, ?, NULL, 1)", "three", "Cy")
+	assert.Error(t, err)
+	assert.NoError(t, db.Close())
+
+	// The rows are in the file, and readonly rejects writes
+	db, err = sql.Open("ulindb", "btree://"+path+"?log=error&readonly=true")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var name string
+	var salary int64
+	assert.NoError(t, db.QueryRow("SELECT name, salary FROM employees WHERE id = ?", 2).Scan(&name, &salary))
+	assert.Equal(t, "Bob", name)
+	assert.Equal(t, int64(60000), salary)
+	_, err = db.Exec("DELETE FROM employees")
+	assert.EqualError(t, err, "DELETE is not supported by this storage backend (read-only)")
+}
+
+func TestDriverMemory(t *testing.T) {
+	db, err := sql.Open("ulindb", "memory://?log=error")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// The connections of the sql.DB share one storage
+	_, err = db.Exec("CREATE TABLE t (id INT, label TEXT)")
+	assert.NoError(t, err)
+	_, err = db.Exec("INSERT INTO t (id, label) VALUES (?, ?)", 7, []byte("seven"))
+	assert.NoError(t, err)
+
+	var id int
+	var label string
+	assert.NoError(t, db.QueryRow("SELECT label, id FROM t").Scan(&label, &id))
+	assert.Equal(t, 7, id)
+	assert.Equal(t, "seven", label)
+
+	_, err = sql.Open("ulindb", "mysql://localhost")
+	assert.EqualError(t, err, `invalid DSN: unknown scheme "mysql" (expected ulindb, btree, json, parquet or memory)`)
+}
+
+func TestDriverBarePathIsNotEscaped(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b#1.btree", "c%20.btree", "d?page_size=1.btree"} {
+		path := filepath.Join(dir, name)
+		db, err := sql.Open("ulindb", path)
+		assert.NoError(t, err, name)
+		_, err = db.Exec("CREATE TABLE t (id INT)")
+		assert.NoError(t, err, name)
+		assert.NoError(t, db.Close())
+		assert.FileExists(t, path)
+	}
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	_, err = sql.Open("ulindb", "")
+	assert.Error(t, err)
+}
+
+func TestDriverTimes(t *testing.T) {
+	db, err := sql.Open("ulindb", "memory://?log=error")
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE events (id INT, day DATE, at TIMESTAMP)")
+	assert.NoError(t, err)
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	_, err = db.Exec("INSERT INTO events VALUES (?, ?, ?)", 1, at, at)
+	assert.NoError(t, err)
+
+	// DATE and TIMESTAMP columns scan into times in UTC
+	var day, stamp time.Time
+	assert.NoError(t, db.QueryRow("SELECT day, at FROM events WHERE at = ?", at).Scan(&day, &stamp))
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), day)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC), stamp)
+
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM events WHERE day = ?", at).Scan(&count))
+	assert.Equal(t, 1, count)
+}
+
+func TestDriverCRUD(t *testing.T) {
+	// A bare path opens a B-tree file
+	path := filepath.Join(t.TempDir(), "crud.btree")
+	db, err := sql.Open("ulindb", path)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE employees (id INT PRIMARY KEY, name STRING, dept STRING, salary INT)")
+	assert.NoError(t, err)
+	for i, name := range []string{"Ann", "Bob", "Cy"} {
+		_, err = db.Exec("INSERT INTO employees VALUES (?, ?, ?, ?)", i+1, name, "Sales", 50000+i*1000)
+		assert.NoError(t, err)
+	}
+	got := scanEmployees(t, db, "SELECT * FROM employees WHERE dept = ?", "Sales")
+	assert.Len(t, got, 3)
+
+	result, err := db.Exec("UPDATE employees SET dept = ? WHERE name = ?", "Ops", "Bob")
+	assert.NoError(t, err)
+	affected, err := result.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	result, err = db.Exec("DELETE FROM employees WHERE id = ?", 3)
+	assert.NoError(t, err)
+	affected, err = result.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	got = scanEmployees(t, db, "SELECT * FROM employees WHERE id < ?", 10)
+	assert.ElementsMatch(t, []employee{
+		{1, "Ann", sql.NullString{String: "Sales", Valid: true}, 50000},
+		{2, "Bob", sql.NullString{String: "Ops", Valid: true}, 51000},
+	}, got)
+}
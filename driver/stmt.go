@@ -0,0 +1,166 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+
+	"github.com/zakazai/ulin-db/internal/parser"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// stmt implements driver.Stmt on a prepared statement
+type stmt struct {
+	conn     *conn
+	prepared *parser.Prepared
+}
+
+// Close implements driver.Stmt
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput implements driver.Stmt
+func (s *stmt) NumInput() int {
+	return s.prepared.NumPlaceholders()
+}
+
+// execute binds args and runs the statement in the connection's session
+func (s *stmt) execute(args []driver.Value) (*parser.Statement, interface{}, error) {
+	if s.conn.closed {
+		return nil, nil, driver.ErrBadConn
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if b, ok := arg.([]byte); ok {
+			arg = string(b)
+		}
+		values[i] = arg
+	}
+
+	store := s.conn.connector.store
+	bound, err := s.prepared.Bind(store, values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.conn.checkWritable(bound); err != nil {
+		return nil, nil, err
+	}
+	result, err := s.conn.session.Execute(bound, store)
+	return bound, result, err
+}
+
+// Exec implements driver.Stmt. UPDATE and DELETE report the rows they
+// changed, and INSERT the rows it added.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, result, err := s.execute(args)
+	if err != nil {
+		return nil, err
+	}
+	if res, ok := result.(parser.ExecResult); ok {
+		return driver.RowsAffected(res.RowsAffected), nil
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// Query implements driver.Stmt
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	bound, result, err := s.execute(args)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := result.([]types.Row)
+	r := &rows{data: data}
+	r.columns = resultColumns(bound, s.conn.connector.store, data)
+	r.colTypes = resultTypes(bound, s.conn.connector.store, r.columns)
+	return r, nil
+}
+
+// resultColumns returns the columns of a result, for a SELECT in the
+// order it selects them (see SelectStatement.ResultColumns) and otherwise
+// in name order
+func resultColumns(stmt *parser.Statement, store types.Storage, data []types.Row) []string {
+	if stmt.Type == "SELECT" {
+		sel := stmt.SelectStatement
+		return sel.ResultColumns(store.GetTable(sel.Table), data)
+	}
+	return (&parser.SelectStatement{}).ResultColumns(nil, data)
+}
+
+// resultTypes returns the type of each result column of a SELECT that
+// names a column of its table, and "" for the others
+func resultTypes(stmt *parser.Statement, store types.Storage, columns []string) []string {
+	colTypes := make([]string, len(columns))
+	if stmt.Type != "SELECT" {
+		return colTypes
+	}
+	table := store.GetTable(stmt.SelectStatement.Table)
+	if table == nil {
+		return colTypes
+	}
+	for i, name := range columns {
+		for _, col := range table.Columns {
+			if col.Name == name {
+				colTypes[i] = col.Type
+			}
+		}
+	}
+	return colTypes
+}
+
+// rows implements driver.Rows over a materialized result
+type rows struct {
+	columns  []string
+	colTypes []string // column types, "" if unknown
+	data     []types.Row
+	pos      int
+}
+
+// Columns implements driver.Rows
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+// Close implements driver.Rows
+func (r *rows) Close() error {
+	r.data = nil
+	return nil
+}
+
+// Next implements driver.Rows. A column missing from a row is NULL.
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.data) {
+		return io.EOF
+	}
+	row := r.data[r.pos]
+	r.pos++
+	for i, col := range r.columns {
+		colType := ""
+		if i < len(r.colTypes) {
+			colType = r.colTypes[i]
+		}
+		dest[i] = driverValue(colType, row[col])
+	}
+	return nil
+}
+
+// driverValue converts a stored value to one of the types database/sql
+// accepts. Values of DATE and TIMESTAMP columns are times in UTC.
+func driverValue(colType string, value interface{}) driver.Value {
+	if types.IsTimeType(colType) && value != nil {
+		if t, err := types.ParseTime(colType, value); err == nil {
+			return t.UTC()
+		}
+	}
+	switch v := value.(type) {
+	case nil, int64, float64, bool, string, []byte:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,162 @@
+package ulindb
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// DSN is a parsed connection string. The supported forms are
+//
+//	ulindb://hybrid?btree=data/ulindb.btree&parquet=data/parquet&sync=5m
+//	btree:///var/lib/ulindb/db.btree?page_size=8192
+//	json:///var/lib/ulindb?prefix=app_
+//	parquet:///var/lib/ulindb/parquet
+//	memory://
+//
+// Every form also accepts log (debug, info, warn, error or none), strict
+// and readonly. Paths are URL-escaped (my%20data), and a path written as
+// the host (json://data) is relative to the working directory.
+type DSN struct {
+	Config Config
+
+	// Hybrid uses BTree for OLTP with Parquet for OLAP (ulindb://hybrid)
+	Hybrid bool
+
+	// ReadOnly rejects writes through the DB
+	ReadOnly bool
+}
+
+// dsnParams lists the parameters each scheme accepts besides the common
+// ones
+var dsnParams = map[string][]string{
+	"hybrid":  {"btree", "parquet", "sync", "page_size", "history"},
+	"btree":   {"page_size"},
+	"json":    {"prefix"},
+	"parquet": {},
+	"memory":  {},
+}
+
+var dsnCommonParams = []string{"log", "strict", "readonly"}
+
+// ParseDSN parses and validates a connection string
+func ParseDSN(dsn string) (*DSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+
+	mode := strings.ToLower(u.Scheme)
+	path := u.Host + u.Path
+	if mode == "ulindb" {
+		if u.Host != "hybrid" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid DSN: ulindb:// supports only ulindb://hybrid, got %q", u.Host+u.Path)
+		}
+		mode, path = "hybrid", ""
+	}
+	allowed, ok := dsnParams[mode]
+	if !ok {
+		return nil, fmt.Errorf("invalid DSN: unknown scheme %q (expected ulindb, btree, json, parquet or memory)", u.Scheme)
+	}
+
+	params, err := dsnValues(u, mode, append(allowed, dsnCommonParams...))
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DSN{Config: Config{LogLevel: types.LogLevelInfo}}
+	switch mode {
+	case "hybrid":
+		d.Hybrid = true
+		d.Config.Type = BTreeStorage
+		d.Config.FilePath = params["btree"]
+		d.Config.DataDir = params["parquet"]
+		if d.Config.FilePath == "" {
+			return nil, fmt.Errorf("invalid DSN: ulindb://hybrid requires the btree parameter")
+		}
+		if d.Config.DataDir == "" {
+			d.Config.DataDir = filepath.Join(filepath.Dir(d.Config.FilePath), "parquet")
+		}
+		if d.Config.DataDir == d.Config.FilePath {
+			return nil, fmt.Errorf("invalid DSN: btree and parquet must be different paths")
+		}
+	case "btree", "json", "parquet":
+		if path == "" {
+			return nil, fmt.Errorf("invalid DSN: %s:// requires a path", mode)
+		}
+		d.Config.Type = storage.StorageType(mode)
+		if mode == "btree" {
+			d.Config.FilePath = path
+		} else {
+			d.Config.DataDir = path
+		}
+		d.Config.FilePrefix = params["prefix"]
+	case "memory":
+		if path != "" {
+			return nil, fmt.Errorf("invalid DSN: memory:// takes no path, got %q", path)
+		}
+		d.Config.Type = MemoryStorage
+	}
+
+	if v, ok := params["sync"]; ok {
+		if d.Config.SyncInterval, err = time.ParseDuration(v); err != nil || d.Config.SyncInterval <= 0 {
+			return nil, fmt.Errorf("invalid DSN: sync must be a positive duration such as 5m, got %q", v)
+		}
+	}
+	if v, ok := params["page_size"]; ok {
+		if d.Config.PageSize, err = strconv.Atoi(v); err != nil || d.Config.PageSize <= 0 {
+			return nil, fmt.Errorf("invalid DSN: page_size must be a positive integer, got %q", v)
+		}
+	}
+	if v, ok := params["history"]; ok {
+		if d.Config.RoutingHistorySize, err = strconv.Atoi(v); err != nil || d.Config.RoutingHistorySize <= 0 {
+			return nil, fmt.Errorf("invalid DSN: history must be a positive integer, got %q", v)
+		}
+	}
+	if v, ok := params["log"]; ok {
+		if d.Config.LogLevel, err = types.ParseLogLevel(v); err != nil {
+			return nil, fmt.Errorf("invalid DSN: log %v", err)
+		}
+	}
+	for name, dst := range map[string]*bool{"strict": &d.Config.Strict, "readonly": &d.ReadOnly} {
+		if v, ok := params[name]; ok {
+			if *dst, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid DSN: %s must be true or false, got %q", name, v)
+			}
+		}
+	}
+	return d, nil
+}
+
+// dsnValues returns the query parameters of u, rejecting parameters mode
+// does not accept and parameters given more than once
+func dsnValues(u *url.URL, mode string, allowed []string) (map[string]string, error) {
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+
+	known := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		known[name] = true
+	}
+	params := make(map[string]string, len(query))
+	for name, values := range query {
+		if !known[name] {
+			sort.Strings(allowed)
+			return nil, fmt.Errorf("invalid DSN: unknown parameter %q for %s (expected one of %s)", name, mode, strings.Join(allowed, ", "))
+		}
+		if len(values) > 1 {
+			return nil, fmt.Errorf("invalid DSN: parameter %q is set %d times", name, len(values))
+		}
+		params[name] = values[0]
+	}
+	return params, nil
+}
@@ -0,0 +1,99 @@
+package ulindb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want DSN
+	}{
+		{
+			"ulindb://hybrid?btree=/data/db.btree&parquet=/data/parquet&sync=5m&log=warn&readonly=true",
+			DSN{
+				Config: Config{
+					Type:         BTreeStorage,
+					FilePath:     "/data/db.btree",
+					DataDir:      "/data/parquet",
+					SyncInterval: 5 * time.Minute,
+					LogLevel:     types.LogLevelWarning,
+				},
+				Hybrid:   true,
+				ReadOnly: true,
+			},
+		},
+		{
+			"ulindb://hybrid?btree=data/ulindb.btree&page_size=8192&history=16",
+			DSN{
+				Config: Config{
+					Type:               BTreeStorage,
+					FilePath:           "data/ulindb.btree",
+					DataDir:            filepath.Join("data", "parquet"),
+					PageSize:           8192,
+					RoutingHistorySize: 16,
+					LogLevel:           types.LogLevelInfo,
+				},
+				Hybrid: true,
+			},
+		},
+		{"memory://", DSN{Config: Config{Type: MemoryStorage, LogLevel: types.LogLevelInfo}}},
+		{"memory://?strict=true&log=none", DSN{Config: Config{Type: MemoryStorage, Strict: true, LogLevel: types.LogLevelNone}}},
+		{"json:///path?prefix=app_", DSN{Config: Config{Type: JSONStorage, DataDir: "/path", FilePrefix: "app_", LogLevel: types.LogLevelInfo}}},
+		{"json://relative/dir", DSN{Config: Config{Type: JSONStorage, DataDir: "relative/dir", LogLevel: types.LogLevelInfo}}},
+		{"btree:///my%20data/db.btree", DSN{Config: Config{Type: BTreeStorage, FilePath: "/my data/db.btree", LogLevel: types.LogLevelInfo}}},
+		{"parquet:///var/lib/ulindb", DSN{Config: Config{Type: ParquetStorage, DataDir: "/var/lib/ulindb", LogLevel: types.LogLevelInfo}}},
+		{
+			"ulindb://hybrid?btree=%2Fmy%20data%2Fdb.btree&parquet=/my+data/parquet",
+			DSN{
+				Config: Config{Type: BTreeStorage, FilePath: "/my data/db.btree", DataDir: "/my data/parquet", LogLevel: types.LogLevelInfo},
+				Hybrid: true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseDSN(tt.dsn)
+		if assert.NoError(t, err, tt.dsn) {
+			assert.Equal(t, tt.want, *got, tt.dsn)
+		}
+	}
+}
+
+func TestParseDSNErrors(t *testing.T) {
+	tests := map[string]string{
+		"mysql://localhost/db":                        `invalid DSN: unknown scheme "mysql" (expected ulindb, btree, json, parquet or memory)`,
+		"ulindb://cluster":                            `invalid DSN: ulindb:// supports only ulindb://hybrid, got "cluster"`,
+		"ulindb://hybrid?parquet=/data":               "invalid DSN: ulindb://hybrid requires the btree parameter",
+		"ulindb://hybrid?btree=/d&parquet=/d":         "invalid DSN: btree and parquet must be different paths",
+		"ulindb://hybrid?btree=/d&sync=often":         `invalid DSN: sync must be a positive duration such as 5m, got "often"`,
+		"ulindb://hybrid?btree=/d&log=loud":           `invalid DSN: log must be debug, info, warn, error or none, got "loud"`,
+		"ulindb://hybrid?btree=/d&log=warn&log=debug": `invalid DSN: parameter "log" is set 2 times`,
+		"json:///path?sync=5m":                        `invalid DSN: unknown parameter "sync" for json (expected one of log, prefix, readonly, strict)`,
+		"json://":                                     "invalid DSN: json:// requires a path",
+		"memory:///tmp":                               `invalid DSN: memory:// takes no path, got "/tmp"`,
+		"btree:///db.btree?page_size=-1":              `invalid DSN: page_size must be a positive integer, got "-1"`,
+		"memory://?readonly=maybe":                    `invalid DSN: readonly must be true or false, got "maybe"`,
+	}
+	for dsn, want := range tests {
+		_, err := ParseDSN(dsn)
+		assert.EqualError(t, err, want, dsn)
+	}
+}
+
+func TestOpenDSNReadOnly(t *testing.T) {
+	db, err := OpenDSN("memory://?readonly=true")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	schema, err := NewTable("events").Column("id", Int).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, ErrReadOnly, db.CreateTable(schema))
+	assert.Equal(t, ErrReadOnly, db.Insert("events", map[string]interface{}{"id": 1}))
+}
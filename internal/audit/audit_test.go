@@ -0,0 +1,132 @@
+package audit_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/audit"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func newAccounts(t *testing.T) *storage.InMemoryStorage {
+	t.Helper()
+	store := storage.NewInMemoryStorage()
+	for _, name := range []string{"accounts", "sessions"} {
+		err := store.CreateTable(&types.Table{
+			Name: name,
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "INT"},
+				{Name: "owner", Type: "STRING"},
+			},
+		})
+		assert.NoError(t, err)
+	}
+	return store
+}
+
+func TestAuditLogRecordsWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path, audit.Options{Sync: true})
+	assert.NoError(t, err)
+	defer log.Close()
+
+	store := newAccounts(t)
+	assert.NoError(t, log.SetEnabled("accounts", true, "ALTER TABLE accounts SET AUDIT = true;"))
+
+	insert := "INSERT INTO accounts VALUES (1, 'ann');"
+	assert.NoError(t, log.Wrap(store, insert).Insert("accounts", map[string]interface{}{"id": 1, "owner": "ann"}))
+
+	update := "UPDATE accounts SET owner = 'bob' WHERE id = 1;"
+	updated, err := log.Wrap(store, update).Update("accounts",
+		map[string]interface{}{"owner": "bob"}, types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	// Reads are never audited
+	rows, err := log.Wrap(store, "SELECT * FROM accounts;").Select("accounts", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+
+	del := "DELETE FROM accounts WHERE id = 1;"
+	deleted, err := log.Wrap(store, del).Delete("accounts", types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	// Writes to tables without auditing are not recorded
+	assert.NoError(t, log.Wrap(store, "INSERT INTO sessions VALUES (1, 'ann');").
+		Insert("sessions", map[string]interface{}{"id": 1, "owner": "ann"}))
+
+	entries, err := log.Entries("accounts", 0)
+	assert.NoError(t, err)
+	if !assert.Len(t, entries, 4) {
+		return
+	}
+
+	// Newest first
+	assert.Equal(t, audit.OpDelete, entries[0].Operation)
+	assert.Equal(t, del, entries[0].Statement)
+	assert.Equal(t, "bob", entries[0].Rows[0]["owner"])
+
+	assert.Equal(t, audit.OpUpdate, entries[1].Operation)
+	assert.Equal(t, update, entries[1].Statement)
+	assert.Equal(t, "ann", entries[1].Rows[0]["owner"], "UPDATE records rows before the change")
+	assert.Equal(t, "bob", entries[1].Set["owner"])
+
+	assert.Equal(t, audit.OpInsert, entries[2].Operation)
+	assert.Equal(t, insert, entries[2].Statement)
+	assert.Equal(t, "ann", entries[2].Rows[0]["owner"])
+
+	assert.Equal(t, audit.OpAuditOn, entries[3].Operation)
+
+	for i := 1; i < len(entries); i++ {
+		assert.Greater(t, entries[i-1].Seq, entries[i].Seq)
+	}
+
+	sessions, err := log.Entries("sessions", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	limited, err := log.Entries("accounts", 2)
+	assert.NoError(t, err)
+	assert.Len(t, limited, 2)
+	assert.Equal(t, audit.OpDelete, limited[0].Operation)
+}
+
+func TestAuditLogReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path, audit.Options{})
+	assert.NoError(t, err)
+
+	store := newAccounts(t)
+	assert.NoError(t, log.SetEnabled("accounts", true, ""))
+	assert.NoError(t, log.SetEnabled("sessions", true, ""))
+	assert.NoError(t, log.SetEnabled("sessions", false, ""))
+	assert.NoError(t, log.Close())
+
+	// Audited tables and the sequence survive a restart
+	log, err = audit.Open(path, audit.Options{})
+	assert.NoError(t, err)
+	defer log.Close()
+	assert.True(t, log.Enabled("accounts"))
+	assert.False(t, log.Enabled("sessions"))
+
+	assert.NoError(t, log.Wrap(store, "").Insert("accounts", map[string]interface{}{"id": 1, "owner": "ann"}))
+	entries, err := log.Entries("accounts", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), entries[0].Seq)
+}
+
+func TestAuditLogAllTables(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), audit.Options{AllTables: true})
+	assert.NoError(t, err)
+	defer log.Close()
+
+	store := newAccounts(t)
+	assert.NoError(t, log.Wrap(store, "").Insert("sessions", map[string]interface{}{"id": 1, "owner": "ann"}))
+
+	entries, err := log.Entries("sessions", 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// auditedStorage records the writes of a single statement against the
+// wrapped storage. Reads pass straight through and are never logged.
+type auditedStorage struct {
+	types.Storage
+	log       *Log
+	statement string
+}
+
+// Wrap returns a storage that appends an entry to the log for every
+// successful write to an audited table, attributed to the given statement
+// text. Wrap is called once per statement, so concurrent sessions never
+// share attribution state. A nil log returns s unchanged.
+func (l *Log) Wrap(s types.Storage, statement string) types.Storage {
+	if l == nil {
+		return s
+	}
+	return &auditedStorage{Storage: s, log: l, statement: statement}
+}
+
+func (s *auditedStorage) Insert(table string, values map[string]interface{}) error {
+	if err := s.Storage.Insert(table, values); err != nil {
+		return err
+	}
+	if !s.log.Enabled(table) {
+		return nil
+	}
+	return s.log.Append(Entry{
+		Table:     table,
+		Operation: OpInsert,
+		Statement: s.statement,
+		Rows:      []types.Row{types.Row(values)},
+	})
+}
+
+// InsertRows implements types.BatchInserter, recording the rows of a
+// multi-row INSERT as one entry
+func (s *auditedStorage) InsertRows(table string, rows []map[string]interface{}) error {
+	if err := types.InsertRows(s.Storage, table, rows); err != nil {
+		return err
+	}
+	if !s.log.Enabled(table) {
+		return nil
+	}
+	logged := make([]types.Row, len(rows))
+	for i, row := range rows {
+		logged[i] = types.Row(row)
+	}
+	return s.log.Append(Entry{
+		Table:     table,
+		Operation: OpInsert,
+		Statement: s.statement,
+		Rows:      logged,
+	})
+}
+
+func (s *auditedStorage) Update(table string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	if !s.log.Enabled(table) {
+		return s.Storage.Update(table, set, where)
+	}
+
+	before, err := s.Storage.Select(table, []string{"*"}, where)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := s.Storage.Update(table, set, where)
+	if err != nil {
+		return 0, err
+	}
+	return updated, s.log.Append(Entry{
+		Table:     table,
+		Operation: OpUpdate,
+		Statement: s.statement,
+		Rows:      before,
+		Set:       set,
+	})
+}
+
+func (s *auditedStorage) Delete(table string, where *types.WhereExpr) (int, error) {
+	if !s.log.Enabled(table) {
+		return s.Storage.Delete(table, where)
+	}
+
+	before, err := s.Storage.Select(table, []string{"*"}, where)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := s.Storage.Delete(table, where)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, s.log.Append(Entry{
+		Table:     table,
+		Operation: OpDelete,
+		Statement: s.statement,
+		Rows:      before,
+	})
+}
@@ -0,0 +1,208 @@
+// Package fixture loads declarative table fixtures into a storage, for the
+// LOAD FIXTURE statement and for tests.
+package fixture
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture describes a set of tables and their rows. It is read from YAML;
+// since JSON is a subset of YAML, a .json file works as well:
+//
+//	tables:
+//	  - name: employees
+//	    columns:
+//	      - {name: id, type: INT, not_null: true}
+//	      - {name: name, type: STRING}
+//	    rows:
+//	      - {id: 1, name: Alice}
+type Fixture struct {
+	Tables []Table `yaml:"tables"`
+}
+
+// Table is the schema and rows of one fixture table
+type Table struct {
+	Name    string                   `yaml:"name"`
+	Columns []Column                 `yaml:"columns"`
+	Rows    []map[string]interface{} `yaml:"rows"`
+}
+
+// Column is one column of a fixture table
+type Column struct {
+	Name    string `yaml:"name"`
+	Type    string `yaml:"type"`
+	NotNull bool   `yaml:"not_null"`
+}
+
+// LoadResult summarizes what loading a fixture changed
+type LoadResult struct {
+	Created []string // tables created by the fixture
+	Skipped []string // existing tables left untouched in merge mode
+	Rows    int      // rows inserted
+}
+
+// Row returns the result as a single result row
+func (r *LoadResult) Row() types.Row {
+	return types.Row{
+		"tables_created": len(r.Created),
+		"tables_skipped": len(r.Skipped),
+		"rows_loaded":    r.Rows,
+	}
+}
+
+// Read reads and validates a fixture file
+func Read(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	fixture, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", path, err)
+	}
+	return fixture, nil
+}
+
+// Parse decodes and validates a YAML or JSON fixture
+func Parse(data []byte) (*Fixture, error) {
+	var fixture Fixture
+	if err := yaml.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("malformed fixture: %w", err)
+	}
+	if err := fixture.validate(); err != nil {
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+// LoadFile reads the fixture at path and loads it into s
+func LoadFile(s types.Storage, path string, merge bool) (*LoadResult, error) {
+	fixture, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return fixture.Load(s, merge)
+}
+
+// Load creates every fixture table and inserts its rows. A table that
+// already exists is an error, unless merge is set, in which case the table
+// and its fixture rows are skipped. The whole fixture is checked against the
+// storage before anything is written, so a conflicting fixture leaves the
+// storage unchanged.
+func (f *Fixture) Load(s types.Storage, merge bool) (*LoadResult, error) {
+	result := &LoadResult{}
+	var pending []Table
+	for _, table := range f.Tables {
+		if s.GetTable(table.Name) != nil {
+			if !merge {
+				return nil, fmt.Errorf("table %s already exists", table.Name)
+			}
+			result.Skipped = append(result.Skipped, table.Name)
+			continue
+		}
+		pending = append(pending, table)
+	}
+
+	for _, table := range pending {
+		if err := s.CreateTable(table.schema()); err != nil {
+			return result, fmt.Errorf("failed to create table %s: %w", table.Name, err)
+		}
+		result.Created = append(result.Created, table.Name)
+
+		if len(table.Rows) == 0 {
+			continue
+		}
+		if err := types.InsertRows(s, table.Name, table.Rows); err != nil {
+			return result, fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		result.Rows += len(table.Rows)
+	}
+
+	return result, nil
+}
+
+// schema returns the table definition of a fixture table. DOUBLE is a
+// synonym of FLOAT, as in CREATE TABLE.
+func (t Table) schema() *types.Table {
+	columns := make([]types.ColumnDefinition, len(t.Columns))
+	for i, col := range t.Columns {
+		colType := strings.ToUpper(col.Type)
+		if colType == "DOUBLE" {
+			colType = "FLOAT"
+		}
+		columns[i] = types.ColumnDefinition{
+			Name:     col.Name,
+			Type:     colType,
+			Nullable: !col.NotNull,
+		}
+	}
+	return &types.Table{Name: t.Name, Columns: columns}
+}
+
+// validate checks the fixture schemas and that every row fits its table
+func (f *Fixture) validate() error {
+	if len(f.Tables) == 0 {
+		return fmt.Errorf("fixture defines no tables")
+	}
+
+	names := make(map[string]bool, len(f.Tables))
+	for _, table := range f.Tables {
+		if table.Name == "" {
+			return fmt.Errorf("fixture table without a name")
+		}
+		if names[table.Name] {
+			return fmt.Errorf("table %s is defined twice", table.Name)
+		}
+		names[table.Name] = true
+		if err := table.validate(); err != nil {
+			return fmt.Errorf("table %s: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+func (t Table) validate() error {
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("no columns defined")
+	}
+
+	schema := t.schema()
+	columns := make(map[string]types.ColumnDefinition, len(schema.Columns))
+	for _, col := range schema.Columns {
+		if col.Name == "" {
+			return fmt.Errorf("column without a name")
+		}
+		if _, ok := columns[col.Name]; ok {
+			return fmt.Errorf("column %s is defined twice", col.Name)
+		}
+		switch col.Type {
+		case "INT", "FLOAT", "BOOLEAN", "STRING", "TEXT", "DATE", "TIMESTAMP":
+		default:
+			return fmt.Errorf("column %s has unsupported type %q", col.Name, col.Type)
+		}
+		columns[col.Name] = col
+	}
+
+	for i, row := range t.Rows {
+		for field, val := range row {
+			col, ok := columns[field]
+			if !ok {
+				return fmt.Errorf("row %d: unknown column %s", i+1, field)
+			}
+			if err := types.CheckValueType(col.Name, col.Type, val, false); err != nil {
+				return fmt.Errorf("row %d: column %s: %w", i+1, field, err)
+			}
+		}
+		for _, col := range schema.Columns {
+			if !col.Nullable && row[col.Name] == nil {
+				return fmt.Errorf("row %d: column %s cannot be null", i+1, col.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package fixture_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/fixture"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+const companyFixture = `
+tables:
+  - name: employees
+    columns:
+      - {name: id, type: INT, not_null: true}
+      - {name: name, type: STRING}
+    rows:
+      - {id: 1, name: Alice}
+      - {id: 2, name: Bob}
+  - name: projects
+    columns:
+      - {name: id, type: int}
+      - {name: budget, type: int}
+    rows:
+      - {id: 1, budget: 50000}
+`
+
+func writeFixture(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadFixture(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	path := writeFixture(t, "company.yaml", companyFixture)
+
+	result, err := fixture.LoadFile(s, path, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"employees", "projects"}, result.Created)
+	assert.Equal(t, 3, result.Rows)
+
+	table := s.GetTable("employees")
+	assert.NotNil(t, table)
+	assert.False(t, table.Columns[0].Nullable)
+	assert.Equal(t, "INT", s.GetTable("projects").Columns[1].Type)
+
+	rows, err := s.Select("employees", []string{"*"}, types.WhereAll(map[string]interface{}{"id": 2}))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "Bob", rows[0]["name"])
+}
+
+func TestLoadFixtureJSON(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	path := writeFixture(t, "users.json", `{"tables": [{"name": "users",
+		"columns": [{"name": "id", "type": "INT"}, {"name": "email", "type": "TEXT"}],
+		"rows": [{"id": 7, "email": "a@example.com"}]}]}`)
+
+	result, err := fixture.LoadFile(s, path, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Rows)
+
+	rows, err := s.Select("users", []string{"email"}, types.WhereAll(map[string]interface{}{"id": 7}))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+}
+
+func TestLoadFixtureTypes(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	path := writeFixture(t, "readings.yaml", `
+tables:
+  - name: readings
+    columns:
+      - {name: score, type: FLOAT}
+      - {name: ratio, type: double}
+      - {name: ok, type: BOOLEAN}
+    rows:
+      - {score: 1.5, ratio: 2, ok: true}
+`)
+
+	_, err := fixture.LoadFile(s, path, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "FLOAT", s.GetTable("readings").Columns[1].Type)
+	rows, err := s.Select("readings", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"score": 1.5, "ratio": float64(2), "ok": true}}, rows)
+}
+
+func TestParseFixtureErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		wantErr string
+	}{
+		{"malformed", "tables: [name: x", "malformed fixture"},
+		{"wrong shape", "tables: employees", "malformed fixture"},
+		{"no tables", "tables: []", "no tables"},
+		{"missing name", "tables:\n  - columns: [{name: id, type: INT}]", "without a name"},
+		{"no columns", "tables:\n  - name: t", "no columns"},
+		{"duplicate table", "tables:\n  - {name: t, columns: [{name: id, type: INT}]}\n  - {name: t, columns: [{name: id, type: INT}]}", "defined twice"},
+		{"unsupported type", "tables:\n  - {name: t, columns: [{name: id, type: UUID}]}", "unsupported type"},
+		{"unknown column", "tables:\n  - {name: t, columns: [{name: id, type: INT}], rows: [{id: 1, extra: 2}]}", "unknown column extra"},
+		{"type mismatch", "tables:\n  - {name: t, columns: [{name: id, type: INT}], rows: [{id: abc}]}", "row 1: column id"},
+		{"fractional int", "tables:\n  - {name: t, columns: [{name: id, type: INT}], rows: [{id: 1.5}]}", "not an integer"},
+		{"not null", "tables:\n  - {name: t, columns: [{name: id, type: INT, not_null: true}], rows: [{}]}", "cannot be null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fixture.Parse([]byte(tt.fixture))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFixtureMissingFile(t *testing.T) {
+	_, err := fixture.LoadFile(storage.NewInMemoryStorage(), filepath.Join(t.TempDir(), "missing.yaml"), false)
+	assert.Error(t, err)
+}
+
+func TestLoadFixtureMerge(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	err := s.CreateTable(&types.Table{
+		Name:    "employees",
+		Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}, {Name: "name", Type: "STRING"}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 9, "name": "Zoe"}))
+
+	path := writeFixture(t, "company.yaml", companyFixture)
+
+	// Without merge an existing table is a conflict and nothing is loaded
+	_, err = fixture.LoadFile(s, path, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already exists")
+	}
+	assert.Nil(t, s.GetTable("projects"))
+
+	// With merge the existing table and its fixture rows are skipped
+	result, err := fixture.LoadFile(s, path, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"projects"}, result.Created)
+	assert.Equal(t, []string{"employees"}, result.Skipped)
+	assert.Equal(t, 1, result.Rows)
+
+	rows, err := s.Select("employees", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "Zoe", rows[0]["name"])
+}
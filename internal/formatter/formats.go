@@ -0,0 +1,228 @@
+package formatter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Format is the way result rows are rendered
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatCSV   Format = "csv"
+)
+
+// ParseFormat returns the format called name, ignoring case
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case FormatTable, FormatJSON, FormatCSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected table, json or csv)", name)
+}
+
+// RowWriter streams result rows to a writer in some format. Flush must be
+// called after the last row.
+type RowWriter interface {
+	WriteRow(row map[string]interface{}) error
+	Flush() error
+}
+
+// NewWriter returns a writer for format, the table format for any other
+// value
+func NewWriter(format Format, w io.Writer) RowWriter {
+	switch format {
+	case FormatJSON:
+		return NewJSON(w)
+	case FormatCSV:
+		return NewCSV(w, DefaultSampleSize)
+	}
+	return NewTable(w, DefaultSampleSize)
+}
+
+// JSON writes rows as a JSON array of objects, one per line. Object keys
+// are in name order, and a missing column is left out rather than null.
+type JSON struct {
+	w    *bufio.Writer
+	rows int
+}
+
+// NewJSON creates a JSON array writer
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: bufio.NewWriter(w)}
+}
+
+// WriteRow adds a row to the array
+func (j *JSON) WriteRow(row map[string]interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if j.rows == 0 {
+		sep = "[\n  "
+	}
+	j.rows++
+	j.w.WriteString(sep)
+	_, err = j.w.Write(data)
+	return err
+}
+
+// Flush closes the array, printing [] for no rows, and flushes the
+// underlying writer
+func (j *JSON) Flush() error {
+	end := "\n]\n"
+	if j.rows == 0 {
+		end = "[]\n"
+	}
+	if _, err := j.w.WriteString(end); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// CSV writes rows as RFC 4180 CSV: a header row, then a record per row,
+// quoting fields that need it and ending lines with CRLF. As with Table,
+// the first sampleSize rows fix the columns, in name order. NULL is an
+// empty field.
+type CSV struct {
+	w          *csv.Writer
+	sampleSize int
+	sample     []map[string]interface{}
+	columns    []string
+	started    bool
+}
+
+// NewCSV creates a CSV writer. A sampleSize <= 0 uses DefaultSampleSize.
+func NewCSV(w io.Writer, sampleSize int) *CSV {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	return &CSV{w: cw, sampleSize: sampleSize}
+}
+
+// WriteRow adds a record
+func (c *CSV) WriteRow(row map[string]interface{}) error {
+	if c.started {
+		return c.writeRow(row)
+	}
+	c.sample = append(c.sample, row)
+	if len(c.sample) >= c.sampleSize {
+		return c.start()
+	}
+	return nil
+}
+
+// Flush writes any buffered rows and flushes the underlying writer. No
+// rows print nothing, not even a header.
+func (c *CSV) Flush() error {
+	if !c.started && len(c.sample) > 0 {
+		if err := c.start(); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *CSV) start() error {
+	c.started = true
+	seen := make(map[string]bool)
+	for _, row := range c.sample {
+		for col := range row {
+			if !seen[col] {
+				seen[col] = true
+				c.columns = append(c.columns, col)
+			}
+		}
+	}
+	sort.Strings(c.columns)
+
+	if err := c.w.Write(c.columns); err != nil {
+		return err
+	}
+	for _, row := range c.sample {
+		if err := c.writeRow(row); err != nil {
+			return err
+		}
+	}
+	c.sample = nil
+	return nil
+}
+
+func (c *CSV) writeRow(row map[string]interface{}) error {
+	record := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		if val := row[col]; val != nil {
+			record[i] = FormatValue(val)
+		}
+	}
+	return c.w.Write(record)
+}
+
+// NewCSVColumns creates a CSV writer for the given columns, in that order,
+// and writes the header row at once, so a result with no rows still has
+// one. Columns of a row that are not listed are left out.
+func NewCSVColumns(w io.Writer, columns []string) (*CSV, error) {
+	c := NewCSV(w, 0)
+	c.columns = columns
+	c.started = true
+	if err := c.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// JSONLines writes rows as JSON Lines, one object per line with the keys
+// in the order of its columns. A missing column is null.
+type JSONLines struct {
+	w       *bufio.Writer
+	columns []string
+	keys    [][]byte
+}
+
+// NewJSONLines creates a JSON Lines writer for the given columns
+func NewJSONLines(w io.Writer, columns []string) (*JSONLines, error) {
+	keys := make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+	return &JSONLines{w: bufio.NewWriter(w), columns: columns, keys: keys}, nil
+}
+
+// WriteRow writes a row as one line
+func (j *JSONLines) WriteRow(row map[string]interface{}) error {
+	j.w.WriteByte('{')
+	for i, col := range j.columns {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		value, err := json.Marshal(row[col])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+		j.w.Write(j.keys[i])
+		j.w.WriteByte(':')
+		j.w.Write(value)
+	}
+	_, err := j.w.WriteString("}\n")
+	return err
+}
+
+// Flush flushes the underlying writer
+func (j *JSONLines) Flush() error {
+	return j.w.Flush()
+}
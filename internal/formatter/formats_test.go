@@ -0,0 +1,110 @@
+package formatter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var formatRows = []map[string]interface{}{
+	{"id": 1, "name": "Ann", "note": "says \"hi\", twice"},
+	{"id": 22, "name": "Bo", "note": nil},
+	{"id": 3, "tags": []interface{}{"a", "b"}},
+}
+
+func writeAll(t *testing.T, w RowWriter, rows []map[string]interface{}) {
+	t.Helper()
+	for _, row := range rows {
+		assert.NoError(t, w.WriteRow(row))
+	}
+	assert.NoError(t, w.Flush())
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"table": FormatTable, "JSON": FormatJSON, " csv ": FormatCSV} {
+		got, err := ParseFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseFormat("xml")
+	assert.EqualError(t, err, `unknown format "xml" (expected table, json or csv)`)
+}
+
+func TestJSONRows(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, NewWriter(FormatJSON, &buf), formatRows)
+	assert.Equal(t, ""+
+		"[\n"+
+		`  {"id":1,"name":"Ann","note":"says \"hi\", twice"},`+"\n"+
+		`  {"id":22,"name":"Bo","note":null},`+"\n"+
+		`  {"id":3,"tags":["a","b"]}`+"\n"+
+		"]\n", buf.String())
+
+	buf.Reset()
+	writeAll(t, NewWriter(FormatJSON, &buf), nil)
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestCSVRows(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, NewWriter(FormatCSV, &buf), formatRows)
+	assert.Equal(t, ""+
+		"id,name,note,tags\r\n"+
+		"1,Ann,\"says \"\"hi\"\", twice\",\r\n"+
+		"22,Bo,,\r\n"+
+		"3,,,\"[\"\"a\"\",\"\"b\"\"]\"\r\n", buf.String())
+
+	buf.Reset()
+	writeAll(t, NewWriter(FormatCSV, &buf), nil)
+	assert.Empty(t, buf.String())
+}
+
+func TestCSVStreamsAfterSample(t *testing.T) {
+	var buf bytes.Buffer
+	c := NewCSV(&buf, 1)
+	assert.NoError(t, c.WriteRow(map[string]interface{}{"v": "a"}))
+	assert.Nil(t, c.sample, "sample is released once the columns are fixed")
+	assert.NoError(t, c.WriteRow(map[string]interface{}{"v": "b", "extra": 1}))
+	assert.NoError(t, c.Flush())
+	assert.Equal(t, "v\r\na\r\nb\r\n", buf.String())
+}
+
+func TestTableFormat(t *testing.T) {
+	var buf bytes.Buffer
+	writeAll(t, NewWriter(FormatTable, &buf), formatRows[:2])
+	assert.Equal(t, ""+
+		"id | name | note            \n"+
+		"---+------+-----------------\n"+
+		"1  | Ann  | says \"hi\", twice\n"+
+		"22 | Bo   | NULL            \n", buf.String())
+}
+
+func TestColumnOrderedWriters(t *testing.T) {
+	columns := []string{"name", "id", "note"}
+
+	var buf bytes.Buffer
+	c, err := NewCSVColumns(&buf, columns)
+	assert.NoError(t, err)
+	writeAll(t, c, formatRows[:2])
+	assert.Equal(t, ""+
+		"name,id,note\r\n"+
+		"Ann,1,\"says \"\"hi\"\", twice\"\r\n"+
+		"Bo,22,\r\n", buf.String())
+
+	// The header is written even with no rows
+	buf.Reset()
+	c, err = NewCSVColumns(&buf, columns)
+	assert.NoError(t, err)
+	writeAll(t, c, nil)
+	assert.Equal(t, "name,id,note\r\n", buf.String())
+
+	buf.Reset()
+	j, err := NewJSONLines(&buf, columns)
+	assert.NoError(t, err)
+	writeAll(t, j, formatRows)
+	assert.Equal(t, ""+
+		`{"name":"Ann","id":1,"note":"says \"hi\", twice"}`+"\n"+
+		`{"name":"Bo","id":22,"note":null}`+"\n"+
+		`{"name":null,"id":3,"note":null}`+"\n", buf.String())
+}
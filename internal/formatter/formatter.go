@@ -0,0 +1,184 @@
+// Package formatter renders query results as aligned text tables, JSON
+// or CSV.
+package formatter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// DefaultSampleSize is the number of rows buffered to estimate column widths
+const DefaultSampleSize = 200
+
+// Table streams rows to a writer as an aligned text table. Only the first
+// sampleSize rows are held in memory; they fix the column set and widths,
+// and every later row is written immediately using those widths. Values
+// wider than their column are printed in full rather than truncated, and
+// columns a later row has but the sample lacked follow its cells as
+// column=value.
+type Table struct {
+	w          *bufio.Writer
+	sampleSize int
+	sample     []map[string]interface{}
+	columns    []string
+	widths     map[string]int
+	started    bool
+	rows       int
+}
+
+// NewTable creates a table writer. A sampleSize <= 0 uses DefaultSampleSize.
+func NewTable(w io.Writer, sampleSize int) *Table {
+	if sampleSize <= 0 {
+		sampleSize = DefaultSampleSize
+	}
+	return &Table{
+		w:          bufio.NewWriter(w),
+		sampleSize: sampleSize,
+		widths:     make(map[string]int),
+	}
+}
+
+// WriteRow adds a row to the table
+func (t *Table) WriteRow(row map[string]interface{}) error {
+	t.rows++
+	if t.started {
+		return t.writeRow(row)
+	}
+
+	t.sample = append(t.sample, row)
+	if len(t.sample) >= t.sampleSize {
+		return t.start()
+	}
+	return nil
+}
+
+// Rows returns the number of rows written so far
+func (t *Table) Rows() int {
+	return t.rows
+}
+
+// Flush writes any buffered rows and flushes the underlying writer. A
+// table with no rows prints "Empty result set".
+func (t *Table) Flush() error {
+	if t.rows == 0 {
+		if _, err := fmt.Fprintln(t.w, "Empty result set"); err != nil {
+			return err
+		}
+		return t.w.Flush()
+	}
+	if !t.started {
+		if err := t.start(); err != nil {
+			return err
+		}
+	}
+	return t.w.Flush()
+}
+
+// start computes widths from the sample, writes the header and the
+// buffered rows, then releases the buffer
+func (t *Table) start() error {
+	t.started = true
+
+	// Gather all column names from the sample
+	for _, row := range t.sample {
+		for col := range row {
+			if _, ok := t.widths[col]; !ok {
+				t.columns = append(t.columns, col)
+				t.widths[col] = len(col)
+			}
+		}
+	}
+
+	// Sort columns for consistent display
+	sort.Strings(t.columns)
+
+	// Calculate maximum width for each column
+	for _, row := range t.sample {
+		for _, col := range t.columns {
+			if n := len(cell(row, col)); n > t.widths[col] {
+				t.widths[col] = n
+			}
+		}
+	}
+
+	// Print header
+	for i, col := range t.columns {
+		if i > 0 {
+			t.w.WriteString(" | ")
+		}
+		fmt.Fprintf(t.w, "%-*s", t.widths[col], col)
+	}
+	t.w.WriteString("\n")
+
+	// Print separator
+	for i, col := range t.columns {
+		if i > 0 {
+			t.w.WriteString("-+-")
+		}
+		for j := 0; j < t.widths[col]; j++ {
+			t.w.WriteByte('-')
+		}
+	}
+	if _, err := t.w.WriteString("\n"); err != nil {
+		return err
+	}
+
+	for _, row := range t.sample {
+		if err := t.writeRow(row); err != nil {
+			return err
+		}
+	}
+	t.sample = nil
+	return nil
+}
+
+func (t *Table) writeRow(row map[string]interface{}) error {
+	for i, col := range t.columns {
+		if i > 0 {
+			t.w.WriteString(" | ")
+		}
+		fmt.Fprintf(t.w, "%-*s", t.widths[col], cell(row, col))
+	}
+
+	// Columns first seen after the sample have no place in the header
+	var extra []string
+	for col := range row {
+		if _, ok := t.widths[col]; !ok {
+			extra = append(extra, col)
+		}
+	}
+	sort.Strings(extra)
+	for _, col := range extra {
+		fmt.Fprintf(t.w, " | %s=%s", col, cell(row, col))
+	}
+
+	_, err := t.w.WriteString("\n")
+	return err
+}
+
+func cell(row map[string]interface{}, col string) string {
+	val, ok := row[col]
+	if !ok {
+		return "NULL"
+	}
+	return FormatValue(val)
+}
+
+// FormatValue renders a single value for display. Maps, slices and structs
+// (which can appear after a JSON round-trip) are rendered as compact JSON.
+func FormatValue(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
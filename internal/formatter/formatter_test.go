@@ -0,0 +1,96 @@
+package formatter
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableFlatRows(t *testing.T) {
+	var buf bytes.Buffer
+	tbl := NewTable(&buf, 0)
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"id": 1, "name": "Ann"}))
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"id": 22, "name": "Bo"}))
+	assert.NoError(t, tbl.Flush())
+
+	assert.Equal(t, ""+
+		"id | name\n"+
+		"---+-----\n"+
+		"1  | Ann \n"+
+		"22 | Bo  \n", buf.String())
+	assert.Equal(t, 2, tbl.Rows())
+}
+
+func TestTableMissingAndNestedValues(t *testing.T) {
+	var buf bytes.Buffer
+	tbl := NewTable(&buf, 0)
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{
+		"id":   1,
+		"tags": []interface{}{"a", "b"},
+		"meta": map[string]interface{}{"k": 1.5},
+	}))
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"id": 2, "meta": nil}))
+	assert.NoError(t, tbl.Flush())
+
+	assert.Equal(t, ""+
+		"id | meta      | tags     \n"+
+		"---+-----------+----------\n"+
+		"1  | {\"k\":1.5} | [\"a\",\"b\"]\n"+
+		"2  | NULL      | NULL     \n", buf.String())
+}
+
+func TestTableStreamsAfterSample(t *testing.T) {
+	var buf bytes.Buffer
+	tbl := NewTable(&buf, 2)
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"v": "a"}))
+	assert.Empty(t, buf.String(), "rows are buffered until the sample is full")
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"v": "bb"}))
+	assert.Nil(t, tbl.sample, "sample is released once widths are fixed")
+
+	// Later rows keep the sampled widths and columns, and print columns
+	// the sample lacked after them
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"v": "ccc", "extra": 1}))
+	assert.NoError(t, tbl.WriteRow(map[string]interface{}{"v": "d", "z": nil, "extra": "x"}))
+	assert.NoError(t, tbl.Flush())
+
+	assert.Equal(t, ""+
+		"v \n"+
+		"--\n"+
+		"a \n"+
+		"bb\n"+
+		"ccc | extra=1\n"+
+		"d  | extra=x | z=NULL\n", buf.String())
+}
+
+func TestTableEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewTable(&buf, 0).Flush())
+	assert.Equal(t, "Empty result set\n", buf.String())
+}
+
+// BenchmarkTable1MRows streams one million rows and reports the peak heap
+// size, which stays flat regardless of row count because only the sample
+// is buffered.
+func BenchmarkTable1MRows(b *testing.B) {
+	b.ReportAllocs()
+	var peak uint64
+	var stats runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		tbl := NewTable(io.Discard, 0)
+		for n := 0; n < 1000000; n++ {
+			tbl.WriteRow(map[string]interface{}{"id": n, "name": "employee", "salary": 50000.0})
+			if n%100000 == 0 {
+				runtime.GC()
+				runtime.ReadMemStats(&stats)
+				if stats.HeapAlloc > peak {
+					peak = stats.HeapAlloc
+				}
+			}
+		}
+		tbl.Flush()
+	}
+	b.ReportMetric(float64(peak)/(1<<20), "peak-heap-MB")
+}
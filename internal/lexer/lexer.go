@@ -14,6 +14,12 @@ const (
 	NUMBER     = "NUMBER"
 	STRING     = "STRING"
 	SYMBOL     = "SYMBOL"
+	VARIABLE   = "VARIABLE"
+	// BOOLEAN is a TRUE or FALSE literal
+	BOOLEAN = "BOOLEAN"
+	// PLACEHOLDER is a ? standing for a value bound when a prepared
+	// statement is executed
+	PLACEHOLDER = "PLACEHOLDER"
 
 	// Symbols
 	ASTERISK  = "ASTERISK"
@@ -22,26 +28,60 @@ const (
 	LPAREN    = "LPAREN"
 	RPAREN    = "RPAREN"
 	EQUALS    = "EQUALS"
+	NOT_EQ    = "NOT_EQ"
+	LT        = "LT"
+	GT        = "GT"
+	LTE       = "LTE"
+	GTE       = "GTE"
+	DOT       = "DOT"
+	CONCAT    = "CONCAT"
 )
 
 // Keywords
 var keywords = map[string]TokenType{
-	"select": KEYWORD,
-	"from":   KEYWORD,
-	"where":  KEYWORD,
-	"insert": KEYWORD,
-	"into":   KEYWORD,
-	"values": KEYWORD,
-	"update": KEYWORD,
-	"set":    KEYWORD,
-	"delete": KEYWORD,
-	"create": KEYWORD,
-	"table":  KEYWORD,
-	"int":    KEYWORD,
-	"text":   KEYWORD,
-	"string": KEYWORD,
-	"show":   KEYWORD,
-	"tables": KEYWORD,
+	"select":  KEYWORD,
+	"from":    KEYWORD,
+	"where":   KEYWORD,
+	"insert":  KEYWORD,
+	"into":    KEYWORD,
+	"values":  KEYWORD,
+	"update":  KEYWORD,
+	"set":     KEYWORD,
+	"delete":  KEYWORD,
+	"create":  KEYWORD,
+	"table":   KEYWORD,
+	"int":     KEYWORD,
+	"text":    KEYWORD,
+	"string":  KEYWORD,
+	"float":   KEYWORD,
+	"boolean": KEYWORD,
+	"show":    KEYWORD,
+	"tables":  KEYWORD,
+	"if":      KEYWORD,
+	"not":     KEYWORD,
+	"exists":  KEYWORD,
+	"alter":   KEYWORD,
+	"audit":   KEYWORD,
+	"with":    KEYWORD,
+	"check":   KEYWORD,
+	"load":    KEYWORD,
+	"import":  KEYWORD,
+	"export":  KEYWORD,
+	"drop":    KEYWORD,
+	"attach":  KEYWORD,
+	"detach":  KEYWORD,
+	"explain": KEYWORD,
+	// WHERE operators
+	"like":    KEYWORD,
+	"in":      KEYWORD,
+	"between": KEYWORD,
+	// Literals
+	"true":  BOOLEAN,
+	"false": BOOLEAN,
+	// Transaction control
+	"begin":    KEYWORD,
+	"commit":   KEYWORD,
+	"rollback": KEYWORD,
 }
 
 type TokenType string
@@ -101,9 +141,64 @@ func (l *Lexer) NextToken() Token {
 		tok = Token{Type: RPAREN, Literal: string(l.ch)}
 	case '=':
 		tok = Token{Type: EQUALS, Literal: string(l.ch)}
+	case '<':
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			tok = Token{Type: LTE, Literal: "<="}
+		case '>':
+			l.readChar()
+			tok = Token{Type: NOT_EQ, Literal: "!="}
+		default:
+			tok = Token{Type: LT, Literal: string(l.ch)}
+		}
+	case '>':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = Token{Type: GTE, Literal: ">="}
+		} else {
+			tok = Token{Type: GT, Literal: string(l.ch)}
+		}
+	case '!':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = Token{Type: NOT_EQ, Literal: "!="}
+		} else {
+			tok = Token{Type: ILLEGAL, Literal: string(l.ch)}
+		}
+	case '.':
+		tok = Token{Type: DOT, Literal: string(l.ch)}
+	case '-':
+		// A minus sign directly before a digit is part of a negative
+		// number; there is no subtraction
+		if isDigit(l.peekChar()) {
+			tok.Literal = l.readNumber()
+			tok.Type = NUMBER
+			return tok
+		}
+		tok = Token{Type: ILLEGAL, Literal: string(l.ch)}
+	case '|':
+		// Only || is an operator
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = Token{Type: CONCAT, Literal: "||"}
+		} else {
+			tok = Token{Type: ILLEGAL, Literal: string(l.ch)}
+		}
 	case '\'':
 		tok.Type = STRING
 		tok.Literal = l.readString()
+	case '@':
+		// Session variable reference, e.g. @dept
+		l.readChar()
+		if !isLetter(l.ch) {
+			return Token{Type: ILLEGAL, Literal: "@"}
+		}
+		tok.Type = VARIABLE
+		tok.Literal = l.readIdentifier()
+		return tok
+	case '?':
+		tok = Token{Type: PLACEHOLDER, Literal: "?"}
 	case 0:
 		tok.Literal = ""
 		tok.Type = EOF
@@ -145,6 +240,14 @@ func (l *Lexer) readChar() {
 	l.readPos++
 }
 
+// peekChar returns the character after the current one without consuming it
+func (l *Lexer) peekChar() byte {
+	if l.readPos >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPos]
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.readPos - 1
 	for isLetter(l.ch) || isDigit(l.ch) {
@@ -153,11 +256,22 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position : l.readPos-1]
 }
 
+// readNumber reads an integer or a number with a fractional part, such as
+// 19.99, either with a leading minus sign
 func (l *Lexer) readNumber() string {
 	position := l.readPos - 1
+	if l.ch == '-' {
+		l.readChar()
+	}
 	for isDigit(l.ch) {
 		l.readChar()
 	}
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
 	return l.input[position : l.readPos-1]
 }
 
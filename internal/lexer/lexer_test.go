@@ -56,6 +56,82 @@ func TestLexer(t *testing.T) {
 				{Type: lexer.RPAREN, Literal: ")"},
 			},
 		},
+		{
+			name:  "Placeholders",
+			input: "SELECT * FROM users WHERE id = ? AND name = ?",
+			expected: []lexer.Token{
+				{Type: lexer.KEYWORD, Literal: "SELECT"},
+				{Type: lexer.ASTERISK, Literal: "*"},
+				{Type: lexer.KEYWORD, Literal: "FROM"},
+				{Type: lexer.IDENTIFIER, Literal: "users"},
+				{Type: lexer.KEYWORD, Literal: "WHERE"},
+				{Type: lexer.IDENTIFIER, Literal: "id"},
+				{Type: lexer.EQUALS, Literal: "="},
+				{Type: lexer.PLACEHOLDER, Literal: "?"},
+				{Type: lexer.IDENTIFIER, Literal: "AND"},
+				{Type: lexer.IDENTIFIER, Literal: "name"},
+				{Type: lexer.EQUALS, Literal: "="},
+				{Type: lexer.PLACEHOLDER, Literal: "?"},
+			},
+		},
+		{
+			name:  "Session_variable",
+			input: "SET @dept = 'Engineering'",
+			expected: []lexer.Token{
+				{Type: lexer.KEYWORD, Literal: "SET"},
+				{Type: lexer.VARIABLE, Literal: "dept"},
+				{Type: lexer.EQUALS, Literal: "="},
+				{Type: lexer.STRING, Literal: "Engineering"},
+			},
+		},
+		{
+			name:  "Qualified_column",
+			input: "SET salary = r.new_salary",
+			expected: []lexer.Token{
+				{Type: lexer.KEYWORD, Literal: "SET"},
+				{Type: lexer.IDENTIFIER, Literal: "salary"},
+				{Type: lexer.EQUALS, Literal: "="},
+				{Type: lexer.IDENTIFIER, Literal: "r"},
+				{Type: lexer.DOT, Literal: "."},
+				{Type: lexer.IDENTIFIER, Literal: "new_salary"},
+			},
+		},
+		{
+			name:  "Concatenation",
+			input: "a || 'x'|b",
+			expected: []lexer.Token{
+				{Type: lexer.IDENTIFIER, Literal: "a"},
+				{Type: lexer.CONCAT, Literal: "||"},
+				{Type: lexer.STRING, Literal: "x"},
+				{Type: lexer.ILLEGAL, Literal: "|"},
+				{Type: lexer.IDENTIFIER, Literal: "b"},
+			},
+		},
+		{
+			name:  "Comparison_operators",
+			input: "a>1 b >= 2 c<3 d<=4 e != 5 f<>6 !",
+			expected: []lexer.Token{
+				{Type: lexer.IDENTIFIER, Literal: "a"},
+				{Type: lexer.GT, Literal: ">"},
+				{Type: lexer.NUMBER, Literal: "1"},
+				{Type: lexer.IDENTIFIER, Literal: "b"},
+				{Type: lexer.GTE, Literal: ">="},
+				{Type: lexer.NUMBER, Literal: "2"},
+				{Type: lexer.IDENTIFIER, Literal: "c"},
+				{Type: lexer.LT, Literal: "<"},
+				{Type: lexer.NUMBER, Literal: "3"},
+				{Type: lexer.IDENTIFIER, Literal: "d"},
+				{Type: lexer.LTE, Literal: "<="},
+				{Type: lexer.NUMBER, Literal: "4"},
+				{Type: lexer.IDENTIFIER, Literal: "e"},
+				{Type: lexer.NOT_EQ, Literal: "!="},
+				{Type: lexer.NUMBER, Literal: "5"},
+				{Type: lexer.IDENTIFIER, Literal: "f"},
+				{Type: lexer.NOT_EQ, Literal: "!="},
+				{Type: lexer.NUMBER, Literal: "6"},
+				{Type: lexer.ILLEGAL, Literal: "!"},
+			},
+		},
 		{
 			name:  "Insert_into_table",
 			input: "INSERT INTO users VALUES (105, 233)",
@@ -71,6 +147,42 @@ func TestLexer(t *testing.T) {
 				{Type: lexer.RPAREN, Literal: ")"},
 			},
 		},
+		{
+			name:  "Float_and_boolean_literals",
+			input: "VALUES (19.99, TRUE, false, 3.)",
+			expected: []lexer.Token{
+				{Type: lexer.KEYWORD, Literal: "VALUES"},
+				{Type: lexer.LPAREN, Literal: "("},
+				{Type: lexer.NUMBER, Literal: "19.99"},
+				{Type: lexer.COMMA, Literal: ","},
+				{Type: lexer.BOOLEAN, Literal: "TRUE"},
+				{Type: lexer.COMMA, Literal: ","},
+				{Type: lexer.BOOLEAN, Literal: "false"},
+				{Type: lexer.COMMA, Literal: ","},
+				{Type: lexer.NUMBER, Literal: "3"},
+				{Type: lexer.DOT, Literal: "."},
+				{Type: lexer.RPAREN, Literal: ")"},
+			},
+		},
+		{
+			name:  "Negative_numbers",
+			input: "WHERE balance = -100 AND rate > -2.5 OR x = - 1",
+			expected: []lexer.Token{
+				{Type: lexer.KEYWORD, Literal: "WHERE"},
+				{Type: lexer.IDENTIFIER, Literal: "balance"},
+				{Type: lexer.EQUALS, Literal: "="},
+				{Type: lexer.NUMBER, Literal: "-100"},
+				{Type: lexer.IDENTIFIER, Literal: "AND"},
+				{Type: lexer.IDENTIFIER, Literal: "rate"},
+				{Type: lexer.GT, Literal: ">"},
+				{Type: lexer.NUMBER, Literal: "-2.5"},
+				{Type: lexer.IDENTIFIER, Literal: "OR"},
+				{Type: lexer.IDENTIFIER, Literal: "x"},
+				{Type: lexer.EQUALS, Literal: "="},
+				{Type: lexer.ILLEGAL, Literal: "-"},
+				{Type: lexer.NUMBER, Literal: "1"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// AttachStatement makes a Parquet file queryable as a read-only table
+// (ATTACH PARQUET 'events.parquet' AS events), with the columns of the
+// file's schema
+type AttachStatement struct {
+	Path  string
+	Table string
+}
+
+// DetachStatement removes a table attached with ATTACH PARQUET (DETACH
+// [PARQUET] events), leaving its file alone
+type DetachStatement struct {
+	Table string
+}
+
+func (p *Parser) parseAttach() (*AttachStatement, error) {
+	stmt := &AttachStatement{}
+
+	p.nextToken()
+	if !p.isWord("PARQUET") {
+		return nil, fmt.Errorf("expected PARQUET, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Type != lexer.STRING || p.currentToken.Literal == "" {
+		return nil, fmt.Errorf("expected Parquet file path, got %s", p.currentToken.Literal)
+	}
+	stmt.Path = p.currentToken.Literal
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "AS") {
+		return nil, fmt.Errorf("expected AS, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after table name", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseDetach() (*DetachStatement, error) {
+	stmt := &DetachStatement{}
+
+	p.nextToken()
+	if p.isWord("PARQUET") {
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after table name", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// Execute attaches the file and returns the columns of the new table
+func (s *AttachStatement) Execute(storage types.Storage) (interface{}, error) {
+	attacher, ok := storage.(types.ParquetAttacher)
+	if !ok {
+		return nil, types.Unsupported("ATTACH PARQUET")
+	}
+	table, err := attacher.AttachParquet(s.Table, s.Path)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]types.Row, len(table.Columns))
+	for i, col := range table.Columns {
+		rows[i] = types.Row{"column": col.Name, "type": col.Type, "nullable": col.Nullable}
+	}
+	return rows, nil
+}
+
+// Execute detaches the table
+func (s *DetachStatement) Execute(storage types.Storage) (interface{}, error) {
+	attacher, ok := storage.(types.ParquetAttacher)
+	if !ok {
+		return nil, types.Unsupported("DETACH")
+	}
+	if err := attacher.DetachParquet(s.Table); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Table %s detached", s.Table), nil
+}
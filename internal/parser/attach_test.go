@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParseAttach(t *testing.T) {
+	stmt, err := Parse("ATTACH PARQUET 'data/events.parquet' AS events;")
+	assert.NoError(t, err)
+	assert.Equal(t, "ATTACH", stmt.Type)
+	assert.Equal(t, &AttachStatement{Path: "data/events.parquet", Table: "events"}, stmt.AttachStatement)
+
+	for _, sql := range []string{"DETACH events;", "DETACH PARQUET events"} {
+		stmt, err = Parse(sql)
+		assert.NoError(t, err, sql)
+		assert.Equal(t, "DETACH", stmt.Type)
+		assert.Equal(t, "events", stmt.DetachStatement.Table)
+	}
+
+	for sql, want := range map[string]string{
+		"ATTACH 'e.parquet' AS events;":         "expected PARQUET, got e.parquet",
+		"ATTACH PARQUET events AS events;":      "expected Parquet file path, got events",
+		"ATTACH PARQUET 'e.parquet' TO events;": "expected AS, got TO",
+		"ATTACH PARQUET 'e.parquet' AS e x;":    "unexpected x after table name",
+		"DETACH;":                               "expected table name, got ;",
+	} {
+		_, err := Parse(sql)
+		assert.EqualError(t, err, want, sql)
+	}
+}
+
+func TestAttachParquetSQL(t *testing.T) {
+	type reading struct {
+		Sensor string `parquet:"name=sensor, type=BYTE_ARRAY, convertedtype=UTF8"`
+		Value  int32  `parquet:"name=value, type=INT32"`
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "readings.parquet")
+	fw, err := local.NewLocalFileWriter(path)
+	assert.NoError(t, err)
+	pw, err := writer.NewParquetWriter(fw, new(reading), 1)
+	assert.NoError(t, err)
+	for _, r := range []reading{{"a", 10}, {"b", 20}, {"a", 30}} {
+		assert.NoError(t, pw.Write(r))
+	}
+	assert.NoError(t, pw.WriteStop())
+	assert.NoError(t, fw.Close())
+
+	s, err := storage.CreateHybridStorage(storage.StorageConfig{
+		Type:     storage.BTreeStorageType,
+		FilePath: filepath.Join(dir, "attach.btree"),
+		DataDir:  filepath.Join(dir, "parquet"),
+		LogLevel: types.LogLevelError,
+	})
+	assert.NoError(t, err)
+	defer s.Close()
+	session := NewSession()
+	run := func(sql string) (interface{}, error) {
+		stmt, err := Parse(sql)
+		assert.NoError(t, err, sql)
+		return session.Execute(stmt, s)
+	}
+
+	result, err := run("ATTACH PARQUET '" + path + "' AS readings;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{
+		{"column": "sensor", "type": "STRING", "nullable": false},
+		{"column": "value", "type": "INT", "nullable": false},
+	}, result)
+
+	result, err = run("SELECT sensor, SUM(value) AS total FROM readings GROUP BY sensor ORDER BY sensor;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"sensor": "a", "total": 40}, {"sensor": "b", "total": 20}}, result)
+
+	_, err = run("INSERT INTO readings VALUES ('c', 1);")
+	assert.EqualError(t, err, "table readings is an attached Parquet file and is read-only")
+
+	_, err = run("DETACH readings;")
+	assert.NoError(t, err)
+	_, err = run("SELECT * FROM readings;")
+	assert.Error(t, err)
+
+	_, err = run("ATTACH PARQUET '" + path + "' AS readings;")
+	assert.NoError(t, err)
+	_, err = run("ATTACH PARQUET '" + path + "' AS readings;")
+	assert.EqualError(t, err, "table readings already exists")
+
+	stmt, err := Parse("ATTACH PARQUET '" + path + "' AS r2;")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, stmt.CheckSupported(types.Capabilities{}), types.ErrNotSupported)
+}
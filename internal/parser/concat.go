@@ -0,0 +1,253 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// ConcatExpr is a chain of operands joined with ||, evaluated left to
+// right. Operands are ColumnRefs or literal values; each is converted to
+// its string form, and a NULL operand makes the whole result NULL.
+type ConcatExpr struct {
+	Operands []interface{}
+}
+
+// Eval evaluates the expression against a row
+func (e ConcatExpr) Eval(row types.Row) interface{} {
+	var b strings.Builder
+	for _, op := range e.Operands {
+		val := op
+		if ref, ok := op.(ColumnRef); ok {
+			val = row[ref.Column]
+		}
+		if val == nil {
+			return nil
+		}
+		b.WriteString(fmt.Sprint(val))
+	}
+	return b.String()
+}
+
+// Columns returns the columns the expression reads
+func (e ConcatExpr) Columns() []string {
+	var columns []string
+	for _, op := range e.Operands {
+		if ref, ok := op.(ColumnRef); ok {
+			columns = append(columns, ref.Column)
+		}
+	}
+	return columns
+}
+
+// String returns the expression as SQL. It names the result column of an
+// expression without an alias.
+func (e ConcatExpr) String() string {
+	parts := make([]string, len(e.Operands))
+	for i, op := range e.Operands {
+		switch v := op.(type) {
+		case ColumnRef:
+			parts[i] = v.String()
+		case Variable:
+			parts[i] = "@" + v.Name
+		case string:
+			parts[i] = "'" + v + "'"
+		case nil:
+			parts[i] = "NULL"
+		default:
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, " || ")
+}
+
+// ConcatFilter is a WHERE condition on a concatenation, such as
+// first_name || last_name = 'AdaLovelace'. It is a types.RowCondition, so
+// storages evaluate it with the rest of the WHERE clause.
+type ConcatFilter struct {
+	Expr  ConcatExpr
+	Value interface{}
+}
+
+// MatchRow implements types.RowCondition, comparing the concatenation with
+// the string form of the value
+func (f ConcatFilter) MatchRow(row types.Row) (match, ok bool) {
+	val := f.Expr.Eval(row)
+	if val == nil || f.Value == nil {
+		return false, false
+	}
+	return val == fmt.Sprint(f.Value), true
+}
+
+// Columns implements types.RowCondition
+func (f ConcatFilter) Columns() []string {
+	return f.Expr.Columns()
+}
+
+// String implements types.RowCondition
+func (f ConcatFilter) String() string {
+	return f.Expr.String() + " = " + ConcatExpr{Operands: []interface{}{f.Value}}.String()
+}
+
+// parseConcat parses operand || operand [|| ...] starting at the current
+// token and leaves the parser on the token after the last operand
+func (p *Parser) parseConcat() (ConcatExpr, error) {
+	var expr ConcatExpr
+	for {
+		op, err := p.parseConcatOperand()
+		if err != nil {
+			return expr, err
+		}
+		expr.Operands = append(expr.Operands, op)
+		p.nextToken()
+		if p.currentToken.Type != lexer.CONCAT {
+			return expr, nil
+		}
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseConcatOperand() (interface{}, error) {
+	tok := p.currentToken
+	switch tok.Type {
+	case lexer.IDENTIFIER:
+		if strings.EqualFold(tok.Literal, "NULL") {
+			return nil, nil
+		}
+		return ColumnRef{Column: tok.Literal}, nil
+	case lexer.STRING:
+		return strings.Trim(tok.Literal, "'\""), nil
+	case lexer.NUMBER:
+		return parseNumber(tok.Literal)
+	case lexer.VARIABLE:
+		return Variable{Name: tok.Literal}, nil
+	}
+	return nil, fmt.Errorf("expected a column or value in || expression, got %s", tok.Literal)
+}
+
+// HasExpressions reports whether the SELECT computes columns, aggregates,
+// groups, sorts, drops duplicates or limits the rows, which only
+// SelectStatement.Execute evaluates
+func (s *SelectStatement) HasExpressions() bool {
+	return len(s.Exprs) > 0 || len(s.Aggregates) > 0 || len(s.GroupBy) > 0 || len(s.OrderBy) > 0 || s.Distinct || s.Limit != nil
+}
+
+// sourceColumns returns the stored columns the SELECT reads
+func (s *SelectStatement) sourceColumns() []string {
+	if !s.HasExpressions() {
+		return s.Columns
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	add := func(names ...string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	for _, col := range s.Columns {
+		if expr, ok := s.Exprs[col]; ok {
+			add(expr.Columns()...)
+		} else if call, ok := s.Aggregates[col]; ok {
+			if call.Column != "*" {
+				add(call.Column)
+			}
+		} else {
+			add(col)
+		}
+	}
+	add(s.GroupBy...)
+	for _, clause := range s.OrderBy {
+		if expr, ok := s.Exprs[clause.Column]; ok {
+			add(expr.Columns()...)
+		} else if _, ok := s.Aggregates[clause.Column]; !ok {
+			add(clause.Column)
+		}
+	}
+	if len(columns) == 0 || seen["*"] {
+		return []string{"*"}
+	}
+	return columns
+}
+
+// project evaluates the computed columns of each row, or the aggregates
+// over all rows or each group, and drops the stored columns that were only read for
+// expressions. For SELECT DISTINCT it then drops repeated rows, and
+// finally applies a LIMIT the storage did not. mask, if not nil, is
+// applied to the MIN and MAX results.
+func (s *SelectStatement) project(rows []types.Row, mask rowMask) ([]types.Row, error) {
+	if !s.HasExpressions() {
+		return rows, nil
+	}
+	var projected []types.Row
+	if len(s.GroupBy) > 0 {
+		grouped, err := s.group(rows, mask)
+		if err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		s.sortRows(grouped)
+		s.traceStage("Sort", start, len(grouped))
+		projected = make([]types.Row, len(grouped))
+		for i, row := range grouped {
+			out := make(types.Row, len(s.Columns))
+			for _, col := range s.Columns {
+				out[col] = row[col]
+			}
+			projected[i] = out
+		}
+	} else if len(s.Aggregates) > 0 {
+		start := time.Now()
+		row, aggs, err := types.AggregateRows(s.Aggregates, rows)
+		if err != nil {
+			return nil, err
+		}
+		s.maskExtremes(row, mask)
+		s.traceAggregate(start, 1, []map[string]types.Aggregate{aggs})
+		projected = []types.Row{row}
+	} else {
+		start := time.Now()
+		projected = make([]types.Row, len(rows))
+		for i, row := range rows {
+			projected[i] = s.projectRow(row)
+		}
+		s.traceStage("Project", start, len(projected))
+	}
+	if s.Distinct {
+		start := time.Now()
+		projected = types.DistinctRows(projected)
+		s.traceStage("Distinct", start, len(projected))
+	}
+	if s.Limit != nil && !s.pushLimit() {
+		start := time.Now()
+		projected = s.Limit.Apply(projected)
+		s.traceStage("Limit", start, len(projected))
+	}
+	return projected, nil
+}
+
+// projectRow evaluates the computed columns of a row and keeps the
+// columns the SELECT returns
+func (s *SelectStatement) projectRow(row types.Row) types.Row {
+	out := make(types.Row, len(s.Columns))
+	for _, col := range s.Columns {
+		if expr, ok := s.Exprs[col]; ok {
+			out[col] = expr.Eval(row)
+		} else if col == "*" {
+			for k, v := range row {
+				if _, ok := out[k]; !ok {
+					out[k] = v
+				}
+			}
+		} else {
+			out[col] = row[col]
+		}
+	}
+	return out
+}
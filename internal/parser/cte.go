@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// CTE is a named subquery in a WITH clause
+type CTE struct {
+	Name   string
+	Select *SelectStatement
+}
+
+// cteStorage resolves CTE names to their materialized rows before falling
+// back to the real tables, so a CTE shadows a table of the same name for the
+// duration of one statement
+type cteStorage struct {
+	types.Storage
+	relations types.Storage
+	mask      rowMask
+}
+
+// rowMask masks rows read from a stored table
+type rowMask func(table string, rows []types.Row) []types.Row
+
+// WithCTEs materializes each CTE once, in order, and returns a storage in
+// which the CTE names resolve to the materialized rows. A CTE may read the
+// real tables and any CTE defined before it; a name that is only defined by
+// the CTE itself or a later one refers to the real table, and is rejected
+// if there is none since recursive CTEs are not supported.
+func WithCTEs(base types.Storage, ctes []CTE) (types.Storage, error) {
+	return withCTEs(base, ctes, nil)
+}
+
+// withCTEs is WithCTEs with the rows a CTE reads from a stored table masked
+// by mask, if not nil
+func withCTEs(base types.Storage, ctes []CTE, mask rowMask) (types.Storage, error) {
+	if len(ctes) == 0 {
+		return base, nil
+	}
+
+	relations, err := types.NewScratchStorage()
+	if err != nil {
+		return nil, err
+	}
+	s := &cteStorage{Storage: base, relations: relations, mask: mask}
+	for i, cte := range ctes {
+		if err := checkCTEReference(base, ctes, i); err != nil {
+			return nil, err
+		}
+		if err := s.materialize(cte); err != nil {
+			return nil, fmt.Errorf("CTE %s: %w", cte.Name, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *cteStorage) materialize(cte CTE) error {
+	sel := cte.Select
+	rows, err := sel.rows(s, s.mask)
+	if err != nil {
+		return err
+	}
+	if rows, err = sel.project(rows, storedMask(s, sel.Table, s.mask)); err != nil {
+		return err
+	}
+
+	table := &types.Table{Name: cte.Name, Columns: s.resultColumns(sel)}
+	if err := s.relations.CreateTable(table); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := s.relations.Insert(cte.Name, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resultColumns derives the schema of a SELECT's result from its source
+func (s *cteStorage) resultColumns(sel *SelectStatement) []types.ColumnDefinition {
+	var source []types.ColumnDefinition
+	if def := s.GetTable(sel.Table); def != nil {
+		source = def.Columns
+	}
+	if len(sel.Columns) == 0 || (len(sel.Columns) == 1 && sel.Columns[0] == "*") {
+		columns := make([]types.ColumnDefinition, len(source))
+		for i, col := range source {
+			col.Nullable = true
+			columns[i] = col
+		}
+		return columns
+	}
+
+	columns := make([]types.ColumnDefinition, len(sel.Columns))
+	for i, name := range sel.Columns {
+		columns[i] = types.ColumnDefinition{Name: name, Type: "STRING", Nullable: true}
+		column := name
+		call, isAggregate := sel.Aggregates[name]
+		if isAggregate {
+			column = call.Column
+		}
+		for _, col := range source {
+			if col.Name == column {
+				columns[i].Type = col.Type
+			}
+		}
+		if isAggregate {
+			columns[i].Type = call.ResultType(columns[i].Type)
+		}
+	}
+	return columns
+}
+
+func (s *cteStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	if s.relations.GetTable(tableName) != nil {
+		return s.relations.Select(tableName, columns, where)
+	}
+	return s.Storage.Select(tableName, columns, where)
+}
+
+func (s *cteStorage) GetTable(tableName string) *types.Table {
+	if table := s.relations.GetTable(tableName); table != nil {
+		return table
+	}
+	return s.Storage.GetTable(tableName)
+}
+
+// checkCTEReference rejects a CTE that reads itself or a later CTE when no
+// real table of that name exists
+func checkCTEReference(base types.Storage, ctes []CTE, i int) error {
+	cte := ctes[i]
+	for _, earlier := range ctes[:i] {
+		if cte.Select.Table == earlier.Name {
+			return nil
+		}
+	}
+	if base.GetTable(cte.Select.Table) != nil {
+		return nil
+	}
+	if cte.Select.Table == cte.Name {
+		return fmt.Errorf("recursive CTE %s is not supported", cte.Name)
+	}
+	for _, later := range ctes[i+1:] {
+		if cte.Select.Table == later.Name {
+			return fmt.Errorf("CTE %s references %s before it is defined", cte.Name, later.Name)
+		}
+	}
+	return nil
+}
+
+// checkCTENames rejects a WITH clause that defines the same name twice
+func checkCTENames(ctes []CTE) error {
+	seen := make(map[string]bool, len(ctes))
+	for _, cte := range ctes {
+		if seen[cte.Name] {
+			return fmt.Errorf("duplicate CTE name %s", cte.Name)
+		}
+		seen[cte.Name] = true
+	}
+	return nil
+}
+
+// isCTE reports whether table names a CTE materialized in storage
+func isCTE(storage types.Storage, table string) bool {
+	s, ok := storage.(*cteStorage)
+	return ok && s.relations.GetTable(table) != nil
+}
+
+// storedMask returns mask for rows of a stored table, and nil for rows of
+// a CTE, which were masked as it was materialized
+func storedMask(storage types.Storage, table string, mask rowMask) rowMask {
+	if isCTE(storage, table) {
+		return nil
+	}
+	return mask
+}
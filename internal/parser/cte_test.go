@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// countingStorage counts the SELECTs issued against each real table
+type countingStorage struct {
+	types.Storage
+	selects map[string]int
+}
+
+func (s *countingStorage) Select(table string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	s.selects[table]++
+	return s.Storage.Select(table, columns, where)
+}
+
+func newEmployees(t *testing.T) *countingStorage {
+	t.Helper()
+	store := storage.NewInMemoryStorage()
+	err := store.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING"},
+			{Name: "department", Type: "STRING"},
+			{Name: "level", Type: "INT"},
+		},
+	})
+	assert.NoError(t, err)
+	for _, row := range []map[string]interface{}{
+		{"id": float64(1), "name": "Ann", "department": "Engineering", "level": float64(3)},
+		{"id": float64(2), "name": "Bob", "department": "Sales", "level": float64(3)},
+		{"id": float64(3), "name": "Cid", "department": "Engineering", "level": float64(1)},
+	} {
+		assert.NoError(t, store.Insert("employees", row))
+	}
+	return &countingStorage{Storage: store, selects: make(map[string]int)}
+}
+
+func TestParseWith(t *testing.T) {
+	stmt, err := Parse("WITH eng AS (SELECT * FROM employees WHERE department = 'Engineering'), top AS (SELECT name FROM eng) SELECT name FROM top;")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT", stmt.Type)
+
+	sel := stmt.SelectStatement
+	assert.Equal(t, "top", sel.Table)
+	assert.Equal(t, []string{"name"}, sel.Columns)
+	if assert.Len(t, sel.With, 2) {
+		assert.Equal(t, "eng", sel.With[0].Name)
+		assert.Equal(t, &SelectStatement{
+			Table:   "employees",
+			Columns: []string{"*"},
+			Where:   types.Condition("department", "Engineering"),
+		}, sel.With[0].Select)
+		assert.Equal(t, "top", sel.With[1].Name)
+		assert.Equal(t, "eng", sel.With[1].Select.Table)
+	}
+}
+
+func TestParseWithErrors(t *testing.T) {
+	tests := map[string]string{
+		"WITH a AS (SELECT * FROM t), a AS (SELECT * FROM t) SELECT * FROM a": "duplicate CTE name a",
+		"WITH a (SELECT * FROM t) SELECT * FROM a":                            "expected AS",
+		"WITH a AS (SELECT * FROM t SELECT * FROM a":                          "expected )",
+		"WITH a AS (SELECT * FROM t) DELETE FROM a":                           "expected SELECT",
+	}
+	for sql, want := range tests {
+		_, err := Parse(sql)
+		if assert.Error(t, err, sql) {
+			assert.Contains(t, err.Error(), want, sql)
+		}
+	}
+}
+
+func TestWithExecution(t *testing.T) {
+	store := newEmployees(t)
+	session := NewSession()
+
+	// eng is referenced by two later CTEs but materialized once
+	result, err := execSQL(t, session, store,
+		"WITH eng AS (SELECT * FROM employees WHERE department = 'Engineering'), "+
+			"senior AS (SELECT * FROM eng WHERE level = 3), "+
+			"names AS (SELECT name FROM eng) "+
+			"SELECT name FROM senior")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Ann"}}, result)
+	assert.Equal(t, 1, store.selects["employees"])
+
+	// A CTE shadows a real table of the same name for that statement only
+	result, err = execSQL(t, session, store,
+		"WITH sales AS (SELECT * FROM employees WHERE department = 'Sales'), "+
+			"employees AS (SELECT * FROM sales) SELECT name FROM employees")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Bob"}}, result)
+
+	rows, err := store.Select("employees", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	// Without a real table of that name, self and forward references fail
+	_, err = execSQL(t, session, store, "WITH a AS (SELECT * FROM a) SELECT * FROM a")
+	assert.EqualError(t, err, "recursive CTE a is not supported")
+	_, err = execSQL(t, session, store, "WITH a AS (SELECT * FROM b), b AS (SELECT * FROM employees) SELECT * FROM a")
+	assert.EqualError(t, err, "CTE a references b before it is defined")
+
+	// Variables are bound inside CTEs
+	session.Set("dept", "Sales")
+	result, err = execSQL(t, session, store,
+		"WITH d AS (SELECT * FROM employees WHERE department = @dept) SELECT id FROM d")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(2)}}, result, "INT columns are normalized when materialized")
+}
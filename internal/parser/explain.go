@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+)
+
+// ExplainStatement asks for the execution plan of another statement
+// (EXPLAIN [ANALYZE] [FORMAT JSON] UPDATE ...). Plans are built by the
+// planner package, so the statement does not execute by itself.
+type ExplainStatement struct {
+	Analyze   bool
+	JSON      bool
+	Statement *Statement
+}
+
+// parseExplain parses the options of an EXPLAIN and the statement they
+// apply to
+func (p *Parser) parseExplain() (*ExplainStatement, error) {
+	stmt := &ExplainStatement{}
+
+	p.nextToken()
+	for {
+		if p.isWord("ANALYZE") {
+			stmt.Analyze = true
+			p.nextToken()
+			continue
+		}
+		if p.isWord("FORMAT") {
+			p.nextToken()
+			switch {
+			case p.isWord("JSON"):
+				stmt.JSON = true
+			case strings.EqualFold(p.currentToken.Literal, "TEXT"):
+			default:
+				return nil, fmt.Errorf("expected TEXT or JSON after FORMAT, got %s", p.currentToken.Literal)
+			}
+			p.nextToken()
+			continue
+		}
+		break
+	}
+
+	if p.currentToken.Type == lexer.EOF || p.currentToken.Type == lexer.SEMICOLON {
+		return nil, fmt.Errorf("expected statement after EXPLAIN")
+	}
+	if p.currentToken.Type == lexer.KEYWORD && p.currentToken.Literal == "EXPLAIN" {
+		return nil, fmt.Errorf("EXPLAIN cannot explain another EXPLAIN")
+	}
+	inner, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Statement = inner
+	return stmt, nil
+}
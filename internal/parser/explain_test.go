@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParseExplain(t *testing.T) {
+	stmt, err := Parse("EXPLAIN SELECT id FROM employees WHERE id = 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, "EXPLAIN", stmt.Type)
+	assert.False(t, stmt.ExplainStatement.Analyze)
+	assert.False(t, stmt.ExplainStatement.JSON)
+	assert.Equal(t, "SELECT", stmt.ExplainStatement.Statement.Type)
+	assert.Equal(t, "employees", stmt.ExplainStatement.Statement.SelectStatement.Table)
+
+	for sql, inner := range map[string]string{
+		"EXPLAIN UPDATE employees SET salary = 1 WHERE id = 1": "UPDATE",
+		"EXPLAIN INSERT INTO employees VALUES (1, 'Ann');":     "INSERT",
+		"EXPLAIN DELETE FROM employees WHERE id = 1":           "DELETE",
+		"EXPLAIN CREATE TABLE t (id INT)":                      "CREATE",
+		"EXPLAIN CREATE INDEX idx ON t (id)":                   "CREATE INDEX",
+	} {
+		stmt, err := Parse(sql)
+		assert.NoError(t, err, sql)
+		assert.Equal(t, inner, stmt.ExplainStatement.Statement.Type, sql)
+	}
+
+	stmt, err = Parse("EXPLAIN ANALYZE FORMAT JSON DELETE FROM employees;")
+	assert.NoError(t, err)
+	assert.True(t, stmt.ExplainStatement.Analyze)
+	assert.True(t, stmt.ExplainStatement.JSON)
+	stmt, err = Parse("EXPLAIN FORMAT TEXT SELECT * FROM employees;")
+	assert.NoError(t, err)
+	assert.False(t, stmt.ExplainStatement.JSON)
+
+	for sql, want := range map[string]string{
+		"EXPLAIN;":                            "expected statement after EXPLAIN",
+		"EXPLAIN ANALYZE":                     "expected statement after EXPLAIN",
+		"EXPLAIN FORMAT XML SELECT * FROM t;": "expected TEXT or JSON after FORMAT, got XML",
+		"EXPLAIN EXPLAIN SELECT * FROM t;":    "EXPLAIN cannot explain another EXPLAIN",
+		"EXPLAIN DROP t;":                     "expected TABLE, got t",
+	} {
+		_, err := Parse(sql)
+		assert.EqualError(t, err, want, sql)
+	}
+}
+
+func TestExplainBindAndCheck(t *testing.T) {
+	session := NewSession()
+	session.Set("id", 7)
+	stmt, err := Parse("EXPLAIN DELETE FROM employees WHERE id = @id;")
+	assert.NoError(t, err)
+	bound, err := session.Bind(stmt)
+	assert.NoError(t, err)
+	assert.Equal(t, types.Condition("id", 7), bound.ExplainStatement.Statement.DeleteStatement.Where)
+
+	// Only EXPLAIN ANALYZE runs the statement, so only it needs writes
+	readOnly := types.Capabilities{ReadOnly: true}
+	assert.NoError(t, stmt.CheckSupported(readOnly))
+	stmt, err = Parse("EXPLAIN ANALYZE DELETE FROM employees;")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, stmt.CheckSupported(readOnly), types.ErrNotSupported)
+
+	_, err = stmt.Execute(nil)
+	assert.EqualError(t, err, "EXPLAIN requires a planner")
+}
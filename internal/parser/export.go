@@ -0,0 +1,265 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/formatter"
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// ExportStatement writes the result of a query to a file (EXPORT (SELECT *
+// FROM users) TO 'users.csv' [FORMAT CSV|JSON]). CSV, the default, has a
+// header row; JSON writes JSON Lines, one object per row.
+type ExportStatement struct {
+	Select *SelectStatement
+	Path   string
+	Format string
+}
+
+// ExportTable writes every row of a table to the file at path, in the
+// format its extension names (see ExportFormat), with the columns in
+// schema order and masked columns masked as a session would show them
+func ExportTable(storage types.Storage, tableName, path string) error {
+	format, err := ExportFormat(path)
+	if err != nil {
+		return err
+	}
+	if storage.GetTable(tableName) == nil {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	stmt := &ExportStatement{
+		Select: &SelectStatement{Table: tableName, Columns: []string{"*"}},
+		Path:   path,
+		Format: format,
+	}
+	_, err = stmt.execute(storage, func(table string, rows []types.Row) []types.Row {
+		return types.MaskRows(storage.GetTable(table), rows)
+	})
+	return err
+}
+
+// ExportFormat returns the export format a file extension names: CSV for
+// .csv and JSON for .json or .jsonl
+func ExportFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "CSV", nil
+	case ".json", ".jsonl":
+		return "JSON", nil
+	}
+	return "", fmt.Errorf("cannot tell the export format of %s; use a .csv or .json file or give the format", path)
+}
+
+func (p *Parser) parseExport() (*ExportStatement, error) {
+	stmt := &ExportStatement{Format: "CSV"}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.LPAREN {
+		return nil, fmt.Errorf("expected (, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Literal != "SELECT" {
+		return nil, fmt.Errorf("expected SELECT, got %s", p.currentToken.Literal)
+	}
+	sel, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if sel.Table == "" {
+		return nil, fmt.Errorf("expected FROM in EXPORT")
+	}
+	if p.currentToken.Type != lexer.RPAREN {
+		return nil, fmt.Errorf("expected ), got %s", p.currentToken.Literal)
+	}
+	stmt.Select = sel
+
+	p.nextToken()
+	if !p.isWord("TO") {
+		return nil, fmt.Errorf("expected TO, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Type != lexer.STRING || p.currentToken.Literal == "" {
+		return nil, fmt.Errorf("expected export file path, got %s", p.currentToken.Literal)
+	}
+	stmt.Path = p.currentToken.Literal
+
+	p.nextToken()
+	if p.isWord("FORMAT") {
+		p.nextToken()
+		stmt.Format = strings.ToUpper(p.currentToken.Literal)
+		if stmt.Format != "CSV" && stmt.Format != "JSON" {
+			return nil, fmt.Errorf("expected CSV or JSON after FORMAT, got %s", p.currentToken.Literal)
+		}
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after EXPORT", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// Execute runs the query and writes its rows to the file
+func (s *ExportStatement) Execute(storage types.Storage) (interface{}, error) {
+	return s.execute(storage, nil)
+}
+
+// execute runs the query as SELECT does, reading stored rows through mask,
+// and writes the rows one at a time, in the order of ResultColumns, through
+// a buffered writer. A query whose rows need no ORDER BY, DISTINCT,
+// grouping or aggregate streams them from the storage scan to the file, so
+// its result is never held in memory; other queries are run in full
+// first, as SELECT does, and each row is dropped once written.
+func (s *ExportStatement) execute(storage types.Storage, mask rowMask) (interface{}, error) {
+	sel := s.Select
+	if table := storage.GetTable(sel.Table); table != nil && sel.streams() {
+		columns := sel.ResultColumns(table, nil)
+		return s.write(columns, func(write func(types.Row) error) error {
+			return sel.each(storage, mask, write)
+		})
+	}
+
+	rows, err := sel.execute(storage, mask)
+	if err != nil {
+		return nil, err
+	}
+	columns := sel.ResultColumns(storage.GetTable(sel.Table), rows)
+	return s.write(columns, func(write func(types.Row) error) error {
+		for i, row := range rows {
+			if err := write(row); err != nil {
+				return err
+			}
+			rows[i] = nil
+		}
+		return nil
+	})
+}
+
+// write creates the export file and writes to it the rows produce passes
+// to its write function
+func (s *ExportStatement) write(columns []string, produce func(write func(types.Row) error) error) (interface{}, error) {
+	f, err := os.Create(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer f.Close()
+	buf := bufio.NewWriter(f)
+
+	var w formatter.RowWriter
+	if s.Format == "JSON" {
+		w, err = formatter.NewJSONLines(buf, columns)
+	} else {
+		w, err = formatter.NewCSVColumns(buf, columns)
+	}
+	if err != nil {
+		return nil, err
+	}
+	written := 0
+	err = produce(func(row types.Row) error {
+		if err := w.WriteRow(row); err != nil {
+			return fmt.Errorf("row %d: %w", written+1, err)
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return []types.Row{{"rows_exported": written, "path": s.Path}}, nil
+}
+
+// errScanDone stops a streamed scan once a LIMIT has all its rows
+var errScanDone = errors.New("scan done")
+
+// streams reports whether the rows of the SELECT can be produced one at a
+// time as the storage reads them, which they can unless something done
+// after reading needs every row or the rows come from a CTE or sample
+func (s *SelectStatement) streams() bool {
+	return len(s.With) == 0 && s.Sample == nil && len(s.Aggregates) == 0 && len(s.GroupBy) == 0 && len(s.OrderBy) == 0 && !s.Distinct
+}
+
+// each passes the rows of a SELECT that streams to fn one at a time, as
+// execute would return them, reading stored rows through mask
+func (s *SelectStatement) each(storage types.Storage, mask rowMask, fn func(types.Row) error) error {
+	if err := s.checkLimitBound(); err != nil {
+		return err
+	}
+	if s.Limit != nil && s.Limit.Done(0) {
+		return nil
+	}
+	matched := 0
+	err := types.SelectEach(storage, s.Table, s.sourceColumns(), s.Where, func(row types.Row) error {
+		matched++
+		if s.Limit != nil && matched <= s.Limit.Offset {
+			return nil
+		}
+		rows := []types.Row{row}
+		if mask != nil {
+			rows = mask(s.Table, rows)
+		}
+		out := rows[0]
+		if s.HasExpressions() {
+			out = s.projectRow(out)
+		}
+		if err := fn(out); err != nil {
+			return err
+		}
+		if s.Limit != nil && s.Limit.Done(matched) {
+			return errScanDone
+		}
+		return nil
+	})
+	if err == errScanDone {
+		return nil
+	}
+	return err
+}
+
+// ResultColumns returns the columns of the query's result in the order it
+// selects them, * standing for the columns of table in schema order.
+// Result columns the query does not name, if any, follow in name order.
+func (s *SelectStatement) ResultColumns(table *types.Table, rows []types.Row) []string {
+	var columns []string
+	for _, col := range s.Columns {
+		if col != "*" {
+			columns = append(columns, col)
+			continue
+		}
+		if table != nil {
+			for _, def := range table.Columns {
+				columns = append(columns, def.Name)
+			}
+		}
+	}
+
+	named := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		named[col] = true
+	}
+	var extra []string
+	for _, row := range rows {
+		for col := range row {
+			if !named[col] {
+				named[col] = true
+				extra = append(extra, col)
+			}
+		}
+	}
+	sort.Strings(extra)
+	return append(columns, extra...)
+}
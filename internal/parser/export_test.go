@@ -0,0 +1,234 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParseExport(t *testing.T) {
+	stmt, err := Parse("EXPORT (SELECT id, name FROM users WHERE id > 1) TO 'users.json' FORMAT JSON;")
+	assert.NoError(t, err)
+	assert.Equal(t, "EXPORT", stmt.Type)
+	assert.Equal(t, "users.json", stmt.ExportStatement.Path)
+	assert.Equal(t, "JSON", stmt.ExportStatement.Format)
+	assert.Equal(t, "users", stmt.ExportStatement.Select.Table)
+	assert.Equal(t, []string{"id", "name"}, stmt.ExportStatement.Select.Columns)
+
+	stmt, err = Parse("EXPORT (SELECT * FROM users) TO 'users.csv'")
+	assert.NoError(t, err)
+	assert.Equal(t, "CSV", stmt.ExportStatement.Format)
+
+	for sql, want := range map[string]string{
+		"EXPORT SELECT * FROM users TO 'u.csv';":          "expected (, got SELECT",
+		"EXPORT (SELECT @x) TO 'u.csv';":                  "expected FROM in EXPORT",
+		"EXPORT (SELECT * FROM users) INTO 'u.csv';":      "expected TO, got INTO",
+		"EXPORT (SELECT * FROM users) TO u;":              "expected export file path, got u",
+		"EXPORT (SELECT * FROM users) TO 'u' FORMAT XML;": "expected CSV or JSON after FORMAT, got XML",
+	} {
+		_, err := Parse(sql)
+		assert.EqualError(t, err, want, sql)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := storage.NewBTreeStorage(filepath.Join(dir, "export.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	session := NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name STRING, bio TEXT)",
+		"CREATE TABLE copy (id INT PRIMARY KEY, name STRING, bio TEXT)",
+		`INSERT INTO users VALUES (1, 'Ann', 'likes "quotes", and commas'), (2, 'Bob', NULL), (3, 'Cy', 'multi
+line')`,
+	} {
+		_, err := execSQL(t, session, btree, sql)
+		assert.NoError(t, err, sql)
+	}
+
+	// The header follows the schema, whatever the order of the row maps
+	path := filepath.Join(dir, "users.csv")
+	result, err := execSQL(t, session, btree, fmt.Sprintf("EXPORT (SELECT * FROM users) TO '%s';", path))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"rows_exported": 3, "path": path}}, result)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "id,name,bio\r\n", string(data[:len("id,name,bio\r\n")]))
+
+	result, err = execSQL(t, session, btree, fmt.Sprintf("IMPORT CSV '%s' INTO copy;", path))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.([]types.Row)[0]["rows_imported"])
+
+	want, err := execSQL(t, session, btree, "SELECT * FROM users ORDER BY id")
+	assert.NoError(t, err)
+	got, err := execSQL(t, session, btree, "SELECT * FROM copy ORDER BY id")
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// JSON Lines keep the order of the SELECT list
+	path = filepath.Join(dir, "users.json")
+	_, err = execSQL(t, session, btree, fmt.Sprintf("EXPORT (SELECT name, id FROM users WHERE id < 3 ORDER BY id) TO '%s' FORMAT JSON;", path))
+	assert.NoError(t, err)
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"Ann","id":1}`+"\n"+`{"name":"Bob","id":2}`+"\n", string(data))
+}
+
+func TestExportMasksColumns(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT, email STRING)",
+		"INSERT INTO users VALUES (1, 'abcdef@example.com')",
+		"ALTER TABLE users ALTER COLUMN email SET MASKED USING 'partial(3)'",
+	} {
+		_, err := execSQL(t, session, store, sql)
+		assert.NoError(t, err, sql)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.csv")
+	_, err := execSQL(t, session, store, fmt.Sprintf("EXPORT (SELECT * FROM users) TO '%s';", path))
+	assert.NoError(t, err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "id,email\r\n1,abc*****@*****\r\n", string(data))
+}
+
+func TestExportTable(t *testing.T) {
+	dir := t.TempDir()
+	store := storage.NewInMemoryStorage()
+	columns := []types.ColumnDefinition{
+		{Name: "id", Type: "INT"},
+		{Name: "name", Type: "STRING", Nullable: true},
+		{Name: "dept", Type: "STRING", Nullable: true},
+	}
+	for _, name := range []string{"employees", "restored"} {
+		assert.NoError(t, store.CreateTable(&types.Table{Name: name, Columns: columns}))
+	}
+	for i, name := range []string{"Ann", "Bob", "Cy"} {
+		assert.NoError(t, store.Insert("employees", map[string]interface{}{"id": i + 1, "name": name, "dept": "Sales"}))
+	}
+
+	// The columns follow the table definition
+	path := filepath.Join(dir, "employees.csv")
+	assert.NoError(t, ExportTable(store, "employees", path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "id,name,dept\r\n1,Ann,Sales\r\n2,Bob,Sales\r\n3,Cy,Sales\r\n", string(data))
+
+	assert.NoError(t, ImportCSV(store, "restored", path))
+	want, err := store.Select("employees", []string{"*"}, nil)
+	assert.NoError(t, err)
+	got, err := store.Select("restored", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+
+	// .json writes JSON Lines
+	path = filepath.Join(dir, "employees.json")
+	assert.NoError(t, ExportTable(store, "employees", path))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `{"id":2,"name":"Bob","dept":"Sales"}`+"\n")
+
+	assert.EqualError(t, ExportTable(store, "employees", filepath.Join(dir, "employees.txt")),
+		"cannot tell the export format of "+filepath.Join(dir, "employees.txt")+"; use a .csv or .json file or give the format")
+	assert.EqualError(t, ExportTable(store, "missing", path), "table missing does not exist")
+}
+
+func TestExportTableMasksColumns(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	assert.NoError(t, store.CreateTable(&types.Table{Name: "users", Columns: []types.ColumnDefinition{
+		{Name: "id", Type: "INT"},
+		{Name: "email", Type: "STRING", Mask: "partial(3)"},
+	}}))
+	assert.NoError(t, store.Insert("users", map[string]interface{}{"id": 1, "email": "abcdef@example.com"}))
+
+	path := filepath.Join(t.TempDir(), "users.csv")
+	assert.NoError(t, ExportTable(store, "users", path))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "id,email\r\n1,abc*****@*****\r\n", string(data))
+}
+
+// scanOnly is a storage that can only be read a row at a time, and records
+// the largest heap growth seen while its rows are read
+type scanOnly struct {
+	types.Storage
+	base   uint64
+	growth uint64
+	rows   int
+}
+
+func (s *scanOnly) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	return nil, fmt.Errorf("read all of %s", tableName)
+}
+
+func (s *scanOnly) SelectEach(tableName string, columns []string, where *types.WhereExpr, fn func(row types.Row) error) error {
+	return types.SelectEach(s.Storage, tableName, columns, where, func(row types.Row) error {
+		if s.rows++; s.rows%1000 == 0 {
+			if heap := heapAlloc(); heap > s.base && heap-s.base > s.growth {
+				s.growth = heap - s.base
+			}
+		}
+		return fn(row)
+	})
+}
+
+func heapAlloc() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestExportStreamsRows(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := storage.NewBTreeStorage(filepath.Join(dir, "stream.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	session := NewSession()
+	_, err = execSQL(t, session, btree, "CREATE TABLE docs (id INT PRIMARY KEY, body TEXT)")
+	assert.NoError(t, err)
+	const count, size = 10000, 1024
+	body := strings.Repeat("x", size)
+	rows := make([]map[string]interface{}, 0, 1000)
+	for i := 1; i <= count; i++ {
+		rows = append(rows, map[string]interface{}{"id": i, "body": body})
+		if len(rows) == cap(rows) {
+			assert.NoError(t, types.InsertRows(btree, "docs", rows))
+			rows = rows[:0]
+		}
+	}
+
+	// Rows go from the scan to the file without the result being collected,
+	// so the heap does not grow with the size of the export
+	store := &scanOnly{Storage: btree}
+	store.base = heapAlloc()
+	path := filepath.Join(dir, "docs.json")
+	result, err := execSQL(t, session, store, fmt.Sprintf("EXPORT (SELECT id, body FROM docs WHERE id > 0) TO '%s' FORMAT JSON;", path))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"rows_exported": count, "path": path}}, result)
+	assert.Equal(t, count, store.rows)
+	assert.Less(t, store.growth, uint64(count*size/4))
+
+	// LIMIT and OFFSET stop the scan once the rows are written
+	store.rows = 0
+	_, err = execSQL(t, session, store, fmt.Sprintf("EXPORT (SELECT id FROM docs LIMIT 2 OFFSET 3) TO '%s';", path))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, store.rows)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "id\r\n4\r\n5\r\n", string(data))
+
+	// A query that needs every row first still reads them in full
+	_, err = execSQL(t, session, store, fmt.Sprintf("EXPORT (SELECT id FROM docs ORDER BY id) TO '%s';", path))
+	assert.EqualError(t, err, "read all of docs")
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// isGroupBy reports whether the parser is at GROUP BY
+func (p *Parser) isGroupBy() bool {
+	return strings.EqualFold(p.currentToken.Literal, "GROUP") && strings.EqualFold(p.peekToken.Literal, "BY")
+}
+
+// parseGroupBy parses GROUP BY col [, ...] and leaves the parser on the
+// token after it
+func (p *Parser) parseGroupBy() ([]string, error) {
+	p.nextToken() // move past GROUP
+	var columns []string
+	for {
+		p.nextToken()
+		if p.currentToken.Type != lexer.IDENTIFIER {
+			return nil, fmt.Errorf("expected column in GROUP BY, got %s", p.currentToken.Literal)
+		}
+		columns = append(columns, p.currentToken.Literal)
+
+		p.nextToken()
+		if p.currentToken.Type != lexer.COMMA {
+			return columns, nil
+		}
+	}
+}
+
+// isGroupColumn reports whether col is listed in GROUP BY
+func (s *SelectStatement) isGroupColumn(col string) bool {
+	for _, name := range s.GroupBy {
+		if name == col {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGroupBy rejects GROUP BY columns that are not columns of table
+func (s *SelectStatement) checkGroupBy(table *types.Table) error {
+	if table == nil {
+		return nil // let the storage report the missing table
+	}
+	for _, name := range s.GroupBy {
+		found := false
+		for _, col := range table.Columns {
+			if col.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("GROUP BY column %s does not exist in table %s", name, s.Table)
+		}
+	}
+	return nil
+}
+
+// maskGroupColumns applies mask to the GROUP BY columns of rows only.
+// Aggregates count stored values, but the group values are shown.
+func (s *SelectStatement) maskGroupColumns(rows []types.Row, mask rowMask) []types.Row {
+	keys := make([]types.Row, len(rows))
+	for i, row := range rows {
+		keys[i] = make(types.Row, len(s.GroupBy))
+		for _, col := range s.GroupBy {
+			keys[i][col] = row[col]
+		}
+	}
+	keys = mask(s.Table, keys)
+
+	masked := make([]types.Row, len(rows))
+	for i, row := range rows {
+		masked[i] = make(types.Row, len(row))
+		for col, val := range row {
+			masked[i][col] = val
+		}
+		for col, val := range keys[i] {
+			masked[i][col] = val
+		}
+	}
+	return masked
+}
+
+// maskExtremes applies mask to the MIN and MAX results in row. The other
+// aggregates count or sum stored values, but MIN and MAX return one.
+func (s *SelectStatement) maskExtremes(row types.Row, mask rowMask) {
+	if mask == nil {
+		return
+	}
+	for name, call := range s.Aggregates {
+		if call.Func != "MIN" && call.Func != "MAX" {
+			continue
+		}
+		masked := mask(s.Table, []types.Row{{call.Column: row[name]}})
+		row[name] = masked[0][call.Column]
+	}
+}
+
+// group evaluates the aggregates over each group of rows with equal GROUP
+// BY values and returns one row per group, holding the group values and
+// the aggregates, in the order groups first appear. MIN and MAX results
+// are masked by mask, if not nil.
+func (s *SelectStatement) group(rows []types.Row, mask rowMask) ([]types.Row, error) {
+	start := time.Now()
+	var grouped []types.Row
+	var aggs []map[string]types.Aggregate
+	for _, members := range types.GroupRows(rows, s.GroupBy) {
+		row, groupAggs, err := types.AggregateRows(s.Aggregates, members)
+		if err != nil {
+			return nil, err
+		}
+		s.maskExtremes(row, mask)
+		for _, col := range s.GroupBy {
+			row[col] = members[0][col]
+		}
+		grouped = append(grouped, row)
+		if s.trace != nil {
+			aggs = append(aggs, groupAggs)
+		}
+	}
+	s.traceAggregate(start, len(grouped), aggs)
+	return grouped, nil
+}
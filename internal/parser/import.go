@@ -0,0 +1,328 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// ImportBatchSize is the number of CSV rows IMPORT CSV inserts at a time
+const ImportBatchSize = 500
+
+// maxFailedLines caps the line numbers an import result lists
+const maxFailedLines = 20
+
+// ImportStatement bulk loads a CSV file into an existing table (IMPORT CSV
+// 'users.csv' INTO users [HEADER ON|OFF] [NULL 'NA'] [ON ERROR SKIP|ABORT]).
+// With Header set, the default, the first record names the table columns
+// of the fields; otherwise the fields are the table columns in order. A
+// field equal to Null, by default the empty string, is NULL. With Abort
+// set, a line that does not fit the schema stops the import instead of
+// being skipped.
+type ImportStatement struct {
+	Path   string
+	Table  string
+	Header bool
+	Null   string
+	Abort  bool
+}
+
+// ImportCSV imports the CSV file at path, whose first line names the
+// columns, into an existing table. It stops at the first line that does not
+// fit the schema, such as one with the wrong number of fields; the rows of
+// the batches before it stay inserted.
+func ImportCSV(storage types.Storage, tableName, path string) error {
+	_, err := (&ImportStatement{Path: path, Table: tableName, Header: true, Abort: true}).Import(storage)
+	return err
+}
+
+// ImportResult reports the rows an IMPORT CSV inserted and the lines it
+// skipped because they did not fit the table schema
+type ImportResult struct {
+	Rows        int
+	FailedLines []int
+	FirstError  string
+}
+
+// Row returns the result as a single result row, listing at most 20 of the
+// failed line numbers
+func (r *ImportResult) Row() types.Row {
+	lines := make([]string, 0, len(r.FailedLines))
+	for i, line := range r.FailedLines {
+		if i == maxFailedLines {
+			lines = append(lines, "...")
+			break
+		}
+		lines = append(lines, fmt.Sprint(line))
+	}
+	return types.Row{
+		"rows_imported": r.Rows,
+		"rows_failed":   len(r.FailedLines),
+		"failed_lines":  strings.Join(lines, ", "),
+		"first_error":   r.FirstError,
+	}
+}
+
+func (p *Parser) parseImport() (*ImportStatement, error) {
+	stmt := &ImportStatement{Header: true}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "CSV") {
+		return nil, fmt.Errorf("expected CSV, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.STRING || p.currentToken.Literal == "" {
+		return nil, fmt.Errorf("expected CSV file path, got %s", p.currentToken.Literal)
+	}
+	stmt.Path = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Literal != "INTO" {
+		return nil, fmt.Errorf("expected INTO, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	for p.nextToken(); p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON; p.nextToken() {
+		switch {
+		case p.isWord("HEADER"):
+			p.nextToken()
+			switch {
+			case p.isWord("ON"):
+				stmt.Header = true
+			case p.isWord("OFF"):
+				stmt.Header = false
+			default:
+				return nil, fmt.Errorf("expected ON or OFF after HEADER, got %s", p.currentToken.Literal)
+			}
+		case p.isWord("NULL"):
+			p.nextToken()
+			if p.currentToken.Type != lexer.STRING {
+				return nil, fmt.Errorf("expected a string after NULL, got %s", p.currentToken.Literal)
+			}
+			stmt.Null = p.currentToken.Literal
+		case p.isWord("ON"):
+			p.nextToken()
+			if !p.isWord("ERROR") {
+				return nil, fmt.Errorf("expected ERROR after ON, got %s", p.currentToken.Literal)
+			}
+			p.nextToken()
+			switch {
+			case p.isWord("SKIP"):
+				stmt.Abort = false
+			case p.isWord("ABORT"):
+				stmt.Abort = true
+			default:
+				return nil, fmt.Errorf("expected SKIP or ABORT after ON ERROR, got %s", p.currentToken.Literal)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %s after IMPORT CSV", p.currentToken.Literal)
+		}
+	}
+	return stmt, nil
+}
+
+// Execute imports the CSV file and returns the result row
+func (s *ImportStatement) Execute(storage types.Storage) (interface{}, error) {
+	result, err := s.Import(storage)
+	if err != nil {
+		return nil, err
+	}
+	return []types.Row{result.Row()}, nil
+}
+
+// Import streams the CSV file into the table, ImportBatchSize rows at a
+// time through types.InsertRows, so a storage that is a BatchInserter takes
+// its table lock once per batch. A record with the wrong number of fields,
+// fields that do not convert to the column types, or no value for a NOT
+// NULL column is skipped and its line reported, or with Abort set stops
+// the import. A batch the storage rejects, say for a duplicate primary
+// key, is inserted again a row at a time so that only the rows it rejects
+// are skipped; with Abort set it stops the import, and the batches before
+// it stay inserted.
+func (s *ImportStatement) Import(storage types.Storage) (*ImportResult, error) {
+	table := storage.GetTable(s.Table)
+	if table == nil {
+		return nil, fmt.Errorf("table %s does not exist", s.Table)
+	}
+
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+
+	columns := make([]types.ColumnDefinition, len(table.Columns))
+	copy(columns, table.Columns)
+	if s.Header {
+		header, err := r.Read()
+		if err == io.EOF {
+			return &ImportResult{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV file %s: %w", s.Path, err)
+		}
+		if columns, err = importColumns(table, header); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ImportResult{}
+	var batch []map[string]interface{}
+	var lines []int // line of each row of batch
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() { batch, lines = nil, nil }()
+		err := types.InsertRows(storage, s.Table, batch)
+		if err == nil {
+			result.Rows += len(batch)
+			return nil
+		}
+		if s.Abort {
+			return fmt.Errorf("batch starting at line %d: %w (%d rows imported)", lines[0], err, result.Rows)
+		}
+		for i, row := range batch {
+			if err := storage.Insert(s.Table, row); err != nil {
+				result.fail(lines[i], err)
+				continue
+			}
+			result.Rows++
+		}
+		return nil
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			if s.Abort {
+				return nil, fmt.Errorf("line %d: %w (%d rows imported)", parseErr.StartLine, parseErr.Err, result.Rows)
+			}
+			result.fail(parseErr.StartLine, parseErr.Err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV file %s: %w", s.Path, err)
+		}
+		line, _ := r.FieldPos(0)
+
+		row, err := s.importRow(table, columns, record)
+		if err != nil && s.Abort {
+			return nil, fmt.Errorf("line %d: %w (%d rows imported)", line, err, result.Rows)
+		}
+		if err != nil {
+			result.fail(line, err)
+			continue
+		}
+		batch = append(batch, row)
+		lines = append(lines, line)
+		if len(batch) == ImportBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *ImportResult) fail(line int, err error) {
+	r.FailedLines = append(r.FailedLines, line)
+	if r.FirstError == "" {
+		r.FirstError = fmt.Sprintf("line %d: %v", line, err)
+	}
+}
+
+// importColumns returns the table columns named by a CSV header
+func importColumns(table *types.Table, header []string) ([]types.ColumnDefinition, error) {
+	byName := make(map[string]types.ColumnDefinition, len(table.Columns))
+	for _, col := range table.Columns {
+		byName[col.Name] = col
+	}
+	columns := make([]types.ColumnDefinition, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		col, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("CSV column %s does not exist in table %s", name, table.Name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("CSV column %s appears twice", name)
+		}
+		seen[name] = true
+		columns[i] = col
+	}
+	return columns, nil
+}
+
+// importRow converts the fields of a record to a row of the table. Table
+// columns the record does not cover are left to their DEFAULT or NULL, as
+// with INSERT.
+func (s *ImportStatement) importRow(table *types.Table, columns []types.ColumnDefinition, record []string) (map[string]interface{}, error) {
+	if len(record) != len(columns) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(columns), len(record))
+	}
+
+	row := make(map[string]interface{}, len(table.Columns))
+	for i, col := range columns {
+		var value interface{}
+		if record[i] != s.Null {
+			converted, err := importValue(col, record[i])
+			if err != nil {
+				return nil, err
+			}
+			value = converted
+		}
+		if value == nil && !col.Nullable {
+			return nil, fmt.Errorf("column %s cannot be NULL", col.Name)
+		}
+		row[col.Name] = value
+	}
+
+	for _, col := range table.Columns {
+		if _, ok := row[col.Name]; ok {
+			continue
+		}
+		switch {
+		case col.Default != nil:
+		case col.Nullable:
+			row[col.Name] = nil
+		default:
+			return nil, fmt.Errorf("column %s cannot be NULL", col.Name)
+		}
+	}
+	return row, nil
+}
+
+// importValue converts a CSV field to the canonical type of its column, so
+// that a field of the wrong type fails its own line rather than the batch
+// it would be inserted in. BOOLEANs are read as strconv.ParseBool does.
+func importValue(col types.ColumnDefinition, field string) (interface{}, error) {
+	if types.IsTimeType(col.Type) {
+		value, err := types.CanonicalValue(col.Type, field)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		return value, nil
+	}
+	return types.ConvertColumnValue(col.Name, col.Type, field)
+}
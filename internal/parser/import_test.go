@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParseImport(t *testing.T) {
+	stmt, err := Parse("IMPORT CSV 'users.csv' INTO users;")
+	assert.NoError(t, err)
+	assert.Equal(t, "IMPORT", stmt.Type)
+	assert.Equal(t, &ImportStatement{Path: "users.csv", Table: "users", Header: true}, stmt.ImportStatement)
+
+	stmt, err = Parse("IMPORT CSV 'users.csv' INTO users HEADER OFF NULL 'NA' ON ERROR ABORT")
+	assert.NoError(t, err)
+	assert.Equal(t, &ImportStatement{Path: "users.csv", Table: "users", Null: "NA", Abort: true}, stmt.ImportStatement)
+
+	for sql, want := range map[string]string{
+		"IMPORT JSON 'users.json' INTO users;":          "expected CSV, got JSON",
+		"IMPORT CSV users INTO users;":                  "expected CSV file path, got users",
+		"IMPORT CSV 'users.csv' users;":                 "expected INTO, got users",
+		"IMPORT CSV 'users.csv' INTO users HEADER YES;": "expected ON or OFF after HEADER, got YES",
+		"IMPORT CSV 'users.csv' INTO users NULL NA;":    "expected a string after NULL, got NA",
+		"IMPORT CSV 'users.csv' INTO users BATCH 10;":   "unexpected BATCH after IMPORT CSV",
+	} {
+		_, err := Parse(sql)
+		assert.EqualError(t, err, want, sql)
+	}
+}
+
+func writeCSV(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "import.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+	return path
+}
+
+func TestImportCSV(t *testing.T) {
+	btree, err := storage.NewBTreeStorage(filepath.Join(t.TempDir(), "import.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	session := NewSession()
+	_, err = execSQL(t, session, btree, "CREATE TABLE users (id INT PRIMARY KEY, name STRING NOT NULL, city STRING)")
+	assert.NoError(t, err)
+
+	// The header may order the columns differently from the table
+	lines := []string{"name,id,city"}
+	for i := 1; i <= 1000; i++ {
+		lines = append(lines, fmt.Sprintf("user%d,%d,city%d", i, i, i%7))
+	}
+	result, err := execSQL(t, session, btree, fmt.Sprintf("IMPORT CSV '%s' INTO users;", writeCSV(t, lines...)))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"rows_imported": 1000, "rows_failed": 0, "failed_lines": "", "first_error": ""}}, result)
+
+	result, err = execSQL(t, session, btree, "SELECT COUNT(*) FROM users")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"COUNT(*)": 1000}}, result)
+	result, err = execSQL(t, session, btree, "SELECT name, city FROM users WHERE id = 500")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "user500", "city": "city3"}}, result)
+}
+
+func TestImportCSVFailedLines(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE users (id INT, name STRING NOT NULL, city STRING)")
+	assert.NoError(t, err)
+
+	// Without a header the fields are the table columns in order, and NA
+	// is NULL; lines 2, 3 and 5 do not fit the schema
+	path := writeCSV(t,
+		"1,Ann,NA",
+		"two,Bob,Oslo",
+		"3,NA,Rome",
+		"4,Cy,",
+		"5,Di",
+	)
+	result, err := execSQL(t, session, store, fmt.Sprintf("IMPORT CSV '%s' INTO users HEADER OFF NULL 'NA';", path))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{
+		"rows_imported": 2,
+		"rows_failed":   3,
+		"failed_lines":  "2, 3, 5",
+		"first_error":   `line 2: column id: value "two" cannot be converted to INT`,
+	}}, result)
+
+	rows, err := store.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "name": "Ann", "city": nil},
+		{"id": int64(4), "name": "Cy", "city": ""},
+	}, rows)
+
+	_, err = execSQL(t, session, store, fmt.Sprintf("IMPORT CSV '%s' INTO users;", writeCSV(t, "id,email")))
+	assert.EqualError(t, err, "CSV column email does not exist in table users")
+}
+
+func TestImportCSVTypedColumns(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE events (id INT PRIMARY KEY, ok BOOLEAN, score FLOAT, day DATE, at TIMESTAMP)")
+	assert.NoError(t, err)
+
+	// Each field is converted on its own line, so bad fields and rows the
+	// storage rejects skip only their lines
+	path := writeCSV(t,
+		"id,ok,score,day,at",
+		"1,true,1.5,2024-05-01,2024-05-01 10:00:00",
+		"2,false,x,2024-05-02,2024-05-02 10:00:00",
+		"3,maybe,2,2024-05-03,2024-05-03 10:00:00",
+		"4,f,3,2024-13-01,2024-05-04 10:00:00",
+		"5,1,4,2024-05-05,2024-05-05T10:00:00Z",
+		"1,true,5,2024-05-06,2024-05-06 10:00:00",
+	)
+	result, err := execSQL(t, session, store, fmt.Sprintf("IMPORT CSV '%s' INTO events;", path))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.([]types.Row)[0]["rows_imported"])
+	assert.Equal(t, "3, 4, 5, 7", result.([]types.Row)[0]["failed_lines"])
+
+	rows, err := store.Select("events", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "ok": true, "score": 1.5, "day": "2024-05-01", "at": "2024-05-01T10:00:00Z"},
+		{"id": int64(5), "ok": true, "score": float64(4), "day": "2024-05-05", "at": "2024-05-05T10:00:00Z"},
+	}, rows)
+}
+
+func TestImportCSVFunc(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	assert.NoError(t, store.CreateTable(&types.Table{Name: "employees", Columns: []types.ColumnDefinition{
+		{Name: "id", Type: "INT"},
+		{Name: "name", Type: "STRING", Nullable: true},
+		{Name: "salary", Type: "INT", Nullable: true},
+	}}))
+
+	// Values are coerced to the column types, and empty fields are NULL
+	assert.NoError(t, ImportCSV(store, "employees", writeCSV(t,
+		"id,name,salary",
+		"1,Ann,72000",
+		`2,"Bob, Jr.",`,
+	)))
+	rows, err := store.Select("employees", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "name": "Ann", "salary": int64(72000)},
+		{"id": int64(2), "name": "Bob, Jr.", "salary": nil},
+	}, rows)
+
+	// A line with the wrong number of fields stops ImportCSV
+	path := writeCSV(t,
+		"id,name,salary",
+		"3,Cy,50000",
+		"4,Di",
+		"5,Ed,51000",
+	)
+	err = ImportCSV(store, "employees", path)
+	assert.EqualError(t, err, "line 3: expected 3 fields, got 2 (0 rows imported)")
+
+	// and is skipped by IMPORT CSV unless it says ON ERROR ABORT
+	result, err := execSQL(t, NewSession(), store, fmt.Sprintf("IMPORT CSV '%s' INTO employees ON ERROR SKIP;", path))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.([]types.Row)[0]["rows_imported"])
+	assert.Equal(t, "3", result.([]types.Row)[0]["failed_lines"])
+
+	assert.EqualError(t, ImportCSV(store, "missing", path), "table missing does not exist")
+}
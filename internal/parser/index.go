@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// CreateIndexStatement adds a secondary index on a column (CREATE INDEX
+// idx_dept ON employees (department))
+type CreateIndexStatement struct {
+	Name   string
+	Table  string
+	Column string
+}
+
+// DropIndexStatement removes a secondary index (DROP INDEX idx_dept)
+type DropIndexStatement struct {
+	Name string
+}
+
+// parseCreateIndex parses the rest of a CREATE INDEX statement; the parser
+// is on CREATE
+func (p *Parser) parseCreateIndex() (*CreateIndexStatement, error) {
+	stmt := &CreateIndexStatement{}
+
+	p.nextToken()
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected index name, got %s", p.currentToken.Literal)
+	}
+	stmt.Name = p.currentToken.Literal
+
+	p.nextToken()
+	if !p.isWord("ON") {
+		return nil, fmt.Errorf("expected ON, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.LPAREN {
+		return nil, fmt.Errorf("expected (, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
+	}
+	stmt.Column = p.currentToken.Literal
+	p.nextToken()
+	if p.currentToken.Type == lexer.COMMA {
+		return nil, fmt.Errorf("indexes on more than one column are not supported")
+	}
+	if p.currentToken.Type != lexer.RPAREN {
+		return nil, fmt.Errorf("expected ), got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after column list", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// parseDropIndex parses the rest of a DROP INDEX statement; the parser is
+// on DROP
+func (p *Parser) parseDropIndex() (*DropIndexStatement, error) {
+	stmt := &DropIndexStatement{}
+
+	p.nextToken()
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected index name, got %s", p.currentToken.Literal)
+	}
+	stmt.Name = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after index name", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// Execute creates the index
+func (s *CreateIndexStatement) Execute(storage types.Storage) (interface{}, error) {
+	manager, ok := storage.(types.IndexManager)
+	if !ok {
+		return nil, types.Unsupported("CREATE INDEX")
+	}
+	if err := manager.CreateIndex(s.Table, types.IndexDefinition{Name: s.Name, Column: s.Column}); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Index %s created on %s (%s)", s.Name, s.Table, s.Column), nil
+}
+
+// Execute drops the index
+func (s *DropIndexStatement) Execute(storage types.Storage) (interface{}, error) {
+	manager, ok := storage.(types.IndexManager)
+	if !ok {
+		return nil, types.Unsupported("DROP INDEX")
+	}
+	if err := manager.DropIndex(s.Name); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("Index %s dropped", s.Name), nil
+}
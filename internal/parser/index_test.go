@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParseIndex(t *testing.T) {
+	stmt, err := Parse("CREATE INDEX idx_dept ON employees (department);")
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE INDEX", stmt.Type)
+	assert.Equal(t, &CreateIndexStatement{Name: "idx_dept", Table: "employees", Column: "department"}, stmt.CreateIndexStatement)
+
+	stmt, err = Parse("DROP INDEX idx_dept")
+	assert.NoError(t, err)
+	assert.Equal(t, "DROP INDEX", stmt.Type)
+	assert.Equal(t, &DropIndexStatement{Name: "idx_dept"}, stmt.DropIndexStatement)
+
+	for sql, want := range map[string]string{
+		"CREATE INDEX (department);":                        "expected index name, got (",
+		"CREATE INDEX idx employees (department);":          "expected ON, got employees",
+		"CREATE INDEX idx ON employees department;":         "expected (, got department",
+		"CREATE INDEX idx ON employees (department, name);": "indexes on more than one column are not supported",
+		"CREATE INDEX idx ON employees (department) x;":     "unexpected x after column list",
+		"DROP INDEX;":          "expected index name, got ;",
+		"DROP INDEX idx_a, b;": "unexpected , after index name",
+	} {
+		_, err := Parse(sql)
+		assert.EqualError(t, err, want, sql)
+	}
+}
+
+func TestIndexSQL(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	session := NewSession()
+	run := func(sql string) (interface{}, error) {
+		stmt, err := Parse(sql)
+		assert.NoError(t, err, sql)
+		return session.Execute(stmt, s)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE employees (id INT, name STRING, department STRING);",
+		"INSERT INTO employees VALUES (1, 'Ann', 'eng'), (2, 'Bob', 'ops'), (3, 'Cy', 'eng');",
+	} {
+		_, err := run(sql)
+		assert.NoError(t, err, sql)
+	}
+
+	result, err := run("CREATE INDEX idx_dept ON employees (department);")
+	assert.NoError(t, err)
+	assert.Equal(t, "Index idx_dept created on employees (department)", result)
+	_, err = run("CREATE INDEX idx_dept ON employees (name);")
+	assert.EqualError(t, err, "index idx_dept already exists")
+
+	_, err = run("UPDATE employees SET department = 'eng' WHERE id = 2;")
+	assert.NoError(t, err)
+	result, err = run("SELECT name FROM employees WHERE department = 'eng' ORDER BY name;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Ann"}, {"name": "Bob"}, {"name": "Cy"}}, result)
+
+	result, err = run("DROP INDEX idx_dept;")
+	assert.NoError(t, err)
+	assert.Equal(t, "Index idx_dept dropped", result)
+	_, err = run("DROP INDEX idx_dept;")
+	assert.EqualError(t, err, "index idx_dept does not exist")
+
+	stmt, err := Parse("CREATE INDEX idx_name ON employees (name);")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, stmt.CheckSupported(types.Capabilities{}), types.ErrNotSupported)
+	assert.ErrorIs(t, stmt.CheckSupported(types.Capabilities{SupportsIndexes: true, ReadOnly: true}), types.ErrNotSupported)
+}
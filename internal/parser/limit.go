@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// isLimit reports whether the parser is at LIMIT or OFFSET
+func (p *Parser) isLimit() bool {
+	return p.isWord("LIMIT") || p.isWord("OFFSET")
+}
+
+// parseLimit parses LIMIT n [OFFSET m] or OFFSET m alone and leaves the
+// parser on the token after it. n and m may be @variables or ?
+// placeholders, which are returned in params for binding to resolve.
+func (p *Parser) parseLimit() (*types.LimitSpec, *LimitParams, error) {
+	limit := &types.LimitSpec{Count: types.NoLimit}
+	params := &LimitParams{}
+	if p.isWord("LIMIT") {
+		count, param, err := p.parseLimitValue("LIMIT")
+		if err != nil {
+			return nil, nil, err
+		}
+		limit.Count, params.Count = count, param
+	}
+	if p.isWord("OFFSET") {
+		offset, param, err := p.parseLimitValue("OFFSET")
+		if err != nil {
+			return nil, nil, err
+		}
+		limit.Offset, params.Offset = offset, param
+	}
+	if params.Count == nil && params.Offset == nil {
+		params = nil
+	}
+	return limit, params, nil
+}
+
+// parseLimitValue parses the row count after LIMIT or OFFSET: a number, or
+// a Variable or Placeholder returned as param
+func (p *Parser) parseLimitValue(clause string) (n int, param interface{}, err error) {
+	p.nextToken()
+	switch p.currentToken.Type {
+	case lexer.VARIABLE:
+		param = Variable{Name: p.currentToken.Literal}
+	case lexer.PLACEHOLDER:
+		param = p.placeholder()
+	default:
+		n, err = strconv.Atoi(p.currentToken.Literal)
+		if p.currentToken.Type != lexer.NUMBER || err != nil || n < 0 {
+			return 0, nil, fmt.Errorf("%s must be a non-negative integer, got %s", clause, p.currentToken.Literal)
+		}
+	}
+	p.nextToken()
+	return n, param, nil
+}
+
+// LimitParams holds the @variables and ? placeholders given for LIMIT and
+// OFFSET; nil fields were given as numbers. Binding the statement resolves
+// them into its Limit.
+type LimitParams struct {
+	Count  interface{}
+	Offset interface{}
+}
+
+// bindLimit sets sel's Limit to a copy holding the values r resolves its
+// LimitParams to, which must be non-negative integers. Params r leaves
+// unresolved are kept, and the statement cannot run until they are bound.
+func (r resolver) bindLimit(sel *SelectStatement) error {
+	if sel.LimitParams == nil {
+		return nil
+	}
+	limit := *sel.Limit
+	params := &LimitParams{}
+	var err error
+	if limit.Count, params.Count, err = r.limitValue("LIMIT", sel.LimitParams.Count, limit.Count); err != nil {
+		return err
+	}
+	if limit.Offset, params.Offset, err = r.limitValue("OFFSET", sel.LimitParams.Offset, limit.Offset); err != nil {
+		return err
+	}
+	if params.Count == nil && params.Offset == nil {
+		params = nil
+	}
+	sel.Limit, sel.LimitParams = &limit, params
+	return nil
+}
+
+// limitValue resolves the param of a LIMIT or OFFSET clause, returning n,
+// the parsed value, if there is none, and the param itself if r leaves it
+// unresolved
+func (r resolver) limitValue(clause string, param interface{}, n int) (int, interface{}, error) {
+	if param == nil {
+		return n, nil, nil
+	}
+	val, err := r(param)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch v := val.(type) {
+	case Variable, Placeholder:
+		return n, v, nil
+	case int64:
+		if v >= 0 {
+			return int(v), nil, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%s must be a non-negative integer, got %v", clause, val)
+}
+
+// checkLimitBound rejects a SELECT whose LIMIT or OFFSET is an unbound
+// @variable or ? placeholder
+func (s *SelectStatement) checkLimitBound() error {
+	if s.LimitParams == nil {
+		return nil
+	}
+	if s.LimitParams.Count != nil {
+		return fmt.Errorf("LIMIT %s is not bound", limitParam(s.LimitParams.Count))
+	}
+	return fmt.Errorf("OFFSET %s is not bound", limitParam(s.LimitParams.Offset))
+}
+
+func limitParam(param interface{}) string {
+	if v, ok := param.(Variable); ok {
+		return "@" + v.Name
+	}
+	return "?"
+}
+
+// pushLimit reports whether the storage can apply LIMIT while it reads
+// rows, which it can unless rows are sorted, aggregated, grouped or
+// deduplicated after they are read
+func (s *SelectStatement) pushLimit() bool {
+	return s.Limit != nil && s.Sample == nil && len(s.Aggregates) == 0 && len(s.GroupBy) == 0 && len(s.OrderBy) == 0 && !s.Distinct
+}
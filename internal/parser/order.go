@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// OrderByClause is one sort key of ORDER BY: a stored column or the name
+// of a computed column, ascending unless Desc is set
+type OrderByClause struct {
+	Column string
+	Desc   bool
+}
+
+func (c OrderByClause) String() string {
+	if c.Desc {
+		return c.Column + " DESC"
+	}
+	return c.Column
+}
+
+// isOrderBy reports whether the parser is at ORDER BY
+func (p *Parser) isOrderBy() bool {
+	return strings.EqualFold(p.currentToken.Literal, "ORDER") && strings.EqualFold(p.peekToken.Literal, "BY")
+}
+
+// parseOrderBy parses ORDER BY col [ASC | DESC] [, ...] and leaves the
+// parser on the token after it
+func (p *Parser) parseOrderBy() ([]OrderByClause, error) {
+	p.nextToken() // move past ORDER
+	var clauses []OrderByClause
+	for {
+		p.nextToken()
+		if p.currentToken.Type != lexer.IDENTIFIER {
+			return nil, fmt.Errorf("expected column in ORDER BY, got %s", p.currentToken.Literal)
+		}
+		clause := OrderByClause{Column: p.currentToken.Literal}
+
+		p.nextToken()
+		switch strings.ToUpper(p.currentToken.Literal) {
+		case "DESC":
+			clause.Desc = true
+			p.nextToken()
+		case "ASC":
+			p.nextToken()
+		}
+		clauses = append(clauses, clause)
+
+		if p.currentToken.Type != lexer.COMMA {
+			return clauses, nil
+		}
+	}
+}
+
+// checkOrderBy rejects ORDER BY columns that are neither columns of table
+// nor computed columns of the SELECT. With GROUP BY, rows can only be
+// sorted on GROUP BY columns and aggregates.
+func (s *SelectStatement) checkOrderBy(table *types.Table) error {
+	for _, clause := range s.OrderBy {
+		if _, ok := s.Aggregates[clause.Column]; len(s.GroupBy) > 0 && !ok && !s.isGroupColumn(clause.Column) {
+			return fmt.Errorf("ORDER BY column %s must appear in GROUP BY or be used in an aggregate function", clause.Column)
+		}
+	}
+	if table == nil {
+		return nil // let the storage report the missing table
+	}
+	for _, clause := range s.OrderBy {
+		if _, ok := s.Exprs[clause.Column]; ok {
+			continue
+		}
+		if _, ok := s.Aggregates[clause.Column]; ok {
+			continue
+		}
+		found := false
+		for _, col := range table.Columns {
+			if col.Name == clause.Column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("ORDER BY column %s does not exist in table %s", clause.Column, s.Table)
+		}
+	}
+	return nil
+}
+
+// sort orders rows by the ORDER BY clauses. Computed columns are evaluated
+// for each row, since rows are sorted before they are projected. Grouped
+// rows are sorted by group once they are aggregated.
+func (s *SelectStatement) sort(rows []types.Row) {
+	if len(s.Aggregates) > 0 || len(s.GroupBy) > 0 {
+		return
+	}
+	s.sortRows(rows)
+}
+
+// sortRows orders rows by the ORDER BY clauses
+func (s *SelectStatement) sortRows(rows []types.Row) {
+	if len(s.OrderBy) == 0 {
+		return
+	}
+	value := func(row types.Row, col string) interface{} {
+		if expr, ok := s.Exprs[col]; ok {
+			return expr.Eval(row)
+		}
+		return row[col]
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, clause := range s.OrderBy {
+			cmp := compareForSort(value(rows[i], clause.Column), value(rows[j], clause.Column))
+			if cmp == 0 {
+				continue
+			}
+			if clause.Desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// compareForSort orders two values numerically if both are numbers and by
+// their string form otherwise. NULL sorts after every other value, so it
+// comes last in ascending order and first in descending order.
+func compareForSort(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if cmp, ok := types.CompareValues(a, b); ok {
+		return cmp
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
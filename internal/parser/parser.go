@@ -1,23 +1,46 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/zakazai/ulin-db/internal/fixture"
 	"github.com/zakazai/ulin-db/internal/lexer"
 	"github.com/zakazai/ulin-db/internal/types"
 )
 
 // Statement types
 type Statement struct {
-	Type            string
-	SelectStatement *SelectStatement
-	InsertStatement *InsertStatement
-	UpdateStatement *UpdateStatement
-	DeleteStatement *DeleteStatement
-	CreateStatement *CreateStatement
-	Error           error
+	Type                 string
+	SelectStatement      *SelectStatement
+	InsertStatement      *InsertStatement
+	UpdateStatement      *UpdateStatement
+	DeleteStatement      *DeleteStatement
+	CreateStatement      *CreateStatement
+	SetStatement         *SetStatement
+	AlterStatement       *AlterStatement
+	AuditStatement       *AuditStatement
+	CheckStatement       *CheckStatement
+	LoadStatement        *LoadStatement
+	ImportStatement      *ImportStatement
+	ExportStatement      *ExportStatement
+	DropStatement        *DropStatement
+	AttachStatement      *AttachStatement
+	DetachStatement      *DetachStatement
+	CreateIndexStatement *CreateIndexStatement
+	DropIndexStatement   *DropIndexStatement
+	ExplainStatement     *ExplainStatement
+	Error                error
+}
+
+// ExecResult is what executing an INSERT, UPDATE or DELETE returns: the
+// number of rows it wrote. Matching no row is not an error, the count is
+// then zero.
+type ExecResult struct {
+	RowsAffected int
 }
 
 func (stmt *Statement) Execute(s types.Storage) (interface{}, error) {
@@ -32,42 +55,285 @@ func (stmt *Statement) Execute(s types.Storage) (interface{}, error) {
 		return stmt.DeleteStatement.Execute(s)
 	case "CREATE":
 		return stmt.CreateStatement.Execute(s)
+	case "SET":
+		return nil, fmt.Errorf("SET %s requires a session", stmt.SetStatement.Name)
+	case "ALTER":
+		return stmt.AlterStatement.Execute(s)
+	case "AUDIT":
+		return nil, fmt.Errorf("%s requires an audit log", stmt.Type)
+	case "EXPLAIN":
+		return nil, fmt.Errorf("EXPLAIN requires a planner")
+	case "CHECK":
+		return stmt.CheckStatement.Execute(s)
+	case "LOAD":
+		return stmt.LoadStatement.Execute(s)
+	case "IMPORT":
+		return stmt.ImportStatement.Execute(s)
+	case "EXPORT":
+		return stmt.ExportStatement.Execute(s)
+	case "DROP":
+		return stmt.DropStatement.Execute(s)
+	case "ATTACH":
+		return stmt.AttachStatement.Execute(s)
+	case "DETACH":
+		return stmt.DetachStatement.Execute(s)
+	case "CREATE INDEX":
+		return stmt.CreateIndexStatement.Execute(s)
+	case "DROP INDEX":
+		return stmt.DropIndexStatement.Execute(s)
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		return nil, fmt.Errorf("%s requires a session", stmt.Type)
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %s", stmt.Type)
 	}
 }
 
+// CheckSupported returns an ErrNotSupported error, before anything runs,
+// if the statement needs a feature that caps does not include
+func (stmt *Statement) CheckSupported(caps types.Capabilities) error {
+	switch stmt.Type {
+	case "INSERT", "UPDATE", "DELETE", "LOAD", "IMPORT", "CREATE", "ALTER", "DROP", "CREATE INDEX", "DROP INDEX":
+		if caps.ReadOnly {
+			return fmt.Errorf("%s is %w (read-only)", stmt.Type, types.ErrNotSupported)
+		}
+	}
+
+	switch stmt.Type {
+	case "EXPLAIN":
+		// EXPLAIN ANALYZE runs the statement
+		if stmt.ExplainStatement.Analyze {
+			return stmt.ExplainStatement.Statement.CheckSupported(caps)
+		}
+	case "BEGIN":
+		if !caps.SupportsTransactions {
+			return types.Unsupported("transactions")
+		}
+	case "CHECK":
+		if !caps.SupportsTableCheck {
+			return types.Unsupported("CHECK TABLE")
+		}
+	case "ATTACH", "DETACH":
+		if !caps.SupportsAttachParquet {
+			return types.Unsupported(stmt.Type + " PARQUET")
+		}
+	case "CREATE INDEX", "DROP INDEX":
+		if !caps.SupportsIndexes {
+			return types.Unsupported(stmt.Type)
+		}
+	case "ALTER":
+		switch stmt.AlterStatement.Option {
+		case "TYPE":
+			if !caps.SupportsAlterColumnType {
+				return types.Unsupported("ALTER COLUMN ... TYPE")
+			}
+		case "MASK":
+			if !caps.SupportsColumnMasks {
+				return types.Unsupported("column masking")
+			}
+		case "ADD":
+			if !caps.SupportsAddColumn {
+				return types.Unsupported("ADD COLUMN")
+			}
+		case "MAX_ROWS", "MAX_BYTES":
+			if !caps.SupportsQuotas {
+				return types.Unsupported(stmt.AlterStatement.Option)
+			}
+		}
+	}
+	return nil
+}
+
+// SelectStatement reads rows of Table. With Sample set (SELECT * FROM
+// events TABLESAMPLE (1 PERCENT)), Where filters the sampled rows.
 type SelectStatement struct {
 	Table   string
 	Columns []string
-	Where   map[string]interface{}
+	Where   *types.WhereExpr
+	With    []CTE
+	Sample  *types.SampleSpec
+
+	// Exprs maps the names of computed columns in Columns to their
+	// expressions, e.g. full_name for first_name || ' ' || last_name AS
+	// full_name
+	Exprs map[string]ConcatExpr
+
+	// Aggregates maps the names of aggregate columns to their calls
+	Aggregates map[string]types.AggregateCall
+
+	// GroupBy lists the columns whose values split the rows into groups,
+	// each giving one row of the aggregates
+	GroupBy []string
+
+	// OrderBy sorts the result, on stored or computed columns
+	OrderBy []OrderByClause
+
+	// Distinct drops result rows equal to an earlier one (SELECT DISTINCT)
+	Distinct bool
+
+	// Limit keeps a window of the result, after it is sorted and
+	// deduplicated
+	Limit *types.LimitSpec
+
+	// LimitParams holds an @variable or ? placeholder given for LIMIT or
+	// OFFSET until binding resolves it into Limit
+	LimitParams *LimitParams
+
+	// trace, if not nil, is called after each step of the execution (see
+	// ExecuteTraced)
+	trace func(Stage)
 }
 
+// InsertStatement inserts Rows into Table, one for each tuple of VALUES.
+// With a column list (INSERT INTO employees (name, salary) VALUES ...) the
+// values of a row are keyed by the listed columns; without one they are
+// keyed by position: column1, column2, ...
 type InsertStatement struct {
-	Table  string
-	Values map[string]interface{}
+	Table   string
+	Columns []string
+	Rows    []map[string]interface{}
+}
+
+// TableRows returns the rows keyed by the columns of table, matching
+// positional values to the columns in order. Columns not given are left out
+// if they have a DEFAULT, for the storage to fill in, NULL if nullable, and
+// left out otherwise, for the storage to report as missing.
+// If table is nil the rows are returned as they are.
+func (s *InsertStatement) TableRows(table *types.Table) ([]map[string]interface{}, error) {
+	if table == nil {
+		return s.Rows, nil
+	}
+
+	if s.Columns == nil {
+		// Every tuple has the same number of values
+		if n := len(s.Rows[0]); n > len(table.Columns) {
+			return nil, fmt.Errorf("INSERT has %d values but table %s has %d columns", n, table.Name, len(table.Columns))
+		}
+	} else {
+		known := make(map[string]bool, len(table.Columns))
+		for _, col := range table.Columns {
+			known[col.Name] = true
+		}
+		for _, name := range s.Columns {
+			if !known[name] {
+				return nil, fmt.Errorf("column %s does not exist in table %s", name, table.Name)
+			}
+		}
+	}
+
+	rows := make([]map[string]interface{}, len(s.Rows))
+	for i, values := range s.Rows {
+		row := make(map[string]interface{}, len(table.Columns))
+		for j, col := range table.Columns {
+			key := col.Name
+			if s.Columns == nil {
+				key = fmt.Sprintf("column%d", j+1)
+			}
+			if val, ok := values[key]; ok {
+				row[col.Name] = val
+			} else if col.Nullable && col.Default == nil {
+				row[col.Name] = nil
+			}
+		}
+		rows[i] = row
+	}
+	return rows, nil
 }
 
+// UpdateStatement changes the rows of Table matching Where. With From set
+// (UPDATE employees SET salary = r.new_salary FROM raises r WHERE
+// employees.id = r.employee_id), Set values may be ColumnRefs to the source
+// table, and Where holds only the literal conditions on Table.
 type UpdateStatement struct {
 	Table string
 	Set   map[string]interface{}
-	Where map[string]interface{}
+	Where *types.WhereExpr
+	From  *UpdateSource
 }
 
 type DeleteStatement struct {
 	Table string
-	Where map[string]interface{}
+	Where *types.WhereExpr
 }
 
 type CreateStatement struct {
-	Table   string
-	Columns []struct {
-		Name     string
-		Type     string
-		Nullable bool
+	Table       string
+	IfNotExists bool
+	Columns     []struct {
+		Name       string
+		Type       string
+		Nullable   bool
+		PrimaryKey bool
+		Default    interface{}
 	}
 }
 
+// SetStatement assigns a value to a session variable (SET @name = value)
+// or changes a session setting (SET sql_strict = true)
+type SetStatement struct {
+	Name    string
+	Value   interface{}
+	Setting bool
+}
+
+// Variable is a reference to a session variable (@name) used in place of a
+// literal value. It is resolved against a Session before execution.
+type Variable struct {
+	Name string
+}
+
+// Placeholder is a ? used in place of a literal value in a prepared
+// statement. Index numbers placeholders from 1 in the order they appear;
+// Prepared.ExecuteWith binds each to the argument at that position.
+type Placeholder struct {
+	Index int
+}
+
+// AlterStatement changes a table option: ALTER TABLE accounts SET AUDIT =
+// true, or a quota with ALTER TABLE logs SET MAX_ROWS = 1000 [ON FULL
+// DELETE OLDEST | ON FULL ERROR]. A quota of zero removes the limit.
+// ALTER TABLE employees ALTER COLUMN id TYPE STRING changes a column type,
+// with Option "TYPE" and the new type in Value, and ALTER COLUMN email SET
+// MASKED USING 'partial(3)' sets a masking policy, with Option "MASK" and
+// the policy in Value ("" for DROP MASKED). ALTER TABLE users ADD COLUMN
+// phone STRING adds a column, with Option "ADD" and its
+// types.ColumnDefinition in Value.
+type AlterStatement struct {
+	Table  string
+	Option string
+	Value  interface{}
+	OnFull string // "", "ERROR" or "DELETE OLDEST"; "" keeps the current mode
+	Column string // the column of ALTER COLUMN
+	Using  bool   // USING <column> allows a narrowing type change
+}
+
+// AuditStatement reads a table's audit log (AUDIT LOG FOR accounts LIMIT
+// 100). A Limit of zero returns every entry.
+type AuditStatement struct {
+	Table string
+	Limit int
+}
+
+// CheckStatement validates stored rows against the table schema (CHECK
+// TABLE employees [REPAIR])
+type CheckStatement struct {
+	Table  string
+	Repair bool
+}
+
+// LoadStatement loads a table fixture file (LOAD FIXTURE 'company.yaml'
+// [MERGE]). With Merge set, tables that already exist are skipped.
+type LoadStatement struct {
+	Path  string
+	Merge bool
+}
+
+// DropStatement removes a table and its rows (DROP TABLE [IF EXISTS]
+// logs). With IfExists set, dropping a missing table does nothing.
+type DropStatement struct {
+	Table    string
+	IfExists bool
+}
+
 type ColumnDefinition struct {
 	Name     string
 	Type     string
@@ -87,36 +353,241 @@ func (s *ShowTablesStatement) Execute(storage types.Storage) (interface{}, error
 }
 
 func (s *SelectStatement) Execute(storage types.Storage) (interface{}, error) {
-	return storage.Select(s.Table, s.Columns, s.Where)
+	return s.execute(storage, nil)
+}
+
+// execute runs the SELECT. mask, if not nil, is applied to rows read from
+// stored tables before computed columns are evaluated, so an expression
+// cannot reveal a masked value.
+func (s *SelectStatement) execute(storage types.Storage, mask rowMask) ([]types.Row, error) {
+	storage, err := withCTEs(storage, s.With, mask)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.rows(storage, mask)
+	if err != nil {
+		return nil, err
+	}
+	return s.project(rows, storedMask(storage, s.Table, mask))
+}
+
+// rows reads the rows the SELECT matches in ORDER BY order, before
+// computed columns are evaluated. The LIMIT is passed to the storage when
+// nothing done after reading changes which rows it keeps.
+func (s *SelectStatement) rows(storage types.Storage, mask rowMask) ([]types.Row, error) {
+	if err := s.checkLimitBound(); err != nil {
+		return nil, err
+	}
+	table := storage.GetTable(s.Table)
+	if err := s.checkOrderBy(table); err != nil {
+		return nil, err
+	}
+	if err := s.checkGroupBy(table); err != nil {
+		return nil, err
+	}
+	if err := s.checkAggregateTypes(table); err != nil {
+		return nil, err
+	}
+
+	var rows []types.Row
+	var err error
+	start := time.Now()
+	switch {
+	case s.Sample != nil:
+		rows, err = types.SampleSelect(storage, s.Table, s.sourceColumns(), s.Where, *s.Sample)
+	case s.pushLimit():
+		rows, err = types.SelectLimit(storage, s.Table, s.sourceColumns(), s.Where, *s.Limit)
+	default:
+		rows, err = storage.Select(s.Table, s.sourceColumns(), s.Where)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.traceStage("Scan", start, len(rows))
+	// Aggregates count stored values, as WHERE compares them
+	if mask = storedMask(storage, s.Table, mask); mask != nil {
+		if len(s.Aggregates) == 0 {
+			rows = mask(s.Table, rows)
+		} else if len(s.GroupBy) > 0 {
+			rows = s.maskGroupColumns(rows, mask)
+		}
+	}
+	// Sorting masked rows keeps the order from revealing hidden values
+	start = time.Now()
+	s.sort(rows)
+	if len(s.Aggregates) == 0 && len(s.GroupBy) == 0 {
+		s.traceStage("Sort", start, len(rows))
+	}
+	return rows, nil
 }
 
+// Execute inserts the rows and reports how many there were
 func (s *InsertStatement) Execute(storage types.Storage) (interface{}, error) {
-	return nil, storage.Insert(s.Table, s.Values)
+	rows, err := s.TableRows(storage.GetTable(s.Table))
+	if err != nil {
+		return nil, err
+	}
+	if err := types.InsertRows(storage, s.Table, rows); err != nil {
+		return nil, err
+	}
+	return ExecResult{RowsAffected: len(rows)}, nil
 }
 
+// Execute updates the matching rows and reports how many there were
 func (s *UpdateStatement) Execute(storage types.Storage) (interface{}, error) {
-	return nil, storage.Update(s.Table, s.Set, s.Where)
+	if s.From != nil {
+		return s.executeFrom(storage, nil)
+	}
+	updated, err := storage.Update(s.Table, s.Set, s.Where)
+	if err != nil {
+		return nil, err
+	}
+	return ExecResult{RowsAffected: updated}, nil
 }
 
+// Execute deletes the matching rows and reports how many there were
 func (s *DeleteStatement) Execute(storage types.Storage) (interface{}, error) {
-	return nil, storage.Delete(s.Table, s.Where)
+	deleted, err := storage.Delete(s.Table, s.Where)
+	if err != nil {
+		return nil, err
+	}
+	return ExecResult{RowsAffected: deleted}, nil
 }
 
-func (s *CreateStatement) Execute(storage types.Storage) (interface{}, error) {
+func (s *DropStatement) Execute(storage types.Storage) (interface{}, error) {
+	if s.IfExists && storage.GetTable(s.Table) == nil {
+		return nil, nil
+	}
+	return nil, storage.DropTable(s.Table)
+}
+
+func (s *CheckStatement) Execute(storage types.Storage) (interface{}, error) {
+	checker, ok := storage.(types.TableChecker)
+	if !ok {
+		return nil, types.Unsupported("CHECK TABLE")
+	}
+	report, err := checker.CheckTable(s.Table, s.Repair, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []types.Row{report.Row()}, nil
+}
+
+func (s *LoadStatement) Execute(storage types.Storage) (interface{}, error) {
+	result, err := fixture.LoadFile(storage, s.Path, s.Merge)
+	if err != nil {
+		return nil, err
+	}
+	return []types.Row{result.Row()}, nil
+}
+
+// Execute changes a table quota or column, or adds a column. AUDIT is
+// handled by the audit log.
+func (s *AlterStatement) Execute(storage types.Storage) (interface{}, error) {
+	switch s.Option {
+	case "AUDIT":
+		return nil, fmt.Errorf("ALTER TABLE ... SET AUDIT requires an audit log")
+	case "TYPE":
+		return nil, s.ChangeColumnType(storage, nil)
+	case "MASK":
+		masker, ok := storage.(types.ColumnMasker)
+		if !ok {
+			return nil, types.Unsupported("column masking")
+		}
+		return nil, masker.SetColumnMask(s.Table, s.Column, s.Value.(string))
+	case "ADD":
+		adder, ok := storage.(types.ColumnAdder)
+		if !ok {
+			return nil, types.Unsupported("ADD COLUMN")
+		}
+		return nil, adder.AddColumn(s.Table, s.Value.(types.ColumnDefinition))
+	}
+	manager, ok := storage.(types.QuotaManager)
+	if !ok {
+		return nil, types.Unsupported(s.Option)
+	}
+	table := storage.GetTable(s.Table)
+	if table == nil {
+		return nil, fmt.Errorf("table %s does not exist", s.Table)
+	}
+
+	var quota types.TableQuota
+	if table.Quota != nil {
+		quota = *table.Quota
+	}
+	switch s.Option {
+	case "MAX_ROWS":
+		quota.MaxRows = s.Value.(int64)
+	case "MAX_BYTES":
+		quota.MaxBytes = s.Value.(int64)
+	}
+	switch s.OnFull {
+	case "ERROR":
+		quota.EvictOldest = false
+	case "DELETE OLDEST":
+		quota.EvictOldest = true
+	}
+	return nil, manager.SetQuota(s.Table, quota)
+}
+
+// ChangeColumnType validates and applies ALTER COLUMN ... TYPE, converting
+// the stored rows. progress is passed on to the storage.
+func (s *AlterStatement) ChangeColumnType(storage types.Storage, progress func(converted int)) error {
+	changer, ok := storage.(types.ColumnTypeChanger)
+	if !ok {
+		return types.Unsupported("ALTER COLUMN ... TYPE")
+	}
+	table := storage.GetTable(s.Table)
+	if table == nil {
+		return fmt.Errorf("table %s does not exist", s.Table)
+	}
+
+	newType := s.Value.(string)
+	for _, col := range table.Columns {
+		if col.Name != s.Column {
+			continue
+		}
+		if err := types.CheckColumnTypeChange(s.Column, col.Type, newType, s.Using); err != nil {
+			return err
+		}
+		if col.Type == newType {
+			return nil
+		}
+		return changer.AlterColumnType(s.Table, s.Column, newType, progress)
+	}
+	return fmt.Errorf("column %s does not exist in table %s", s.Column, s.Table)
+}
+
+// Schema returns the table definition the statement creates
+func (s *CreateStatement) Schema() *types.Table {
 	// Convert our column type to types.ColumnDefinition
 	columns := make([]types.ColumnDefinition, len(s.Columns))
 	for i, col := range s.Columns {
 		columns[i] = types.ColumnDefinition{
-			Name:     col.Name,
-			Type:     col.Type,
-			Nullable: col.Nullable,
+			Name:       col.Name,
+			Type:       col.Type,
+			Nullable:   col.Nullable,
+			PrimaryKey: col.PrimaryKey,
+			Default:    col.Default,
 		}
 	}
 
-	return nil, storage.CreateTable(&types.Table{
+	return &types.Table{
 		Name:    s.Table,
 		Columns: columns,
-	})
+	}
+}
+
+func (s *CreateStatement) Execute(storage types.Storage) (interface{}, error) {
+	table := s.Schema()
+
+	if s.IfNotExists {
+		if existing := storage.GetTable(s.Table); existing != nil {
+			return nil, types.CheckSchemaCompatible(existing, table)
+		}
+	}
+
+	return nil, storage.CreateTable(table)
 }
 
 // Parser represents a SQL parser
@@ -124,6 +595,9 @@ type Parser struct {
 	l            *lexer.Lexer
 	currentToken lexer.Token
 	peekToken    lexer.Token
+
+	// placeholders counts the ? placeholders parsed so far
+	placeholders int
 }
 
 // New creates a new parser
@@ -140,10 +614,19 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
+// placeholder numbers the ? at the current token
+func (p *Parser) placeholder() Placeholder {
+	p.placeholders++
+	return Placeholder{Index: p.placeholders}
+}
+
 // Parse parses a SQL statement and returns a Statement
 func Parse(sql string) (*Statement, error) {
-	l := lexer.New(sql)
-	p := New(l)
+	return New(lexer.New(sql)).parseStatement()
+}
+
+// parseStatement parses the statement starting at the current token
+func (p *Parser) parseStatement() (*Statement, error) {
 	stmt := &Statement{}
 
 	switch p.currentToken.Type {
@@ -151,8 +634,18 @@ func Parse(sql string) (*Statement, error) {
 		switch p.currentToken.Literal {
 		case "SELECT":
 			stmt.Type = "SELECT"
-			selectStmt := p.parseSelect()
-			stmt.SelectStatement = &selectStmt
+			selectStmt, err := p.parseSelect()
+			if err != nil {
+				return nil, err
+			}
+			stmt.SelectStatement = selectStmt
+		case "WITH":
+			stmt.Type = "SELECT"
+			selectStmt, err := p.parseWith()
+			if err != nil {
+				return nil, err
+			}
+			stmt.SelectStatement = selectStmt
 		case "INSERT":
 			stmt.Type = "INSERT"
 			insertStmt, err := p.parseInsert()
@@ -175,12 +668,112 @@ func Parse(sql string) (*Statement, error) {
 			}
 			stmt.DeleteStatement = deleteStmt
 		case "CREATE":
+			if p.peekToken.Type == lexer.IDENTIFIER && strings.EqualFold(p.peekToken.Literal, "INDEX") {
+				stmt.Type = "CREATE INDEX"
+				indexStmt, err := p.parseCreateIndex()
+				if err != nil {
+					return nil, err
+				}
+				stmt.CreateIndexStatement = indexStmt
+				break
+			}
 			stmt.Type = "CREATE"
 			createStmt, err := p.parseCreate()
 			if err != nil {
 				return nil, err
 			}
 			stmt.CreateStatement = createStmt
+		case "SET":
+			stmt.Type = "SET"
+			setStmt, err := p.parseSet()
+			if err != nil {
+				return nil, err
+			}
+			stmt.SetStatement = setStmt
+		case "ALTER":
+			stmt.Type = "ALTER"
+			alterStmt, err := p.parseAlter()
+			if err != nil {
+				return nil, err
+			}
+			stmt.AlterStatement = alterStmt
+		case "CHECK":
+			stmt.Type = "CHECK"
+			checkStmt, err := p.parseCheck()
+			if err != nil {
+				return nil, err
+			}
+			stmt.CheckStatement = checkStmt
+		case "AUDIT":
+			stmt.Type = "AUDIT"
+			auditStmt, err := p.parseAudit()
+			if err != nil {
+				return nil, err
+			}
+			stmt.AuditStatement = auditStmt
+		case "LOAD":
+			stmt.Type = "LOAD"
+			loadStmt, err := p.parseLoad()
+			if err != nil {
+				return nil, err
+			}
+			stmt.LoadStatement = loadStmt
+		case "IMPORT":
+			stmt.Type = "IMPORT"
+			importStmt, err := p.parseImport()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ImportStatement = importStmt
+		case "EXPORT":
+			stmt.Type = "EXPORT"
+			exportStmt, err := p.parseExport()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ExportStatement = exportStmt
+		case "DROP":
+			if p.peekToken.Type == lexer.IDENTIFIER && strings.EqualFold(p.peekToken.Literal, "INDEX") {
+				stmt.Type = "DROP INDEX"
+				indexStmt, err := p.parseDropIndex()
+				if err != nil {
+					return nil, err
+				}
+				stmt.DropIndexStatement = indexStmt
+				break
+			}
+			stmt.Type = "DROP"
+			dropStmt, err := p.parseDrop()
+			if err != nil {
+				return nil, err
+			}
+			stmt.DropStatement = dropStmt
+		case "ATTACH":
+			stmt.Type = "ATTACH"
+			attachStmt, err := p.parseAttach()
+			if err != nil {
+				return nil, err
+			}
+			stmt.AttachStatement = attachStmt
+		case "DETACH":
+			stmt.Type = "DETACH"
+			detachStmt, err := p.parseDetach()
+			if err != nil {
+				return nil, err
+			}
+			stmt.DetachStatement = detachStmt
+		case "EXPLAIN":
+			stmt.Type = "EXPLAIN"
+			explainStmt, err := p.parseExplain()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ExplainStatement = explainStmt
+		case "BEGIN", "COMMIT", "ROLLBACK":
+			stmt.Type = p.currentToken.Literal
+			if err := p.parseTransaction(); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, fmt.Errorf("unexpected keyword: %s", p.currentToken.Literal)
 		}
@@ -191,16 +784,44 @@ func Parse(sql string) (*Statement, error) {
 	return stmt, nil
 }
 
-func (p *Parser) parseSelect() SelectStatement {
-	stmt := SelectStatement{}
+func (p *Parser) parseSelect() (*SelectStatement, error) {
+	stmt := &SelectStatement{}
 	p.nextToken() // move past SELECT
+	if p.isWord("DISTINCT") {
+		stmt.Distinct = true
+		p.nextToken()
+	}
 
 	// Parse columns
 	for p.currentToken.Type != lexer.KEYWORD || p.currentToken.Literal != "FROM" {
+		if p.currentToken.Type == lexer.EOF {
+			// SELECT without FROM, e.g. SELECT @dept
+			return stmt, checkAggregateColumns(stmt)
+		}
+		if p.currentToken.Type == lexer.IDENTIFIER && p.peekToken.Type == lexer.LPAREN && types.IsAggregateFunc(p.currentToken.Literal) {
+			if err := p.parseAggregate(stmt); err != nil {
+				return nil, err
+			}
+			if p.currentToken.Type == lexer.COMMA {
+				p.nextToken()
+			}
+			continue
+		}
+		if p.peekToken.Type == lexer.CONCAT {
+			if err := p.parseSelectExpr(stmt); err != nil {
+				return nil, err
+			}
+			if p.currentToken.Type == lexer.COMMA {
+				p.nextToken()
+			}
+			continue
+		}
 		if p.currentToken.Type == lexer.ASTERISK {
 			stmt.Columns = append(stmt.Columns, "*")
 		} else if p.currentToken.Type == lexer.IDENTIFIER {
 			stmt.Columns = append(stmt.Columns, p.currentToken.Literal)
+		} else if p.currentToken.Type == lexer.VARIABLE {
+			stmt.Columns = append(stmt.Columns, "@"+p.currentToken.Literal)
 		}
 		p.nextToken()
 		if p.currentToken.Type == lexer.COMMA {
@@ -217,104 +838,514 @@ func (p *Parser) parseSelect() SelectStatement {
 		p.nextToken()
 	}
 
+	if strings.EqualFold(p.currentToken.Literal, "TABLESAMPLE") {
+		sample, err := p.parseTableSample()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Sample = sample
+	}
+
 	// Parse WHERE clause
 	if p.currentToken.Type == lexer.KEYWORD && p.currentToken.Literal == "WHERE" {
-		p.nextToken()
-		where := make(map[string]interface{})
-		for p.currentToken.Type != lexer.EOF {
-			// Expect column name
+		where, err := p.parseWhere(func() (*types.WhereExpr, error) {
+			// Expect column name, or a concatenation
 			if p.currentToken.Type != lexer.IDENTIFIER {
-				break
+				return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
+			}
+			if p.peekToken.Type == lexer.CONCAT {
+				expr, err := p.parseConcat()
+				if err != nil {
+					return nil, err
+				}
+				if p.currentToken.Type != lexer.EQUALS {
+					return nil, fmt.Errorf("expected = after %s, got %s", expr, p.currentToken.Literal)
+				}
+				p.nextToken()
+				val, err := p.parseWhereValue()
+				if err != nil {
+					return nil, err
+				}
+				p.nextToken()
+				return types.RowWhere(ConcatFilter{Expr: expr, Value: val}), nil
 			}
 			col := p.currentToken.Literal
 			p.nextToken()
-			if p.currentToken.Type != lexer.EQUALS {
-				break
+			op := p.whereOperator()
+			if op == "" {
+				return nil, fmt.Errorf("expected comparison operator after %s, got %s", col, p.currentToken.Literal)
 			}
 			p.nextToken()
-			// Parse value according to token type
-			if p.currentToken.Type == lexer.NUMBER {
-				val, err := strconv.ParseFloat(p.currentToken.Literal, 64)
-				if err != nil {
-					break
-				}
-				where[col] = val
-			} else if p.currentToken.Type == lexer.STRING {
-				where[col] = strings.Trim(p.currentToken.Literal, "'\"")
-			} else {
-				where[col] = p.currentToken.Literal
+			val, err := p.parseConditionValue(op, p.parseWhereValue)
+			if err != nil {
+				return nil, err
 			}
 			p.nextToken()
-			// If next token is AND/OR or SEMICOLON, continue; otherwise loop will handle EOF
+			return types.Condition(col, whereCondition(op, val)), nil
+		})
+		if err != nil {
+			return nil, err
 		}
 		stmt.Where = where
 	}
 
-	return stmt
-}
+	if p.isGroupBy() {
+		groupBy, err := p.parseGroupBy()
+		if err != nil {
+			return nil, err
+		}
+		stmt.GroupBy = groupBy
+	}
+	if err := checkAggregateColumns(stmt); err != nil {
+		return nil, err
+	}
 
-func (p *Parser) parseInsert() (*InsertStatement, error) {
-	stmt := &InsertStatement{
-		Values: make(map[string]interface{}),
+	if p.isOrderBy() {
+		orderBy, err := p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+		stmt.OrderBy = orderBy
 	}
 
-	// Parse INTO keyword - use peekToken which was already read by New()
-	tok := p.peekToken
-	p.nextToken() // Advance to consume the INTO token
-	if strings.ToUpper(tok.Literal) != "INTO" {
-		return nil, fmt.Errorf("expected INTO, got %s", tok.Literal)
+	if p.isLimit() {
+		limit, params, err := p.parseLimit()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Limit, stmt.LimitParams = limit, params
 	}
 
-	// Parse table name
-	p.nextToken()
-	if p.currentToken.Type != lexer.IDENTIFIER {
-		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	return stmt, nil
+}
+
+// parseSelectExpr parses a computed column, expr [AS alias], and leaves the
+// parser on the token after it
+func (p *Parser) parseSelectExpr(stmt *SelectStatement) error {
+	expr, err := p.parseConcat()
+	if err != nil {
+		return err
 	}
-	stmt.Table = p.currentToken.Literal
+	name, err := p.parseAlias(expr.String(), stmt)
+	if err != nil {
+		return err
+	}
+	if stmt.Exprs == nil {
+		stmt.Exprs = make(map[string]ConcatExpr)
+	}
+	stmt.Exprs[name] = expr
+	stmt.Columns = append(stmt.Columns, name)
+	return nil
+}
 
-	// Parse VALUES keyword
+// parseAggregate parses an aggregate call, e.g. COUNT(DISTINCT email) AS
+// senders, and leaves the parser on the token after it
+func (p *Parser) parseAggregate(stmt *SelectStatement) error {
+	call := types.AggregateCall{Func: strings.ToUpper(p.currentToken.Literal)}
+	p.nextToken() // move past the function name
+	p.nextToken() // move past (
+
+	if call.Func == "COUNT" && strings.EqualFold(p.currentToken.Literal, "DISTINCT") {
+		call.Distinct = true
+		p.nextToken()
+	}
+	switch {
+	case p.currentToken.Type == lexer.ASTERISK && call.Func == "COUNT" && !call.Distinct:
+		call.Column = "*"
+	case p.currentToken.Type == lexer.IDENTIFIER:
+		call.Column = p.currentToken.Literal
+	default:
+		return fmt.Errorf("expected column in %s, got %s", call.Func, p.currentToken.Literal)
+	}
 	p.nextToken()
-	if strings.ToUpper(p.currentToken.Literal) != "VALUES" {
-		return nil, fmt.Errorf("expected VALUES, got %s", p.currentToken.Literal)
+	if p.currentToken.Type != lexer.RPAREN {
+		return fmt.Errorf("expected ) after %s, got %s", call, p.currentToken.Literal)
 	}
-
-	// Parse values (expect LPAREN)
 	p.nextToken()
-	if p.currentToken.Type != lexer.LPAREN {
-		return nil, fmt.Errorf("expected (, got %s", p.currentToken.Literal)
+
+	name, err := p.parseAlias(call.String(), stmt)
+	if err != nil {
+		return err
+	}
+	if stmt.Aggregates == nil {
+		stmt.Aggregates = make(map[string]types.AggregateCall)
 	}
+	stmt.Aggregates[name] = call
+	stmt.Columns = append(stmt.Columns, name)
+	return nil
+}
 
-	colIndex := 0
-	for {
+// parseAlias parses an optional AS alias after a computed column and
+// returns the column name, which is name without an alias
+func (p *Parser) parseAlias(name string, stmt *SelectStatement) (string, error) {
+	if strings.EqualFold(p.currentToken.Literal, "AS") {
 		p.nextToken()
-		if p.currentToken.Type == lexer.RPAREN {
-			break
+		if p.currentToken.Type != lexer.IDENTIFIER {
+			return "", fmt.Errorf("expected column alias after AS, got %s", p.currentToken.Literal)
 		}
-
-		if p.currentToken.Type == lexer.NUMBER {
-			val, err := strconv.ParseFloat(p.currentToken.Literal, 64)
-			if err != nil {
+		name = p.currentToken.Literal
+		p.nextToken()
+	}
+	for _, col := range stmt.Columns {
+		if col == name {
+			return "", fmt.Errorf("duplicate column name %s", name)
+		}
+	}
+	return name, nil
+}
+
+// checkAggregateColumns rejects columns next to aggregates, or in a
+// grouped SELECT, that are neither aggregates nor GROUP BY columns
+func checkAggregateColumns(stmt *SelectStatement) error {
+	if len(stmt.Aggregates) == 0 && len(stmt.GroupBy) == 0 {
+		return nil
+	}
+	for _, col := range stmt.Columns {
+		if _, ok := stmt.Aggregates[col]; !ok && !stmt.isGroupColumn(col) {
+			return fmt.Errorf("column %s must appear in GROUP BY or be used in an aggregate function", col)
+		}
+	}
+	return nil
+}
+
+// checkAggregateTypes rejects SUM and AVG over columns of table that are
+// not numeric. Values that are not numbers are also rejected as they are
+// added, since tables without a schema, such as CTEs, are not checked here.
+func (s *SelectStatement) checkAggregateTypes(table *types.Table) error {
+	if table == nil {
+		return nil
+	}
+	for _, call := range s.Aggregates {
+		if !call.Numeric() {
+			continue
+		}
+		for _, col := range table.Columns {
+			if col.Name == call.Column && (col.Type == "STRING" || col.Type == "TEXT") {
+				return fmt.Errorf("%s: column %s is %s, not a numeric column", call, col.Name, col.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// whereOperator returns the comparison operator at the current token, or
+// "" if there is none. For NOT LIKE, NOT IN and IS NOT NULL the parser is
+// left on the second word.
+func (p *Parser) whereOperator() string {
+	switch p.currentToken.Type {
+	case lexer.EQUALS, lexer.NOT_EQ, lexer.LT, lexer.GT, lexer.LTE, lexer.GTE:
+		return p.currentToken.Literal
+	}
+	if strings.EqualFold(p.currentToken.Literal, "LIKE") || strings.EqualFold(p.currentToken.Literal, "IN") || strings.EqualFold(p.currentToken.Literal, "BETWEEN") {
+		return strings.ToUpper(p.currentToken.Literal)
+	}
+	if strings.EqualFold(p.currentToken.Literal, "NOT") && (strings.EqualFold(p.peekToken.Literal, "LIKE") || strings.EqualFold(p.peekToken.Literal, "IN")) {
+		p.nextToken()
+		return "NOT " + strings.ToUpper(p.currentToken.Literal)
+	}
+	// The NULL of IS [NOT] NULL is left to parseConditionValue, as the
+	// condition's value
+	if strings.EqualFold(p.currentToken.Literal, "IS") {
+		if strings.EqualFold(p.peekToken.Literal, "NOT") {
+			p.nextToken()
+			return "IS NOT NULL"
+		}
+		return "IS NULL"
+	}
+	return ""
+}
+
+// whereCondition returns the value of a WHERE condition on a column: the
+// value itself for =, or a types.Comparison for any other operator
+func whereCondition(op string, val interface{}) interface{} {
+	if op == "=" {
+		return val
+	}
+	return types.Comparison{Operator: op, Value: val}
+}
+
+// parseWhereValue parses the value of a WHERE condition in a SELECT
+func (p *Parser) parseWhereValue() (interface{}, error) {
+	switch p.currentToken.Type {
+	case lexer.NUMBER:
+		val, err := parseNumber(p.currentToken.Literal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
+		}
+		return val, nil
+	case lexer.STRING:
+		return strings.Trim(p.currentToken.Literal, "'\""), nil
+	case lexer.BOOLEAN:
+		return parseBoolean(p.currentToken.Literal), nil
+	case lexer.VARIABLE:
+		return Variable{Name: p.currentToken.Literal}, nil
+	case lexer.PLACEHOLDER:
+		return p.placeholder(), nil
+	}
+	return p.currentToken.Literal, nil
+}
+
+// parseNumber parses a NUMBER literal: an integer as int64, so that values
+// beyond 2^53 stay exact, and a number with a fractional part as float64
+func parseNumber(literal string) (interface{}, error) {
+	if strings.Contains(literal, ".") {
+		return strconv.ParseFloat(literal, 64)
+	}
+	return strconv.ParseInt(literal, 10, 64)
+}
+
+// parseBoolean returns the value of a TRUE or FALSE literal
+func parseBoolean(literal string) bool {
+	return strings.EqualFold(literal, "TRUE")
+}
+
+// parseTableSample parses TABLESAMPLE (n PERCENT | n ROWS) [REPEATABLE
+// (seed)] and leaves the parser on the token after it
+func (p *Parser) parseTableSample() (*types.SampleSpec, error) {
+	sample := &types.SampleSpec{}
+	p.nextToken()
+	if p.currentToken.Type != lexer.LPAREN {
+		return nil, fmt.Errorf("expected ( after TABLESAMPLE, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.NUMBER {
+		return nil, fmt.Errorf("expected sample size, got %s", p.currentToken.Literal)
+	}
+	size := p.currentToken.Literal
+
+	p.nextToken()
+	switch strings.ToUpper(p.currentToken.Literal) {
+	case "PERCENT":
+		percent, err := strconv.ParseFloat(size, 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("TABLESAMPLE percent must be greater than 0 and at most 100, got %s", size)
+		}
+		sample.Percent = percent
+	case "ROWS":
+		rows, err := strconv.Atoi(size)
+		if err != nil || rows <= 0 {
+			return nil, fmt.Errorf("TABLESAMPLE rows must be a positive integer, got %s", size)
+		}
+		sample.Rows = rows
+	default:
+		return nil, fmt.Errorf("expected PERCENT or ROWS, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.RPAREN {
+		return nil, fmt.Errorf("expected ), got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "REPEATABLE") {
+		p.nextToken()
+		if p.currentToken.Type != lexer.LPAREN {
+			return nil, fmt.Errorf("expected ( after REPEATABLE, got %s", p.currentToken.Literal)
+		}
+		p.nextToken()
+		seed, err := strconv.ParseInt(p.currentToken.Literal, 10, 64)
+		if p.currentToken.Type != lexer.NUMBER || err != nil {
+			return nil, fmt.Errorf("REPEATABLE seed must be an integer, got %s", p.currentToken.Literal)
+		}
+		p.nextToken()
+		if p.currentToken.Type != lexer.RPAREN {
+			return nil, fmt.Errorf("expected ), got %s", p.currentToken.Literal)
+		}
+		sample.Repeatable, sample.Seed = true, seed
+		p.nextToken()
+	}
+	return sample, nil
+}
+
+// parseWith parses WITH name AS (SELECT ...)[, ...] followed by the main
+// SELECT
+func (p *Parser) parseWith() (*SelectStatement, error) {
+	var ctes []CTE
+	for {
+		p.nextToken()
+		if p.currentToken.Type != lexer.IDENTIFIER {
+			return nil, fmt.Errorf("expected CTE name, got %s", p.currentToken.Literal)
+		}
+		name := p.currentToken.Literal
+
+		p.nextToken()
+		if !strings.EqualFold(p.currentToken.Literal, "AS") {
+			return nil, fmt.Errorf("expected AS, got %s", p.currentToken.Literal)
+		}
+
+		p.nextToken()
+		if p.currentToken.Type != lexer.LPAREN {
+			return nil, fmt.Errorf("expected (, got %s", p.currentToken.Literal)
+		}
+
+		p.nextToken()
+		if p.currentToken.Literal != "SELECT" {
+			return nil, fmt.Errorf("expected SELECT, got %s", p.currentToken.Literal)
+		}
+		sel, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		if sel.Table == "" {
+			return nil, fmt.Errorf("expected FROM in CTE %s", name)
+		}
+		if p.currentToken.Type != lexer.RPAREN {
+			return nil, fmt.Errorf("expected ), got %s", p.currentToken.Literal)
+		}
+		ctes = append(ctes, CTE{Name: name, Select: sel})
+
+		p.nextToken()
+		if p.currentToken.Type != lexer.COMMA {
+			break
+		}
+	}
+
+	if p.currentToken.Literal != "SELECT" {
+		return nil, fmt.Errorf("expected SELECT, got %s", p.currentToken.Literal)
+	}
+	if err := checkCTENames(ctes); err != nil {
+		return nil, err
+	}
+
+	stmt, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	stmt.With = ctes
+	return stmt, nil
+}
+
+func (p *Parser) parseInsert() (*InsertStatement, error) {
+	stmt := &InsertStatement{}
+
+	// Parse INTO keyword - use peekToken which was already read by New()
+	tok := p.peekToken
+	p.nextToken() // Advance to consume the INTO token
+	if strings.ToUpper(tok.Literal) != "INTO" {
+		return nil, fmt.Errorf("expected INTO, got %s", tok.Literal)
+	}
+
+	// Parse table name
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	// Parse the optional column list
+	p.nextToken()
+	if p.currentToken.Type == lexer.LPAREN {
+		seen := make(map[string]bool)
+		for {
+			p.nextToken()
+			if p.currentToken.Type != lexer.IDENTIFIER {
+				return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
+			}
+			name := p.currentToken.Literal
+			if seen[name] {
+				return nil, fmt.Errorf("column %s specified more than once", name)
+			}
+			seen[name] = true
+			stmt.Columns = append(stmt.Columns, name)
+
+			p.nextToken()
+			if p.currentToken.Type == lexer.RPAREN {
+				break
+			}
+			if p.currentToken.Type != lexer.COMMA {
+				return nil, fmt.Errorf("expected comma or ), got %s", p.currentToken.Literal)
+			}
+		}
+		p.nextToken()
+	}
+
+	// Parse VALUES keyword
+	if strings.ToUpper(p.currentToken.Literal) != "VALUES" {
+		return nil, fmt.Errorf("expected VALUES, got %s", p.currentToken.Literal)
+	}
+
+	// Parse one or more tuples: (...), (...). Errors name the tuple, so a
+	// typo in a long bulk INSERT can be found.
+	for {
+		p.nextToken()
+		values, err := p.parseValuesTuple()
+		if err != nil {
+			return nil, fmt.Errorf("VALUES row %d: %w", len(stmt.Rows)+1, err)
+		}
+
+		n := len(values)
+		switch {
+		case stmt.Columns != nil && n != len(stmt.Columns):
+			return nil, fmt.Errorf("INSERT has %d columns but %d values", len(stmt.Columns), n)
+		case len(stmt.Rows) > 0 && n != len(stmt.Rows[0]):
+			return nil, fmt.Errorf("VALUES row %d has %d values, expected %d", len(stmt.Rows)+1, n, len(stmt.Rows[0]))
+		}
+
+		row := make(map[string]interface{}, n)
+		for i, val := range values {
+			if stmt.Columns != nil {
+				row[stmt.Columns[i]] = val
+			} else {
+				row[fmt.Sprintf("column%d", i+1)] = val
+			}
+		}
+		stmt.Rows = append(stmt.Rows, row)
+
+		p.nextToken()
+		if p.currentToken.Type != lexer.COMMA {
+			break
+		}
+	}
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("expected comma or end of INSERT after VALUES row %d, got %s", len(stmt.Rows), p.currentToken.Literal)
+	}
+
+	return stmt, nil
+}
+
+// parseValuesTuple parses a parenthesized list of values starting at the
+// current token and leaves the parser on the closing )
+func (p *Parser) parseValuesTuple() ([]interface{}, error) {
+	if p.currentToken.Type != lexer.LPAREN {
+		return nil, fmt.Errorf("expected (, got %s", p.currentToken.Literal)
+	}
+
+	var values []interface{}
+	for {
+		p.nextToken()
+		if p.currentToken.Type == lexer.RPAREN && len(values) == 0 {
+			return values, nil
+		}
+
+		if p.currentToken.Type == lexer.NUMBER {
+			val, err := parseNumber(p.currentToken.Literal)
+			if err != nil {
 				return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
 			}
-			stmt.Values[fmt.Sprintf("column%d", colIndex+1)] = val
+			values = append(values, val)
 		} else if p.currentToken.Type == lexer.STRING {
-			stmt.Values[fmt.Sprintf("column%d", colIndex+1)] = strings.Trim(p.currentToken.Literal, "'\"")
+			values = append(values, strings.Trim(p.currentToken.Literal, "'\""))
+		} else if p.currentToken.Type == lexer.BOOLEAN {
+			values = append(values, parseBoolean(p.currentToken.Literal))
+		} else if p.currentToken.Type == lexer.VARIABLE {
+			values = append(values, Variable{Name: p.currentToken.Literal})
+		} else if p.currentToken.Type == lexer.PLACEHOLDER {
+			values = append(values, p.placeholder())
+		} else if p.currentToken.Type == lexer.IDENTIFIER && strings.EqualFold(p.currentToken.Literal, "NULL") {
+			values = append(values, nil)
 		} else {
 			return nil, fmt.Errorf("expected number or string, got %s", p.currentToken.Literal)
 		}
 
-		colIndex++
-
 		p.nextToken()
 		if p.currentToken.Type == lexer.RPAREN {
-			break
+			return values, nil
 		}
 		if p.currentToken.Type != lexer.COMMA {
 			return nil, fmt.Errorf("expected comma or ), got %s", p.currentToken.Literal)
 		}
 	}
-
-	return stmt, nil
 }
 
 func (p *Parser) parseUpdate() (*UpdateStatement, error) {
@@ -353,23 +1384,17 @@ func (p *Parser) parseUpdate() (*UpdateStatement, error) {
 		}
 
 		p.nextToken()
-		if p.currentToken.Type == lexer.NUMBER {
-			val, err := strconv.ParseFloat(p.currentToken.Literal, 64)
-			if err != nil {
-				return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
-			}
-			stmt.Set[col] = val
-		} else if p.currentToken.Type == lexer.STRING {
-			stmt.Set[col] = strings.Trim(p.currentToken.Literal, "'\"")
-		} else {
-			return nil, fmt.Errorf("expected number or string, got %s", p.currentToken.Literal)
+		val, err := p.parseUpdateValue()
+		if err != nil {
+			return nil, err
 		}
+		stmt.Set[col] = val
 
 		p.nextToken()
 		if p.currentToken.Type == lexer.EOF {
 			break
 		}
-		if strings.ToUpper(p.currentToken.Literal) == "WHERE" {
+		if keyword := strings.ToUpper(p.currentToken.Literal); keyword == "WHERE" || keyword == "FROM" {
 			break
 		}
 		if p.currentToken.Type != lexer.COMMA {
@@ -377,49 +1402,134 @@ func (p *Parser) parseUpdate() (*UpdateStatement, error) {
 		}
 	}
 
-	// Parse WHERE clause if present
-	if strings.ToUpper(p.currentToken.Literal) == "WHERE" {
-		where := make(map[string]interface{})
-		for {
+	// Parse FROM source [alias] if present
+	if strings.ToUpper(p.currentToken.Literal) == "FROM" {
+		p.nextToken()
+		if p.currentToken.Type != lexer.IDENTIFIER {
+			return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+		}
+		stmt.From = &UpdateSource{Table: p.currentToken.Literal}
+
+		p.nextToken()
+		if strings.EqualFold(p.currentToken.Literal, "AS") {
 			p.nextToken()
-			if p.currentToken.Type == lexer.EOF {
-				break
+			if p.currentToken.Type != lexer.IDENTIFIER {
+				return nil, fmt.Errorf("expected alias, got %s", p.currentToken.Literal)
 			}
+		}
+		if p.currentToken.Type == lexer.IDENTIFIER {
+			stmt.From.Alias = p.currentToken.Literal
+			p.nextToken()
+		}
+		if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON &&
+			strings.ToUpper(p.currentToken.Literal) != "WHERE" {
+			return nil, fmt.Errorf("expected WHERE, got %s", p.currentToken.Literal)
+		}
+	}
 
+	// Parse WHERE clause if present. Conditions on the target table go
+	// into the WHERE clause; those involving the FROM table are bound after.
+	var conditions []updateCondition
+	if strings.ToUpper(p.currentToken.Literal) == "WHERE" {
+		where, err := p.parseWhere(func() (*types.WhereExpr, error) {
 			if p.currentToken.Type != lexer.IDENTIFIER {
 				return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
 			}
-			col := p.currentToken.Literal
+			col, err := p.parseColumnRef()
+			if err != nil {
+				return nil, err
+			}
 
 			p.nextToken()
-			if p.currentToken.Type != lexer.EQUALS {
-				return nil, fmt.Errorf("expected =, got %s", p.currentToken.Literal)
+			op := p.whereOperator()
+			if op == "" {
+				return nil, fmt.Errorf("expected comparison operator, got %s", p.currentToken.Literal)
 			}
 
 			p.nextToken()
-			if p.currentToken.Type == lexer.NUMBER {
-				val, err := strconv.ParseFloat(p.currentToken.Literal, 64)
-				if err != nil {
-					return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
-				}
-				where[col] = val
-			} else if p.currentToken.Type == lexer.STRING {
-				where[col] = strings.Trim(p.currentToken.Literal, "'\"")
-			} else {
-				return nil, fmt.Errorf("expected number or string, got %s", p.currentToken.Literal)
+			val, err := p.parseConditionValue(op, p.parseUpdateValue)
+			if err != nil {
+				return nil, err
 			}
-
 			p.nextToken()
-			if p.currentToken.Type == lexer.EOF {
-				break
+
+			_, isRef := val.(ColumnRef)
+			if isRef && op != "=" {
+				return nil, fmt.Errorf("condition %s %s %s: only = can compare columns", col, op, val)
+			}
+			source, err := stmt.isSource(col.Table)
+			if err != nil {
+				return nil, err
+			}
+			if isRef || source {
+				conditions = append(conditions, updateCondition{column: col, value: whereCondition(op, val)})
+				return nil, nil
 			}
+			return types.Condition(col.Column, whereCondition(op, val)), nil
+		})
+		if stmt.From != nil && (errors.Is(err, errKeptOr) || (err == nil && len(conditions) > 0 && hasOr(where))) {
+			return nil, fmt.Errorf("conditions on %s cannot be combined with OR", stmt.From.Table)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+			return nil, fmt.Errorf("unexpected %s in WHERE", p.currentToken.Literal)
 		}
 		stmt.Where = where
 	}
 
+	if err := stmt.bindConditions(conditions); err != nil {
+		return nil, err
+	}
 	return stmt, nil
 }
 
+// parseColumnRef parses a column name that may be qualified with a table
+// name or alias (r.new_salary)
+func (p *Parser) parseColumnRef() (ColumnRef, error) {
+	ref := ColumnRef{Column: p.currentToken.Literal}
+	if p.peekToken.Type != lexer.DOT {
+		return ref, nil
+	}
+	p.nextToken()
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return ColumnRef{}, fmt.Errorf("expected column name after %s., got %s", ref.Column, p.currentToken.Literal)
+	}
+	return ColumnRef{Table: ref.Column, Column: p.currentToken.Literal}, nil
+}
+
+// parseUpdateValue parses the right hand side of a SET assignment or WHERE
+// condition in an UPDATE: a literal or NULL, a session variable, or a
+// qualified column reference
+func (p *Parser) parseUpdateValue() (interface{}, error) {
+	switch p.currentToken.Type {
+	case lexer.NUMBER:
+		val, err := parseNumber(p.currentToken.Literal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
+		}
+		return val, nil
+	case lexer.STRING:
+		return strings.Trim(p.currentToken.Literal, "'\""), nil
+	case lexer.BOOLEAN:
+		return parseBoolean(p.currentToken.Literal), nil
+	case lexer.VARIABLE:
+		return Variable{Name: p.currentToken.Literal}, nil
+	case lexer.PLACEHOLDER:
+		return p.placeholder(), nil
+	case lexer.IDENTIFIER:
+		if p.peekToken.Type == lexer.DOT {
+			return p.parseColumnRef()
+		}
+		if strings.EqualFold(p.currentToken.Literal, "NULL") {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("expected number or string, got %s", p.currentToken.Literal)
+}
+
 func (p *Parser) parseDelete() (*DeleteStatement, error) {
 	stmt := &DeleteStatement{}
 
@@ -443,40 +1553,49 @@ func (p *Parser) parseDelete() (*DeleteStatement, error) {
 	}
 
 	if strings.ToUpper(p.currentToken.Literal) == "WHERE" {
-		where := make(map[string]interface{})
-		for {
-			p.nextToken()
-			if p.currentToken.Type == lexer.EOF {
-				break
-			}
-
+		where, err := p.parseWhere(func() (*types.WhereExpr, error) {
 			if p.currentToken.Type != lexer.IDENTIFIER {
 				return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
 			}
 			col := p.currentToken.Literal
 
 			p.nextToken()
-			if p.currentToken.Type != lexer.EQUALS {
-				return nil, fmt.Errorf("expected =, got %s", p.currentToken.Literal)
+			op := p.whereOperator()
+			if op == "" {
+				return nil, fmt.Errorf("expected comparison operator, got %s", p.currentToken.Literal)
 			}
 
 			p.nextToken()
-			if p.currentToken.Type == lexer.NUMBER {
-				val, err := strconv.ParseFloat(p.currentToken.Literal, 64)
-				if err != nil {
-					return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
+			val, err := p.parseConditionValue(op, func() (interface{}, error) {
+				switch p.currentToken.Type {
+				case lexer.NUMBER:
+					num, err := parseNumber(p.currentToken.Literal)
+					if err != nil {
+						return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
+					}
+					return num, nil
+				case lexer.STRING:
+					return strings.Trim(p.currentToken.Literal, "'\""), nil
+				case lexer.BOOLEAN:
+					return parseBoolean(p.currentToken.Literal), nil
+				case lexer.VARIABLE:
+					return Variable{Name: p.currentToken.Literal}, nil
+				case lexer.PLACEHOLDER:
+					return p.placeholder(), nil
 				}
-				where[col] = val
-			} else if p.currentToken.Type == lexer.STRING {
-				where[col] = strings.Trim(p.currentToken.Literal, "'\"")
-			} else {
 				return nil, fmt.Errorf("expected number or string, got %s", p.currentToken.Literal)
+			})
+			if err != nil {
+				return nil, err
 			}
-
 			p.nextToken()
-			if p.currentToken.Type == lexer.EOF {
-				break
-			}
+			return types.Condition(col, whereCondition(op, val)), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+			return nil, fmt.Errorf("unexpected %s in WHERE", p.currentToken.Literal)
 		}
 		stmt.Where = where
 	}
@@ -484,6 +1603,357 @@ func (p *Parser) parseDelete() (*DeleteStatement, error) {
 	return stmt, nil
 }
 
+func (p *Parser) parseSet() (*SetStatement, error) {
+	stmt := &SetStatement{}
+
+	// Parse variable or setting name
+	p.nextToken()
+	switch p.currentToken.Type {
+	case lexer.VARIABLE:
+	case lexer.IDENTIFIER:
+		stmt.Setting = true
+	default:
+		return nil, fmt.Errorf("expected @variable or setting name, got %s", p.currentToken.Literal)
+	}
+	stmt.Name = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EQUALS {
+		return nil, fmt.Errorf("expected =, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type == lexer.NUMBER {
+		val, err := parseNumber(p.currentToken.Literal)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %s", p.currentToken.Literal)
+		}
+		stmt.Value = val
+	} else if p.currentToken.Type == lexer.STRING {
+		stmt.Value = strings.Trim(p.currentToken.Literal, "'\"")
+	} else if p.currentToken.Type == lexer.VARIABLE {
+		stmt.Value = Variable{Name: p.currentToken.Literal}
+	} else if p.currentToken.Type == lexer.BOOLEAN {
+		stmt.Value = parseBoolean(p.currentToken.Literal)
+	} else {
+		return nil, fmt.Errorf("expected number, string, boolean or @variable, got %s", p.currentToken.Literal)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseAlter() (*AlterStatement, error) {
+	stmt := &AlterStatement{}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "TABLE") {
+		return nil, fmt.Errorf("expected TABLE, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "ALTER") {
+		return p.parseAlterColumn(stmt)
+	}
+	if strings.EqualFold(p.currentToken.Literal, "ADD") {
+		return p.parseAddColumn(stmt)
+	}
+	if !strings.EqualFold(p.currentToken.Literal, "SET") {
+		return nil, fmt.Errorf("expected SET, ALTER COLUMN or ADD COLUMN, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	stmt.Option = strings.ToUpper(p.currentToken.Literal)
+	switch stmt.Option {
+	case "AUDIT":
+	case "MAX_ROWS", "MAX_BYTES":
+		return p.parseQuota(stmt)
+	default:
+		return nil, fmt.Errorf("unsupported table option: %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EQUALS {
+		return nil, fmt.Errorf("expected =, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	switch {
+	case strings.EqualFold(p.currentToken.Literal, "true"):
+		stmt.Value = true
+	case strings.EqualFold(p.currentToken.Literal, "false"):
+		stmt.Value = false
+	default:
+		return nil, fmt.Errorf("AUDIT expects true or false, got %s", p.currentToken.Literal)
+	}
+
+	return stmt, nil
+}
+
+// parseAlterColumn parses ALTER [COLUMN] name TYPE type [USING name]. The
+// only USING expression supported is the column itself, which converts each
+// stored value to the new type and fails if any does not convert.
+func (p *Parser) parseAlterColumn(stmt *AlterStatement) (*AlterStatement, error) {
+	stmt.Option = "TYPE"
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "COLUMN") {
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
+	}
+	stmt.Column = p.currentToken.Literal
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "SET") || strings.EqualFold(p.currentToken.Literal, "DROP") {
+		return p.parseColumnMask(stmt)
+	}
+	if !strings.EqualFold(p.currentToken.Literal, "TYPE") {
+		return nil, fmt.Errorf("expected TYPE, SET MASKED or DROP MASKED, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.KEYWORD && p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected column type, got %s", p.currentToken.Literal)
+	}
+	stmt.Value = columnType(p.currentToken.Literal)
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "USING") {
+		p.nextToken()
+		if p.currentToken.Literal != stmt.Column || p.peekToken.Type != lexer.EOF && p.peekToken.Type != lexer.SEMICOLON {
+			return nil, fmt.Errorf("USING supports only the column itself (USING %s)", stmt.Column)
+		}
+		stmt.Using = true
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after ALTER COLUMN", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// parseAddColumn parses ADD [COLUMN] name type [NOT NULL | NULL]
+// [DEFAULT value]
+func (p *Parser) parseAddColumn(stmt *AlterStatement) (*AlterStatement, error) {
+	stmt.Option = "ADD"
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "COLUMN") {
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected column name, got %s", p.currentToken.Literal)
+	}
+	stmt.Column = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER && p.currentToken.Type != lexer.KEYWORD {
+		return nil, fmt.Errorf("expected column type, got %s", p.currentToken.Literal)
+	}
+	col, err := p.parseColumnModifiers(stmt.Column, columnType(p.currentToken.Literal))
+	if err != nil {
+		return nil, err
+	}
+	if col.PrimaryKey {
+		return nil, fmt.Errorf("cannot add PRIMARY KEY column %s to existing table %s", col.Name, stmt.Table)
+	}
+	stmt.Value = col
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after ADD COLUMN", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// parseColumnMask parses SET MASKED [USING 'policy'] or DROP MASKED after
+// ALTER COLUMN name. The policy defaults to full; DROP MASKED sets it to "".
+func (p *Parser) parseColumnMask(stmt *AlterStatement) (*AlterStatement, error) {
+	stmt.Option = "MASK"
+	drop := strings.EqualFold(p.currentToken.Literal, "DROP")
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "MASKED") {
+		return nil, fmt.Errorf("expected MASKED, got %s", p.currentToken.Literal)
+	}
+	stmt.Value = ""
+	if !drop {
+		stmt.Value = "full"
+	}
+
+	p.nextToken()
+	if !drop && strings.EqualFold(p.currentToken.Literal, "USING") {
+		p.nextToken()
+		if p.currentToken.Type != lexer.STRING {
+			return nil, fmt.Errorf("expected a masking policy string, got %s", p.currentToken.Literal)
+		}
+		policy, err := types.ParseMaskPolicy(strings.Trim(p.currentToken.Literal, "'\""))
+		if err != nil {
+			return nil, err
+		}
+		stmt.Value = policy
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after ALTER COLUMN", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+// parseQuota parses the value of a MAX_ROWS or MAX_BYTES option and the
+// optional ON FULL clause
+func (p *Parser) parseQuota(stmt *AlterStatement) (*AlterStatement, error) {
+	p.nextToken()
+	if p.currentToken.Type != lexer.EQUALS {
+		return nil, fmt.Errorf("expected =, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	limit, err := strconv.ParseInt(p.currentToken.Literal, 10, 64)
+	if p.currentToken.Type != lexer.NUMBER || err != nil || limit < 0 {
+		return nil, fmt.Errorf("%s expects a non-negative integer, got %s", stmt.Option, p.currentToken.Literal)
+	}
+	stmt.Value = limit
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "ON") {
+		return stmt, nil
+	}
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "FULL") {
+		return nil, fmt.Errorf("expected FULL, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	switch strings.ToUpper(p.currentToken.Literal) {
+	case "ERROR":
+		stmt.OnFull = "ERROR"
+	case "DELETE":
+		p.nextToken()
+		if !strings.EqualFold(p.currentToken.Literal, "OLDEST") {
+			return nil, fmt.Errorf("expected OLDEST, got %s", p.currentToken.Literal)
+		}
+		stmt.OnFull = "DELETE OLDEST"
+	default:
+		return nil, fmt.Errorf("expected ERROR or DELETE OLDEST after ON FULL, got %s", p.currentToken.Literal)
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseCheck() (*CheckStatement, error) {
+	stmt := &CheckStatement{}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "TABLE") {
+		return nil, fmt.Errorf("expected TABLE, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "REPAIR") {
+		stmt.Repair = true
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseDrop() (*DropStatement, error) {
+	stmt := &DropStatement{}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "TABLE") {
+		return nil, fmt.Errorf("expected TABLE, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "IF") {
+		p.nextToken()
+		if !strings.EqualFold(p.currentToken.Literal, "EXISTS") {
+			return nil, fmt.Errorf("expected EXISTS, got %s", p.currentToken.Literal)
+		}
+		stmt.IfExists = true
+		p.nextToken()
+	}
+
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return nil, fmt.Errorf("unexpected %s after table name", p.currentToken.Literal)
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseAudit() (*AuditStatement, error) {
+	stmt := &AuditStatement{}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "LOG") {
+		return nil, fmt.Errorf("expected LOG, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "FOR") {
+		return nil, fmt.Errorf("expected FOR, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.IDENTIFIER {
+		return nil, fmt.Errorf("expected table name, got %s", p.currentToken.Literal)
+	}
+	stmt.Table = p.currentToken.Literal
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "LIMIT") {
+		p.nextToken()
+		limit, err := strconv.Atoi(p.currentToken.Literal)
+		if p.currentToken.Type != lexer.NUMBER || err != nil || limit < 0 {
+			return nil, fmt.Errorf("expected row count after LIMIT, got %s", p.currentToken.Literal)
+		}
+		stmt.Limit = limit
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) parseLoad() (*LoadStatement, error) {
+	stmt := &LoadStatement{}
+
+	p.nextToken()
+	if !strings.EqualFold(p.currentToken.Literal, "FIXTURE") {
+		return nil, fmt.Errorf("expected FIXTURE, got %s", p.currentToken.Literal)
+	}
+
+	p.nextToken()
+	if p.currentToken.Type != lexer.STRING || p.currentToken.Literal == "" {
+		return nil, fmt.Errorf("expected fixture path, got %s", p.currentToken.Literal)
+	}
+	stmt.Path = p.currentToken.Literal
+
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "MERGE") {
+		stmt.Merge = true
+	}
+
+	return stmt, nil
+}
+
 func (p *Parser) parseCreate() (*CreateStatement, error) {
 	stmt := &CreateStatement{}
 
@@ -494,6 +1964,18 @@ func (p *Parser) parseCreate() (*CreateStatement, error) {
 		return nil, fmt.Errorf("expected TABLE, got %s", tok.Literal)
 	}
 
+	// Parse optional IF NOT EXISTS
+	if strings.ToUpper(p.peekToken.Literal) == "IF" {
+		p.nextToken()
+		for _, kw := range []string{"NOT", "EXISTS"} {
+			p.nextToken()
+			if strings.ToUpper(p.currentToken.Literal) != kw {
+				return nil, fmt.Errorf("expected %s, got %s", kw, p.currentToken.Literal)
+			}
+		}
+		stmt.IfNotExists = true
+	}
+
 	// Parse table name
 	p.nextToken()
 	if p.currentToken.Type != lexer.IDENTIFIER {
@@ -523,17 +2005,32 @@ func (p *Parser) parseCreate() (*CreateStatement, error) {
 		if p.currentToken.Type != lexer.IDENTIFIER && p.currentToken.Type != lexer.KEYWORD {
 			return nil, fmt.Errorf("expected column type, got %s", p.currentToken.Literal)
 		}
-		// Normalize type name to uppercase for consistency
-		colType := strings.ToUpper(p.currentToken.Literal)
+		colType := columnType(p.currentToken.Literal)
+
+		col, err := p.parseColumnModifiers(colName, colType)
+		if err != nil {
+			return nil, err
+		}
+		if col.PrimaryKey {
+			for _, existing := range stmt.Columns {
+				if existing.PrimaryKey {
+					return nil, fmt.Errorf("table %s has more than one primary key: %s and %s", stmt.Table, existing.Name, colName)
+				}
+			}
+		}
 
 		stmt.Columns = append(stmt.Columns, struct {
-			Name     string
-			Type     string
-			Nullable bool
+			Name       string
+			Type       string
+			Nullable   bool
+			PrimaryKey bool
+			Default    interface{}
 		}{
-			Name:     colName,
-			Type:     colType,
-			Nullable: true,
+			Name:       col.Name,
+			Type:       col.Type,
+			Nullable:   col.Nullable,
+			PrimaryKey: col.PrimaryKey,
+			Default:    col.Default,
 		})
 
 		p.nextToken()
@@ -547,3 +2044,68 @@ func (p *Parser) parseCreate() (*CreateStatement, error) {
 
 	return stmt, nil
 }
+
+// columnType returns the type of a column definition normalized to
+// uppercase, with DOUBLE, a synonym of FLOAT, as FLOAT
+func columnType(literal string) string {
+	colType := strings.ToUpper(literal)
+	if colType == "DOUBLE" {
+		return "FLOAT"
+	}
+	return colType
+}
+
+// parseColumnModifiers parses the optional modifiers after a column's type,
+// in any order: NOT NULL, or NULL, the default; PRIMARY KEY, which implies
+// NOT NULL; and DEFAULT value. The parser is left on the last token of the
+// definition.
+func (p *Parser) parseColumnModifiers(name, colType string) (types.ColumnDefinition, error) {
+	col := types.ColumnDefinition{Name: name, Type: colType, Nullable: true}
+	for {
+		switch {
+		case strings.EqualFold(p.peekToken.Literal, "NOT"):
+			p.nextToken()
+			p.nextToken()
+			if strings.ToUpper(p.currentToken.Literal) != "NULL" {
+				return col, fmt.Errorf("expected NULL, got %s", p.currentToken.Literal)
+			}
+			col.Nullable = false
+			continue
+		case strings.EqualFold(p.peekToken.Literal, "NULL"):
+			p.nextToken()
+			continue
+		case strings.EqualFold(p.peekToken.Literal, "PRIMARY"):
+			p.nextToken()
+			p.nextToken()
+			if !strings.EqualFold(p.currentToken.Literal, "KEY") {
+				return col, fmt.Errorf("expected KEY, got %s", p.currentToken.Literal)
+			}
+			col.PrimaryKey, col.Nullable = true, false
+			continue
+		case strings.EqualFold(p.peekToken.Literal, "DEFAULT"):
+			p.nextToken()
+			p.nextToken()
+			switch {
+			case p.currentToken.Type == lexer.NUMBER:
+				num, err := parseNumber(p.currentToken.Literal)
+				if err != nil {
+					return col, fmt.Errorf("invalid DEFAULT %s for column %s", p.currentToken.Literal, name)
+				}
+				col.Default = num
+			case p.currentToken.Type == lexer.STRING:
+				col.Default = p.currentToken.Literal
+			case p.currentToken.Type == lexer.BOOLEAN:
+				col.Default = parseBoolean(p.currentToken.Literal)
+			case strings.EqualFold(p.currentToken.Literal, "NULL"):
+				col.Default = nil
+			default:
+				return col, fmt.Errorf("expected DEFAULT value, got %s", p.currentToken.Literal)
+			}
+			if err := types.CheckDefault(col); err != nil {
+				return col, err
+			}
+			continue
+		}
+		return col, nil
+	}
+}
@@ -1,10 +1,13 @@
 package parser
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
 )
 
 func TestParse(t *testing.T) {
@@ -33,12 +36,224 @@ func TestParse(t *testing.T) {
 				SelectStatement: &SelectStatement{
 					Table:   "tablex",
 					Columns: []string{"a"},
-					Where: map[string]interface{}{
-						"a": float64(1),
+					Where:   types.Condition("a", int64(1)),
+				},
+			},
+		},
+		{
+			name:  "Select with comparison",
+			input: "SELECT a FROM tablex WHERE a >= 2",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "tablex",
+					Columns: []string{"a"},
+					Where:   types.Condition("a", types.Comparison{Operator: ">=", Value: int64(2)}),
+				},
+			},
+		},
+		{
+			name:  "Select with like",
+			input: "SELECT name FROM users WHERE name LIKE 'Al%' AND email not like '%@example.com'",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "users",
+					Columns: []string{"name"},
+					Where: types.And(
+						types.Condition("name", types.Comparison{Operator: "LIKE", Value: "Al%"}),
+						types.Condition("email", types.Comparison{Operator: "NOT LIKE", Value: "%@example.com"}),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select with in",
+			input: "SELECT name FROM employees WHERE department IN ('Engineering','Marketing') AND level NOT IN (1, 2)",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "employees",
+					Columns: []string{"name"},
+					Where: types.And(
+						types.Condition("department", types.Comparison{Operator: "IN", Value: []interface{}{"Engineering", "Marketing"}}),
+						types.Condition("level", types.Comparison{Operator: "NOT IN", Value: []interface{}{int64(1), int64(2)}}),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select with between",
+			input: "SELECT name FROM employees WHERE salary BETWEEN 80000 AND 95000 AND name BETWEEN 'A' AND 'M'",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "employees",
+					Columns: []string{"name"},
+					Where: types.And(
+						types.Condition("salary", types.Comparison{Operator: "BETWEEN", Value: []interface{}{int64(80000), int64(95000)}}),
+						types.Condition("name", types.Comparison{Operator: "BETWEEN", Value: []interface{}{"A", "M"}}),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select with negative numbers",
+			input: "SELECT id FROM accounts WHERE balance = -100 AND rate BETWEEN -1.5 AND 2",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "accounts",
+					Columns: []string{"id"},
+					Where: types.And(
+						types.Condition("balance", int64(-100)),
+						types.Condition("rate", types.Comparison{Operator: "BETWEEN", Value: []interface{}{-1.5, int64(2)}}),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select with is null",
+			input: "SELECT name FROM users WHERE email IS NULL AND age is not null",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "users",
+					Columns: []string{"name"},
+					Where: types.And(
+						types.Condition("email", types.Comparison{Operator: "IS NULL"}),
+						types.Condition("age", types.Comparison{Operator: "IS NOT NULL"}),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select with and and or",
+			input: "SELECT a FROM tablex WHERE a > 1 AND a < 5 AND (b = 'x' OR c = 2 AND d = 3)",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "tablex",
+					Columns: []string{"a"},
+					Where: types.And(
+						types.Condition("a", types.Comparison{Operator: ">", Value: int64(1)}),
+						types.Condition("a", types.Comparison{Operator: "<", Value: int64(5)}),
+						types.Or(
+							types.Condition("b", "x"),
+							types.And(types.Condition("c", int64(2)), types.Condition("d", int64(3))),
+						),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select with not",
+			input: "SELECT a FROM tablex WHERE (a = 1 OR b = 2) AND c = 3 AND NOT (d = 4 OR e > 5) AND NOT f BETWEEN 1 AND 9",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "tablex",
+					Columns: []string{"a"},
+					Where: types.And(
+						types.Or(types.Condition("a", int64(1)), types.Condition("b", int64(2))),
+						types.Condition("c", int64(3)),
+						types.Not(types.Or(types.Condition("d", int64(4)), types.Condition("e", types.Comparison{Operator: ">", Value: int64(5)}))),
+						types.Not(types.Condition("f", types.Comparison{Operator: "BETWEEN", Value: []interface{}{int64(1), int64(9)}})),
+					),
+				},
+			},
+		},
+		{
+			name:  "Select distinct",
+			input: "SELECT DISTINCT department FROM employees",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:    "employees",
+					Columns:  []string{"department"},
+					Distinct: true,
+				},
+			},
+		},
+		{
+			name:  "Select count star",
+			input: "SELECT COUNT(*) FROM employees",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:      "employees",
+					Columns:    []string{"COUNT(*)"},
+					Aggregates: map[string]types.AggregateCall{"COUNT(*)": {Func: "COUNT", Column: "*"}},
+				},
+			},
+		},
+		{
+			name:  "Select with group by",
+			input: "SELECT department, COUNT(*), AVG(salary) FROM employees WHERE level >= 3 GROUP BY department ORDER BY department;",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "employees",
+					Columns: []string{"department", "COUNT(*)", "AVG(salary)"},
+					Where:   types.Condition("level", types.Comparison{Operator: ">=", Value: int64(3)}),
+					Aggregates: map[string]types.AggregateCall{
+						"COUNT(*)":    {Func: "COUNT", Column: "*"},
+						"AVG(salary)": {Func: "AVG", Column: "salary"},
 					},
+					GroupBy: []string{"department"},
+					OrderBy: []OrderByClause{{Column: "department"}},
 				},
 			},
 		},
+		{
+			name:  "Select with order by",
+			input: "SELECT * FROM employees WHERE dept = 'x' ORDER BY salary DESC, name ASC, id;",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "employees",
+					Columns: []string{"*"},
+					Where:   types.Condition("dept", "x"),
+					OrderBy: []OrderByClause{{Column: "salary", Desc: true}, {Column: "name"}, {Column: "id"}},
+				},
+			},
+		},
+		{
+			name:  "Select with limit and offset",
+			input: "SELECT * FROM logs ORDER BY id LIMIT 10 OFFSET 20;",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "logs",
+					Columns: []string{"*"},
+					OrderBy: []OrderByClause{{Column: "id"}},
+					Limit:   &types.LimitSpec{Count: 10, Offset: 20},
+				},
+			},
+		},
+		{
+			name:  "Select with offset only",
+			input: "SELECT id FROM logs WHERE level = 'error' OFFSET 5",
+			want: &Statement{
+				Type: "SELECT",
+				SelectStatement: &SelectStatement{
+					Table:   "logs",
+					Columns: []string{"id"},
+					Where:   types.Condition("level", "error"),
+					Limit:   &types.LimitSpec{Count: types.NoLimit, Offset: 5},
+				},
+			},
+		},
+		{
+			name:    "Select with negative limit",
+			input:   "SELECT * FROM logs LIMIT -1",
+			wantErr: true,
+		},
+		{
+			name:    "Select with non-numeric offset",
+			input:   "SELECT * FROM logs LIMIT 10 OFFSET ten",
+			wantErr: true,
+		},
 		{
 			name:  "Create table",
 			input: "CREATE TABLE tablex (id INT, name TEXT)",
@@ -47,9 +262,11 @@ func TestParse(t *testing.T) {
 				CreateStatement: &CreateStatement{
 					Table: "tablex",
 					Columns: []struct {
-						Name     string
-						Type     string
-						Nullable bool
+						Name       string
+						Type       string
+						Nullable   bool
+						PrimaryKey bool
+						Default    interface{}
 					}{
 						{Name: "id", Type: "INT", Nullable: true},
 						{Name: "name", Type: "TEXT", Nullable: true},
@@ -57,6 +274,52 @@ func TestParse(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "Drop table",
+			input: "DROP TABLE logs;",
+			want: &Statement{
+				Type:          "DROP",
+				DropStatement: &DropStatement{Table: "logs"},
+			},
+		},
+		{
+			name:  "Drop table if exists",
+			input: "DROP TABLE IF EXISTS logs",
+			want: &Statement{
+				Type:          "DROP",
+				DropStatement: &DropStatement{Table: "logs", IfExists: true},
+			},
+		},
+		{
+			name:    "Drop without table",
+			input:   "DROP logs",
+			wantErr: true,
+		},
+		{
+			name:  "Begin",
+			input: "BEGIN;",
+			want:  &Statement{Type: "BEGIN"},
+		},
+		{
+			name:  "Begin transaction",
+			input: "BEGIN TRANSACTION",
+			want:  &Statement{Type: "BEGIN"},
+		},
+		{
+			name:  "Commit",
+			input: "COMMIT;",
+			want:  &Statement{Type: "COMMIT"},
+		},
+		{
+			name:  "Rollback",
+			input: "ROLLBACK",
+			want:  &Statement{Type: "ROLLBACK"},
+		},
+		{
+			name:    "Rollback with argument",
+			input:   "ROLLBACK logs",
+			wantErr: true,
+		},
 		{
 			name:    "Invalid SQL",
 			input:   "INVALID SQL",
@@ -88,12 +351,59 @@ func TestParseInsert(t *testing.T) {
 			input: "INSERT INTO users VALUES (1, 'test')",
 			expected: &InsertStatement{
 				Table: "users",
-				Values: map[string]interface{}{
-					"column1": float64(1),
+				Rows: []map[string]interface{}{{
+					"column1": int64(1),
 					"column2": "test",
+				}},
+			},
+		},
+		{
+			name:  "Insert_column_list",
+			input: "INSERT INTO employees (salary, name) VALUES (90000, 'Alice')",
+			expected: &InsertStatement{
+				Table:   "employees",
+				Columns: []string{"salary", "name"},
+				Rows: []map[string]interface{}{{
+					"name":   "Alice",
+					"salary": int64(90000),
+				}},
+			},
+		},
+		{
+			name:  "Insert_null",
+			input: "INSERT INTO users VALUES (1, NULL)",
+			expected: &InsertStatement{
+				Table: "users",
+				Rows: []map[string]interface{}{{
+					"column1": int64(1),
+					"column2": nil,
+				}},
+			},
+		},
+		{
+			name:  "Insert_multiple_rows",
+			input: "INSERT INTO users VALUES (1, 'a'), (2, @name),('3', 4);",
+			expected: &InsertStatement{
+				Table: "users",
+				Rows: []map[string]interface{}{
+					{"column1": int64(1), "column2": "a"},
+					{"column1": int64(2), "column2": Variable{Name: "name"}},
+					{"column1": "3", "column2": int64(4)},
 				},
 			},
 		},
+		{
+			name:  "Insert_negative_and_decimal_numbers",
+			input: "INSERT INTO t VALUES (-5, 2.5, -0.25)",
+			expected: &InsertStatement{
+				Table: "t",
+				Rows: []map[string]interface{}{{
+					"column1": int64(-5),
+					"column2": 2.5,
+					"column3": -0.25,
+				}},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -121,9 +431,55 @@ func TestParseUpdate(t *testing.T) {
 				Set: map[string]interface{}{
 					"name": "updated",
 				},
-				Where: map[string]interface{}{
-					"id": float64(1),
+				Where: types.Condition("id", int64(1)),
+			},
+		},
+		{
+			name:  "Update_with_comparison",
+			input: "UPDATE users SET name = 'x' WHERE name != 'root'",
+			expected: &UpdateStatement{
+				Table: "users",
+				Set: map[string]interface{}{
+					"name": "x",
 				},
+				Where: types.Condition("name", types.Comparison{Operator: "!=", Value: "root"}),
+			},
+		},
+		{
+			name:  "Update_with_like",
+			input: "UPDATE users SET name = 'x' WHERE name LIKE 'r_ot'",
+			expected: &UpdateStatement{
+				Table: "users",
+				Set: map[string]interface{}{
+					"name": "x",
+				},
+				Where: types.Condition("name", types.Comparison{Operator: "LIKE", Value: "r_ot"}),
+			},
+		},
+		{
+			name:  "Update_with_and",
+			input: "UPDATE users SET name = 'x' WHERE users.age > 17 AND name = 'y'",
+			expected: &UpdateStatement{
+				Table: "users",
+				Set: map[string]interface{}{
+					"name": "x",
+				},
+				Where: types.And(
+					types.Condition("age", types.Comparison{Operator: ">", Value: int64(17)}),
+					types.Condition("name", "y"),
+				),
+			},
+		},
+		{
+			name:  "Update_with_negative_numbers",
+			input: "UPDATE accounts SET balance = -100, rate = -1.5 WHERE balance < -2.5",
+			expected: &UpdateStatement{
+				Table: "accounts",
+				Set: map[string]interface{}{
+					"balance": int64(-100),
+					"rate":    -1.5,
+				},
+				Where: types.Condition("balance", types.Comparison{Operator: "<", Value: -2.5}),
 			},
 		},
 	}
@@ -150,9 +506,39 @@ func TestParseDelete(t *testing.T) {
 			input: "DELETE FROM users WHERE id = 1",
 			expected: &DeleteStatement{
 				Table: "users",
-				Where: map[string]interface{}{
-					"id": float64(1),
-				},
+				Where: types.Condition("id", int64(1)),
+			},
+		},
+		{
+			name:  "Delete_with_or",
+			input: "DELETE FROM users WHERE id = 1 OR id = 2;",
+			expected: &DeleteStatement{
+				Table: "users",
+				Where: types.Or(types.Condition("id", int64(1)), types.Condition("id", int64(2))),
+			},
+		},
+		{
+			name:  "Delete_with_comparison",
+			input: "DELETE FROM users WHERE age <= 17",
+			expected: &DeleteStatement{
+				Table: "users",
+				Where: types.Condition("age", types.Comparison{Operator: "<=", Value: int64(17)}),
+			},
+		},
+		{
+			name:  "Delete_with_in",
+			input: "DELETE FROM users WHERE id IN (1, 3)",
+			expected: &DeleteStatement{
+				Table: "users",
+				Where: types.Condition("id", types.Comparison{Operator: "IN", Value: []interface{}{int64(1), int64(3)}}),
+			},
+		},
+		{
+			name:  "Delete_with_negative_number",
+			input: "DELETE FROM accounts WHERE balance = -100",
+			expected: &DeleteStatement{
+				Table: "accounts",
+				Where: types.Condition("balance", int64(-100)),
 			},
 		},
 	}
@@ -180,15 +566,121 @@ func TestParseCreate(t *testing.T) {
 			expected: &CreateStatement{
 				Table: "users",
 				Columns: []struct {
-					Name     string
-					Type     string
-					Nullable bool
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
 				}{
 					{Name: "id", Type: "INT", Nullable: true},
 					{Name: "name", Type: "STRING", Nullable: true},
 				},
 			},
 		},
+		{
+			name:  "Create_table_not_null",
+			input: "CREATE TABLE users (id INT NOT NULL, name STRING)",
+			expected: &CreateStatement{
+				Table: "users",
+				Columns: []struct {
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
+				}{
+					{Name: "id", Type: "INT", Nullable: false},
+					{Name: "name", Type: "STRING", Nullable: true},
+				},
+			},
+		},
+		{
+			name:  "Create_table_null",
+			input: "CREATE TABLE users (id INT NOT NULL, name STRING NULL)",
+			expected: &CreateStatement{
+				Table: "users",
+				Columns: []struct {
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
+				}{
+					{Name: "id", Type: "INT", Nullable: false},
+					{Name: "name", Type: "STRING", Nullable: true},
+				},
+			},
+		},
+		{
+			name:  "Create_table_primary_key",
+			input: "CREATE TABLE users (id INT PRIMARY KEY, name STRING)",
+			expected: &CreateStatement{
+				Table: "users",
+				Columns: []struct {
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
+				}{
+					{Name: "id", Type: "INT", PrimaryKey: true},
+					{Name: "name", Type: "STRING", Nullable: true},
+				},
+			},
+		},
+		{
+			name:  "Create_table_default",
+			input: "CREATE TABLE t (id INT, status STRING NOT NULL DEFAULT 'active', created INT DEFAULT 0, note STRING DEFAULT NULL)",
+			expected: &CreateStatement{
+				Table: "t",
+				Columns: []struct {
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
+				}{
+					{Name: "id", Type: "INT", Nullable: true},
+					{Name: "status", Type: "STRING", Default: "active"},
+					{Name: "created", Type: "INT", Nullable: true, Default: int64(0)},
+					{Name: "note", Type: "STRING", Nullable: true},
+				},
+			},
+		},
+		{
+			name:  "Create_table_if_not_exists",
+			input: "CREATE TABLE IF NOT EXISTS users (id INT)",
+			expected: &CreateStatement{
+				Table:       "users",
+				IfNotExists: true,
+				Columns: []struct {
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
+				}{
+					{Name: "id", Type: "INT", Nullable: true},
+				},
+			},
+		},
+		{
+			name:  "Create_table_with_float_columns",
+			input: "CREATE TABLE readings (price FLOAT, ratio double DEFAULT 0.5)",
+			expected: &CreateStatement{
+				Table: "readings",
+				Columns: []struct {
+					Name       string
+					Type       string
+					Nullable   bool
+					PrimaryKey bool
+					Default    interface{}
+				}{
+					{Name: "price", Type: "FLOAT", Nullable: true},
+					{Name: "ratio", Type: "FLOAT", Nullable: true, Default: 0.5},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -202,6 +694,238 @@ func TestParseCreate(t *testing.T) {
 	}
 }
 
+func TestParseAuditStatements(t *testing.T) {
+	stmt, err := Parse("ALTER TABLE accounts SET AUDIT = true;")
+	assert.NoError(t, err)
+	assert.Equal(t, "ALTER", stmt.Type)
+	assert.Equal(t, &AlterStatement{Table: "accounts", Option: "AUDIT", Value: true}, stmt.AlterStatement)
+
+	stmt, err = Parse("ALTER TABLE accounts SET AUDIT = false")
+	assert.NoError(t, err)
+	assert.Equal(t, false, stmt.AlterStatement.Value)
+
+	stmt, err = Parse("AUDIT LOG FOR accounts LIMIT 100;")
+	assert.NoError(t, err)
+	assert.Equal(t, "AUDIT", stmt.Type)
+	assert.Equal(t, &AuditStatement{Table: "accounts", Limit: 100}, stmt.AuditStatement)
+
+	stmt, err = Parse("AUDIT LOG FOR accounts")
+	assert.NoError(t, err)
+	assert.Equal(t, &AuditStatement{Table: "accounts"}, stmt.AuditStatement)
+}
+
+func TestParseAlterQuota(t *testing.T) {
+	stmt, err := Parse("ALTER TABLE logs SET MAX_ROWS = 1000000;")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "logs", Option: "MAX_ROWS", Value: int64(1000000)}, stmt.AlterStatement)
+
+	stmt, err = Parse("ALTER TABLE logs SET max_bytes = 4096 ON FULL DELETE OLDEST;")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "logs", Option: "MAX_BYTES", Value: int64(4096), OnFull: "DELETE OLDEST"}, stmt.AlterStatement)
+
+	stmt, err = Parse("ALTER TABLE logs SET MAX_ROWS = 0 ON FULL ERROR;")
+	assert.NoError(t, err)
+	assert.Equal(t, "ERROR", stmt.AlterStatement.OnFull)
+
+	_, err = Parse("ALTER TABLE logs SET MAX_ROWS = -1;")
+	assert.Error(t, err)
+	_, err = Parse("ALTER TABLE logs SET MAX_ROWS = 10 ON FULL DROP;")
+	assert.EqualError(t, err, "expected ERROR or DELETE OLDEST after ON FULL, got DROP")
+
+	// The quota is stored with the table and enforced on insert
+	s := storage.NewInMemoryStorage()
+	_, err = execSQL(t, NewSession(), s, "CREATE TABLE logs (id INT);")
+	assert.NoError(t, err)
+	stmt, err = Parse("ALTER TABLE logs SET MAX_ROWS = 1 ON FULL DELETE OLDEST;")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(s)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.TableQuota{MaxRows: 1, EvictOldest: true}, s.GetTable("logs").Quota)
+
+	stmt, err = Parse("ALTER TABLE logs SET MAX_BYTES = 100;")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(s)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.TableQuota{MaxRows: 1, MaxBytes: 100, EvictOldest: true}, s.GetTable("logs").Quota)
+}
+
+func TestParseTableSample(t *testing.T) {
+	stmt, err := Parse("SELECT * FROM events TABLESAMPLE (5 PERCENT) WHERE kind = 'click';")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.SampleSpec{Percent: 5}, stmt.SelectStatement.Sample)
+	assert.Equal(t, types.Condition("kind", "click"), stmt.SelectStatement.Where)
+
+	stmt, err = Parse("SELECT id FROM events TABLESAMPLE (1000 ROWS) REPEATABLE (42);")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.SampleSpec{Rows: 1000, Repeatable: true, Seed: 42}, stmt.SelectStatement.Sample)
+
+	_, err = Parse("SELECT * FROM events TABLESAMPLE (150 PERCENT);")
+	assert.EqualError(t, err, "TABLESAMPLE percent must be greater than 0 and at most 100, got 150")
+	_, err = Parse("SELECT * FROM events TABLESAMPLE (10 BLOCKS);")
+	assert.EqualError(t, err, "expected PERCENT or ROWS, got BLOCKS")
+	_, err = Parse("SELECT * FROM events TABLESAMPLE (0 ROWS);")
+	assert.EqualError(t, err, "TABLESAMPLE rows must be a positive integer, got 0")
+
+	// A repeatable sample returns the same rows every time
+	s := storage.NewInMemoryStorage()
+	_, err = execSQL(t, NewSession(), s, "CREATE TABLE events (id INT, kind STRING);")
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, s.Insert("events", map[string]interface{}{"id": i, "kind": "click"}))
+	}
+	first, err := execSQL(t, NewSession(), s, "SELECT id FROM events TABLESAMPLE (30 PERCENT) REPEATABLE (7);")
+	assert.NoError(t, err)
+	second, err := execSQL(t, NewSession(), s, "SELECT id FROM events TABLESAMPLE (30 PERCENT) REPEATABLE (7);")
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.InDelta(t, 30, len(first.([]types.Row)), 20)
+}
+
+func TestParseConcatenation(t *testing.T) {
+	stmt, err := Parse("SELECT first_name || ' ' || last_name AS full_name, id FROM users WHERE id || 'x' = '1x';")
+	assert.NoError(t, err)
+	sel := stmt.SelectStatement
+	assert.Equal(t, []string{"full_name", "id"}, sel.Columns)
+	assert.Equal(t, ConcatExpr{Operands: []interface{}{ColumnRef{Column: "first_name"}, " ", ColumnRef{Column: "last_name"}}}, sel.Exprs["full_name"])
+	assert.Equal(t, types.RowWhere(ConcatFilter{Expr: ConcatExpr{Operands: []interface{}{ColumnRef{Column: "id"}, "x"}}, Value: "1x"}), sel.Where)
+	assert.Equal(t, []string{"first_name", "last_name", "id"}, sel.sourceColumns())
+
+	_, err = Parse("SELECT a || FROM users;")
+	assert.EqualError(t, err, "expected a column or value in || expression, got FROM")
+	_, err = Parse("SELECT a || b AS FROM users;")
+	assert.EqualError(t, err, "expected column alias after AS, got FROM")
+}
+
+func TestParseAlterColumnType(t *testing.T) {
+	stmt, err := Parse("ALTER TABLE employees ALTER COLUMN id TYPE string;")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "employees", Option: "TYPE", Value: "STRING", Column: "id"}, stmt.AlterStatement)
+
+	stmt, err = Parse("ALTER TABLE employees ALTER code TYPE INT USING code;")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "employees", Option: "TYPE", Value: "INT", Column: "code", Using: true}, stmt.AlterStatement)
+
+	_, err = Parse("ALTER TABLE employees ALTER COLUMN code TYPE INT USING name;")
+	assert.EqualError(t, err, "USING supports only the column itself (USING code)")
+
+	s := storage.NewInMemoryStorage()
+	_, err = execSQL(t, NewSession(), s, "CREATE TABLE employees (id INT, code STRING);")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 1, "code": "42"}))
+
+	// Narrowing needs USING, and then every value must convert
+	stmt, err = Parse("ALTER TABLE employees ALTER COLUMN code TYPE INT;")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(s)
+	assert.EqualError(t, err, "changing column code from STRING to INT is a narrowing conversion; add USING code to convert and validate existing values")
+
+	stmt, err = Parse("ALTER TABLE employees ALTER COLUMN code TYPE INT USING code;")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(s)
+	assert.NoError(t, err)
+	rows, err := s.Select("employees", []string{"code"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), rows[0]["code"])
+
+	// Any type widens to STRING; other targets convert with USING
+	_, err = execSQL(t, NewSession(), s, "CREATE TABLE flags (ok BOOLEAN, qty INT);")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Insert("flags", map[string]interface{}{"ok": true, "qty": 2}))
+	_, err = execSQL(t, NewSession(), s, "ALTER TABLE flags ALTER COLUMN ok TYPE STRING;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, NewSession(), s, "ALTER TABLE flags ALTER COLUMN qty TYPE DOUBLE;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, NewSession(), s, "ALTER TABLE flags ALTER COLUMN ok TYPE BOOLEAN;")
+	assert.EqualError(t, err, "changing column ok from STRING to BOOLEAN is a narrowing conversion; add USING ok to convert and validate existing values")
+	rows, err = s.Select("flags", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"ok": "true", "qty": float64(2)}}, rows)
+
+	stmt, err = Parse("ALTER TABLE users ALTER COLUMN email SET MASKED USING 'Partial( 3 )';")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "users", Option: "MASK", Value: "partial(3)", Column: "email"}, stmt.AlterStatement)
+	stmt, err = Parse("ALTER TABLE users ALTER email DROP MASKED;")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "users", Option: "MASK", Value: "", Column: "email"}, stmt.AlterStatement)
+	_, err = Parse("ALTER TABLE users ALTER COLUMN email SET MASKED USING 'hash';")
+	assert.EqualError(t, err, `unknown masking policy "hash" (expected full or partial(n))`)
+
+	stmt, err = Parse("ALTER TABLE employees ALTER COLUMN salary TYPE TEXT;")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(s)
+	assert.EqualError(t, err, "column salary does not exist in table employees")
+}
+
+func TestParseAddColumn(t *testing.T) {
+	stmt, err := Parse("ALTER TABLE users ADD COLUMN phone string;")
+	assert.NoError(t, err)
+	assert.Equal(t, &AlterStatement{Table: "users", Option: "ADD", Column: "phone", Value: types.ColumnDefinition{Name: "phone", Type: "STRING", Nullable: true}}, stmt.AlterStatement)
+
+	stmt, err = Parse("ALTER TABLE users ADD level INT NOT NULL DEFAULT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, types.ColumnDefinition{Name: "level", Type: "INT", Default: int64(1)}, stmt.AlterStatement.Value)
+
+	_, err = Parse("ALTER TABLE users ADD COLUMN level INT DEFAULT 'one';")
+	assert.EqualError(t, err, "invalid DEFAULT one for INT column level")
+	_, err = Parse("ALTER TABLE users ADD COLUMN id INT PRIMARY KEY;")
+	assert.EqualError(t, err, "cannot add PRIMARY KEY column id to existing table users")
+	_, err = Parse("ALTER TABLE users ADD COLUMN phone STRING, email STRING;")
+	assert.EqualError(t, err, "unexpected , after ADD COLUMN")
+
+	// Old rows read the new column as NULL, or its DEFAULT
+	s := storage.NewInMemoryStorage()
+	session := NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT, name STRING);",
+		"INSERT INTO users VALUES (1, 'ann');",
+		"ALTER TABLE users ADD COLUMN phone STRING;",
+		"ALTER TABLE users ADD COLUMN level INT NOT NULL DEFAULT 1;",
+		"INSERT INTO users VALUES (2, 'bob', '555', 3);",
+	} {
+		_, err := execSQL(t, session, s, sql)
+		assert.NoError(t, err, sql)
+	}
+	result, err := execSQL(t, session, s, "SELECT id, phone, level FROM users WHERE phone IN ('555') OR level = 1;")
+	assert.NoError(t, err)
+	var got []string
+	for _, row := range result.([]types.Row) {
+		got = append(got, fmt.Sprint(row["id"], " ", row["phone"], " ", row["level"]))
+	}
+	assert.ElementsMatch(t, []string{"1 <nil> 1", "2 555 3"}, got)
+
+	_, err = execSQL(t, session, s, "ALTER TABLE users ADD COLUMN phone TEXT;")
+	assert.EqualError(t, err, "column phone already exists in table users")
+}
+
+func TestParseCheck(t *testing.T) {
+	stmt, err := Parse("CHECK TABLE employees;")
+	assert.NoError(t, err)
+	assert.Equal(t, "CHECK", stmt.Type)
+	assert.Equal(t, &CheckStatement{Table: "employees"}, stmt.CheckStatement)
+
+	stmt, err = Parse("CHECK TABLE employees REPAIR;")
+	assert.NoError(t, err)
+	assert.Equal(t, &CheckStatement{Table: "employees", Repair: true}, stmt.CheckStatement)
+
+	// Storages that validate every write do not support CHECK TABLE
+	_, err = stmt.Execute(storage.NewInMemoryStorage())
+	assert.EqualError(t, err, "CHECK TABLE is not supported by this storage backend")
+}
+
+func TestParseLoadFixture(t *testing.T) {
+	stmt, err := Parse("LOAD FIXTURE 'testdata/company.yaml';")
+	assert.NoError(t, err)
+	assert.Equal(t, "LOAD", stmt.Type)
+	assert.Equal(t, &LoadStatement{Path: "testdata/company.yaml"}, stmt.LoadStatement)
+
+	stmt, err = Parse("LOAD FIXTURE 'testdata/company.yaml' MERGE;")
+	assert.NoError(t, err)
+	assert.Equal(t, &LoadStatement{Path: "testdata/company.yaml", Merge: true}, stmt.LoadStatement)
+
+	_, err = Parse("LOAD FIXTURE company;")
+	assert.EqualError(t, err, "expected fixture path, got company")
+}
+
 func TestParserErrors(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -223,6 +947,161 @@ func TestParserErrors(t *testing.T) {
 			input:         "INSERT INTO users",
 			expectedError: "expected VALUES",
 		},
+		{
+			name:          "Insert_more_values_than_columns",
+			input:         "INSERT INTO users (id) VALUES (1, 'test')",
+			expectedError: "INSERT has 1 columns but 2 values",
+		},
+		{
+			name:          "Insert_fewer_values_than_columns",
+			input:         "INSERT INTO users (id, name) VALUES (1)",
+			expectedError: "INSERT has 2 columns but 1 values",
+		},
+		{
+			name:          "Join_condition_with_comparison",
+			input:         "UPDATE employees SET salary = r.amount FROM raises r WHERE employees.id < r.employee_id",
+			expectedError: "only = can compare columns",
+		},
+		{
+			name:          "Where_unclosed_group",
+			input:         "SELECT * FROM users WHERE (id = 1 OR id = 2",
+			expectedError: "expected ) in WHERE, got",
+		},
+		{
+			name:          "Where_trailing_and",
+			input:         "DELETE FROM users WHERE id = 1 AND",
+			expectedError: "expected column name, got",
+		},
+		{
+			name:          "Where_empty_in",
+			input:         "SELECT * FROM users WHERE id IN ()",
+			expectedError: "IN list is empty",
+		},
+		{
+			name:          "Where_in_without_parentheses",
+			input:         "DELETE FROM users WHERE id NOT IN 1",
+			expectedError: "expected ( after NOT IN, got 1",
+		},
+		{
+			name:          "Where_is_without_null",
+			input:         "UPDATE users SET name = 'x' WHERE email IS 5",
+			expectedError: "expected NULL after IS, got 5",
+		},
+		{
+			name:          "Where_unclosed_in",
+			input:         "SELECT * FROM users WHERE id IN (1, 2",
+			expectedError: "expected , or ) in IN list, got",
+		},
+		{
+			name:          "Not_before_join_condition",
+			input:         "UPDATE employees SET salary = r.new_salary FROM raises r WHERE id = 1 AND NOT (r.employee_id = employees.id AND id = 2)",
+			expectedError: "NOT cannot be applied to this condition",
+		},
+		{
+			name:          "Where_between_without_and",
+			input:         "SELECT * FROM users WHERE id BETWEEN 1 OR 2",
+			expectedError: "expected AND in BETWEEN, got OR",
+		},
+		{
+			name:          "Where_unknown_connective",
+			input:         "DELETE FROM users WHERE id = 1 XOR id = 2",
+			expectedError: "unexpected XOR in WHERE",
+		},
+		{
+			name:          "Join_condition_with_or",
+			input:         "UPDATE employees SET salary = r.amount FROM raises r WHERE employees.id = r.employee_id OR id = 1",
+			expectedError: "conditions on raises cannot be combined with OR",
+		},
+		{
+			name:          "Order_by_without_column",
+			input:         "SELECT * FROM employees ORDER BY 1",
+			expectedError: "expected column in ORDER BY",
+		},
+		{
+			name:          "Group_by_without_column",
+			input:         "SELECT COUNT(*) FROM employees GROUP BY 1",
+			expectedError: "expected column in GROUP BY",
+		},
+		{
+			name:          "Column_not_in_group_by",
+			input:         "SELECT department, name, COUNT(*) FROM employees GROUP BY department",
+			expectedError: "column name must appear in GROUP BY or be used in an aggregate function",
+		},
+		{
+			name:          "Create_table_two_primary_keys",
+			input:         "CREATE TABLE users (id INT PRIMARY KEY, email STRING PRIMARY KEY)",
+			expectedError: "table users has more than one primary key: id and email",
+		},
+		{
+			name:          "Create_table_primary_without_key",
+			input:         "CREATE TABLE users (id INT PRIMARY, name STRING)",
+			expectedError: "expected KEY, got ,",
+		},
+		{
+			name:          "Create_table_default_wrong_type",
+			input:         "CREATE TABLE t (id INT, created INT DEFAULT 'now')",
+			expectedError: "invalid DEFAULT now for INT column created",
+		},
+		{
+			name:          "Create_table_default_without_value",
+			input:         "CREATE TABLE t (id INT DEFAULT, name STRING)",
+			expectedError: "expected DEFAULT value, got ,",
+		},
+		{
+			name:          "Insert_trailing_comma",
+			input:         "INSERT INTO users VALUES (1, 'a'), (2, 'b'),",
+			expectedError: "VALUES row 3: expected (, got",
+		},
+		{
+			name:          "Insert_trailing_comma_in_tuple",
+			input:         "INSERT INTO users VALUES (1, 'a'), (2, )",
+			expectedError: "VALUES row 2: expected number or string, got )",
+		},
+		{
+			name:          "Insert_unclosed_tuple",
+			input:         "INSERT INTO users VALUES (1, 'a'), (2, 'b', (3, 'c')",
+			expectedError: "VALUES row 2: expected number or string, got (",
+		},
+		{
+			name:          "Insert_tuples_without_comma",
+			input:         "INSERT INTO users VALUES (1, 'a') (2, 'b')",
+			expectedError: "expected comma or end of INSERT after VALUES row 1, got (",
+		},
+		{
+			name:          "Insert_rows_of_different_lengths",
+			input:         "INSERT INTO users VALUES (1, 'a'), (2)",
+			expectedError: "VALUES row 2 has 1 values, expected 2",
+		},
+		{
+			name:          "Insert_row_without_listed_columns",
+			input:         "INSERT INTO users (id, name) VALUES (1, 'a'), (2)",
+			expectedError: "INSERT has 2 columns but 1 values",
+		},
+		{
+			name:          "Insert_duplicate_column",
+			input:         "INSERT INTO users (id, id) VALUES (1, 2)",
+			expectedError: "column id specified more than once",
+		},
+		{
+			name:          "Incomplete_if_not_exists",
+			input:         "CREATE TABLE IF EXISTS users (id INT)",
+			expectedError: "expected NOT",
+		},
+		{
+			name:          "Incomplete_not_null",
+			input:         "CREATE TABLE users (id INT NOT EXISTS)",
+			expectedError: "expected NULL",
+		},
+		{
+			name:          "Unsupported_table_option",
+			input:         "ALTER TABLE accounts SET COMPRESSION = true",
+			expectedError: "unsupported table option",
+		},
+		{
+			name:          "Invalid_audit_limit",
+			input:         "AUDIT LOG FOR accounts LIMIT many",
+			expectedError: "expected row count after LIMIT",
+		},
 	}
 
 	for _, tt := range tests {
@@ -233,3 +1112,39 @@ func TestParserErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestInsertColumnList(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING", Nullable: true},
+			{Name: "salary", Type: "INT", Nullable: true},
+		},
+	}))
+
+	exec := func(sql string) error {
+		stmt, err := Parse(sql)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Execute(s)
+		return err
+	}
+
+	// Out of order, with the unlisted nullable column set to NULL
+	assert.NoError(t, exec("INSERT INTO employees (salary, id) VALUES (90000, 1)"))
+	assert.NoError(t, exec("INSERT INTO employees VALUES (2, 'Bob')"))
+
+	rows, err := s.Select("employees", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{
+		{"id": int64(1), "name": nil, "salary": int64(90000)},
+		{"id": int64(2), "name": "Bob", "salary": nil},
+	}, rows)
+
+	assert.EqualError(t, exec("INSERT INTO employees (name) VALUES ('Alice')"), "missing required column id")
+	assert.EqualError(t, exec("INSERT INTO employees (id, bonus) VALUES (3, 10)"), "column bonus does not exist in table employees")
+	assert.EqualError(t, exec("INSERT INTO employees VALUES (3, 'Cy', 1, 2)"), "INSERT has 4 values but table employees has 3 columns")
+}
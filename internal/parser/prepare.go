@@ -0,0 +1,198 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// Prepared is a statement parsed once, with ? placeholders in place of
+// WHERE, VALUES, SET, LIMIT and OFFSET values, that can be executed many
+// times with different arguments and no quoting:
+//
+//	stmt, err := parser.Prepare("SELECT name FROM users WHERE id = ?")
+//	rows, err := stmt.ExecuteWith(storage, 42)
+type Prepared struct {
+	stmt         *Statement
+	placeholders int
+}
+
+// Prepare parses sql and counts its placeholders
+func Prepare(sql string) (*Prepared, error) {
+	stmt, err := Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	prepared := &Prepared{stmt: stmt}
+	_, err = resolver(func(value interface{}) (interface{}, error) {
+		if ph, ok := value.(Placeholder); ok && ph.Index > prepared.placeholders {
+			prepared.placeholders = ph.Index
+		}
+		return value, nil
+	}).statement(stmt)
+	return prepared, err
+}
+
+// NumPlaceholders returns the number of arguments ExecuteWith expects
+func (p *Prepared) NumPlaceholders() int {
+	return p.placeholders
+}
+
+// Bind returns a copy of the statement with each placeholder replaced by
+// the argument at its position. Arguments are checked against the types of
+// the columns they are compared with or assigned to, if storage knows the
+// table; a string for an INT column, for instance, is rejected rather than
+// converted.
+func (p *Prepared) Bind(storage types.Storage, args ...interface{}) (*Statement, error) {
+	if len(args) != p.placeholders {
+		return nil, fmt.Errorf("statement has %d placeholders, got %d arguments", p.placeholders, len(args))
+	}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		val, err := bindValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		values[i] = val
+	}
+	if err := p.checkArgs(storage, args, values); err != nil {
+		return nil, err
+	}
+	return resolver(func(value interface{}) (interface{}, error) {
+		if ph, ok := value.(Placeholder); ok {
+			return values[ph.Index-1], nil
+		}
+		return value, nil
+	}).statement(p.stmt)
+}
+
+// ExecuteWith binds args to the placeholders and runs the statement
+func (p *Prepared) ExecuteWith(storage types.Storage, args ...interface{}) (interface{}, error) {
+	bound, err := p.Bind(storage, args...)
+	if err != nil {
+		return nil, err
+	}
+	return bound.Execute(storage)
+}
+
+// bindValue converts an argument to the value a literal in the SQL text
+// would have parsed to: integers are int64, other numbers float64, and
+// times the canonical TIMESTAMP string in UTC
+func bindValue(arg interface{}) (interface{}, error) {
+	switch v := arg.(type) {
+	case nil, string, bool, int64, float64:
+		return arg, nil
+	case time.Time:
+		return v.UTC().Format(types.TimestampLayout), nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint:
+		return bindUint(uint64(v))
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return bindUint(v)
+	}
+	return nil, fmt.Errorf("unsupported argument type %T", arg)
+}
+
+func bindUint(v uint64) (interface{}, error) {
+	if v > math.MaxInt64 {
+		return nil, fmt.Errorf("argument %d is out of range for INT", v)
+	}
+	return int64(v), nil
+}
+
+// checkArgs rejects arguments whose type does not match the column their
+// placeholder stands for. values are the arguments converted by bindValue;
+// a time bound to a DATE column is narrowed to its date in its own zone.
+func (p *Prepared) checkArgs(storage types.Storage, args, values []interface{}) error {
+	var table string
+	var where *types.WhereExpr
+	var assigned []map[string]interface{}
+	switch p.stmt.Type {
+	case "SELECT":
+		table, where = p.stmt.SelectStatement.Table, p.stmt.SelectStatement.Where
+	case "UPDATE":
+		upd := p.stmt.UpdateStatement
+		table, where, assigned = upd.Table, upd.Where, []map[string]interface{}{upd.Set}
+	case "DELETE":
+		table, where = p.stmt.DeleteStatement.Table, p.stmt.DeleteStatement.Where
+	case "INSERT":
+		table = p.stmt.InsertStatement.Table
+	}
+	def := storage.GetTable(table)
+	if def == nil {
+		return nil // let the storage report the missing table
+	}
+	if p.stmt.Type == "INSERT" {
+		rows, err := p.stmt.InsertStatement.TableRows(def)
+		if err != nil {
+			return err
+		}
+		assigned = rows
+	}
+
+	columns := make(map[int]string)
+	for _, cond := range where.Conditions() {
+		if cond.Row == nil {
+			placeholderColumn(cond.Column, cond.Value, columns)
+		}
+	}
+	for _, m := range assigned {
+		for col, val := range m {
+			placeholderColumn(col, val, columns)
+		}
+	}
+	defs := make(map[string]types.ColumnDefinition, len(def.Columns))
+	for _, col := range def.Columns {
+		defs[col.Name] = col
+	}
+	for i, arg := range args {
+		col, ok := defs[columns[i+1]]
+		if !ok {
+			continue
+		}
+		if t, isTime := arg.(time.Time); isTime && col.Type == "DATE" {
+			values[i] = t.Format(types.DateLayout)
+		}
+		if err := types.CheckValueType(col.Name, col.Type, values[i], true); err != nil {
+			return fmt.Errorf("argument %d: column %s is %s, got %T %v", i+1, col.Name, col.Type, arg, arg)
+		}
+	}
+	return nil
+}
+
+// placeholderColumn records col as the column of the placeholders in val,
+// a value given for col in a WHERE condition, SET or VALUES
+func placeholderColumn(col string, val interface{}, columns map[int]string) {
+	switch v := val.(type) {
+	case Placeholder:
+		columns[v.Index] = col
+	case types.Comparison:
+		if ph, ok := v.Value.(Placeholder); ok {
+			columns[ph.Index] = col
+		}
+		if list, ok := v.Value.([]interface{}); ok {
+			for _, item := range list {
+				if ph, ok := item.(Placeholder); ok {
+					columns[ph.Index] = col
+				}
+			}
+		}
+	}
+}
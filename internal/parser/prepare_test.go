@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestPrepare(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	_, err := execSQL(t, NewSession(), store, "CREATE TABLE users (id INT, name STRING, level INT);")
+	assert.NoError(t, err)
+
+	insert, err := Prepare("INSERT INTO users (id, name, level) VALUES (?, ?, 1), (?, ?, 2);")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, insert.NumPlaceholders())
+	_, err = insert.ExecuteWith(store, 1, "Ann", 2, "O'Brien")
+	assert.NoError(t, err)
+	_, err = insert.ExecuteWith(store, int64(3), "Cy", uint8(4), "Dee")
+	assert.NoError(t, err)
+
+	// The same statement runs with each id
+	sel, err := Prepare("SELECT name FROM users WHERE id = ?;")
+	assert.NoError(t, err)
+	for id, name := range map[int]string{1: "Ann", 2: "O'Brien", 3: "Cy", 4: "Dee"} {
+		result, err := sel.ExecuteWith(store, id)
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"name": name}}, result, "id %d", id)
+	}
+
+	// Placeholders in comparisons and OR
+	sel, err = Prepare("SELECT COUNT(*) AS n FROM users WHERE level >= ? AND (name = ? OR id > ?);")
+	assert.NoError(t, err)
+	result, err := sel.ExecuteWith(store, 1, "Ann", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"n": 2}}, result)
+
+	update, err := Prepare("UPDATE users SET name = ? WHERE id = ?;")
+	assert.NoError(t, err)
+	_, err = update.ExecuteWith(store, "Bea", 2)
+	assert.NoError(t, err)
+	rows, err := store.Select("users", []string{"name"}, types.WhereAll(map[string]interface{}{"id": float64(2)}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Bea"}}, rows)
+
+	del, err := Prepare("DELETE FROM users WHERE id = ?;")
+	assert.NoError(t, err)
+	_, err = del.ExecuteWith(store, 4)
+	assert.NoError(t, err)
+	rows, err = store.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	// Argument count and types are checked before anything runs
+	_, err = sel.ExecuteWith(store, 1)
+	assert.EqualError(t, err, "statement has 3 placeholders, got 1 arguments")
+	byID, err := Prepare("SELECT name FROM users WHERE id = ?;")
+	assert.NoError(t, err)
+	_, err = byID.ExecuteWith(store, "1 OR 1 = 1")
+	assert.EqualError(t, err, "argument 1: column id is INT, got string 1 OR 1 = 1")
+	_, err = insert.ExecuteWith(store, 5, "Eve", "6", "Flo")
+	assert.EqualError(t, err, "argument 3: column id is INT, got string 6")
+	_, err = byID.ExecuteWith(store, struct{}{})
+	assert.EqualError(t, err, "argument 1: unsupported argument type struct {}")
+	rows, err = store.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	// LIMIT and OFFSET take placeholders too
+	page, err := Prepare("SELECT id FROM users WHERE level >= ? ORDER BY id LIMIT ? OFFSET ?;")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, page.NumPlaceholders())
+	result, err = page.ExecuteWith(store, 1, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(2)}}, result)
+	_, err = page.ExecuteWith(store, 1, -1, 0)
+	assert.EqualError(t, err, "LIMIT must be a non-negative integer, got -1")
+	_, err = page.ExecuteWith(store, 1, 1, "1")
+	assert.EqualError(t, err, "OFFSET must be a non-negative integer, got 1")
+	_, err = page.stmt.Execute(store)
+	assert.EqualError(t, err, "LIMIT ? is not bound")
+
+	// A session cannot run a statement with unbound placeholders
+	stmt, err := Parse("SELECT name FROM users WHERE id = ?;")
+	assert.NoError(t, err)
+	_, err = NewSession().Execute(stmt, store)
+	assert.EqualError(t, err, "placeholder 1 is not bound; prepare the statement to pass arguments")
+}
@@ -0,0 +1,433 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// Session holds per-connection state such as user-defined @variables and
+// settings. Each client (REPL, piped script) gets its own Session, so
+// variables set in one are never visible in another.
+type Session struct {
+	vars map[string]interface{}
+
+	// strict rejects values that would be silently coerced to their column
+	// type (SET sql_strict = true)
+	strict bool
+
+	// showMasked returns masked columns unmasked (SET show_masked_data =
+	// true), which is only allowed if allowUnmasked is set
+	showMasked    bool
+	allowUnmasked bool
+
+	// tx buffers the writes made between BEGIN and COMMIT or ROLLBACK
+	tx types.Transaction
+}
+
+// NewSession creates an empty session
+func NewSession() *Session {
+	return &Session{
+		vars: make(map[string]interface{}),
+	}
+}
+
+// Get returns the value of a session variable. Names are case-insensitive.
+func (s *Session) Get(name string) (interface{}, bool) {
+	val, ok := s.vars[strings.ToLower(name)]
+	return val, ok
+}
+
+// Set assigns a value to a session variable
+func (s *Session) Set(name string, value interface{}) {
+	s.vars[strings.ToLower(name)] = value
+}
+
+// Strict reports whether sql_strict is enabled for the session
+func (s *Session) Strict() bool {
+	return s.strict
+}
+
+// applySetting changes a session setting such as sql_strict
+func (s *Session) applySetting(name string, value interface{}) error {
+	switch strings.ToLower(name) {
+	case "sql_strict":
+		switch v := value.(type) {
+		case bool:
+			s.strict = v
+		case int64:
+			s.strict = v != 0
+		default:
+			return fmt.Errorf("sql_strict expects true or false, got %v", value)
+		}
+		return nil
+	case "show_masked_data":
+		show, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("show_masked_data expects true or false, got %v", value)
+		}
+		if show && !s.allowUnmasked {
+			return fmt.Errorf("show_masked_data requires the server to be started with --allow-unmasked")
+		}
+		s.showMasked = show
+		return nil
+	default:
+		return fmt.Errorf("unknown setting %s", name)
+	}
+}
+
+// AllowUnmasked lets the session turn off column masking with SET
+// show_masked_data = true
+func (s *Session) AllowUnmasked(allow bool) {
+	s.allowUnmasked = allow
+	if !allow {
+		s.showMasked = false
+	}
+}
+
+// MaskRows applies the masking policies of table to SELECT results, unless
+// the session shows masked data. Masks apply to results only; WHERE sees
+// the stored values.
+func (s *Session) MaskRows(storage types.Storage, table string, rows []types.Row) []types.Row {
+	if s.showMasked {
+		return rows
+	}
+	return types.MaskRows(storage.GetTable(table), rows)
+}
+
+// CheckCoercions rejects INSERT and UPDATE values that only fit their
+// column through a silent type conversion when sql_strict is enabled.
+// stmt must already be bound.
+func (s *Session) CheckCoercions(stmt *Statement, storage types.Storage) error {
+	if !s.strict {
+		return nil
+	}
+
+	var table string
+	switch stmt.Type {
+	case "INSERT":
+		table = stmt.InsertStatement.Table
+	case "UPDATE":
+		table = stmt.UpdateStatement.Table
+	default:
+		return nil
+	}
+
+	def := storage.GetTable(table)
+	if def == nil {
+		return nil // let the storage report the missing table
+	}
+	var rows []map[string]interface{}
+	if stmt.Type == "INSERT" {
+		var err error
+		if rows, err = stmt.InsertStatement.TableRows(def); err != nil {
+			return err
+		}
+	} else {
+		rows = []map[string]interface{}{stmt.UpdateStatement.Set}
+	}
+	for _, values := range rows {
+		for _, col := range def.Columns {
+			val, ok := values[col.Name]
+			if _, isRef := val.(ColumnRef); !ok || isRef {
+				continue // values read from an UPDATE ... FROM source are checked by the storage
+			}
+			if err := types.CheckValueType(col.Name, col.Type, val, true); err != nil {
+				return fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolver replaces a leaf value of a statement, such as a Variable, and
+// returns other values unchanged
+type resolver func(value interface{}) (interface{}, error)
+
+// value resolves a value, alone or compared in a WHERE condition
+func (r resolver) value(value interface{}) (interface{}, error) {
+	if c, ok := value.(types.Comparison); ok {
+		if list, ok := c.Value.([]interface{}); ok {
+			resolved := make([]interface{}, len(list))
+			for i, item := range list {
+				var err error
+				if resolved[i], err = r(item); err != nil {
+					return nil, err
+				}
+			}
+			return types.Comparison{Operator: c.Operator, Value: resolved}, nil
+		}
+		val, err := r.value(c.Value)
+		return types.Comparison{Operator: c.Operator, Value: val}, err
+	}
+	return r(value)
+}
+
+// where resolves the values of the conditions of a WHERE clause, including
+// those of its concatenations
+func (r resolver) where(where *types.WhereExpr) (*types.WhereExpr, error) {
+	return where.Rewrite(func(cond *types.WhereExpr) (*types.WhereExpr, error) {
+		if f, ok := cond.Row.(ConcatFilter); ok {
+			expr, err := r.expr(f.Expr)
+			if err != nil {
+				return nil, err
+			}
+			val, err := r.value(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			return types.RowWhere(ConcatFilter{Expr: expr, Value: val}), nil
+		}
+		if cond.Row != nil {
+			return cond, nil
+		}
+		val, err := r.value(cond.Value)
+		if err != nil {
+			return nil, err
+		}
+		return types.Condition(cond.Column, val), nil
+	})
+}
+
+func (r resolver) values(m map[string]interface{}) (map[string]interface{}, error) {
+	if m == nil {
+		return nil, nil
+	}
+	resolved := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		val, err := r.value(v)
+		if err != nil {
+			return nil, err
+		}
+		resolved[k] = val
+	}
+	return resolved, nil
+}
+
+// expr returns a copy of a concatenation with its operands resolved
+func (r resolver) expr(expr ConcatExpr) (ConcatExpr, error) {
+	operands := make([]interface{}, len(expr.Operands))
+	for i, op := range expr.Operands {
+		val, err := r.value(op)
+		if err != nil {
+			return expr, err
+		}
+		operands[i] = val
+	}
+	return ConcatExpr{Operands: operands}, nil
+}
+
+// exprs replaces the computed columns of sel with copies in which values
+// are resolved
+func (r resolver) exprs(sel *SelectStatement) error {
+	if sel.Exprs != nil {
+		exprs := make(map[string]ConcatExpr, len(sel.Exprs))
+		for name, expr := range sel.Exprs {
+			resolved, err := r.expr(expr)
+			if err != nil {
+				return err
+			}
+			exprs[name] = resolved
+		}
+		sel.Exprs = exprs
+	}
+	return nil
+}
+
+// selectStatement returns a copy of sel, and of its CTEs, with every value
+// resolved
+func (r resolver) selectStatement(stmt *SelectStatement) (*SelectStatement, error) {
+	var err error
+	sel := *stmt
+	if sel.Where, err = r.where(sel.Where); err != nil {
+		return nil, err
+	}
+	if err := r.exprs(&sel); err != nil {
+		return nil, err
+	}
+	if err := r.bindLimit(&sel); err != nil {
+		return nil, err
+	}
+	if sel.With != nil {
+		sel.With = make([]CTE, len(stmt.With))
+		for i, cte := range stmt.With {
+			cteSel := *cte.Select
+			if cteSel.Where, err = r.where(cteSel.Where); err != nil {
+				return nil, err
+			}
+			if err := r.exprs(&cteSel); err != nil {
+				return nil, err
+			}
+			if err := r.bindLimit(&cteSel); err != nil {
+				return nil, err
+			}
+			sel.With[i] = CTE{Name: cte.Name, Select: &cteSel}
+		}
+	}
+	return &sel, nil
+}
+
+// statement returns a copy of stmt with every value resolved, leaving stmt
+// untouched
+func (r resolver) statement(stmt *Statement) (*Statement, error) {
+	bound := *stmt
+	var err error
+
+	switch stmt.Type {
+	case "SELECT":
+		if bound.SelectStatement, err = r.selectStatement(stmt.SelectStatement); err != nil {
+			return nil, err
+		}
+	case "EXPORT":
+		export := *stmt.ExportStatement
+		if export.Select, err = r.selectStatement(export.Select); err != nil {
+			return nil, err
+		}
+		bound.ExportStatement = &export
+	case "EXPLAIN":
+		explain := *stmt.ExplainStatement
+		if explain.Statement, err = r.statement(explain.Statement); err != nil {
+			return nil, err
+		}
+		bound.ExplainStatement = &explain
+	case "INSERT":
+		ins := *stmt.InsertStatement
+		ins.Rows = make([]map[string]interface{}, len(stmt.InsertStatement.Rows))
+		for i, row := range stmt.InsertStatement.Rows {
+			if ins.Rows[i], err = r.values(row); err != nil {
+				return nil, err
+			}
+		}
+		bound.InsertStatement = &ins
+	case "UPDATE":
+		upd := *stmt.UpdateStatement
+		if upd.Set, err = r.values(upd.Set); err != nil {
+			return nil, err
+		}
+		if upd.Where, err = r.where(upd.Where); err != nil {
+			return nil, err
+		}
+		if upd.From != nil {
+			from := *upd.From
+			if from.Where, err = r.where(from.Where); err != nil {
+				return nil, err
+			}
+			upd.From = &from
+		}
+		bound.UpdateStatement = &upd
+	case "DELETE":
+		del := *stmt.DeleteStatement
+		if del.Where, err = r.where(del.Where); err != nil {
+			return nil, err
+		}
+		bound.DeleteStatement = &del
+	case "SET":
+		set := *stmt.SetStatement
+		if set.Value, err = r.value(set.Value); err != nil {
+			return nil, err
+		}
+		bound.SetStatement = &set
+	}
+
+	return &bound, nil
+}
+
+// variable returns the current value of a Variable; other values are
+// returned unchanged. Placeholders are only bound by a Prepared statement.
+func (s *Session) variable(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case Variable:
+		val, ok := s.Get(v.Name)
+		if !ok {
+			return nil, fmt.Errorf("undefined variable @%s", v.Name)
+		}
+		return val, nil
+	case Placeholder:
+		return nil, fmt.Errorf("placeholder %d is not bound; prepare the statement to pass arguments", v.Index)
+	}
+	return value, nil
+}
+
+// resolve replaces a Variable, alone or compared in a WHERE condition,
+// with its current value; other values are returned unchanged.
+func (s *Session) resolve(value interface{}) (interface{}, error) {
+	return resolver(s.variable).value(value)
+}
+
+// Bind returns a copy of stmt with every variable reference replaced by its
+// current value in the session. The original statement is left untouched so
+// it can be bound again after the variables change.
+func (s *Session) Bind(stmt *Statement) (*Statement, error) {
+	return resolver(s.variable).statement(stmt)
+}
+
+// Execute binds stmt against the session and runs it. SET statements update
+// the session, and a SELECT without a FROM clause (SELECT @dept) returns the
+// requested variables as a single row. Between BEGIN and COMMIT or
+// ROLLBACK, statements run against the session's transaction instead of
+// storage.
+func (s *Session) Execute(stmt *Statement, storage types.Storage) (interface{}, error) {
+	bound, err := s.Bind(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch bound.Type {
+	case "BEGIN", "COMMIT", "ROLLBACK":
+		return nil, s.transaction(bound.Type, storage)
+	case "SET":
+		if bound.SetStatement.Setting {
+			return nil, s.applySetting(bound.SetStatement.Name, bound.SetStatement.Value)
+		}
+		s.Set(bound.SetStatement.Name, bound.SetStatement.Value)
+		return nil, nil
+	case "SELECT":
+		if bound.SelectStatement.Table == "" {
+			return s.selectVariables(bound.SelectStatement.Columns)
+		}
+	}
+
+	if s.tx != nil {
+		storage = s.tx
+	}
+	if err := bound.CheckSupported(storage.Capabilities()); err != nil {
+		return nil, err
+	}
+	if err := s.CheckCoercions(bound, storage); err != nil {
+		return nil, err
+	}
+
+	mask := func(table string, rows []types.Row) []types.Row {
+		return s.MaskRows(storage, table, rows)
+	}
+	switch bound.Type {
+	case "SELECT":
+		return bound.SelectStatement.execute(storage, mask)
+	case "EXPORT":
+		return bound.ExportStatement.execute(storage, mask)
+	case "UPDATE":
+		if bound.UpdateStatement.From != nil {
+			return bound.UpdateStatement.executeFrom(storage, mask)
+		}
+	}
+	return bound.Execute(storage)
+}
+
+func (s *Session) selectVariables(columns []string) ([]types.Row, error) {
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("expected FROM")
+	}
+	row := make(types.Row, len(columns))
+	for _, col := range columns {
+		if !strings.HasPrefix(col, "@") {
+			return nil, fmt.Errorf("column %s requires a FROM clause", col)
+		}
+		val, err := s.resolve(Variable{Name: col[1:]})
+		if err != nil {
+			return nil, err
+		}
+		row[col] = val
+	}
+	return []types.Row{row}, nil
+}
@@ -0,0 +1,1150 @@
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func execSQL(t *testing.T, session *Session, store types.Storage, sql string) (interface{}, error) {
+	t.Helper()
+	stmt, err := Parse(sql)
+	if !assert.NoError(t, err, "failed to parse %q", sql) {
+		t.FailNow()
+	}
+	return session.Execute(stmt, store)
+}
+
+// execAll runs each statement of sqls in order, failing the test on an
+// error
+func execAll(t *testing.T, session *Session, store types.Storage, sqls ...string) {
+	t.Helper()
+	for _, sql := range sqls {
+		_, err := execSQL(t, session, store, sql)
+		assert.NoError(t, err, sql)
+	}
+}
+
+// forEachStorage runs fn as a subtest on each of an empty InMemory, JSON
+// and BTree storage, so that statements behave the same on all of them
+func forEachStorage(t *testing.T, fn func(t *testing.T, store types.Storage)) {
+	t.Helper()
+	dir := t.TempDir()
+	btree, err := storage.NewBTreeStorage(filepath.Join(dir, "test.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer btree.Close()
+	jsonStore, err := storage.NewJSONStorage(dir, "test")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for _, tc := range []struct {
+		name  string
+		store types.Storage
+	}{
+		{"InMemory", storage.NewInMemoryStorage()},
+		{"JSON", jsonStore},
+		{"BTree", btree},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fn(t, tc.store)
+		})
+	}
+}
+
+func TestSessionVariables(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	err := store.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING"},
+			{Name: "department", Type: "STRING"},
+		},
+	})
+	assert.NoError(t, err)
+	for _, row := range []map[string]interface{}{
+		{"id": float64(1), "name": "Ann", "department": "Engineering"},
+		{"id": float64(2), "name": "Bob", "department": "Sales"},
+		{"id": float64(3), "name": "Cid", "department": "Engineering"},
+	} {
+		assert.NoError(t, store.Insert("employees", row))
+	}
+
+	session := NewSession()
+
+	// Definition
+	_, err = execSQL(t, session, store, "SET @dept = 'Engineering'")
+	assert.NoError(t, err)
+	val, ok := session.Get("dept")
+	assert.True(t, ok)
+	assert.Equal(t, "Engineering", val)
+
+	// SELECT @var returns a single row
+	result, err := execSQL(t, session, store, "SELECT @dept")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"@dept": "Engineering"}}, result)
+
+	// Use in WHERE across statements
+	result, err = execSQL(t, session, store, "SELECT * FROM employees WHERE department = @dept")
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	// Use in SET assignments and UPDATE/DELETE WHERE
+	_, err = execSQL(t, session, store, "SET @newdept = 'Research'")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "UPDATE employees SET department = @newdept WHERE department = @dept")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT * FROM employees WHERE department = @newdept")
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	_, err = execSQL(t, session, store, "SET @id = 2")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "DELETE FROM employees WHERE id = @id")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT * FROM employees")
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	// Use in INSERT values
+	stmt, err := Parse("INSERT INTO employees VALUES (@id, 'Dee', @dept)")
+	assert.NoError(t, err)
+	bound, err := session.Bind(stmt)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{
+		"column1": int64(2),
+		"column2": "Dee",
+		"column3": "Engineering",
+	}}, bound.InsertStatement.Rows)
+	assert.Equal(t, Variable{Name: "id"}, stmt.InsertStatement.Rows[0]["column1"], "Bind must not modify the parsed statement")
+
+	// Reassignment is visible to later statements
+	_, err = execSQL(t, session, store, "SET @dept = @newdept")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT @dept")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"@dept": "Research"}}, result)
+}
+
+func TestSessionUndefinedVariable(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+
+	_, err := execSQL(t, session, store, "SELECT * FROM employees WHERE department = @missing")
+	assert.EqualError(t, err, "undefined variable @missing")
+
+	_, err = execSQL(t, session, store, "SELECT @missing")
+	assert.EqualError(t, err, "undefined variable @missing")
+}
+
+func TestSessionIsolation(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	first := NewSession()
+	second := NewSession()
+
+	_, err := execSQL(t, first, store, "SET @dept = 'Engineering'")
+	assert.NoError(t, err)
+	_, err = execSQL(t, second, store, "SET @dept = 'Sales'")
+	assert.NoError(t, err)
+
+	result, err := execSQL(t, first, store, "SELECT @dept")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"@dept": "Engineering"}}, result)
+
+	result, err = execSQL(t, second, store, "SELECT @dept")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"@dept": "Sales"}}, result)
+
+	_, err = execSQL(t, NewSession(), store, "SELECT @dept")
+	assert.EqualError(t, err, "undefined variable @dept")
+}
+
+func TestSessionStrictMode(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	assert.NoError(t, store.CreateTable(&types.Table{
+		Name: "addresses",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", Nullable: true},
+			{Name: "zip", Type: "STRING", Nullable: true},
+		},
+	}))
+	assert.NoError(t, store.Insert("addresses", map[string]interface{}{"id": 1, "zip": "02134"}))
+
+	session := NewSession()
+	assert.False(t, session.Strict())
+
+	// Lenient: a numeric zip code is accepted
+	_, err := execSQL(t, session, store, "UPDATE addresses SET zip = 2134 WHERE id = 1")
+	assert.NoError(t, err)
+
+	_, err = execSQL(t, session, store, "SET sql_strict = true")
+	assert.NoError(t, err)
+	assert.True(t, session.Strict())
+
+	_, err = execSQL(t, session, store, "UPDATE addresses SET zip = 2134 WHERE id = 1")
+	var coercion *types.CoercionError
+	assert.ErrorAs(t, err, &coercion)
+	assert.Contains(t, err.Error(), "column zip expects STRING")
+
+	stmt, err := Parse("INSERT INTO addresses VALUES ('7', '02134')")
+	assert.NoError(t, err)
+	err = session.CheckCoercions(stmt, store)
+	if assert.ErrorAs(t, err, &coercion) {
+		assert.Equal(t, "id", coercion.Column)
+		assert.Equal(t, "7", coercion.Value)
+	}
+
+	_, err = execSQL(t, session, store, "UPDATE addresses SET zip = '02134' WHERE id = 1")
+	assert.NoError(t, err)
+
+	// Strictness is per session
+	_, err = execSQL(t, NewSession(), store, "UPDATE addresses SET zip = 2134 WHERE id = 1")
+	assert.NoError(t, err)
+
+	_, err = execSQL(t, session, store, "SET sql_strict = false")
+	assert.NoError(t, err)
+	assert.False(t, session.Strict())
+
+	_, err = execSQL(t, session, store, "SET no_such_setting = 1")
+	assert.EqualError(t, err, "unknown setting no_such_setting")
+}
+
+func TestSessionColumnMasking(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE users (id INT, email STRING, token STRING);")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Insert("users", map[string]interface{}{"id": 1, "email": "abcdef@example.com", "token": "s3cr3t"}))
+	assert.NoError(t, store.Insert("users", map[string]interface{}{"id": 2, "email": "xy@example.com"}))
+
+	_, err = execSQL(t, session, store, "ALTER TABLE users ALTER COLUMN email SET MASKED USING 'partial(3)';")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "ALTER TABLE users ALTER COLUMN token SET MASKED;")
+	assert.NoError(t, err)
+	assert.Equal(t, "partial(3)", store.GetTable("users").Columns[1].Mask)
+
+	// WHERE matches the stored value; the result is masked
+	result, err := execSQL(t, session, store, "SELECT * FROM users WHERE email = 'abcdef@example.com';")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1), "email": "abc*****@*****", "token": "*****"}}, result)
+
+	result, err = execSQL(t, session, store, "WITH u AS (SELECT email FROM users WHERE id = 2) SELECT * FROM u;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"email": "xy*****@*****"}}, result)
+
+	// Expressions see the masked value
+	result, err = execSQL(t, session, store, "SELECT email || '!' AS e FROM users WHERE id = 2;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"e": "xy*****@*****!"}}, result)
+
+	// MIN and MAX return a stored value, so it is masked too
+	result, err = execSQL(t, session, store, "SELECT MIN(email) AS lo, MAX(email) AS hi, COUNT(token) AS n FROM users;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"lo": "abc*****@*****", "hi": "xy*****@*****", "n": 1}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT id, MAX(token) AS t FROM users GROUP BY id ORDER BY id;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1), "t": "*****"}, {"id": int64(2), "t": nil}}, result)
+
+	// Only sessions of a server that allows it may turn masking off
+	_, err = execSQL(t, session, store, "SET show_masked_data = true;")
+	assert.EqualError(t, err, "show_masked_data requires the server to be started with --allow-unmasked")
+	session.AllowUnmasked(true)
+	_, err = execSQL(t, session, store, "SET show_masked_data = true;")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT token FROM users WHERE id = 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"token": "s3cr3t"}}, result)
+
+	// Other sessions still see masked data
+	result, err = execSQL(t, NewSession(), store, "SELECT token FROM users WHERE id = 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"token": "*****"}}, result)
+
+	_, err = execSQL(t, session, store, "ALTER TABLE users ALTER COLUMN token DROP MASKED;")
+	assert.NoError(t, err)
+	result, err = execSQL(t, NewSession(), store, "SELECT token FROM users WHERE id = 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"token": "s3cr3t"}}, result)
+}
+
+func TestSessionConcatenation(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE users (id INT, first_name STRING, last_name STRING);")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Insert("users", map[string]interface{}{"id": 1, "first_name": "Ada", "last_name": "Lovelace"}))
+	assert.NoError(t, store.Insert("users", map[string]interface{}{"id": 2, "first_name": "Grace"}))
+
+	result, err := execSQL(t, session, store, "SELECT id, first_name || ' ' || last_name AS full_name FROM users WHERE id = 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1), "full_name": "Ada Lovelace"}}, result)
+
+	// NULL || anything is NULL
+	result, err = execSQL(t, session, store, "SELECT first_name || last_name AS name FROM users WHERE id = 2;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": nil}}, result)
+
+	// Numbers are concatenated in their string form; without an alias the
+	// column is named after the expression
+	_, err = execSQL(t, session, store, "SET @sep = '-';")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT 'user' || @sep || id FROM users WHERE first_name = 'Ada';")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"'user' || @sep || id": "user-1"}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT id FROM users WHERE first_name || last_name = 'AdaLovelace';")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1)}}, result)
+
+	result, err = execSQL(t, session, store, "WITH named AS (SELECT id, first_name || '!' AS greeting FROM users) SELECT greeting FROM named WHERE id = 2;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"greeting": "Grace!"}}, result)
+}
+
+func TestSessionAggregates(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE visits (id INT, visitor STRING, page STRING);")
+	assert.NoError(t, err)
+	const visitors = 100000
+	for i := 0; i < visitors; i++ {
+		assert.NoError(t, store.Insert("visits", map[string]interface{}{"id": i, "visitor": fmt.Sprintf("v%d", i), "page": "home"}))
+	}
+	assert.NoError(t, store.Insert("visits", map[string]interface{}{"id": visitors, "visitor": "v1", "page": "about"}))
+	assert.NoError(t, store.Insert("visits", map[string]interface{}{"id": visitors + 1, "page": "about"}))
+
+	result, err := execSQL(t, session, store, "SELECT COUNT(*) AS total, COUNT(visitor), COUNT(DISTINCT visitor) AS exact, APPROX_COUNT_DISTINCT(visitor) AS approx FROM visits;")
+	assert.NoError(t, err)
+	row := result.([]types.Row)[0]
+	assert.Equal(t, visitors+2, row["total"])
+	assert.Equal(t, visitors+1, row["COUNT(visitor)"])
+	assert.Equal(t, visitors, row["exact"])
+	// The sketch's standard error is about 0.8%
+	assert.InEpsilon(t, visitors, row["approx"], 0.03)
+
+	result, err = execSQL(t, session, store, "SELECT COUNT(DISTINCT visitor) AS exact, APPROX_COUNT_DISTINCT(visitor) AS approx FROM visits WHERE page = 'about';")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"exact": 1, "approx": int64(1)}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT COUNT(*) FROM visits WHERE page = 'about';")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"COUNT(*)": 2}}, result)
+
+	_, err = Parse("SELECT page, COUNT(*) FROM visits;")
+	assert.EqualError(t, err, "column page must appear in GROUP BY or be used in an aggregate function")
+	_, err = Parse("SELECT APPROX_COUNT_DISTINCT(*) FROM visits;")
+	assert.EqualError(t, err, "expected column in APPROX_COUNT_DISTINCT, got *")
+}
+
+func TestSessionComparisons(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE employees (name STRING, salary INT);",
+		"INSERT INTO employees VALUES ('Ann', 70000);",
+		"INSERT INTO employees VALUES ('Bob', 85000);",
+		"INSERT INTO employees VALUES ('Cy', 90000);",
+		"SET @floor = 80000;",
+	)
+
+	for sql, want := range map[string]int{
+		"SELECT name FROM employees WHERE salary > 85000;":   1,
+		"SELECT name FROM employees WHERE salary >= 85000;":  2,
+		"SELECT name FROM employees WHERE salary < 85000;":   1,
+		"SELECT name FROM employees WHERE salary <= 85000;":  2,
+		"SELECT name FROM employees WHERE salary != 85000;":  2,
+		"SELECT name FROM employees WHERE salary <> 85000;":  2,
+		"SELECT name FROM employees WHERE name < 'Bob';":     1,
+		"SELECT name FROM employees WHERE salary >= @floor;": 2,
+	} {
+		result, err := execSQL(t, session, store, sql)
+		assert.NoError(t, err, sql)
+		assert.Len(t, result, want, sql)
+	}
+
+	_, err := execSQL(t, session, store, "UPDATE employees SET salary = 80000 WHERE salary < 80000;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "DELETE FROM employees WHERE salary > 85000;")
+	assert.NoError(t, err)
+	result, err := execSQL(t, session, store, "SELECT name FROM employees WHERE salary >= 80000;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Ann"}, {"name": "Bob"}}, result)
+}
+
+func TestSessionDistinct(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE employees (name STRING, department STRING, code STRING);")
+	assert.NoError(t, err)
+	// Lenient mode stores numbers in STRING columns as strings
+	for _, row := range []map[string]interface{}{
+		{"name": "Ann", "department": "Engineering", "code": 1},
+		{"name": "Bob", "department": "Sales", "code": float64(1)},
+		{"name": "Cy", "department": "Engineering", "code": "1"},
+		{"name": "Dee", "department": "Sales"},
+		{"name": "Eve", "department": "Engineering"},
+	} {
+		assert.NoError(t, store.Insert("employees", row))
+	}
+
+	result, err := execSQL(t, session, store, "SELECT DISTINCT department FROM employees;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"department": "Engineering"}, {"department": "Sales"}}, result)
+
+	// int(1), float64(1) and '1' are all stored as the string '1'
+	result, err = execSQL(t, session, store, "SELECT DISTINCT code FROM employees;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"code": "1"}, {"code": nil}}, result)
+
+	// Rows are distinct over every selected column
+	result, err = execSQL(t, session, store, "SELECT DISTINCT department, code FROM employees WHERE name != 'Eve' ORDER BY department;")
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+}
+
+func TestSessionDistinctStar(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE visits (id INT, page STRING);",
+			"INSERT INTO visits VALUES (1, 'home'), (1, 'home'), (2, 'home'), (1, 'about'), (2, 'home');",
+		)
+
+		result, err := execSQL(t, session, store, "SELECT DISTINCT * FROM visits;")
+		assert.NoError(t, err)
+		assert.Len(t, result, 3)
+
+		result, err = execSQL(t, session, store, "SELECT DISTINCT * FROM visits WHERE page = 'home' ORDER BY id;")
+		assert.NoError(t, err)
+		rows := result.([]types.Row)
+		if assert.Len(t, rows, 2) {
+			assert.Equal(t, int64(1), rows[0]["id"])
+			assert.Equal(t, int64(2), rows[1]["id"])
+		}
+
+		result, err = execSQL(t, session, store, "SELECT DISTINCT id FROM visits LIMIT 5;")
+		assert.NoError(t, err)
+		assert.Len(t, result, 2)
+	})
+
+	// Numbers are equal by value, whatever their Go type
+	assert.Len(t, types.DistinctRows([]types.Row{{"id": 1, "page": "home"}, {"id": float64(1), "page": "home"}}), 1)
+}
+
+func TestSessionLimit(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE logs (id INT, level STRING);")
+	assert.NoError(t, err)
+	for i := 1; i <= 50; i++ {
+		assert.NoError(t, store.Insert("logs", map[string]interface{}{"id": i, "level": []string{"info", "error"}[i%2]}))
+	}
+	ids := func(result interface{}) []interface{} {
+		var ids []interface{}
+		for _, row := range result.([]types.Row) {
+			ids = append(ids, row["id"])
+		}
+		return ids
+	}
+
+	result, err := execSQL(t, session, store, "SELECT * FROM logs LIMIT 10 OFFSET 20;")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(21), int64(22), int64(23), int64(24), int64(25), int64(26), int64(27), int64(28), int64(29), int64(30)}, ids(result))
+
+	result, err = execSQL(t, session, store, "SELECT id FROM logs LIMIT 3;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT * FROM logs LIMIT 0;")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	result, err = execSQL(t, session, store, "SELECT * FROM logs LIMIT 10 OFFSET 50;")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	// The limit applies after WHERE, ORDER BY and DISTINCT
+	result, err = execSQL(t, session, store, "SELECT id FROM logs WHERE level = 'error' ORDER BY id DESC LIMIT 2 OFFSET 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(47), int64(45)}, ids(result))
+
+	result, err = execSQL(t, session, store, "SELECT DISTINCT level FROM logs ORDER BY level OFFSET 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"level": "info"}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT COUNT(id) FROM logs LIMIT 0;")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	// LIMIT and OFFSET take variables, checked when the statement is bound
+	_, err = execSQL(t, session, store, "SET @n = 2;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "SET @skip = 4;")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT id FROM logs LIMIT @n OFFSET @skip;")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(5), int64(6)}, ids(result))
+	for sql, want := range map[string]string{
+		"SET @n = -1;":  "LIMIT must be a non-negative integer, got -1",
+		"SET @n = 'a';": "LIMIT must be a non-negative integer, got a",
+		"SET @n = 1.5;": "LIMIT must be a non-negative integer, got 1.5",
+	} {
+		_, err = execSQL(t, session, store, sql)
+		assert.NoError(t, err, sql)
+		_, err = execSQL(t, session, store, "SELECT id FROM logs LIMIT @n;")
+		assert.EqualError(t, err, want, sql)
+	}
+	_, err = execSQL(t, session, store, "SELECT id FROM logs OFFSET @missing;")
+	assert.EqualError(t, err, "undefined variable @missing")
+}
+
+func TestSessionCount(t *testing.T) {
+	// Every storage is counted the same way, by the statement
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE employees (id INT, department STRING);",
+			"INSERT INTO employees VALUES (1, 'Engineering'), (2, 'Engineering'), (3, 'Sales');",
+		)
+
+		result, err := execSQL(t, session, store, "SELECT COUNT(*) FROM employees;")
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"COUNT(*)": 3}}, result)
+
+		result, err = execSQL(t, session, store, "SELECT COUNT(department) AS staffed FROM employees WHERE id != 1;")
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"staffed": 2}}, result)
+
+		result, err = execSQL(t, session, store, "SELECT COUNT(*) FROM employees WHERE department = 'Marketing';")
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"COUNT(*)": 0}}, result)
+	})
+}
+
+func TestSessionNumericAggregates(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE employees (name STRING, department STRING, salary INT);",
+			"INSERT INTO employees VALUES ('Ann', 'Engineering', 90000), ('Bob', 'Engineering', 75000), ('Cy', 'Sales', 60000);",
+			"INSERT INTO employees (name, department) VALUES ('Dee', 'Sales');",
+		)
+
+		// NULL is skipped
+		result, err := execSQL(t, session, store, "SELECT SUM(salary) AS sum, AVG(salary) AS avg, MIN(salary), MAX(salary), MIN(name) FROM employees;")
+		assert.NoError(t, err)
+		row := result.([]types.Row)[0]
+		assert.Equal(t, 225000, row["sum"])
+		assert.Equal(t, float64(75000), row["avg"])
+		assert.Equal(t, int64(60000), row["MIN(salary)"])
+		assert.Equal(t, int64(90000), row["MAX(salary)"])
+		assert.Equal(t, "Ann", row["MIN(name)"])
+
+		result, err = execSQL(t, session, store, "SELECT AVG(salary) AS avg, MAX(salary) AS max FROM employees WHERE department = 'Engineering';")
+		assert.NoError(t, err)
+		row = result.([]types.Row)[0]
+		assert.Equal(t, float64(82500), row["avg"])
+		assert.Equal(t, int64(90000), row["max"])
+
+		// Over no rows the aggregates are NULL rather than a division by zero
+		result, err = execSQL(t, session, store, "SELECT SUM(salary), AVG(salary), MIN(salary) FROM employees WHERE department = 'Marketing';")
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"SUM(salary)": nil, "AVG(salary)": nil, "MIN(salary)": nil}}, result)
+
+		_, err = execSQL(t, session, store, "SELECT SUM(name) FROM employees;")
+		assert.EqualError(t, err, "SUM(name): column name is STRING, not a numeric column")
+	})
+}
+
+func TestSessionNotNull(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		_, err := execSQL(t, session, store, "CREATE TABLE users (id INT NOT NULL, name STRING NULL, email STRING);")
+		assert.NoError(t, err)
+		columns := store.GetTable("users").Columns
+		assert.False(t, columns[0].Nullable)
+		assert.True(t, columns[1].Nullable)
+		assert.True(t, columns[2].Nullable)
+
+		_, err = execSQL(t, session, store, "INSERT INTO users VALUES (1, NULL, 'a@example.com');")
+		assert.NoError(t, err)
+		_, err = execSQL(t, session, store, "INSERT INTO users (name) VALUES ('Bob');")
+		assert.EqualError(t, err, "missing required column id")
+		_, err = execSQL(t, session, store, "INSERT INTO users VALUES (NULL, 'Bob', NULL);")
+		assert.EqualError(t, err, "NULL value not allowed for non-nullable column id")
+
+		result, err := execSQL(t, session, store, "SELECT * FROM users;")
+		assert.NoError(t, err)
+		if rows := result.([]types.Row); assert.Len(t, rows, 1) {
+			assert.Equal(t, int64(1), rows[0]["id"])
+			assert.Nil(t, rows[0]["name"])
+		}
+	})
+}
+
+func TestSessionDefault(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		_, err := execSQL(t, session, store, "CREATE TABLE t (id INT, status STRING NOT NULL DEFAULT 'active', created INT DEFAULT 0);")
+		assert.NoError(t, err)
+		assert.Equal(t, "active", store.GetTable("t").Columns[1].Default)
+
+		_, err = execSQL(t, session, store, "INSERT INTO t (id) VALUES (1);")
+		assert.NoError(t, err)
+		_, err = execSQL(t, session, store, "INSERT INTO t (id, status, created) VALUES (2, 'closed', NULL);")
+		assert.NoError(t, err)
+		// Storage inserts fill in defaults too
+		assert.NoError(t, store.Insert("t", map[string]interface{}{"id": 3, "created": 7}))
+
+		result, err := execSQL(t, session, store, "SELECT * FROM t ORDER BY id;")
+		assert.NoError(t, err)
+		if rows := result.([]types.Row); assert.Len(t, rows, 3) {
+			assert.Equal(t, "active", rows[0]["status"])
+			assert.Equal(t, int64(0), rows[0]["created"])
+			assert.Equal(t, "closed", rows[1]["status"])
+			assert.Nil(t, rows[1]["created"])
+			assert.Equal(t, "active", rows[2]["status"])
+			assert.Equal(t, int64(7), rows[2]["created"])
+		}
+	})
+}
+
+func TestSessionTransaction(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE accounts (id INT PRIMARY KEY, balance INT);",
+		"INSERT INTO accounts VALUES (1, 100), (2, 50);",
+	)
+
+	stmt, err := Parse("BEGIN;")
+	assert.NoError(t, err)
+	assert.NoError(t, stmt.CheckSupported(store.Capabilities()))
+	assert.ErrorIs(t, stmt.CheckSupported(types.Capabilities{}), types.ErrNotSupported)
+
+	// A rollback after a failed statement leaves the database unchanged
+	_, err = execSQL(t, session, store, "BEGIN;")
+	assert.NoError(t, err)
+	assert.True(t, session.InTransaction())
+	_, err = execSQL(t, session, store, "UPDATE accounts SET balance = 70 WHERE id = 1;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "INSERT INTO accounts VALUES (3, 10), (1, 30);")
+	assert.EqualError(t, err, "row 2: duplicate primary key id = 1 in table accounts")
+	result, err := execSQL(t, session, store, "SELECT balance FROM accounts WHERE id = 1;")
+	assert.NoError(t, err)
+	if rows := result.([]types.Row); assert.Len(t, rows, 1) {
+		assert.Equal(t, int64(70), rows[0]["balance"])
+	}
+	_, err = execSQL(t, session, store, "ROLLBACK;")
+	assert.NoError(t, err)
+	assert.False(t, session.InTransaction())
+	result, err = execSQL(t, session, store, "SELECT id, balance FROM accounts ORDER BY id;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1), "balance": int64(100)}, {"id": int64(2), "balance": int64(50)}}, result)
+
+	// Committed writes become visible to the storage together
+	_, err = execSQL(t, session, store, "BEGIN;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "UPDATE accounts SET balance = 80 WHERE id = 1;")
+	assert.NoError(t, err)
+	_, err = execSQL(t, session, store, "UPDATE accounts SET balance = 70 WHERE id = 2;")
+	assert.NoError(t, err)
+	rows, err := store.Select("accounts", []string{"balance"}, types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"balance": int64(100)}}, rows)
+	_, err = execSQL(t, session, store, "CREATE TABLE logs (id INT);")
+	assert.EqualError(t, err, "CREATE TABLE is not supported inside a transaction")
+	_, err = execSQL(t, session, store, "BEGIN;")
+	assert.EqualError(t, err, "a transaction is already in progress")
+	_, err = execSQL(t, session, store, "COMMIT;")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT id, balance FROM accounts ORDER BY id;")
+	assert.NoError(t, err)
+	if rows := result.([]types.Row); assert.Len(t, rows, 2) {
+		assert.Equal(t, int64(80), rows[0]["balance"])
+		assert.Equal(t, int64(70), rows[1]["balance"])
+	}
+
+	_, err = execSQL(t, session, store, "COMMIT;")
+	assert.EqualError(t, err, "COMMIT without a transaction in progress")
+}
+
+func TestSessionLike(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE users (id INT, name STRING);",
+			"INSERT INTO users VALUES (1, 'Alice'), (2, 'Alfred'), (3, 'Bob'), (12, 'Carla'), (5, 'a.c'), (6, NULL);",
+		)
+
+		for sql, want := range map[string][]string{
+			"SELECT id FROM users WHERE name LIKE 'Al%';":     {"1", "2"},
+			"SELECT id FROM users WHERE name LIKE '%a';":      {"12"},
+			"SELECT id FROM users WHERE name LIKE '%l_c%';":   {"1"},
+			"SELECT id FROM users WHERE name LIKE 'a.c';":     {"5"},
+			"SELECT id FROM users WHERE name LIKE 'a_c';":     {"5"},
+			"SELECT id FROM users WHERE name NOT LIKE '%l%';": {"3", "5"},
+			"SELECT id FROM users WHERE id LIKE '1%';":        {"1", "12"},
+		} {
+			result, err := execSQL(t, session, store, sql)
+			if !assert.NoError(t, err, sql) {
+				continue
+			}
+			var ids []string
+			for _, row := range result.([]types.Row) {
+				ids = append(ids, fmt.Sprint(row["id"]))
+			}
+			assert.ElementsMatch(t, want, ids, sql)
+		}
+	})
+}
+
+func TestSessionNegativeNumbers(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE accounts (id INT, balance INT, rate FLOAT);",
+		"INSERT INTO accounts VALUES (1, -100, -0.5), (2, 250, 1.25), (3, -7, -2);",
+	)
+
+	// Negative literals match stored INT and FLOAT values, whatever the
+	// form of the literal
+	for sql, want := range map[string][]string{
+		"SELECT id FROM accounts WHERE balance = -100;":   {"1"},
+		"SELECT id FROM accounts WHERE balance = -100.0;": {"1"},
+		"SELECT id FROM accounts WHERE balance < -50;":    {"1"},
+		"SELECT id FROM accounts WHERE rate = -2;":        {"3"},
+		"SELECT id FROM accounts WHERE rate >= -0.5;":     {"1", "2"},
+	} {
+		result, err := execSQL(t, session, store, sql)
+		if !assert.NoError(t, err, sql) {
+			continue
+		}
+		var ids []string
+		for _, row := range result.([]types.Row) {
+			ids = append(ids, fmt.Sprint(row["id"]))
+		}
+		assert.ElementsMatch(t, want, ids, sql)
+	}
+
+	result, err := execSQL(t, session, store, "UPDATE accounts SET balance = -1 WHERE rate < 0;")
+	assert.NoError(t, err)
+	assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+	result, err = execSQL(t, session, store, "DELETE FROM accounts WHERE balance = -1;")
+	assert.NoError(t, err)
+	assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+}
+
+func TestSessionNull(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE employees (id INT, department STRING, salary INT);",
+			"INSERT INTO employees VALUES (1, 'Engineering', 100), (2, NULL, 80), (3, 'Sales', NULL);",
+			"INSERT INTO employees (id) VALUES (4);",
+		)
+
+		for sql, want := range map[string][]string{
+			"SELECT id FROM employees WHERE department IS NULL;":                   {"2", "4"},
+			"SELECT id FROM employees WHERE department IS NOT NULL;":               {"1", "3"},
+			"SELECT id FROM employees WHERE NOT (salary IS NULL);":                 {"1", "2"},
+			"SELECT id FROM employees WHERE salary IS NULL OR department IS NULL;": {"2", "3", "4"},
+			"SELECT id FROM employees WHERE department = 'NULL';":                  nil,
+		} {
+			result, err := execSQL(t, session, store, sql)
+			if !assert.NoError(t, err, sql) {
+				continue
+			}
+			var ids []string
+			for _, row := range result.([]types.Row) {
+				ids = append(ids, fmt.Sprint(row["id"]))
+			}
+			assert.ElementsMatch(t, want, ids, sql)
+		}
+
+		// Aggregates skip NULLs
+		result, err := execSQL(t, session, store, "SELECT COUNT(*), COUNT(salary), SUM(salary) FROM employees;")
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"COUNT(*)": 4, "COUNT(salary)": 2, "SUM(salary)": 180}}, result)
+
+		result, err = execSQL(t, session, store, "UPDATE employees SET department = 'Unassigned' WHERE department IS NULL;")
+		assert.NoError(t, err)
+		assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+		result, err = execSQL(t, session, store, "DELETE FROM employees WHERE salary IS NULL;")
+		assert.NoError(t, err)
+		assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+	})
+}
+
+func TestSessionIn(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE employees (id INT, department STRING);",
+			"INSERT INTO employees VALUES (1, 'Engineering'), (2, 'Marketing'), (3, 'Sales'), (4, NULL);",
+		)
+
+		for sql, want := range map[string][]string{
+			"SELECT id FROM employees WHERE department IN ('Engineering','Marketing');": {"1", "2"},
+			"SELECT id FROM employees WHERE department NOT IN ('Engineering');":         {"2", "3"},
+			"SELECT id FROM employees WHERE id IN (1, 3, 5);":                           {"1", "3"},
+			"SELECT id FROM employees WHERE id NOT IN (1, 3);":                          {"2", "4"},
+			"SELECT id FROM employees WHERE id IN (7, 8);":                              nil,
+			"SELECT id FROM employees WHERE department IN ('HR');":                      nil,
+		} {
+			result, err := execSQL(t, session, store, sql)
+			if !assert.NoError(t, err, sql) {
+				continue
+			}
+			var ids []string
+			for _, row := range result.([]types.Row) {
+				ids = append(ids, fmt.Sprint(row["id"]))
+			}
+			assert.ElementsMatch(t, want, ids, sql)
+		}
+
+		result, err := execSQL(t, session, store, "DELETE FROM employees WHERE id IN (2, 4);")
+		assert.NoError(t, err)
+		assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+	})
+
+	// Placeholders and variables in the list are bound one by one
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE users (id INT, name STRING);",
+		"INSERT INTO users VALUES (1, 'Ann'), (2, 'Bob'), (3, 'Cy');",
+		"SET @first = 1;",
+	)
+	result, err := execSQL(t, session, store, "SELECT name FROM users WHERE id IN (@first, 2) ORDER BY name;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Ann"}, {"name": "Bob"}}, result)
+	sel, err := Prepare("SELECT name FROM users WHERE id IN (?, ?);")
+	assert.NoError(t, err)
+	result, err = sel.ExecuteWith(store, 3, 9)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "Cy"}}, result)
+	_, err = sel.ExecuteWith(store, 3, "x")
+	assert.EqualError(t, err, "argument 2: column id is INT, got string x")
+}
+
+func TestSessionBetween(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE employees (id INT, name STRING, salary INT);",
+			"INSERT INTO employees VALUES (1, 'Ann', 79999), (2, 'Bob', 80000), (3, 'Cy', 90000), (4, 'Dee', 95000), (5, 'Eve', 95001), (6, 'Fay', NULL);",
+		)
+
+		for sql, want := range map[string][]string{
+			"SELECT id FROM employees WHERE salary BETWEEN 80000 AND 95000;":             {"2", "3", "4"},
+			"SELECT id FROM employees WHERE salary BETWEEN 80000 AND 95000 AND id != 3;": {"2", "4"},
+			"SELECT id FROM employees WHERE salary BETWEEN 95000 AND 80000;":             nil,
+			"SELECT id FROM employees WHERE name BETWEEN 'B' AND 'D';":                   {"2", "3"},
+			"SELECT id FROM employees WHERE id = 1 OR salary BETWEEN 95000 AND 99999;":   {"1", "4", "5"},
+			"SELECT id FROM employees WHERE salary BETWEEN 100000 AND 200000;":           nil,
+		} {
+			result, err := execSQL(t, session, store, sql)
+			if !assert.NoError(t, err, sql) {
+				continue
+			}
+			var ids []string
+			for _, row := range result.([]types.Row) {
+				ids = append(ids, fmt.Sprint(row["id"]))
+			}
+			assert.ElementsMatch(t, want, ids, sql)
+		}
+
+		result, err := execSQL(t, session, store, "DELETE FROM employees WHERE salary BETWEEN 80000 AND 90000;")
+		assert.NoError(t, err)
+		assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+	})
+}
+
+func TestSessionNotAndNestedOr(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE t (id INT, a INT, b INT, c INT, name STRING);",
+			"INSERT INTO t VALUES (1, 1, 0, 3, 'Ann'), (2, 0, 2, 3, 'Bob'), (3, 1, 2, 0, 'Cy'), (4, 0, 0, 3, 'Dee'), (5, NULL, 2, 3, NULL);",
+		)
+
+		for sql, want := range map[string][]string{
+			"SELECT id FROM t WHERE (a = 1 OR b = 2) AND c = 3;":              {"1", "2", "5"},
+			"SELECT id FROM t WHERE c = 3 AND (a = 1 OR (b = 2 AND id > 2));": {"1", "5"},
+			"SELECT id FROM t WHERE NOT a = 1;":                               {"2", "4"},
+			"SELECT id FROM t WHERE NOT (a = 1 OR b = 2);":                    {"4"},
+			"SELECT id FROM t WHERE NOT (a = 1 AND b = 2);":                   {"1", "2", "4"},
+			"SELECT id FROM t WHERE NOT NOT a = 1;":                           {"1", "3"},
+			"SELECT id FROM t WHERE NOT id BETWEEN 2 AND 4;":                  {"1", "5"},
+			"SELECT id FROM t WHERE NOT name LIKE 'B%' AND NOT id IN (1, 3);": {"4"},
+			"SELECT id FROM t WHERE c = 3 AND NOT (id < 3 OR a = 0);":         nil,
+			"SELECT id FROM t WHERE name || '!' = 'Bob!' OR a = 1;":           {"1", "2", "3"},
+			"SELECT id FROM t WHERE NOT name || '!' = 'Ann!';":                {"2", "3", "4"},
+		} {
+			result, err := execSQL(t, session, store, sql)
+			if !assert.NoError(t, err, sql) {
+				continue
+			}
+			var ids []string
+			for _, row := range result.([]types.Row) {
+				ids = append(ids, fmt.Sprint(row["id"]))
+			}
+			assert.ElementsMatch(t, want, ids, sql)
+		}
+
+		result, err := execSQL(t, session, store, "DELETE FROM t WHERE NOT (a = 0 OR c = 0);")
+		assert.NoError(t, err)
+		assert.Equal(t, ExecResult{RowsAffected: 1}, result)
+	})
+}
+
+func TestSessionRowsAffected(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		_, err := execSQL(t, session, store, "CREATE TABLE users (id INT, name STRING);")
+		assert.NoError(t, err)
+
+		for _, tt := range []struct {
+			sql      string
+			affected int
+		}{
+			{"INSERT INTO users VALUES (1, 'Ann'), (2, 'Bob'), (3, 'Cy');", 3},
+			{"UPDATE users SET name = 'x' WHERE id >= 2;", 2},
+			{"UPDATE users SET name = 'y' WHERE id = 1;", 1},
+			{"UPDATE users SET name = 'z' WHERE id = 9;", 0},
+			{"DELETE FROM users WHERE id = 9;", 0},
+			{"DELETE FROM users WHERE name = 'x';", 2},
+		} {
+			result, err := execSQL(t, session, store, tt.sql)
+			assert.NoError(t, err, tt.sql)
+			assert.Equal(t, ExecResult{RowsAffected: tt.affected}, result, tt.sql)
+		}
+
+		result, err := execSQL(t, session, store, "SELECT id, name FROM users;")
+		assert.NoError(t, err)
+		if rows := result.([]types.Row); assert.Len(t, rows, 1) {
+			assert.Equal(t, int64(1), rows[0]["id"])
+			assert.Equal(t, "y", rows[0]["name"])
+		}
+	})
+}
+
+func TestSessionGroupBy(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE employees (name STRING, department STRING, level INT, salary INT);",
+		"INSERT INTO employees VALUES ('Ann', 'Engineering', 3, 90000), ('Bob', 'Engineering', 2, 75000), ('Cy', 'Sales', 2, 60000);",
+		"INSERT INTO employees (name, department) VALUES ('Dee', 'Sales');",
+		"INSERT INTO employees (name, level, salary) VALUES ('Eve', 3, 50000);",
+	)
+	// A float64 level is stored as an INT like the others
+	assert.NoError(t, store.Insert("employees", map[string]interface{}{"name": "Flo", "department": "Sales", "level": float64(3), "salary": 70000}))
+
+	result, err := execSQL(t, session, store, "SELECT department, COUNT(*), AVG(salary) FROM employees GROUP BY department ORDER BY department;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{
+		{"department": "Engineering", "COUNT(*)": 2, "AVG(salary)": float64(82500)},
+		{"department": "Sales", "COUNT(*)": 3, "AVG(salary)": float64(65000)},
+		{"department": nil, "COUNT(*)": 1, "AVG(salary)": float64(50000)},
+	}, result)
+
+	// Flo's level, inserted as float64 3, is in the group of level 3
+	result, err = execSQL(t, session, store, "SELECT level, COUNT(*) AS n FROM employees WHERE salary > 0 GROUP BY level ORDER BY n DESC;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"level": int64(3), "n": 3}, {"level": int64(2), "n": 2}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT department, level FROM employees WHERE level = 2 GROUP BY department, level;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"department": "Engineering", "level": int64(2)}, {"department": "Sales", "level": int64(2)}}, result)
+
+	result, err = execSQL(t, session, store, "SELECT department, MAX(salary) AS max FROM employees GROUP BY department ORDER BY max DESC LIMIT 1;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"department": "Engineering", "max": int64(90000)}}, result)
+
+	// No rows means no groups
+	result, err = execSQL(t, session, store, "SELECT department, COUNT(*) FROM employees WHERE level > 5 GROUP BY department;")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+
+	// Group values are masked; aggregates see stored values
+	_, err = execSQL(t, session, store, "ALTER TABLE employees ALTER COLUMN department SET MASKED USING 'partial(2)';")
+	assert.NoError(t, err)
+	result, err = execSQL(t, session, store, "SELECT department, COUNT(DISTINCT department) AS n FROM employees WHERE level = 2 GROUP BY department ORDER BY department;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"department": "En*****", "n": 1}, {"department": "Sa*****", "n": 1}}, result)
+
+	_, err = execSQL(t, session, store, "SELECT COUNT(*) FROM employees GROUP BY division;")
+	assert.EqualError(t, err, "GROUP BY column division does not exist in table employees")
+	_, err = execSQL(t, session, store, "SELECT department, COUNT(*) FROM employees GROUP BY department ORDER BY salary;")
+	assert.EqualError(t, err, "ORDER BY column salary must appear in GROUP BY or be used in an aggregate function")
+}
+
+func TestSessionAndOr(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, store types.Storage) {
+		session := NewSession()
+		execAll(t, session, store,
+			"CREATE TABLE employees (id INT, department STRING, salary INT);",
+			"INSERT INTO employees VALUES (1, 'Engineering', 90000), (2, 'Engineering', 75000), (3, 'Sales', 85000), (4, 'Sales', 60000);",
+			"SET @dept = 'Sales';",
+		)
+
+		// ids returns the ids a query selects, in order
+		ids := func(sql string) string {
+			result, err := execSQL(t, session, store, sql)
+			assert.NoError(t, err, sql)
+			var ids []string
+			for _, row := range result.([]types.Row) {
+				ids = append(ids, fmt.Sprint(row["id"]))
+			}
+			return strings.Join(ids, " ")
+		}
+		for sql, want := range map[string]string{
+			"SELECT id FROM employees WHERE department = 'Engineering' AND salary > 80000 ORDER BY id;":                           "1",
+			"SELECT id FROM employees WHERE id = 1 OR id = 2 ORDER BY id;":                                                        "1 2",
+			"SELECT id FROM employees WHERE salary > 70000 AND salary < 88000 ORDER BY id;":                                       "2 3",
+			"SELECT id FROM employees WHERE department = 'Sales' OR department = 'Engineering' AND salary > 80000 ORDER BY id;":   "1 3 4",
+			"SELECT id FROM employees WHERE (department = 'Sales' OR department = 'Engineering') AND salary > 80000 ORDER BY id;": "1 3",
+			"SELECT id FROM employees WHERE department = @dept OR id = 1 ORDER BY id;":                                            "1 3 4",
+		} {
+			assert.Equal(t, want, ids(sql), sql)
+		}
+
+		_, err := execSQL(t, session, store, "UPDATE employees SET salary = 0 WHERE id = 2 OR id = 4;")
+		assert.NoError(t, err)
+		_, err = execSQL(t, session, store, "DELETE FROM employees WHERE salary = 0 AND department = 'Sales' OR id = 1;")
+		assert.NoError(t, err)
+		assert.Equal(t, "2 3", ids("SELECT id FROM employees ORDER BY id;"))
+	})
+}
+
+func TestSessionOrderBy(t *testing.T) {
+	forEachStorage(t, testOrderBy)
+}
+
+func testOrderBy(t *testing.T, store types.Storage) {
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE employees (name STRING, salary INT, code STRING);")
+	assert.NoError(t, err)
+	for _, row := range []map[string]interface{}{
+		{"name": "Cy", "salary": 90000, "code": "10"},
+		{"name": "Ann", "salary": 100000, "code": "9"},
+		{"name": "Bob", "salary": 90000, "code": "x"},
+		{"name": "Dee", "code": 2},
+	} {
+		assert.NoError(t, store.Insert("employees", row))
+	}
+
+	names := func(sql string) []interface{} {
+		result, err := execSQL(t, session, store, sql)
+		assert.NoError(t, err, sql)
+		var names []interface{}
+		for _, row := range result.([]types.Row) {
+			names = append(names, row["name"])
+		}
+		return names
+	}
+
+	// Numbers compare numerically and ties on the first key are broken by
+	// the next. NULL sorts last ascending and first descending.
+	assert.Equal(t, []interface{}{"Bob", "Cy", "Ann", "Dee"}, names("SELECT name FROM employees ORDER BY salary, name;"))
+	assert.Equal(t, []interface{}{"Dee", "Ann", "Bob", "Cy"}, names("SELECT name FROM employees ORDER BY salary DESC, name ASC;"))
+
+	// A column holding numbers and strings compares by string form
+	assert.Equal(t, []interface{}{"Cy", "Dee", "Ann", "Bob"}, names("SELECT name FROM employees ORDER BY code;"))
+
+	// Order by a computed column, and by a column that is not selected
+	result, err := execSQL(t, session, store, "SELECT name || '!' AS shout FROM employees WHERE salary >= 90000 ORDER BY shout DESC;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"shout": "Cy!"}, {"shout": "Bob!"}, {"shout": "Ann!"}}, result)
+	result, err = execSQL(t, session, store, "SELECT code FROM employees WHERE salary = 90000 ORDER BY name;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"code": "x"}, {"code": "10"}}, result)
+
+	_, err = execSQL(t, session, store, "SELECT name FROM employees ORDER BY age;")
+	assert.EqualError(t, err, "ORDER BY column age does not exist in table employees")
+}
+
+func TestSessionDropTable(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	_, err := execSQL(t, session, store, "CREATE TABLE logs (id INT);")
+	assert.NoError(t, err)
+
+	_, err = execSQL(t, session, store, "DROP TABLE logs;")
+	assert.NoError(t, err)
+	assert.Nil(t, store.GetTable("logs"))
+
+	_, err = execSQL(t, session, store, "DROP TABLE logs;")
+	assert.EqualError(t, err, "table logs does not exist")
+	_, err = execSQL(t, session, store, "DROP TABLE IF EXISTS logs;")
+	assert.NoError(t, err)
+
+	stmt, err := Parse("DROP TABLE logs")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, stmt.CheckSupported(types.Capabilities{ReadOnly: true}), types.ErrNotSupported)
+}
+
+func TestSessionDates(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE events (id INT, occurred DATE NOT NULL, logged TIMESTAMP DEFAULT '2024-01-01 00:00:00');",
+		"INSERT INTO events (id, occurred) VALUES (1, '2023-12-31'), (2, '2024-01-15'), (3, '2024-02-01');",
+		"SET sql_strict = true;",
+		"INSERT INTO events VALUES (4, '2024-03-10', '2024-03-10T12:00:00+01:00');",
+	)
+
+	result, err := execSQL(t, session, store, "SELECT id, logged FROM events WHERE occurred > '2024-01-01' ORDER BY occurred DESC;")
+	assert.NoError(t, err)
+	var got []string
+	for _, row := range result.([]types.Row) {
+		got = append(got, fmt.Sprintf("%v %v", row["id"], row["logged"]))
+	}
+	assert.Equal(t, []string{"4 2024-03-10T11:00:00Z", "3 2024-01-01T00:00:00Z", "2 2024-01-01T00:00:00Z"}, got)
+
+	_, err = execSQL(t, session, store, "INSERT INTO events VALUES (5, '2024-13-01', NULL);")
+	assert.EqualError(t, err, "invalid data type for column occurred: value 2024-13-01 is not a date (expected YYYY-MM-DD)")
+	_, err = Parse("CREATE TABLE bad (d DATE DEFAULT 'today');")
+	assert.EqualError(t, err, "invalid DEFAULT today for DATE column d")
+}
+
+func TestSessionFloatAndBoolean(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	execAll(t, session, store,
+		"CREATE TABLE products (id INT, price FLOAT NOT NULL, active BOOLEAN DEFAULT TRUE);",
+		"INSERT INTO products (id, price) VALUES (1, 19.99), (2, 5);",
+		"INSERT INTO products VALUES (3, 0.5, false);",
+		"UPDATE products SET active = FALSE WHERE price < 1;",
+	)
+
+	result, err := execSQL(t, session, store, "SELECT id, price, active FROM products WHERE price BETWEEN 1 AND 20.5 ORDER BY price DESC;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{
+		{"id": int64(1), "price": 19.99, "active": true},
+		{"id": int64(2), "price": float64(5), "active": true},
+	}, result)
+	result, err = execSQL(t, session, store, "SELECT id FROM products WHERE active = false;")
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(3)}}, result)
+
+	_, err = execSQL(t, session, store, "INSERT INTO products VALUES (4, 'cheap', TRUE);")
+	assert.EqualError(t, err, "invalid data type for column price: value cheap is not a number")
+	_, err = execSQL(t, session, store, "INSERT INTO products VALUES (4, 1.5, 'yes');")
+	assert.EqualError(t, err, "invalid data type for column active: value yes is not a boolean")
+	_, err = Parse("INSERT INTO products VALUES (4, 1.2.3, TRUE);")
+	assert.Error(t, err)
+	_, err = Parse("CREATE TABLE bad (b BOOLEAN DEFAULT 1);")
+	assert.EqualError(t, err, "invalid DEFAULT 1 for BOOLEAN column b")
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// Stage is a step of a SELECT's execution, as ExecuteTraced reports it
+type Stage struct {
+	// Operator is Scan, Aggregate, Sort, Project, Distinct or Limit, as
+	// EXPLAIN names the step
+	Operator string
+	Rows     int
+	Elapsed  time.Duration
+
+	// MemoryUsed and MemoryExact are, for Aggregate, the bytes held by
+	// the state of the aggregates and the bytes an exact evaluation would
+	// need
+	MemoryUsed, MemoryExact int
+}
+
+// ExecuteTraced runs the SELECT as Execute does, calling trace after each
+// step that ran with the rows it produced and the time it took. The
+// storage applies WHERE, and a LIMIT it can take, as it scans, so Scan
+// reports the rows the storage returned. CTEs are materialized untraced.
+func (s *SelectStatement) ExecuteTraced(storage types.Storage, trace func(Stage)) ([]types.Row, error) {
+	traced := *s
+	traced.trace = trace
+	return traced.execute(storage, nil)
+}
+
+// traceStage reports a step that started at start, if the statement is
+// traced
+func (s *SelectStatement) traceStage(operator string, start time.Time, rows int) {
+	if s.trace != nil {
+		s.trace(Stage{Operator: operator, Rows: rows, Elapsed: time.Since(start)})
+	}
+}
+
+// traceAggregate reports the Aggregate step, which produced groups rows
+// from aggs, the aggregates of each group
+func (s *SelectStatement) traceAggregate(start time.Time, groups int, aggs []map[string]types.Aggregate) {
+	if s.trace == nil {
+		return
+	}
+	stage := Stage{Operator: "Aggregate", Rows: groups, Elapsed: time.Since(start)}
+	for _, group := range aggs {
+		for _, agg := range group {
+			used, exact := agg.Memory()
+			stage.MemoryUsed += used
+			stage.MemoryExact += exact
+		}
+	}
+	s.trace(stage)
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// parseTransaction parses the rest of BEGIN [TRANSACTION], COMMIT or
+// ROLLBACK, which take no arguments
+func (p *Parser) parseTransaction() error {
+	keyword := p.currentToken.Literal
+	p.nextToken()
+	if strings.EqualFold(p.currentToken.Literal, "TRANSACTION") {
+		p.nextToken()
+	}
+	if p.currentToken.Type != lexer.EOF && p.currentToken.Type != lexer.SEMICOLON {
+		return fmt.Errorf("unexpected %s after %s", p.currentToken.Literal, keyword)
+	}
+	return nil
+}
+
+// InTransaction reports whether a BEGIN is waiting for COMMIT or ROLLBACK
+func (s *Session) InTransaction() bool {
+	return s.tx != nil
+}
+
+// transaction runs BEGIN, COMMIT or ROLLBACK. BEGIN starts buffering the
+// writes of the session on top of store, and the statements that follow
+// run against the transaction until it ends.
+func (s *Session) transaction(stmtType string, store types.Storage) error {
+	if stmtType == "BEGIN" {
+		if s.tx != nil {
+			return fmt.Errorf("a transaction is already in progress")
+		}
+		tx, err := types.BeginTransaction(store)
+		if err != nil {
+			return err
+		}
+		s.tx = tx
+		return nil
+	}
+
+	if s.tx == nil {
+		return fmt.Errorf("%s without a transaction in progress", stmtType)
+	}
+	tx := s.tx
+	s.tx = nil
+	if stmtType == "COMMIT" {
+		return tx.Commit()
+	}
+	return tx.Rollback()
+}
@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// ColumnRef is a column qualified with a table name or alias (r.new_salary).
+// In UPDATE ... FROM it is used in place of a literal to take the value from
+// the matching source row.
+type ColumnRef struct {
+	Table  string
+	Column string
+}
+
+func (r ColumnRef) String() string {
+	if r.Table == "" {
+		return r.Column
+	}
+	return r.Table + "." + r.Column
+}
+
+// UpdateSource is the FROM clause of an UPDATE. Each target row is joined
+// to the source rows on TargetColumn = SourceColumn; Where holds the literal
+// conditions on the source table.
+type UpdateSource struct {
+	Table        string
+	Alias        string
+	TargetColumn string
+	SourceColumn string
+	Where        *types.WhereExpr
+}
+
+// updateCondition is a parsed WHERE condition of an UPDATE that involves
+// the FROM table, before it is split between the source table and the join
+type updateCondition struct {
+	column ColumnRef
+	value  interface{}
+}
+
+// isSource reports whether a column qualifier names the FROM table. An
+// unqualified column, or one qualified with the target table name, belongs
+// to the target table.
+func (s *UpdateStatement) isSource(qualifier string) (bool, error) {
+	switch {
+	case qualifier == "":
+		return false, nil
+	case s.From != nil && s.From.Alias != "" && qualifier == s.From.Alias:
+		return true, nil
+	case qualifier == s.Table:
+		return false, nil
+	case s.From != nil && qualifier == s.From.Table:
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown table %s", qualifier)
+}
+
+// bindConditions assigns the parsed WHERE conditions involving the FROM
+// table; those on the target table alone are already in Where. Exactly one
+// condition must join a target column to a source column, and the others
+// filter the source table.
+func (s *UpdateStatement) bindConditions(conditions []updateCondition) error {
+	for col, val := range s.Set {
+		ref, ok := val.(ColumnRef)
+		if !ok {
+			continue
+		}
+		if s.From == nil {
+			return fmt.Errorf("column reference %s in SET %s requires a FROM clause", ref, col)
+		}
+		source, err := s.isSource(ref.Table)
+		if err != nil {
+			return err
+		}
+		if !source {
+			return fmt.Errorf("SET %s = %s: only columns of %s can be referenced", col, ref, s.From.Table)
+		}
+	}
+
+	for _, c := range conditions {
+		source, err := s.isSource(c.column.Table)
+		if err != nil {
+			return err
+		}
+
+		ref, isRef := c.value.(ColumnRef)
+		if !isRef {
+			s.From.Where = types.And(s.From.Where, types.Condition(c.column.Column, c.value))
+			continue
+		}
+
+		if s.From == nil {
+			return fmt.Errorf("column reference %s requires a FROM clause", ref)
+		}
+		refSource, err := s.isSource(ref.Table)
+		if err != nil {
+			return err
+		}
+		if source == refSource {
+			return fmt.Errorf("condition %s = %s must compare a column of %s with a column of %s", c.column, ref, s.Table, s.From.Table)
+		}
+		if s.From.TargetColumn != "" {
+			return fmt.Errorf("UPDATE ... FROM supports a single join condition")
+		}
+		if source {
+			s.From.TargetColumn, s.From.SourceColumn = ref.Column, c.column.Column
+		} else {
+			s.From.TargetColumn, s.From.SourceColumn = c.column.Column, ref.Column
+		}
+	}
+
+	if s.From != nil && s.From.TargetColumn == "" {
+		return fmt.Errorf("UPDATE %s ... FROM %s requires a WHERE condition joining the two tables", s.Table, s.From.Table)
+	}
+	return nil
+}
+
+// checkSourceColumns rejects references to columns the source table does
+// not have, which would otherwise read as NULL
+func (s *UpdateStatement) checkSourceColumns(storage types.Storage) error {
+	def := storage.GetTable(s.From.Table)
+	if def == nil {
+		return nil // let the storage report the missing table
+	}
+	columns := make(map[string]bool, len(def.Columns))
+	for _, col := range def.Columns {
+		columns[col.Name] = true
+	}
+
+	refs := []string{s.From.SourceColumn}
+	for _, val := range s.Set {
+		if ref, ok := val.(ColumnRef); ok {
+			refs = append(refs, ref.Column)
+		}
+	}
+	for _, col := range refs {
+		if !columns[col] {
+			return fmt.Errorf("column %s does not exist in table %s", col, s.From.Table)
+		}
+	}
+	return nil
+}
+
+// joinKey normalizes a join column value so numbers compare equal whatever
+// their Go type (an INT column holds int64, a computed number may be an
+// int or a float64). NULL never joins.
+func joinKey(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case int:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64), true
+	case int64:
+		return strconv.FormatFloat(float64(v), 'g', -1, 64), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case string:
+		return "'" + v, true
+	}
+	return fmt.Sprintf("%T:%v", value, value), true
+}
+
+// executeFrom runs an UPDATE ... FROM. The source rows are read once into a
+// lookup keyed by the join column. Each target row with a matching source
+// row is updated with the SET values resolved against that row; target rows
+// without a match are left untouched. A target row matching more than one
+// source row is ambiguous and fails the statement before anything is
+// written. mask, if not nil, is applied to the source values SET copies,
+// so they are written as the session would read them; the join compares
+// stored values, as WHERE does.
+func (s *UpdateStatement) executeFrom(storage types.Storage, mask rowMask) (ExecResult, error) {
+	src := s.From
+	if err := s.checkSourceColumns(storage); err != nil {
+		return ExecResult{}, err
+	}
+	sourceRows, err := storage.Select(src.Table, []string{"*"}, src.Where)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	setRows := sourceRows
+	if mask != nil {
+		setRows = mask(src.Table, sourceRows)
+	}
+	lookup := make(map[string]types.Row, len(sourceRows))
+	matches := make(map[string]int, len(sourceRows))
+	for i, row := range sourceRows {
+		if key, ok := joinKey(row[src.SourceColumn]); ok {
+			lookup[key] = setRows[i]
+			matches[key]++
+		}
+	}
+
+	targetRows, err := storage.Select(s.Table, []string{"*"}, s.Where)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	// Group the matched target rows by join value, so each value is one
+	// storage update
+	var keys []string
+	joinValues := make(map[string]interface{})
+	for _, row := range targetRows {
+		key, ok := joinKey(row[src.TargetColumn])
+		if !ok || matches[key] == 0 {
+			continue
+		}
+		if matches[key] > 1 {
+			return ExecResult{}, fmt.Errorf("ambiguous UPDATE: %s.%s = %v matches %d rows of %s",
+				s.Table, src.TargetColumn, row[src.TargetColumn], matches[key], src.Table)
+		}
+		if _, seen := joinValues[key]; !seen {
+			keys = append(keys, key)
+			joinValues[key] = row[src.TargetColumn]
+		}
+	}
+
+	var result ExecResult
+	for _, key := range keys {
+		set := make(map[string]interface{}, len(s.Set))
+		for col, val := range s.Set {
+			if ref, ok := val.(ColumnRef); ok {
+				val = lookup[key][ref.Column]
+			}
+			set[col] = val
+		}
+		where := types.And(s.Where, types.Condition(src.TargetColumn, joinValues[key]))
+		updated, err := storage.Update(s.Table, set, where)
+		if err != nil {
+			return ExecResult{}, err
+		}
+		result.RowsAffected += updated
+	}
+	return result, nil
+}
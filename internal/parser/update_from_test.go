@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func newRaises(t *testing.T, raises ...map[string]interface{}) *storage.InMemoryStorage {
+	t.Helper()
+	store := storage.NewInMemoryStorage()
+	session := NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE employees (id INT, name STRING, salary INT);",
+		"CREATE TABLE raises (employee_id INT, new_salary INT, approved STRING);",
+	} {
+		_, err := execSQL(t, session, store, sql)
+		assert.NoError(t, err, sql)
+	}
+	for i, name := range []string{"Ann", "Bob", "Cid"} {
+		assert.NoError(t, store.Insert("employees", map[string]interface{}{"id": i + 1, "name": name, "salary": (i + 1) * 100}))
+	}
+	for _, raise := range raises {
+		assert.NoError(t, store.Insert("raises", raise))
+	}
+	return store
+}
+
+func salaries(t *testing.T, store types.Storage) map[int]int {
+	t.Helper()
+	rows, err := store.Select("employees", []string{"id", "salary"}, nil)
+	assert.NoError(t, err)
+	salaries := make(map[int]int)
+	for _, row := range rows {
+		salaries[int(row["id"].(int64))] = int(row["salary"].(int64))
+	}
+	return salaries
+}
+
+func TestParseUpdateFrom(t *testing.T) {
+	stmt, err := Parse("UPDATE employees SET salary = r.new_salary, note = 'raised' FROM raises r WHERE employees.id = r.employee_id AND r.approved = 'yes';")
+	assert.NoError(t, err)
+	assert.Equal(t, &UpdateStatement{
+		Table: "employees",
+		Set:   map[string]interface{}{"salary": ColumnRef{Table: "r", Column: "new_salary"}, "note": "raised"},
+		From: &UpdateSource{
+			Table:        "raises",
+			Alias:        "r",
+			TargetColumn: "id",
+			SourceColumn: "employee_id",
+			Where:        types.Condition("approved", "yes"),
+		},
+	}, stmt.UpdateStatement)
+
+	// The join may be written either way round, and without an alias
+	stmt, err = Parse("UPDATE employees SET salary = raises.new_salary FROM raises WHERE raises.employee_id = employees.id AND name = 'Ann'")
+	assert.NoError(t, err)
+	assert.Equal(t, "id", stmt.UpdateStatement.From.TargetColumn)
+	assert.Equal(t, "employee_id", stmt.UpdateStatement.From.SourceColumn)
+	assert.Equal(t, types.Condition("name", "Ann"), stmt.UpdateStatement.Where)
+
+	for sql, msg := range map[string]string{
+		"UPDATE employees SET salary = r.new_salary WHERE id = 1":                                  "column reference r.new_salary in SET salary requires a FROM clause",
+		"UPDATE employees SET salary = r.new_salary FROM raises r":                                 "UPDATE employees ... FROM raises requires a WHERE condition joining the two tables",
+		"UPDATE employees SET salary = x.new_salary FROM raises r WHERE id = r.employee_id":        "unknown table x",
+		"UPDATE employees SET salary = employees.id FROM raises r WHERE id = r.employee_id":        "SET salary = employees.id: only columns of raises can be referenced",
+		"UPDATE employees SET salary = 1 FROM raises r WHERE id = r.employee_id AND name = r.name": "UPDATE ... FROM supports a single join condition",
+	} {
+		_, err := Parse(sql)
+		assert.EqualError(t, err, msg, sql)
+	}
+}
+
+func TestUpdateFrom(t *testing.T) {
+	store := newRaises(t,
+		map[string]interface{}{"employee_id": 1, "new_salary": 150, "approved": "yes"},
+		map[string]interface{}{"employee_id": 3, "new_salary": 350, "approved": "no"},
+		map[string]interface{}{"employee_id": 9, "new_salary": 999, "approved": "yes"},
+	)
+
+	result, err := execSQL(t, NewSession(), store, "UPDATE employees SET salary = r.new_salary FROM raises r WHERE employees.id = r.employee_id AND r.approved = 'yes';")
+	assert.NoError(t, err)
+	assert.Equal(t, ExecResult{RowsAffected: 1}, result)
+	// Rows without a matching source row are left untouched
+	assert.Equal(t, map[int]int{1: 150, 2: 200, 3: 300}, salaries(t, store))
+
+	result, err = execSQL(t, NewSession(), store, "UPDATE employees SET salary = r.new_salary FROM raises r WHERE employees.id = r.employee_id;")
+	assert.NoError(t, err)
+	assert.Equal(t, ExecResult{RowsAffected: 2}, result)
+	assert.Equal(t, map[int]int{1: 150, 2: 200, 3: 350}, salaries(t, store))
+}
+
+func TestUpdateFromAmbiguous(t *testing.T) {
+	store := newRaises(t,
+		map[string]interface{}{"employee_id": 1, "new_salary": 150},
+		map[string]interface{}{"employee_id": 2, "new_salary": 250},
+		map[string]interface{}{"employee_id": 2, "new_salary": 260},
+	)
+
+	_, err := execSQL(t, NewSession(), store, "UPDATE employees SET salary = r.new_salary FROM raises r WHERE employees.id = r.employee_id;")
+	assert.EqualError(t, err, "ambiguous UPDATE: employees.id = 2 matches 2 rows of raises")
+	// Nothing is written when any row is ambiguous
+	assert.Equal(t, map[int]int{1: 100, 2: 200, 3: 300}, salaries(t, store))
+
+	_, err = execSQL(t, NewSession(), store, "UPDATE employees SET salary = r.bonus FROM raises r WHERE employees.id = r.employee_id;")
+	assert.EqualError(t, err, "column bonus does not exist in table raises")
+}
+
+func TestUpdateFromMaskedSource(t *testing.T) {
+	store := newRaises(t, map[string]interface{}{"employee_id": 1, "new_salary": 150, "approved": "yes"})
+	_, err := execSQL(t, NewSession(), store, "ALTER TABLE raises ALTER COLUMN approved SET MASKED;")
+	assert.NoError(t, err)
+
+	// A masked session copies the value it would read; the join and WHERE
+	// still see the stored one
+	result, err := execSQL(t, NewSession(), store, "UPDATE employees SET name = r.approved FROM raises r WHERE employees.id = r.employee_id AND r.approved = 'yes';")
+	assert.NoError(t, err)
+	assert.Equal(t, ExecResult{RowsAffected: 1}, result)
+	rows, err := store.Select("employees", []string{"name"}, types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "*****"}}, rows)
+
+	// Statements run outside a session are not masked
+	stmt, err := Parse("UPDATE employees SET name = r.approved FROM raises r WHERE employees.id = r.employee_id;")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(store)
+	assert.NoError(t, err)
+	rows, err = store.Select("employees", []string{"name"}, types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "yes"}}, rows)
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// conditionParser parses one condition of a WHERE clause and leaves the
+// parser on the token after it. It returns the condition, or nil for a
+// condition the statement keeps outside its WHERE clause.
+type conditionParser func() (*types.WhereExpr, error)
+
+// parseWhere parses the conditions after WHERE, joined by AND and OR with
+// parentheses for grouping and NOT for negation, into a WHERE clause. NOT
+// binds tighter than AND, and AND tighter than OR. The parser is left on
+// the token after the last condition.
+func (p *Parser) parseWhere(condition conditionParser) (*types.WhereExpr, error) {
+	p.nextToken() // move past WHERE
+	return p.parseOr(condition)
+}
+
+func (p *Parser) parseOr(condition conditionParser) (*types.WhereExpr, error) {
+	var args []*types.WhereExpr
+	for {
+		arg, err := p.parseAnd(condition)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.isWord("OR") {
+			break
+		}
+		p.nextToken()
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	// A condition kept outside the WHERE clause must hold for every row
+	for _, arg := range args {
+		if arg == nil {
+			return nil, errKeptOr
+		}
+	}
+	return types.Or(args...), nil
+}
+
+// errKeptOr is returned for an OR with an operand the statement keeps
+// outside its WHERE clause
+var errKeptOr = errors.New("this condition cannot be combined with OR")
+
+func (p *Parser) parseAnd(condition conditionParser) (*types.WhereExpr, error) {
+	var args []*types.WhereExpr
+	for {
+		arg, err := p.parseNot(condition)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.isWord("AND") {
+			return types.And(args...), nil
+		}
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseNot(condition conditionParser) (*types.WhereExpr, error) {
+	if p.currentToken.Type == lexer.KEYWORD && strings.EqualFold(p.currentToken.Literal, "NOT") {
+		p.nextToken()
+		// A condition kept outside the WHERE clause cannot be negated, even
+		// when ANDed with others inside the operand
+		kept := false
+		arg, err := p.parseNot(func() (*types.WhereExpr, error) {
+			cond, err := condition()
+			kept = kept || (err == nil && cond == nil)
+			return cond, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if kept {
+			return nil, fmt.Errorf("NOT cannot be applied to this condition")
+		}
+		return types.Not(arg), nil
+	}
+
+	if p.currentToken.Type != lexer.LPAREN {
+		return condition()
+	}
+	p.nextToken()
+	group, err := p.parseOr(condition)
+	if err != nil {
+		return nil, err
+	}
+	if p.currentToken.Type != lexer.RPAREN {
+		return nil, fmt.Errorf("expected ) in WHERE, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	return group, nil
+}
+
+// parseConditionValue parses the value of a condition with operator op:
+// a parenthesized list for IN and NOT IN, each element parsed by value,
+// the two bounds of BETWEEN low AND high, the NULL of IS [NOT] NULL, which
+// gives a nil value, and a single value otherwise. The parser is left on
+// the last token of the value.
+func (p *Parser) parseConditionValue(op string, value func() (interface{}, error)) (interface{}, error) {
+	if op == "BETWEEN" {
+		return p.parseBetween(value)
+	}
+	if op == "IS NULL" || op == "IS NOT NULL" {
+		if !strings.EqualFold(p.currentToken.Literal, "NULL") {
+			return nil, fmt.Errorf("expected NULL after IS, got %s", p.currentToken.Literal)
+		}
+		return nil, nil
+	}
+	if op != "IN" && op != "NOT IN" {
+		return value()
+	}
+	if p.currentToken.Type != lexer.LPAREN {
+		return nil, fmt.Errorf("expected ( after %s, got %s", op, p.currentToken.Literal)
+	}
+	var list []interface{}
+	for {
+		p.nextToken()
+		if p.currentToken.Type == lexer.RPAREN && len(list) == 0 {
+			return nil, fmt.Errorf("%s list is empty", op)
+		}
+		val, err := value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, val)
+
+		p.nextToken()
+		if p.currentToken.Type == lexer.RPAREN {
+			return list, nil
+		}
+		if p.currentToken.Type != lexer.COMMA {
+			return nil, fmt.Errorf("expected , or ) in %s list, got %s", op, p.currentToken.Literal)
+		}
+	}
+}
+
+// parseBetween parses the low AND high bounds of BETWEEN into a two
+// element list. The AND is consumed here, so parseAnd never takes it for
+// one joining conditions.
+func (p *Parser) parseBetween(value func() (interface{}, error)) (interface{}, error) {
+	low, err := value()
+	if err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	if !p.isWord("AND") {
+		return nil, fmt.Errorf("expected AND in BETWEEN, got %s", p.currentToken.Literal)
+	}
+	p.nextToken()
+	high, err := value()
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{low, high}, nil
+}
+
+// isWord reports whether the current token is the unquoted word w, such as
+// AND, which the lexer does not treat as a keyword
+func (p *Parser) isWord(w string) bool {
+	return p.currentToken.Type == lexer.IDENTIFIER && strings.EqualFold(p.currentToken.Literal, w)
+}
+
+// hasOr reports whether a WHERE clause joins conditions with OR, which
+// conditions kept outside it cannot take part in
+func hasOr(where *types.WhereExpr) bool {
+	if where == nil {
+		return false
+	}
+	if where.Op == "OR" {
+		return true
+	}
+	for _, arg := range where.Args {
+		if hasOr(arg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// PlanDescription is what EXPLAIN reports about a statement: what it
+// does, which storage engine it runs against and its operator tree
+type PlanDescription struct {
+	Type    string   `json:"type"`
+	Table   string   `json:"table,omitempty"`
+	Engine  string   `json:"engine"`
+	Columns []string `json:"columns,omitempty"`
+
+	// Filters are the conditions of the WHERE clause, all of which must
+	// hold, in column order
+	Filters []string `json:"filters,omitempty"`
+
+	// EstimatedRows is the number of rows the statement inserts, or its
+	// WHERE clause matches, counted when the plan is described. It is nil
+	// when the storage does not know the table, as for a CTE or a table
+	// being created.
+	EstimatedRows *int `json:"estimated_rows,omitempty"`
+
+	Plan *ExplainNode `json:"plan"`
+}
+
+// Engine returns the storage engine the hybrid storage runs the plan on:
+// "parquet" for analytical SELECTs (see storage.IsOLAPQuery), including
+// every aggregate query whatever its aliases, and "btree" otherwise
+func (p *Plan) Engine() string {
+	if p.Type != "SELECT" {
+		return "btree"
+	}
+	if (p.Select != nil && len(p.Select.Aggregates) > 0) || storage.IsOLAPQuery(p.Columns, p.Where) {
+		return "parquet"
+	}
+	return "btree"
+}
+
+// Describe builds the description of the plan. With analyze set the
+// operator tree comes from ExplainAnalyze, which executes the statement;
+// rows are estimated before it runs.
+func (p *Plan) Describe(analyze bool) (*PlanDescription, error) {
+	desc := &PlanDescription{
+		Type:          p.Type,
+		Table:         p.Table,
+		Engine:        p.Engine(),
+		Columns:       p.describeColumns(),
+		EstimatedRows: p.estimateRows(),
+	}
+	filters := []*types.WhereExpr{p.Where}
+	if p.Where == nil {
+		filters = nil
+	} else if p.Where.Op == "AND" {
+		filters = p.Where.Args
+	}
+	for _, filter := range filters {
+		desc.Filters = append(desc.Filters, types.FormatWhere(filter, formatCondition))
+	}
+
+	if analyze {
+		root, err := p.ExplainAnalyze(desc.Engine)
+		if err != nil {
+			return nil, err
+		}
+		desc.Plan = root
+	} else {
+		desc.Plan = p.Explain(desc.Engine)
+	}
+	return desc, nil
+}
+
+// describeColumns returns the columns a statement reads or writes
+func (p *Plan) describeColumns() []string {
+	switch p.Type {
+	case "UPDATE":
+		return sortedKeys(p.Set)
+	case "INSERT":
+		if len(p.Rows) > 0 {
+			return sortedKeys(p.Rows[0])
+		}
+		return nil
+	case "DELETE":
+		return nil
+	}
+	return p.Columns
+}
+
+// estimateRows counts the rows an INSERT adds, or the rows of a known
+// table that the WHERE clause of any other statement matches
+func (p *Plan) estimateRows() *int {
+	switch p.Type {
+	case "INSERT":
+		n := len(p.Rows)
+		return &n
+	case "SELECT", "UPDATE", "DELETE":
+	default:
+		return nil
+	}
+	if p.Storage == nil || p.Sample != nil || p.cte(p.Table) != nil || p.Storage.GetTable(p.Table) == nil {
+		return nil
+	}
+	rows, err := p.Storage.Select(p.Table, []string{"COUNT(*)"}, p.Where)
+	if err != nil || len(rows) != 1 {
+		return nil
+	}
+	n, ok := rows[0]["count"].(int)
+	if !ok {
+		return nil
+	}
+	return &n
+}
+
+// RenderDescription formats a description as text, one property per line
+// followed by the operator tree (see RenderTree)
+func RenderDescription(desc *PlanDescription) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Statement: %s\n", desc.Type)
+	if desc.Table != "" {
+		fmt.Fprintf(&b, "Table: %s\n", desc.Table)
+	}
+	if desc.Type == "SELECT" {
+		fmt.Fprintf(&b, "Query Type: %s\n", map[bool]string{true: "OLAP (Analytical)", false: "OLTP (Transactional)"}[desc.Engine == "parquet"])
+	}
+	fmt.Fprintf(&b, "Storage Engine: %s\n", map[bool]string{true: "Parquet", false: "BTree"}[desc.Engine == "parquet"])
+	if len(desc.Columns) > 0 {
+		fmt.Fprintf(&b, "Columns: %s\n", strings.Join(desc.Columns, ", "))
+	}
+	if len(desc.Filters) > 0 {
+		fmt.Fprintf(&b, "Filters: %s\n", strings.Join(desc.Filters, " AND "))
+	}
+	if desc.EstimatedRows != nil {
+		fmt.Fprintf(&b, "Estimated Rows: %d\n", *desc.EstimatedRows)
+	}
+	b.WriteString("Plan:\n")
+	b.WriteString(RenderTree(desc.Plan))
+	return b.String()
+}
+
+// RenderDescriptionJSON formats a description as indented JSON for
+// tooling
+func RenderDescriptionJSON(desc *PlanDescription) (string, error) {
+	data, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
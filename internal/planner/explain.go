@@ -0,0 +1,431 @@
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/parser"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// ExplainNode is a single operator in an EXPLAIN tree. ActualRows and
+// ActualTime are only set by EXPLAIN ANALYZE.
+type ExplainNode struct {
+	Operator   string         `json:"operator"`
+	Detail     string         `json:"detail,omitempty"`
+	Engine     string         `json:"engine,omitempty"`
+	ActualRows *int           `json:"actual_rows,omitempty"`
+	ActualTime *time.Duration `json:"actual_time_ns,omitempty"`
+	Memory     *MemoryUsage   `json:"memory,omitempty"`
+	Children   []*ExplainNode `json:"children,omitempty"`
+}
+
+// MemoryUsage is the state EXPLAIN ANALYZE measured for an Aggregate node,
+// next to what exact evaluation would need. They differ for sketches such
+// as APPROX_COUNT_DISTINCT.
+type MemoryUsage struct {
+	Used  int `json:"used_bytes"`
+	Exact int `json:"exact_bytes"`
+}
+
+// Explain builds the operator tree for a plan. engine names the storage
+// engine the scan runs against (e.g. "btree" or "parquet").
+func (p *Plan) Explain(engine string) *ExplainNode {
+	scan := &ExplainNode{
+		Operator: "Seq Scan on " + p.Table,
+		Engine:   engine,
+	}
+	if cte := p.cte(p.Table); cte != nil {
+		scan = &ExplainNode{
+			Operator: "CTE Scan on " + p.Table,
+			Children: []*ExplainNode{p.explainCTE(cte, engine)},
+		}
+	}
+	if p.Sample != nil {
+		if p.cte(p.Table) == nil {
+			scan.Operator = "Sample Scan on " + p.Table
+		}
+		scan.Detail = p.Sample.String()
+	}
+
+	// Input rows for SELECT, UPDATE and DELETE: scan, then filter
+	input := scan
+	if p.Where != nil {
+		input = &ExplainNode{
+			Operator: "Filter",
+			Detail:   types.FormatWhere(p.Where, formatCondition),
+			Children: []*ExplainNode{scan},
+		}
+	}
+
+	switch p.Type {
+	case "SELECT":
+		if p.Select != nil && len(p.Select.GroupBy) > 0 {
+			return p.explainLimit(p.explainGroup(input))
+		}
+		if p.Select != nil && len(p.Select.Aggregates) > 0 {
+			calls := make([]string, len(p.Columns))
+			for i, col := range p.Columns {
+				calls[i] = p.Select.Aggregates[col].String()
+			}
+			return p.explainLimit(&ExplainNode{
+				Operator: "Aggregate",
+				Detail:   strings.Join(calls, ", "),
+				Children: []*ExplainNode{input},
+			})
+		}
+		if p.Select != nil && len(p.Select.OrderBy) > 0 {
+			keys := make([]string, len(p.Select.OrderBy))
+			for i, clause := range p.Select.OrderBy {
+				keys[i] = clause.String()
+			}
+			input = &ExplainNode{
+				Operator: "Sort",
+				Detail:   strings.Join(keys, ", "),
+				Children: []*ExplainNode{input},
+			}
+		}
+		if len(p.Columns) > 0 && (len(p.Columns) > 1 || p.Columns[0] != "*") {
+			input = &ExplainNode{
+				Operator: "Project",
+				Detail:   strings.Join(p.Columns, ", "),
+				Children: []*ExplainNode{input},
+			}
+		}
+		if p.Select != nil && p.Select.Distinct {
+			input = &ExplainNode{
+				Operator: "Distinct",
+				Children: []*ExplainNode{input},
+			}
+		}
+		return p.explainLimit(input)
+	case "UPDATE":
+		if p.From != nil {
+			input = p.explainUpdateSource(input, engine)
+		}
+		return &ExplainNode{
+			Operator: "Update on " + p.Table,
+			Detail:   "SET " + formatAssignments(p.Set),
+			Engine:   engine,
+			Children: []*ExplainNode{input},
+		}
+	case "DELETE":
+		return &ExplainNode{
+			Operator: "Delete on " + p.Table,
+			Engine:   engine,
+			Children: []*ExplainNode{input},
+		}
+	case "INSERT":
+		return &ExplainNode{
+			Operator: "Insert on " + p.Table,
+			Engine:   engine,
+			Children: []*ExplainNode{{
+				Operator: "Values",
+				Detail:   formatValues(p.Rows),
+			}},
+		}
+	case "CREATE":
+		return &ExplainNode{
+			Operator: "Create Table " + p.Table,
+			Detail:   strings.Join(p.Columns, ", "),
+			Engine:   engine,
+		}
+	default:
+		return &ExplainNode{Operator: p.Type}
+	}
+}
+
+// explainGroup aggregates the input rows of a grouped SELECT, then sorts
+// and deduplicates the groups
+func (p *Plan) explainGroup(input *ExplainNode) *ExplainNode {
+	var calls []string
+	for _, col := range p.Columns {
+		if call, ok := p.Select.Aggregates[col]; ok {
+			calls = append(calls, call.String())
+		}
+	}
+	detail := "GROUP BY " + strings.Join(p.Select.GroupBy, ", ")
+	if len(calls) > 0 {
+		detail = strings.Join(calls, ", ") + " " + detail
+	}
+	node := &ExplainNode{
+		Operator: "Aggregate",
+		Detail:   detail,
+		Children: []*ExplainNode{input},
+	}
+	if len(p.Select.OrderBy) > 0 {
+		keys := make([]string, len(p.Select.OrderBy))
+		for i, clause := range p.Select.OrderBy {
+			keys[i] = clause.String()
+		}
+		node = &ExplainNode{
+			Operator: "Sort",
+			Detail:   strings.Join(keys, ", "),
+			Children: []*ExplainNode{node},
+		}
+	}
+	if p.Select.Distinct {
+		node = &ExplainNode{
+			Operator: "Distinct",
+			Children: []*ExplainNode{node},
+		}
+	}
+	return node
+}
+
+// explainLimit puts a SELECT's LIMIT, if any, on top of its result
+func (p *Plan) explainLimit(input *ExplainNode) *ExplainNode {
+	if p.Select == nil || p.Select.Limit == nil {
+		return input
+	}
+	return &ExplainNode{
+		Operator: "Limit",
+		Detail:   p.Select.Limit.String(),
+		Children: []*ExplainNode{input},
+	}
+}
+
+// explainUpdateSource joins the target rows of an UPDATE ... FROM to the
+// source table, which is read once into a lookup keyed by the join column
+func (p *Plan) explainUpdateSource(input *ExplainNode, engine string) *ExplainNode {
+	source := &ExplainNode{
+		Operator: "Seq Scan on " + p.From.Table,
+		Engine:   engine,
+	}
+	if p.From.Where != nil {
+		source = &ExplainNode{
+			Operator: "Filter",
+			Detail:   types.FormatWhere(p.From.Where, formatCondition),
+			Children: []*ExplainNode{source},
+		}
+	}
+	return &ExplainNode{
+		Operator: "Hash Join",
+		Detail:   fmt.Sprintf("%s.%s = %s.%s", p.Table, p.From.TargetColumn, p.From.Table, p.From.SourceColumn),
+		Children: []*ExplainNode{input, source},
+	}
+}
+
+// ExplainAnalyze builds the operator tree and executes the plan, annotating
+// each node with the rows it produced and the time it and the nodes below
+// it took. A SELECT is executed once, traced step by step (see
+// parser.SelectStatement.ExecuteTraced); a node whose step did not run on
+// its own, such as a Filter the storage applied as it scanned, shows the
+// rows of the node below it. Like EXPLAIN ANALYZE elsewhere,
+// data-modifying statements are really executed.
+func (p *Plan) ExplainAnalyze(engine string) (*ExplainNode, error) {
+	root := p.Explain(engine)
+
+	if p.Type != "SELECT" {
+		start := time.Now()
+		if _, err := p.Execute(); err != nil {
+			return nil, err
+		}
+		root.setActual(-1, time.Since(start))
+		return root, nil
+	}
+
+	sel := p.Select
+	if sel == nil {
+		sel = &parser.SelectStatement{Table: p.Table, Columns: p.Columns, Where: p.Where, With: p.With, Sample: p.Sample}
+	}
+	stages := make(map[string]parser.Stage)
+	_, err := sel.ExecuteTraced(p.Storage, func(stage parser.Stage) {
+		stages[stage.Operator] = stage
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The children of a CTE scan describe the materialized CTE
+	var chain []*ExplainNode
+	for node := root; node != nil; node = node.child() {
+		chain = append(chain, node)
+		if isScan(node) {
+			break
+		}
+	}
+	var rows int
+	var elapsed time.Duration
+	for i := len(chain) - 1; i >= 0; i-- {
+		node := chain[i]
+		operator := node.Operator
+		if isScan(node) {
+			operator = "Scan"
+		}
+		if stage, ok := stages[operator]; ok {
+			rows = stage.Rows
+			elapsed += stage.Elapsed
+			if operator == "Aggregate" {
+				node.Memory = &MemoryUsage{Used: stage.MemoryUsed, Exact: stage.MemoryExact}
+			}
+		}
+		node.setActual(rows, elapsed)
+	}
+	return root, nil
+}
+
+// isScan reports whether node reads the plan's table
+func isScan(node *ExplainNode) bool {
+	return strings.Contains(node.Operator, " Scan on ")
+}
+
+// cte returns the CTE that the plan's table name refers to, if any
+func (p *Plan) cte(name string) *parser.CTE {
+	for i := range p.With {
+		if p.With[i].Name == name {
+			return &p.With[i]
+		}
+	}
+	return nil
+}
+
+// explainCTE builds the subtree that materializes a CTE. CTEs are
+// materialized before the main query runs, so EXPLAIN ANALYZE does not
+// annotate these nodes.
+func (p *Plan) explainCTE(cte *parser.CTE, engine string) *ExplainNode {
+	sub := &Plan{
+		Storage: p.Storage,
+		Type:    "SELECT",
+		Table:   cte.Select.Table,
+		Columns: cte.Select.Columns,
+		Where:   cte.Select.Where,
+		Sample:  cte.Select.Sample,
+	}
+	if cte.Select.HasExpressions() {
+		sub.Select = cte.Select
+	}
+	// A CTE may only read CTEs defined before it
+	for i := range p.With {
+		if p.With[i].Name == cte.Name {
+			break
+		}
+		sub.With = append(sub.With, p.With[i])
+	}
+	return &ExplainNode{
+		Operator: "CTE " + cte.Name,
+		Children: []*ExplainNode{sub.Explain(engine)},
+	}
+}
+
+func (n *ExplainNode) child() *ExplainNode {
+	if len(n.Children) == 0 {
+		return nil
+	}
+	return n.Children[0]
+}
+
+// setActual records EXPLAIN ANALYZE results; rows < 0 means not applicable
+func (n *ExplainNode) setActual(rows int, elapsed time.Duration) {
+	if rows >= 0 {
+		n.ActualRows = &rows
+	}
+	n.ActualTime = &elapsed
+}
+
+// RenderTree formats the tree as indented text, one operator per line:
+//
+//	Project (id, name)
+//	  -> Filter (department = 'Engineering')
+//	       -> Seq Scan on employees [engine=parquet]
+func RenderTree(root *ExplainNode) string {
+	var b strings.Builder
+	renderNode(&b, root, 0)
+	return b.String()
+}
+
+func renderNode(b *strings.Builder, n *ExplainNode, depth int) {
+	if depth > 0 {
+		b.WriteString(strings.Repeat(" ", 5*depth-3))
+		b.WriteString("-> ")
+	}
+	b.WriteString(n.Operator)
+	if n.Detail != "" {
+		fmt.Fprintf(b, " (%s)", n.Detail)
+	}
+	if n.Engine != "" {
+		fmt.Fprintf(b, " [engine=%s]", n.Engine)
+	}
+	if n.ActualTime != nil {
+		b.WriteString(" (actual")
+		if n.ActualRows != nil {
+			fmt.Fprintf(b, " rows=%d", *n.ActualRows)
+		}
+		fmt.Fprintf(b, " time=%.3fms)", float64(*n.ActualTime)/float64(time.Millisecond))
+	}
+	if n.Memory != nil {
+		fmt.Fprintf(b, " (memory=%s, exact=%s)", formatBytes(n.Memory.Used), formatBytes(n.Memory.Exact))
+	}
+	b.WriteString("\n")
+
+	for _, child := range n.Children {
+		renderNode(b, child, depth+1)
+	}
+}
+
+// RenderJSON formats the tree as indented JSON for tooling
+func RenderJSON(root *ExplainNode) (string, error) {
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// formatAssignments renders the SET column/value pairs in a stable order
+func formatAssignments(m map[string]interface{}) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s = %s", k, formatValue(m[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatCondition renders a WHERE condition on column
+func formatCondition(column string, value interface{}) string {
+	if c, ok := value.(types.Comparison); ok {
+		return c.Format(column)
+	}
+	return fmt.Sprintf("%s = %s", column, formatValue(value))
+}
+
+// formatValues describes the rows of an INSERT, e.g. 3 columns or 2 rows,
+// 3 columns
+func formatValues(rows []map[string]interface{}) string {
+	columns := 0
+	if len(rows) > 0 {
+		columns = len(rows[0])
+	}
+	if len(rows) == 1 {
+		return fmt.Sprintf("%d columns", columns)
+	}
+	return fmt.Sprintf("%d rows, %d columns", len(rows), columns)
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 16.0 KiB
+func formatBytes(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, unit := float64(n)/1024, "KiB"
+	if value >= 1024 {
+		value, unit = value/1024, "MiB"
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return "'" + s + "'"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,334 @@
+package planner
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/parser"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/")
+
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "explain", name+".golden")
+	if *updateGolden {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(got), 0644))
+	}
+	want, err := os.ReadFile(path)
+	if !assert.NoError(t, err, "missing golden file; run go test -update") {
+		return
+	}
+	assert.Equal(t, string(want), got)
+}
+
+func TestExplainGolden(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+
+	tests := []struct {
+		name   string
+		sql    string
+		engine string
+	}{
+		{"select_star", "SELECT * FROM employees", "parquet"},
+		{"select_filter_project", "SELECT id, name FROM employees WHERE department = 'Engineering'", "btree"},
+		{"update", "UPDATE employees SET salary = 60000 WHERE id = 1", "btree"},
+		{"delete", "DELETE FROM employees WHERE department = 'Sales'", "btree"},
+		{"insert", "INSERT INTO employees VALUES (1, 'Ann', 'Engineering')", "btree"},
+		{"create", "CREATE TABLE employees (id INT, name TEXT)", "btree"},
+		{"select_sample", "SELECT id FROM events TABLESAMPLE (10 PERCENT) REPEATABLE (42) WHERE kind = 'click'", "btree"},
+		{"select_aggregate", "SELECT COUNT(DISTINCT department) AS departments, APPROX_COUNT_DISTINCT(name) FROM employees WHERE level = 3", "parquet"},
+		{"select_and_or", "SELECT id FROM employees WHERE level >= 3 AND (department = 'Engineering' OR department = 'Sales')", "btree"},
+		{"select_group_by", "SELECT department, COUNT(*), AVG(salary) FROM employees WHERE level >= 3 GROUP BY department ORDER BY department LIMIT 5", "parquet"},
+		{"select_distinct", "SELECT DISTINCT department FROM employees WHERE level >= 3 ORDER BY department", "btree"},
+		{"select_limit", "SELECT name FROM employees ORDER BY salary DESC LIMIT 10 OFFSET 20", "btree"},
+		{"select_order_by", "SELECT name FROM employees WHERE department = 'Engineering' ORDER BY salary DESC, name", "btree"},
+		{"with", "WITH eng AS (SELECT * FROM employees WHERE department = 'Engineering'), top AS (SELECT * FROM eng WHERE level = 3) SELECT name FROM top", "btree"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := parser.Parse(tt.sql)
+			assert.NoError(t, err)
+			plan, err := CreatePlan(stmt, store)
+			assert.NoError(t, err)
+
+			root := plan.Explain(tt.engine)
+			assertGolden(t, tt.name, RenderTree(root))
+
+			js, err := RenderJSON(root)
+			assert.NoError(t, err)
+			assertGolden(t, tt.name+"_json", js)
+		})
+	}
+}
+
+func TestExplainAnalyzeRender(t *testing.T) {
+	stmt, err := parser.Parse("SELECT id, name FROM employees WHERE department = 'Engineering'")
+	assert.NoError(t, err)
+	plan, err := CreatePlan(stmt, nil)
+	assert.NoError(t, err)
+
+	// Fixed annotations so the output is stable
+	root := plan.Explain("btree")
+	root.setActual(2, 1500*time.Microsecond)
+	root.Children[0].setActual(2, 1200*time.Microsecond)
+	root.Children[0].Children[0].setActual(5, 800*time.Microsecond)
+	assertGolden(t, "select_analyze", RenderTree(root))
+}
+
+func TestExplainAnalyzeRows(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	assert.NoError(t, store.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING"},
+			{Name: "department", Type: "STRING"},
+		},
+	}))
+	assert.NoError(t, store.Insert("employees", map[string]interface{}{"id": float64(1), "name": "Ann", "department": "Engineering"}))
+	assert.NoError(t, store.Insert("employees", map[string]interface{}{"id": float64(2), "name": "Bob", "department": "Sales"}))
+	assert.NoError(t, store.Insert("employees", map[string]interface{}{"id": float64(3), "name": "Cid", "department": "Engineering"}))
+
+	stmt, err := parser.Parse("SELECT name FROM employees WHERE department = 'Engineering'")
+	assert.NoError(t, err)
+	plan, err := CreatePlan(stmt, store)
+	assert.NoError(t, err)
+
+	// The storage applies WHERE as it scans, so the scan returns the rows
+	// that pass it
+	root, err := plan.ExplainAnalyze("memory")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *root.ActualRows)
+	assert.Equal(t, 2, *root.Children[0].ActualRows)
+	assert.Equal(t, 2, *root.Children[0].Children[0].ActualRows)
+	assert.NotNil(t, root.Children[0].Children[0].ActualTime)
+	assert.GreaterOrEqual(t, *root.ActualTime, *root.Children[0].Children[0].ActualTime)
+
+	stmt, err = parser.Parse("SELECT name FROM employees LIMIT 5 OFFSET 1")
+	assert.NoError(t, err)
+	plan, err = CreatePlan(stmt, store)
+	assert.NoError(t, err)
+	root, err = plan.ExplainAnalyze("memory")
+	assert.NoError(t, err)
+	assert.Equal(t, "Limit", root.Operator)
+	assert.Equal(t, 2, *root.ActualRows)
+	// and a LIMIT nothing after it changes
+	assert.Equal(t, 2, *root.Children[0].ActualRows)
+
+	stmt, err = parser.Parse("SELECT DISTINCT department FROM employees ORDER BY department LIMIT 1")
+	assert.NoError(t, err)
+	plan, err = CreatePlan(stmt, store)
+	assert.NoError(t, err)
+	root, err = plan.ExplainAnalyze("memory")
+	assert.NoError(t, err)
+	for _, want := range []struct {
+		operator string
+		rows     int
+	}{{"Limit", 1}, {"Distinct", 2}, {"Project", 3}, {"Sort", 3}, {"Seq Scan on employees", 3}} {
+		assert.Equal(t, want.operator, root.Operator)
+		assert.Equal(t, want.rows, *root.ActualRows, root.Operator)
+		root = root.child()
+	}
+
+	stmt, err = parser.Parse("SELECT department, COUNT(*) FROM employees GROUP BY department ORDER BY department LIMIT 1")
+	assert.NoError(t, err)
+	plan, err = CreatePlan(stmt, store)
+	assert.NoError(t, err)
+	root, err = plan.ExplainAnalyze("memory")
+	assert.NoError(t, err)
+	assert.Equal(t, "Limit", root.Operator)
+	assert.Equal(t, 1, *root.ActualRows)
+	sort := root.Children[0]
+	assert.Equal(t, "Sort", sort.Operator)
+	assert.Equal(t, 2, *sort.ActualRows)
+	assert.Equal(t, "Aggregate", sort.Children[0].Operator)
+	assert.Equal(t, 2, *sort.Children[0].ActualRows)
+	assert.Equal(t, 3, *sort.Children[0].Children[0].ActualRows)
+
+	// DML is executed and only timed
+	stmt, err = parser.Parse("DELETE FROM employees WHERE department = 'Sales'")
+	assert.NoError(t, err)
+	plan, err = CreatePlan(stmt, store)
+	assert.NoError(t, err)
+	root, err = plan.ExplainAnalyze("memory")
+	assert.NoError(t, err)
+	assert.Nil(t, root.ActualRows)
+	assert.NotNil(t, root.ActualTime)
+	rows, err := store.Select("employees", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+}
+
+// countingStorage counts the SELECTs run against a storage
+type countingStorage struct {
+	types.Storage
+	selects int
+}
+
+func (s *countingStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	s.selects++
+	return s.Storage.Select(tableName, columns, where)
+}
+
+func TestExplainAnalyzeExecutesOnce(t *testing.T) {
+	store := &countingStorage{Storage: storage.NewInMemoryStorage()}
+	assert.NoError(t, store.CreateTable(&types.Table{
+		Name:    "employees",
+		Columns: []types.ColumnDefinition{{Name: "department", Type: "STRING"}},
+	}))
+	for _, dept := range []string{"Engineering", "Sales", "Engineering"} {
+		assert.NoError(t, store.Insert("employees", map[string]interface{}{"department": dept}))
+	}
+
+	stmt, err := parser.Parse("SELECT DISTINCT department, COUNT(*) AS n FROM employees WHERE department <> 'Ops' GROUP BY department ORDER BY n DESC LIMIT 1")
+	assert.NoError(t, err)
+	plan, err := CreatePlan(stmt, store)
+	assert.NoError(t, err)
+	root, err := plan.ExplainAnalyze("memory")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.selects)
+	assert.Equal(t, 1, *root.ActualRows)
+}
+
+func TestExplainAnalyzeAggregateMemory(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	assert.NoError(t, store.CreateTable(&types.Table{
+		Name:    "events",
+		Columns: []types.ColumnDefinition{{Name: "user_id", Type: "STRING", Nullable: true}},
+	}))
+	for i := 0; i < 5000; i++ {
+		assert.NoError(t, store.Insert("events", map[string]interface{}{"user_id": fmt.Sprintf("user-%d", i)}))
+	}
+
+	for sql, sketch := range map[string]bool{
+		"SELECT APPROX_COUNT_DISTINCT(user_id) FROM events": true,
+		"SELECT COUNT(DISTINCT user_id) FROM events":        false,
+	} {
+		stmt, err := parser.Parse(sql)
+		assert.NoError(t, err)
+		plan, err := CreatePlan(stmt, store)
+		assert.NoError(t, err)
+		root, err := plan.ExplainAnalyze("memory")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "Aggregate", root.Operator)
+		assert.Equal(t, 1, *root.ActualRows)
+		if assert.NotNil(t, root.Memory, sql) {
+			if sketch {
+				assert.Equal(t, 16384, root.Memory.Used)
+			} else {
+				assert.Equal(t, root.Memory.Exact, root.Memory.Used)
+			}
+			assert.InDelta(t, 5000*(9+48), root.Memory.Exact, 5000*57*0.05, sql)
+		}
+		assert.Contains(t, RenderTree(root), "(memory=")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	store := storage.NewInMemoryStorage()
+	assert.NoError(t, store.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING"},
+			{Name: "department", Type: "STRING"},
+		},
+	}))
+	for i, dept := range []string{"Engineering", "Sales", "Engineering"} {
+		assert.NoError(t, store.Insert("employees", map[string]interface{}{"id": i + 1, "name": fmt.Sprintf("e%d", i+1), "department": dept}))
+	}
+	describe := func(sql string) *PlanDescription {
+		stmt, err := parser.Parse(sql)
+		assert.NoError(t, err, sql)
+		assert.Equal(t, "EXPLAIN", stmt.Type, sql)
+		plan, err := CreatePlan(stmt.ExplainStatement.Statement, store)
+		assert.NoError(t, err, sql)
+		desc, err := plan.Describe(stmt.ExplainStatement.Analyze)
+		assert.NoError(t, err, sql)
+		return desc
+	}
+	rows := func(n int) *int { return &n }
+
+	tests := []struct {
+		sql  string
+		want PlanDescription
+	}{
+		{"EXPLAIN SELECT id, name FROM employees WHERE id = 1", PlanDescription{
+			Type: "SELECT", Table: "employees", Engine: "btree", Columns: []string{"id", "name"},
+			Filters: []string{"id = 1"}, EstimatedRows: rows(1),
+		}},
+		{"EXPLAIN SELECT * FROM employees WHERE department = 'Engineering' AND id > 1", PlanDescription{
+			Type: "SELECT", Table: "employees", Engine: "parquet", Columns: []string{"*"},
+			Filters: []string{"department = 'Engineering'", "id > 1"}, EstimatedRows: rows(1),
+		}},
+		{"EXPLAIN SELECT COUNT(*) AS n FROM employees WHERE id = 1", PlanDescription{
+			Type: "SELECT", Table: "employees", Engine: "parquet", Columns: []string{"n"},
+			Filters: []string{"id = 1"}, EstimatedRows: rows(1),
+		}},
+		{"EXPLAIN WITH eng AS (SELECT * FROM employees) SELECT name FROM eng WHERE id = 1", PlanDescription{
+			Type: "SELECT", Table: "eng", Engine: "btree", Columns: []string{"name"}, Filters: []string{"id = 1"},
+		}},
+		{"EXPLAIN UPDATE employees SET name = 'x', department = 'Ops' WHERE department = 'Engineering'", PlanDescription{
+			Type: "UPDATE", Table: "employees", Engine: "btree", Columns: []string{"department", "name"},
+			Filters: []string{"department = 'Engineering'"}, EstimatedRows: rows(2),
+		}},
+		{"EXPLAIN DELETE FROM employees WHERE id = 1 OR id = 2", PlanDescription{
+			Type: "DELETE", Table: "employees", Engine: "btree",
+			Filters: []string{"id = 1 OR id = 2"}, EstimatedRows: rows(2),
+		}},
+		{"EXPLAIN INSERT INTO employees VALUES (4, 'Dee', 'Sales'), (5, 'Eve', 'Sales')", PlanDescription{
+			Type: "INSERT", Table: "employees", Engine: "btree", Columns: []string{"department", "id", "name"},
+			EstimatedRows: rows(2),
+		}},
+		{"EXPLAIN CREATE TABLE teams (id INT PRIMARY KEY, name STRING)", PlanDescription{
+			Type: "CREATE", Table: "teams", Engine: "btree", Columns: []string{"id INT PRIMARY KEY", "name STRING"},
+		}},
+	}
+	for _, tt := range tests {
+		desc := describe(tt.sql)
+		assert.NotNil(t, desc.Plan, tt.sql)
+		desc.Plan = nil
+		assert.Equal(t, tt.want, *desc, tt.sql)
+	}
+
+	// Nothing ran
+	count, err := store.Select("employees", []string{"COUNT(*)"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"count": 3}}, count)
+
+	assert.Equal(t, `Statement: UPDATE
+Table: employees
+Storage Engine: BTree
+Columns: name
+Filters: id = 2
+Estimated Rows: 1
+Plan:
+Update on employees (SET name = 'x') [engine=btree]
+  -> Filter (id = 2)
+       -> Seq Scan on employees [engine=btree]
+`, RenderDescription(describe("EXPLAIN UPDATE employees SET name = 'x' WHERE id = 2")))
+
+	// Rows are estimated before EXPLAIN ANALYZE runs the statement
+	desc := describe("EXPLAIN ANALYZE DELETE FROM employees WHERE department = 'Sales'")
+	assert.Equal(t, 1, *desc.EstimatedRows)
+	assert.NotNil(t, desc.Plan.ActualTime)
+	count, err = store.Select("employees", []string{"COUNT(*)"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"count": 2}}, count)
+
+	stmt, err := parser.Parse("EXPLAIN DROP TABLE employees")
+	assert.NoError(t, err)
+	_, err = CreatePlan(stmt.ExplainStatement.Statement, store)
+	assert.EqualError(t, err, "DROP statements cannot be planned")
+}
@@ -1,7 +1,6 @@
 package planner
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 
@@ -11,13 +10,25 @@ import (
 
 // Plan represents a query execution plan
 type Plan struct {
-	Storage types.Storage
-	Type    string
-	Table   string
-	Columns []string
-	Where   map[string]interface{}
-	Set     map[string]interface{}
-	Values  map[string]interface{}
+	Storage     types.Storage
+	Type        string
+	Table       string
+	Columns     []string
+	Where       *types.WhereExpr
+	Set         map[string]interface{}
+	Rows        []map[string]interface{}
+	IfNotExists bool
+	With        []parser.CTE
+	From        *parser.UpdateSource
+	Sample      *types.SampleSpec
+
+	// Schema is set for a CREATE to the table it creates; Columns then
+	// only describe it
+	Schema *types.Table
+
+	// Select is set for a SELECT with computed columns or aggregates,
+	// which the statement evaluates
+	Select *parser.SelectStatement
 }
 
 type Planner struct {
@@ -42,14 +53,37 @@ func NewPlanner(storage types.Storage) *Planner {
 func (p *Plan) Execute() (interface{}, error) {
 	switch p.Type {
 	case "SELECT":
-		return p.Storage.Select(p.Table, p.Columns, p.Where)
+		if p.Select != nil {
+			return p.Select.Execute(p.Storage)
+		}
+		source, err := parser.WithCTEs(p.Storage, p.With)
+		if err != nil {
+			return nil, err
+		}
+		if p.Sample != nil {
+			return types.SampleSelect(source, p.Table, p.Columns, p.Where, *p.Sample)
+		}
+		return source.Select(p.Table, p.Columns, p.Where)
 	case "INSERT":
-		return nil, p.Storage.Insert(p.Table, p.Values)
+		if err := types.InsertRows(p.Storage, p.Table, p.Rows); err != nil {
+			return nil, err
+		}
+		return parser.ExecResult{RowsAffected: len(p.Rows)}, nil
 	case "UPDATE":
-		return nil, p.Storage.Update(p.Table, p.Set, p.Where)
+		stmt := &parser.UpdateStatement{Table: p.Table, Set: p.Set, Where: p.Where, From: p.From}
+		return stmt.Execute(p.Storage)
 	case "DELETE":
-		return nil, p.Storage.Delete(p.Table, p.Where)
+		stmt := &parser.DeleteStatement{Table: p.Table, Where: p.Where}
+		return stmt.Execute(p.Storage)
 	case "CREATE":
+		if p.Schema != nil {
+			if p.IfNotExists {
+				if existing := p.Storage.GetTable(p.Table); existing != nil {
+					return nil, types.CheckSchemaCompatible(existing, p.Schema)
+				}
+			}
+			return nil, p.Storage.CreateTable(p.Schema)
+		}
 		// Parse column definitions from plan.Columns
 		columnDefs := make([]types.ColumnDefinition, 0, len(p.Columns))
 		for _, colStr := range p.Columns {
@@ -60,13 +94,19 @@ func (p *Plan) Execute() (interface{}, error) {
 			columnDefs = append(columnDefs, types.ColumnDefinition{
 				Name:     parts[0],
 				Type:     parts[1],
-				Nullable: true, // Default to nullable
+				Nullable: !strings.HasSuffix(colStr, " NOT NULL"), // Default to nullable
 			})
 		}
-		return nil, p.Storage.CreateTable(&types.Table{
+		table := &types.Table{
 			Name:    p.Table,
 			Columns: columnDefs,
-		})
+		}
+		if p.IfNotExists {
+			if existing := p.Storage.GetTable(p.Table); existing != nil {
+				return nil, types.CheckSchemaCompatible(existing, table)
+			}
+		}
+		return nil, p.Storage.CreateTable(table)
 	default:
 		return nil, fmt.Errorf("unsupported statement type: %s", p.Type)
 	}
@@ -89,17 +129,30 @@ func CreatePlan(stmt *parser.Statement, storage types.Storage) (*Plan, error) {
 		plan.Table = s.Table
 		plan.Columns = s.Columns
 		plan.Where = s.Where
+		plan.With = s.With
+		plan.Sample = s.Sample
+		if s.HasExpressions() {
+			plan.Select = s
+		}
 	} else if stmt.InsertStatement != nil {
 		s := stmt.InsertStatement
 		plan.Type = "INSERT"
 		plan.Table = s.Table
-		plan.Values = s.Values
+		plan.Rows = s.Rows
+		if storage != nil {
+			rows, err := s.TableRows(storage.GetTable(s.Table))
+			if err != nil {
+				return nil, err
+			}
+			plan.Rows = rows
+		}
 	} else if stmt.UpdateStatement != nil {
 		s := stmt.UpdateStatement
 		plan.Type = "UPDATE"
 		plan.Table = s.Table
 		plan.Set = s.Set
 		plan.Where = s.Where
+		plan.From = s.From
 	} else if stmt.DeleteStatement != nil {
 		s := stmt.DeleteStatement
 		plan.Type = "DELETE"
@@ -109,15 +162,30 @@ func CreatePlan(stmt *parser.Statement, storage types.Storage) (*Plan, error) {
 		s := stmt.CreateStatement
 		plan.Type = "CREATE"
 		plan.Table = s.Table
+		plan.IfNotExists = s.IfNotExists
+		plan.Schema = s.Schema()
 		// Convert columns to string format
 		plan.Columns = make([]string, len(s.Columns))
 		for i, col := range s.Columns {
 			plan.Columns[i] = fmt.Sprintf("%s %s", col.Name, col.Type)
+			if col.PrimaryKey {
+				plan.Columns[i] += " PRIMARY KEY"
+			} else if !col.Nullable {
+				plan.Columns[i] += " NOT NULL"
+			}
+			if col.Default != nil {
+				plan.Columns[i] += " DEFAULT " + formatValue(col.Default)
+			}
 		}
 	} else {
-		return nil, errors.New("invalid statement type")
+		return nil, fmt.Errorf("%s statements cannot be planned", stmt.Type)
 	}
 
+	if storage != nil {
+		if err := stmt.CheckSupported(storage.Capabilities()); err != nil {
+			return nil, err
+		}
+	}
 	return plan, nil
 }
 
@@ -35,9 +35,7 @@ func TestCreatePlan(t *testing.T) {
 				Type:    "SELECT",
 				Table:   "users",
 				Columns: []string{"name"},
-				Where: map[string]interface{}{
-					"id": float64(1),
-				},
+				Where:   types.Condition("id", int64(1)),
 				Storage: store,
 			},
 		},
@@ -48,6 +46,38 @@ func TestCreatePlan(t *testing.T) {
 				Type:    "CREATE",
 				Table:   "users",
 				Columns: []string{"id INT", "name TEXT"},
+				Schema: &types.Table{Name: "users", Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT", Nullable: true},
+					{Name: "name", Type: "TEXT", Nullable: true},
+				}},
+				Storage: store,
+			},
+		},
+		{
+			name: "Create table plan with NOT NULL",
+			sql:  "CREATE TABLE users (id INT NOT NULL, name TEXT)",
+			want: &Plan{
+				Type:    "CREATE",
+				Table:   "users",
+				Columns: []string{"id INT NOT NULL", "name TEXT"},
+				Schema: &types.Table{Name: "users", Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT"},
+					{Name: "name", Type: "TEXT", Nullable: true},
+				}},
+				Storage: store,
+			},
+		},
+		{
+			name: "Create table plan with DEFAULT",
+			sql:  "CREATE TABLE users (id INT PRIMARY KEY, status TEXT DEFAULT 'active')",
+			want: &Plan{
+				Type:    "CREATE",
+				Table:   "users",
+				Columns: []string{"id INT PRIMARY KEY", "status TEXT DEFAULT 'active'"},
+				Schema: &types.Table{Name: "users", Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT", PrimaryKey: true},
+					{Name: "status", Type: "TEXT", Nullable: true, Default: "active"},
+				}},
 				Storage: store,
 			},
 		},
@@ -103,7 +133,7 @@ func TestPlanExecution(t *testing.T) {
 	assert.Equal(t, "SELECT", plan.Type)
 	assert.Equal(t, "users", plan.Table)
 	assert.Equal(t, []string{"*"}, plan.Columns)
-	assert.Equal(t, float64(1), plan.Where["id"])
+	assert.Equal(t, types.Condition("id", int64(1)), plan.Where)
 }
 
 func TestPlanOptimization(t *testing.T) {
@@ -145,5 +175,5 @@ func TestPlanOptimization(t *testing.T) {
 	plan, err = CreatePlan(stmt, store)
 	assert.NoError(t, err)
 	assert.NotNil(t, plan.Where)
-	assert.Equal(t, float64(1), plan.Where["id"])
+	assert.Equal(t, types.And(types.Condition("id", int64(1)), types.Condition("age", types.Comparison{Operator: ">", Value: int64(20)})), plan.Where)
 }
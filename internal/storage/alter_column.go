@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// alterProgressInterval is how many rows ALTER COLUMN converts between
+// progress callbacks
+const alterProgressInterval = 1000
+
+// columnIndex returns the position of a column in the table, or -1
+func columnIndex(table *types.Table, column string) int {
+	for i, col := range table.Columns {
+		if col.Name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// AlterColumnType implements types.ColumnTypeChanger. The rows are
+// converted into a copy, so the table is only changed once every value has
+// converted.
+func (s *InMemoryStorage) AlterColumnType(tableName, column, newType string, progress func(converted int)) error {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	idx := columnIndex(table, column)
+	if idx < 0 {
+		return fmt.Errorf("column %s does not exist in table %s", column, tableName)
+	}
+	def, err := types.ConvertColumnValue(column, newType, table.Columns[idx].Default)
+	if err != nil {
+		return fmt.Errorf("DEFAULT: %w", err)
+	}
+
+	converted := make([]interface{}, len(table.Rows))
+	for i, row := range table.Rows {
+		if converted[i], err = types.ConvertColumnValue(column, newType, row[column]); err != nil {
+			return err
+		}
+		if progress != nil && (i+1)%alterProgressInterval == 0 {
+			progress(i + 1)
+		}
+	}
+
+	for i, row := range table.Rows {
+		if _, ok := row[column]; ok {
+			row[column] = converted[i]
+		}
+	}
+	table.Columns[idx].Type = newType
+	table.Columns[idx].Default = def
+	s.reindex(table)
+	return nil
+}
+
+// AlterColumnType implements types.ColumnTypeChanger. Every row is
+// converted before any is written; the rows are then rewritten in place and
+// the new type is written to the table metadata last, so a crash part way
+// leaves the old type on rows whose values it still accepts.
+func (s *BTreeStorage) AlterColumnType(tableName, column, newType string, progress func(converted int)) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	idx := columnIndex(table, column)
+	if idx < 0 {
+		return fmt.Errorf("column %s does not exist in table %s", column, tableName)
+	}
+	def, err := types.ConvertColumnValue(column, newType, table.Columns[idx].Default)
+	if err != nil {
+		return fmt.Errorf("DEFAULT: %w", err)
+	}
+
+	rewrites := make(map[string]types.Row)
+	scanned := 0
+	err = s.scanRows(tableName, func(key string, row types.Row) error {
+		scanned++
+		if progress != nil && scanned%alterProgressInterval == 0 {
+			progress(scanned)
+		}
+		val, ok := row[column]
+		if !ok {
+			return nil
+		}
+		converted, err := types.ConvertColumnValue(column, newType, val)
+		if err != nil {
+			return err
+		}
+		row[column] = converted
+		rewrites[key] = row
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.rewriteRows(tableName, rewrites); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Replace the definition rather than changing it, since row operations
+	// read it without the catalog lock
+	current := s.tables[tableName]
+	updated := *current
+	updated.Columns = append([]types.ColumnDefinition(nil), current.Columns...)
+	updated.Columns[idx].Type = newType
+	updated.Columns[idx].Default = def
+	if err := s.writeTable(&updated); err != nil {
+		s.tables[tableName] = current
+		return err
+	}
+	return nil
+}
+
+// rewriteRows replaces the stored values of existing row keys in one pass
+// over the table's data pages. A row that no longer fits its page is moved
+// to one with room, keeping its key.
+func (s *BTreeStorage) rewriteRows(tableName string, rows map[string]types.Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	values := make(map[string][]byte, len(rows))
+	for key, row := range rows {
+		value, err := encodeRow(row)
+		if err != nil {
+			return err
+		}
+		values[key] = value
+	}
+
+	moved, err := s.rewritePages(tableName, values)
+	if err != nil {
+		return err
+	}
+	for _, key := range moved {
+		if err := s.insert(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewritePages writes the new values into the pages holding their keys.
+// Rows that do not fit are removed from their page and returned, for the
+// caller to insert again. The new values can change the primary key of
+// rows or move them, so the table's primary key index is dropped.
+func (s *BTreeStorage) rewritePages(tableName string, values map[string][]byte) ([]string, error) {
+	defer s.changed(tableName)
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+	if s.file == nil {
+		return nil, fmt.Errorf("BTree file is closed")
+	}
+	s.dropIndex(tableName)
+
+	var moved []string
+	chain, err := s.pageChain(s.tablePageOffset(tableName))
+	if err != nil {
+		return nil, err
+	}
+	page := make([]byte, s.pageSize)
+	for _, offset := range chain {
+		n, err := s.pages.readAt(page, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+
+		keys, pageValues := decodeDataPage(page)
+		changed := false
+		for i, key := range keys {
+			if value, ok := values[key]; ok {
+				pageValues[i] = value
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		next := pageNext(page)
+		encoded, err := encodeDataPage(keys, pageValues, next, s.pageSize)
+		for err != nil && len(keys) > 0 {
+			// Move the last rewritten row off the page until the rest fit
+			last := -1
+			for i, key := range keys {
+				if _, ok := values[key]; ok {
+					last = i
+				}
+			}
+			if last < 0 {
+				return nil, err
+			}
+			moved = append(moved, keys[last])
+			keys = append(keys[:last:last], keys[last+1:]...)
+			pageValues = append(pageValues[:last:last], pageValues[last+1:]...)
+			encoded, err = encodeDataPage(keys, pageValues, next, s.pageSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.pages.writeAt(encoded, offset); err != nil {
+			return nil, err
+		}
+	}
+	return moved, s.pages.sync()
+}
+
+// SetColumnMask implements types.ColumnMasker
+func (s *InMemoryStorage) SetColumnMask(tableName, column, policy string) error {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	idx := columnIndex(table, column)
+	if idx < 0 {
+		return fmt.Errorf("column %s does not exist in table %s", column, tableName)
+	}
+	table.Columns[idx].Mask = policy
+	return nil
+}
+
+// SetColumnMask implements types.ColumnMasker by storing the policy in the
+// table metadata
+func (s *BTreeStorage) SetColumnMask(tableName, column, policy string) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	idx := columnIndex(current, column)
+	if idx < 0 {
+		return fmt.Errorf("column %s does not exist in table %s", column, tableName)
+	}
+
+	updated := *current
+	updated.Columns = append([]types.ColumnDefinition(nil), current.Columns...)
+	updated.Columns[idx].Mask = policy
+	if err := s.writeTable(&updated); err != nil {
+		s.tables[tableName] = current
+		return err
+	}
+	return nil
+}
+
+// AddColumn implements types.ColumnAdder
+func (s *InMemoryStorage) AddColumn(tableName string, col types.ColumnDefinition) error {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := types.CheckAddColumn(table, col); err != nil {
+		return err
+	}
+	value, err := types.CanonicalValue(col.Type, col.Default)
+	if err != nil {
+		return err
+	}
+	if value != nil {
+		for _, row := range table.Rows {
+			row[col.Name] = value
+		}
+	}
+	table.Columns = append(table.Columns, col)
+	return nil
+}
+
+// AddColumn implements types.ColumnAdder. The table file is rewritten with
+// the new column and, if it has a DEFAULT, the value on every row.
+func (s *JSONStorage) AddColumn(tableName string, col types.ColumnDefinition) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	table, err := s.existingTable(tableName)
+	if err != nil {
+		return err
+	}
+	if err := types.CheckAddColumn(table, col); err != nil {
+		return err
+	}
+
+	value, err := types.CanonicalValue(col.Type, col.Default)
+	if err != nil {
+		return err
+	}
+
+	table.Columns = append(table.Columns, col)
+	if value != nil {
+		for _, row := range table.Rows {
+			row[col.Name] = value
+		}
+	}
+	if err := s.saveTable(table); err != nil {
+		table.Columns = table.Columns[:len(table.Columns)-1]
+		for _, row := range table.Rows {
+			delete(row, col.Name)
+		}
+		return fmt.Errorf("failed to save tables: %v", err)
+	}
+	return nil
+}
+
+// AddColumn implements types.ColumnAdder. A column without a DEFAULT only
+// changes the table metadata, since a row without a value for a column
+// reads as NULL. Otherwise the metadata is written first and the DEFAULT
+// is then stored on every row, so a crash part way leaves NULL on the rows
+// not rewritten yet.
+func (s *BTreeStorage) AddColumn(tableName string, col types.ColumnDefinition) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	if _, err := s.lookup(tableName); err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.mu.Lock()
+	current := s.tables[tableName]
+	if err := types.CheckAddColumn(current, col); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	updated := *current
+	updated.Columns = append(append([]types.ColumnDefinition(nil), current.Columns...), col)
+	if err := s.writeTable(&updated); err != nil {
+		s.tables[tableName] = current
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	if col.Default == nil {
+		return nil
+	}
+	rewrites := make(map[string]types.Row)
+	err := s.scanRows(tableName, func(key string, row types.Row) error {
+		row[col.Name] = col.Default
+		rewrites[key] = row
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.rewriteRows(tableName, rewrites)
+}
@@ -0,0 +1,222 @@
+package storage_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func columnType(s types.Storage, table, column string) string {
+	for _, col := range s.GetTable(table).Columns {
+		if col.Name == column {
+			return col.Type
+		}
+	}
+	return ""
+}
+
+func TestAlterColumnTypeWidens(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		createLogs(t, s, 1, 2, 3)
+		assert.NoError(t, s.Insert("logs", map[string]interface{}{"msg": "no id"}))
+
+		changer := s.(types.ColumnTypeChanger)
+		assert.NoError(t, changer.AlterColumnType("logs", "id", "STRING", nil), name)
+		assert.Equal(t, "STRING", columnType(s, "logs", "id"), name)
+
+		// New rows take the new type alongside the converted ones
+		assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": "abc-4", "msg": "m"}), name)
+		rows, err := s.Select("logs", []string{"id"}, nil)
+		assert.NoError(t, err, name)
+		var ids []interface{}
+		for _, row := range rows {
+			ids = append(ids, row["id"])
+		}
+		assert.ElementsMatch(t, []interface{}{"1", "2", "3", nil, "abc-4"}, ids, name)
+	}
+}
+
+func TestAlterColumnTypeConversions(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		assert.NoError(t, s.CreateTable(&types.Table{
+			Name: "orders",
+			Columns: []types.ColumnDefinition{
+				{Name: "ok", Type: "BOOLEAN", Default: true},
+				{Name: "qty", Type: "INT", Nullable: true},
+				{Name: "flag", Type: "STRING", Nullable: true},
+				{Name: "placed", Type: "TIMESTAMP", Nullable: true},
+				{Name: "due", Type: "DATE", Nullable: true},
+			},
+		}), name)
+		assert.NoError(t, s.Insert("orders", map[string]interface{}{
+			"ok": false, "qty": 3, "flag": "true", "placed": "2024-05-01 10:30:00", "due": "2024-06-01",
+		}), name)
+
+		changer := s.(types.ColumnTypeChanger)
+		for column, newType := range map[string]string{
+			"ok": "STRING", "qty": "FLOAT", "flag": "BOOLEAN", "placed": "DATE", "due": "TIMESTAMP",
+		} {
+			assert.NoError(t, changer.AlterColumnType("orders", column, newType, nil), name)
+		}
+		rows, err := s.Select("orders", []string{"*"}, nil)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []types.Row{{
+			"ok": "false", "qty": float64(3), "flag": true, "placed": "2024-05-01", "due": "2024-06-01T00:00:00Z",
+		}}, rows, name)
+
+		// The DEFAULT is converted with the rows
+		assert.Equal(t, "true", s.GetTable("orders").Columns[0].Default, name)
+
+		err = changer.AlterColumnType("orders", "ok", "BOOLEAN", nil)
+		assert.NoError(t, err, name)
+		err = changer.AlterColumnType("orders", "placed", "BOOLEAN", nil)
+		assert.EqualError(t, err, `column placed: value "2024-05-01" cannot be converted to BOOLEAN`, name)
+	}
+}
+
+func TestAlterColumnTypeIntToFloatPrecision(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		createLogs(t, s, 1)
+		assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": int64(1<<53 + 1), "msg": "big"}), name)
+
+		// INT to FLOAT needs no USING, but a value FLOAT would round fails it
+		err := s.(types.ColumnTypeChanger).AlterColumnType("logs", "id", "FLOAT", nil)
+		assert.EqualError(t, err, "column id: value 9007199254740993 cannot be converted to FLOAT", name)
+		assert.Equal(t, "INT", columnType(s, "logs", "id"), name)
+		rows, err := s.Select("logs", []string{"id"}, types.WhereAll(map[string]interface{}{"msg": "big"}))
+		assert.NoError(t, err, name)
+		assert.Equal(t, []types.Row{{"id": int64(1<<53 + 1)}}, rows, name)
+
+		// 2^53 itself is exact
+		_, err = s.Delete("logs", types.WhereAll(map[string]interface{}{"msg": "big"}))
+		assert.NoError(t, err, name)
+		assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": int64(1 << 53), "msg": "big"}), name)
+		assert.NoError(t, s.(types.ColumnTypeChanger).AlterColumnType("logs", "id", "FLOAT", nil), name)
+		rows, err = s.Select("logs", []string{"id"}, types.WhereAll(map[string]interface{}{"msg": "big"}))
+		assert.NoError(t, err, name)
+		assert.Equal(t, []types.Row{{"id": float64(1 << 53)}}, rows, name)
+	}
+}
+
+func TestAlterColumnTypeNarrowingFailure(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		createLogs(t, s, 1)
+		assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 2, "msg": "12"}))
+
+		err := s.(types.ColumnTypeChanger).AlterColumnType("logs", "msg", "INT", nil)
+		assert.EqualError(t, err, `column msg: value "m" cannot be converted to INT`, name)
+
+		// A failed conversion leaves the type and the rows as they were
+		assert.Equal(t, "STRING", columnType(s, "logs", "msg"), name)
+		rows, err := s.Select("logs", []string{"msg"}, types.WhereAll(map[string]interface{}{"msg": "12"}))
+		assert.NoError(t, err, name)
+		assert.Len(t, rows, 1, name)
+	}
+}
+
+func TestBTreeAlterColumnTypePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alter.db")
+	s, err := storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	createLogs(t, s, 1, 2)
+
+	var reported []int
+	assert.NoError(t, s.AlterColumnType("logs", "id", "TEXT", func(converted int) {
+		reported = append(reported, converted)
+	}))
+	assert.Empty(t, reported)
+	assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": "three", "msg": "m"}))
+	assert.NoError(t, s.Close())
+
+	s, err = storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.Equal(t, "TEXT", columnType(s, "logs", "id"))
+	rows, err := s.Select("logs", []string{"id"}, nil)
+	assert.NoError(t, err)
+	var ids []interface{}
+	for _, row := range rows {
+		ids = append(ids, row["id"])
+	}
+	assert.ElementsMatch(t, []interface{}{"1", "2", "three"}, ids)
+}
+
+func TestBTreeColumnMaskPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mask.db")
+	s, err := storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	createLogs(t, s, 1)
+	assert.NoError(t, s.SetColumnMask("logs", "msg", "partial(1)"))
+	assert.EqualError(t, s.SetColumnMask("logs", "level", "full"), "column level does not exist in table logs")
+	assert.NoError(t, s.Close())
+
+	s, err = storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, "partial(1)", s.GetTable("logs").Columns[1].Mask)
+
+	rows, err := s.Select("logs", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "m*****", types.MaskRows(s.GetTable("logs"), rows)[0]["msg"])
+	assert.Equal(t, "m", rows[0]["msg"], "masking copies the rows")
+}
+
+func TestAddColumn(t *testing.T) {
+	dir := t.TempDir()
+	open := map[string]func() storage.Storage{
+		"InMemory": func() storage.Storage { return storage.NewInMemoryStorage() },
+		"JSON": func() storage.Storage {
+			s, err := storage.NewJSONStorage(dir, "add")
+			assert.NoError(t, err)
+			return s
+		},
+		"BTree": func() storage.Storage {
+			s, err := storage.NewBTreeStorage(filepath.Join(dir, "add.db"))
+			assert.NoError(t, err)
+			return s
+		},
+	}
+
+	for name, open := range open {
+		s := open()
+		assert.NoError(t, s.CreateTable(&types.Table{
+			Name:    "users",
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: false}, {Name: "name", Type: "STRING", Nullable: true}},
+		}), name)
+		for i, user := range []string{"ann", "bob"} {
+			assert.NoError(t, s.Insert("users", map[string]interface{}{"id": i + 1, "name": user}), name)
+		}
+
+		adder := s.(types.ColumnAdder)
+		assert.NoError(t, adder.AddColumn("users", types.ColumnDefinition{Name: "phone", Type: "STRING", Nullable: true}), name)
+		assert.NoError(t, adder.AddColumn("users", types.ColumnDefinition{Name: "level", Type: "INT", Nullable: false, Default: float64(1)}), name)
+		assert.EqualError(t, adder.AddColumn("users", types.ColumnDefinition{Name: "phone", Type: "TEXT", Nullable: true}), "column phone already exists in table users", name)
+		assert.EqualError(t, adder.AddColumn("users", types.ColumnDefinition{Name: "age", Type: "INT", Nullable: false}), "NOT NULL column age needs a DEFAULT for the existing rows of table users", name)
+		assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 3, "name": "cy", "phone": "555", "level": 2}), name)
+
+		// The schema and the DEFAULT on the old rows survive reopening
+		if name != "InMemory" {
+			assert.NoError(t, s.Close(), name)
+			s = open()
+		}
+		var columns []string
+		for _, col := range s.GetTable("users").Columns {
+			columns = append(columns, col.Name)
+		}
+		assert.Equal(t, []string{"id", "name", "phone", "level"}, columns, name)
+
+		rows, err := s.Select("users", []string{"id", "phone", "level"}, nil)
+		assert.NoError(t, err, name)
+		var got []string
+		for _, row := range rows {
+			got = append(got, fmt.Sprint(row["id"], " ", row["phone"], " ", row["level"]))
+		}
+		assert.ElementsMatch(t, []string{"1 <nil> 1", "2 <nil> 1", "3 555 2"}, got, name)
+		assert.NoError(t, s.Close(), name)
+	}
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+)
+
+// The catalog holds every table definition under a "__table__"+name key,
+// in the data page format. It starts on the metadata page and continues on
+// the pages chained to it. The first page without entries ends it.
+
+// readCatalogPage reads the catalog page at offset into page and returns
+// the number of entries its header claims. The caller must hold pageMu.
+func (s *BTreeStorage) readCatalogPage(page []byte, offset int64) (int, error) {
+	n, err := s.pages.readAt(page, offset)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	if n > 0 {
+		atomic.AddInt64(&s.pageReads, 1)
+	}
+	for j := n; j < len(page); j++ {
+		page[j] = 0
+	}
+	if n < headerSize {
+		return 0, nil
+	}
+	return int(binary.BigEndian.Uint64(page[0:])), nil
+}
+
+// readCatalog returns the entries of every catalog page. The caller must
+// hold pageMu.
+func (s *BTreeStorage) readCatalog() ([]string, [][]byte, error) {
+	if s.file == nil {
+		return nil, nil, fmt.Errorf("BTree file is closed")
+	}
+	chain, err := s.pageChain(metadataPageOffset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []string
+	var values [][]byte
+	page := make([]byte, s.pageSize)
+	for _, offset := range chain {
+		n, err := s.readCatalogPage(page, offset)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n == 0 {
+			break
+		}
+		pageKeys, pageValues := decodeDataPage(page)
+		keys = append(keys, pageKeys...)
+		values = append(values, pageValues...)
+	}
+	return keys, values, nil
+}
+
+// writeCatalog packs the entries onto catalog pages in order, chaining new
+// pages if the catalog outgrew its chain. The page after the last one is
+// emptied if it holds entries of a longer catalog. The caller must hold
+// pageMu.
+func (s *BTreeStorage) writeCatalog(keys []string, values [][]byte) error {
+	capacity := int(s.pageSize) - headerSize
+	starts := []int{0} // index of the first entry on each page
+	used := 0
+	for i := range keys {
+		size := 8 + len(keys[i]) + len(values[i])
+		if size > capacity {
+			return fmt.Errorf("definition of table %s does not fit in a %d-byte page", strings.TrimPrefix(keys[i], "__table__"), s.pageSize)
+		}
+		if used+size > capacity {
+			starts = append(starts, i)
+			used = 0
+		}
+		used += size
+	}
+	starts = append(starts, len(keys))
+
+	pages := len(starts) - 1
+	chain, err := s.pageChain(metadataPageOffset)
+	if err != nil {
+		return err
+	}
+	if extra := pages - len(chain); extra > 0 {
+		first := s.allocPage()
+		chain = append(chain[:len(chain):len(chain)], make([]int64, extra)...)
+		for p := 0; p < extra; p++ {
+			chain[len(chain)-extra+p] = first + int64(p)*s.pageSize
+		}
+	}
+	next := func(p int) int64 {
+		if p+1 < len(chain) {
+			return chain[p+1]
+		}
+		return 0
+	}
+
+	// Pages are written last to first, so a page is only linked once the
+	// pages after it are written
+	if pages < len(chain) {
+		n, err := s.readCatalogPage(make([]byte, s.pageSize), chain[pages])
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			empty, err := encodeDataPage(nil, nil, next(pages), s.pageSize)
+			if err != nil {
+				return err
+			}
+			if err := s.pages.writeAt(empty, chain[pages]); err != nil {
+				return err
+			}
+		}
+	}
+	for p := pages - 1; p >= 0; p-- {
+		encoded, err := encodeDataPage(keys[starts[p]:starts[p+1]], values[starts[p]:starts[p+1]], next(p), s.pageSize)
+		if err != nil {
+			return err
+		}
+		if err := s.pages.writeAt(encoded, chain[p]); err != nil {
+			return err
+		}
+	}
+	s.setPageChain(metadataPageOffset, chain)
+	return s.pages.sync()
+}
+
+// putCatalogEntry adds or replaces a table definition in the catalog. The
+// caller must hold pageMu.
+func (s *BTreeStorage) putCatalogEntry(key string, value []byte) error {
+	keys, values, err := s.readCatalog()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range keys {
+		if keys[i] == key {
+			values[i] = value
+			replaced = true
+		}
+	}
+	if !replaced {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return s.writeCatalog(keys, values)
+}
+
+// removeTableMetadata removes the definition of tableName from the
+// catalog. The caller must hold the catalog write lock.
+func (s *BTreeStorage) removeTableMetadata(tableName string) error {
+	defer s.changed(tableName)
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+
+	keys, values, err := s.readCatalog()
+	if err != nil {
+		return err
+	}
+	var keptKeys []string
+	var keptValues [][]byte
+	for i, key := range keys {
+		if key != "__table__"+tableName {
+			keptKeys = append(keptKeys, key)
+			keptValues = append(keptValues, values[i])
+		}
+	}
+	if len(keptKeys) == len(keys) {
+		return nil
+	}
+	return s.writeCatalog(keptKeys, keptValues)
+}
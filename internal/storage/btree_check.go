@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// checkProgressInterval is how many rows CHECK TABLE scans between progress
+// callbacks
+const checkProgressInterval = 1000
+
+// tablePageOffset returns the offset of the first data page of a table.
+// Rows are spread over pages by a hash of the table name, followed by
+// overflow pages.
+func (s *BTreeStorage) tablePageOffset(tableName string) int64 {
+	// Unsigned, so that a long name cannot wrap to a negative page
+	var tableHash uint64
+	for _, c := range tableName {
+		tableHash = tableHash*31 + uint64(c)
+	}
+	pageIndex := 1 + (tableHash % 100)
+	return fileHeaderSize + s.pageSize*int64(pageIndex)
+}
+
+// CheckTable validates every stored row of a table against its schema.
+// Rows are stored as schemaless JSON, so they can carry fields that are no
+// longer columns or lack NOT NULL columns. With repair set, the offending
+// rows are rewritten in place with unknown fields dropped and missing
+// values filled with their column's DEFAULT; missing values of columns
+// without one are only reported.
+func (s *BTreeStorage) CheckTable(tableName string, repair bool, progress func(scanned int)) (*types.CheckReport, error) {
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.locks.get(tableName)
+	if repair {
+		lock.Lock()
+		defer lock.Unlock()
+	} else {
+		lock.RLock()
+		defer lock.RUnlock()
+	}
+
+	report := &types.CheckReport{Table: tableName}
+	repairs := make(map[string]types.Row)
+	err = s.scanRows(tableName, func(key string, row types.Row) error {
+		drift := types.CheckRowSchema(table, row)
+		report.Add(key, drift)
+		if repair && repairRow(table, row, drift) {
+			repairs[key] = row
+		}
+		if progress != nil && report.RowsScanned%checkProgressInterval == 0 {
+			progress(report.RowsScanned)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, row := range repairs {
+		if err := s.rewriteRow(tableName, key, row); err != nil {
+			return report, fmt.Errorf("failed to repair row %s: %w", key, err)
+		}
+		report.Repaired++
+	}
+
+	return report, nil
+}
+
+// repairRow drops the unknown fields of row and fills its missing values
+// that have a DEFAULT, reporting whether it changed anything
+func repairRow(table *types.Table, row types.Row, drift types.RowDrift) bool {
+	changed := false
+	for _, field := range drift.Unknown {
+		delete(row, field)
+		changed = true
+	}
+	for _, name := range drift.Missing {
+		col := table.Columns[columnIndex(table, name)]
+		if col.Default != nil {
+			row[name] = col.Default
+			changed = true
+		}
+	}
+	return changed
+}
+
+// rewriteRow replaces the stored value of an existing row key in place
+func (s *BTreeStorage) rewriteRow(tableName, key string, row types.Row) error {
+	defer s.changed(tableName)
+	value, err := encodeRow(row)
+	if err != nil {
+		return err
+	}
+
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("BTree file is closed")
+	}
+
+	chain, err := s.pageChain(s.tablePageOffset(tableName))
+	if err != nil {
+		return err
+	}
+	page := make([]byte, s.pageSize)
+	for _, offset := range chain {
+		n, err := s.pages.readAt(page, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		keys, values := decodeDataPage(page)
+		for i := range keys {
+			if keys[i] != key {
+				continue
+			}
+			values[i] = value
+			encoded, err := encodeDataPage(keys, values, pageNext(page), s.pageSize)
+			if err != nil {
+				return err
+			}
+			if err := s.pages.writeAt(encoded, offset); err != nil {
+				return err
+			}
+			return s.pages.sync()
+		}
+	}
+
+	return fmt.Errorf("row %s not found", key)
+}
+
+// decodeDataPage returns the keys and values stored in a data page
+func decodeDataPage(page []byte) ([]string, [][]byte) {
+	numKeys := int(binary.BigEndian.Uint64(page[0:]))
+	offset := int64(headerSize)
+	size := int64(len(page))
+
+	var keys []string
+	var values [][]byte
+	for i := 0; i < numKeys; i++ {
+		if offset+4 > size {
+			break
+		}
+		keyLen := int64(binary.BigEndian.Uint32(page[offset:]))
+		offset += 4
+		if offset+keyLen+4 > size {
+			break
+		}
+		key := string(page[offset : offset+keyLen])
+		offset += keyLen
+
+		valueLen := int64(binary.BigEndian.Uint32(page[offset:]))
+		offset += 4
+		if offset+valueLen > size {
+			break
+		}
+		value := make([]byte, valueLen)
+		copy(value, page[offset:offset+valueLen])
+		offset += valueLen
+
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+// encodeDataPage serializes keys and values into a leaf data page linked
+// to the page at offset next
+func encodeDataPage(keys []string, values [][]byte, next int64, pageSize int64) ([]byte, error) {
+	page := make([]byte, pageSize)
+	binary.BigEndian.PutUint64(page[0:], uint64(len(keys)))
+	binary.BigEndian.PutUint64(page[8:], 1) // isLeaf = true
+	binary.BigEndian.PutUint64(page[nextPagePosition:], uint64(next))
+
+	offset := int64(headerSize)
+	for i := range keys {
+		if offset+8+int64(len(keys[i])+len(values[i])) > pageSize {
+			return nil, fmt.Errorf("data page overflow")
+		}
+		binary.BigEndian.PutUint32(page[offset:], uint32(len(keys[i])))
+		offset += 4
+		offset += int64(copy(page[offset:], keys[i]))
+		binary.BigEndian.PutUint32(page[offset:], uint32(len(values[i])))
+		offset += 4
+		offset += int64(copy(page[offset:], values[i]))
+	}
+	return page, nil
+}
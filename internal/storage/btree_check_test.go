@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestBTreeCheckTable(t *testing.T) {
+	s, err := NewBTreeStorage(filepath.Join(t.TempDir(), "check.btree"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	err = s.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	})
+	assert.NoError(t, err)
+
+	// Fabricate drifted rows below the validating Insert path
+	assert.NoError(t, s.insertRow("employees", types.Row{"id": 1, "name": "Ann"}))
+	assert.NoError(t, s.insertRow("employees", types.Row{"id": 2, "name": "Bob", "legacy_code": "X1"}))
+	assert.NoError(t, s.insertRow("employees", types.Row{"name": "Cid"}))
+	assert.NoError(t, s.insertRow("employees", types.Row{"id": "two", "name": "Dee"}))
+
+	var progress []int
+	report, err := s.CheckTable("employees", false, func(scanned int) { progress = append(progress, scanned) })
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.RowsScanned)
+	assert.Equal(t, 1, report.UnknownFields)
+	assert.Equal(t, 1, report.MissingColumns)
+	assert.Equal(t, 1, report.TypeMismatches)
+	assert.Len(t, report.Samples, 3)
+	assert.Equal(t, 0, report.Repaired)
+	assert.False(t, report.OK())
+	assert.Empty(t, progress, "fewer rows than the progress interval")
+
+	// REPAIR drops unknown fields; the missing id has no default to use
+	report, err = s.CheckTable("employees", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Repaired)
+
+	report, err = s.CheckTable("employees", false, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.UnknownFields)
+	assert.Equal(t, 1, report.MissingColumns)
+
+	rows, err := s.Select("employees", []string{"*"}, types.WhereAll(map[string]interface{}{"name": "Bob"}))
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.NotContains(t, rows[0], "legacy_code")
+		assert.Equal(t, int64(2), rows[0]["id"])
+	}
+
+	_, err = s.CheckTable("missing", false, nil)
+	assert.Error(t, err)
+}
+
+func TestBTreeCheckTableRepairsDefaults(t *testing.T) {
+	s, err := NewBTreeStorage(filepath.Join(t.TempDir(), "check.btree"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "accounts",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "level", Type: "INT", Default: int64(1)},
+		},
+	}))
+	assert.NoError(t, s.insertRow("accounts", types.Row{"id": 1}))
+	assert.NoError(t, s.insertRow("accounts", types.Row{"id": 2, "level": nil}))
+	assert.NoError(t, s.insertRow("accounts", types.Row{"id": 3, "level": 5}))
+
+	report, err := s.CheckTable("accounts", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.MissingColumns)
+	assert.Equal(t, 2, report.Repaired)
+
+	report, err = s.CheckTable("accounts", false, nil)
+	assert.NoError(t, err)
+	assert.True(t, report.OK())
+	rows, err := s.Select("accounts", []string{"id", "level"}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "level": int64(1)},
+		{"id": int64(2), "level": int64(1)},
+		{"id": int64(3), "level": int64(5)},
+	}, rows)
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// primaryKeyIndex maps the primary key values of a table's rows to the
+// data pages holding them. Rows are appended to their table's page chain
+// in insertion order, not sorted by key, so without it finding a row by
+// key means reading every page of the chain.
+//
+// An index is built by one scan of the chain, the first time a table is
+// searched by key, and kept up to date by inserts. Rewrites that can move
+// rows or change their key drop it, to be rebuilt on the next search.
+// Deletes leave it alone: a page that no longer holds a row only costs a
+// read, since the rows of the pages read are matched against the WHERE
+// clause anyway.
+type primaryKeyIndex struct {
+	pages map[string][]int64
+}
+
+func (idx *primaryKeyIndex) add(value string, offset int64) {
+	for _, existing := range idx.pages[value] {
+		if existing == offset {
+			return
+		}
+	}
+	idx.pages[value] = append(idx.pages[value], offset)
+}
+
+// indexValue returns the key a value is indexed under.
+// Numbers are keyed by their float64 value, as types.ValuesEqual compares
+// them, so an int64 stored in an INT column is found by an int or float64
+// a Go caller passes for it. Only numbers and strings are indexed.
+func indexValue(value interface{}) (string, bool) {
+	var f float64
+	switch v := value.(type) {
+	case string:
+		return "s" + v, true
+	case int:
+		f = float64(v)
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	case json.Number:
+		var err error
+		if f, err = v.Float64(); err != nil {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return "n" + strconv.FormatFloat(f, 'g', -1, 64), true
+}
+
+// keyLookup returns the value a WHERE clause requires the table's primary
+// key to equal, if it has a primary key and the clause such a condition
+func keyLookup(table *types.Table, where *types.WhereExpr) (interface{}, bool) {
+	key := table.PrimaryKey()
+	if key == "" {
+		return nil, false
+	}
+	value, ok := where.Equality(key)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := indexValue(value); !ok {
+		return nil, false
+	}
+	return value, true
+}
+
+// candidateRows returns the rows of a table that can match where: only
+// those on the pages holding the key for an equality on the primary key,
+// and otherwise every row. The caller must hold the table lock.
+func (s *BTreeStorage) candidateRows(table *types.Table, where *types.WhereExpr) ([]types.Row, error) {
+	if value, ok := keyLookup(table, where); ok {
+		return s.get(table, value)
+	}
+	return s.readRows(table.Name)
+}
+
+// get returns the rows of a table whose primary key equals value, reading
+// only the pages the index lists for it. The caller must hold the table
+// lock.
+func (s *BTreeStorage) get(table *types.Table, value interface{}) ([]types.Row, error) {
+	offsets, err := s.keyPages(table, value)
+	if err != nil {
+		return nil, err
+	}
+
+	key := table.PrimaryKey()
+	var rows []types.Row
+	page := s.pagePool.Get().([]byte)
+	defer s.pagePool.Put(page)
+	for _, offset := range offsets {
+		n, err := s.readPage(page, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		keys, values := decodeDataPage(page)
+		for i, rowKey := range keys {
+			if tableNameFromKey(rowKey) != table.Name {
+				continue
+			}
+			row, err := decodeRow(values[i], table)
+			if err != nil {
+				continue
+			}
+			if types.ValuesEqual(row[key], value) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// keyPages returns the offsets of the pages holding rows whose primary key
+// equals value, building the table's index first if it has none
+func (s *BTreeStorage) keyPages(table *types.Table, value interface{}) ([]int64, error) {
+	lookup, _ := indexValue(value)
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if idx, ok := s.pkIndexes[table.Name]; ok {
+		return idx.pages[lookup], nil
+	}
+
+	idx, err := s.buildPrimaryKeyIndex(table)
+	if err != nil {
+		return nil, err
+	}
+	s.pkIndexes[table.Name] = idx
+	return idx.pages[lookup], nil
+}
+
+// buildPrimaryKeyIndex indexes the rows of a table by reading its chain
+// once
+func (s *BTreeStorage) buildPrimaryKeyIndex(table *types.Table) (*primaryKeyIndex, error) {
+	chain, err := s.tableChain(table.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := table.PrimaryKey()
+	idx := &primaryKeyIndex{pages: make(map[string][]int64)}
+	page := s.pagePool.Get().([]byte)
+	defer s.pagePool.Put(page)
+	for _, offset := range chain {
+		n, err := s.readPage(page, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		keys, values := decodeDataPage(page)
+		for i, rowKey := range keys {
+			if tableNameFromKey(rowKey) != table.Name {
+				continue
+			}
+			row, err := decodeRow(values[i], table)
+			if err != nil {
+				continue
+			}
+			if value, ok := indexValue(row[key]); ok {
+				idx.add(value, offset)
+			}
+		}
+	}
+	return idx, nil
+}
+
+// indexRow adds a row just stored on the page at offset to its table's
+// index, if the table has one
+func (s *BTreeStorage) indexRow(table *types.Table, row types.Row, offset int64) {
+	key := table.PrimaryKey()
+	if key == "" {
+		return
+	}
+	value, ok := indexValue(row[key])
+	if !ok {
+		return
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if idx, ok := s.pkIndexes[table.Name]; ok {
+		idx.add(value, offset)
+	}
+}
+
+// dropIndex forgets a table's index after its rows were rewritten
+func (s *BTreeStorage) dropIndex(tableName string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	delete(s.pkIndexes, tableName)
+}
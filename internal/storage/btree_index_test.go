@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// fillKeyedTable creates a table of rows with ids 0 to rows-1, with id as
+// its primary key if keyed is set
+func fillKeyedTable(t testing.TB, s *BTreeStorage, name string, keyed bool, rows int) {
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: name,
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", PrimaryKey: keyed},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	}))
+	batch := make([]map[string]interface{}, rows)
+	for i := range batch {
+		batch[i] = map[string]interface{}{"id": i, "name": fmt.Sprintf("row%d", i)}
+	}
+	assert.NoError(t, s.InsertRows(name, batch))
+}
+
+func TestBTreePrimaryKeyLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	s, err := NewBTreeStorageWithPageSize(path, minPageSize)
+	assert.NoError(t, err)
+	fillKeyedTable(t, s, "employees", true, 200)
+	chain, err := s.tableChain("employees")
+	assert.NoError(t, err)
+	assert.Greater(t, len(chain), 10)
+
+	lookup := func(id interface{}) ([]types.Row, int64) {
+		reads := s.PageReads()
+		rows, err := s.Select("employees", []string{"name"}, types.WhereAll(map[string]interface{}{"id": id}))
+		assert.NoError(t, err)
+		return rows, s.PageReads() - reads
+	}
+
+	// The first lookup builds the index, later ones read a single page
+	rows, _ := lookup(7)
+	assert.Equal(t, []types.Row{{"name": "row7"}}, rows)
+	rows, reads := lookup(float64(150))
+	assert.Equal(t, []types.Row{{"name": "row150"}}, rows)
+	assert.Equal(t, int64(1), reads)
+	rows, reads = lookup(1000)
+	assert.Empty(t, rows)
+	assert.Equal(t, int64(0), reads)
+
+	// The other conditions still apply
+	rows, err = s.Select("employees", []string{"*"}, types.WhereAll(map[string]interface{}{"id": 7, "name": "row8"}))
+	assert.NoError(t, err)
+	assert.Empty(t, rows)
+	rows, err = s.Select("employees", []string{"COUNT(*)"}, types.WhereAll(map[string]interface{}{"id": 7}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"count": 1}}, rows)
+
+	// Inserts keep the index up to date, updates and deletes are seen
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 500, "name": "new"}))
+	rows, reads = lookup(500)
+	assert.Equal(t, []types.Row{{"name": "new"}}, rows)
+	assert.Equal(t, int64(1), reads)
+	assert.Equal(t, 1, rowsAffected(t)(s.Update("employees", map[string]interface{}{"id": 700}, types.WhereAll(map[string]interface{}{"id": 7}))))
+	rows, _ = lookup(7)
+	assert.Empty(t, rows)
+	rows, _ = lookup(700)
+	assert.Equal(t, []types.Row{{"name": "row7"}}, rows)
+	assert.Equal(t, 1, rowsAffected(t)(s.Delete("employees", types.WhereAll(map[string]interface{}{"id": 150}))))
+	rows, _ = lookup(150)
+	assert.Empty(t, rows)
+	assert.NoError(t, s.Close())
+
+	// The index is rebuilt from the file
+	s, err = NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	rows, _ = lookup(700)
+	assert.Equal(t, []types.Row{{"name": "row7"}}, rows)
+	rows, _ = lookup(42)
+	assert.Equal(t, []types.Row{{"name": "row42"}}, rows)
+}
+
+func BenchmarkBTreePointLookup(b *testing.B) {
+	s, err := NewBTreeStorage(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+
+	// The same rows, scanned without a primary key and looked up with one
+	const rows = 10000
+	if err := s.SetPageCacheSize(4096); err != nil {
+		b.Fatal(err)
+	}
+	fillKeyedTable(b, s, "scanned", false, rows)
+	fillKeyedTable(b, s, "keyed", true, rows)
+
+	for _, table := range []string{"scanned", "keyed"} {
+		b.Run(table, func(b *testing.B) {
+			reads := s.PageReads()
+			for i := 0; i < b.N; i++ {
+				where := types.WhereAll(map[string]interface{}{"id": (i * 7919) % rows})
+				got, err := s.Select(table, []string{"name"}, where)
+				if err != nil || len(got) != 1 {
+					b.Fatalf("lookup %v: %v, %v", where, got, err)
+				}
+			}
+			b.ReportMetric(float64(s.PageReads()-reads)/float64(b.N), "preads/op")
+		})
+	}
+}
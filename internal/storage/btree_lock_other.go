@@ -0,0 +1,11 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFile is a no-op where flock is not available; the shutdown marker
+// then cannot tell a running process from a crashed one
+func lockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecondOpenIsRefused(t *testing.T) {
+	path, s := openCrashed(t)
+	marker, err := os.ReadFile(path + shutdownMarkerSuffix)
+	assert.NoError(t, err)
+
+	// The live file is neither repaired nor stripped of its marker
+	_, err = OpenBTreeStorage(path, 0, RecoveryOptions{})
+	assert.True(t, errors.Is(err, ErrFileLocked), "got %v", err)
+	after, err := os.ReadFile(path + shutdownMarkerSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, marker, after)
+
+	rows, err := s.Select("users", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.NoError(t, s.Close())
+
+	// The lock goes with the file, crashed or closed
+	s, err = NewBTreeStorage(path)
+	assert.NoError(t, err)
+	assert.Nil(t, s.LastRecovery())
+	crash(t, s)
+	s, err = NewBTreeStorage(path)
+	assert.NoError(t, err)
+	assert.NotNil(t, s.LastRecovery())
+	assert.NoError(t, s.Close())
+}
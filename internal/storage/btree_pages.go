@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Data and catalog pages are chained: a table's chain starts on its hashed
+// page (see tablePageOffset) and the catalog's on the metadata page, and
+// each page header holds the offset of the next page of its chain, or 0 on
+// the last one. Pages added to a chain are allocated past the end of the
+// file and never among the hashed pages, so a chain cannot run into another
+// table's pages. Tables whose names hash to the same page share a chain.
+const firstAllocatedPage = 101
+
+// pageNext returns the offset of the page after page in its chain
+func pageNext(page []byte) int64 {
+	return int64(binary.BigEndian.Uint64(page[nextPagePosition:]))
+}
+
+// allocPage returns the offset of a new page past the end of the file. The
+// caller must hold pageMu and write the page before allocating another.
+func (s *BTreeStorage) allocPage() int64 {
+	index := (s.pages.fileSize() - fileHeaderSize + s.pageSize - 1) / s.pageSize
+	if index < firstAllocatedPage {
+		index = firstAllocatedPage
+	}
+	return fileHeaderSize + index*s.pageSize
+}
+
+// validNext reports whether next can follow the page at offset in a chain:
+// a page-aligned offset inside the file, past offset since pages are
+// allocated at the end of the file
+func (s *BTreeStorage) validNext(offset, next int64) bool {
+	return next > offset && next < s.pages.fileSize() && (next-fileHeaderSize)%s.pageSize == 0
+}
+
+// pageChain returns the offsets of the pages in the chain starting at
+// head. Chains only grow, so the offsets are read from the page headers
+// once and kept. The caller must hold pageMu, for reading at least.
+func (s *BTreeStorage) pageChain(head int64) ([]int64, error) {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	if chain, ok := s.chains[head]; ok {
+		return chain, nil
+	}
+
+	chain := []int64{head}
+	page := make([]byte, s.pageSize)
+	for offset := head; ; {
+		n, err := s.pages.readAt(page, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n < headerSize {
+			break
+		}
+		atomic.AddInt64(&s.pageReads, 1)
+		next := pageNext(page)
+		if !s.validNext(offset, next) {
+			break
+		}
+		chain = append(chain, next)
+		offset = next
+	}
+	s.chains[head] = chain
+	return chain, nil
+}
+
+// setPageChain records the pages of the chain starting at head after the
+// caller linked new pages to it
+func (s *BTreeStorage) setPageChain(head int64, chain []int64) {
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	s.chains[head] = chain
+}
+
+// tableChain returns the offsets of a table's data pages
+func (s *BTreeStorage) tableChain(tableName string) ([]int64, error) {
+	s.pageMu.RLock()
+	defer s.pageMu.RUnlock()
+	if s.file == nil {
+		return nil, fmt.Errorf("BTree file is closed")
+	}
+	return s.pageChain(s.tablePageOffset(tableName))
+}
+
+// appendToChain stores key and value on the last page of the chain
+// starting at head, or on a new page linked after it if they do not fit.
+// The new page is written before the link to it, so an interrupted append
+// leaves an unreachable page rather than a broken chain. It returns the
+// offset of the page that took them. The caller must hold pageMu.
+func (s *BTreeStorage) appendToChain(head int64, key string, value []byte) (int64, error) {
+	chain, err := s.pageChain(head)
+	if err != nil {
+		return 0, err
+	}
+	tail := chain[len(chain)-1]
+	page := make([]byte, s.pageSize)
+	if _, err := s.pages.readAt(page, tail); err != nil && err != io.EOF {
+		return 0, err
+	}
+	keys, values := decodeDataPage(page)
+
+	encoded, err := encodeDataPage(append(keys, key), append(values, value), 0, s.pageSize)
+	if err == nil {
+		return tail, s.pages.writeAt(encoded, tail)
+	}
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("row %s does not fit in a %d-byte page", key, s.pageSize)
+	}
+
+	offset := s.allocPage()
+	encoded, err = encodeDataPage([]string{key}, [][]byte{value}, 0, s.pageSize)
+	if err != nil {
+		return 0, fmt.Errorf("row %s does not fit in a %d-byte page", key, s.pageSize)
+	}
+	if err := s.pages.writeAt(encoded, offset); err != nil {
+		return 0, err
+	}
+	linked, err := encodeDataPage(keys, values, offset, s.pageSize)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.pages.writeAt(linked, tail); err != nil {
+		return 0, err
+	}
+	s.setPageChain(head, append(chain[:len(chain):len(chain)], offset))
+	return offset, nil
+}
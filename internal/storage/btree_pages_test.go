@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestBTreePageChains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chains.db")
+	s, err := NewBTreeStorage(path)
+	assert.NoError(t, err)
+
+	// users and orders10 hash to the same first page, and notes to the
+	// page after it, where their overflow rows used to go
+	assert.Equal(t, s.tablePageOffset("users"), s.tablePageOffset("orders10"))
+	assert.Equal(t, s.tablePageOffset("users")+s.pageSize, s.tablePageOffset("notes"))
+	names := []string{"users", "orders10", "notes"}
+	for _, name := range names {
+		assert.NoError(t, s.CreateTable(&types.Table{
+			Name: name,
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "INT", Nullable: false},
+				{Name: "name", Type: "STRING", Nullable: true},
+			},
+		}))
+	}
+	for i := 0; i < 500; i++ {
+		for _, name := range names {
+			assert.NoError(t, s.Insert(name, map[string]interface{}{"id": i, "name": fmt.Sprintf("%s %d", name, i)}))
+		}
+	}
+
+	// Enough tables to spill the catalog onto chained pages too
+	for i := 0; i < 40; i++ {
+		assert.NoError(t, s.CreateTable(&types.Table{
+			Name:    fmt.Sprintf("extra_table_with_a_long_name_%d", i),
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: true}},
+		}))
+	}
+	chain, err := s.pageChain(metadataPageOffset)
+	assert.NoError(t, err)
+	assert.Greater(t, len(chain), 1)
+
+	check := func(s *BTreeStorage) {
+		for _, name := range names {
+			rows, err := s.Select(name, []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, rows, 500, name)
+			ids := make(map[string]bool)
+			for _, row := range rows {
+				assert.Equal(t, fmt.Sprintf("%s %v", name, row["id"]), row["name"])
+				ids[fmt.Sprint(row["id"])] = true
+			}
+			assert.Len(t, ids, 500, name)
+		}
+		tables, err := s.ShowTables()
+		assert.NoError(t, err)
+		assert.Len(t, tables, len(names)+40)
+	}
+	check(s)
+
+	// The chains are found again from the page headers
+	assert.NoError(t, s.Close())
+	reopened, err := NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	check(reopened)
+
+	// Deleting compacts pages but keeps them chained
+	assert.Equal(t, 250, rowsAffected(t)(reopened.Delete("users", types.WhereAll(map[string]interface{}{"id": types.Comparison{Operator: "<", Value: float64(250)}}))))
+	assert.NoError(t, reopened.Insert("users", map[string]interface{}{"id": 500, "name": "users 500"}))
+	rows, err := reopened.Select("users", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 251)
+	rows, err = reopened.Select("orders10", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 500)
+}
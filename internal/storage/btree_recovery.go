@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// shutdownMarkerSuffix names the file that marks a BTree file as open. It
+// is written when the file is opened and removed by Close, so finding it at
+// startup means the last process did not shut down cleanly.
+const shutdownMarkerSuffix = ".open"
+
+// ErrUnrecoverable is returned by writes to a BTree file whose recovery
+// pass found corruption it could not repair
+var ErrUnrecoverable = errors.New("unrecoverable corruption found after an unclean shutdown; writes are disabled (open with --force to allow them)")
+
+// ErrFileLocked is returned when opening a BTree file that another
+// storage, in this or another process, holds open
+var ErrFileLocked = errors.New("file is already open")
+
+// RecoveryOptions controls the integrity pass run after an unclean shutdown
+type RecoveryOptions struct {
+	// Thorough checks every data page instead of the first page of each
+	// table and the last page of the file
+	Thorough bool
+
+	// Force allows writes even if the pass finds unrecoverable corruption
+	Force bool
+}
+
+// RecoveryReport describes the integrity pass run when a BTree file was
+// not closed cleanly. Data pages with entries that cannot be decoded are
+// rewritten without them; damaged table metadata cannot be repaired.
+type RecoveryReport struct {
+	Marker        string // contents of the marker left by the unclean run
+	Thorough      bool
+	PagesChecked  int
+	CorruptPages  int
+	RepairedPages int
+	RowsDropped   int
+	Unrecoverable string // why the file cannot be recovered, or ""
+	Forced        bool
+	Duration      time.Duration
+}
+
+// Row returns the report as a result row for SHOW RECOVERY
+func (r *RecoveryReport) Row() map[string]interface{} {
+	status := "recovered"
+	switch {
+	case r.Unrecoverable != "" && r.Forced:
+		status = "unrecoverable (writes forced)"
+	case r.Unrecoverable != "":
+		status = "unrecoverable (read-only)"
+	}
+	return map[string]interface{}{
+		"status":         status,
+		"unclean_run":    r.Marker,
+		"thorough":       r.Thorough,
+		"pages_checked":  r.PagesChecked,
+		"corrupt_pages":  r.CorruptPages,
+		"repaired_pages": r.RepairedPages,
+		"rows_dropped":   r.RowsDropped,
+		"problem":        r.Unrecoverable,
+		"duration":       r.Duration.String(),
+	}
+}
+
+// LastRecovery returns the report of the integrity pass run when the file
+// was opened, or nil if it had been closed cleanly
+func (s *BTreeStorage) LastRecovery() *RecoveryReport {
+	return s.recovery
+}
+
+// writable returns ErrUnrecoverable if writes were disabled at open
+func (s *BTreeStorage) writable() error {
+	if s.recovery != nil && s.recovery.Unrecoverable != "" && !s.recovery.Forced {
+		return ErrUnrecoverable
+	}
+	return nil
+}
+
+// openMarker runs the recovery pass if the shutdown marker of filePath is
+// present, then writes the marker for this run. The caller holds the lock
+// on the file, so a marker found here was left by a process that is gone. loadErr is the error, if
+// any, from loading the table metadata.
+func (s *BTreeStorage) openMarker(filePath string, loadErr error, opts RecoveryOptions) error {
+	s.markerPath = filePath + shutdownMarkerSuffix
+	if marker, err := os.ReadFile(s.markerPath); err == nil {
+		types.GlobalLogger.Warning("%s was not closed cleanly; checking it", filePath)
+		report, err := s.recover(loadErr, opts)
+		if err != nil {
+			return fmt.Errorf("recovery of %s failed: %w", filePath, err)
+		}
+		report.Marker = string(marker)
+		s.recovery = report
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	marker := fmt.Sprintf("pid %d, opened %s", os.Getpid(), time.Now().Format(time.RFC3339))
+	return os.WriteFile(s.markerPath, []byte(marker), 0644)
+}
+
+// recover checks the data pages and rewrites those with entries that
+// cannot be decoded. Without opts.Thorough only the first page of each
+// table and the last page of the file, where an interrupted append lands,
+// are checked.
+func (s *BTreeStorage) recover(loadErr error, opts RecoveryOptions) (*RecoveryReport, error) {
+	start := time.Now()
+	report := &RecoveryReport{Thorough: opts.Thorough, Forced: opts.Force}
+	if loadErr == nil {
+		loadErr = s.checkMetadataPage()
+	}
+	if loadErr != nil {
+		report.Unrecoverable = fmt.Sprintf("table metadata: %v", loadErr)
+	}
+
+	info, err := s.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	lastPage := (info.Size() - metadataPageOffset - 1) / s.pageSize
+
+	var offsets []int64
+	if opts.Thorough {
+		for i := int64(1); i <= lastPage; i++ {
+			offsets = append(offsets, metadataPageOffset+i*s.pageSize)
+		}
+	} else {
+		seen := make(map[int64]bool)
+		for name := range s.tables {
+			seen[s.tablePageOffset(name)] = true
+		}
+		if lastPage > 0 {
+			seen[metadataPageOffset+lastPage*s.pageSize] = true
+		}
+		for offset := range seen {
+			offsets = append(offsets, offset)
+		}
+	}
+
+	page := make([]byte, s.pageSize)
+	for _, offset := range offsets {
+		n, err := s.pages.readAt(page, offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		for i := n; i < len(page); i++ {
+			page[i] = 0
+		}
+		report.PagesChecked++
+
+		keys, values, dropped, corrupt := checkDataPage(page)
+		if !corrupt {
+			continue
+		}
+		report.CorruptPages++
+		report.RowsDropped += dropped
+		next := pageNext(page)
+		if !s.validNext(offset, next) {
+			next = 0
+		}
+		encoded, err := encodeDataPage(keys, values, next, s.pageSize)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.pages.writeAt(encoded, offset); err != nil {
+			return nil, err
+		}
+		report.RepairedPages++
+	}
+	if report.RepairedPages > 0 {
+		if err := s.pages.sync(); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+// checkMetadataPage validates the table definitions on the catalog pages.
+// Loading tables skips definitions it cannot decode, which would otherwise
+// lose the table silently.
+func (s *BTreeStorage) checkMetadataPage() error {
+	if s.root == 0 {
+		return nil
+	}
+	chain, err := s.pageChain(metadataPageOffset)
+	if err != nil {
+		return err
+	}
+	page := make([]byte, s.pageSize)
+	for _, offset := range chain {
+		numKeys, err := s.readCatalogPage(page, offset)
+		if err != nil {
+			return err
+		}
+		if numKeys == 0 {
+			return nil
+		}
+
+		keys, values := decodeDataPage(page)
+		if len(keys) != numKeys {
+			return fmt.Errorf("page holds %d of %d entries", len(keys), numKeys)
+		}
+		for j, key := range keys {
+			if !strings.HasPrefix(key, "__table__") {
+				return fmt.Errorf("unexpected key %q", key)
+			}
+			var table types.Table
+			if err := json.Unmarshal(values[j], &table); err != nil {
+				return fmt.Errorf("%s: %v", strings.TrimPrefix(key, "__table__"), err)
+			}
+		}
+	}
+	return nil
+}
+
+// checkDataPage decodes a data page strictly. It returns the intact
+// entries, how many entries were lost, and whether the page needs
+// rewriting.
+func checkDataPage(page []byte) ([]string, [][]byte, int, bool) {
+	numKeys := binary.BigEndian.Uint64(page[0:])
+	isLeaf := binary.BigEndian.Uint64(page[8:])
+	if numKeys == 0 && isLeaf == 0 {
+		return nil, nil, 0, false
+	}
+	corrupt := isLeaf != 1
+
+	// A count larger than the page can hold is itself damage, so only
+	// count the entries lost to a plausible header
+	keys, values := decodeDataPage(page)
+	dropped := 0
+	if numKeys > uint64(len(page)-headerSize)/8 {
+		corrupt = true
+	} else if uint64(len(keys)) < numKeys {
+		corrupt = true
+		dropped = int(numKeys) - len(keys)
+	}
+
+	intactKeys := keys[:0]
+	intactValues := values[:0]
+	for i, key := range keys {
+		if key == "" || tableNameFromKey(key) == "" {
+			dropped++
+			corrupt = true
+			continue
+		}
+		if _, err := decodeRow(values[i], nil); err != nil {
+			dropped++
+			corrupt = true
+			continue
+		}
+		intactKeys = append(intactKeys, key)
+		intactValues = append(intactValues, values[i])
+	}
+	return intactKeys, intactValues, dropped, corrupt
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// crash closes the file without removing the shutdown marker, as if the
+// process had been killed
+func crash(t *testing.T, s *BTreeStorage) {
+	t.Helper()
+	assert.NoError(t, s.file.Close())
+	s.file = nil
+}
+
+func openCrashed(t *testing.T) (string, *BTreeStorage) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "recovery.db")
+	s, err := NewBTreeStorage(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name:    "users",
+		Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: true}},
+	}))
+	for id := 1; id <= 3; id++ {
+		assert.NoError(t, s.Insert("users", map[string]interface{}{"id": id}))
+	}
+	return path, s
+}
+
+func TestCleanShutdownLeavesNoMarker(t *testing.T) {
+	path, s := openCrashed(t)
+	assert.FileExists(t, path+shutdownMarkerSuffix)
+	assert.NoError(t, s.Close())
+	assert.NoFileExists(t, path+shutdownMarkerSuffix)
+
+	s, err := NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Nil(t, s.LastRecovery())
+}
+
+func TestRecoveryAfterUncleanShutdown(t *testing.T) {
+	path, s := openCrashed(t)
+	offset := s.tablePageOffset("users")
+	crash(t, s)
+	assert.FileExists(t, path+shutdownMarkerSuffix)
+
+	s, err := OpenBTreeStorage(path, 0, RecoveryOptions{})
+	assert.NoError(t, err)
+	report := s.LastRecovery()
+	if assert.NotNil(t, report) {
+		assert.Contains(t, report.Marker, "pid ")
+		assert.Equal(t, 0, report.CorruptPages)
+		assert.Positive(t, report.PagesChecked)
+	}
+	assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 4}))
+
+	// A page claiming more entries than it holds is rewritten without them
+	page := make([]byte, s.pageSize)
+	_, err = s.file.ReadAt(page, offset)
+	assert.NoError(t, err)
+	numKeys := binary.BigEndian.Uint64(page)
+	binary.BigEndian.PutUint64(page, numKeys+2)
+	_, err = s.file.WriteAt(page, offset)
+	assert.NoError(t, err)
+	crash(t, s)
+
+	s, err = OpenBTreeStorage(path, 0, RecoveryOptions{Thorough: true})
+	assert.NoError(t, err)
+	defer s.Close()
+	report = s.LastRecovery()
+	if assert.NotNil(t, report) {
+		assert.True(t, report.Thorough)
+		assert.Equal(t, 1, report.CorruptPages)
+		assert.Equal(t, 1, report.RepairedPages)
+		assert.Equal(t, 2, report.RowsDropped)
+		assert.Equal(t, "recovered", report.Row()["status"])
+	}
+	rows, err := s.Select("users", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, int(numKeys))
+}
+
+func TestUnrecoverableCorruptionDisablesWrites(t *testing.T) {
+	path, s := openCrashed(t)
+
+	// Damage the table metadata JSON
+	page := make([]byte, s.pageSize)
+	_, err := s.file.ReadAt(page, metadataPageOffset)
+	assert.NoError(t, err)
+	keyLen := int(binary.BigEndian.Uint32(page[headerSize:]))
+	page[headerSize+4+keyLen+4] = '#'
+	_, err = s.file.WriteAt(page, metadataPageOffset)
+	assert.NoError(t, err)
+	crash(t, s)
+
+	s, err = OpenBTreeStorage(path, 0, RecoveryOptions{})
+	assert.NoError(t, err)
+	report := s.LastRecovery()
+	if assert.NotNil(t, report) {
+		assert.Contains(t, report.Unrecoverable, "table metadata")
+		assert.Equal(t, "unrecoverable (read-only)", report.Row()["status"])
+	}
+	err = s.CreateTable(&types.Table{Name: "orders", Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}}})
+	assert.Equal(t, ErrUnrecoverable, err)
+	crash(t, s)
+
+	s, err = OpenBTreeStorage(path, 0, RecoveryOptions{Force: true})
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.True(t, s.LastRecovery().Forced)
+	assert.NoError(t, s.CreateTable(&types.Table{Name: "orders", Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}}}))
+}
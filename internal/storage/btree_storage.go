@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zakazai/ulin-db/internal/types"
@@ -16,10 +17,29 @@ import (
 
 const (
 	// B-tree parameters
-	maxKeys    = 4 // Maximum number of keys in a node
-	minKeys    = maxKeys / 2
-	pageSize   = 4096 // Size of a page in bytes
-	headerSize = 16   // Size of page header in bytes
+	DefaultPageSize = 4096 // Page size used when none is configured
+	minPageSize     = 1024
+	maxPageSize     = 1 << 20
+	bytesPerKey     = 1024 // Page bytes budgeted per key; 4096-byte pages hold 4 keys
+
+	// Page header, at the start of every data and catalog page:
+	//   [0:8]   number of entries
+	//   [8:16]  leaf flag, always 1
+	//   [16:24] offset of the next page of the chain, or 0
+	headerSize       = 24
+	nextPagePosition = 16
+
+	// File header, written once at offset 0:
+	//   [0:8]   magic
+	//   [8:12]  format version
+	//   [12:16] page size
+	//   [16:24] creation time (unix nanoseconds)
+	//   [24:32] root offset
+	btreeMagic         = "ULINDBBT"
+	btreeFormatVersion = 2
+	fileHeaderSize     = 32
+	rootOffsetPosition = 24
+	metadataPageOffset = fileHeaderSize
 )
 
 // BTreeNode represents a node in the B-tree
@@ -31,17 +51,71 @@ type BTreeNode struct {
 	children []int64 // Page offsets for children
 }
 
-// BTreeStorage implements Storage interface using B-tree file storage
+// BTreeStorage implements Storage interface using B-tree file storage.
+//
+// mu is the catalog lock guarding tables and root. Row operations hold the
+// table's lock from locks instead, so tables are read and written
+// independently. Tables share data pages, so every page read and write
+// also takes pageMu, but only for the page I/O itself.
 type BTreeStorage struct {
-	file     *os.File
-	root     int64 // Page offset of root node
-	mu       sync.RWMutex
-	tables   map[string]*types.Table
-	pagePool sync.Pool
+	file      *os.File
+	pages     *pageCache // all page I/O on file goes through it
+	root      int64      // Page offset of root node
+	mu        sync.RWMutex
+	locks     *tableLocks
+	pageMu    sync.RWMutex
+	chainMu   sync.Mutex
+	chains    map[int64][]int64 // page offsets of each chain by its first page, see pageChain
+	tables    map[string]*types.Table
+	pagePool  sync.Pool
+	pageSize  int64 // Size of a page in bytes, read from the file header
+	maxKeys   int   // Maximum number of keys in a node
+	minKeys   int
+	createdAt time.Time
+
+	markerPath string          // shutdown marker, removed by Close
+	recovery   *RecoveryReport // set if the file was not closed cleanly
+
+	// catalogLoaded is set once tables holds every table on the metadata
+	// page. DDL updates tables as it writes the page, so the catalog only
+	// has to be reread if loading it at open failed.
+	catalogLoaded bool
+	pageReads     int64 // pages read from the file, see PageReads
+
+	// pkIndexes holds the primary key index of the tables searched by
+	// key so far, see btree_index.go
+	indexMu   sync.Mutex
+	pkIndexes map[string]*primaryKeyIndex
+
+	// versions counts the changes to each table's rows and schema since
+	// the file was opened, see TableVersion
+	versionMu sync.Mutex
+	versions  map[string]uint64
 }
 
-// NewBTreeStorage creates a new B-tree storage
+// NewBTreeStorage creates a new B-tree storage using DefaultPageSize for new files
 func NewBTreeStorage(filePath string) (*BTreeStorage, error) {
+	return NewBTreeStorageWithPageSize(filePath, DefaultPageSize)
+}
+
+// NewBTreeStorageWithPageSize creates a new B-tree storage. pageSize only
+// applies when the file is created; existing files always use the page size
+// recorded in their header.
+func NewBTreeStorageWithPageSize(filePath string, pageSize int) (*BTreeStorage, error) {
+	return OpenBTreeStorage(filePath, pageSize, RecoveryOptions{})
+}
+
+// OpenBTreeStorage creates a new B-tree storage like
+// NewBTreeStorageWithPageSize. If the file was not closed cleanly, it first
+// runs an integrity pass configured by recovery (see LastRecovery).
+func OpenBTreeStorage(filePath string, pageSize int, recovery RecoveryOptions) (*BTreeStorage, error) {
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	if err := validatePageSize(pageSize); err != nil {
+		return nil, err
+	}
+
 	// Make sure the directory exists
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -55,31 +129,45 @@ func NewBTreeStorage(filePath string) (*BTreeStorage, error) {
 		return nil, fmt.Errorf("failed to open BTree file: %v", err)
 	}
 
+	// A second process would take the first one's marker for a crash and
+	// repair the file under it
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if err == ErrFileLocked {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		return nil, fmt.Errorf("failed to lock BTree file: %v", err)
+	}
+
 	storage := &BTreeStorage{
 		file:   file,
+		locks:  newTableLocks(),
+		chains: make(map[int64][]int64),
 		tables: make(map[string]*types.Table),
-		pagePool: sync.Pool{
-			New: func() interface{} {
-				return make([]byte, pageSize)
-			},
-		},
+
+		pkIndexes: make(map[string]*primaryKeyIndex),
 	}
 
-	// Initialize root node if file is empty
+	// Initialize the header if file is empty
 	info, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, fmt.Errorf("failed to stat file: %v", err)
 	}
 
 	types.GlobalLogger.Debug("BTree file size: %d bytes", info.Size())
+	var loadErr error
 	if info.Size() == 0 {
 		types.GlobalLogger.Debug("Creating new BTree file with empty root")
 
 		// Initialize the file with a root offset of 0 (no data yet)
 		storage.root = 0
-		file.Seek(0, 0)
-		if err := binary.Write(file, binary.BigEndian, int64(0)); err != nil {
-			return nil, fmt.Errorf("failed to write initial root offset: %v", err)
+		storage.setPageSize(int64(pageSize))
+		storage.createdAt = time.Now()
+		storage.catalogLoaded = true
+		if err := storage.writeFileHeader(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write file header: %v", err)
 		}
 
 		// Sync the file to ensure changes are written
@@ -89,21 +177,21 @@ func NewBTreeStorage(filePath string) (*BTreeStorage, error) {
 
 		types.GlobalLogger.Debug("Initialized empty BTree file with root offset 0")
 	} else {
-		// Read root offset from file header
-		types.GlobalLogger.Debug("Reading root offset from existing file")
-		file.Seek(0, 0)
-		var rootOffset int64
-		if err := binary.Read(file, binary.BigEndian, &rootOffset); err != nil {
-			return nil, fmt.Errorf("failed to read root offset from header: %v", err)
+		// Validate the file header and read the root offset from it
+		types.GlobalLogger.Debug("Reading header from existing file")
+		if err := storage.readFileHeader(filePath); err != nil {
+			file.Close()
+			return nil, err
 		}
-		storage.root = rootOffset
-		types.GlobalLogger.Debug("Read root offset: %d", rootOffset)
+		types.GlobalLogger.Debug("Read root offset: %d, page size: %d", storage.root, storage.pageSize)
 
 		// Load table metadata from the B-tree
 		types.GlobalLogger.Debug("Loading tables from BTree")
-		if err := storage.loadTables(); err != nil {
-			types.GlobalLogger.Warning("Error loading tables: %v", err)
+		if loadErr = storage.loadTables(); loadErr != nil {
+			types.GlobalLogger.Warning("Error loading tables: %v", loadErr)
 			// Continue anyway, as this might be a new file
+		} else {
+			storage.catalogLoaded = true
 		}
 
 		types.GlobalLogger.Debug("Loaded %d tables from BTree", len(storage.tables))
@@ -112,10 +200,92 @@ func NewBTreeStorage(filePath string) (*BTreeStorage, error) {
 		}
 	}
 
+	if err := storage.openMarker(filePath, loadErr, recovery); err != nil {
+		file.Close()
+		return nil, err
+	}
+
 	return storage, nil
 }
 
+func validatePageSize(pageSize int) error {
+	if pageSize < minPageSize || pageSize > maxPageSize || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("invalid page size %d: must be a power of two between %d and %d", pageSize, minPageSize, maxPageSize)
+	}
+	return nil
+}
+
+// setPageSize sets the page size, the node fan-out derived from it and the
+// page cache, which starts disabled
+func (s *BTreeStorage) setPageSize(pageSize int64) {
+	s.pageSize = pageSize
+	s.pages = newPageCache(s.file, pageSize)
+	s.maxKeys = int(pageSize / bytesPerKey)
+	s.minKeys = s.maxKeys / 2
+	s.pagePool = sync.Pool{
+		New: func() interface{} {
+			return make([]byte, pageSize)
+		},
+	}
+}
+
+// PageSize returns the page size of the open file
+func (s *BTreeStorage) PageSize() int {
+	return int(s.pageSize)
+}
+
+func (s *BTreeStorage) writeFileHeader() error {
+	header := make([]byte, fileHeaderSize)
+	copy(header, btreeMagic)
+	binary.BigEndian.PutUint32(header[8:], btreeFormatVersion)
+	binary.BigEndian.PutUint32(header[12:], uint32(s.pageSize))
+	binary.BigEndian.PutUint64(header[16:], uint64(s.createdAt.UnixNano()))
+	binary.BigEndian.PutUint64(header[rootOffsetPosition:], uint64(s.root))
+	if err := s.pages.writeAt(header, 0); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *BTreeStorage) readFileHeader(filePath string) error {
+	header := make([]byte, fileHeaderSize)
+	if _, err := s.file.ReadAt(header, 0); err != nil || string(header[:8]) != btreeMagic {
+		return fmt.Errorf("%s is not a ulindb file", filePath)
+	}
+	if version := binary.BigEndian.Uint32(header[8:]); version != btreeFormatVersion {
+		return fmt.Errorf("%s has unsupported format version %d (supported: %d)", filePath, version, btreeFormatVersion)
+	}
+	pageSize := int(binary.BigEndian.Uint32(header[12:]))
+	if err := validatePageSize(pageSize); err != nil {
+		return fmt.Errorf("%s has a corrupt header: %v", filePath, err)
+	}
+	s.setPageSize(int64(pageSize))
+	s.createdAt = time.Unix(0, int64(binary.BigEndian.Uint64(header[16:])))
+	s.root = int64(binary.BigEndian.Uint64(header[rootOffsetPosition:]))
+	return nil
+}
+
+// writeRootOffset updates the root offset stored in the file header
+func (s *BTreeStorage) writeRootOffset(offset int64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(offset))
+	_, err := s.file.WriteAt(buf, rootOffsetPosition)
+	return err
+}
+
+// readRootOffset reads the root offset stored in the file header
+func (s *BTreeStorage) readRootOffset() (int64, error) {
+	buf := make([]byte, 8)
+	if _, err := s.file.ReadAt(buf, rootOffsetPosition); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf)), nil
+}
+
 func (s *BTreeStorage) CreateTable(table *types.Table) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -148,40 +318,123 @@ func (s *BTreeStorage) CreateTable(table *types.Table) error {
 	return nil
 }
 
-func (s *BTreeStorage) Insert(tableName string, values map[string]interface{}) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// lookup returns a table definition under the catalog lock
+func (s *BTreeStorage) lookup(tableName string) (*types.Table, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	table, exists := s.tables[tableName]
 	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	return table, nil
+}
+
+func (s *BTreeStorage) Insert(tableName string, values map[string]interface{}) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	row, err := s.buildRow(table, values)
+	if err != nil {
+		return err
+	}
+	return s.storeRow(table, row)
+}
+
+// InsertRows implements types.BatchInserter. The rows are validated and
+// then written under a single acquisition of the table lock.
+func (s *BTreeStorage) InsertRows(tableName string, rows []map[string]interface{}) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	built := make([]types.Row, len(rows))
+	for i, values := range rows {
+		if built[i], err = s.buildRow(table, values); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	for i, row := range built {
+		if err := s.storeRow(table, row); err != nil {
+			return fmt.Errorf("row %d: %w (%d rows inserted)", i+1, err, i)
+		}
 	}
+	return nil
+}
 
-	// Validate all required columns are present
+// buildRow checks that values has every required column, each of its
+// type, and returns the row to store, with column defaults filled in
+func (s *BTreeStorage) buildRow(table *types.Table, values map[string]interface{}) (types.Row, error) {
+	values, err := types.CanonicalValues(table, types.WithDefaults(table, values))
+	if err != nil {
+		return nil, err
+	}
 	row := make(types.Row)
 	for _, col := range table.Columns {
 		val, exists := values[col.Name]
 		if !exists && !col.Nullable {
-			return fmt.Errorf("missing required column %s", col.Name)
+			return nil, fmt.Errorf("missing required column %s", col.Name)
+		}
+		if exists && val == nil && !col.Nullable {
+			return nil, fmt.Errorf("NULL value not allowed for non-nullable column %s", col.Name)
+		}
+		if err := s.validateDataType(val, col.Type); err != nil {
+			return nil, fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
 		}
 		if exists {
 			row[col.Name] = val
 		}
 	}
-
-	// Insert the row
-	return s.insertRow(tableName, row)
+	return row, nil
 }
 
-func (s *BTreeStorage) Select(tableName string, columns []string, where map[string]interface{}) ([]types.Row, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// storeRow writes a validated row, making room for it first if the table
+// has a quota. The caller must hold the table lock.
+func (s *BTreeStorage) storeRow(table *types.Table, row types.Row) error {
+	if table.Quota != nil {
+		if err := s.makeRoom(table, row); err != nil {
+			return err
+		}
+	}
+	offset, err := s.insertRowAt(table.Name, row)
+	if err != nil {
+		return err
+	}
+	s.indexRow(table, row, offset)
+	return nil
+}
 
+func (s *BTreeStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
 	types.GlobalLogger.Debug("BTreeStorage.Select called for table '%s', columns %v", tableName, columns)
 
-	table, exists := s.tables[tableName]
-	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", tableName)
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return nil, err
 	}
 
 	// Check for COUNT(*) query
@@ -222,8 +475,9 @@ func (s *BTreeStorage) Select(tableName string, columns []string, where map[stri
 		}
 	}
 
-	// Read all rows from B-tree
-	allRows, err := s.readRows(tableName)
+	// Read the rows that can match, through the primary key index for a
+	// key lookup
+	allRows, err := s.candidateRows(table, where)
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +486,7 @@ func (s *BTreeStorage) Select(tableName string, columns []string, where map[stri
 	if isCountQuery {
 		var matchingRows int
 		for _, row := range allRows {
-			if where == nil || s.matchesWhere(row, where) {
+			if where.Matches(row) {
 				matchingRows++
 			}
 		}
@@ -241,14 +495,14 @@ func (s *BTreeStorage) Select(tableName string, columns []string, where map[stri
 		countResult := make(types.Row)
 		countResult["count"] = matchingRows
 
-		fmt.Printf("DEBUG: COUNT(*) query returning count = %d\n", matchingRows)
+		types.GlobalLogger.Debug("COUNT(*) query returning count = %d", matchingRows)
 		return []types.Row{countResult}, nil
 	}
 
 	// Filter rows based on where clause and select specified columns
 	var results []types.Row
 	for _, row := range allRows {
-		if where == nil || s.matchesWhere(row, where) {
+		if where.Matches(row) {
 			result := make(types.Row)
 			if allColumns {
 				// For * just copy the whole row
@@ -267,89 +521,127 @@ func (s *BTreeStorage) Select(tableName string, columns []string, where map[stri
 		}
 	}
 
-	fmt.Printf("DEBUG: BTreeStorage.Select returning %d rows\n", len(results))
+	types.GlobalLogger.Debug("BTreeStorage.Select returning %d rows", len(results))
 	return results, nil
 }
 
-func (s *BTreeStorage) Update(tableName string, set map[string]interface{}, where map[string]interface{}) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.tables[tableName]; !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+func (s *BTreeStorage) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	if err := s.writable(); err != nil {
+		return 0, err
 	}
-
-	// Read all rows
-	rows, err := s.readRows(tableName)
+	table, err := s.lookup(tableName)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Update matching rows
-	rowsAffected := 0
-	for i, row := range rows {
-		if where == nil || s.matchesWhere(row, where) {
-			for k, v := range set {
-				rows[i][k] = v
+	// Validate before any page is touched, so a bad statement leaves the
+	// table as it was
+	if err := s.validateColumnNames(table, set); err != nil {
+		return 0, err
+	}
+	if err := s.validateWhereColumns(table, where); err != nil {
+		return 0, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return 0, err
+	}
+	for _, col := range table.Columns {
+		if value, ok := set[col.Name]; ok {
+			if err := s.validateDataType(value, col.Type); err != nil {
+				return 0, fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
 			}
-			rowsAffected++
 		}
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows matched the WHERE clause")
+	if set, err = types.CanonicalValues(table, set); err != nil {
+		return 0, err
 	}
 
-	// Write updated rows back to B-tree
-	return s.writeRows(tableName, rows)
-}
-
-func (s *BTreeStorage) Delete(tableName string, where map[string]interface{}) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
 
-	if _, exists := s.tables[tableName]; !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+	// Only the pages holding a matching row are written back
+	rewrites := make(map[string]types.Row)
+	err = s.scanRows(tableName, func(key string, row types.Row) error {
+		if !where.Matches(row) {
+			return nil
+		}
+		for k, v := range set {
+			row[k] = v
+		}
+		rewrites[key] = row
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
+	if err := s.rewriteRows(tableName, rewrites); err != nil {
+		return 0, err
+	}
+	return len(rewrites), nil
+}
 
-	// Read all rows
-	rows, err := s.readRows(tableName)
+func (s *BTreeStorage) Delete(tableName string, where *types.WhereExpr) (int, error) {
+	if err := s.writable(); err != nil {
+		return 0, err
+	}
+	table, err := s.lookup(tableName)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if err := s.validateWhereColumns(table, where); err != nil {
+		return 0, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return 0, err
 	}
 
-	// Filter out rows that match the where clause
-	var newRows []types.Row
-	rowsAffected := 0
-	for _, row := range rows {
-		if where == nil || !s.matchesWhere(row, where) {
-			newRows = append(newRows, row)
-		} else {
-			rowsAffected++
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Matching rows are removed from their pages, leaving other pages as
+	// they are
+	keys := make(map[string]bool)
+	err = s.scanRows(tableName, func(key string, row types.Row) error {
+		if where.Matches(row) {
+			keys[key] = true
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows matched the WHERE clause")
+	if len(keys) == 0 {
+		return 0, nil
 	}
-
-	// Write remaining rows back to B-tree
-	return s.writeRows(tableName, newRows)
+	if err := s.deleteRowKeys(tableName, keys); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
 }
 
 func (s *BTreeStorage) Close() error {
-	// Acquire write lock to wait for any ongoing readers (which use RLock)
-	// to finish before closing the underlying file. Also clear the file
-	// reference to avoid future accidental use.
+	// Acquire the catalog and page write locks to wait for any ongoing
+	// page I/O to finish before closing the underlying file. Also clear the
+	// file reference to avoid future accidental use.
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
 
 	if s.file == nil {
 		return nil
 	}
 
-	err := s.file.Close()
+	err := s.pages.flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
 	s.file = nil
+	if err == nil && s.markerPath != "" {
+		err = os.Remove(s.markerPath)
+	}
 	return err
 }
 
@@ -362,7 +654,7 @@ func (s *BTreeStorage) GetTable(tableName string) *types.Table {
 // Helper functions for B-tree operations
 
 func (s *BTreeStorage) writeNode(node *BTreeNode) (int64, error) {
-	fmt.Printf("DEBUG: writeNode called, node has %d keys\n", node.numKeys)
+	types.GlobalLogger.Debug("writeNode called, node has %d keys", node.numKeys)
 
 	// Get a page buffer from the pool
 	page := s.pagePool.Get().([]byte)
@@ -393,7 +685,7 @@ func (s *BTreeStorage) writeNode(node *BTreeNode) (int64, error) {
 		copy(page[offset:], node.keys[i])
 		offset += int64(keyLen)
 
-		fmt.Printf("DEBUG: Wrote key %d: '%s' (len=%d)\n", i, node.keys[i], keyLen)
+		types.GlobalLogger.Debug("Wrote key %d: '%s' (len=%d)", i, node.keys[i], keyLen)
 
 		// Write value length and value
 		valueLen := len(node.values[i])
@@ -402,7 +694,7 @@ func (s *BTreeStorage) writeNode(node *BTreeNode) (int64, error) {
 		copy(page[offset:], node.values[i])
 		offset += int64(valueLen)
 
-		fmt.Printf("DEBUG: Wrote value %d (len=%d)\n", i, valueLen)
+		types.GlobalLogger.Debug("Wrote value %d (len=%d)", i, valueLen)
 	}
 
 	// Write child pointers
@@ -410,26 +702,21 @@ func (s *BTreeStorage) writeNode(node *BTreeNode) (int64, error) {
 		for i := 0; i <= node.numKeys; i++ {
 			binary.BigEndian.PutUint64(page[offset:], uint64(node.children[i]))
 			offset += 8
-			fmt.Printf("DEBUG: Wrote child pointer %d: %d\n", i, node.children[i])
+			types.GlobalLogger.Debug("Wrote child pointer %d: %d", i, node.children[i])
 		}
 	}
 
-	// Write page to file
-	fileOffset, err := s.file.Seek(0, os.SEEK_END)
+	// Append the page to the file
+	fileOffset, err := s.pages.appendPage(page[:s.pageSize])
 	if err != nil {
-		fmt.Printf("DEBUG: Error seeking to end of file: %v\n", err)
-		return 0, err
-	}
-
-	fmt.Printf("DEBUG: Writing page at offset %d\n", fileOffset)
-	if _, err := s.file.Write(page[:pageSize]); err != nil {
-		fmt.Printf("DEBUG: Error writing page: %v\n", err)
+		types.GlobalLogger.Debug("Error writing page: %v", err)
 		return 0, err
 	}
+	types.GlobalLogger.Debug("Wrote page at offset %d", fileOffset)
 
 	// Sync to ensure data is written to disk
-	if err := s.file.Sync(); err != nil {
-		fmt.Printf("DEBUG: Error syncing file: %v\n", err)
+	if err := s.pages.sync(); err != nil {
+		types.GlobalLogger.Debug("Error syncing file: %v", err)
 		// Continue anyway, as this might not be critical
 	}
 
@@ -440,25 +727,25 @@ func (s *BTreeStorage) readNode(offset int64) (*BTreeNode, error) {
 	if s.file == nil {
 		return nil, fmt.Errorf("BTree file is closed")
 	}
-	fmt.Printf("DEBUG: readNode called at offset %d\n", offset)
+	types.GlobalLogger.Debug("readNode called at offset %d", offset)
 
 	// Get a page buffer from the pool
 	page := s.pagePool.Get().([]byte)
 	defer s.pagePool.Put(page)
 
 	// Read page from file
-	bytesRead, err := s.file.ReadAt(page, offset)
+	bytesRead, err := s.pages.readAt(page, offset)
 	if err != nil {
-		fmt.Printf("DEBUG: Error reading page: %v\n", err)
+		types.GlobalLogger.Debug("Error reading page: %v", err)
 		return nil, err
 	}
-	fmt.Printf("DEBUG: Read %d bytes from file at offset %d\n", bytesRead, offset)
+	types.GlobalLogger.Debug("Read %d bytes from file at offset %d", bytesRead, offset)
 
 	// Read node data from page buffer
 	node := &BTreeNode{
-		keys:     make([]string, maxKeys),
-		values:   make([][]byte, maxKeys),
-		children: make([]int64, maxKeys+1),
+		keys:     make([]string, s.maxKeys),
+		values:   make([][]byte, s.maxKeys),
+		children: make([]int64, s.maxKeys+1),
 	}
 
 	bufOffset := int64(0)
@@ -467,18 +754,18 @@ func (s *BTreeStorage) readNode(offset int64) (*BTreeNode, error) {
 	node.isLeaf = binary.BigEndian.Uint64(page[bufOffset:]) == 1
 	bufOffset += 8
 
-	fmt.Printf("DEBUG: Node has %d keys, isLeaf=%v\n", node.numKeys, node.isLeaf)
+	types.GlobalLogger.Debug("Node has %d keys, isLeaf=%v", node.numKeys, node.isLeaf)
 
 	// Read keys and values
 	for i := 0; i < node.numKeys; i++ {
 		// Read key
 		keyLen := binary.BigEndian.Uint32(page[bufOffset:])
 		bufOffset += 4
-		if keyLen > 0 && bufOffset+int64(keyLen) <= pageSize {
+		if keyLen > 0 && bufOffset+int64(keyLen) <= s.pageSize {
 			node.keys[i] = string(page[bufOffset : bufOffset+int64(keyLen)])
-			fmt.Printf("DEBUG: Read key %d: '%s' (len=%d)\n", i, node.keys[i], keyLen)
+			types.GlobalLogger.Debug("Read key %d: '%s' (len=%d)", i, node.keys[i], keyLen)
 		} else {
-			fmt.Printf("DEBUG: Invalid key length %d at offset %d\n", keyLen, bufOffset)
+			types.GlobalLogger.Debug("Invalid key length %d at offset %d", keyLen, bufOffset)
 			return nil, fmt.Errorf("invalid key length %d at offset %d", keyLen, bufOffset)
 		}
 		bufOffset += int64(keyLen)
@@ -486,12 +773,12 @@ func (s *BTreeStorage) readNode(offset int64) (*BTreeNode, error) {
 		// Read value
 		valueLen := binary.BigEndian.Uint32(page[bufOffset:])
 		bufOffset += 4
-		if valueLen > 0 && bufOffset+int64(valueLen) <= pageSize {
+		if valueLen > 0 && bufOffset+int64(valueLen) <= s.pageSize {
 			node.values[i] = make([]byte, valueLen)
 			copy(node.values[i], page[bufOffset:bufOffset+int64(valueLen)])
-			fmt.Printf("DEBUG: Read value %d (len=%d)\n", i, valueLen)
+			types.GlobalLogger.Debug("Read value %d (len=%d)", i, valueLen)
 		} else {
-			fmt.Printf("DEBUG: Invalid value length %d at offset %d\n", valueLen, bufOffset)
+			types.GlobalLogger.Debug("Invalid value length %d at offset %d", valueLen, bufOffset)
 			return nil, fmt.Errorf("invalid value length %d at offset %d", valueLen, bufOffset)
 		}
 		bufOffset += int64(valueLen)
@@ -502,7 +789,7 @@ func (s *BTreeStorage) readNode(offset int64) (*BTreeNode, error) {
 		for i := 0; i <= node.numKeys; i++ {
 			node.children[i] = int64(binary.BigEndian.Uint64(page[bufOffset:]))
 			bufOffset += 8
-			fmt.Printf("DEBUG: Read child pointer %d: %d\n", i, node.children[i])
+			types.GlobalLogger.Debug("Read child pointer %d: %d", i, node.children[i])
 		}
 	}
 
@@ -510,6 +797,8 @@ func (s *BTreeStorage) readNode(offset int64) (*BTreeNode, error) {
 }
 
 func (s *BTreeStorage) writeTable(table *types.Table) error {
+	defer s.changed(table.Name)
+
 	// Store the table in memory first
 	s.tables[table.Name] = table
 
@@ -523,456 +812,109 @@ func (s *BTreeStorage) writeTable(table *types.Table) error {
 	key := fmt.Sprintf("__table__%s", table.Name)
 
 	// Log debugging info
-	fmt.Printf("DEBUG: Writing table metadata for '%s' with key '%s'\n", table.Name, key)
-	fmt.Printf("DEBUG: Table schema: %v\n", table.Columns)
+	types.GlobalLogger.Debug("Writing table metadata for '%s' with key '%s'", table.Name, key)
+	types.GlobalLogger.Debug("Table schema: %v", table.Columns)
 
 	// Store in BTree
 	return s.insert(key, tableJSON)
 }
 
+// newRowKey generates a unique key with timestamp to avoid overwrites
+func newRowKey(tableName string, row types.Row) string {
+	return fmt.Sprintf("%s:%d:%d", tableName, len(row), time.Now().UnixNano())
+}
+
 func (s *BTreeStorage) insertRow(tableName string, row types.Row) error {
-	// Generate a unique key with timestamp to avoid overwrites
-	key := fmt.Sprintf("%s:%d:%d", tableName, len(row), time.Now().UnixNano())
-	fmt.Printf("DEBUG: Generated unique row key: %s\n", key)
+	_, err := s.insertRowAt(tableName, row)
+	return err
+}
+
+// insertRowAt stores a row under a new key and returns the offset of the
+// data page that took it
+func (s *BTreeStorage) insertRowAt(tableName string, row types.Row) (int64, error) {
+	defer s.changed(tableName)
+	key := newRowKey(tableName, row)
+	types.GlobalLogger.Debug("Generated unique row key: %s", key)
 
 	// Convert row to bytes
 	value, err := encodeRow(row)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Insert into B-tree
-	return s.insert(key, value)
+	return s.insertAt(key, value)
 }
 
 func (s *BTreeStorage) insert(key string, value []byte) error {
-	fmt.Printf("DEBUG: Inserting key '%s' into BTree\n", key)
+	_, err := s.insertAt(key, value)
+	return err
+}
 
-	// For simplicity, we'll maintain two distinct pages for different types of data:
-	// - Page 1 (offset 8): for table metadata (keys with "__table__" prefix)
-	// - Page 2+ (offset 8 + pageSize*n): for actual data rows
+// insertAt stores key and value and returns the offset of the data page
+// that took them, or 0 for a catalog entry
+func (s *BTreeStorage) insertAt(key string, value []byte) (int64, error) {
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+	if s.file == nil {
+		return 0, fmt.Errorf("BTree file is closed")
+	}
+
+	types.GlobalLogger.Debug("Inserting key '%s' into BTree", key)
+
+	// For simplicity, we'll maintain two distinct kinds of pages:
+	// - Page 1 (right after the file header): the catalog of table metadata
+	//   (keys with "__table__" prefix), continued on the pages chained to it
+	// - Page 2+ (header + pageSize*n): for actual data rows, see btree_pages.go
 
 	// Determine whether this is a metadata or data key
 	isMetadata := strings.HasPrefix(key, "__table__")
 
-	// If it's a metadata key, write to page 1
+	// If it's a metadata key, add it to the catalog
+	var offset int64
 	if isMetadata {
-		page := s.pagePool.Get().([]byte)
-		defer s.pagePool.Put(page)
-
-		// Clear the page
-		for i := range page {
-			page[i] = 0
-		}
-
-		// Create a simple node with just our key/value
-		node := &BTreeNode{
-			numKeys: 1,
-			keys:    make([]string, maxKeys),
-			values:  make([][]byte, maxKeys),
-		}
-		node.keys[0] = key
-		node.values[0] = value
-
-		// Serialize the node
-		offset := int64(0)
-		binary.BigEndian.PutUint64(page[offset:], uint64(node.numKeys))
-		offset += 8
-		binary.BigEndian.PutUint64(page[offset:], 1) // isLeaf = true
-		offset += 8
-
-		// Write key and value
-		keyLen := len(node.keys[0])
-		binary.BigEndian.PutUint32(page[offset:], uint32(keyLen))
-		offset += 4
-		copy(page[offset:], node.keys[0])
-		offset += int64(keyLen)
-
-		valueLen := len(node.values[0])
-		binary.BigEndian.PutUint32(page[offset:], uint32(valueLen))
-		offset += 4
-		copy(page[offset:], node.values[0])
-
-		// Write to metadata page
-		const metadataOffset = 8
-		fmt.Printf("DEBUG: Writing metadata to offset %d\n", metadataOffset)
-
-		if _, err := s.file.WriteAt(page[:pageSize], metadataOffset); err != nil {
-			fmt.Printf("DEBUG: Error writing metadata: %v\n", err)
-			return err
+		if err := s.putCatalogEntry(key, value); err != nil {
+			types.GlobalLogger.Debug("Error writing metadata: %v", err)
+			return 0, err
 		}
 
 		// Set the root pointer to page 1 (metadata) so it's found on reload
-		s.file.Seek(0, 0)
-		if err := binary.Write(s.file, binary.BigEndian, int64(metadataOffset)); err != nil {
-			fmt.Printf("DEBUG: Error writing root offset to header: %v\n", err)
-			return err
+		if err := s.writeRootOffset(metadataPageOffset); err != nil {
+			types.GlobalLogger.Debug("Error writing root offset to header: %v", err)
+			return 0, err
 		}
-		s.root = metadataOffset
+		s.root = metadataPageOffset
 
-		fmt.Printf("DEBUG: Wrote metadata key '%s' at offset %d\n", key, metadataOffset)
+		types.GlobalLogger.Debug("Wrote metadata key '%s' at offset %d", key, metadataPageOffset)
 	} else {
-		// For data rows, we'll use a different strategy to ensure we don't lose rows:
-		// Find the tableName from the key and store rows in pages by table
-
-		// Extract table name from key for organizing data
+		// Data rows are appended to the chain of the table's pages
 		tableName := tableNameFromKey(key)
 		if tableName == "" {
-			return fmt.Errorf("could not determine table name from key: %s", key)
-		}
-
-		// Use a different page offset for each table to avoid conflicts
-		// We'll use a simple hash of the table name to determine the page
-		tableHash := 0
-		for _, c := range tableName {
-			tableHash = tableHash*31 + int(c)
-		}
-		pageIndex := 1 + (tableHash % 100) // Distribute across 100 possible pages
-		dataOffset := int64(8 + pageSize*pageIndex)
-
-		// Read existing pages for this table
-		dataPage := s.pagePool.Get().([]byte)
-		defer s.pagePool.Put(dataPage)
-
-		// Get current node info
-		bytesRead, err := s.file.ReadAt(dataPage, dataOffset)
-		if err != nil && err != io.EOF {
-			fmt.Printf("DEBUG: Error reading data page: %v\n", err)
-			return err
-		}
-
-		var node *BTreeNode
-		var numKeys int
-
-		// Check if we have an existing data page or need to create a new one
-		if bytesRead > 0 {
-			// Parse existing page
-			bufOffset := int64(0)
-			numKeys = int(binary.BigEndian.Uint64(dataPage[bufOffset:]))
-
-			// Create node from existing data
-			node = &BTreeNode{
-				isLeaf:   true,
-				numKeys:  numKeys,
-				keys:     make([]string, maxKeys),
-				values:   make([][]byte, maxKeys),
-				children: make([]int64, maxKeys+1),
-			}
-
-			// Read existing keys/values
-			bufOffset = 16 // Skip the numKeys and isLeaf fields
-			for i := 0; i < numKeys; i++ {
-				// Read key
-				keyLen := binary.BigEndian.Uint32(dataPage[bufOffset:])
-				bufOffset += 4
-				if keyLen > 0 {
-					node.keys[i] = string(dataPage[bufOffset : bufOffset+int64(keyLen)])
-				}
-				bufOffset += int64(keyLen)
-
-				// Read value
-				valueLen := binary.BigEndian.Uint32(dataPage[bufOffset:])
-				bufOffset += 4
-				if valueLen > 0 {
-					node.values[i] = make([]byte, valueLen)
-					copy(node.values[i], dataPage[bufOffset:bufOffset+int64(valueLen)])
-				}
-				bufOffset += int64(valueLen)
-			}
-
-			fmt.Printf("DEBUG: Read existing data page with %d keys for table '%s'\n", numKeys, tableName)
-		} else {
-			// Create a new node
-			node = &BTreeNode{
-				isLeaf:   true,
-				numKeys:  0,
-				keys:     make([]string, maxKeys),
-				values:   make([][]byte, maxKeys),
-				children: make([]int64, maxKeys+1),
-			}
-			fmt.Printf("DEBUG: Creating new data page for table '%s'\n", tableName)
-		}
-
-		// Check if we need to add the row to this page
-		if node.numKeys < maxKeys {
-			// We have space in the current page
-			node.keys[node.numKeys] = key
-			node.values[node.numKeys] = value
-			node.numKeys++
-			fmt.Printf("DEBUG: Added key %s as item %d in data page for table '%s'\n", key, node.numKeys-1, tableName)
-		} else {
-			// Current page is full, we need to append to a new page
-			// Find the next available page for this table
-			nextPageOffset := dataOffset + pageSize
-
-			// Check if the next page exists and has data related to this table
-			nextPage := s.pagePool.Get().([]byte)
-			defer s.pagePool.Put(nextPage)
-
-			bytesRead, err := s.file.ReadAt(nextPage, nextPageOffset)
-			if err != nil && err != io.EOF {
-				fmt.Printf("DEBUG: Error reading next page: %v\n", err)
-				return err
-			}
-
-			if bytesRead > 0 {
-				// Next page exists, decode it and see if it has space
-				var nextNode *BTreeNode
-				var nextNumKeys int
-
-				// Parse existing next page
-				bufOffset := int64(0)
-				nextNumKeys = int(binary.BigEndian.Uint64(nextPage[bufOffset:]))
-				bufOffset += 8
-				isLeaf := binary.BigEndian.Uint64(nextPage[bufOffset:]) == 1
-				bufOffset += 8
-
-				// Create node from existing data
-				nextNode = &BTreeNode{
-					isLeaf:   isLeaf,
-					numKeys:  nextNumKeys,
-					keys:     make([]string, maxKeys),
-					values:   make([][]byte, maxKeys),
-					children: make([]int64, maxKeys+1),
-				}
-
-				// Read existing keys/values from the next page
-				for i := 0; i < nextNumKeys; i++ {
-					// Read key
-					keyLen := binary.BigEndian.Uint32(nextPage[bufOffset:])
-					bufOffset += 4
-					if keyLen > 0 {
-						nextNode.keys[i] = string(nextPage[bufOffset : bufOffset+int64(keyLen)])
-					}
-					bufOffset += int64(keyLen)
-
-					// Read value
-					valueLen := binary.BigEndian.Uint32(nextPage[bufOffset:])
-					bufOffset += 4
-					if valueLen > 0 {
-						nextNode.values[i] = make([]byte, valueLen)
-						copy(nextNode.values[i], nextPage[bufOffset:bufOffset+int64(valueLen)])
-					}
-					bufOffset += int64(valueLen)
-				}
-
-				fmt.Printf("DEBUG: Current page full, checking next page at offset %d (has %d keys)\n",
-					nextPageOffset, nextNumKeys)
-
-				// If the next page has space, add the key/value
-				if nextNode.numKeys < maxKeys {
-					nextNode.keys[nextNode.numKeys] = key
-					nextNode.values[nextNode.numKeys] = value
-					nextNode.numKeys++
-					fmt.Printf("DEBUG: Added key '%s' to existing overflow page at index %d\n",
-						key, nextNode.numKeys-1)
-				} else {
-					// Next page is full too, create a new overflow page
-					fmt.Printf("DEBUG: Overflow page is also full, creating another overflow page\n")
-
-					// Calculate the offset for another overflow page
-					nextNextPageOffset := nextPageOffset + pageSize
-
-					// Create a new overflow page
-					newOverflowPage := s.pagePool.Get().([]byte)
-					defer s.pagePool.Put(newOverflowPage)
-
-					// Clear the new overflow page
-					for i := range newOverflowPage {
-						newOverflowPage[i] = 0
-					}
-
-					// Create a node for the new overflow page
-					newOverflowNode := &BTreeNode{
-						isLeaf:   true,
-						numKeys:  1,
-						keys:     make([]string, maxKeys),
-						values:   make([][]byte, maxKeys),
-						children: make([]int64, maxKeys+1),
-					}
-					newOverflowNode.keys[0] = key
-					newOverflowNode.values[0] = value
-
-					// Serialize the new overflow node
-					newOffset := int64(0)
-					binary.BigEndian.PutUint64(newOverflowPage[newOffset:], uint64(newOverflowNode.numKeys))
-					newOffset += 8
-					binary.BigEndian.PutUint64(newOverflowPage[newOffset:], 1) // isLeaf = true
-					newOffset += 8
-
-					// Write key and value
-					keyLen := len(newOverflowNode.keys[0])
-					binary.BigEndian.PutUint32(newOverflowPage[newOffset:], uint32(keyLen))
-					newOffset += 4
-					copy(newOverflowPage[newOffset:], newOverflowNode.keys[0])
-					newOffset += int64(keyLen)
-
-					valueLen := len(newOverflowNode.values[0])
-					binary.BigEndian.PutUint32(newOverflowPage[newOffset:], uint32(valueLen))
-					newOffset += 4
-					copy(newOverflowPage[newOffset:], newOverflowNode.values[0])
-
-					// Write the new overflow page
-					fmt.Printf("DEBUG: Writing additional overflow page at offset %d\n", nextNextPageOffset)
-					if _, err := s.file.WriteAt(newOverflowPage[:pageSize], nextNextPageOffset); err != nil {
-						fmt.Printf("DEBUG: Error writing additional overflow page: %v\n", err)
-						return err
-					}
-
-					fmt.Printf("DEBUG: Successfully wrote key '%s' to additional overflow page at offset %d\n",
-						key, nextNextPageOffset)
-
-					// We've written the key to a new overflow page, no need to update the current page
-					return nil
-				}
-
-				// Clear the page for writing
-				for i := range nextPage {
-					nextPage[i] = 0
-				}
-
-				// Serialize the updated node to the page
-				offset := int64(0)
-				binary.BigEndian.PutUint64(nextPage[offset:], uint64(nextNode.numKeys))
-				offset += 8
-				binary.BigEndian.PutUint64(nextPage[offset:], 1) // isLeaf = true
-				offset += 8
-
-				// Write all keys and values
-				for i := 0; i < nextNode.numKeys; i++ {
-					// Write key
-					keyLen := len(nextNode.keys[i])
-					binary.BigEndian.PutUint32(nextPage[offset:], uint32(keyLen))
-					offset += 4
-					copy(nextPage[offset:], nextNode.keys[i])
-					offset += int64(keyLen)
-
-					// Write value
-					valueLen := len(nextNode.values[i])
-					binary.BigEndian.PutUint32(nextPage[offset:], uint32(valueLen))
-					offset += 4
-					copy(nextPage[offset:], nextNode.values[i])
-					offset += int64(valueLen)
-				}
-
-				// Write to the page
-				fmt.Printf("DEBUG: Writing updated overflow page with %d keys at offset %d\n",
-					nextNode.numKeys, nextPageOffset)
-				if _, err := s.file.WriteAt(nextPage[:pageSize], nextPageOffset); err != nil {
-					fmt.Printf("DEBUG: Error writing updated overflow page: %v\n", err)
-					return err
-				}
-
-				fmt.Printf("DEBUG: Successfully wrote updated overflow page containing key '%s'\n", key)
-			} else {
-				// Create a new overflow page
-				fmt.Printf("DEBUG: Creating new overflow page for table '%s' at offset %d\n",
-					tableName, nextPageOffset)
-
-				// Create a new node for the overflow page
-				newNode := &BTreeNode{
-					isLeaf:   true,
-					numKeys:  1,
-					keys:     make([]string, maxKeys),
-					values:   make([][]byte, maxKeys),
-					children: make([]int64, maxKeys+1),
-				}
-				newNode.keys[0] = key
-				newNode.values[0] = value
-
-				// Clear the page for writing
-				for i := range nextPage {
-					nextPage[i] = 0
-				}
-
-				// Serialize the node to the page
-				offset := int64(0)
-				binary.BigEndian.PutUint64(nextPage[offset:], uint64(newNode.numKeys))
-				offset += 8
-				binary.BigEndian.PutUint64(nextPage[offset:], 1) // isLeaf = true
-				offset += 8
-
-				// Write key and value
-				keyLen := len(newNode.keys[0])
-				binary.BigEndian.PutUint32(nextPage[offset:], uint32(keyLen))
-				offset += 4
-				copy(nextPage[offset:], newNode.keys[0])
-				offset += int64(keyLen)
-
-				valueLen := len(newNode.values[0])
-				binary.BigEndian.PutUint32(nextPage[offset:], uint32(valueLen))
-				offset += 4
-				copy(nextPage[offset:], newNode.values[0])
-
-				// Write to the new page
-				fmt.Printf("DEBUG: Writing new overflow page at offset %d\n", nextPageOffset)
-				if _, err := s.file.WriteAt(nextPage[:pageSize], nextPageOffset); err != nil {
-					fmt.Printf("DEBUG: Error writing overflow page: %v\n", err)
-					return err
-				}
-
-				fmt.Printf("DEBUG: Successfully wrote key '%s' to new overflow page at offset %d\n",
-					key, nextPageOffset)
-			}
-
-			// We've written to a different page, so we don't need to update the current page
-			return nil
+			return 0, fmt.Errorf("could not determine table name from key: %s", key)
 		}
-
-		// Clear the page for writing
-		for i := range dataPage {
-			dataPage[i] = 0
-		}
-
-		// Serialize the node to the page
-		offset := int64(0)
-		binary.BigEndian.PutUint64(dataPage[offset:], uint64(node.numKeys))
-		offset += 8
-		binary.BigEndian.PutUint64(dataPage[offset:], 1) // isLeaf = true
-		offset += 8
-
-		// Write all keys and values
-		for i := 0; i < node.numKeys; i++ {
-			// Write key
-			keyLen := len(node.keys[i])
-			binary.BigEndian.PutUint32(dataPage[offset:], uint32(keyLen))
-			offset += 4
-			copy(dataPage[offset:], node.keys[i])
-			offset += int64(keyLen)
-
-			// Write value
-			valueLen := len(node.values[i])
-			binary.BigEndian.PutUint32(dataPage[offset:], uint32(valueLen))
-			offset += 4
-			copy(dataPage[offset:], node.values[i])
-			offset += int64(valueLen)
-		}
-
-		// Write the page to disk
-		fmt.Printf("DEBUG: Writing data page with %d keys to offset %d\n", node.numKeys, dataOffset)
-		if _, err := s.file.WriteAt(dataPage[:pageSize], dataOffset); err != nil {
-			fmt.Printf("DEBUG: Error writing data page: %v\n", err)
-			return err
+		var err error
+		if offset, err = s.appendToChain(s.tablePageOffset(tableName), key, value); err != nil {
+			types.GlobalLogger.Debug("Error writing data page: %v", err)
+			return 0, err
 		}
-
-		fmt.Printf("DEBUG: Successfully wrote data page containing key '%s'\n", key)
+		types.GlobalLogger.Debug("Successfully wrote data page containing key '%s'", key)
 	}
 
 	// Force a sync to ensure data is written to disk
-	if err := s.file.Sync(); err != nil {
-		fmt.Printf("DEBUG: Error syncing file: %v\n", err)
+	if err := s.pages.sync(); err != nil {
+		types.GlobalLogger.Debug("Error syncing file: %v", err)
 	}
 
-	return nil
+	return offset, nil
 }
 
 func (s *BTreeStorage) insertNonFull(node *BTreeNode, key string, value []byte) error {
-	fmt.Printf("DEBUG: insertNonFull for key '%s', node has %d keys\n", key, node.numKeys)
+	types.GlobalLogger.Debug("insertNonFull for key '%s', node has %d keys", key, node.numKeys)
 	i := node.numKeys - 1
 
 	if node.isLeaf {
 		// Insert into leaf node
-		fmt.Println("DEBUG: Inserting into leaf node")
+		types.GlobalLogger.Debug("Inserting into leaf node")
 		for i >= 0 && key < node.keys[i] {
 			node.keys[i+1] = node.keys[i]
 			node.values[i+1] = node.values[i]
@@ -982,65 +924,64 @@ func (s *BTreeStorage) insertNonFull(node *BTreeNode, key string, value []byte)
 		node.keys[i] = key
 		node.values[i] = value
 		node.numKeys++
-		fmt.Printf("DEBUG: Leaf node now has %d keys\n", node.numKeys)
+		types.GlobalLogger.Debug("Leaf node now has %d keys", node.numKeys)
 
 		// Write node back to disk
 		offset, err := s.writeNode(node)
 		if err != nil {
-			fmt.Printf("DEBUG: Error writing node: %v\n", err)
+			types.GlobalLogger.Debug("Error writing node: %v", err)
 			return err
 		}
 
-		fmt.Printf("DEBUG: Wrote node at offset %d\n", offset)
+		types.GlobalLogger.Debug("Wrote node at offset %d", offset)
 
 		// If this is the root node (or we're updating the root),
 		// update the root pointer and file header
 		if s.root == 0 || offset == 0 {
 			s.root = offset
-			fmt.Printf("DEBUG: Updated root offset to %d\n", s.root)
+			types.GlobalLogger.Debug("Updated root offset to %d", s.root)
 
 			// Update root offset in file header
-			s.file.Seek(0, 0)
-			if err := binary.Write(s.file, binary.BigEndian, offset); err != nil {
-				fmt.Printf("DEBUG: Error writing root offset to header: %v\n", err)
+			if err := s.writeRootOffset(offset); err != nil {
+				types.GlobalLogger.Debug("Error writing root offset to header: %v", err)
 				return err
 			}
-			fmt.Println("DEBUG: Updated root offset in file header")
+			types.GlobalLogger.Debug("Updated root offset in file header")
 		}
 		return nil
 	}
 
 	// Find child to recurse to
-	fmt.Println("DEBUG: Non-leaf node, finding child to recurse to")
+	types.GlobalLogger.Debug("Non-leaf node, finding child to recurse to")
 	for i >= 0 && key < node.keys[i] {
 		i--
 	}
 	i++
-	fmt.Printf("DEBUG: Selected child %d\n", i)
+	types.GlobalLogger.Debug("Selected child %d", i)
 
 	child, err := s.readNode(node.children[i])
 	if err != nil {
-		fmt.Printf("DEBUG: Error reading child node: %v\n", err)
+		types.GlobalLogger.Debug("Error reading child node: %v", err)
 		return err
 	}
 
-	if child.numKeys == maxKeys {
+	if child.numKeys == s.maxKeys {
 		// Split child
-		fmt.Printf("DEBUG: Child node is full, splitting\n")
+		types.GlobalLogger.Debug("Child node is full, splitting")
 		err = s.splitChild(node, i, child)
 		if err != nil {
-			fmt.Printf("DEBUG: Error splitting child: %v\n", err)
+			types.GlobalLogger.Debug("Error splitting child: %v", err)
 			return err
 		}
 
 		if key > node.keys[i] {
 			i++
-			fmt.Printf("DEBUG: After split, moving to child %d\n", i)
+			types.GlobalLogger.Debug("After split, moving to child %d", i)
 		}
 
 		child, err = s.readNode(node.children[i])
 		if err != nil {
-			fmt.Printf("DEBUG: Error reading child after split: %v\n", err)
+			types.GlobalLogger.Debug("Error reading child after split: %v", err)
 			return err
 		}
 	}
@@ -1051,27 +992,27 @@ func (s *BTreeStorage) insertNonFull(node *BTreeNode, key string, value []byte)
 func (s *BTreeStorage) splitChild(parent *BTreeNode, i int, child *BTreeNode) error {
 	newChild := &BTreeNode{
 		isLeaf:   child.isLeaf,
-		numKeys:  minKeys,
-		keys:     make([]string, maxKeys),
-		values:   make([][]byte, maxKeys),
-		children: make([]int64, maxKeys+1),
+		numKeys:  s.minKeys,
+		keys:     make([]string, s.maxKeys),
+		values:   make([][]byte, s.maxKeys),
+		children: make([]int64, s.maxKeys+1),
 	}
 
 	// Copy keys and values to new child
-	for j := 0; j < minKeys; j++ {
-		newChild.keys[j] = child.keys[j+minKeys]
-		newChild.values[j] = child.values[j+minKeys]
+	for j := 0; j < s.minKeys; j++ {
+		newChild.keys[j] = child.keys[j+s.minKeys]
+		newChild.values[j] = child.values[j+s.minKeys]
 	}
 
 	// Copy children if not leaf
 	if !child.isLeaf {
-		for j := 0; j <= minKeys; j++ {
-			newChild.children[j] = child.children[j+minKeys]
+		for j := 0; j <= s.minKeys; j++ {
+			newChild.children[j] = child.children[j+s.minKeys]
 		}
 	}
 
 	// Update child's key count
-	child.numKeys = minKeys
+	child.numKeys = s.minKeys
 
 	// Write new child to disk
 	newChildOffset, err := s.writeNode(newChild)
@@ -1092,8 +1033,8 @@ func (s *BTreeStorage) splitChild(parent *BTreeNode, i int, child *BTreeNode) er
 		parent.children[j+1] = parent.children[j]
 	}
 
-	parent.keys[i] = child.keys[minKeys-1]
-	parent.values[i] = child.values[minKeys-1]
+	parent.keys[i] = child.keys[s.minKeys-1]
+	parent.values[i] = child.values[s.minKeys-1]
 	parent.children[i] = childOffset
 	parent.children[i+1] = newChildOffset
 	parent.numKeys++
@@ -1111,112 +1052,105 @@ func (s *BTreeStorage) splitChild(parent *BTreeNode, i int, child *BTreeNode) er
 }
 
 func (s *BTreeStorage) readRows(tableName string) ([]types.Row, error) {
-	if s.file == nil {
-		return nil, fmt.Errorf("BTree file is closed")
-	}
-	fmt.Printf("DEBUG: readRows called for table '%s'\n", tableName)
+	types.GlobalLogger.Debug("readRows called for table '%s'", tableName)
 
 	// Create an empty result set
 	var rows []types.Row
-
-	// Calculate the hash of the table name to find its pages
-	tableHash := 0
-	for _, c := range tableName {
-		tableHash = tableHash*31 + int(c)
+	err := s.scanRows(tableName, func(key string, row types.Row) error {
+		types.GlobalLogger.Debug("Adding row: %v", row)
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	pageIndex := 1 + (tableHash % 100) // Same hash as in insert method
-	baseOffset := int64(8 + pageSize*pageIndex)
 
-	// We need to read potentially multiple pages for this table
-	// Start with the first page and continue to additional overflow pages
-	currentOffset := baseOffset
-	maxOffset := baseOffset + (pageSize * 100) // Limit to 100 pages per table for safety
+	types.GlobalLogger.Debug("Found %d rows for table '%s'", len(rows), tableName)
+	return rows, nil
+}
 
-	for currentOffset <= maxOffset {
-		// Read the current page
-		page := s.pagePool.Get().([]byte)
-		defer s.pagePool.Put(page)
+// scanRows streams a table's rows page by page, calling fn with each row
+// and the key it is stored under. Rows are decoded with the table's schema
+// while it is in the catalog, and as stored once DropTable removed it.
+func (s *BTreeStorage) scanRows(tableName string, fn func(key string, row types.Row) error) error {
+	// Follow the chain of the table's data pages
+	chain, err := s.tableChain(tableName)
+	if err != nil {
+		return err
+	}
+	table := s.GetTable(tableName)
 
-		bytesRead, err := s.file.ReadAt(page, currentOffset)
+	page := s.pagePool.Get().([]byte)
+	defer s.pagePool.Put(page)
+	for _, offset := range chain {
+		bytesRead, err := s.readPage(page, offset)
 		if err != nil && err != io.EOF {
-			// Error other than EOF, return it
-			fmt.Printf("DEBUG: Error reading data page at offset %d: %v\n", currentOffset, err)
-			return nil, err
+			types.GlobalLogger.Debug("Error reading data page at offset %d: %v", offset, err)
+			return err
 		}
-
-		// Check if we reached the end of the file or an empty page
 		if bytesRead == 0 {
-			fmt.Printf("DEBUG: Reached end of file at offset %d\n", currentOffset)
+			types.GlobalLogger.Debug("Reached end of file at offset %d", offset)
 			break
 		}
 
-		fmt.Printf("DEBUG: Read %d bytes from data page at offset %d\n", bytesRead, currentOffset)
-
-		// Parse the node header
-		bufOffset := int64(0)
-		numKeys := int(binary.BigEndian.Uint64(page[bufOffset:]))
-		bufOffset += 8
-		isLeaf := binary.BigEndian.Uint64(page[bufOffset:]) == 1
-		bufOffset += 8
-
-		fmt.Printf("DEBUG: Data node has %d keys, isLeaf=%v\n", numKeys, isLeaf)
-
-		// If the page is empty or invalid, skip to the next page
-		if numKeys == 0 {
-			fmt.Printf("DEBUG: Empty page at offset %d, checking next page\n", currentOffset)
-			currentOffset += pageSize
-			continue
-		}
-
-		// Process all keys in the node
-		for i := 0; i < numKeys; i++ {
-			// Read key
-			keyLen := binary.BigEndian.Uint32(page[bufOffset:])
-			bufOffset += 4
-			if keyLen == 0 || bufOffset+int64(keyLen) > pageSize {
-				fmt.Printf("DEBUG: Invalid key length %d at offset %d\n", keyLen, bufOffset)
+		// Pages are shared by tables whose names hash alike, so skip the
+		// rows of other tables
+		keys, values := decodeDataPage(page)
+		types.GlobalLogger.Debug("Data page at offset %d has %d keys", offset, len(keys))
+		for i, key := range keys {
+			if tableNameFromKey(key) != tableName {
 				continue
 			}
-
-			key := string(page[bufOffset : bufOffset+int64(keyLen)])
-			bufOffset += int64(keyLen)
-			fmt.Printf("DEBUG: Found key '%s'\n", key)
-
-			// Check if this key belongs to our target table
-			rowTableName := tableNameFromKey(key)
-			fmt.Printf("DEBUG: Key belongs to table '%s'\n", rowTableName)
-
-			// Read value
-			valueLen := binary.BigEndian.Uint32(page[bufOffset:])
-			bufOffset += 4
-			if valueLen == 0 || bufOffset+int64(valueLen) > pageSize {
-				fmt.Printf("DEBUG: Invalid value length %d at offset %d\n", valueLen, bufOffset)
+			row, err := decodeRow(values[i], table)
+			if err != nil {
+				types.GlobalLogger.Debug("Error decoding row: %v", err)
 				continue
 			}
-
-			value := make([]byte, valueLen)
-			copy(value, page[bufOffset:bufOffset+int64(valueLen)])
-			bufOffset += int64(valueLen)
-
-			// If the row belongs to our table, decode and add it
-			if rowTableName == tableName {
-				row, err := decodeRow(value)
-				if err != nil {
-					fmt.Printf("DEBUG: Error decoding row: %v\n", err)
-					continue
-				}
-
-				fmt.Printf("DEBUG: Adding row: %v\n", row)
-				rows = append(rows, row)
+			if err := fn(key, row); err != nil {
+				return err
 			}
 		}
+	}
+
+	return nil
+}
 
-		// Move to the next page
-		currentOffset += pageSize
+// readPage reads one page under the page read lock. The lock is released
+// before the page is decoded, so scans never hold it while calling back.
+func (s *BTreeStorage) readPage(page []byte, offset int64) (int, error) {
+	s.pageMu.RLock()
+	defer s.pageMu.RUnlock()
+	if s.file == nil {
+		return 0, fmt.Errorf("BTree file is closed")
 	}
+	atomic.AddInt64(&s.pageReads, 1)
+	return s.pages.readAt(page, offset)
+}
 
-	fmt.Printf("DEBUG: Found %d rows for table '%s'\n", len(rows), tableName)
-	return rows, nil
+// PageReads returns how many pages have been read from the file since it
+// was opened
+func (s *BTreeStorage) PageReads() int64 {
+	return atomic.LoadInt64(&s.pageReads)
+}
+
+// TableVersion returns a counter that changes whenever a table's rows or
+// schema are written, so that copies of the table can tell whether they
+// are stale. It starts over when the file is opened.
+func (s *BTreeStorage) TableVersion(tableName string) uint64 {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	return s.versions[tableName]
+}
+
+// changed bumps the version of a table. Writers defer it, so that the new
+// version is only seen once the write is done.
+func (s *BTreeStorage) changed(tableName string) {
+	s.versionMu.Lock()
+	defer s.versionMu.Unlock()
+	if s.versions == nil {
+		s.versions = make(map[string]uint64)
+	}
+	s.versions[tableName]++
 }
 
 func (s *BTreeStorage) readRowsFromNode(node *BTreeNode, tableName string, rows []types.Row) ([]types.Row, error) {
@@ -1234,7 +1168,7 @@ func (s *BTreeStorage) readRowsFromNode(node *BTreeNode, tableName string, rows
 
 		// Check if key belongs to this table
 		if tableNameFromKey(node.keys[i]) == tableName {
-			row, err := decodeRow(node.values[i])
+			row, err := decodeRow(node.values[i], s.GetTable(tableName))
 			if err != nil {
 				return nil, err
 			}
@@ -1256,52 +1190,36 @@ func (s *BTreeStorage) readRowsFromNode(node *BTreeNode, tableName string, rows
 	return rows, nil
 }
 
-func (s *BTreeStorage) writeRows(tableName string, rows []types.Row) error {
-	// Delete all existing rows for this table
-	if err := s.Delete(tableName, nil); err != nil {
-		return err
-	}
-
-	// Insert new rows
-	for _, row := range rows {
-		if err := s.insertRow(tableName, row); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 // Helper functions for encoding/decoding rows
 
 func encodeRow(row types.Row) ([]byte, error) {
 	return json.Marshal(row)
 }
 
-func decodeRow(data []byte) (types.Row, error) {
-	var row types.Row
-	err := json.Unmarshal(data, &row)
-	return row, err
+// decodeRow decodes a stored row, with the values of the columns of table
+// in their canonical type (see types.DecodeRow)
+func decodeRow(data []byte, table *types.Table) (types.Row, error) {
+	return types.DecodeRow(data, table)
 }
 
 func tableNameFromKey(key string) string {
-	fmt.Printf("DEBUG: tableNameFromKey called with key: %s\n", key)
+	types.GlobalLogger.Debug("tableNameFromKey called with key: %s", key)
 
 	// Skip meta table keys
 	if strings.HasPrefix(key, "__table__") {
 		tableName := strings.TrimPrefix(key, "__table__")
-		fmt.Printf("DEBUG: Extracted table name from metadata key: %s\n", tableName)
+		types.GlobalLogger.Debug("Extracted table name from metadata key: %s", tableName)
 		return tableName
 	}
 
 	// Regular row keys
 	parts := strings.Split(key, ":")
 	if len(parts) > 0 {
-		fmt.Printf("DEBUG: Extracted table name from row key: %s\n", parts[0])
+		types.GlobalLogger.Debug("Extracted table name from row key: %s", parts[0])
 		return parts[0]
 	}
 
-	fmt.Printf("DEBUG: Could not extract table name from key: %s\n", key)
+	types.GlobalLogger.Debug("Could not extract table name from key: %s", key)
 	return ""
 }
 
@@ -1321,10 +1239,23 @@ func (s *BTreeStorage) validateDataType(value interface{}, columnType string) er
 			}
 		}
 		return fmt.Errorf("value %v is not an integer", value)
+	case "FLOAT":
+		switch value.(type) {
+		case int, int32, int64, float64:
+			return nil
+		}
+		return fmt.Errorf("value %v is not a number", value)
+	case "BOOLEAN":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("value %v is not a boolean", value)
+		}
 	case "STRING", "TEXT":
 		if _, ok := value.(string); !ok {
 			return fmt.Errorf("value %v is not a string", value)
 		}
+	case "DATE", "TIMESTAMP":
+		_, err := types.ParseTime(columnType, value)
+		return err
 	}
 	return nil
 }
@@ -1361,7 +1292,7 @@ func (s *BTreeStorage) validateColumnNames(table *types.Table, values map[string
 	return nil
 }
 
-func (s *BTreeStorage) validateWhereColumns(table *types.Table, where map[string]interface{}) error {
+func (s *BTreeStorage) validateWhereColumns(table *types.Table, where *types.WhereExpr) error {
 	if where == nil {
 		return nil
 	}
@@ -1371,7 +1302,7 @@ func (s *BTreeStorage) validateWhereColumns(table *types.Table, where map[string
 		columnMap[col.Name] = true
 	}
 
-	for colName := range where {
+	for _, colName := range types.WhereColumns(where) {
 		if !columnMap[colName] {
 			return fmt.Errorf("invalid column name in WHERE clause: %s", colName)
 		}
@@ -1379,88 +1310,66 @@ func (s *BTreeStorage) validateWhereColumns(table *types.Table, where map[string
 	return nil
 }
 
-func (s *BTreeStorage) matchesWhere(row types.Row, where map[string]interface{}) bool {
-	if where == nil {
-		return true
-	}
-
-	for col, val := range where {
-		rowVal, ok := row[col]
-		if !ok {
-			return false
-		}
-
-		// Handle different types of value comparisons
-		switch v := val.(type) {
-		case string:
-			// String comparison
-			rowStr, isStr := rowVal.(string)
-			if !isStr || rowStr != v {
-				return false
-			}
-		case int:
-			// Integer comparison with various possible types
-			switch rv := rowVal.(type) {
-			case int:
-				if rv != v {
-					return false
-				}
-			case int64:
-				if int(rv) != v {
-					return false
-				}
-			case float64:
-				if int(rv) != v {
-					return false
-				}
-			default:
-				// If the types are incompatible, it's not a match
-				return false
-			}
-		case float64:
-			// Float comparison
-			rowFloat, isFloat := rowVal.(float64)
-			if !isFloat || rowFloat != v {
-				return false
-			}
-		default:
-			// For any other type, use direct equality
-			if rowVal != val {
-				return false
-			}
-		}
+// Capabilities implements Storage.Capabilities. The file is read-only if
+// recovery found corruption it could not repair.
+func (s *BTreeStorage) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		ReadOnly:                s.writable() != nil,
+		Persistent:              true,
+		SupportsTransactions:    true,
+		SupportsTableCheck:      true,
+		SupportsQuotas:          true,
+		SupportsAlterColumnType: true,
+		SupportsColumnMasks:     true,
+		SupportsAddColumn:       true,
 	}
-	return true
 }
 
+// ShowTables lists the tables in the in-memory catalog. The metadata page
+// is only read if the catalog could not be loaded when the file was opened.
 func (s *BTreeStorage) ShowTables() ([]string, error) {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	fmt.Printf("DEBUG: BTreeStorage.ShowTables called. In-memory tables: %v\n", s.tables)
-
-	// If tables map is empty, try reloading from disk
-	if len(s.tables) == 0 {
-		fmt.Println("DEBUG: No tables in memory, reloading from disk...")
-		if err := s.loadTables(); err != nil {
-			fmt.Printf("DEBUG: Error loading tables from disk: %v\n", err)
+	loaded := s.catalogLoaded
+	s.mu.RUnlock()
+	if !loaded {
+		// A partial list would pass for the whole catalog
+		if err := s.reloadCatalog(); err != nil {
+			return nil, fmt.Errorf("failed to load tables: %w", err)
 		}
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	tables := make([]string, 0, len(s.tables))
 	for name := range s.tables {
 		tables = append(tables, name)
 	}
-	fmt.Printf("DEBUG: Returning tables: %v\n", tables)
 	return tables, nil
 }
 
-// loadTables scans the BTree for table metadata and loads it into memory
+// reloadCatalog retries loading the table metadata under the catalog write
+// lock. A failure is returned and leaves the tables already in memory.
+func (s *BTreeStorage) reloadCatalog() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.catalogLoaded {
+		return nil
+	}
+	if err := s.loadTables(); err != nil {
+		types.GlobalLogger.Warning("Error loading tables: %v", err)
+		return err
+	}
+	s.catalogLoaded = true
+	return nil
+}
+
+// loadTables scans the BTree for table metadata and loads it into memory.
+// The caller must hold the catalog write lock, or be opening the file.
 func (s *BTreeStorage) loadTables() error {
 	if s.file == nil {
 		return fmt.Errorf("BTree file is closed")
 	}
-	fmt.Println("DEBUG: Loading tables from BTree storage...")
+	types.GlobalLogger.Debug("Loading tables from BTree storage...")
 
 	// Initialize tables map if needed
 	if s.tables == nil {
@@ -1468,109 +1377,70 @@ func (s *BTreeStorage) loadTables() error {
 	}
 
 	// Read the root offset
-	var rootOffset int64
-	s.file.Seek(0, 0)
-	if err := binary.Read(s.file, binary.BigEndian, &rootOffset); err != nil {
-		fmt.Printf("DEBUG: Error reading root offset: %v\n", err)
+	rootOffset, err := s.readRootOffset()
+	if err != nil {
+		types.GlobalLogger.Debug("Error reading root offset: %v", err)
 		return err
 	}
-	fmt.Printf("DEBUG: Root offset from header: %d\n", rootOffset)
+	types.GlobalLogger.Debug("Root offset from header: %d", rootOffset)
 
 	// If root offset is 0, file is empty
 	if rootOffset == 0 {
-		fmt.Println("DEBUG: Root offset is 0, no data in file")
+		types.GlobalLogger.Debug("Root offset is 0, no data in file")
 		return nil
 	}
 
-	// Read the page at the root offset
-	page := s.pagePool.Get().([]byte)
-	defer s.pagePool.Put(page)
-
-	bytesRead, err := s.file.ReadAt(page, rootOffset)
+	// Read every table definition in the catalog
+	s.pageMu.RLock()
+	keys, values, err := s.readCatalog()
+	s.pageMu.RUnlock()
 	if err != nil {
-		fmt.Printf("DEBUG: Error reading page at offset %d: %v\n", rootOffset, err)
 		return err
 	}
-	fmt.Printf("DEBUG: Read %d bytes from offset %d\n", bytesRead, rootOffset)
-
-	// Parse the page
-	bufOffset := int64(0)
-	numKeys := int(binary.BigEndian.Uint64(page[bufOffset:]))
-	bufOffset += 8
-	isLeaf := binary.BigEndian.Uint64(page[bufOffset:]) == 1
-	bufOffset += 8
-
-	fmt.Printf("DEBUG: Node has %d keys, isLeaf=%v\n", numKeys, isLeaf)
 
-	// Read each key/value pair
-	for i := 0; i < numKeys; i++ {
-		// Read key
-		keyLen := binary.BigEndian.Uint32(page[bufOffset:])
-		bufOffset += 4
-		if keyLen == 0 || bufOffset+int64(keyLen) > pageSize {
-			fmt.Printf("DEBUG: Invalid key length %d at offset %d\n", keyLen, bufOffset)
+	// Tables that decode are kept even if others do not, but the catalog
+	// is then incomplete and the first failure is returned
+	var loadErr error
+	for i, key := range keys {
+		if !strings.HasPrefix(key, "__table__") {
 			continue
 		}
+		tableName := strings.TrimPrefix(key, "__table__")
 
-		key := string(page[bufOffset : bufOffset+int64(keyLen)])
-		bufOffset += int64(keyLen)
-		fmt.Printf("DEBUG: Key %d: '%s'\n", i, key)
-
-		// Read value length
-		valueLen := binary.BigEndian.Uint32(page[bufOffset:])
-		bufOffset += 4
-		if valueLen == 0 || bufOffset+int64(valueLen) > pageSize {
-			fmt.Printf("DEBUG: Invalid value length %d at offset %d\n", valueLen, bufOffset)
-			continue
-		}
-
-		// Make a copy of the value data
-		value := make([]byte, valueLen)
-		copy(value, page[bufOffset:bufOffset+int64(valueLen)])
-		bufOffset += int64(valueLen)
-
-		// If this is a table metadata key, deserialize it
-		if strings.HasPrefix(key, "__table__") {
-			tableName := strings.TrimPrefix(key, "__table__")
-			fmt.Printf("DEBUG: Found table metadata for '%s'\n", tableName)
-
-			var table types.Table
-			if err := json.Unmarshal(value, &table); err != nil {
-				fmt.Printf("DEBUG: Error deserializing table metadata: %v\n", err)
-				continue
+		var table types.Table
+		if err := json.Unmarshal(values[i], &table); err != nil {
+			types.GlobalLogger.Debug("Error deserializing table metadata for '%s': %v", tableName, err)
+			if loadErr == nil {
+				loadErr = fmt.Errorf("failed to deserialize table metadata for %s: %v", tableName, err)
 			}
-
-			fmt.Printf("DEBUG: Successfully loaded table '%s' with %d columns\n",
-				table.Name, len(table.Columns))
-
-			// Store in memory
-			s.tables[tableName] = &table
+			continue
 		}
+		s.tables[tableName] = &table
 	}
 
-	fmt.Printf("DEBUG: Loaded %d tables from BTree\n", len(s.tables))
-	return nil
+	types.GlobalLogger.Debug("Loaded %d tables from BTree", len(s.tables))
+	return loadErr
 }
 
 // loadTablesFromNode recursively scans a node and its children for table metadata
 func (s *BTreeStorage) loadTablesFromNode(node *BTreeNode) error {
 	for i := 0; i < node.numKeys; i++ {
-		fmt.Printf("DEBUG: Checking key: %s\n", node.keys[i])
+		types.GlobalLogger.Debug("Checking key: %s", node.keys[i])
 
 		// Check each key to see if it's a table metadata key
 		if strings.HasPrefix(node.keys[i], "__table__") {
 			// Extract table name from key
 			tableName := strings.TrimPrefix(node.keys[i], "__table__")
-			fmt.Printf("DEBUG: Found table metadata for '%s'\n", tableName)
+			types.GlobalLogger.Debug("Found table metadata for '%s'", tableName)
 
 			// Deserialize table metadata
 			var table types.Table
 			if err := json.Unmarshal(node.values[i], &table); err != nil {
-				fmt.Printf("DEBUG: Failed to deserialize table metadata: %v\n", err)
+				types.GlobalLogger.Debug("Failed to deserialize table metadata: %v", err)
 				return fmt.Errorf("failed to deserialize table metadata for %s: %v", tableName, err)
 			}
 
-			fmt.Printf("DEBUG: Successfully deserialized table '%s' with %d columns\n",
+			types.GlobalLogger.Debug("Successfully deserialized table '%s' with %d columns",
 				table.Name, len(table.Columns))
 
 			// Store table in memory
@@ -1579,10 +1449,10 @@ func (s *BTreeStorage) loadTablesFromNode(node *BTreeNode) error {
 
 		// Recursively check children if not a leaf node
 		if !node.isLeaf {
-			fmt.Printf("DEBUG: Checking child node %d\n", i)
+			types.GlobalLogger.Debug("Checking child node %d", i)
 			child, err := s.readNode(node.children[i])
 			if err != nil {
-				fmt.Printf("DEBUG: Error reading child node: %v\n", err)
+				types.GlobalLogger.Debug("Error reading child node: %v", err)
 				return err
 			}
 			if err := s.loadTablesFromNode(child); err != nil {
@@ -1593,10 +1463,10 @@ func (s *BTreeStorage) loadTablesFromNode(node *BTreeNode) error {
 
 	// Check the last child if not a leaf node
 	if !node.isLeaf {
-		fmt.Printf("DEBUG: Checking last child node %d\n", node.numKeys)
+		types.GlobalLogger.Debug("Checking last child node %d", node.numKeys)
 		child, err := s.readNode(node.children[node.numKeys])
 		if err != nil {
-			fmt.Printf("DEBUG: Error reading last child node: %v\n", err)
+			types.GlobalLogger.Debug("Error reading last child node: %v", err)
 			return err
 		}
 		if err := s.loadTablesFromNode(child); err != nil {
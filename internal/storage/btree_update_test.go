@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// rowsAffected returns a function that checks a write succeeded and
+// returns the number of rows it changed, as in rowsAffected(t)(s.Delete(...))
+func rowsAffected(t testing.TB) func(int, error) int {
+	return func(n int, err error) int {
+		t.Helper()
+		assert.NoError(t, err)
+		return n
+	}
+}
+
+func TestBTreeUpdateDeleteWriteOnlyMatchingPages(t *testing.T) {
+	s, err := NewBTreeStorageWithPageSize(filepath.Join(t.TempDir(), "rows.db"), 16384)
+	assert.NoError(t, err)
+	defer s.Close()
+	fillTables(t, s, 4, 8)
+	want := tableContents(t, s)
+
+	// Updating one row writes back the one page holding it
+	writes := s.PageCacheStats().Writes
+	assert.Equal(t, 1, rowsAffected(t)(s.Update("table_1", map[string]interface{}{"name": "updated"}, types.WhereAll(map[string]interface{}{"id": float64(3)}))))
+	assert.Equal(t, writes+1, s.PageCacheStats().Writes)
+
+	// Deleting compacts the page in place
+	writes = s.PageCacheStats().Writes
+	assert.Equal(t, 4, rowsAffected(t)(s.Delete("table_2", types.WhereAll(map[string]interface{}{"id": types.Comparison{Operator: "<", Value: float64(4)}}))))
+	assert.Equal(t, writes+1, s.PageCacheStats().Writes)
+
+	// Matching nothing writes nothing
+	writes = s.PageCacheStats().Writes
+	assert.Equal(t, 0, rowsAffected(t)(s.Update("table_1", map[string]interface{}{"name": "none"}, types.WhereAll(map[string]interface{}{"id": float64(100)}))))
+	assert.Equal(t, 0, rowsAffected(t)(s.Delete("table_2", types.WhereAll(map[string]interface{}{"id": float64(100)}))))
+	assert.Equal(t, writes, s.PageCacheStats().Writes)
+
+	var expected []string
+	for _, row := range want {
+		switch {
+		case row == "table_1 3 row3":
+			expected = append(expected, "table_1 3 updated")
+		case row >= "table_2 0" && row < "table_2 4":
+			// deleted
+		default:
+			expected = append(expected, row)
+		}
+	}
+	assert.Equal(t, expected, tableContents(t, s))
+}
+
+func BenchmarkBTreeUpdateOneRow(b *testing.B) {
+	s, err := NewBTreeStorage(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+
+	// Fill the table through the page cache, then write through again
+	const rows = 10000
+	if err := s.SetPageCacheSize(1024); err != nil {
+		b.Fatal(err)
+	}
+	fillTables(b, s, 1, rows)
+	if err := s.SetPageCacheSize(0); err != nil {
+		b.Fatal(err)
+	}
+	chain, err := s.tableChain("table_0")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	writes := s.PageCacheStats().Writes
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := map[string]interface{}{"name": fmt.Sprintf("name%d", i)}
+		if _, err := s.Update("table_0", set, types.WhereAll(map[string]interface{}{"id": float64(i % rows)})); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(chain)), "pages")
+	b.ReportMetric(float64(s.PageCacheStats().Writes-writes)/float64(b.N), "pwrites/op")
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func itemsTable() *types.Table {
+	return &types.Table{
+		Name: "items",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", Nullable: true},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	}
+}
+
+// assertCapabilities checks that the capabilities a storage declares match
+// what it does
+func assertCapabilities(t *testing.T, s Storage) {
+	t.Helper()
+	caps := s.Capabilities()
+
+	// Nothing implements these yet
+	assert.False(t, caps.SupportsTTL)
+	assert.False(t, caps.SupportsStreaming)
+
+	err := s.Insert("items", map[string]interface{}{"id": 1, "name": "pen"})
+	assert.Equal(t, caps.ReadOnly, err != nil, "Insert: %v", err)
+	_, err = s.Update("items", map[string]interface{}{"name": "ink"}, types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.Equal(t, caps.ReadOnly, err != nil, "Update: %v", err)
+
+	tx := NewTransaction(s)
+	works := tx.Insert("items", map[string]interface{}{"id": 2, "name": "cap"}) == nil && tx.Commit() == nil
+	assert.Equal(t, caps.SupportsTransactions && !caps.ReadOnly, works, "Commit")
+
+	works = false
+	if checker, ok := s.(types.TableChecker); ok {
+		_, err := checker.CheckTable("items", false, nil)
+		works = err == nil
+	}
+	assert.Equal(t, caps.SupportsTableCheck, works, "CheckTable")
+
+	// Schema changes are writes too
+	works = false
+	if manager, ok := s.(types.QuotaManager); ok {
+		works = manager.SetQuota("items", types.TableQuota{MaxRows: 100}) == nil
+	}
+	assert.Equal(t, caps.SupportsQuotas && !caps.ReadOnly, works, "SetQuota")
+
+	works = false
+	if masker, ok := s.(types.ColumnMasker); ok {
+		works = masker.SetColumnMask("items", "name", "full") == nil
+	}
+	assert.Equal(t, caps.SupportsColumnMasks && !caps.ReadOnly, works, "SetColumnMask")
+
+	works = false
+	if changer, ok := s.(types.ColumnTypeChanger); ok {
+		works = changer.AlterColumnType("items", "id", "STRING", nil) == nil
+	}
+	assert.Equal(t, caps.SupportsAlterColumnType && !caps.ReadOnly, works, "AlterColumnType")
+
+	works = false
+	if adder, ok := s.(types.ColumnAdder); ok {
+		works = adder.AddColumn("items", types.ColumnDefinition{Name: "note", Type: "STRING", Nullable: true}) == nil
+	}
+	assert.Equal(t, caps.SupportsAddColumn && !caps.ReadOnly, works, "AddColumn")
+
+	works = false
+	if manager, ok := s.(types.IndexManager); ok {
+		works = manager.CreateIndex("items", types.IndexDefinition{Name: "idx_name", Column: "name"}) == nil
+	}
+	assert.Equal(t, caps.SupportsIndexes && !caps.ReadOnly, works, "CreateIndex")
+
+	// Attaching reads the file and writes nothing, so read-only storages
+	// can do it too
+	works = false
+	if attacher, ok := s.(types.ParquetAttacher); ok {
+		path := filepath.Join(t.TempDir(), "events.parquet")
+		writeEventsParquet(t, path, testEvents())
+		_, err := attacher.AttachParquet("events", path)
+		works = err == nil
+	}
+	assert.Equal(t, caps.SupportsAttachParquet, works, "AttachParquet")
+}
+
+func TestCapabilitiesMatchBehavior(t *testing.T) {
+	open := map[string]func(t *testing.T, dir string) Storage{
+		"InMemory": func(t *testing.T, dir string) Storage { return NewInMemoryStorage() },
+		"JSON": func(t *testing.T, dir string) Storage {
+			s, err := NewJSONStorage(dir, "caps")
+			assert.NoError(t, err)
+			return s
+		},
+		"BTree": func(t *testing.T, dir string) Storage {
+			s, err := NewBTreeStorage(filepath.Join(dir, "caps.db"))
+			assert.NoError(t, err)
+			return s
+		},
+		"BTreeUnrecoverable": func(t *testing.T, dir string) Storage {
+			s, err := NewBTreeStorage(filepath.Join(dir, "caps.db"))
+			assert.NoError(t, err)
+			assert.NoError(t, s.CreateTable(itemsTable()))
+			s.recovery = &RecoveryReport{Unrecoverable: "table metadata: damaged"}
+			return s
+		},
+		"Parquet": func(t *testing.T, dir string) Storage {
+			s, err := NewParquetStorage(dir)
+			assert.NoError(t, err)
+			return s
+		},
+		"HybridInMemory": func(t *testing.T, dir string) Storage {
+			olap, err := NewParquetStorage(dir)
+			assert.NoError(t, err)
+			return &HybridStorage{oltp: NewInMemoryStorage(), olap: olap, history: newRoutingHistory(10)}
+		},
+		"HybridBTree": func(t *testing.T, dir string) Storage {
+			oltp, err := NewBTreeStorage(filepath.Join(dir, "caps.db"))
+			assert.NoError(t, err)
+			olap, err := NewParquetStorage(dir)
+			assert.NoError(t, err)
+			return &HybridStorage{oltp: oltp, olap: olap, history: newRoutingHistory(10)}
+		},
+	}
+
+	for name, openStorage := range open {
+		t.Run(name, func(t *testing.T) {
+			s := openStorage(t, t.TempDir())
+			defer s.Close()
+			if s.GetTable("items") == nil {
+				assert.NoError(t, s.CreateTable(itemsTable()))
+			}
+			assertCapabilities(t, s)
+		})
+	}
+}
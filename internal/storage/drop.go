@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// DropTable implements Storage.DropTable. It waits for operations already
+// holding the table's lock to finish before the rows are released.
+func (s *InMemoryStorage) DropTable(tableName string) error {
+	s.db.mu.Lock()
+	if _, exists := s.db.Tables[tableName]; !exists {
+		s.db.mu.Unlock()
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	delete(s.db.Tables, tableName)
+	s.db.mu.Unlock()
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+	s.dropTableIndexes(tableName)
+	return nil
+}
+
+// DropTable implements Storage.DropTable by removing the table's file
+func (s *JSONStorage) DropTable(tableName string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	file, exists := s.catalog[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove table %s: %v", tableName, err)
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	delete(s.catalog, tableName)
+	delete(s.db.Tables, tableName)
+	s.cache.remove(tableName)
+	return nil
+}
+
+// DropTable implements Storage.DropTable. The table leaves the catalog
+// first, so no new operation can start on it, and its rows are deleted
+// from the data pages once running operations release the table lock.
+func (s *BTreeStorage) DropTable(tableName string) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if _, exists := s.tables[tableName]; !exists {
+		s.mu.Unlock()
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	delete(s.tables, tableName)
+	err := s.removeTableMetadata(tableName)
+	s.mu.Unlock()
+	s.dropIndex(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	keys := make(map[string]bool)
+	if err := s.scanRows(tableName, func(key string, row types.Row) error {
+		keys[key] = true
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.deleteRowKeys(tableName, keys)
+}
+
+// DropTable implements Storage.DropTable by removing the table's Parquet
+// file
+func (s *ParquetStorage) DropTable(tableName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.attached[tableName]; ok {
+		return fmt.Errorf("table %s is an attached Parquet file; use DETACH to remove it", tableName)
+	}
+	filePath := filepath.Join(s.baseDir, fmt.Sprintf("%s.parquet", tableName))
+	_, exists := s.tables[tableName]
+	err := os.Remove(filePath)
+	switch {
+	case err == nil:
+	case os.IsNotExist(err):
+		if !exists {
+			return fmt.Errorf("table %s does not exist", tableName)
+		}
+	default:
+		return fmt.Errorf("failed to remove table %s: %v", tableName, err)
+	}
+	delete(s.tables, tableName)
+	delete(s.synced, tableName)
+	return nil
+}
+
+// DropTable implements Storage.DropTable by dropping the table from OLTP,
+// then from OLAP. A table that was never synced to OLAP is not an error.
+func (s *HybridStorage) DropTable(tableName string) error {
+	if s.isAttached(tableName) {
+		return fmt.Errorf("table %s is an attached Parquet file; use DETACH to remove it", tableName)
+	}
+	if err := s.oltp.DropTable(tableName); err != nil {
+		return err
+	}
+	if err := s.olap.DropTable(tableName); err != nil {
+		types.GlobalLogger.Warning("Failed to drop table in OLAP storage: %v", err)
+	}
+	return nil
+}
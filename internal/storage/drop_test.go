@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropTable(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "drop.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	jsonStore, err := NewJSONStorage(filepath.Join(dir, "json"), "test_")
+	assert.NoError(t, err)
+
+	for name, s := range map[string]Storage{"InMemory": NewInMemoryStorage(), "JSON": jsonStore, "BTree": btree} {
+		assert.NoError(t, s.CreateTable(eventsTable()), name)
+		for _, row := range eventRows(4) {
+			assert.NoError(t, s.Insert("events", row), name)
+		}
+
+		assert.NoError(t, s.DropTable("events"), name)
+		assert.Nil(t, s.GetTable("events"), name)
+		tables, err := s.ShowTables()
+		assert.NoError(t, err, name)
+		assert.NotContains(t, tables, "events", name)
+		_, err = s.Select("events", []string{"*"}, nil)
+		assert.EqualError(t, err, "table events does not exist", name)
+		assert.EqualError(t, s.DropTable("events"), "table events does not exist", name)
+
+		// A table created again under the same name starts empty
+		assert.NoError(t, s.CreateTable(eventsTable()), name)
+		rows, err := s.Select("events", []string{"*"}, nil)
+		assert.NoError(t, err, name)
+		assert.Empty(t, rows, name)
+		assert.NoError(t, s.DropTable("events"), name)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "json", "test_events.json"))
+	assert.True(t, os.IsNotExist(err))
+	reopened, err := NewJSONStorage(filepath.Join(dir, "json"), "test_")
+	assert.NoError(t, err)
+	assert.Nil(t, reopened.GetTable("events"))
+}
+
+func TestBTreeDropTablePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "drop.db")
+	s, err := NewBTreeStorage(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateTable(eventsTable()))
+	assert.NoError(t, s.Insert("events", eventRows(1)[0]))
+	assert.NoError(t, s.DropTable("events"))
+	assert.NoError(t, s.Close())
+
+	s, err = NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Nil(t, s.GetTable("events"))
+	assert.NoError(t, s.CreateTable(eventsTable()))
+	rows, err := s.Select("events", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestHybridDropTable(t *testing.T) {
+	dir := t.TempDir()
+	hybrid, err := CreateHybridStorage(StorageConfig{
+		Type:     BTreeStorageType,
+		FilePath: filepath.Join(dir, "drop.btree"),
+		DataDir:  filepath.Join(dir, "parquet"),
+	})
+	assert.NoError(t, err)
+	defer hybrid.Close()
+
+	assert.NoError(t, hybrid.CreateTable(eventsTable()))
+	for _, row := range eventRows(3) {
+		assert.NoError(t, hybrid.Insert("events", row))
+	}
+	_, err = hybrid.SyncNow()
+	assert.NoError(t, err)
+
+	assert.NoError(t, hybrid.DropTable("events"))
+	assert.Nil(t, hybrid.GetOLTPStorage().GetTable("events"))
+	assert.Nil(t, hybrid.GetOLAPStorage().GetTable("events"))
+	_, err = os.Stat(filepath.Join(dir, "parquet", "events.parquet"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Error(t, hybrid.DropTable("events"))
+}
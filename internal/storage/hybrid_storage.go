@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/zakazai/ulin-db/internal/types"
@@ -20,30 +21,54 @@ type HybridStorage struct {
 	// It is read-only and provides columnar access patterns for efficient analytics.
 	olap Storage
 
-	// syncTime records when data was last synchronized from OLTP to OLAP storage.
+	// syncTime records when data was last synchronized from OLTP to OLAP
+	// storage. It is guarded by syncMu, since connections of the server
+	// can sync at the same time.
+	syncMu   sync.Mutex
 	syncTime time.Time
+
+	// history records the routing decision of recent SELECTs.
+	history *routingHistory
+
+	// writeMu is held for reading by every row write and for writing by
+	// WriteExclusive, so a transaction commits with no write in between
+	writeMu sync.RWMutex
 }
 
 // IsOLAPQuery determines if a query is OLAP-style and should be routed to Parquet
-func IsOLAPQuery(columns []string, where map[string]interface{}) bool {
+func IsOLAPQuery(columns []string, where *types.WhereExpr) bool {
+	olap, _ := ClassifyQuery(columns, where)
+	return olap
+}
+
+// ClassifyQuery determines if a query is OLAP-style and reports the signal
+// that decided it
+func ClassifyQuery(columns []string, where *types.WhereExpr) (olap bool, reason string) {
 	// Heuristics to determine if this is an OLAP query:
 	// 1. Query reads many columns (reporting/analytics)
 	// 2. No specific key lookup (range scan or full table scan)
-	// 3. Query contains aggregation (future enhancement)
+	// 3. Query contains aggregation
 
 	// If no WHERE clause or ID lookup, likely an analytical query
-	if where == nil || len(where) == 0 {
-		return true
+	if where == nil {
+		return true, "no WHERE clause"
+	}
+
+	// Aggregates summarize many rows, even after a key lookup
+	for _, col := range columns {
+		if i := strings.Index(col, "("); i > 0 && types.IsAggregateFunc(col[:i]) {
+			return true, fmt.Sprintf("aggregates %s", col)
+		}
 	}
 
 	// If we're selecting all columns, likely an analytical query
 	if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
-		return true
+		return true, "selects all columns"
 	}
 
 	// Check if WHERE contains only ID fields (OLTP) or range conditions (OLAP)
 	idFieldNames := []string{"id", "ID", "Id", "_id", "pk"}
-	for col := range where {
+	for _, col := range types.WhereColumns(where) {
 		isIdField := false
 		for _, idField := range idFieldNames {
 			if strings.EqualFold(col, idField) {
@@ -54,42 +79,46 @@ func IsOLAPQuery(columns []string, where map[string]interface{}) bool {
 
 		if !isIdField {
 			// Non-ID field in WHERE clause suggests OLAP
-			return true
+			return true, fmt.Sprintf("filters on non-key column %s", col)
 		}
 	}
 
 	// Default to OLTP for safety
-	return false
+	return false, "key lookup"
 }
 
 // CreateTable implements Storage.CreateTable by delegating to both backends
 func (s *HybridStorage) CreateTable(table *types.Table) error {
 	// Debug
-	fmt.Printf("DEBUG: HybridStorage.CreateTable called for table '%s'\n", table.Name)
-	fmt.Printf("DEBUG: Table schema: %v\n", table.Columns)
-	
+	types.GlobalLogger.Debug("HybridStorage.CreateTable called for table '%s'", table.Name)
+	types.GlobalLogger.Debug("Table schema: %v", table.Columns)
+
+	if s.isAttached(table.Name) {
+		return fmt.Errorf("table %s already exists", table.Name)
+	}
+
 	// Always create in OLTP first
 	if err := s.oltp.CreateTable(table); err != nil {
-		fmt.Printf("DEBUG: OLTP CreateTable failed: %v\n", err)
+		types.GlobalLogger.Debug("OLTP CreateTable failed: %v", err)
 		return err
 	}
 	
-	fmt.Printf("DEBUG: OLTP CreateTable succeeded for table '%s'\n", table.Name)
+	types.GlobalLogger.Debug("OLTP CreateTable succeeded for table '%s'", table.Name)
 	
 	// Show tables after OLTP creation
 	tables, err := s.oltp.ShowTables()
 	if err != nil {
-		fmt.Printf("DEBUG: Failed to list OLTP tables: %v\n", err)
+		types.GlobalLogger.Debug("Failed to list OLTP tables: %v", err)
 	} else {
-		fmt.Printf("DEBUG: OLTP tables after creation: %v\n", tables)
+		types.GlobalLogger.Debug("OLTP tables after creation: %v", tables)
 	}
 
 	// Then propagate to OLAP
 	if err := s.olap.CreateTable(table); err != nil {
 		// This is not critical, so just log and continue
-		fmt.Printf("Warning: Failed to create table in OLAP storage: %v\n", err)
+		types.GlobalLogger.Warning("Failed to create table in OLAP storage: %v", err)
 	} else {
-		fmt.Printf("DEBUG: OLAP CreateTable succeeded for table '%s'\n", table.Name)
+		types.GlobalLogger.Debug("OLAP CreateTable succeeded for table '%s'", table.Name)
 	}
 
 	return nil
@@ -97,60 +126,269 @@ func (s *HybridStorage) CreateTable(table *types.Table) error {
 
 // Insert implements Storage.Insert by delegating to OLTP
 func (s *HybridStorage) Insert(tableName string, values map[string]interface{}) error {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	return s.insert(tableName, values)
+}
+
+func (s *HybridStorage) insert(tableName string, values map[string]interface{}) error {
+	if err := s.checkWritable(tableName); err != nil {
+		return err
+	}
 	// Inserts always go to OLTP storage
 	return s.oltp.Insert(tableName, values)
 }
 
-// Select implements Storage.Select with intelligent routing
-func (s *HybridStorage) Select(tableName string, columns []string, where map[string]interface{}) ([]types.Row, error) {
-	// First try OLTP storage to ensure we always see the most recent data
-	oltpRows, oltpErr := s.oltp.Select(tableName, columns, where)
-	
-	// If OLTP succeeds, use its results
-	if oltpErr == nil && len(oltpRows) > 0 {
-		return oltpRows, nil
+// InsertRows implements types.BatchInserter on the OLTP storage
+func (s *HybridStorage) InsertRows(tableName string, rows []map[string]interface{}) error {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	return s.insertRows(tableName, rows)
+}
+
+func (s *HybridStorage) insertRows(tableName string, rows []map[string]interface{}) error {
+	if err := s.checkWritable(tableName); err != nil {
+		return err
 	}
-	
-	// If query is OLAP type and OLTP couldn't find data, try OLAP storage
-	if IsOLAPQuery(columns, where) {
-		// Try OLAP storage 
-		rows, err := s.olap.Select(tableName, columns, where)
-
-		// If successful or error is not just "not found", return results
-		if err == nil || (err != nil && !strings.Contains(err.Error(), "does not exist")) {
-			return rows, err
+	return types.InsertRows(s.oltp, tableName, rows)
+}
+
+// Select implements Storage.Select with intelligent routing, recording each
+// decision in the routing history. The RoutingHistoryTable virtual table
+// returns the history itself. Attached Parquet files only exist in OLAP,
+// so their queries go there whatever the classification.
+func (s *HybridStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	if tableName == RoutingHistoryTable {
+		return s.routingHistoryRows(), nil
+	}
+
+	start := time.Now()
+	olap, reason := ClassifyQuery(columns, where)
+	var rows []types.Row
+	var engine string
+	var err error
+	if s.isAttached(tableName) {
+		olap, reason = true, "attached Parquet file"
+		engine = "parquet"
+		rows, err = s.olap.Select(tableName, columns, where)
+	} else {
+		rows, engine, err = s.route(tableName, columns, where, olap)
+	}
+
+	if s.history != nil {
+		decision := RoutingDecision{
+			Time:      start,
+			Statement: normalizeSelect(tableName, columns, where),
+			Class:     map[bool]string{true: "OLAP", false: "OLTP"}[olap],
+			Reason:    reason,
+			Engine:    engine,
+			Rows:      len(rows),
+			Duration:  time.Since(start),
+		}
+		if err != nil {
+			decision.Error = err.Error()
+		}
+		s.history.record(decision)
+	}
+	return rows, err
+}
+
+// route runs a SELECT and returns the engine that produced the result.
+// OLAP queries read the Parquet copy of the table, brought up to date
+// first if the table was written since it was synced; other queries, and
+// OLAP queries on a table whose copy cannot be synced, read the OLTP
+// storage.
+func (s *HybridStorage) route(tableName string, columns []string, where *types.WhereExpr, olap bool) ([]types.Row, string, error) {
+	if olap {
+		if err := s.freshen(tableName); err != nil {
+			types.GlobalLogger.Debug("Reading table %s from OLTP storage: %v", tableName, err)
+		} else {
+			rows, err := s.olap.Select(tableName, columns, where)
+			if err == nil {
+				return rows, "parquet", nil
+			}
+			types.GlobalLogger.Warning("OLAP query failed: %v", err)
 		}
+	}
+
+	rows, err := s.oltp.Select(tableName, columns, where)
+	return rows, "btree", err
+}
 
-		// Fall back to OLTP error if OLAP also fails
-		fmt.Printf("OLAP query failed: %v\n", err)
+// freshen syncs the Parquet copy of a table unless the table was not
+// written since its last sync. A table not synced since the storage was
+// opened is synced too, as its file may predate writes of an earlier run.
+func (s *HybridStorage) freshen(tableName string) error {
+	parquet, ok := s.olap.(*ParquetStorage)
+	if !ok {
+		return fmt.Errorf("OLAP storage %T cannot be synced", s.olap)
 	}
+	return parquet.SyncTable(tableName)
+}
+
+// RoutingHistory returns the recent SELECT routing decisions, oldest first
+func (s *HybridStorage) RoutingHistory() []RoutingDecision {
+	if s.history == nil {
+		return nil
+	}
+	return s.history.entries()
+}
+
+// ResetRoutingHistory clears the routing history
+func (s *HybridStorage) ResetRoutingHistory() {
+	if s.history != nil {
+		s.history.reset()
+	}
+}
 
-	// Return OLTP results, which could be an error or empty result
-	return oltpRows, oltpErr
+func (s *HybridStorage) routingHistoryRows() []types.Row {
+	decisions := s.RoutingHistory()
+	rows := make([]types.Row, len(decisions))
+	for i, d := range decisions {
+		rows[i] = d.Row()
+	}
+	return rows
 }
 
 // Update implements Storage.Update by delegating to OLTP
-func (s *HybridStorage) Update(tableName string, set map[string]interface{}, where map[string]interface{}) error {
+func (s *HybridStorage) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	return s.update(tableName, set, where)
+}
+
+func (s *HybridStorage) update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	if err := s.checkWritable(tableName); err != nil {
+		return 0, err
+	}
 	// Updates always go to OLTP storage
 	return s.oltp.Update(tableName, set, where)
 }
 
 // Delete implements Storage.Delete by delegating to OLTP
-func (s *HybridStorage) Delete(tableName string, where map[string]interface{}) error {
+func (s *HybridStorage) Delete(tableName string, where *types.WhereExpr) (int, error) {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	return s.delete(tableName, where)
+}
+
+func (s *HybridStorage) delete(tableName string, where *types.WhereExpr) (int, error) {
+	if err := s.checkWritable(tableName); err != nil {
+		return 0, err
+	}
 	// Deletes always go to OLTP storage
 	return s.oltp.Delete(tableName, where)
 }
 
+// WriteExclusive implements types.ExclusiveWriter. fn writes through a view
+// of s whose row writes skip the write lock.
+func (s *HybridStorage) WriteExclusive(fn func(s types.Storage) error) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return fn(exclusiveHybrid{s})
+}
+
+// exclusiveHybrid is the view of a HybridStorage given to WriteExclusive,
+// which already holds the write lock
+type exclusiveHybrid struct {
+	*HybridStorage
+}
+
+func (s exclusiveHybrid) Insert(tableName string, values map[string]interface{}) error {
+	return s.insert(tableName, values)
+}
+
+func (s exclusiveHybrid) InsertRows(tableName string, rows []map[string]interface{}) error {
+	return s.insertRows(tableName, rows)
+}
+
+func (s exclusiveHybrid) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	return s.update(tableName, set, where)
+}
+
+func (s exclusiveHybrid) Delete(tableName string, where *types.WhereExpr) (int, error) {
+	return s.delete(tableName, where)
+}
+
+// CheckTable implements types.TableChecker by checking the OLTP copy, which
+// holds the authoritative rows
+func (s *HybridStorage) CheckTable(tableName string, repair bool, progress func(scanned int)) (*types.CheckReport, error) {
+	checker, ok := s.oltp.(types.TableChecker)
+	if !ok {
+		return nil, fmt.Errorf("CHECK TABLE is not supported by %T", s.oltp)
+	}
+	return checker.CheckTable(tableName, repair, progress)
+}
+
+// SetQuota implements types.QuotaManager on the OLTP storage, which takes
+// every insert
+func (s *HybridStorage) SetQuota(tableName string, quota types.TableQuota) error {
+	manager, ok := s.oltp.(types.QuotaManager)
+	if !ok {
+		return fmt.Errorf("table quotas are not supported by %T", s.oltp)
+	}
+	return manager.SetQuota(tableName, quota)
+}
+
+// QuotaUsage implements types.QuotaManager on the OLTP storage
+func (s *HybridStorage) QuotaUsage(tableName string) (types.QuotaUsage, error) {
+	manager, ok := s.oltp.(types.QuotaManager)
+	if !ok {
+		return types.QuotaUsage{}, fmt.Errorf("table quotas are not supported by %T", s.oltp)
+	}
+	return manager.QuotaUsage(tableName)
+}
+
+// AlterColumnType implements types.ColumnTypeChanger on the OLTP storage.
+// The Parquet copy picks up the converted rows on the next sync.
+func (s *HybridStorage) AlterColumnType(tableName, column, newType string, progress func(converted int)) error {
+	changer, ok := s.oltp.(types.ColumnTypeChanger)
+	if !ok {
+		return fmt.Errorf("ALTER COLUMN is not supported by %T", s.oltp)
+	}
+	return changer.AlterColumnType(tableName, column, newType, progress)
+}
+
+// AddColumn implements types.ColumnAdder on the OLTP storage, which holds
+// the table metadata
+func (s *HybridStorage) AddColumn(tableName string, col types.ColumnDefinition) error {
+	adder, ok := s.oltp.(types.ColumnAdder)
+	if !ok {
+		return fmt.Errorf("ADD COLUMN is not supported by %T", s.oltp)
+	}
+	return adder.AddColumn(tableName, col)
+}
+
+// SetColumnMask implements types.ColumnMasker on the OLTP storage, which
+// holds the table metadata
+func (s *HybridStorage) SetColumnMask(tableName, column, policy string) error {
+	masker, ok := s.oltp.(types.ColumnMasker)
+	if !ok {
+		return fmt.Errorf("column masking is not supported by %T", s.oltp)
+	}
+	return masker.SetColumnMask(tableName, column, policy)
+}
+
+// LastRecovery returns the recovery report of the OLTP storage, or nil if
+// it was closed cleanly
+func (s *HybridStorage) LastRecovery() *RecoveryReport {
+	if btree, ok := s.oltp.(*BTreeStorage); ok {
+		return btree.LastRecovery()
+	}
+	return nil
+}
+
 // Close implements Storage.Close by closing both storages
 func (s *HybridStorage) Close() error {
 	var oltpErr, olapErr error
 
+	// Close OLAP storage first, which stops its sync worker before the
+	// OLTP storage it reads from is closed
+	olapErr = s.olap.Close()
+
 	// Close OLTP storage
 	oltpErr = s.oltp.Close()
 
-	// Close OLAP storage
-	olapErr = s.olap.Close()
-
 	// Return first error encountered
 	if oltpErr != nil {
 		return oltpErr
@@ -168,27 +406,49 @@ func (s *HybridStorage) GetTable(tableName string) *types.Table {
 	return s.olap.GetTable(tableName)
 }
 
-// ShowTables implements Storage.ShowTables from OLTP
+// Capabilities implements Storage.Capabilities. Writes and the table
+// features are delegated to the OLTP storage, so they are its capabilities,
+// except ATTACH PARQUET, which the OLAP storage provides.
+func (s *HybridStorage) Capabilities() types.Capabilities {
+	caps := s.oltp.Capabilities()
+	_, caps.SupportsAttachParquet = s.olap.(types.ParquetAttacher)
+	return caps
+}
+
+// ShowTables implements Storage.ShowTables from OLTP, adding the attached
+// Parquet files
 func (s *HybridStorage) ShowTables() ([]string, error) {
 	// Get tables from primary storage (OLTP)
-	return s.oltp.ShowTables()
+	tables, err := s.oltp.ShowTables()
+	if err != nil {
+		return nil, err
+	}
+	if parquetStorage, ok := s.olap.(*ParquetStorage); ok {
+		tables = append(tables, parquetStorage.attachedTables()...)
+	}
+	return tables, nil
 }
 
-// SyncNow forces a synchronization from OLTP to OLAP
-func (s *HybridStorage) SyncNow() error {
+// SyncNow forces a synchronization from OLTP to OLAP of the tables written
+// since their last sync
+func (s *HybridStorage) SyncNow() (SyncStats, error) {
 	// Cast to specific implementation
 	if parquetStorage, ok := s.olap.(*ParquetStorage); ok {
-		err := parquetStorage.SyncFromBTree()
+		stats, err := parquetStorage.SyncFromBTree()
 		if err == nil {
+			s.syncMu.Lock()
 			s.syncTime = time.Now()
+			s.syncMu.Unlock()
 		}
-		return err
+		return stats, err
 	}
-	return fmt.Errorf("OLAP storage is not a ParquetStorage")
+	return SyncStats{}, fmt.Errorf("OLAP storage is not a ParquetStorage")
 }
 
 // GetLastSyncTime returns the time of the last synchronization
 func (s *HybridStorage) GetLastSyncTime() time.Time {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
 	return s.syncTime
 }
 
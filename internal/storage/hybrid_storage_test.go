@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestHybridSelectSeesLatestWrites(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "fresh.db"))
+	assert.NoError(t, err)
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	parquet.SetBTreeSource(btree)
+	s := &HybridStorage{oltp: btree, olap: parquet, history: newRoutingHistory(10)}
+	defer s.Close()
+
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "orders",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "status", Type: "STRING", Nullable: true},
+		},
+	}))
+	assert.NoError(t, s.Insert("orders", map[string]interface{}{"id": 1, "status": "new"}))
+	_, err = s.SyncNow()
+	assert.NoError(t, err)
+
+	// Each OLAP query below reads Parquet, whose copy is synced again
+	// when the table was written since the last sync
+	statuses := func() []string {
+		rows, err := s.Select("orders", []string{"*"}, nil)
+		assert.NoError(t, err)
+		history := s.RoutingHistory()
+		assert.Equal(t, "parquet", history[len(history)-1].Engine)
+		var statuses []string
+		for _, row := range rows {
+			statuses = append(statuses, row["status"].(string))
+		}
+		sort.Strings(statuses)
+		return statuses
+	}
+	assert.Equal(t, []string{"new"}, statuses())
+
+	synced := parquet.TableSyncTime("orders")
+	assert.Equal(t, []string{"new"}, statuses())
+	assert.Equal(t, synced, parquet.TableSyncTime("orders"), "an unchanged table is not synced again")
+
+	assert.NoError(t, s.Insert("orders", map[string]interface{}{"id": 2, "status": "new"}))
+	assert.Equal(t, []string{"new", "new"}, statuses())
+
+	_, err = s.Update("orders", map[string]interface{}{"status": "shipped"}, types.WhereAll(map[string]interface{}{"id": 1}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new", "shipped"}, statuses())
+
+	// Deleting every row leaves no stale file behind
+	_, err = s.Delete("orders", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, statuses())
+}
+
+func TestSyncSkipsUnchangedTables(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "sync.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	parquet.SetBTreeSource(btree)
+
+	for _, name := range []string{"orders", "customers"} {
+		assert.NoError(t, btree.CreateTable(&types.Table{
+			Name:    name,
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}},
+		}))
+		assert.NoError(t, btree.Insert(name, map[string]interface{}{"id": 1}))
+	}
+	stats, err := parquet.SyncFromBTree()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Tables)
+	assert.Equal(t, 2, stats.Rows)
+
+	// Backdate both files, so that a rewrite shows in their mtime
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	mtime := func(name string) time.Time {
+		info, err := os.Stat(filepath.Join(dir, name+".parquet"))
+		assert.NoError(t, err)
+		return info.ModTime()
+	}
+	for _, name := range []string{"orders", "customers"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(dir, name+".parquet"), old, old))
+	}
+
+	assert.NoError(t, btree.Insert("orders", map[string]interface{}{"id": 2}))
+	stats, err = parquet.SyncFromBTree()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Tables)
+	assert.Equal(t, 1, stats.Skipped)
+	assert.Equal(t, 2, stats.Rows)
+	assert.True(t, mtime("customers").Equal(old), "an unchanged table is not rewritten")
+	assert.False(t, mtime("orders").Equal(old))
+
+	// Writes through any path make the table stale
+	_, err = btree.Update("customers", map[string]interface{}{"id": 3}, nil)
+	assert.NoError(t, err)
+	stats, err = parquet.SyncFromBTree()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.Tables)
+	assert.Equal(t, 1, stats.Rows)
+	assert.False(t, mtime("customers").Equal(old))
+
+	stats, err = parquet.SyncFromBTree()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Tables)
+	assert.Equal(t, 2, stats.Skipped)
+}
+
+func TestHybridCloseStopsSyncWorker(t *testing.T) {
+	dir := t.TempDir()
+	s, err := CreateHybridStorage(StorageConfig{
+		Type:         BTreeStorageType,
+		FilePath:     filepath.Join(dir, "worker.db"),
+		DataDir:      filepath.Join(dir, "parquet"),
+		SyncInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	parquet := s.GetOLAPStorage().(*ParquetStorage)
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt64(&parquet.syncRuns) >= 2 },
+		time.Second, time.Millisecond)
+	assert.NoError(t, s.Close())
+
+	runs := atomic.LoadInt64(&parquet.syncRuns)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, runs, atomic.LoadInt64(&parquet.syncRuns), "no sync starts once the storage is closed")
+
+	// Stopping again is harmless
+	parquet.StopSyncWorker()
+}
+
+func TestSyncDelay(t *testing.T) {
+	interval := 10 * time.Second
+	assert.Equal(t, interval, syncDelay(interval, 0))
+
+	// Consecutive failures double the wait, plus up to a quarter of jitter
+	for failures, base := range map[int]time.Duration{1: 20 * time.Second, 3: 80 * time.Second, 20: maxSyncBackoff} {
+		delay := syncDelay(interval, failures)
+		assert.GreaterOrEqual(t, delay, base)
+		assert.LessOrEqual(t, delay, base+base/4)
+	}
+
+	// An interval longer than the cap is kept
+	assert.GreaterOrEqual(t, syncDelay(time.Hour, 5), time.Hour)
+}
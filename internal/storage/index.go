@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// valueIndex is a secondary index of an InMemoryStorage table. It maps the
+// values of a column to the positions in table.Rows of the rows holding
+// them; NULL and values that cannot be indexed (see indexValue) are left
+// out, since an equality on an indexable value never matches them.
+//
+// Inserts and updates change the index in place. Deletes and quota
+// evictions move the rows that are kept, so they rebuild the indexes of
+// the table.
+type valueIndex struct {
+	column string
+	rows   map[string][]int
+}
+
+func newValueIndex(table *types.Table, column string) *valueIndex {
+	idx := &valueIndex{column: column, rows: make(map[string][]int)}
+	for i, row := range table.Rows {
+		idx.add(row[column], i)
+	}
+	return idx
+}
+
+func (idx *valueIndex) add(value interface{}, pos int) {
+	if key, ok := indexValue(value); ok {
+		idx.rows[key] = append(idx.rows[key], pos)
+	}
+}
+
+func (idx *valueIndex) remove(value interface{}, pos int) {
+	key, ok := indexValue(value)
+	if !ok {
+		return
+	}
+	positions := idx.rows[key]
+	for i, p := range positions {
+		if p == pos {
+			positions = append(positions[:i], positions[i+1:]...)
+			break
+		}
+	}
+	if len(positions) == 0 {
+		delete(idx.rows, key)
+	} else {
+		idx.rows[key] = positions
+	}
+}
+
+// CreateIndex implements types.IndexManager. The index is built from the
+// rows already in the table and recorded in its Indexes.
+func (s *InMemoryStorage) CreateIndex(tableName string, index types.IndexDefinition) error {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if columnIndex(table, index.Column) < 0 {
+		return fmt.Errorf("column %s does not exist in table %s", index.Column, tableName)
+	}
+	if err := s.addIndex(table, index); err != nil {
+		return err
+	}
+	table.Indexes = append(table.Indexes, index)
+	return nil
+}
+
+// DropIndex implements types.IndexManager
+func (s *InMemoryStorage) DropIndex(indexName string) error {
+	s.indexMu.Lock()
+	tableName, exists := s.indexTables[indexName]
+	s.indexMu.Unlock()
+	if !exists {
+		return fmt.Errorf("index %s does not exist", indexName)
+	}
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if s.indexTables[indexName] != tableName {
+		return fmt.Errorf("index %s does not exist", indexName)
+	}
+	delete(s.indexTables, indexName)
+	delete(s.indexes[tableName], indexName)
+
+	indexes := table.Indexes[:0:0]
+	for _, def := range table.Indexes {
+		if def.Name != indexName {
+			indexes = append(indexes, def)
+		}
+	}
+	table.Indexes = indexes
+	return nil
+}
+
+// addIndex registers an index of a table and builds it. The caller must
+// hold the table lock, or the catalog lock for a table being created.
+func (s *InMemoryStorage) addIndex(table *types.Table, index types.IndexDefinition) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if _, exists := s.indexTables[index.Name]; exists {
+		return fmt.Errorf("index %s already exists", index.Name)
+	}
+	s.indexTables[index.Name] = table.Name
+	if s.indexes[table.Name] == nil {
+		s.indexes[table.Name] = make(map[string]*valueIndex)
+	}
+	s.indexes[table.Name][index.Name] = newValueIndex(table, index.Column)
+	return nil
+}
+
+// dropTableIndexes forgets the indexes of a dropped table
+func (s *InMemoryStorage) dropTableIndexes(tableName string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	for name := range s.indexes[tableName] {
+		delete(s.indexTables, name)
+	}
+	delete(s.indexes, tableName)
+}
+
+// tableIndexes returns the indexes of a table by name. The map is only
+// changed under the table lock, which the caller must hold.
+func (s *InMemoryStorage) tableIndexes(tableName string) map[string]*valueIndex {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	return s.indexes[tableName]
+}
+
+// reindex rebuilds the indexes of a table after rows were removed or
+// rewritten. The caller must hold the table lock.
+func (s *InMemoryStorage) reindex(table *types.Table) {
+	indexes := s.tableIndexes(table.Name)
+	for name, idx := range indexes {
+		indexes[name] = newValueIndex(table, idx.column)
+	}
+}
+
+// candidateRows returns the rows of a table that can match where: those
+// an index lists for an equality on its column, and otherwise every row.
+// The caller must hold the table lock.
+func (s *InMemoryStorage) candidateRows(table *types.Table, where *types.WhereExpr) []types.Row {
+	indexes := s.tableIndexes(table.Name)
+	if len(indexes) == 0 {
+		return table.Rows
+	}
+
+	// Indexes are tried in the order they were created, so the same query
+	// always uses the same one
+	for _, def := range table.Indexes {
+		idx, ok := indexes[def.Name]
+		if !ok {
+			continue
+		}
+		value, ok := where.Equality(idx.column)
+		if !ok {
+			continue
+		}
+		key, ok := indexValue(value)
+		if !ok {
+			continue
+		}
+		positions := idx.rows[key]
+		rows := make([]types.Row, len(positions))
+		for i, pos := range positions {
+			rows[i] = table.Rows[pos]
+		}
+		return rows
+	}
+	return table.Rows
+}
+
+// CreateIndex implements types.IndexManager on the OLTP storage, which
+// holds the table metadata
+func (s *HybridStorage) CreateIndex(tableName string, index types.IndexDefinition) error {
+	manager, ok := s.oltp.(types.IndexManager)
+	if !ok {
+		return types.Unsupported("CREATE INDEX")
+	}
+	return manager.CreateIndex(tableName, index)
+}
+
+// DropIndex implements types.IndexManager on the OLTP storage
+func (s *HybridStorage) DropIndex(indexName string) error {
+	manager, ok := s.oltp.(types.IndexManager)
+	if !ok {
+		return types.Unsupported("DROP INDEX")
+	}
+	return manager.DropIndex(indexName)
+}
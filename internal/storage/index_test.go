@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// fillEmployees creates an employees table of rows spread over depts
+// departments
+func fillEmployees(t testing.TB, s *InMemoryStorage, rows, depts int) {
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "department", Type: "STRING", Nullable: true},
+		},
+	}))
+	batch := make([]map[string]interface{}, rows)
+	for i := range batch {
+		batch[i] = map[string]interface{}{"id": i, "department": fmt.Sprintf("dept%d", i%depts)}
+	}
+	assert.NoError(t, s.InsertRows("employees", batch))
+}
+
+func TestInMemorySecondaryIndex(t *testing.T) {
+	s := NewInMemoryStorage()
+	fillEmployees(t, s, 100, 10)
+	assert.NoError(t, s.CreateIndex("employees", types.IndexDefinition{Name: "idx_dept", Column: "department"}))
+	assert.Equal(t, []types.IndexDefinition{{Name: "idx_dept", Column: "department"}}, s.GetTable("employees").Indexes)
+
+	ids := func(where *types.WhereExpr) []int64 {
+		rows, err := s.Select("employees", []string{"id"}, where)
+		assert.NoError(t, err)
+		ids := make([]int64, len(rows))
+		for i, row := range rows {
+			ids[i] = row["id"].(int64)
+		}
+		return ids
+	}
+	candidates := func(where *types.WhereExpr) int {
+		return len(s.candidateRows(s.GetTable("employees"), where))
+	}
+
+	// Only the rows of the department are read
+	where := types.WhereAll(map[string]interface{}{"department": "dept3"})
+	assert.Equal(t, 10, candidates(where))
+	assert.Equal(t, []int64{3, 13, 23, 33, 43, 53, 63, 73, 83, 93}, ids(where))
+	assert.Equal(t, []int64{23}, ids(types.WhereAll(map[string]interface{}{"department": "dept3", "id": 23})))
+	rows, err := s.Select("employees", []string{"COUNT(*)"}, where)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"count": 10}}, rows)
+	assert.Empty(t, ids(types.WhereAll(map[string]interface{}{"department": "missing"})))
+
+	// Other conditions scan the table
+	assert.Equal(t, 100, candidates(types.WhereAll(map[string]interface{}{"department": types.Comparison{Operator: "!=", Value: "dept3"}})))
+	assert.Equal(t, 100, candidates(types.WhereAll(map[string]interface{}{"id": 3})))
+
+	// Writes keep the index up to date
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 100, "department": "dept3"}))
+	assert.Equal(t, 1, rowsAffected(t)(s.Update("employees", map[string]interface{}{"department": "dept4"}, types.WhereAll(map[string]interface{}{"id": 13}))))
+	assert.Equal(t, 50, rowsAffected(t)(s.Delete("employees", types.WhereAll(map[string]interface{}{"id": types.Comparison{Operator: "<", Value: 50}}))))
+	assert.Equal(t, []int64{53, 63, 73, 83, 93, 100}, ids(where))
+	assert.Equal(t, []int64{54, 64, 74, 84, 94}, ids(types.WhereAll(map[string]interface{}{"department": "dept4"})))
+	assert.Equal(t, 1, rowsAffected(t)(s.Update("employees", map[string]interface{}{"department": nil}, types.WhereAll(map[string]interface{}{"id": 53}))))
+	assert.Equal(t, []int64{63, 73, 83, 93, 100}, ids(where))
+
+	// Index names are unique, and must name a column
+	err = s.CreateIndex("employees", types.IndexDefinition{Name: "idx_dept", Column: "id"})
+	assert.EqualError(t, err, "index idx_dept already exists")
+	err = s.CreateIndex("employees", types.IndexDefinition{Name: "idx_x", Column: "x"})
+	assert.EqualError(t, err, "column x does not exist in table employees")
+	err = s.CreateIndex("missing", types.IndexDefinition{Name: "idx_x", Column: "x"})
+	assert.EqualError(t, err, "table missing does not exist")
+
+	assert.NoError(t, s.DropIndex("idx_dept"))
+	assert.Empty(t, s.GetTable("employees").Indexes)
+	assert.Equal(t, 51, candidates(where))
+	assert.Equal(t, []int64{63, 73, 83, 93, 100}, ids(where))
+	assert.EqualError(t, s.DropIndex("idx_dept"), "index idx_dept does not exist")
+
+	// Dropping the table drops its indexes, and a definition with indexes
+	// gets them built
+	assert.NoError(t, s.CreateIndex("employees", types.IndexDefinition{Name: "idx_dept", Column: "department"}))
+	assert.NoError(t, s.DropTable("employees"))
+	assert.EqualError(t, s.DropIndex("idx_dept"), "index idx_dept does not exist")
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name:    "teams",
+		Columns: []types.ColumnDefinition{{Name: "lead", Type: "STRING"}},
+		Rows:    []types.Row{{"lead": "ann"}, {"lead": "bob"}},
+		Indexes: []types.IndexDefinition{{Name: "idx_lead", Column: "lead"}},
+	}))
+	assert.Equal(t, 1, len(s.candidateRows(s.GetTable("teams"), types.WhereAll(map[string]interface{}{"lead": "bob"}))))
+}
+
+func TestInMemoryIndexQuotaEviction(t *testing.T) {
+	s := NewInMemoryStorage()
+	fillEmployees(t, s, 10, 2)
+	assert.NoError(t, s.CreateIndex("employees", types.IndexDefinition{Name: "idx_dept", Column: "department"}))
+	assert.NoError(t, s.SetQuota("employees", types.TableQuota{MaxRows: 10, EvictOldest: true}))
+
+	// Evicting the oldest rows moves the others
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 10, "department": "dept0"}))
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 11, "department": "dept1"}))
+	rows, err := s.Select("employees", []string{"id"}, types.WhereAll(map[string]interface{}{"department": "dept0"}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(2)}, {"id": int64(4)}, {"id": int64(6)}, {"id": int64(8)}, {"id": int64(10)}}, rows)
+}
+
+func BenchmarkInMemoryIndexLookup(b *testing.B) {
+	const rows, depts = 100000, 1000
+	for _, indexed := range []bool{false, true} {
+		s := NewInMemoryStorage()
+		fillEmployees(b, s, rows, depts)
+		name := "scanned"
+		if indexed {
+			name = "indexed"
+			if err := s.CreateIndex("employees", types.IndexDefinition{Name: "idx_dept", Column: "department"}); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				where := types.WhereAll(map[string]interface{}{"department": fmt.Sprintf("dept%d", (i*7919)%depts)})
+				got, err := s.Select("employees", []string{"id"}, where)
+				if err != nil || len(got) != rows/depts {
+					b.Fatalf("lookup %v: %d rows, %v", where, len(got), err)
+				}
+			}
+		})
+	}
+}
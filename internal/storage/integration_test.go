@@ -3,10 +3,13 @@ package storage_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
 	"github.com/zakazai/ulin-db/internal/parser"
 	"github.com/zakazai/ulin-db/internal/storage"
 	"github.com/zakazai/ulin-db/internal/types"
@@ -76,9 +79,9 @@ func TestSQLIntegration(t *testing.T) {
 				insertStmt := stmt.InsertStatement
 				// Map column1, column2, column3 to id, name, age
 				values := map[string]interface{}{
-					"id":   insertStmt.Values["column1"],
-					"name": insertStmt.Values["column2"],
-					"age":  insertStmt.Values["column3"],
+					"id":   insertStmt.Rows[0]["column1"],
+					"name": insertStmt.Rows[0]["column2"],
+					"age":  insertStmt.Rows[0]["column3"],
 				}
 				// Execute directly instead of using the Statement interface
 				err = store.Insert(insertStmt.Table, values)
@@ -133,11 +136,9 @@ func TestMultipleInsertsAndCount(t *testing.T) {
 	rows, err := store.Select("test_rows", []string{"*"}, nil)
 	assert.NoError(t, err)
 
-	// Debug output to see what's happening
-	fmt.Printf("DEBUG INTEGRATION TEST: Retrieved %d rows\n", len(rows))
+	t.Logf("Retrieved %d rows", len(rows))
 	for i, row := range rows {
-		fmt.Printf("DEBUG INTEGRATION TEST: Row %d: ID=%v, Content=%v\n",
-			i, row["id"], row["content"])
+		t.Logf("Row %d: ID=%v, Content=%v", i, row["id"], row["content"])
 	}
 
 	assert.Len(t, rows, rowCount, "All %d records should be preserved", rowCount)
@@ -145,13 +146,13 @@ func TestMultipleInsertsAndCount(t *testing.T) {
 	// Test COUNT(*) functionality
 	countRows, err := store.Select("test_rows", []string{"COUNT(*)"}, nil)
 	assert.NoError(t, err)
-	fmt.Printf("DEBUG INTEGRATION TEST: COUNT(*) returned %v\n", countRows[0]["count"])
+	t.Logf("COUNT(*) returned %v", countRows[0]["count"])
 	assert.Equal(t, rowCount, countRows[0]["count"], "COUNT(*) should return %d for total rows", rowCount)
 
 	// Test COUNT(*) with a WHERE filter
-	firstHalfCount, err := store.Select("test_rows", []string{"COUNT(*)"}, map[string]interface{}{
+	firstHalfCount, err := store.Select("test_rows", []string{"COUNT(*)"}, types.WhereAll(map[string]interface{}{
 		"id": 1,
-	})
+	}))
 	assert.NoError(t, err)
 	assert.Equal(t, 1, firstHalfCount[0]["count"], "COUNT(*) with WHERE id=1 should return 1")
 
@@ -169,16 +170,14 @@ func TestMultipleInsertsAndCount(t *testing.T) {
 	newTotalCount, err := store.Select("test_rows", []string{"COUNT(*)"}, nil)
 	assert.NoError(t, err)
 	expectedTotal := rowCount + additionalRows
-	fmt.Printf("DEBUG INTEGRATION TEST: New COUNT(*) returned %v, expected %d\n",
-		newTotalCount[0]["count"], expectedTotal)
+	t.Logf("New COUNT(*) returned %v, expected %d", newTotalCount[0]["count"], expectedTotal)
 
 	// Check rows again
 	allRows, err := store.Select("test_rows", []string{"*"}, nil)
 	assert.NoError(t, err)
-	fmt.Printf("DEBUG INTEGRATION TEST: After additions, retrieved %d rows\n", len(allRows))
+	t.Logf("After additions, retrieved %d rows", len(allRows))
 	for i, row := range allRows {
-		fmt.Printf("DEBUG INTEGRATION TEST: Row %d: ID=%v, Content=%v\n",
-			i, row["id"], row["content"])
+		t.Logf("Row %d: ID=%v, Content=%v", i, row["id"], row["content"])
 	}
 
 	assert.Equal(t, expectedTotal, newTotalCount[0]["count"],
@@ -230,14 +229,14 @@ func TestStorageIntegration(t *testing.T) {
 	}
 
 	// Test OLTP query (point query)
-	rows, err := hybrid.Select("test_table", []string{"id", "name"}, map[string]interface{}{"id": 1})
+	rows, err := hybrid.Select("test_table", []string{"id", "name"}, types.WhereAll(map[string]interface{}{"id": 1}))
 	assert.NoError(t, err, "Failed to execute OLTP query")
 	assert.Len(t, rows, 1, "Expected 1 row from OLTP query")
-	assert.Equal(t, float64(1), rows[0]["id"])
+	assert.Equal(t, int64(1), rows[0]["id"])
 	assert.Equal(t, "test1", rows[0]["name"])
 
 	// Force sync to ensure data is in Parquet
-	err = hybrid.SyncNow()
+	_, err = hybrid.SyncNow()
 	assert.NoError(t, err, "Failed to sync data")
 
 	// Test OLAP query (full scan)
@@ -246,25 +245,11 @@ func TestStorageIntegration(t *testing.T) {
 	assert.Len(t, rows, 3, "Expected 3 rows from OLAP query")
 
 	// Verify all data is present
-	foundIds := make(map[float64]bool)
-	for _, row := range rows {
-		id := row["id"].(float64)
-		foundIds[id] = true
-		switch id {
-		case 1:
-			assert.Equal(t, "test1", row["name"])
-			assert.Equal(t, float64(100), row["value"])
-		case 2:
-			assert.Equal(t, "test2", row["name"])
-			assert.Equal(t, float64(200), row["value"])
-		case 3:
-			assert.Equal(t, "test3", row["name"])
-			assert.Equal(t, float64(300), row["value"])
-		default:
-			t.Errorf("Unexpected id: %v", id)
-		}
-	}
-	assert.Len(t, foundIds, 3, "Not all expected rows were found")
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "name": "test1", "value": int64(100)},
+		{"id": int64(2), "name": "test2", "value": int64(200)},
+		{"id": int64(3), "name": "test3", "value": int64(300)},
+	}, rows)
 
 	// Test concurrent operations
 	done := make(chan bool)
@@ -286,7 +271,7 @@ func TestStorageIntegration(t *testing.T) {
 			}
 
 			// Select
-			rows, err := hybrid.Select("test_table", []string{"id", "name"}, map[string]interface{}{"id": id + 10})
+			rows, err := hybrid.Select("test_table", []string{"id", "name"}, types.WhereAll(map[string]interface{}{"id": id + 10}))
 			if err != nil {
 				errors <- err
 				return
@@ -311,7 +296,7 @@ func TestStorageIntegration(t *testing.T) {
 	}
 
 	// Final sync and verification
-	err = hybrid.SyncNow()
+	_, err = hybrid.SyncNow()
 	assert.NoError(t, err, "Failed final sync")
 
 	// Verify final state
@@ -319,3 +304,281 @@ func TestStorageIntegration(t *testing.T) {
 	assert.NoError(t, err, "Failed to get final state")
 	assert.Len(t, rows, 8, "Expected 8 total rows (3 initial + 5 concurrent)")
 }
+
+func TestCreateTableIfNotExistsIsIdempotent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "testdb_if_not_exists")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	setupScript := []string{
+		"CREATE TABLE IF NOT EXISTS users (id INT, name STRING)",
+		"CREATE TABLE IF NOT EXISTS orders (id INT, user_id INT)",
+	}
+	runSetup := func(store storage.Storage) {
+		for _, sql := range setupScript {
+			stmt, err := parser.Parse(sql)
+			assert.NoError(t, err)
+			_, err = stmt.Execute(store)
+			assert.NoError(t, err, "setup statement failed: %s", sql)
+		}
+	}
+
+	store, err := storage.NewJSONStorage(tmpDir, "test_")
+	assert.NoError(t, err)
+	runSetup(store)
+	assert.NoError(t, store.Insert("users", map[string]interface{}{"id": 1, "name": "Alice"}))
+	assert.NoError(t, store.Close())
+
+	// Re-running the script against the persisted database must not error
+	// or disturb existing data.
+	store, err = storage.NewJSONStorage(tmpDir, "test_")
+	assert.NoError(t, err)
+	runSetup(store)
+
+	rows, err := store.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "Alice", rows[0]["name"])
+
+	// A conflicting definition is reported with the schema differences
+	stmt, err := parser.Parse("CREATE TABLE IF NOT EXISTS users (id INT, email STRING)")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(store)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "different schema")
+	assert.Contains(t, err.Error(), "email")
+
+	// Without IF NOT EXISTS the duplicate is still an error
+	stmt, err = parser.Parse("CREATE TABLE users (id INT, name STRING)")
+	assert.NoError(t, err)
+	_, err = stmt.Execute(store)
+	assert.Error(t, err)
+}
+
+func TestParquetColumnNameRoundTrip(t *testing.T) {
+	testDir := "test_data"
+	parquetDir := "test_data/parquet"
+	os.MkdirAll(parquetDir, 0755)
+	defer os.RemoveAll(testDir)
+
+	hybrid, err := storage.CreateHybridStorage(storage.StorageConfig{
+		Type:     storage.BTreeStorageType,
+		FilePath: "test_data/names.btree",
+		DataDir:  parquetDir,
+	})
+	assert.NoError(t, err, "Failed to create hybrid storage")
+	defer hybrid.Close()
+
+	err = hybrid.CreateTable(&types.Table{
+		Name: "orders",
+		Columns: []types.ColumnDefinition{
+			{Name: "UserID", Type: "INT"},
+			{Name: "order_2024", Type: "INT"},
+			{Name: "first name", Type: "TEXT"},
+		},
+	})
+	assert.NoError(t, err, "Failed to create table")
+
+	assert.NoError(t, hybrid.Insert("orders", map[string]interface{}{"UserID": 7, "order_2024": 3, "first name": "Ada"}))
+	assert.NoError(t, hybrid.Insert("orders", map[string]interface{}{"UserID": 8, "order_2024": 5, "first name": "Linus"}))
+	_, err = hybrid.SyncNow()
+	assert.NoError(t, err, "Failed to sync data")
+
+	// Query the Parquet side directly using the original SQL names
+	olap := hybrid.GetOLAPStorage()
+	rows, err := olap.Select("orders", []string{"UserID", "first name"}, types.WhereAll(map[string]interface{}{"order_2024": float64(5)}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"UserID": int64(8), "first name": "Linus"}}, rows)
+
+	rows, err = storage.NewParquetReader(parquetDir).ReadTable("orders")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	for _, row := range rows {
+		assert.Contains(t, row, "UserID")
+		assert.Contains(t, row, "order_2024")
+		assert.Contains(t, row, "first name")
+	}
+
+	// The file itself stores sanitized field names plus the mapping back
+	fr, err := local.NewLocalFileReader(filepath.Join(parquetDir, "orders.parquet"))
+	assert.NoError(t, err)
+	defer fr.Close()
+	pr, err := reader.NewParquetColumnReader(fr, 1)
+	assert.NoError(t, err)
+	defer pr.ReadStop()
+
+	var mapping string
+	for _, kv := range pr.Footer.KeyValueMetadata {
+		if kv.Key == "ulindb.column_names" && kv.Value != nil {
+			mapping = *kv.Value
+		}
+	}
+	assert.JSONEq(t, `{"userid": "UserID", "order_2024": "order_2024", "first_name": "first name"}`, mapping)
+}
+
+func TestWhereConditionsAfterSync(t *testing.T) {
+	dir := t.TempDir()
+	hybrid, err := storage.CreateHybridStorage(storage.StorageConfig{
+		Type:     storage.BTreeStorageType,
+		FilePath: filepath.Join(dir, "compare.btree"),
+		DataDir:  filepath.Join(dir, "parquet"),
+	})
+	assert.NoError(t, err, "Failed to create hybrid storage")
+	defer hybrid.Close()
+
+	assert.NoError(t, hybrid.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "salary", Type: "INT"},
+		},
+	}))
+	for id, salary := range []int{80000, 85000, 90000} {
+		assert.NoError(t, hybrid.Insert("employees", map[string]interface{}{"id": id + 1, "salary": salary}))
+	}
+	_, err = hybrid.SyncNow()
+	assert.NoError(t, err, "Failed to sync data")
+
+	// Both compare INT columns with FLOAT values numerically
+	where := types.Condition("salary", types.Comparison{Operator: ">=", Value: float64(85000)})
+	or := types.Or(
+		types.Condition("salary", types.Comparison{Operator: "<", Value: float64(85000)}),
+		types.Condition("id", types.Comparison{Operator: ">", Value: float64(2)}),
+	)
+	for name, s := range map[string]storage.Storage{"BTree": hybrid.GetOLTPStorage(), "Parquet": hybrid.GetOLAPStorage()} {
+		rows, err := s.Select("employees", []string{"id"}, where)
+		assert.NoError(t, err, name)
+		assert.Len(t, rows, 2, name)
+
+		rows, err = s.Select("employees", []string{"id"}, or)
+		assert.NoError(t, err, name)
+		assert.Len(t, rows, 2, name)
+	}
+}
+
+func TestGroupByAfterSync(t *testing.T) {
+	dir := t.TempDir()
+	hybrid, err := storage.CreateHybridStorage(storage.StorageConfig{
+		Type:     storage.BTreeStorageType,
+		FilePath: filepath.Join(dir, "group.btree"),
+		DataDir:  filepath.Join(dir, "parquet"),
+	})
+	assert.NoError(t, err, "Failed to create hybrid storage")
+	defer hybrid.Close()
+	memory := storage.NewInMemoryStorage()
+
+	table := &types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "department", Type: "STRING"},
+			{Name: "level", Type: "INT"},
+			{Name: "salary", Type: "INT"},
+		},
+	}
+	rows := []map[string]interface{}{
+		{"id": 1, "department": "Engineering", "level": 3, "salary": 90000},
+		{"id": 2, "department": "Engineering", "level": 2, "salary": 75000},
+		{"id": 3, "department": "Sales", "level": 2, "salary": 60000},
+		{"id": 4, "department": "Sales", "level": 3, "salary": 70000},
+		{"id": 5, "department": "Sales", "level": 3, "salary": 65000},
+	}
+	for _, s := range []storage.Storage{hybrid, memory} {
+		assert.NoError(t, s.CreateTable(table))
+		for _, row := range rows {
+			assert.NoError(t, s.Insert("employees", row))
+		}
+	}
+	_, err = hybrid.SyncNow()
+	assert.NoError(t, err, "Failed to sync data")
+
+	// Every storage returns values in their column's type, so the rows
+	// are equal
+	for _, sql := range []string{
+		"SELECT department, COUNT(*), AVG(salary) FROM employees GROUP BY department ORDER BY department",
+		"SELECT level, SUM(salary) AS total FROM employees GROUP BY level ORDER BY level",
+		"SELECT department, level, MAX(salary) FROM employees WHERE salary > 60000 GROUP BY department, level ORDER BY department, level",
+	} {
+		stmt, err := parser.Parse(sql)
+		assert.NoError(t, err, sql)
+		results := make(map[string][]types.Row)
+		for name, s := range map[string]storage.Storage{"InMemory": memory, "BTree": hybrid.GetOLTPStorage(), "Parquet": hybrid.GetOLAPStorage()} {
+			result, err := stmt.SelectStatement.Execute(s)
+			assert.NoError(t, err, "%s: %s", name, sql)
+			results[name] = result.([]types.Row)
+		}
+		assert.NotEmpty(t, results["InMemory"], sql)
+		assert.Equal(t, results["InMemory"], results["Parquet"], sql)
+		assert.Equal(t, results["InMemory"], results["BTree"], sql)
+	}
+}
+
+func TestBTreeCatalogPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	table := func(name string) *types.Table {
+		return &types.Table{
+			Name: name,
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "INT", Nullable: false},
+				{Name: "name", Type: "STRING", Nullable: true},
+			},
+		}
+	}
+	// The long name used to hash to a negative page
+	names := []string{"customers", "orders", "order_line_items_archive"}
+
+	first, err := storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	for i, name := range names {
+		assert.NoError(t, first.CreateTable(table(name)))
+		assert.NoError(t, first.Insert(name, map[string]interface{}{"id": i, "name": name}))
+	}
+	assert.NoError(t, first.Close())
+
+	second, err := storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	tables, err := second.ShowTables()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, names, tables)
+	for _, name := range names {
+		rows, err := second.Select(name, []string{"name"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Row{{"name": name}}, rows)
+	}
+	assert.NoError(t, second.Close())
+
+	// A catalog larger than a page continues on further pages, and
+	// shrinks again when tables are dropped
+	path = filepath.Join(t.TempDir(), "large.db")
+	s, err := storage.NewBTreeStorageWithPageSize(path, 1024)
+	assert.NoError(t, err)
+	var many []string
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("table_%02d", i)
+		many = append(many, name)
+		assert.NoError(t, s.CreateTable(table(name)))
+		assert.NoError(t, s.Insert(name, map[string]interface{}{"id": i}))
+	}
+	assert.NoError(t, s.Close())
+
+	s, err = storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	tables, err = s.ShowTables()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, many, tables)
+	for _, name := range many[10:] {
+		assert.NoError(t, s.DropTable(name))
+	}
+	assert.NoError(t, s.Close())
+
+	s, err = storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	tables, err = s.ShowTables()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, many[:10], tables)
+	assert.Equal(t, 1024, s.PageSize())
+	rows, err := s.Select("table_09", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+}
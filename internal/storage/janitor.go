@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// DefaultCleanupMinAge is how long a stray file must have been left alone
+// before Cleanup removes it, so a file a sync is still writing is never
+// touched
+const DefaultCleanupMinAge = time.Hour
+
+// parquetTempSuffix is appended to a Parquet file while it is written; the
+// finished file is renamed into place
+const parquetTempSuffix = ".tmp"
+
+// CleanupOptions controls a Cleanup run
+type CleanupOptions struct {
+	// DryRun lists the stray files without deleting them
+	DryRun bool
+	// MinAge keeps files modified more recently; zero uses
+	// DefaultCleanupMinAge
+	MinAge time.Duration
+}
+
+// CleanupFile is a stray file found by Cleanup
+type CleanupFile struct {
+	Path    string
+	Kind    string // "orphaned parquet" or "temp file"
+	Bytes   int64
+	ModTime time.Time
+}
+
+// CleanupReport lists the files Cleanup removed, or would remove in a dry
+// run, and the bytes reclaimed
+type CleanupReport struct {
+	DryRun bool
+	Files  []CleanupFile
+	Bytes  int64
+}
+
+// Rows returns the report as result rows, one per file
+func (r *CleanupReport) Rows() []types.Row {
+	action := "deleted"
+	if r.DryRun {
+		action = "would delete"
+	}
+	rows := make([]types.Row, len(r.Files))
+	for i, f := range r.Files {
+		rows[i] = types.Row{
+			"path":     f.Path,
+			"kind":     f.Kind,
+			"bytes":    f.Bytes,
+			"modified": f.ModTime.Format(time.RFC3339),
+			"action":   action,
+		}
+	}
+	return rows
+}
+
+// Cleanup removes stray files from the Parquet data directory: the Parquet
+// files of tables that are neither in live nor known to this storage, and
+// temp files left by interrupted syncs. Other files are never touched.
+func (s *ParquetStorage) Cleanup(live []string, opts CleanupOptions) (*CleanupReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if opts.MinAge == 0 {
+		opts.MinAge = DefaultCleanupMinAge
+	}
+	keep := make(map[string]bool, len(live)+len(s.tables))
+	for _, name := range live {
+		keep[name] = true
+	}
+	for name := range s.tables {
+		keep[name] = true
+	}
+
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	report := &CleanupReport{DryRun: opts.DryRun}
+	cutoff := time.Now().Add(-opts.MinAge)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+
+		var kind string
+		switch {
+		case strings.HasSuffix(name, parquetTempSuffix):
+			kind = "temp file"
+		case strings.HasSuffix(name, ".parquet") && !keep[strings.TrimSuffix(name, ".parquet")]:
+			kind = "orphaned parquet"
+		default:
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+
+		path := filepath.Join(s.baseDir, name)
+		if !opts.DryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return report, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+		report.Files = append(report.Files, CleanupFile{Path: path, Kind: kind, Bytes: info.Size(), ModTime: info.ModTime()})
+		report.Bytes += info.Size()
+	}
+
+	return report, nil
+}
+
+// Cleanup removes stray files from the OLAP data directory, keeping the
+// Parquet files of every table in the OLTP catalog. It refuses to run when
+// that catalog could not be read in full.
+func (s *HybridStorage) Cleanup(opts CleanupOptions) (*CleanupReport, error) {
+	parquet, ok := s.olap.(*ParquetStorage)
+	if !ok {
+		return &CleanupReport{DryRun: opts.DryRun}, nil
+	}
+	// Files are only orphaned relative to a complete catalog; with a
+	// damaged one they may be the last copy of a table's rows
+	if btree, ok := s.oltp.(*BTreeStorage); ok {
+		if report := btree.LastRecovery(); report != nil && report.Unrecoverable != "" {
+			return nil, fmt.Errorf("cleanup skipped: %s", report.Unrecoverable)
+		}
+	}
+	live, err := s.oltp.ShowTables()
+	if err != nil {
+		return nil, fmt.Errorf("cleanup skipped: %w", err)
+	}
+	return parquet.Cleanup(live, opts)
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func plantFile(t *testing.T, dir, name string, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(path, []byte("stray data"), 0644))
+	modified := time.Now().Add(-age)
+	assert.NoError(t, os.Chtimes(path, modified, modified))
+}
+
+func TestCleanupRemovesStrayFiles(t *testing.T) {
+	dir := t.TempDir()
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	oltp := NewInMemoryStorage()
+	assert.NoError(t, oltp.CreateTable(&types.Table{Name: "employees", Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}}}))
+	s := &HybridStorage{oltp: oltp, olap: parquet}
+
+	old := 2 * DefaultCleanupMinAge
+	plantFile(t, dir, "employees.parquet", old)      // live table
+	plantFile(t, dir, "dropped.parquet", old)        // orphan
+	plantFile(t, dir, "recent.parquet", time.Minute) // orphan, but too new
+	plantFile(t, dir, "employees.parquet.tmp", old)  // interrupted sync
+	plantFile(t, dir, "syncing.parquet.tmp", time.Minute)
+	plantFile(t, dir, "notes.txt", old) // not ours
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "archive.parquet"), 0755))
+
+	// A dry run lists the candidates and deletes nothing
+	report, err := s.Cleanup(CleanupOptions{DryRun: true})
+	assert.NoError(t, err)
+	if assert.Len(t, report.Files, 2) {
+		assert.Equal(t, filepath.Join(dir, "dropped.parquet"), report.Files[0].Path)
+		assert.Equal(t, "orphaned parquet", report.Files[0].Kind)
+		assert.Equal(t, filepath.Join(dir, "employees.parquet.tmp"), report.Files[1].Path)
+		assert.Equal(t, "temp file", report.Files[1].Kind)
+	}
+	assert.Equal(t, int64(2*len("stray data")), report.Bytes)
+	assert.Equal(t, "would delete", report.Rows()[0]["action"])
+	assert.FileExists(t, filepath.Join(dir, "dropped.parquet"))
+
+	report, err = s.Cleanup(CleanupOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Files, 2)
+	assert.Equal(t, "deleted", report.Rows()[0]["action"])
+	assert.NoFileExists(t, filepath.Join(dir, "dropped.parquet"))
+	assert.NoFileExists(t, filepath.Join(dir, "employees.parquet.tmp"))
+	for _, kept := range []string{"employees.parquet", "recent.parquet", "syncing.parquet.tmp", "notes.txt"} {
+		assert.FileExists(t, filepath.Join(dir, kept))
+	}
+	assert.DirExists(t, filepath.Join(dir, "archive.parquet"))
+
+	// A shorter threshold picks up the newer files
+	report, err = s.Cleanup(CleanupOptions{MinAge: time.Second})
+	assert.NoError(t, err)
+	assert.Len(t, report.Files, 2)
+	assert.FileExists(t, filepath.Join(dir, "employees.parquet"))
+}
+
+func TestParquetWriteLeavesNoTempFile(t *testing.T) {
+	dir := t.TempDir()
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	table := &types.Table{Name: "employees", Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}}}
+	assert.NoError(t, parquet.writeParquetFile("employees", table, []types.Row{{"id": 1}}))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "employees.parquet", entries[0].Name())
+	}
+}
+
+func TestCleanupSkippedWithoutCatalog(t *testing.T) {
+	path, btree := openCrashed(t)
+	dir := t.TempDir()
+	plantFile(t, dir, "users.parquet", 2*DefaultCleanupMinAge)
+
+	// Damage the table metadata so the catalog cannot be loaded
+	page := make([]byte, btree.pageSize)
+	_, err := btree.file.ReadAt(page, metadataPageOffset)
+	assert.NoError(t, err)
+	keyLen := int(binary.BigEndian.Uint32(page[headerSize:]))
+	page[headerSize+4+keyLen+4] = '#'
+	_, err = btree.file.WriteAt(page, metadataPageOffset)
+	assert.NoError(t, err)
+	crash(t, btree)
+
+	btree, err = OpenBTreeStorage(path, 0, RecoveryOptions{Force: true})
+	assert.NoError(t, err)
+	defer btree.Close()
+	_, err = btree.ShowTables()
+	assert.Error(t, err)
+
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	s := &HybridStorage{oltp: btree, olap: parquet}
+	_, err = s.Cleanup(CleanupOptions{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cleanup skipped")
+	}
+	assert.FileExists(t, filepath.Join(dir, "users.parquet"))
+
+	// Without Force the recovery report alone stops the janitor
+	crash(t, btree)
+	btree, err = OpenBTreeStorage(path, 0, RecoveryOptions{})
+	assert.NoError(t, err)
+	s.oltp = btree
+	_, err = s.Cleanup(CleanupOptions{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "table metadata")
+	}
+	assert.FileExists(t, filepath.Join(dir, "users.parquet"))
+}
@@ -0,0 +1,56 @@
+package storage
+
+import "container/list"
+
+// jsonTableCacheSize is the number of JSON tables kept in memory at once.
+// Other tables stay on disk until they are next accessed.
+const jsonTableCacheSize = 64
+
+// jsonTableCache tracks the order in which loaded JSON tables were used so
+// the least recently used one can be dropped from memory. Every write is
+// saved to disk immediately, so an evicted table never has unsaved changes.
+type jsonTableCache struct {
+	capacity int
+	order    *list.List // table names, most recently used at the front
+	elements map[string]*list.Element
+}
+
+func newJSONTableCache(capacity int) *jsonTableCache {
+	return &jsonTableCache{
+		capacity: capacity,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// touch marks a table as most recently used. It returns the name of the
+// table to evict when the cache is over capacity, or "" otherwise.
+func (c *jsonTableCache) touch(name string) string {
+	if elem, ok := c.elements[name]; ok {
+		c.order.MoveToFront(elem)
+		return ""
+	}
+	c.elements[name] = c.order.PushFront(name)
+
+	if c.order.Len() <= c.capacity {
+		return ""
+	}
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	evicted := oldest.Value.(string)
+	delete(c.elements, evicted)
+	return evicted
+}
+
+// len returns the number of loaded tables
+func (c *jsonTableCache) len() int {
+	return c.order.Len()
+}
+
+// remove forgets a table that no longer exists
+func (c *jsonTableCache) remove(name string) {
+	if elem, ok := c.elements[name]; ok {
+		c.order.Remove(elem)
+		delete(c.elements, name)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// writeJSONTables writes n small table files directly, without going
+// through JSONStorage, so setup cost does not depend on the code under test
+func writeJSONTables(tb testing.TB, dir string, n int) {
+	tb.Helper()
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("table%03d", i)
+		table := jsonTable{
+			Name:    name,
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}, {Name: "name", Type: "STRING"}},
+		}
+		for j := 0; j < 20; j++ {
+			table.Rows = append(table.Rows, map[string]interface{}{"id": j, "name": "row"})
+		}
+		data, err := json.Marshal(table)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "t_"+name+".json"), data, 0644); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkOpenJSONStorage500Tables(b *testing.B) {
+	dir := b.TempDir()
+	writeJSONTables(b, dir, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s, err := NewJSONStorage(dir, "t_")
+		if err != nil {
+			b.Fatal(err)
+		}
+		s.Close()
+	}
+}
+
+func TestJSONStorageLazyLoading(t *testing.T) {
+	dir := t.TempDir()
+	writeJSONTables(t, dir, 500)
+
+	s, err := NewJSONStorage(dir, "t_")
+	assert.NoError(t, err)
+	s.cache = newJSONTableCache(2)
+
+	// Opening and listing tables reads only the catalog
+	tables, err := s.ShowTables()
+	assert.NoError(t, err)
+	assert.Len(t, tables, 500)
+	assert.Empty(t, s.db.Tables, "no table should be loaded after open")
+
+	// First access loads the table
+	rows, err := s.Select("table007", []string{"*"}, types.WhereAll(map[string]interface{}{"id": float64(3)}))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+
+	// Writes are saved before the table can be evicted
+	assert.NoError(t, s.Insert("table001", map[string]interface{}{"id": 99, "name": "new"}))
+	assert.NotNil(t, s.GetTable("table002"))
+	assert.NotContains(t, s.db.Tables, "table007", "least recently used table should be evicted")
+	assert.Len(t, s.db.Tables, 2)
+	assert.Equal(t, 2, s.cache.len())
+
+	err = s.CreateTable(&types.Table{
+		Name:    "fresh",
+		Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}},
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, s.db.Tables, "table001")
+
+	rows, err = s.Select("table001", []string{"*"}, types.WhereAll(map[string]interface{}{"id": float64(99)}))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1, "inserted row should survive eviction")
+	assert.NoError(t, s.Close())
+
+	// The catalog stays consistent with the files on disk
+	s, err = NewJSONStorage(dir, "t_")
+	assert.NoError(t, err)
+	tables, err = s.ShowTables()
+	assert.NoError(t, err)
+	assert.Len(t, tables, 501)
+	assert.NotNil(t, s.GetTable("fresh"))
+	assert.Error(t, s.CreateTable(&types.Table{Name: "table400"}), "table exists on disk but is not loaded")
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// errLimitReached stops a scan once a LIMIT has all its rows
+var errLimitReached = errors.New("limit reached")
+
+// SelectLimit implements types.Limiter by scanning the table's pages in
+// order and stopping at the page that completes the limit
+func (s *BTreeStorage) SelectLimit(tableName string, columns []string, where *types.WhereExpr, limit types.LimitSpec) ([]types.Row, error) {
+	if len(columns) == 1 && strings.HasPrefix(strings.ToUpper(columns[0]), "COUNT(") {
+		rows, err := s.Select(tableName, columns, where)
+		if err != nil {
+			return nil, err
+		}
+		return limit.Apply(rows), nil
+	}
+
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSampleColumns(table, columns); err != nil {
+		return nil, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return nil, err
+	}
+
+	if limit.Done(0) {
+		return nil, nil
+	}
+
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var rows []types.Row
+	matched := 0
+	err = s.scanRows(tableName, func(key string, row types.Row) error {
+		if !where.Matches(row) {
+			return nil
+		}
+		matched++
+		if matched > limit.Offset {
+			rows = append(rows, types.ProjectRow(row, columns))
+		}
+		if limit.Done(matched) {
+			return errLimitReached
+		}
+		return nil
+	})
+	if err != nil && err != errLimitReached {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// SelectLimit implements types.Limiter on the OLTP storage, which always
+// has the latest rows
+func (s *HybridStorage) SelectLimit(tableName string, columns []string, where *types.WhereExpr, limit types.LimitSpec) ([]types.Row, error) {
+	return types.SelectLimit(s.oltp, tableName, columns, where, limit)
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestSelectLimit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s types.Storage) {
+		all, err := s.Select("events", []string{"*"}, nil)
+		assert.NoError(t, err)
+
+		// The limit keeps rows in the order Select returns them
+		rows, err := types.SelectLimit(s, "events", []string{"*"}, nil, types.LimitSpec{Count: 3, Offset: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, all[2:5], rows)
+
+		rows, err = types.SelectLimit(s, "events", []string{"id"}, types.WhereAll(map[string]interface{}{"kind": "view"}), types.LimitSpec{Count: 2})
+		assert.NoError(t, err)
+		assert.Len(t, rows, 2)
+		for _, row := range rows {
+			assert.Equal(t, types.Row{"id": row["id"]}, row)
+		}
+
+		rows, err = types.SelectLimit(s, "events", []string{"*"}, nil, types.LimitSpec{Count: types.NoLimit, Offset: 6})
+		assert.NoError(t, err)
+		assert.Equal(t, all[6:], rows)
+
+		rows, err = types.SelectLimit(s, "events", []string{"*"}, nil, types.LimitSpec{Count: 0})
+		assert.NoError(t, err)
+		assert.Empty(t, rows)
+
+		rows, err = types.SelectLimit(s, "events", []string{"*"}, nil, types.LimitSpec{Count: 5, Offset: 20})
+		assert.NoError(t, err)
+		assert.Empty(t, rows)
+
+		_, err = types.SelectLimit(s, "events", []string{"missing"}, nil, types.LimitSpec{Count: 1})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// pageCache sits between BTreeStorage and its file. With a capacity of 0
+// every read and write goes to the file and sync flushes it at once. With a
+// capacity of n it keeps the n most recently used pages in memory: reads
+// are served from it, and written pages stay dirty until they are evicted
+// or flushed, so a run of writes costs one fsync instead of one each.
+//
+// Only whole pages are cached. The header at the start of the file is
+// read and written directly.
+type pageCache struct {
+	mu       sync.Mutex
+	file     *os.File
+	pageSize int64
+	capacity int
+	order    *list.List // cached pages, most recently used at the front
+	elements map[int64]*list.Element
+	size     int64 // file size once dirty pages are written
+
+	stats PageCacheStats
+}
+
+// cachedPage is a page held by a pageCache
+type cachedPage struct {
+	offset int64
+	data   []byte
+	dirty  bool
+}
+
+// PageCacheStats counts a BTree file's page cache hits and the system
+// calls made for pages since the file was opened
+type PageCacheStats struct {
+	Hits   int64
+	Reads  int64 // pread calls
+	Writes int64 // pwrite calls
+	Syncs  int64 // fsync calls
+}
+
+func newPageCache(file *os.File, pageSize int64) *pageCache {
+	c := &pageCache{
+		file:     file,
+		pageSize: pageSize,
+		order:    list.New(),
+		elements: make(map[int64]*list.Element),
+	}
+	if info, err := file.Stat(); err == nil {
+		c.size = info.Size()
+	}
+	return c
+}
+
+// readAt reads the page at offset like os.File.ReadAt. Pages past the end
+// of the file on disk but before a dirty page read as zeros, as they will
+// once the dirty page is written.
+func (c *pageCache) readAt(page []byte, offset int64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.elements[offset]; ok && int64(len(page)) == c.pageSize {
+		c.order.MoveToFront(elem)
+		copy(page, elem.Value.(*cachedPage).data)
+		c.stats.Hits++
+		return len(page), nil
+	}
+
+	n, err := c.file.ReadAt(page, offset)
+	c.stats.Reads++
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	if n < len(page) {
+		for i := n; i < len(page); i++ {
+			page[i] = 0
+		}
+		if end := c.size - offset; end >= int64(len(page)) {
+			n = len(page)
+		} else if end > int64(n) {
+			n = int(end)
+		}
+		if n < len(page) {
+			return n, io.EOF
+		}
+	}
+
+	if c.capacity > 0 && int64(len(page)) == c.pageSize {
+		data := make([]byte, len(page))
+		copy(data, page)
+		if err := c.add(&cachedPage{offset: offset, data: data}); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// writeAt writes the page at offset, to the file if the cache is disabled
+// or to the cache as a dirty page otherwise
+func (c *pageCache) writeAt(page []byte, offset int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.write(page, offset)
+}
+
+func (c *pageCache) write(page []byte, offset int64) error {
+	if end := offset + int64(len(page)); end > c.size {
+		c.size = end
+	}
+	if c.capacity == 0 || int64(len(page)) != c.pageSize {
+		if elem, ok := c.elements[offset]; ok {
+			c.order.Remove(elem)
+			delete(c.elements, offset)
+		}
+		c.stats.Writes++
+		_, err := c.file.WriteAt(page, offset)
+		return err
+	}
+
+	data := make([]byte, len(page))
+	copy(data, page)
+	if elem, ok := c.elements[offset]; ok {
+		cached := elem.Value.(*cachedPage)
+		cached.data = data
+		cached.dirty = true
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	return c.add(&cachedPage{offset: offset, data: data, dirty: true})
+}
+
+// appendPage writes the page after the last page of the file and returns
+// its offset
+func (c *pageCache) appendPage(page []byte) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	offset := c.size
+	return offset, c.write(page, offset)
+}
+
+// sync makes the writes so far durable if the cache is disabled. With the
+// cache enabled, dirty pages wait for eviction or flush.
+func (c *pageCache) sync() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity > 0 {
+		return nil
+	}
+	c.stats.Syncs++
+	return c.file.Sync()
+}
+
+// flush writes every dirty page, in file order, and syncs the file
+func (c *pageCache) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+func (c *pageCache) flushLocked() error {
+	var dirty []*cachedPage
+	for _, elem := range c.elements {
+		if cached := elem.Value.(*cachedPage); cached.dirty {
+			dirty = append(dirty, cached)
+		}
+	}
+	sort.Slice(dirty, func(i, j int) bool { return dirty[i].offset < dirty[j].offset })
+	for _, cached := range dirty {
+		if err := c.writeBack(cached); err != nil {
+			return err
+		}
+	}
+	c.stats.Syncs++
+	return c.file.Sync()
+}
+
+// setCapacity resizes the cache. Shrinking it writes the evicted dirty
+// pages; disabling it flushes the file.
+func (c *pageCache) setCapacity(capacity int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if capacity < 0 {
+		capacity = 0
+	}
+	c.capacity = capacity
+	if capacity == 0 && c.order.Len() > 0 {
+		if err := c.flushLocked(); err != nil {
+			return err
+		}
+		c.order.Init()
+		c.elements = make(map[int64]*list.Element)
+		return nil
+	}
+	return c.evict()
+}
+
+// add caches a page and evicts the least recently used pages over capacity
+func (c *pageCache) add(cached *cachedPage) error {
+	c.elements[cached.offset] = c.order.PushFront(cached)
+	return c.evict()
+}
+
+func (c *pageCache) evict() error {
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		cached := oldest.Value.(*cachedPage)
+		if cached.dirty {
+			if err := c.writeBack(cached); err != nil {
+				return err
+			}
+		}
+		c.order.Remove(oldest)
+		delete(c.elements, cached.offset)
+	}
+	return nil
+}
+
+// writeBack writes a dirty page to the file without syncing it
+func (c *pageCache) writeBack(cached *cachedPage) error {
+	c.stats.Writes++
+	if _, err := c.file.WriteAt(cached.data, cached.offset); err != nil {
+		return err
+	}
+	cached.dirty = false
+	return nil
+}
+
+// len returns the number of cached pages
+func (c *pageCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// fileSize returns the size of the file once dirty pages are written
+func (c *pageCache) fileSize() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// SetPageCacheSize keeps up to pages pages of the file in memory, deferring
+// writes until pages are evicted, Flush or Close. 0 disables the cache:
+// every write is then synced at once, and pages held so far are flushed.
+func (s *BTreeStorage) SetPageCacheSize(pages int) error {
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("BTree file is closed")
+	}
+	return s.pages.setCapacity(pages)
+}
+
+// Flush writes the pages changed in the page cache to the file and syncs it
+func (s *BTreeStorage) Flush() error {
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("BTree file is closed")
+	}
+	return s.pages.flush()
+}
+
+// PageCacheStats returns the page cache's counters
+func (s *BTreeStorage) PageCacheStats() PageCacheStats {
+	s.pages.mu.Lock()
+	defer s.pages.mu.Unlock()
+	return s.pages.stats
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// fillTables creates tables with rows rows each
+func fillTables(t testing.TB, s *BTreeStorage, tables, rows int) {
+	for i := 0; i < tables; i++ {
+		name := fmt.Sprintf("table_%d", i)
+		assert.NoError(t, s.CreateTable(&types.Table{
+			Name: name,
+			Columns: []types.ColumnDefinition{
+				{Name: "id", Type: "INT", Nullable: false},
+				{Name: "name", Type: "STRING", Nullable: true},
+			},
+		}))
+		for j := 0; j < rows; j++ {
+			assert.NoError(t, s.Insert(name, map[string]interface{}{"id": j, "name": fmt.Sprintf("row%d", j)}))
+		}
+	}
+}
+
+// tableContents returns every row of every table as sorted strings
+func tableContents(t *testing.T, s *BTreeStorage) []string {
+	names, err := s.ShowTables()
+	assert.NoError(t, err)
+	var contents []string
+	for _, name := range names {
+		rows, err := s.Select(name, []string{"*"}, nil)
+		assert.NoError(t, err)
+		for _, row := range rows {
+			contents = append(contents, fmt.Sprintf("%s %v %v", name, row["id"], row["name"]))
+		}
+	}
+	sort.Strings(contents)
+	return contents
+}
+
+func TestBTreePageCache(t *testing.T) {
+	// 16KB pages hold each table's rows on its first page
+	dir := t.TempDir()
+	plain, err := NewBTreeStorageWithPageSize(filepath.Join(dir, "plain.db"), 16384)
+	assert.NoError(t, err)
+	cachedPath := filepath.Join(dir, "cached.db")
+	cached, err := NewBTreeStorageWithPageSize(cachedPath, 16384)
+	assert.NoError(t, err)
+	// Far fewer pages than the tables use, so pages are evicted while dirty
+	assert.NoError(t, cached.SetPageCacheSize(2))
+
+	for _, s := range []*BTreeStorage{plain, cached} {
+		fillTables(t, s, 6, 8)
+		assert.Equal(t, 1, rowsAffected(t)(s.Update("table_2", map[string]interface{}{"name": "updated"}, types.WhereAll(map[string]interface{}{"id": float64(3)}))))
+		assert.Equal(t, 4, rowsAffected(t)(s.Delete("table_4", types.WhereAll(map[string]interface{}{"id": types.Comparison{Operator: "<", Value: float64(4)}}))))
+		assert.NoError(t, s.DropTable("table_5"))
+	}
+	want := tableContents(t, plain)
+	assert.Len(t, want, 5*8-4)
+	assert.Equal(t, want, tableContents(t, cached))
+	assert.LessOrEqual(t, cached.pages.len(), 2)
+
+	// Writes were not synced one by one, and the cache served reads
+	stats := cached.PageCacheStats()
+	assert.Less(t, stats.Syncs, plain.PageCacheStats().Syncs/10)
+	assert.Greater(t, stats.Hits, int64(0))
+
+	// Close flushes the dirty pages
+	assert.NoError(t, plain.Close())
+	assert.NoError(t, cached.Close())
+	reopened, err := NewBTreeStorage(cachedPath)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, want, tableContents(t, reopened))
+
+	// Disabling the cache flushes it and writes through again
+	assert.NoError(t, reopened.SetPageCacheSize(16))
+	assert.NoError(t, reopened.Insert("table_0", map[string]interface{}{"id": 8, "name": "row8"}))
+	assert.NoError(t, reopened.SetPageCacheSize(0))
+	assert.Equal(t, 0, reopened.pages.len())
+	syncs := reopened.PageCacheStats().Syncs
+	assert.NoError(t, reopened.Insert("table_0", map[string]interface{}{"id": 9, "name": "row9"}))
+	assert.Equal(t, syncs+1, reopened.PageCacheStats().Syncs)
+	rows, err := reopened.Select("table_0", []string{"id"}, types.WhereAll(map[string]interface{}{"id": types.Comparison{Operator: ">=", Value: float64(8)}}))
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+}
+
+func BenchmarkBTreeInsertPageCache(b *testing.B) {
+	for _, pages := range []int{0, 256} {
+		b.Run(fmt.Sprintf("pages=%d", pages), func(b *testing.B) {
+			var stats PageCacheStats
+			for i := 0; i < b.N; i++ {
+				s, err := NewBTreeStorageWithPageSize(filepath.Join(b.TempDir(), "bench.db"), 16384)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := s.SetPageCacheSize(pages); err != nil {
+					b.Fatal(err)
+				}
+				fillTables(b, s, 20, 8)
+				for j := 0; j < 20; j++ {
+					if _, err := s.Select(fmt.Sprintf("table_%d", j), []string{"*"}, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := s.Close(); err != nil {
+					b.Fatal(err)
+				}
+				got := s.PageCacheStats()
+				stats.Reads += got.Reads
+				stats.Writes += got.Writes
+				stats.Syncs += got.Syncs
+			}
+			n := float64(b.N)
+			b.ReportMetric(float64(stats.Reads)/n, "preads/op")
+			b.ReportMetric(float64(stats.Writes)/n, "pwrites/op")
+			b.ReportMetric(float64(stats.Syncs)/n, "fsyncs/op")
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// AttachParquet implements types.ParquetAttacher. The file is read in
+// place on every SELECT, so it must stay where it is; the table lasts
+// until it is detached or the storage is closed.
+func (s *ParquetStorage) AttachParquet(tableName, path string) (*types.Table, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("cannot attach Parquet file: %w", err)
+	}
+	table, err := inferParquetTable(tableName, path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.tables[tableName]; exists {
+		return nil, fmt.Errorf("table %s already exists", tableName)
+	}
+	s.tables[tableName] = table
+	s.attached[tableName] = path
+	return table, nil
+}
+
+// DetachParquet implements types.ParquetAttacher
+func (s *ParquetStorage) DetachParquet(tableName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.attached[tableName]; !ok {
+		return fmt.Errorf("table %s is not an attached Parquet file", tableName)
+	}
+	delete(s.attached, tableName)
+	delete(s.tables, tableName)
+	return nil
+}
+
+// IsAttached reports whether a table was attached with AttachParquet
+func (s *ParquetStorage) IsAttached(tableName string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.attached[tableName]
+	return ok
+}
+
+// attachedTables returns the names of the attached tables
+func (s *ParquetStorage) attachedTables() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tables := make([]string, 0, len(s.attached))
+	for name := range s.attached {
+		tables = append(tables, name)
+	}
+	return tables
+}
+
+// openParquetColumns opens a Parquet file for reading by column, with the
+// file's own schema
+func openParquetColumns(path string) (*reader.ParquetReader, func(), error) {
+	fr, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open Parquet file: %w", err)
+	}
+	pr, err := reader.NewParquetColumnReader(fr, 4)
+	if err != nil {
+		fr.Close()
+		return nil, nil, fmt.Errorf("failed to read Parquet file %s: %w", path, err)
+	}
+	return pr, func() {
+		pr.ReadStop()
+		fr.Close()
+	}, nil
+}
+
+// inferParquetTable returns the table whose columns are the columns of a
+// Parquet file
+func inferParquetTable(tableName, path string) (*types.Table, error) {
+	pr, closeFile, err := openParquetColumns(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile()
+	return parquetTable(tableName, pr)
+}
+
+// parquetTable maps the schema of an open Parquet file to a table. Only
+// flat schemas are supported: integers become INT, except TIMESTAMP_MILLIS
+// ones which become TIMESTAMP, strings and other byte arrays STRING,
+// floating point numbers FLOAT and booleans BOOLEAN. Optional columns are
+// nullable.
+func parquetTable(tableName string, pr *reader.ParquetReader) (*types.Table, error) {
+	elements := pr.SchemaHandler.SchemaElements
+	if len(elements) < 2 {
+		return nil, fmt.Errorf("Parquet file has no columns")
+	}
+
+	table := &types.Table{Name: tableName}
+	for i, el := range elements[1:] {
+		name := pr.SchemaHandler.Infos[i+1].ExName
+		if el.GetNumChildren() > 0 || !el.IsSetType() {
+			return nil, fmt.Errorf("column %s is nested; only flat Parquet schemas can be attached", name)
+		}
+		if el.GetRepetitionType() == parquet.FieldRepetitionType_REPEATED {
+			return nil, fmt.Errorf("column %s is repeated; only flat Parquet schemas can be attached", name)
+		}
+		if el.IsSetConvertedType() && el.GetConvertedType() == parquet.ConvertedType_DECIMAL {
+			return nil, fmt.Errorf("column %s is a DECIMAL, which cannot be attached", name)
+		}
+
+		var colType string
+		switch el.GetType() {
+		case parquet.Type_INT32, parquet.Type_INT64:
+			colType = "INT"
+			if el.IsSetConvertedType() && el.GetConvertedType() == parquet.ConvertedType_TIMESTAMP_MILLIS {
+				colType = "TIMESTAMP"
+			}
+		case parquet.Type_BYTE_ARRAY, parquet.Type_FIXED_LEN_BYTE_ARRAY:
+			colType = "STRING"
+		case parquet.Type_FLOAT, parquet.Type_DOUBLE:
+			colType = "FLOAT"
+		case parquet.Type_BOOLEAN:
+			colType = "BOOLEAN"
+		default:
+			return nil, fmt.Errorf("column %s has Parquet type %s, which cannot be attached", name, el.GetType())
+		}
+		table.Columns = append(table.Columns, types.ColumnDefinition{
+			Name:     name,
+			Type:     colType,
+			Nullable: el.GetRepetitionType() != parquet.FieldRepetitionType_REQUIRED,
+		})
+	}
+	return table, nil
+}
+
+// readAttachedParquet reads the given columns of the rows of an attached
+// Parquet file, skipping the row groups where rules out. The file must
+// still have the schema it was attached with.
+func (s *ParquetStorage) readAttachedParquet(path string, table *types.Table, columns []types.ColumnDefinition, where *types.WhereExpr) ([]types.Row, error) {
+	pr, closeFile, err := openParquetColumns(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile()
+
+	current, err := parquetTable(table.Name, pr)
+	if err != nil {
+		return nil, err
+	}
+	if len(current.Columns) != len(table.Columns) {
+		return nil, fmt.Errorf("Parquet file %s changed since it was attached; detach and attach it again", path)
+	}
+	for i, col := range current.Columns {
+		if col != table.Columns[i] {
+			return nil, fmt.Errorf("Parquet file %s changed since it was attached; detach and attach it again", path)
+		}
+	}
+
+	field := func(column string) string { return column }
+	return s.readRowGroups(pr, table, columns, field, where)
+}
+
+// AttachParquet implements types.ParquetAttacher on the OLAP storage. The
+// name must not be taken by a table of the OLTP storage either.
+func (s *HybridStorage) AttachParquet(tableName, path string) (*types.Table, error) {
+	attacher, ok := s.olap.(types.ParquetAttacher)
+	if !ok {
+		return nil, types.Unsupported("ATTACH PARQUET")
+	}
+	if s.oltp.GetTable(tableName) != nil {
+		return nil, fmt.Errorf("table %s already exists", tableName)
+	}
+	return attacher.AttachParquet(tableName, path)
+}
+
+// DetachParquet implements types.ParquetAttacher on the OLAP storage
+func (s *HybridStorage) DetachParquet(tableName string) error {
+	attacher, ok := s.olap.(types.ParquetAttacher)
+	if !ok {
+		return types.Unsupported("DETACH")
+	}
+	return attacher.DetachParquet(tableName)
+}
+
+// isAttached reports whether a table is an attached Parquet file of the
+// OLAP storage
+func (s *HybridStorage) isAttached(tableName string) bool {
+	parquetStorage, ok := s.olap.(*ParquetStorage)
+	return ok && parquetStorage.IsAttached(tableName)
+}
+
+// checkWritable returns an error for a write to an attached Parquet file
+func (s *HybridStorage) checkWritable(tableName string) error {
+	if s.isAttached(tableName) {
+		return fmt.Errorf("table %s is an attached Parquet file and is read-only", tableName)
+	}
+	return nil
+}
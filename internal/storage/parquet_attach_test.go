@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+type parquetEvent struct {
+	ID    int64   `parquet:"name=id, type=INT64"`
+	Kind  string  `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Score float64 `parquet:"name=score, type=DOUBLE"`
+	Note  *string `parquet:"name=note, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// writeEventsParquet writes events to a Parquet file with their own
+// columnar schema, as other tools would
+func writeEventsParquet(t *testing.T, path string, events []parquetEvent) {
+	t.Helper()
+	fw, err := local.NewLocalFileWriter(path)
+	assert.NoError(t, err)
+	pw, err := writer.NewParquetWriter(fw, new(parquetEvent), 1)
+	assert.NoError(t, err)
+	for i := range events {
+		assert.NoError(t, pw.Write(events[i]))
+	}
+	assert.NoError(t, pw.WriteStop())
+	assert.NoError(t, fw.Close())
+}
+
+func testEvents() []parquetEvent {
+	note := "retried"
+	return []parquetEvent{
+		{ID: 1, Kind: "click", Score: 0.5},
+		{ID: 2, Kind: "view", Score: 1.25, Note: &note},
+		{ID: 3, Kind: "click", Score: 2},
+	}
+}
+
+func TestAttachParquet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.parquet")
+	writeEventsParquet(t, path, testEvents())
+
+	olap, err := NewParquetStorage(filepath.Join(dir, "olap"))
+	assert.NoError(t, err)
+	s := &HybridStorage{oltp: NewInMemoryStorage(), olap: olap, history: newRoutingHistory(10)}
+	defer s.Close()
+	assert.True(t, s.Capabilities().SupportsAttachParquet)
+
+	table, err := s.AttachParquet("events", path)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.ColumnDefinition{
+		{Name: "id", Type: "INT"},
+		{Name: "kind", Type: "STRING"},
+		{Name: "score", Type: "FLOAT"},
+		{Name: "note", Type: "STRING", Nullable: true},
+	}, table.Columns)
+	assert.Equal(t, table, s.GetTable("events"))
+	tables, err := s.ShowTables()
+	assert.NoError(t, err)
+	assert.Contains(t, tables, "events")
+
+	// A key lookup would go to OLTP, but only OLAP has the table
+	rows, err := s.Select("events", []string{"kind", "note"}, types.WhereAll(map[string]interface{}{"id": 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"kind": "view", "note": "retried"}}, rows)
+	history := s.RoutingHistory()
+	assert.Equal(t, "parquet", history[len(history)-1].Engine)
+	assert.Equal(t, "attached Parquet file", history[len(history)-1].Reason)
+
+	rows, err = s.Select("events", []string{"*"}, types.WhereAll(map[string]interface{}{"kind": "click"}))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "kind": "click", "score": 0.5, "note": nil},
+		{"id": int64(3), "kind": "click", "score": 2.0, "note": nil},
+	}, rows)
+	rows, err = s.Select("events", []string{"COUNT(*)"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"count": 3}}, rows)
+
+	// The table is read-only and its name is taken
+	assert.EqualError(t, s.Insert("events", map[string]interface{}{"id": 4}), "table events is an attached Parquet file and is read-only")
+	_, err = s.Delete("events", nil)
+	assert.EqualError(t, err, "table events is an attached Parquet file and is read-only")
+	assert.EqualError(t, s.CreateTable(&types.Table{Name: "events"}), "table events already exists")
+	assert.EqualError(t, s.DropTable("events"), "table events is an attached Parquet file; use DETACH to remove it")
+	_, err = s.AttachParquet("events", path)
+	assert.EqualError(t, err, "table events already exists")
+
+	assert.NoError(t, s.CreateTable(itemsTable()))
+	_, err = s.AttachParquet("items", path)
+	assert.EqualError(t, err, "table items already exists")
+	_, err = s.AttachParquet("missing", filepath.Join(dir, "missing.parquet"))
+	assert.Error(t, err)
+
+	// DETACH forgets the table but keeps the file
+	assert.NoError(t, s.DetachParquet("events"))
+	assert.Nil(t, s.GetTable("events"))
+	_, err = s.Select("events", []string{"*"}, nil)
+	assert.Error(t, err)
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.EqualError(t, s.DetachParquet("events"), "table events is not an attached Parquet file")
+	assert.EqualError(t, s.DetachParquet("items"), "table items is not an attached Parquet file")
+}
+
+func TestAttachParquetRejectsNestedSchema(t *testing.T) {
+	type tagged struct {
+		ID   int32   `parquet:"name=id, type=INT32"`
+		Tags []int32 `parquet:"name=tags, type=LIST, valuetype=INT32"`
+	}
+	path := filepath.Join(t.TempDir(), "tagged.parquet")
+	fw, err := local.NewLocalFileWriter(path)
+	assert.NoError(t, err)
+	pw, err := writer.NewParquetWriter(fw, new(tagged), 1)
+	assert.NoError(t, err)
+	assert.NoError(t, pw.Write(tagged{ID: 1, Tags: []int32{1, 2}}))
+	assert.NoError(t, pw.WriteStop())
+	assert.NoError(t, fw.Close())
+
+	s, err := NewParquetStorage(t.TempDir())
+	assert.NoError(t, err)
+	_, err = s.AttachParquet("tagged", path)
+	assert.EqualError(t, err, "column tags is nested; only flat Parquet schemas can be attached")
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// parquetColumns reads rows from an open Parquet file a column at a time,
+// decoding only the columns it was made for
+type parquetColumns struct {
+	pr      *reader.ParquetReader
+	columns []types.ColumnDefinition
+	paths   []string // path of each column in the file, "" if it has none
+}
+
+// newParquetColumns prepares to read columns from pr. field returns the
+// name of a column's field in the file; columns the file does not have
+// read as NULL.
+func newParquetColumns(pr *reader.ParquetReader, columns []types.ColumnDefinition, field func(column string) string) *parquetColumns {
+	byField := make(map[string]string)
+	for i := 1; i < len(pr.SchemaHandler.Infos); i++ {
+		byField[pr.SchemaHandler.Infos[i].ExName] = pr.SchemaHandler.IndexMap[int32(i)]
+	}
+	paths := make([]string, len(columns))
+	for i, col := range columns {
+		paths[i] = byField[field(col.Name)]
+	}
+	return &parquetColumns{pr: pr, columns: columns, paths: paths}
+}
+
+// read decodes the next n rows. A row holds every column read, NULL ones
+// included.
+func (c *parquetColumns) read(n int64) ([]types.Row, error) {
+	rows := make([]types.Row, n)
+	for i := range rows {
+		rows[i] = make(types.Row, len(c.columns))
+	}
+	for i, col := range c.columns {
+		if c.paths[i] == "" {
+			for _, row := range rows {
+				row[col.Name] = nil
+			}
+			continue
+		}
+		values, _, _, err := c.pr.ReadColumnByPath(c.paths[i], n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read column %s: %w", col.Name, err)
+		}
+		if int64(len(values)) != n {
+			return nil, fmt.Errorf("column %s has %d values for %d rows", col.Name, len(values), n)
+		}
+		for j, value := range values {
+			rows[j][col.Name] = parquetValue(col, value)
+		}
+	}
+	return rows, nil
+}
+
+// skip moves past the next n rows without decoding them
+func (c *parquetColumns) skip(n int64) error {
+	for i, col := range c.columns {
+		if c.paths[i] == "" {
+			continue
+		}
+		if err := c.pr.SkipRowsByPath(c.paths[i], n); err != nil {
+			return fmt.Errorf("failed to skip column %s: %w", col.Name, err)
+		}
+	}
+	return nil
+}
+
+// pruneRowGroups drops from the footer of pr the row groups whose min/max
+// statistics show that no row matches where, so that their pages are never
+// read; it must run before any column is. It returns the number of row
+// groups and rows left. Only equality and ordering conditions at the top
+// level of where prune row groups.
+func pruneRowGroups(pr *reader.ParquetReader, table *types.Table, field func(column string) string, where *types.WhereExpr) (int, int64) {
+	// Chunks name their column by its path in the schema
+	chunkColumns := make(map[string]types.ColumnDefinition)
+	chunkTypes := make(map[string]parquet.Type)
+	for _, col := range table.Columns {
+		for i := 1; i < len(pr.SchemaHandler.Infos); i++ {
+			if pr.SchemaHandler.Infos[i].ExName == field(col.Name) {
+				name := pr.SchemaHandler.Infos[i].InName
+				chunkColumns[name] = col
+				chunkTypes[name] = pr.SchemaHandler.SchemaElements[i].GetType()
+			}
+		}
+	}
+
+	var kept []*parquet.RowGroup
+	var rows int64
+	for _, group := range pr.Footer.RowGroups {
+		if rowGroupMatches(group, chunkColumns, chunkTypes, where) {
+			kept = append(kept, group)
+			rows += group.NumRows
+		}
+	}
+	pr.Footer.RowGroups = kept
+	return len(kept), rows
+}
+
+// rowGroupMatches reports whether a row group may hold a row matching
+// where, judging by the statistics of its column chunks
+func rowGroupMatches(group *parquet.RowGroup, columns map[string]types.ColumnDefinition, columnTypes map[string]parquet.Type, where *types.WhereExpr) bool {
+	for _, chunk := range group.Columns {
+		meta := chunk.MetaData
+		if meta == nil || len(meta.PathInSchema) != 1 {
+			continue
+		}
+		name := meta.PathInSchema[0]
+		col, ok := columns[name]
+		stats := meta.Statistics
+		if !ok || stats == nil || stats.MinValue == nil || stats.MaxValue == nil {
+			continue
+		}
+		min, minOK := statValue(col, columnTypes[name], stats.MinValue)
+		max, maxOK := statValue(col, columnTypes[name], stats.MaxValue)
+		if !minOK || !maxOK {
+			continue
+		}
+		for _, cond := range where.Conjuncts() {
+			if cond.Row == nil && cond.Column == col.Name && !rangeMatches(min, max, cond.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// rangeMatches reports whether a value between min and max may satisfy a
+// WHERE condition. Conditions it cannot judge, or values that cannot be
+// ordered against the bounds, may be satisfied.
+func rangeMatches(min, max, cond interface{}) bool {
+	op, value := "=", cond
+	if c, ok := cond.(types.Comparison); ok {
+		op, value = c.Operator, c.Value
+	}
+	if value == nil {
+		return true
+	}
+	low, lowOK := types.CompareValues(value, min)
+	high, highOK := types.CompareValues(value, max)
+	if !lowOK || !highOK {
+		return true
+	}
+	switch op {
+	case "=":
+		return low >= 0 && high <= 0
+	case ">":
+		return high < 0
+	case ">=":
+		return high <= 0
+	case "<":
+		return low > 0
+	case "<=":
+		return low >= 0
+	}
+	return true
+}
+
+// statValue decodes a min or max statistic of a column chunk, plain
+// encoded, to the type rows hold the column's values in
+func statValue(col types.ColumnDefinition, t parquet.Type, data []byte) (interface{}, bool) {
+	switch t {
+	case parquet.Type_INT32:
+		if len(data) == 4 {
+			return parquetValue(col, int32(binary.LittleEndian.Uint32(data))), true
+		}
+	case parquet.Type_INT64:
+		if len(data) == 8 {
+			return parquetValue(col, int64(binary.LittleEndian.Uint64(data))), true
+		}
+	case parquet.Type_FLOAT:
+		if len(data) == 4 {
+			return parquetValue(col, math.Float32frombits(binary.LittleEndian.Uint32(data))), true
+		}
+	case parquet.Type_DOUBLE:
+		if len(data) == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(data)), true
+		}
+	case parquet.Type_BYTE_ARRAY:
+		return string(data), true
+	}
+	return nil, false
+}
+
+// selectedColumns returns the columns of table a SELECT has to read: the
+// columns it returns and those its WHERE clause tests. COUNT(*) returns no
+// column. Every column is read for * or no columns, or for a column table
+// does not have.
+func selectedColumns(table *types.Table, columns []string, where *types.WhereExpr) []types.ColumnDefinition {
+	if len(columns) == 0 {
+		return table.Columns
+	}
+	wanted := make(map[string]bool)
+	for _, col := range columns {
+		if col == "COUNT(*)" {
+			continue
+		}
+		if col == "*" || columnIndex(table, col) < 0 {
+			return table.Columns
+		}
+		wanted[col] = true
+	}
+	for _, col := range types.WhereColumns(where) {
+		wanted[col] = true
+	}
+
+	var selected []types.ColumnDefinition
+	for _, col := range table.Columns {
+		if wanted[col.Name] {
+			selected = append(selected, col)
+		}
+	}
+	return selected
+}
+
+// parquetCell converts a value of a column to the Go type of its Parquet
+// column (see parquetSchemaForTable). TIMESTAMPs are written as
+// milliseconds since the epoch.
+func parquetCell(col types.ColumnDefinition, value interface{}) (interface{}, error) {
+	value, err := types.CanonicalValue(col.Type, value)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	switch col.Type {
+	case "INT":
+		if v, ok := value.(int64); ok {
+			return v, nil
+		}
+	case "FLOAT":
+		if v, ok := value.(float64); ok {
+			return v, nil
+		}
+	case "BOOLEAN":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case "TIMESTAMP":
+		t, err := types.ParseTime(col.Type, value)
+		if err != nil {
+			return nil, err
+		}
+		return t.UnixMilli(), nil
+	default:
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("value %v of column %s is not a %s", value, col.Name, col.Type)
+}
+
+// parquetValue converts a value read from a Parquet column to the type
+// rows of other tables use for it
+func parquetValue(col types.ColumnDefinition, value interface{}) interface{} {
+	switch v := value.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		if col.Type == "TIMESTAMP" {
+			return time.UnixMilli(v).UTC().Format(types.TimestampLayout)
+		}
+	case float32:
+		return float64(v)
+	}
+	return value
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestParquetTypedColumns(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "typed.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	parquet.SetBTreeSource(btree)
+
+	table := &types.Table{
+		Name: "products",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "Name", Type: "STRING"},
+			{Name: "price", Type: "FLOAT"},
+			{Name: "active", Type: "BOOLEAN"},
+			{Name: "added", Type: "TIMESTAMP"},
+			{Name: "note", Type: "STRING", Nullable: true},
+		},
+	}
+	assert.NoError(t, btree.CreateTable(table))
+	assert.NoError(t, btree.Insert("products", map[string]interface{}{
+		"id": 1, "Name": "lamp", "price": 9.5, "active": true, "added": "2024-05-01 10:00:00", "note": "boxed",
+	}))
+	assert.NoError(t, btree.Insert("products", map[string]interface{}{
+		"id": 2, "Name": "desk", "price": 120, "active": false, "added": "2024-05-02 12:30:00",
+	}))
+	_, err = parquet.SyncFromBTree()
+	assert.NoError(t, err)
+
+	// Each column is a Parquet column of its own type
+	pr, closeFile, err := openParquetColumns(filepath.Join(dir, "products.parquet"))
+	assert.NoError(t, err)
+	fileTable, err := parquetTable("products", pr)
+	closeFile()
+	assert.NoError(t, err)
+	assert.Equal(t, []types.ColumnDefinition{
+		{Name: "id", Type: "INT", Nullable: true},
+		{Name: "name", Type: "STRING", Nullable: true},
+		{Name: "price", Type: "FLOAT", Nullable: true},
+		{Name: "active", Type: "BOOLEAN", Nullable: true},
+		{Name: "added", Type: "TIMESTAMP", Nullable: true},
+		{Name: "note", Type: "STRING", Nullable: true},
+	}, fileTable.Columns)
+
+	// Single columns read back in their canonical types
+	rows, err := parquet.Select("products", []string{"price"}, types.WhereAll(map[string]interface{}{"active": true}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"price": 9.5}}, rows)
+
+	rows, err = parquet.Select("products", []string{"Name", "added"}, types.WhereAll(map[string]interface{}{"id": 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"Name": "desk", "added": "2024-05-02T12:30:00Z"}}, rows)
+
+	rows, err = parquet.Select("products", []string{"*"}, types.WhereAll(map[string]interface{}{"id": 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{
+		"id": int64(2), "Name": "desk", "price": float64(120), "active": false, "added": "2024-05-02T12:30:00Z", "note": nil,
+	}}, rows)
+
+	// Only the columns a query returns or tests are decoded
+	read := selectedColumns(table, []string{"price"}, types.WhereAll(map[string]interface{}{"active": true}))
+	assert.Equal(t, []types.ColumnDefinition{table.Columns[2], table.Columns[3]}, read)
+	rows, err = parquet.readSyncedRows(table, read[:1], nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{{"price": 9.5}, {"price": float64(120)}}, rows)
+
+	rows, err = parquet.Select("products", []string{"COUNT(*)"}, types.WhereAll(map[string]interface{}{"active": false}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"count": 1}}, rows)
+}
+
+func TestParquetRowGroupPruning(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "groups.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	parquet.SetBTreeSource(btree)
+	parquet.rowGroupRows = 10
+
+	assert.NoError(t, btree.CreateTable(&types.Table{
+		Name: "events",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "kind", Type: "STRING"},
+		},
+	}))
+	rows := make([]map[string]interface{}, 40)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": i + 1, "kind": fmt.Sprintf("k%02d", i+1)}
+	}
+	assert.NoError(t, btree.InsertRows("events", rows))
+	_, err = parquet.SyncFromBTree()
+	assert.NoError(t, err)
+
+	pr, closeFile, err := openParquetColumns(filepath.Join(dir, "events.parquet"))
+	assert.NoError(t, err)
+	assert.Len(t, pr.Footer.RowGroups, 4)
+	closeFile()
+
+	// selectGroups runs a SELECT and returns its rows and the row groups
+	// it read
+	selectGroups := func(where *types.WhereExpr) ([]types.Row, int64) {
+		before := parquet.RowGroupsRead()
+		rows, err := parquet.Select("events", []string{"id"}, where)
+		assert.NoError(t, err)
+		return rows, parquet.RowGroupsRead() - before
+	}
+
+	found, groups := selectGroups(types.WhereAll(map[string]interface{}{"id": 25}))
+	assert.Equal(t, []types.Row{{"id": int64(25)}}, found)
+	assert.Equal(t, int64(1), groups)
+
+	found, groups = selectGroups(types.WhereAll(map[string]interface{}{"kind": "k07"}))
+	assert.Equal(t, []types.Row{{"id": int64(7)}}, found)
+	assert.Equal(t, int64(1), groups)
+
+	found, groups = selectGroups(types.WhereAll(map[string]interface{}{"id": types.Comparison{Operator: ">", Value: int64(35)}}))
+	assert.Len(t, found, 5)
+	assert.Equal(t, int64(1), groups)
+
+	found, groups = selectGroups(types.WhereAll(map[string]interface{}{"id": 99}))
+	assert.Empty(t, found)
+	assert.Equal(t, int64(0), groups)
+
+	// Conditions statistics cannot rule out read every row group
+	found, groups = selectGroups(types.WhereAll(map[string]interface{}{"kind": types.Comparison{Operator: "LIKE", Value: "k1%"}}))
+	assert.Len(t, found, 10)
+	assert.Equal(t, int64(4), groups)
+
+	found, groups = selectGroups(nil)
+	assert.Len(t, found, 40)
+	assert.Equal(t, int64(4), groups)
+}
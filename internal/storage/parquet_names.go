@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// parquetColumnNamesKey is the file key-value metadata entry that maps
+// Parquet field names back to the original SQL column names
+const parquetColumnNamesKey = "ulindb.column_names"
+
+// parquetNameMap is a reversible mapping between SQL column names and the
+// sanitized field names used inside Parquet files. SQL column names may
+// contain uppercase letters, spaces or leading digits; Parquet field names
+// are restricted to lowercase [a-z0-9_] so they are legal in any schema.
+type parquetNameMap struct {
+	toField  map[string]string // SQL column name -> Parquet field name
+	toColumn map[string]string // Parquet field name -> SQL column name
+}
+
+func newParquetNameMap() *parquetNameMap {
+	return &parquetNameMap{
+		toField:  make(map[string]string),
+		toColumn: make(map[string]string),
+	}
+}
+
+// sanitizeParquetName converts a SQL column name into a legal Parquet field name
+func sanitizeParquetName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	field := b.String()
+	if field == "" || (field[0] >= '0' && field[0] <= '9') {
+		field = "_" + field
+	}
+	return field
+}
+
+// add registers a SQL column and returns its Parquet field name. When a
+// previous mapping is given, a column keeps the field it had before; this
+// includes columns renamed only by case, so a rename from "UserID" to
+// "UserId" is reconciled onto the existing field instead of a new one.
+func (m *parquetNameMap) add(column string, previous *parquetNameMap) string {
+	if field, ok := m.toField[column]; ok {
+		return field
+	}
+
+	field := ""
+	if previous != nil {
+		if f, ok := previous.toField[column]; ok {
+			field = f
+		} else if renamed := previous.caseRename(column); renamed != "" {
+			field = previous.toField[renamed]
+		}
+	}
+	if _, taken := m.toColumn[field]; field == "" || taken {
+		field = sanitizeParquetName(column)
+		for i := 2; ; i++ {
+			if _, taken := m.toColumn[field]; !taken {
+				break
+			}
+			field = fmt.Sprintf("%s_%d", sanitizeParquetName(column), i)
+		}
+	}
+
+	m.toField[column] = field
+	m.toColumn[field] = column
+	return field
+}
+
+// caseRename returns the column in m that differs from column only by case,
+// or "" if there is none
+func (m *parquetNameMap) caseRename(column string) string {
+	for existing := range m.toField {
+		if existing != column && strings.EqualFold(existing, column) {
+			return existing
+		}
+	}
+	return ""
+}
+
+// toParquet rewrites a row's keys from SQL column names to Parquet field names
+func (m *parquetNameMap) toParquet(row types.Row, previous *parquetNameMap) types.Row {
+	result := make(types.Row, len(row))
+	for col, val := range row {
+		result[m.add(col, previous)] = val
+	}
+	return result
+}
+
+// toSQL rewrites a row's keys from Parquet field names back to SQL column
+// names. A nil map leaves the row unchanged, which keeps files written
+// before the mapping existed readable.
+func (m *parquetNameMap) toSQL(row types.Row) types.Row {
+	if m == nil {
+		return row
+	}
+	result := make(types.Row, len(row))
+	for field, val := range row {
+		if col, ok := m.toColumn[field]; ok {
+			result[col] = val
+		} else {
+			result[field] = val
+		}
+	}
+	return result
+}
+
+// keyValue encodes the mapping as Parquet file metadata
+func (m *parquetNameMap) keyValue() (*parquet.KeyValue, error) {
+	data, err := json.Marshal(m.toColumn)
+	if err != nil {
+		return nil, err
+	}
+	value := string(data)
+	return &parquet.KeyValue{Key: parquetColumnNamesKey, Value: &value}, nil
+}
+
+// parquetNameMapFromFooter decodes the mapping stored in a file footer. It
+// returns nil if the file has no mapping.
+func parquetNameMapFromFooter(footer *parquet.FileMetaData) (*parquetNameMap, error) {
+	if footer == nil {
+		return nil, nil
+	}
+	for _, kv := range footer.KeyValueMetadata {
+		if kv.Key != parquetColumnNamesKey || kv.Value == nil {
+			continue
+		}
+		m := newParquetNameMap()
+		if err := json.Unmarshal([]byte(*kv.Value), &m.toColumn); err != nil {
+			return nil, fmt.Errorf("invalid %s metadata: %w", parquetColumnNamesKey, err)
+		}
+		for field, col := range m.toColumn {
+			m.toField[col] = field
+		}
+		return m, nil
+	}
+	return nil, nil
+}
+
+// readParquetNameMap loads the mapping from an existing Parquet file. A
+// missing or unreadable file yields a nil mapping.
+func readParquetNameMap(filePath string) *parquetNameMap {
+	pr, closeFile, err := openParquetColumns(filePath)
+	if err != nil {
+		return nil
+	}
+	defer closeFile()
+
+	m, err := parquetNameMapFromFooter(pr.Footer)
+	if err != nil {
+		return nil
+	}
+	return m
+}
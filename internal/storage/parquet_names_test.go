@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestSanitizeParquetName(t *testing.T) {
+	tests := map[string]string{
+		"UserID":     "userid",
+		"order_2024": "order_2024",
+		"first name": "first_name",
+		"2024_total": "_2024_total",
+		"":           "_",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, sanitizeParquetName(in), "sanitize %q", in)
+	}
+}
+
+func TestParquetNameMapCollisions(t *testing.T) {
+	m := newParquetNameMap()
+	assert.Equal(t, "first_name", m.add("first name", nil))
+	assert.Equal(t, "first_name_2", m.add("first_name", nil))
+	assert.Equal(t, "first_name", m.add("first name", nil))
+
+	row := m.toSQL(map[string]interface{}{"first_name": "a", "first_name_2": "b"})
+	assert.Equal(t, "a", row["first name"])
+	assert.Equal(t, "b", row["first_name"])
+}
+
+func TestParquetNameMapCaseOnlyRename(t *testing.T) {
+	previous := newParquetNameMap()
+	previous.add("first name", nil)
+	previous.add("first_name", nil) // first_name_2
+	previous.add("UserID", nil)
+
+	// Renaming "first_name" to "First_Name" keeps its field rather than
+	// colliding with or replacing "first name"
+	current := newParquetNameMap()
+	assert.Equal(t, "first_name_2", current.add("First_Name", previous))
+	assert.Equal(t, "first_name", current.add("first name", previous))
+	assert.Equal(t, "userid", current.add("UserId", previous))
+
+	// Round trip through file metadata
+	kv, err := current.keyValue()
+	assert.NoError(t, err)
+	footer := &parquet.FileMetaData{KeyValueMetadata: []*parquet.KeyValue{kv}}
+	decoded, err := parquetNameMapFromFooter(footer)
+	assert.NoError(t, err)
+	assert.Equal(t, current.toField, decoded.toField)
+
+	// Files written before the mapping existed are read unchanged
+	legacy, err := parquetNameMapFromFooter(&parquet.FileMetaData{})
+	assert.NoError(t, err)
+	assert.Nil(t, legacy)
+	assert.Equal(t, "x", legacy.toSQL(map[string]interface{}{"UserID": "x"})["UserID"])
+}
+
+func TestParquetSchemaForTable(t *testing.T) {
+	table := &types.Table{
+		Name: "readings",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "label", Type: "STRING"},
+			{Name: "value", Type: "FLOAT"},
+			{Name: "valid", Type: "BOOLEAN"},
+			{Name: "taken", Type: "TIMESTAMP"},
+		},
+	}
+	assert.Equal(t, []string{
+		"name=id, type=INT64, repetitiontype=OPTIONAL",
+		"name=label, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL",
+		"name=value, type=DOUBLE, repetitiontype=OPTIONAL",
+		"name=valid, type=BOOLEAN, repetitiontype=OPTIONAL",
+		"name=taken, type=INT64, convertedtype=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL",
+	}, parquetSchemaForTable(table, newParquetNameMap()))
+}
@@ -1,13 +1,10 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 
-	"github.com/xitongsys/parquet-go-source/local"
-	"github.com/xitongsys/parquet-go/reader"
 	"github.com/zakazai/ulin-db/internal/types"
 )
 
@@ -23,7 +20,8 @@ func NewParquetReader(dataDir string) *ParquetReader {
 	}
 }
 
-// ReadTable reads all rows from a table's Parquet file
+// ReadTable reads all rows from a table's Parquet file. The reader does
+// not know the table, so its columns are taken from the file's schema.
 func (r *ParquetReader) ReadTable(tableName string) ([]types.Row, error) {
 	filePath := filepath.Join(r.dataDir, fmt.Sprintf("%s.parquet", tableName))
 
@@ -32,59 +30,43 @@ func (r *ParquetReader) ReadTable(tableName string) ([]types.Row, error) {
 		return []types.Row{}, nil
 	}
 
-	// Open file
-	fr, err := local.NewLocalFileReader(filePath)
+	pr, closeFile, err := openParquetColumns(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open Parquet file: %w", err)
+		return nil, err
 	}
-	defer fr.Close()
+	defer closeFile()
 
-	// Create Parquet reader
-	pr, err := reader.NewParquetReader(fr, new(ParquetRow), 4)
+	table, err := parquetTable(tableName, pr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Parquet reader: %w", err)
+		return nil, err
 	}
-	defer pr.ReadStop()
-
-	// Get row count
-	numRows := int(pr.GetNumRows())
-	if numRows == 0 {
-		return []types.Row{}, nil
+	names, err := parquetNameMapFromFooter(pr.Footer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read column names: %w", err)
 	}
 
-	// Read rows
-	parquetRows := make([]ParquetRow, numRows)
-	if err := pr.Read(&parquetRows); err != nil {
+	// The file's columns are its fields; rows are renamed to the SQL
+	// columns once read
+	field := func(column string) string { return column }
+	rows, err := newParquetColumns(pr, table.Columns, field).read(pr.GetNumRows())
+	if err != nil {
 		return nil, fmt.Errorf("failed to read Parquet rows: %w", err)
 	}
-
-	// Convert to types.Row
-	rows := make([]types.Row, 0, numRows)
-	for _, prow := range parquetRows {
-		if prow.TableName != tableName {
-			continue
-		}
-
-		var row types.Row
-		if err := json.Unmarshal([]byte(prow.DataJSON), &row); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal row data: %w", err)
-		}
-
-		rows = append(rows, row)
+	for i, row := range rows {
+		rows[i] = names.toSQL(row)
 	}
-
 	return rows, nil
 }
 
 // ApplyFilter filters rows based on WHERE conditions
-func (r *ParquetReader) ApplyFilter(rows []types.Row, where map[string]interface{}) []types.Row {
-	if where == nil || len(where) == 0 {
+func (r *ParquetReader) ApplyFilter(rows []types.Row, where *types.WhereExpr) []types.Row {
+	if where == nil {
 		return rows
 	}
 
 	filtered := make([]types.Row, 0, len(rows))
 	for _, row := range rows {
-		if matchesWhere(row, where) {
+		if where.Matches(row) {
 			filtered = append(filtered, row)
 		}
 	}
@@ -120,14 +102,3 @@ func (r *ParquetReader) ApplyProjection(rows []types.Row, columns []string) []ty
 
 	return projected
 }
-
-// matchesWhere checks if a row matches WHERE conditions
-func matchesWhere(row types.Row, where map[string]interface{}) bool {
-	for col, val := range where {
-		rowVal, ok := row[col]
-		if !ok || rowVal != val {
-			return false
-		}
-	}
-	return true
-}
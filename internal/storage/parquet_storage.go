@@ -1,12 +1,13 @@
 package storage
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xitongsys/parquet-go-source/local"
@@ -16,24 +17,41 @@ import (
 	"github.com/zakazai/ulin-db/internal/types"
 )
 
-// ParquetRow represents a row in Parquet format with dynamic columns
-type ParquetRow struct {
-	TableName string `parquet:"name=table_name, type=BYTE_ARRAY, convertedtype=UTF8"`
-	DataJSON  string `parquet:"name=data_json, type=BYTE_ARRAY, convertedtype=UTF8"`
-}
-
 // ParquetStorage implements Storage interface using Apache Parquet files
 type ParquetStorage struct {
-	baseDir      string
-	tables       map[string]*types.Table
-	mu           sync.RWMutex
-	btreeSource  *BTreeStorage
-	syncWorker   *time.Ticker
+	baseDir     string
+	tables      map[string]*types.Table
+	mu          sync.RWMutex
+	btreeSource *BTreeStorage
+	lastSync    time.Time
+
+	// workerMu guards the sync worker's interval and channels. syncRuns
+	// counts the syncs the worker started.
+	workerMu     sync.Mutex
 	syncInterval time.Duration
-	stopSync     chan struct{}
-	lastSync     time.Time
+	stopSync     chan struct{} // closed to stop the worker
+	workerDone   chan struct{} // closed once the worker has returned
+	syncRuns     int64
+
+	// syncMu serializes syncs, which the worker and FORCE_SYNC can start
+	// at the same time
+	syncMu sync.Mutex
+
+	// synced records the last sync of each table from the BTree storage.
+	// It is guarded by mu.
+	synced map[string]tableSync
+
+	// attached maps the tables of ATTACH PARQUET to their files
+	attached map[string]string
+
+	rowGroupRows  int   // rows per row group of synced files
+	rowGroupsRead int64 // row groups read by Select, see RowGroupsRead
 }
 
+// defaultRowGroupRows is the number of rows per row group of synced files,
+// so that the statistics of large tables let Select skip most of them
+const defaultRowGroupRows = 64 * 1024
+
 // NewParquetStorage creates a new Parquet storage
 func NewParquetStorage(dataDir string) (*ParquetStorage, error) {
 	// Ensure data directory exists
@@ -44,6 +62,9 @@ func NewParquetStorage(dataDir string) (*ParquetStorage, error) {
 	return &ParquetStorage{
 		baseDir:      dataDir,
 		tables:       make(map[string]*types.Table),
+		attached:     make(map[string]string),
+		synced:       make(map[string]tableSync),
+		rowGroupRows: defaultRowGroupRows,
 		syncInterval: 5 * time.Minute, // Default sync interval
 	}, nil
 }
@@ -53,98 +74,265 @@ func (s *ParquetStorage) SetBTreeSource(btree *BTreeStorage) {
 	s.btreeSource = btree
 }
 
-// SetSyncInterval sets the interval for automatic syncing
+// SetSyncInterval sets the interval for automatic syncing. A running
+// worker uses it from its next sync on.
 func (s *ParquetStorage) SetSyncInterval(interval time.Duration) {
+	s.workerMu.Lock()
+	defer s.workerMu.Unlock()
 	s.syncInterval = interval
-	if s.syncWorker != nil {
-		s.syncWorker.Reset(interval)
+}
+
+// interval returns the sync interval, the default if none was set
+func (s *ParquetStorage) interval() time.Duration {
+	s.workerMu.Lock()
+	defer s.workerMu.Unlock()
+	if s.syncInterval <= 0 {
+		return 5 * time.Minute // Default sync interval
 	}
+	return s.syncInterval
 }
 
-// StartSyncWorker starts a background worker that periodically syncs data from BTree
-func (s *ParquetStorage) StartSyncWorker() {
-	if s.syncInterval == 0 {
-		s.syncInterval = 5 * time.Minute // Default sync interval
+// maxSyncBackoff caps how long the sync worker waits after failed syncs,
+// unless the interval is longer
+const maxSyncBackoff = 30 * time.Minute
+
+// syncDelay returns how long the sync worker waits before its next sync:
+// the interval, doubled for each consecutive failed sync up to
+// maxSyncBackoff. After a failure up to a quarter more is added at random,
+// so that storages failing together do not retry in step.
+func syncDelay(interval time.Duration, failures int) time.Duration {
+	if failures == 0 {
+		return interval
+	}
+	delay := interval
+	for i := 0; i < failures && delay < maxSyncBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxSyncBackoff {
+		delay = maxSyncBackoff
 	}
+	if delay < interval {
+		delay = interval
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/4+1))
+}
 
-	s.stopSync = make(chan struct{})
-	s.syncWorker = time.NewTicker(s.syncInterval)
+// StartSyncWorker starts a background worker that periodically syncs data
+// from BTree, until StopSyncWorker. Each wait starts when the previous sync
+// ends, so syncs never overlap however long they take. It does nothing if
+// the worker is running.
+func (s *ParquetStorage) StartSyncWorker() {
+	s.workerMu.Lock()
+	defer s.workerMu.Unlock()
+	if s.stopSync != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.stopSync, s.workerDone = stop, done
 
 	go func() {
+		defer close(done)
+		failures := 0
+		timer := time.NewTimer(s.interval())
+		defer timer.Stop()
 		for {
 			select {
-			case <-s.syncWorker.C:
-				if err := s.SyncFromBTree(); err != nil {
-					fmt.Printf("Warning: Parquet sync failed: %v\n", err)
-				}
-			case <-s.stopSync:
-				s.syncWorker.Stop()
+			case <-timer.C:
+			case <-stop:
 				return
 			}
+
+			atomic.AddInt64(&s.syncRuns, 1)
+			stats, err := s.SyncFromBTree()
+			switch {
+			case err != nil:
+				failures++
+				types.GlobalLogger.Warning("Parquet sync failed: %v", err)
+			case stats.Failed > 0:
+				failures++
+				types.GlobalLogger.Warning("Parquet sync: %s", stats)
+			default:
+				failures = 0
+				types.GlobalLogger.Debug("Parquet sync: %s", stats)
+			}
+			timer.Reset(syncDelay(s.interval(), failures))
 		}
 	}()
 }
 
-// StopSyncWorker stops the background sync worker
+// StopSyncWorker stops the background sync worker, waiting for a sync in
+// progress to end. It does nothing if the worker is not running.
 func (s *ParquetStorage) StopSyncWorker() {
-	if s.stopSync != nil {
-		close(s.stopSync)
-	}
-	if s.syncWorker != nil {
-		s.syncWorker.Stop()
+	s.workerMu.Lock()
+	stop, done := s.stopSync, s.workerDone
+	s.stopSync, s.workerDone = nil, nil
+	s.workerMu.Unlock()
+	if stop == nil {
+		return
 	}
+	close(stop)
+	<-done
+}
+
+// tableSync records a sync of a table: the time its rows were read and the
+// BTree version they had, so that a write made during the sync counts as
+// newer
+type tableSync struct {
+	at      time.Time
+	version uint64
 }
 
-// SyncFromBTree synchronizes data from the BTree storage
-func (s *ParquetStorage) SyncFromBTree() error {
+// SyncStats reports the work done by a sync from the BTree storage
+type SyncStats struct {
+	Tables   int // tables whose Parquet file was rewritten
+	Skipped  int // tables unchanged since their last sync
+	Failed   int // tables that could not be synced
+	Rows     int // rows written
+	Duration time.Duration
+}
+
+func (st SyncStats) String() string {
+	return fmt.Sprintf("%d tables synced (%d unchanged, %d failed), %d rows written in %v",
+		st.Tables, st.Skipped, st.Failed, st.Rows, st.Duration)
+}
+
+// SyncFromBTree synchronizes data from the BTree storage. Only tables
+// written since their last sync are rewritten; a table that fails to sync
+// is logged and counted as failed, without failing the others.
+func (s *ParquetStorage) SyncFromBTree() (SyncStats, error) {
+	var stats SyncStats
 	if s.btreeSource == nil {
-		return fmt.Errorf("no BTree source configured")
+		return stats, fmt.Errorf("no BTree source configured")
 	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	start := time.Now()
 
 	// Get list of tables from BTree
 	tables, err := s.btreeSource.ShowTables()
 	if err != nil {
-		return fmt.Errorf("failed to get tables from BTree: %v", err)
+		return stats, fmt.Errorf("failed to get tables from BTree: %v", err)
 	}
 
 	for _, tableName := range tables {
-		// Get table schema
-		table := s.btreeSource.GetTable(tableName)
-		if table == nil {
+		if !s.stale(tableName) {
+			stats.Skipped++
 			continue
 		}
-
-		// Get all rows from BTree
-		rows, err := s.btreeSource.Select(tableName, []string{"*"}, nil)
+		rows, err := s.syncTable(tableName)
 		if err != nil {
-			fmt.Printf("Warning: Failed to sync table %s: %v\n", tableName, err)
+			types.GlobalLogger.Warning("Failed to sync table %s: %v", tableName, err)
+			stats.Failed++
 			continue
 		}
+		stats.Tables++
+		stats.Rows += rows
+	}
+	stats.Duration = time.Since(start)
 
-		// Write to Parquet
-		if err := s.writeParquetFile(tableName, table, rows); err != nil {
-			fmt.Printf("Warning: Failed to write Parquet file for table %s: %v\n", tableName, err)
+	s.mu.Lock()
+	s.lastSync = start
+	s.mu.Unlock()
+	return stats, nil
+}
+
+// SyncTable synchronizes a single table from the BTree storage, unless it
+// was not written since its last sync
+func (s *ParquetStorage) SyncTable(tableName string) error {
+	if s.btreeSource == nil {
+		return fmt.Errorf("no BTree source configured")
+	}
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+	if !s.stale(tableName) {
+		return nil
+	}
+	_, err := s.syncTable(tableName)
+	return err
+}
+
+// stale reports whether a table was written in the BTree storage since its
+// last sync, or was not synced since the storage was opened
+func (s *ParquetStorage) stale(tableName string) bool {
+	version := s.btreeSource.TableVersion(tableName)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	last, ok := s.synced[tableName]
+	return !ok || last.version != version
+}
+
+// syncTable replaces the Parquet file of a table with the table's rows in
+// the BTree storage, removing it if there are none, and takes its current
+// schema. It returns the number of rows written. The caller must hold
+// syncMu.
+func (s *ParquetStorage) syncTable(tableName string) (int, error) {
+	// The version is read first, so that a write racing with the sync
+	// leaves the table stale
+	version := s.btreeSource.TableVersion(tableName)
+	table := s.btreeSource.GetTable(tableName)
+	if table == nil {
+		return 0, fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	start := time.Now()
+	rows, err := s.btreeSource.Select(tableName, []string{"*"}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		filePath := filepath.Join(s.baseDir, fmt.Sprintf("%s.parquet", tableName))
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return 0, err
 		}
+	} else if err := s.writeParquetFile(tableName, table, rows); err != nil {
+		return 0, fmt.Errorf("failed to write Parquet file: %w", err)
 	}
 
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tables[tableName] = table
+	s.synced[tableName] = tableSync{at: start, version: version}
+	return len(rows), nil
 }
 
-func (s *ParquetStorage) writeParquetFile(tableName string, table *types.Table, rows []types.Row) error {
+// TableSyncTime returns when a table was last synced from the BTree
+// storage, or the zero time if it was not synced since the storage was
+// opened
+func (s *ParquetStorage) TableSyncTime(tableName string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.synced[tableName].at
+}
+
+func (s *ParquetStorage) writeParquetFile(tableName string, table *types.Table, rows []types.Row) (err error) {
 	if len(rows) == 0 {
 		return nil
 	}
 
-	// Create Parquet file
+	// Create Parquet file, keeping the field names of the previous sync
 	filePath := filepath.Join(s.baseDir, fmt.Sprintf("%s.parquet", tableName))
-	fw, err := local.NewLocalFileWriter(filePath)
+	previous := readParquetNameMap(filePath)
+	names := newParquetNameMap()
+	for _, col := range table.Columns {
+		names.add(col.Name, previous)
+	}
+
+	// Write to a temp file and rename it into place, so readers never see a
+	// half-written file. Temp files left by a crash are removed by Cleanup.
+	tmpPath := filePath + parquetTempSuffix
+	fw, err := local.NewLocalFileWriter(tmpPath)
 	if err != nil {
 		return err
 	}
-	defer fw.Close()
+	defer func() {
+		fw.Close()
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
 
-	// Create Parquet writer
-	pw, err := writer.NewParquetWriter(fw, new(ParquetRow), 4)
+	// Each column of the table is a Parquet column of its type
+	pw, err := writer.NewCSVWriter(parquetSchemaForTable(table, names), fw, 4)
 	if err != nil {
 		return err
 	}
@@ -152,29 +340,40 @@ func (s *ParquetStorage) writeParquetFile(tableName string, table *types.Table,
 	// Set compression
 	pw.CompressionType = parquet.CompressionCodec_SNAPPY
 
-	// Write rows
-	for _, row := range rows {
-		jsonData, err := json.Marshal(row)
-		if err != nil {
+	// Write rows, ending a row group every rowGroupRows rows
+	for n, row := range rows {
+		record := make([]interface{}, len(table.Columns))
+		for i, col := range table.Columns {
+			if record[i], err = parquetCell(col, row[col.Name]); err != nil {
+				return err
+			}
+		}
+		if err := pw.Write(record); err != nil {
 			return err
 		}
-
-		parquetRow := &ParquetRow{
-			TableName: tableName,
-			DataJSON:  string(jsonData),
+		if s.rowGroupRows > 0 && (n+1)%s.rowGroupRows == 0 && n+1 < len(rows) {
+			if err := pw.Flush(true); err != nil {
+				return err
+			}
 		}
+	}
 
-		if err := pw.Write(parquetRow); err != nil {
-			return err
-		}
+	// Record the column name mapping so readers can restore the SQL names
+	kv, err := names.keyValue()
+	if err != nil {
+		return err
 	}
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, kv)
 
 	// Flush and close writer
 	if err := pw.WriteStop(); err != nil {
 		return err
 	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
 
-	return nil
+	return os.Rename(tmpPath, filePath)
 }
 
 // CreateTable implements Storage.CreateTable
@@ -198,42 +397,34 @@ func (s *ParquetStorage) Insert(tableName string, values map[string]interface{})
 	return fmt.Errorf("Parquet storage is read-only; insertions must go through the primary storage")
 }
 
-// Select implements Storage.Select
-func (s *ParquetStorage) Select(tableName string, columns []string, where map[string]interface{}) ([]types.Row, error) {
+// Select implements Storage.Select. Tables synced from the BTree storage
+// are read from their file in the data directory, attached tables from
+// the file they were attached from.
+func (s *ParquetStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	// Check if table exists
-	if _, exists := s.tables[tableName]; !exists {
+	table, exists := s.tables[tableName]
+	if !exists {
 		return nil, fmt.Errorf("table %s does not exist", tableName)
 	}
 
-	// Read data from Parquet file
-	filePath := filepath.Join(s.baseDir, fmt.Sprintf("%s.parquet", tableName))
-	fr, err := local.NewLocalFileReader(filePath)
+	where, err := types.CanonicalWhere(table, where)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// If file doesn't exist, return empty result or count=0
-			if len(columns) == 1 && columns[0] == "COUNT(*)" {
-				return []types.Row{{"count": 0}}, nil
-			}
-			return []types.Row{}, nil
-		}
 		return nil, err
 	}
-	defer fr.Close()
 
-	// Get Parquet reader
-	pr, err := reader.NewParquetReader(fr, new(ParquetRow), 4)
-	if err != nil {
-		return nil, err
+	// Only the columns the query returns or tests are decoded, in the row
+	// groups that may hold a matching row
+	read := selectedColumns(table, columns, where)
+	var rows []types.Row
+	if path, ok := s.attached[tableName]; ok {
+		rows, err = s.readAttachedParquet(path, table, read, where)
+	} else {
+		rows, err = s.readSyncedRows(table, read, where)
 	}
-	defer pr.ReadStop()
-
-	// Read all rows
-	numRows := int(pr.GetNumRows())
-	parquetRows := make([]ParquetRow, numRows)
-	if err := pr.Read(&parquetRows); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
@@ -241,20 +432,8 @@ func (s *ParquetStorage) Select(tableName string, columns []string, where map[st
 	if len(columns) == 1 && columns[0] == "COUNT(*)" {
 		// Count matching rows
 		count := 0
-		for _, prow := range parquetRows {
-			// Skip rows that don't belong to this table
-			if prow.TableName != tableName {
-				continue
-			}
-
-			// Parse JSON data
-			var row types.Row
-			if err := json.Unmarshal([]byte(prow.DataJSON), &row); err != nil {
-				return nil, err
-			}
-
-			// Apply WHERE filter
-			if where == nil || s.matchesWhere(row, where) {
+		for _, row := range rows {
+			if where.Matches(row) {
 				count++
 			}
 		}
@@ -262,27 +441,16 @@ func (s *ParquetStorage) Select(tableName string, columns []string, where map[st
 		return []types.Row{{"count": count}}, nil
 	}
 
-	// Convert to types.Row and apply filtering
+	// Apply filtering
 	var results []types.Row
-	for _, prow := range parquetRows {
-		// Skip rows that don't belong to this table
-		if prow.TableName != tableName {
-			continue
-		}
-
-		// Parse JSON data
-		var row types.Row
-		if err := json.Unmarshal([]byte(prow.DataJSON), &row); err != nil {
-			return nil, err
-		}
-
+	for _, row := range rows {
 		// Apply WHERE filter
-		if where != nil && !s.matchesWhere(row, where) {
+		if !where.Matches(row) {
 			continue
 		}
 
-		// Apply column projection
-		if columns != nil && len(columns) > 0 {
+		// Apply column projection; * keeps every column
+		if len(columns) > 0 && !(len(columns) == 1 && columns[0] == "*") {
 			result := make(types.Row)
 			for _, col := range columns {
 				if val, ok := row[col]; ok {
@@ -298,21 +466,73 @@ func (s *ParquetStorage) Select(tableName string, columns []string, where map[st
 	return results, nil
 }
 
+// readSyncedRows reads the given columns of the rows of a table synced
+// from the BTree storage, skipping the row groups where rules out. A table
+// that was never synced has no rows.
+func (s *ParquetStorage) readSyncedRows(table *types.Table, columns []types.ColumnDefinition, where *types.WhereExpr) ([]types.Row, error) {
+	filePath := filepath.Join(s.baseDir, fmt.Sprintf("%s.parquet", table.Name))
+	pr, closeFile, err := openParquetColumns(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer closeFile()
+
+	field, err := syncedFields(pr)
+	if err != nil {
+		return nil, err
+	}
+	return s.readRowGroups(pr, table, columns, field, where)
+}
+
+// syncedFields returns the field names of the columns of a file written by
+// a sync, from the mapping in its footer
+func syncedFields(pr *reader.ParquetReader) (func(column string) string, error) {
+	names, err := parquetNameMapFromFooter(pr.Footer)
+	if err != nil {
+		return nil, err
+	}
+	return func(column string) string {
+		if names == nil {
+			return sanitizeParquetName(column)
+		}
+		return names.toField[column]
+	}, nil
+}
+
+// readRowGroups reads the given columns of the rows of an open file, in the
+// row groups whose statistics do not rule out where
+func (s *ParquetStorage) readRowGroups(pr *reader.ParquetReader, table *types.Table, columns []types.ColumnDefinition, field func(column string) string, where *types.WhereExpr) ([]types.Row, error) {
+	groups, rows := pruneRowGroups(pr, table, field, where)
+	atomic.AddInt64(&s.rowGroupsRead, int64(groups))
+	return newParquetColumns(pr, columns, field).read(rows)
+}
+
+// RowGroupsRead returns how many row groups Select has read since the
+// storage was opened
+func (s *ParquetStorage) RowGroupsRead() int64 {
+	return atomic.LoadInt64(&s.rowGroupsRead)
+}
+
 // Update implements Storage.Update (but is read-only for Parquet)
-func (s *ParquetStorage) Update(tableName string, set map[string]interface{}, where map[string]interface{}) error {
+func (s *ParquetStorage) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
 	// Parquet storage is read-only
-	return fmt.Errorf("Parquet storage is read-only; updates must go through the primary storage")
+	return 0, fmt.Errorf("Parquet storage is read-only; updates must go through the primary storage")
 }
 
 // Delete implements Storage.Delete (but is read-only for Parquet)
-func (s *ParquetStorage) Delete(tableName string, where map[string]interface{}) error {
+func (s *ParquetStorage) Delete(tableName string, where *types.WhereExpr) (int, error) {
 	// Parquet storage is read-only
-	return fmt.Errorf("Parquet storage is read-only; deletions must go through the primary storage")
+	return 0, fmt.Errorf("Parquet storage is read-only; deletions must go through the primary storage")
 }
 
 // Close implements Storage.Close
 func (s *ParquetStorage) Close() error {
-	// Nothing to close
+	// Files are only open while they are read; the sync worker must not
+	// outlive the storage
+	s.StopSyncWorker()
 	return nil
 }
 
@@ -323,6 +543,12 @@ func (s *ParquetStorage) GetTable(tableName string) *types.Table {
 	return s.tables[tableName]
 }
 
+// Capabilities implements Storage.Capabilities. Rows only arrive by sync
+// from the BTree storage, or with the files of ATTACH PARQUET.
+func (s *ParquetStorage) Capabilities() types.Capabilities {
+	return types.Capabilities{ReadOnly: true, Persistent: true, SupportsAttachParquet: true}
+}
+
 // ShowTables implements Storage.ShowTables
 func (s *ParquetStorage) ShowTables() ([]string, error) {
 	s.mu.RLock()
@@ -335,17 +561,6 @@ func (s *ParquetStorage) ShowTables() ([]string, error) {
 	return tables, nil
 }
 
-// Helper function to check if a row matches a WHERE clause
-func (s *ParquetStorage) matchesWhere(row types.Row, where map[string]interface{}) bool {
-	for col, val := range where {
-		rowVal, ok := row[col]
-		if !ok || rowVal != val {
-			return false
-		}
-	}
-	return true
-}
-
 // GetLastSyncTime returns the time of the last sync
 func (s *ParquetStorage) GetLastSyncTime() time.Time {
 	s.mu.RLock()
@@ -353,25 +568,28 @@ func (s *ParquetStorage) GetLastSyncTime() time.Time {
 	return s.lastSync
 }
 
-// Helper function to convert string column names to parquet schema
-func parquetSchemaForTable(table *types.Table) string {
-	var schema strings.Builder
-	schema.WriteString("message schema {")
-
+// parquetSchemaForTable returns the Parquet schema of a table's file, one
+// optional column per table column. Field names come from names so they
+// are legal Parquet identifiers. INT columns map to INT64, FLOAT to
+// DOUBLE, BOOLEAN to BOOLEAN, TIMESTAMP to INT64 milliseconds and the
+// others to UTF8 strings.
+func parquetSchemaForTable(table *types.Table, names *parquetNameMap) []string {
+	schema := make([]string, 0, len(table.Columns))
 	for _, col := range table.Columns {
 		var parquetType string
 		switch col.Type {
 		case "INT":
-			parquetType = "INT64"
-		case "STRING":
-			parquetType = "BYTE_ARRAY"
+			parquetType = "type=INT64"
+		case "FLOAT":
+			parquetType = "type=DOUBLE"
+		case "BOOLEAN":
+			parquetType = "type=BOOLEAN"
+		case "TIMESTAMP":
+			parquetType = "type=INT64, convertedtype=TIMESTAMP_MILLIS"
 		default:
-			parquetType = "BYTE_ARRAY"
+			parquetType = "type=BYTE_ARRAY, convertedtype=UTF8"
 		}
-
-		schema.WriteString(fmt.Sprintf(" optional %s %s;", parquetType, col.Name))
+		schema = append(schema, fmt.Sprintf("name=%s, %s, repetitiontype=OPTIONAL", names.add(col.Name, nil), parquetType))
 	}
-
-	schema.WriteString(" }")
-	return schema.String()
+	return schema
 }
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// SetQuota implements types.QuotaManager. Rows already over a lowered
+// quota are kept until the next insert.
+func (s *InMemoryStorage) SetQuota(tableName string, quota types.TableQuota) error {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	table.Quota = nil
+	if quota.Limited() {
+		table.Quota = &quota
+	}
+	return nil
+}
+
+// QuotaUsage implements types.QuotaManager
+func (s *InMemoryStorage) QuotaUsage(tableName string) (types.QuotaUsage, error) {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return types.QuotaUsage{}, err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	usage := types.QuotaUsage{Rows: int64(len(table.Rows))}
+	for _, row := range table.Rows {
+		usage.Bytes += types.RowSize(row)
+	}
+	return usage, nil
+}
+
+// makeRoom enforces the table quota before row is appended, evicting the
+// oldest rows (the front of table.Rows) if the quota allows it. The caller
+// must hold the table lock.
+func (s *InMemoryStorage) makeRoom(table *types.Table, row types.Row) error {
+	usage := types.QuotaUsage{Rows: int64(len(table.Rows))}
+	for _, existing := range table.Rows {
+		usage.Bytes += types.RowSize(existing)
+	}
+
+	next := 0
+	evict, err := table.Quota.MakeRoom(table.Name, usage, types.RowSize(row), func() (int64, bool) {
+		if next >= len(table.Rows) {
+			return 0, false
+		}
+		next++
+		return types.RowSize(table.Rows[next-1]), true
+	})
+	if err != nil {
+		return err
+	}
+	table.Rows = table.Rows[evict:]
+	return nil
+}
+
+// quotaRow is the key and size of a stored BTree row
+type quotaRow struct {
+	key  string
+	seq  int64
+	size int64
+}
+
+// rowSequence returns the insertion timestamp encoded at the end of a row
+// key (table:fields:nanos), which orders rows from oldest to newest
+func rowSequence(key string) int64 {
+	seq, _ := strconv.ParseInt(key[strings.LastIndex(key, ":")+1:], 10, 64)
+	return seq
+}
+
+// SetQuota implements types.QuotaManager by storing the quota in the table
+// metadata. Rows already over a lowered quota are kept until the next
+// insert.
+func (s *BTreeStorage) SetQuota(tableName string, quota types.TableQuota) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, exists := s.tables[tableName]
+	if !exists {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	// Replace the definition rather than changing it, since row operations
+	// read it without the catalog lock
+	updated := *table
+	updated.Quota = nil
+	if quota.Limited() {
+		updated.Quota = &quota
+	}
+	if err := s.writeTable(&updated); err != nil {
+		s.tables[tableName] = table
+		return err
+	}
+	return nil
+}
+
+// QuotaUsage implements types.QuotaManager
+func (s *BTreeStorage) QuotaUsage(tableName string) (types.QuotaUsage, error) {
+	if _, err := s.lookup(tableName); err != nil {
+		return types.QuotaUsage{}, err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	rows, err := s.quotaRows(tableName)
+	if err != nil {
+		return types.QuotaUsage{}, err
+	}
+	return quotaUsage(rows), nil
+}
+
+// quotaRows lists a table's rows from oldest to newest. The caller must
+// hold the table lock.
+func (s *BTreeStorage) quotaRows(tableName string) ([]quotaRow, error) {
+	var rows []quotaRow
+	err := s.scanRows(tableName, func(key string, row types.Row) error {
+		rows = append(rows, quotaRow{key: key, seq: rowSequence(key), size: types.RowSize(row)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].seq < rows[j].seq })
+	return rows, nil
+}
+
+func quotaUsage(rows []quotaRow) types.QuotaUsage {
+	usage := types.QuotaUsage{Rows: int64(len(rows))}
+	for _, row := range rows {
+		usage.Bytes += row.size
+	}
+	return usage
+}
+
+// makeRoom enforces the table quota before row is inserted, deleting the
+// oldest rows by key sequence if the quota allows it. Usage is measured by
+// scanning the table, so only tables with a quota pay for it. The caller
+// must hold the table lock.
+func (s *BTreeStorage) makeRoom(table *types.Table, row types.Row) error {
+	rows, err := s.quotaRows(table.Name)
+	if err != nil {
+		return err
+	}
+
+	next := 0
+	evict, err := table.Quota.MakeRoom(table.Name, quotaUsage(rows), types.RowSize(row), func() (int64, bool) {
+		if next >= len(rows) {
+			return 0, false
+		}
+		next++
+		return rows[next-1].size, true
+	})
+	if err != nil || evict == 0 {
+		return err
+	}
+
+	keys := make(map[string]bool, evict)
+	for _, r := range rows[:evict] {
+		keys[r.key] = true
+	}
+	return s.deleteRowKeys(table.Name, keys)
+}
+
+// deleteRowKeys removes the given row keys from a table's data pages
+func (s *BTreeStorage) deleteRowKeys(tableName string, keys map[string]bool) error {
+	defer s.changed(tableName)
+	s.pageMu.Lock()
+	defer s.pageMu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("BTree file is closed")
+	}
+
+	chain, err := s.pageChain(s.tablePageOffset(tableName))
+	if err != nil {
+		return err
+	}
+	page := make([]byte, s.pageSize)
+	for _, offset := range chain {
+		n, err := s.pages.readAt(page, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		pageKeys, values := decodeDataPage(page)
+		var keptKeys []string
+		var keptValues [][]byte
+		for i, key := range pageKeys {
+			if !keys[key] {
+				keptKeys = append(keptKeys, key)
+				keptValues = append(keptValues, values[i])
+			}
+		}
+		if len(keptKeys) == len(pageKeys) {
+			continue
+		}
+
+		encoded, err := encodeDataPage(keptKeys, keptValues, pageNext(page), s.pageSize)
+		if err != nil {
+			return err
+		}
+		if err := s.pages.writeAt(encoded, offset); err != nil {
+			return err
+		}
+	}
+	return s.pages.sync()
+}
@@ -0,0 +1,155 @@
+package storage_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+type quotaStorage interface {
+	types.Storage
+	types.QuotaManager
+}
+
+func quotaStorages(t *testing.T) map[string]quotaStorage {
+	btree, err := storage.NewBTreeStorage(filepath.Join(t.TempDir(), "quota.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { btree.Close() })
+
+	return map[string]quotaStorage{
+		"InMemory": storage.NewInMemoryStorage(),
+		"BTree":    btree,
+	}
+}
+
+func createLogs(t *testing.T, s quotaStorage, ids ...int) {
+	t.Helper()
+	err := s.CreateTable(&types.Table{
+		Name:    "logs",
+		Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: true}, {Name: "msg", Type: "STRING", Nullable: true}},
+	})
+	assert.NoError(t, err)
+	for _, id := range ids {
+		assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": id, "msg": "m"}))
+	}
+}
+
+func logIDs(t *testing.T, s quotaStorage) []int {
+	t.Helper()
+	rows, err := s.Select("logs", []string{"id"}, nil)
+	assert.NoError(t, err)
+	var ids []int
+	for _, row := range rows {
+		ids = append(ids, int(row["id"].(int64)))
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestQuotaRejectsInsertsWhenFull(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			createLogs(t, s, 1, 2)
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxRows: 3}))
+			assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 3}))
+
+			err := s.Insert("logs", map[string]interface{}{"id": 4})
+			assert.True(t, errors.Is(err, types.ErrQuotaExceeded))
+			var quotaErr *types.QuotaError
+			if assert.True(t, errors.As(err, &quotaErr)) {
+				assert.Equal(t, "MAX_ROWS", quotaErr.Limit)
+				assert.Equal(t, int64(3), quotaErr.Used)
+			}
+			assert.Equal(t, []int{1, 2, 3}, logIDs(t, s))
+
+			usage, err := s.QuotaUsage("logs")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(3), usage.Rows)
+			assert.Greater(t, usage.Bytes, int64(0))
+
+			// Removing the quota lifts the limit
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{}))
+			assert.Nil(t, s.GetTable("logs").Quota)
+			assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 4}))
+		})
+	}
+}
+
+func TestQuotaEvictsOldestRows(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			createLogs(t, s, 1, 2, 3)
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxRows: 3, EvictOldest: true}))
+
+			assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 4}))
+			assert.Equal(t, []int{2, 3, 4}, logIDs(t, s))
+			assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 5}))
+			assert.Equal(t, []int{3, 4, 5}, logIDs(t, s))
+		})
+	}
+}
+
+func TestQuotaLoweredBelowUsage(t *testing.T) {
+	for name, s := range quotaStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			createLogs(t, s, 1, 2, 3, 4)
+
+			// Existing rows are kept when the quota is lowered
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxRows: 2}))
+			assert.Equal(t, []int{1, 2, 3, 4}, logIDs(t, s))
+			err := s.Insert("logs", map[string]interface{}{"id": 5})
+			assert.True(t, errors.Is(err, types.ErrQuotaExceeded))
+
+			// The next insert in eviction mode trims down to the new limit
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxRows: 2, EvictOldest: true}))
+			assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 5}))
+			assert.Equal(t, []int{4, 5}, logIDs(t, s))
+		})
+	}
+}
+
+func TestQuotaMaxBytes(t *testing.T) {
+	row := types.Row{"id": 1, "msg": "m"}
+	size := types.RowSize(row)
+
+	for name, s := range quotaStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			createLogs(t, s, 1, 2)
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxBytes: 2*size + 1}))
+
+			err := s.Insert("logs", map[string]interface{}{"id": 3, "msg": "m"})
+			var quotaErr *types.QuotaError
+			if assert.True(t, errors.As(err, &quotaErr)) {
+				assert.Equal(t, "MAX_BYTES", quotaErr.Limit)
+			}
+
+			// A row larger than the whole quota is rejected even with eviction
+			assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxBytes: 2*size + 1, EvictOldest: true}))
+			err = s.Insert("logs", map[string]interface{}{"id": 3, "msg": "a message too long to ever fit"})
+			assert.True(t, errors.Is(err, types.ErrQuotaExceeded))
+			assert.Equal(t, []int{1, 2}, logIDs(t, s))
+
+			assert.NoError(t, s.Insert("logs", map[string]interface{}{"id": 3, "msg": "m"}))
+			assert.Equal(t, []int{2, 3}, logIDs(t, s))
+		})
+	}
+}
+
+func TestBTreeQuotaPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.db")
+	s, err := storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	createLogs(t, s, 1)
+	assert.NoError(t, s.SetQuota("logs", types.TableQuota{MaxRows: 10, EvictOldest: true}))
+	assert.NoError(t, s.Close())
+
+	s, err = storage.NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, &types.TableQuota{MaxRows: 10, EvictOldest: true}, s.GetTable("logs").Quota)
+}
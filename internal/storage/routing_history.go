@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// DefaultRoutingHistorySize is the number of SELECT routing decisions a
+// HybridStorage remembers when StorageConfig.RoutingHistorySize is not set
+const DefaultRoutingHistorySize = 256
+
+// RoutingHistoryTable is the virtual table that exposes the routing history
+// to SELECT (SELECT * FROM __routing_history)
+const RoutingHistoryTable = "__routing_history"
+
+// RoutingDecision records how HybridStorage routed one SELECT
+type RoutingDecision struct {
+	Time      time.Time
+	Statement string // normalized statement, with literals replaced by ?
+	Class     string // OLTP or OLAP, as reported by EXPLAIN
+	Reason    string // the classifier signal that decided Class
+	Engine    string // btree or parquet, the engine that returned the rows
+	Rows      int
+	Duration  time.Duration
+	Error     string
+}
+
+// Row returns the decision as a result row
+func (d RoutingDecision) Row() types.Row {
+	return types.Row{
+		"time":        d.Time.Format(time.RFC3339Nano),
+		"statement":   d.Statement,
+		"class":       d.Class,
+		"reason":      d.Reason,
+		"engine":      d.Engine,
+		"rows":        d.Rows,
+		"duration_us": d.Duration.Microseconds(),
+		"error":       d.Error,
+	}
+}
+
+// routingHistory is a fixed size ring buffer of routing decisions
+type routingHistory struct {
+	mu        sync.Mutex
+	decisions []RoutingDecision
+	next      int // index the next decision is written to
+	full      bool
+}
+
+func newRoutingHistory(size int) *routingHistory {
+	if size <= 0 {
+		size = DefaultRoutingHistorySize
+	}
+	return &routingHistory{decisions: make([]RoutingDecision, size)}
+}
+
+func (h *routingHistory) record(d RoutingDecision) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.decisions[h.next] = d
+	h.next = (h.next + 1) % len(h.decisions)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// entries returns the recorded decisions, oldest first
+func (h *routingHistory) entries() []RoutingDecision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]RoutingDecision(nil), h.decisions[:h.next]...)
+	}
+	entries := append([]RoutingDecision(nil), h.decisions[h.next:]...)
+	return append(entries, h.decisions[:h.next]...)
+}
+
+func (h *routingHistory) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.decisions = make([]RoutingDecision, len(h.decisions))
+	h.next = 0
+	h.full = false
+}
+
+// normalizeSelect renders a SELECT with its literals replaced by ?, so
+// queries that differ only in their values are recorded alike
+func normalizeSelect(tableName string, columns []string, where *types.WhereExpr) string {
+	cols := "*"
+	if len(columns) > 0 {
+		cols = strings.Join(columns, ", ")
+	}
+	statement := fmt.Sprintf("SELECT %s FROM %s", cols, tableName)
+
+	if where != nil {
+		statement += " WHERE " + types.FormatWhere(where, func(column string, _ interface{}) string {
+			return column + " = ?"
+		})
+	}
+	return statement
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func newHistoryHybrid(t *testing.T, size int) *HybridStorage {
+	t.Helper()
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "history.db"))
+	assert.NoError(t, err)
+	parquet, err := NewParquetStorage(dir)
+	assert.NoError(t, err)
+	parquet.SetBTreeSource(btree)
+	s := &HybridStorage{oltp: btree, olap: parquet, history: newRoutingHistory(size)}
+	t.Cleanup(func() { s.Close() })
+
+	err = s.CreateTable(&types.Table{
+		Name: "employees",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", Nullable: true},
+			{Name: "dept", Type: "STRING", Nullable: true},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Insert("employees", map[string]interface{}{"id": 1, "dept": "eng"}))
+	return s
+}
+
+func TestRoutingHistoryMatchesClassifier(t *testing.T) {
+	s := newHistoryHybrid(t, 10)
+
+	queries := []struct {
+		columns []string
+		where   *types.WhereExpr
+		reason  string
+		engine  string
+	}{
+		{[]string{"dept"}, types.WhereAll(map[string]interface{}{"id": 1}), "key lookup", "btree"},
+		{[]string{"*"}, nil, "no WHERE clause", "parquet"},
+		{[]string{"id"}, types.WhereAll(map[string]interface{}{"dept": "sales"}), "filters on non-key column dept", "parquet"},
+		{[]string{"dept"}, types.WhereAll(map[string]interface{}{"id": 2}), "key lookup", "btree"},
+		{[]string{"COUNT(*)"}, types.WhereAll(map[string]interface{}{"id": 1}), "aggregates COUNT(*)", "parquet"},
+	}
+	for _, q := range queries {
+		_, err := s.Select("employees", q.columns, q.where)
+		assert.NoError(t, err)
+	}
+
+	history := s.RoutingHistory()
+	if !assert.Len(t, history, len(queries)) {
+		return
+	}
+	for i, q := range queries {
+		d := history[i]
+		// The class must agree with the classification EXPLAIN reports
+		wantClass := "OLTP"
+		if IsOLAPQuery(q.columns, q.where) {
+			wantClass = "OLAP"
+		}
+		assert.Equal(t, wantClass, d.Class, d.Statement)
+		assert.Equal(t, q.reason, d.Reason, d.Statement)
+		assert.Equal(t, q.engine, d.Engine, d.Statement)
+		assert.Empty(t, d.Error)
+	}
+	assert.Equal(t, "SELECT dept FROM employees WHERE id = ?", history[0].Statement)
+	assert.Equal(t, 1, history[0].Rows)
+	assert.Equal(t, 0, history[3].Rows)
+}
+
+func TestRoutingHistoryIsBounded(t *testing.T) {
+	s := newHistoryHybrid(t, 2)
+
+	for _, id := range []int{1, 2, 3} {
+		_, err := s.Select("employees", []string{"dept"}, types.WhereAll(map[string]interface{}{"id": id}))
+		assert.NoError(t, err)
+	}
+	_, err := s.Select("missing", []string{"*"}, nil)
+	assert.Error(t, err)
+
+	history := s.RoutingHistory()
+	assert.Len(t, history, 2)
+	assert.Equal(t, "SELECT dept FROM employees WHERE id = ?", history[0].Statement)
+	assert.Equal(t, "SELECT * FROM missing", history[1].Statement)
+	assert.Contains(t, history[1].Error, "does not exist")
+
+	// The virtual table exposes the same entries and is not recorded itself
+	rows, err := s.Select(RoutingHistoryTable, []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "OLAP", rows[1]["class"])
+	assert.Len(t, s.RoutingHistory(), 2)
+
+	s.ResetRoutingHistory()
+	assert.Empty(t, s.RoutingHistory())
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// checkSampleColumns rejects columns the table does not have, as Select does
+func checkSampleColumns(table *types.Table, columns []string) error {
+	for _, col := range columns {
+		if col != "*" && columnIndex(table, col) < 0 {
+			return fmt.Errorf("column %s does not exist in table %s", col, table.Name)
+		}
+	}
+	return nil
+}
+
+// SelectSample implements types.Sampler by sampling data pages and then
+// rows within the pages read. With ROWS the table's keys are counted
+// first, which reads every page but decodes no rows.
+func (s *BTreeStorage) SelectSample(tableName string, columns []string, where *types.WhereExpr, spec types.SampleSpec) ([]types.Row, error) {
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSampleColumns(table, columns); err != nil {
+		return nil, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return nil, err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	chain, err := s.tableChain(tableName)
+	if err != nil {
+		return nil, err
+	}
+	pages := len(chain)
+
+	total := 0
+	if spec.Rows > 0 {
+		err := s.samplePages(chain, nil, func(keys []string, values [][]byte) error {
+			for _, key := range keys {
+				if tableNameFromKey(key) == tableName {
+					total++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rng := spec.Rand()
+	fraction := spec.Fraction(total)
+	pageFraction := types.BlockFraction(fraction, pages)
+	rowFraction := fraction / pageFraction
+
+	var rows []types.Row
+	keep := func() bool { return rng.Float64() < pageFraction }
+	err = s.samplePages(chain, keep, func(keys []string, values [][]byte) error {
+		for i, key := range keys {
+			if tableNameFromKey(key) != tableName || rng.Float64() >= rowFraction {
+				continue
+			}
+			row, err := decodeRow(values[i], table)
+			if err != nil {
+				return err
+			}
+			if where.Matches(row) {
+				rows = append(rows, types.ProjectRow(row, columns))
+			}
+		}
+		return nil
+	})
+	return rows, err
+}
+
+// samplePages calls fn with the keys and values of each page of a table's
+// chain that keep, if not nil, accepts. Skipped pages are not read.
+func (s *BTreeStorage) samplePages(chain []int64, keep func() bool, fn func(keys []string, values [][]byte) error) error {
+	page := make([]byte, s.pageSize)
+	for _, offset := range chain {
+		if keep != nil && !keep() {
+			continue
+		}
+		n, err := s.readPage(page, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		keys, values := decodeDataPage(page)
+		if err := fn(keys, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectSample implements types.Sampler by sampling row groups and then
+// rows within the row groups read. Skipped row groups are not decoded.
+func (s *ParquetStorage) SelectSample(tableName string, columns []string, where *types.WhereExpr, spec types.SampleSpec) ([]types.Row, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	table, exists := s.tables[tableName]
+	if !exists {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	if err := checkSampleColumns(table, columns); err != nil {
+		return nil, err
+	}
+	where, err := types.CanonicalWhere(table, where)
+	if err != nil {
+		return nil, err
+	}
+
+	filePath := filepath.Join(s.baseDir, fmt.Sprintf("%s.parquet", tableName))
+	pr, closeFile, err := openParquetColumns(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []types.Row{}, nil
+		}
+		return nil, err
+	}
+	defer closeFile()
+
+	field, err := syncedFields(pr)
+	if err != nil {
+		return nil, err
+	}
+	cols := newParquetColumns(pr, selectedColumns(table, columns, where), field)
+
+	rng := spec.Rand()
+	fraction := spec.Fraction(int(pr.GetNumRows()))
+	groupFraction := types.BlockFraction(fraction, len(pr.Footer.RowGroups))
+	rowFraction := fraction / groupFraction
+
+	var rows []types.Row
+	for _, group := range pr.Footer.RowGroups {
+		if rng.Float64() >= groupFraction {
+			if err := cols.skip(group.NumRows); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		groupRows, err := cols.read(group.NumRows)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range groupRows {
+			if rng.Float64() >= rowFraction {
+				continue
+			}
+			if where.Matches(row) {
+				rows = append(rows, types.ProjectRow(row, columns))
+			}
+		}
+	}
+	return rows, nil
+}
+
+// SelectSample implements types.Sampler on the OLTP storage, which always
+// has the latest rows
+func (s *HybridStorage) SelectSample(tableName string, columns []string, where *types.WhereExpr, spec types.SampleSpec) ([]types.Row, error) {
+	return types.SampleSelect(s.oltp, tableName, columns, where, spec)
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func eventsTable() *types.Table {
+	return &types.Table{
+		Name: "events",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", Nullable: true},
+			{Name: "kind", Type: "STRING", Nullable: true},
+		},
+	}
+}
+
+func eventRows(n int) []types.Row {
+	rows := make([]types.Row, n)
+	for i := range rows {
+		rows[i] = types.Row{"id": i, "kind": []string{"click", "view"}[i%2]}
+	}
+	return rows
+}
+
+// forEachStorage runs fn as a subtest on each of an InMemory and a BTree
+// storage holding the events table with eventRows(8)
+func forEachStorage(t *testing.T, fn func(t *testing.T, store types.Storage)) {
+	t.Helper()
+	btree, err := NewBTreeStorage(filepath.Join(t.TempDir(), "events.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer btree.Close()
+
+	for _, tc := range []struct {
+		name  string
+		store types.Storage
+	}{
+		{"InMemory", NewInMemoryStorage()},
+		{"BTree", btree},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.NoError(t, tc.store.CreateTable(eventsTable()))
+			for _, row := range eventRows(8) {
+				assert.NoError(t, tc.store.Insert("events", row))
+			}
+			fn(t, tc.store)
+		})
+	}
+}
+
+func TestSampleSelectSize(t *testing.T) {
+	s := NewInMemoryStorage()
+	assert.NoError(t, s.CreateTable(eventsTable()))
+	for _, row := range eventRows(2000) {
+		assert.NoError(t, s.Insert("events", row))
+	}
+
+	rows, err := types.SampleSelect(s, "events", []string{"*"}, nil, types.SampleSpec{Percent: 10})
+	assert.NoError(t, err)
+	assert.InDelta(t, 200, len(rows), 80)
+
+	rows, err = types.SampleSelect(s, "events", []string{"id"}, nil, types.SampleSpec{Rows: 500})
+	assert.NoError(t, err)
+	assert.InDelta(t, 500, len(rows), 100)
+	assert.Equal(t, types.Row{"id": rows[0]["id"]}, rows[0])
+
+	// WHERE filters the sampled rows, and ROWS is relative to the whole table
+	rows, err = types.SampleSelect(s, "events", []string{"*"}, types.WhereAll(map[string]interface{}{"kind": "click"}), types.SampleSpec{Rows: 500})
+	assert.NoError(t, err)
+	assert.InDelta(t, 250, len(rows), 75)
+	for _, row := range rows {
+		assert.Equal(t, "click", row["kind"])
+	}
+
+	_, err = types.SampleSelect(s, "events", []string{"COUNT(*)"}, nil, types.SampleSpec{Percent: 10})
+	assert.EqualError(t, err, "TABLESAMPLE does not support COUNT(*)")
+}
+
+func TestSampleSelectRepeatable(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s types.Storage) {
+		spec := types.SampleSpec{Percent: 50, Repeatable: true, Seed: 42}
+		first, err := types.SampleSelect(s, "events", []string{"*"}, nil, spec)
+		assert.NoError(t, err)
+		second, err := types.SampleSelect(s, "events", []string{"*"}, nil, spec)
+		assert.NoError(t, err)
+		assert.Equal(t, first, second)
+		assert.Less(t, len(first), 8)
+
+		all, err := types.SampleSelect(s, "events", []string{"*"}, nil, types.SampleSpec{Percent: 100})
+		assert.NoError(t, err)
+		assert.Len(t, all, 8)
+
+		_, err = types.SampleSelect(s, "events", []string{"missing"}, nil, spec)
+		assert.Error(t, err)
+	})
+}
+
+func TestParquetSelectSample(t *testing.T) {
+	s, err := NewParquetStorage(t.TempDir())
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateTable(eventsTable()))
+	assert.NoError(t, s.writeParquetFile("events", eventsTable(), eventRows(1000)))
+
+	spec := types.SampleSpec{Percent: 20, Repeatable: true, Seed: 7}
+	first, err := s.SelectSample("events", []string{"id", "kind"}, types.WhereAll(map[string]interface{}{"kind": "view"}), spec)
+	assert.NoError(t, err)
+	second, err := s.SelectSample("events", []string{"id", "kind"}, types.WhereAll(map[string]interface{}{"kind": "view"}), spec)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.InDelta(t, 100, len(first), 50)
+	for _, row := range first {
+		assert.Equal(t, "view", row["kind"])
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// SelectEach implements types.Scanner, decoding one row at a time as the
+// table's pages are read
+func (s *BTreeStorage) SelectEach(tableName string, columns []string, where *types.WhereExpr, fn func(row types.Row) error) error {
+	if len(columns) == 1 && strings.HasPrefix(strings.ToUpper(columns[0]), "COUNT(") {
+		rows, err := s.Select(tableName, columns, where)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	table, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
+	if err := checkSampleColumns(table, columns); err != nil {
+		return err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return err
+	}
+
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return s.scanRows(tableName, func(key string, row types.Row) error {
+		if !where.Matches(row) {
+			return nil
+		}
+		return fn(types.ProjectRow(row, columns))
+	})
+}
+
+// SelectEach implements types.Scanner on the OLTP storage, which always
+// has the latest rows
+func (s *HybridStorage) SelectEach(tableName string, columns []string, where *types.WhereExpr, fn func(row types.Row) error) error {
+	return types.SelectEach(s.oltp, tableName, columns, where, fn)
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestSelectEach(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s types.Storage) {
+		// Rows come in the order Select returns them
+		want, err := s.Select("events", []string{"id"}, types.WhereAll(map[string]interface{}{"kind": "view"}))
+		assert.NoError(t, err)
+		var got []types.Row
+		assert.NoError(t, types.SelectEach(s, "events", []string{"id"}, types.WhereAll(map[string]interface{}{"kind": "view"}), func(row types.Row) error {
+			got = append(got, row)
+			return nil
+		}))
+		assert.Equal(t, want, got)
+
+		// An error from the callback stops the scan
+		stop := errors.New("stop")
+		seen := 0
+		err = types.SelectEach(s, "events", []string{"*"}, nil, func(row types.Row) error {
+			seen++
+			return stop
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 1, seen)
+
+		assert.Error(t, types.SelectEach(s, "events", []string{"missing"}, nil, func(types.Row) error { return nil }))
+	})
+}
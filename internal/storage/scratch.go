@@ -0,0 +1,17 @@
+package storage
+
+import "github.com/zakazai/ulin-db/internal/types"
+
+// scratch keeps CTE rows and transaction writes in memory
+var scratch = types.Scratch{
+	NewStorage: func() types.Storage {
+		return NewInMemoryStorage()
+	},
+	NewTransaction: func(base types.Storage) types.Transaction {
+		return NewTransaction(base)
+	},
+}
+
+func init() {
+	types.RegisterScratch(scratch)
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestScratchRegistered(t *testing.T) {
+	relations, err := types.NewScratchStorage()
+	assert.NoError(t, err)
+	assert.IsType(t, &InMemoryStorage{}, relations)
+
+	base := NewInMemoryStorage()
+	assert.NoError(t, base.CreateTable(eventsTable()))
+	tx, err := types.BeginTransaction(base)
+	assert.NoError(t, err)
+	assert.IsType(t, &Transaction{}, tx)
+	assert.NoError(t, tx.Rollback())
+
+	// Without this package linked in there is no scratch storage to use
+	types.RegisterScratch(types.Scratch{})
+	defer types.RegisterScratch(scratch)
+	_, err = types.NewScratchStorage()
+	assert.ErrorIs(t, err, types.ErrNoScratch)
+	_, err = types.BeginTransaction(base)
+	assert.ErrorIs(t, err, types.ErrNoScratch)
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -22,18 +23,31 @@ type Database struct {
 // Storage interface defines the methods for database storage
 type Storage interface {
 	CreateTable(table *types.Table) error
+	DropTable(tableName string) error
 	Insert(tableName string, values map[string]interface{}) error
-	Select(tableName string, columns []string, where map[string]interface{}) ([]types.Row, error)
-	Update(tableName string, set map[string]interface{}, where map[string]interface{}) error
-	Delete(tableName string, where map[string]interface{}) error
+	Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error)
+	Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error)
+	Delete(tableName string, where *types.WhereExpr) (int, error)
 	GetTable(tableName string) *types.Table
 	Close() error
 	ShowTables() ([]string, error)
+	Capabilities() types.Capabilities
 }
 
-// InMemoryStorage implements Storage interface using in-memory storage
+// InMemoryStorage implements Storage interface using in-memory storage.
+// db.mu is the catalog lock; each table's rows are guarded by its own lock
+// in locks (see tableLocks for the lock ordering).
 type InMemoryStorage struct {
-	db *Database
+	db     *Database
+	locks  *tableLocks
+	strict bool
+
+	// indexMu guards indexTables, which maps every index name to its
+	// table, and the map of tables in indexes. The indexes of a table are
+	// guarded by the table lock.
+	indexMu     sync.Mutex
+	indexTables map[string]string
+	indexes     map[string]map[string]*valueIndex
 }
 
 // NewInMemoryStorage creates a new in-memory storage
@@ -42,9 +56,32 @@ func NewInMemoryStorage() *InMemoryStorage {
 		db: &Database{
 			Tables: make(map[string]*types.Table),
 		},
+		locks:       newTableLocks(),
+		indexTables: make(map[string]string),
+		indexes:     make(map[string]map[string]*valueIndex),
 	}
 }
 
+// lookup returns a table and the strict mode setting under the catalog lock
+func (s *InMemoryStorage) lookup(tableName string) (*types.Table, bool, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	table, exists := s.db.Tables[tableName]
+	if !exists {
+		return nil, false, fmt.Errorf("table %s does not exist", tableName)
+	}
+	return table, s.strict, nil
+}
+
+// SetStrict enables or disables strict mode, which rejects values that
+// would need a silent type coercion to fit their column
+func (s *InMemoryStorage) SetStrict(strict bool) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.strict = strict
+}
+
 func (s *InMemoryStorage) CreateTable(table *types.Table) error {
 	s.db.mu.Lock()
 	defer s.db.mu.Unlock()
@@ -62,43 +99,26 @@ func (s *InMemoryStorage) CreateTable(table *types.Table) error {
 		columnNames[col.Name] = true
 	}
 
-	s.db.Tables[table.Name] = table
-	return nil
-}
-
-func (s *InMemoryStorage) validateDataType(value interface{}, columnType string) error {
-	if value == nil {
-		return nil // NULL values are allowed for any type
-	}
-
-	switch columnType {
-	case "INT":
-		switch v := value.(type) {
-		case int, int32, int64:
-			return nil
-		case float64:
-			if float64(int(v)) == v {
-				return nil
-			}
-		case string:
-			if _, err := strconv.Atoi(v); err == nil {
-				return nil
-			}
+	// A definition with indexes gets them built over its rows
+	for _, index := range table.Indexes {
+		err := fmt.Errorf("column %s does not exist in table %s", index.Column, table.Name)
+		if columnNames[index.Column] {
+			err = s.addIndex(table, index)
 		}
-		return fmt.Errorf("value %v is not an integer", value)
-	case "STRING", "TEXT":
-		switch value.(type) {
-		case string:
-			return nil
-		case int, int32, int64, float64:
-			// Convert numeric values to string
-			return nil
+		if err != nil {
+			s.dropTableIndexes(table.Name)
+			return err
 		}
-		return fmt.Errorf("value %v is not a string", value)
 	}
+
+	s.db.Tables[table.Name] = table
 	return nil
 }
 
+func (s *InMemoryStorage) validateDataType(value interface{}, col types.ColumnDefinition, strict bool) error {
+	return types.CheckValueType(col.Name, col.Type, value, strict)
+}
+
 func (s *InMemoryStorage) validateColumns(table *types.Table, columns []string) error {
 	if len(columns) == 1 && columns[0] == "*" {
 		return nil
@@ -131,7 +151,7 @@ func (s *InMemoryStorage) validateColumnNames(table *types.Table, values map[str
 	return nil
 }
 
-func (s *InMemoryStorage) validateWhereColumns(table *types.Table, where map[string]interface{}) error {
+func (s *InMemoryStorage) validateWhereColumns(table *types.Table, where *types.WhereExpr) error {
 	if where == nil {
 		return nil
 	}
@@ -141,7 +161,7 @@ func (s *InMemoryStorage) validateWhereColumns(table *types.Table, where map[str
 		columnMap[col.Name] = true
 	}
 
-	for colName := range where {
+	for _, colName := range types.WhereColumns(where) {
 		if !columnMap[colName] {
 			return fmt.Errorf("invalid column name in WHERE clause: %s", colName)
 		}
@@ -150,59 +170,130 @@ func (s *InMemoryStorage) validateWhereColumns(table *types.Table, where map[str
 }
 
 func (s *InMemoryStorage) Insert(tableName string, values map[string]interface{}) error {
-	s.db.mu.Lock()
-	defer s.db.mu.Unlock()
+	table, strict, err := s.lookup(tableName)
+	if err != nil {
+		return err
+	}
 
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	row, err := s.buildRow(table, values, strict)
+	if err != nil {
+		return err
+	}
+	if err := types.CheckPrimaryKey(table, table.Rows, row); err != nil {
+		return err
+	}
+	return s.appendRow(table, row)
+}
+
+// InsertRows implements types.BatchInserter. Every row is validated before
+// any is inserted.
+func (s *InMemoryStorage) InsertRows(tableName string, rows []map[string]interface{}) error {
+	table, strict, err := s.lookup(tableName)
+	if err != nil {
+		return err
 	}
 
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	built := make([]types.Row, len(rows))
+	for i, values := range rows {
+		if built[i], err = s.buildRow(table, values, strict); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if err := types.CheckPrimaryKey(table, table.Rows, built[i]); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+		if err := types.CheckPrimaryKey(table, built[:i], built[i]); err != nil {
+			return fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+	for i, row := range built {
+		if err := s.appendRow(table, row); err != nil {
+			return fmt.Errorf("row %d: %w (%d rows inserted)", i+1, err, i)
+		}
+	}
+	return nil
+}
+
+// buildRow validates values against the table and returns the row to store
+func (s *InMemoryStorage) buildRow(table *types.Table, values map[string]interface{}, strict bool) (types.Row, error) {
 	// Validate column names
 	if err := s.validateColumnNames(table, values); err != nil {
-		return err
+		return nil, err
 	}
+	values = types.WithDefaults(table, values)
 
 	// Validate all required columns are present and check data types
 	row := make(types.Row)
 	for _, col := range table.Columns {
 		val, exists := values[col.Name]
 		if !exists && !col.Nullable {
-			return fmt.Errorf("missing required column %s", col.Name)
+			return nil, fmt.Errorf("missing required column %s", col.Name)
+		}
+		if exists && val == nil && !col.Nullable {
+			return nil, fmt.Errorf("NULL value not allowed for non-nullable column %s", col.Name)
 		}
 		if exists {
-			if err := s.validateDataType(val, col.Type); err != nil {
-				return fmt.Errorf("invalid data type for column %s: %v", col.Name, err)
+			if err := s.validateDataType(val, col, strict); err != nil {
+				return nil, fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
 			}
-			// Convert float64 to int for INT columns
-			if col.Type == "INT" {
-				if f, ok := val.(float64); ok {
-					val = int(f)
-				}
+			canonical, err := types.CanonicalValue(col.Type, val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
 			}
-			row[col.Name] = val
+			row[col.Name] = canonical
 		}
 	}
+	return row, nil
+}
 
+// appendRow stores a validated row, making room for it first if the table
+// has a quota. The caller must hold the table lock.
+func (s *InMemoryStorage) appendRow(table *types.Table, row types.Row) error {
+	kept := len(table.Rows)
+	if table.Quota != nil {
+		if err := s.makeRoom(table, row); err != nil {
+			return err
+		}
+	}
 	table.Rows = append(table.Rows, row)
+
+	if len(table.Rows) <= kept {
+		s.reindex(table)
+		return nil
+	}
+	for _, idx := range s.tableIndexes(table.Name) {
+		idx.add(row[idx.column], len(table.Rows)-1)
+	}
 	return nil
 }
 
-func (s *InMemoryStorage) Select(tableName string, columns []string, where map[string]interface{}) ([]types.Row, error) {
-	s.db.mu.RLock()
-	defer s.db.mu.RUnlock()
+func (s *InMemoryStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return nil, err
+	}
 
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", tableName)
+	lock := s.locks.get(tableName)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return nil, err
 	}
 
 	// Check for COUNT(*) aggregation
 	if len(columns) == 1 && columns[0] == "COUNT(*)" {
 		// Count matching rows
 		count := 0
-		for _, row := range table.Rows {
-			if s.matchesWhere(row, where) {
+		for _, row := range s.candidateRows(table, where) {
+			if where.Matches(row) {
 				count++
 			}
 		}
@@ -221,8 +312,8 @@ func (s *InMemoryStorage) Select(tableName string, columns []string, where map[s
 	}
 
 	var result []types.Row
-	for _, row := range table.Rows {
-		if s.matchesWhere(row, where) {
+	for _, row := range s.candidateRows(table, where) {
+		if where.Matches(row) {
 			selectedRow := make(types.Row)
 			if len(columns) == 1 && columns[0] == "*" {
 				// Select all columns
@@ -248,84 +339,92 @@ func (s *InMemoryStorage) Select(tableName string, columns []string, where map[s
 	return result, nil
 }
 
-func (s *InMemoryStorage) Update(tableName string, set map[string]interface{}, where map[string]interface{}) error {
-	s.db.mu.Lock()
-	defer s.db.mu.Unlock()
-
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+func (s *InMemoryStorage) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	table, strict, err := s.lookup(tableName)
+	if err != nil {
+		return 0, err
 	}
 
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// Validate set columns
 	if err := s.validateColumnNames(table, set); err != nil {
-		return err
+		return 0, err
 	}
 
 	// Validate where columns
 	if err := s.validateWhereColumns(table, where); err != nil {
-		return err
+		return 0, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return 0, err
 	}
 
 	// Validate data types for set values
 	for colName, value := range set {
 		for _, col := range table.Columns {
 			if col.Name == colName {
-				if err := s.validateDataType(value, col.Type); err != nil {
-					return fmt.Errorf("invalid data type for column %s: %v", colName, err)
+				if err := s.validateDataType(value, col, strict); err != nil {
+					return 0, fmt.Errorf("invalid data type for column %s: %w", colName, err)
 				}
 				break
 			}
 		}
 	}
+	if set, err = types.CanonicalValues(table, set); err != nil {
+		return 0, err
+	}
 
-	rowsAffected := 0
+	indexes := s.tableIndexes(tableName)
+	updated := 0
 	for i := range table.Rows {
-		if s.matchesWhere(table.Rows[i], where) {
+		if where.Matches(table.Rows[i]) {
+			updated++
+			for _, idx := range indexes {
+				if value, ok := set[idx.column]; ok {
+					idx.remove(table.Rows[i][idx.column], i)
+					idx.add(value, i)
+				}
+			}
 			for colName, value := range set {
 				table.Rows[i][colName] = value
 			}
-			rowsAffected++
 		}
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows matched the WHERE clause")
-	}
-	return nil
+	return updated, nil
 }
 
-func (s *InMemoryStorage) Delete(tableName string, where map[string]interface{}) error {
-	s.db.mu.Lock()
-	defer s.db.mu.Unlock()
-
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+func (s *InMemoryStorage) Delete(tableName string, where *types.WhereExpr) (int, error) {
+	table, _, err := s.lookup(tableName)
+	if err != nil {
+		return 0, err
 	}
 
+	lock := s.locks.get(tableName)
+	lock.Lock()
+	defer lock.Unlock()
+
 	// Validate where columns
 	if err := s.validateWhereColumns(table, where); err != nil {
-		return err
+		return 0, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return 0, err
 	}
 
 	// Filter out rows that match the where clause
 	var newRows []types.Row
-	rowsAffected := 0
 	for _, row := range table.Rows {
-		if !s.matchesWhere(row, where) {
+		if !where.Matches(row) {
 			newRows = append(newRows, row)
-		} else {
-			rowsAffected++
 		}
 	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no rows matched the WHERE clause")
-	}
-
+	deleted := len(table.Rows) - len(newRows)
 	table.Rows = newRows
-	return nil
+	s.reindex(table)
+	return deleted, nil
 }
 
 func (s *InMemoryStorage) GetTable(tableName string) *types.Table {
@@ -338,6 +437,18 @@ func (s *InMemoryStorage) Close() error {
 	return nil
 }
 
+// Capabilities implements Storage.Capabilities
+func (s *InMemoryStorage) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		SupportsTransactions:    true,
+		SupportsQuotas:          true,
+		SupportsAlterColumnType: true,
+		SupportsColumnMasks:     true,
+		SupportsAddColumn:       true,
+		SupportsIndexes:         true,
+	}
+}
+
 func (s *InMemoryStorage) ShowTables() ([]string, error) {
 	s.db.mu.RLock()
 	defer s.db.mu.RUnlock()
@@ -349,60 +460,23 @@ func (s *InMemoryStorage) ShowTables() ([]string, error) {
 	return tables, nil
 }
 
-func (s *InMemoryStorage) matchesWhere(row types.Row, where map[string]interface{}) bool {
-	if where == nil {
-		return true
-	}
-
-	for col, val := range where {
-		rowVal, ok := row[col]
-		if !ok {
-			return false
-		}
-
-		// Special handling for numeric comparisons
-		switch v := val.(type) {
-		case float64:
-			switch rv := rowVal.(type) {
-			case int:
-				// Compare int to float64
-				if float64(rv) == v {
-					continue
-				}
-			case float64:
-				// Compare float64 to float64
-				if rv == v {
-					continue
-				}
-			}
-		case int:
-			switch rv := rowVal.(type) {
-			case int:
-				// Compare int to int
-				if rv == v {
-					continue
-				}
-			case float64:
-				// Compare float64 to int
-				if rv == float64(v) {
-					continue
-				}
-			}
-		}
-
-		// For non-numeric types or if numeric comparison didn't match
-		if rowVal != val {
-			return false
-		}
-	}
-	return true
-}
-
-// JSONStorage implements Storage interface using JSON files
+// JSONStorage implements Storage interface using JSON files. Tables are
+// loaded lazily: opening the storage only lists the table files, and a
+// table's schema and rows are read on first access. At most
+// jsonTableCacheSize tables are kept in memory.
 type JSONStorage struct {
-	db         *Database
+	db         *Database // db.Tables holds only the loaded tables
 	dataDir    string
 	filePrefix string
+	strict     bool
+
+	// catalog maps every table name to its file, loaded or not
+	catalog map[string]string
+
+	// cacheMu guards db.Tables and cache, which readers holding only
+	// db.mu.RLock still change when they load a table
+	cacheMu sync.Mutex
+	cache   *jsonTableCache
 }
 
 // NewJSONStorage creates a new JSON storage
@@ -418,16 +492,26 @@ func NewJSONStorage(dataDir, filePrefix string) (*JSONStorage, error) {
 		},
 		dataDir:    dataDir,
 		filePrefix: filePrefix,
+		catalog:    make(map[string]string),
+		cache:      newJSONTableCache(jsonTableCacheSize),
 	}
 
-	// Load existing tables
-	if err := storage.loadTables(); err != nil {
+	// List existing tables
+	if err := storage.loadCatalog(); err != nil {
 		return nil, fmt.Errorf("failed to load tables: %v", err)
 	}
 
 	return storage, nil
 }
 
+// SetStrict enables or disables strict mode, which rejects values that
+// would need a silent type coercion to fit their column
+func (s *JSONStorage) SetStrict(strict bool) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.strict = strict
+}
+
 // jsonTable is used for JSON serialization/deserialization
 type jsonTable struct {
 	Name    string                   `json:"name"`
@@ -435,79 +519,132 @@ type jsonTable struct {
 	Rows    []map[string]interface{} `json:"rows"`
 }
 
-func (s *JSONStorage) loadTables() error {
+// loadCatalog lists the table files without reading them
+func (s *JSONStorage) loadCatalog() error {
 	files, err := filepath.Glob(filepath.Join(s.dataDir, s.filePrefix+"*.json"))
 	if err != nil {
 		return fmt.Errorf("failed to list table files: %v", err)
 	}
 
 	for _, file := range files {
-		data, err := ioutil.ReadFile(file)
-		if err != nil {
-			return fmt.Errorf("failed to read table file %s: %v", file, err)
-		}
-
-		var jsonTable jsonTable
-		if err := json.Unmarshal(data, &jsonTable); err != nil {
-			return fmt.Errorf("failed to unmarshal table data from %s: %v", file, err)
-		}
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), s.filePrefix), ".json")
+		s.catalog[name] = file
+	}
 
-		// Create column map for validation
-		columnMap := make(map[string]bool)
-		for _, col := range jsonTable.Columns {
-			columnMap[col.Name] = true
-		}
+	return nil
+}
 
-		table := &types.Table{
-			Name:    jsonTable.Name,
-			Columns: make([]types.ColumnDefinition, len(jsonTable.Columns)),
-			Rows:    make([]types.Row, len(jsonTable.Rows)),
-		}
+// table returns a table, loading it from disk if it is not in memory. It
+// returns nil if the table does not exist. The caller must hold db.mu.
+func (s *JSONStorage) table(tableName string) (*types.Table, error) {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
 
-		// Copy columns
-		copy(table.Columns, jsonTable.Columns)
+	file, exists := s.catalog[tableName]
+	if !exists {
+		return nil, nil
+	}
 
-		// Copy rows with validation
-		for i, row := range jsonTable.Rows {
-			newRow := make(types.Row)
-			for k, v := range row {
-				if !columnMap[k] {
-					return fmt.Errorf("invalid column %s in table %s", k, jsonTable.Name)
-				}
-				newRow[k] = v
-			}
-			table.Rows[i] = newRow
+	table, loaded := s.db.Tables[tableName]
+	if !loaded {
+		var err error
+		if table, err = loadJSONTable(file); err != nil {
+			return nil, err
 		}
+		s.db.Tables[tableName] = table
+	}
 
-		s.db.Tables[table.Name] = table
+	if evicted := s.cache.touch(tableName); evicted != "" {
+		delete(s.db.Tables, evicted)
 	}
+	return table, nil
+}
 
-	return nil
+// existingTable is like table but reports a missing table as an error
+func (s *JSONStorage) existingTable(tableName string) (*types.Table, error) {
+	table, err := s.table(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		return nil, fmt.Errorf("table %s does not exist", tableName)
+	}
+	return table, nil
 }
 
-func (s *JSONStorage) saveTables() error {
-	for tableName, table := range s.db.Tables {
-		// Convert types.Row to map[string]interface{} for JSON serialization
-		jsonRows := make([]map[string]interface{}, len(table.Rows))
-		for i, row := range table.Rows {
-			jsonRows[i] = row
-		}
+func loadJSONTable(file string) (*types.Table, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table file %s: %v", file, err)
+	}
 
-		jsonTable := jsonTable{
-			Name:    tableName,
-			Columns: table.Columns,
-			Rows:    jsonRows,
-		}
+	// Numbers are decoded as json.Number so that INT values keep their
+	// precision until they get the type of their column
+	var jsonTable jsonTable
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&jsonTable); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal table data from %s: %v", file, err)
+	}
 
-		data, err := json.MarshalIndent(jsonTable, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal table %s: %v", tableName, err)
+	// Create column map for validation
+	columnMap := make(map[string]bool)
+	for _, col := range jsonTable.Columns {
+		columnMap[col.Name] = true
+	}
+
+	table := &types.Table{
+		Name:    jsonTable.Name,
+		Columns: make([]types.ColumnDefinition, len(jsonTable.Columns)),
+		Rows:    make([]types.Row, len(jsonTable.Rows)),
+	}
+
+	// Copy columns
+	copy(table.Columns, jsonTable.Columns)
+	for i, col := range table.Columns {
+		if def, err := types.CanonicalValue(col.Type, col.Default); err == nil {
+			table.Columns[i].Default = def
 		}
+	}
 
-		filePath := filepath.Join(s.dataDir, s.filePrefix+tableName+".json")
-		if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
-			return fmt.Errorf("failed to write table %s to file: %v", tableName, err)
+	// Copy rows with validation
+	for i, row := range jsonTable.Rows {
+		newRow := make(types.Row)
+		for k, v := range row {
+			if !columnMap[k] {
+				return nil, fmt.Errorf("invalid column %s in table %s", k, jsonTable.Name)
+			}
+			newRow[k] = v
 		}
+		types.CanonicalRow(table, newRow)
+		table.Rows[i] = newRow
+	}
+
+	return table, nil
+}
+
+// saveTable writes a single table to its file
+func (s *JSONStorage) saveTable(table *types.Table) error {
+	// Convert types.Row to map[string]interface{} for JSON serialization
+	jsonRows := make([]map[string]interface{}, len(table.Rows))
+	for i, row := range table.Rows {
+		jsonRows[i] = row
+	}
+
+	jsonTable := jsonTable{
+		Name:    table.Name,
+		Columns: table.Columns,
+		Rows:    jsonRows,
+	}
+
+	data, err := json.MarshalIndent(jsonTable, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal table %s: %v", table.Name, err)
+	}
+
+	filePath := filepath.Join(s.dataDir, s.filePrefix+table.Name+".json")
+	if err := ioutil.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write table %s to file: %v", table.Name, err)
 	}
 
 	return nil
@@ -517,7 +654,7 @@ func (s *JSONStorage) CreateTable(table *types.Table) error {
 	s.db.mu.Lock()
 	defer s.db.mu.Unlock()
 
-	if _, exists := s.db.Tables[table.Name]; exists {
+	if _, exists := s.catalog[table.Name]; exists {
 		return fmt.Errorf("table %s already exists", table.Name)
 	}
 
@@ -530,12 +667,18 @@ func (s *JSONStorage) CreateTable(table *types.Table) error {
 		columnNames[col.Name] = true
 	}
 
-	s.db.Tables[table.Name] = table
-
-	if err := s.saveTables(); err != nil {
+	if err := s.saveTable(table); err != nil {
 		return fmt.Errorf("failed to save tables: %v", err)
 	}
 
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+	s.catalog[table.Name] = filepath.Join(s.dataDir, s.filePrefix+table.Name+".json")
+	s.db.Tables[table.Name] = table
+	if evicted := s.cache.touch(table.Name); evicted != "" {
+		delete(s.db.Tables, evicted)
+	}
+
 	return nil
 }
 
@@ -543,15 +686,16 @@ func (s *JSONStorage) Insert(tableName string, values map[string]interface{}) er
 	s.db.mu.Lock()
 	defer s.db.mu.Unlock()
 
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+	table, err := s.existingTable(tableName)
+	if err != nil {
+		return err
 	}
 
 	// Validate column names
 	if err := s.validateColumnNames(table, values); err != nil {
 		return err
 	}
+	values = types.WithDefaults(table, values)
 
 	// Validate all required columns are present and check data types
 	row := make(types.Row)
@@ -561,41 +705,46 @@ func (s *JSONStorage) Insert(tableName string, values map[string]interface{}) er
 			return fmt.Errorf("missing required column %s", col.Name)
 		}
 		if exists {
-			if val == nil || val == "NULL" {
+			if val == nil {
 				if !col.Nullable {
 					return fmt.Errorf("NULL value not allowed for non-nullable column %s", col.Name)
 				}
-				// Set default value based on column type
-				if col.Type == "INT" {
-					row[col.Name] = 0
-				} else {
-					row[col.Name] = ""
-				}
+				row[col.Name] = nil
 			} else {
-				if err := s.validateDataType(val, col.Type); err != nil {
-					return fmt.Errorf("invalid data type for column %s: %v", col.Name, err)
+				if err := s.validateDataType(val, col); err != nil {
+					return fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
+				}
+				canonical, err := types.CanonicalValue(col.Type, val)
+				if err != nil {
+					return fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
 				}
-				row[col.Name] = val
+				row[col.Name] = canonical
 			}
 		}
 	}
+	if err := types.CheckPrimaryKey(table, table.Rows, row); err != nil {
+		return err
+	}
 
 	table.Rows = append(table.Rows, row)
 
-	if err := s.saveTables(); err != nil {
+	if err := s.saveTable(table); err != nil {
 		return fmt.Errorf("failed to save tables: %v", err)
 	}
 
 	return nil
 }
 
-func (s *JSONStorage) Select(tableName string, columns []string, where map[string]interface{}) ([]types.Row, error) {
+func (s *JSONStorage) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
 	s.db.mu.RLock()
 	defer s.db.mu.RUnlock()
 
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return nil, fmt.Errorf("table %s does not exist", tableName)
+	table, err := s.existingTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return nil, err
 	}
 
 	// Check for COUNT(*) aggregation
@@ -603,7 +752,7 @@ func (s *JSONStorage) Select(tableName string, columns []string, where map[strin
 		// Count matching rows
 		count := 0
 		for _, row := range table.Rows {
-			if s.matchesWhere(row, where) {
+			if where.Matches(row) {
 				count++
 			}
 		}
@@ -623,7 +772,7 @@ func (s *JSONStorage) Select(tableName string, columns []string, where map[strin
 
 	var result []types.Row
 	for _, row := range table.Rows {
-		if s.matchesWhere(row, where) {
+		if where.Matches(row) {
 			selectedRow := make(types.Row)
 			if len(columns) == 1 && columns[0] == "*" {
 				// Select all columns
@@ -643,40 +792,46 @@ func (s *JSONStorage) Select(tableName string, columns []string, where map[strin
 	return result, nil
 }
 
-func (s *JSONStorage) Update(tableName string, set map[string]interface{}, where map[string]interface{}) error {
+func (s *JSONStorage) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
 	s.db.mu.Lock()
 	defer s.db.mu.Unlock()
 
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+	table, err := s.existingTable(tableName)
+	if err != nil {
+		return 0, err
 	}
 
 	// Validate set columns
 	if err := s.validateColumnNames(table, set); err != nil {
-		return err
+		return 0, err
 	}
 
 	// Validate where columns
 	if err := s.validateWhereColumns(table, where); err != nil {
-		return err
+		return 0, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return 0, err
 	}
 
 	// Validate data types for set values
 	for colName, value := range set {
 		for _, col := range table.Columns {
 			if col.Name == colName {
-				if err := s.validateDataType(value, col.Type); err != nil {
-					return fmt.Errorf("invalid data type for column %s: %v", colName, err)
+				if err := s.validateDataType(value, col); err != nil {
+					return 0, fmt.Errorf("invalid data type for column %s: %w", colName, err)
 				}
 				break
 			}
 		}
 	}
+	if set, err = types.CanonicalValues(table, set); err != nil {
+		return 0, err
+	}
 
 	rowsAffected := 0
 	for i := range table.Rows {
-		if s.matchesWhere(table.Rows[i], where) {
+		if where.Matches(table.Rows[i]) {
 			for colName, value := range set {
 				table.Rows[i][colName] = value
 			}
@@ -684,108 +839,96 @@ func (s *JSONStorage) Update(tableName string, set map[string]interface{}, where
 		}
 	}
 
+	// Nothing to save if no row matched
 	if rowsAffected == 0 {
-		return fmt.Errorf("no rows matched the WHERE clause")
+		return 0, nil
 	}
 
-	if err := s.saveTables(); err != nil {
-		return fmt.Errorf("failed to save tables: %v", err)
+	if err := s.saveTable(table); err != nil {
+		return 0, fmt.Errorf("failed to save tables: %v", err)
 	}
 
-	return nil
+	return rowsAffected, nil
 }
 
-func (s *JSONStorage) Delete(tableName string, where map[string]interface{}) error {
+func (s *JSONStorage) Delete(tableName string, where *types.WhereExpr) (int, error) {
 	s.db.mu.Lock()
 	defer s.db.mu.Unlock()
 
-	table, exists := s.db.Tables[tableName]
-	if !exists {
-		return fmt.Errorf("table %s does not exist", tableName)
+	table, err := s.existingTable(tableName)
+	if err != nil {
+		return 0, err
 	}
 
 	// Validate where columns
 	if err := s.validateWhereColumns(table, where); err != nil {
-		return err
+		return 0, err
+	}
+	if where, err = types.CanonicalWhere(table, where); err != nil {
+		return 0, err
 	}
 
 	rowsAffected := 0
 	var newRows []types.Row
 	for _, row := range table.Rows {
-		if !s.matchesWhere(row, where) {
+		if !where.Matches(row) {
 			newRows = append(newRows, row)
 		} else {
 			rowsAffected++
 		}
 	}
 
+	// Nothing to save if no row matched
 	if rowsAffected == 0 {
-		return fmt.Errorf("no rows matched the WHERE clause")
+		return 0, nil
 	}
 
 	table.Rows = newRows
 
-	if err := s.saveTables(); err != nil {
-		return fmt.Errorf("failed to save tables: %v", err)
+	if err := s.saveTable(table); err != nil {
+		return 0, fmt.Errorf("failed to save tables: %v", err)
 	}
 
-	return nil
+	return rowsAffected, nil
 }
 
 func (s *JSONStorage) GetTable(tableName string) *types.Table {
 	s.db.mu.RLock()
 	defer s.db.mu.RUnlock()
-	return s.db.Tables[tableName]
+
+	table, err := s.table(tableName)
+	if err != nil {
+		types.GlobalLogger.Error("Failed to load table %s: %v", tableName, err)
+		return nil
+	}
+	return table
 }
 
+// Close releases the storage. Every write is already saved to its table
+// file, so there is nothing left to flush.
 func (s *JSONStorage) Close() error {
-	s.db.mu.Lock()
-	defer s.db.mu.Unlock()
-	return s.saveTables()
+	return nil
+}
+
+// ShowTables lists tables from the catalog without loading them
+// Capabilities implements Storage.Capabilities
+func (s *JSONStorage) Capabilities() types.Capabilities {
+	return types.Capabilities{Persistent: true, SupportsTransactions: true, SupportsAddColumn: true}
 }
 
 func (s *JSONStorage) ShowTables() ([]string, error) {
 	s.db.mu.RLock()
 	defer s.db.mu.RUnlock()
 
-	tables := make([]string, 0, len(s.db.Tables))
-	for tableName := range s.db.Tables {
+	tables := make([]string, 0, len(s.catalog))
+	for tableName := range s.catalog {
 		tables = append(tables, tableName)
 	}
 	return tables, nil
 }
 
-func (s *JSONStorage) validateDataType(value interface{}, columnType string) error {
-	if value == nil {
-		return nil // NULL values are allowed for any type
-	}
-
-	switch columnType {
-	case "INT":
-		switch v := value.(type) {
-		case int, int32, int64:
-			return nil
-		case float64:
-			if float64(int(v)) == v {
-				return nil
-			}
-		case string:
-			if _, err := strconv.Atoi(v); err == nil {
-				return nil
-			}
-		}
-		return fmt.Errorf("value %v is not an integer", value)
-	case "STRING", "TEXT":
-		switch value.(type) {
-		case string:
-			return nil
-		case int, int32, int64, float64:
-			// Convert numeric values to string
-			return nil
-		}
-		return fmt.Errorf("value %v is not a string", value)
-	}
-	return nil
+func (s *JSONStorage) validateDataType(value interface{}, col types.ColumnDefinition) error {
+	return types.CheckValueType(col.Name, col.Type, value, s.strict)
 }
 
 func (s *JSONStorage) validateColumns(table *types.Table, columns []string) error {
@@ -820,7 +963,7 @@ func (s *JSONStorage) validateColumnNames(table *types.Table, values map[string]
 	return nil
 }
 
-func (s *JSONStorage) validateWhereColumns(table *types.Table, where map[string]interface{}) error {
+func (s *JSONStorage) validateWhereColumns(table *types.Table, where *types.WhereExpr) error {
 	if where == nil {
 		return nil
 	}
@@ -830,7 +973,7 @@ func (s *JSONStorage) validateWhereColumns(table *types.Table, where map[string]
 		columnMap[col.Name] = true
 	}
 
-	for colName := range where {
+	for _, colName := range types.WhereColumns(where) {
 		if !columnMap[colName] {
 			return fmt.Errorf("invalid column name in WHERE clause: %s", colName)
 		}
@@ -838,55 +981,6 @@ func (s *JSONStorage) validateWhereColumns(table *types.Table, where map[string]
 	return nil
 }
 
-func (s *JSONStorage) matchesWhere(row types.Row, where map[string]interface{}) bool {
-	if where == nil {
-		return true
-	}
-
-	for col, val := range where {
-		rowVal, ok := row[col]
-		if !ok {
-			return false
-		}
-
-		// Special handling for numeric comparisons
-		switch v := val.(type) {
-		case float64:
-			switch rv := rowVal.(type) {
-			case int:
-				// Compare int to float64
-				if float64(rv) == v {
-					continue
-				}
-			case float64:
-				// Compare float64 to float64
-				if rv == v {
-					continue
-				}
-			}
-		case int:
-			switch rv := rowVal.(type) {
-			case int:
-				// Compare int to int
-				if rv == v {
-					continue
-				}
-			case float64:
-				// Compare float64 to int
-				if rv == float64(v) {
-					continue
-				}
-			}
-		}
-
-		// For non-numeric types or if numeric comparison didn't match
-		if rowVal != val {
-			return false
-		}
-	}
-	return true
-}
-
 // Helper function to evaluate WHERE conditions
 func evaluateWhere(row types.Row, where string) bool {
 	if where == "" {
@@ -944,6 +1038,9 @@ func evaluateSimpleCondition(row types.Row, condition string) bool {
 	case int:
 		rowNum = float64(v)
 		isNumeric = true
+	case int64:
+		rowNum = float64(v)
+		isNumeric = true
 	case float64:
 		rowNum = v
 		isNumeric = true
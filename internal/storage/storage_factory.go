@@ -33,6 +33,16 @@ type StorageConfig struct {
 	// FilePath is the path to the BTree storage file.
 	FilePath string
 
+	// PageSize is the BTree page size in bytes used when the file is created
+	// (default DefaultPageSize). Existing files keep the page size recorded
+	// in their header.
+	PageSize int
+
+	// PageCacheSize is the number of BTree pages kept in memory. Writes to
+	// cached pages reach the file when they are evicted or the storage is
+	// flushed or closed. 0 disables the cache and syncs every write.
+	PageCacheSize int
+
 	// DataDir is the directory for JSON and Parquet storage files.
 	DataDir string
 
@@ -47,6 +57,20 @@ type StorageConfig struct {
 	
 	// LogLevel controls the verbosity of logging.
 	LogLevel types.LogLevel
+
+	// RoutingHistorySize is the number of SELECT routing decisions a hybrid
+	// storage keeps for SHOW ROUTING HISTORY (default
+	// DefaultRoutingHistorySize).
+	RoutingHistorySize int
+
+	// Recovery controls the integrity pass run when the BTree file was not
+	// closed cleanly.
+	Recovery RecoveryOptions
+
+	// Strict rejects inserts and updates that would silently coerce a value
+	// to its column type (e.g. a number into a STRING column). The BTree
+	// backend never coerces, so it is strict regardless of this setting.
+	Strict bool
 }
 
 // NewStorage creates a new storage instance based on the provided configuration.
@@ -58,7 +82,9 @@ func NewStorage(config StorageConfig) (Storage, error) {
 	
 	switch config.Type {
 	case InMemoryStorageType:
-		return NewInMemoryStorage(), nil
+		memStorage := NewInMemoryStorage()
+		memStorage.SetStrict(config.Strict)
+		return memStorage, nil
 	case JSONStorageType:
 		if config.DataDir == "" {
 			// Default to the directory of FilePath if provided
@@ -73,12 +99,17 @@ func NewStorage(config StorageConfig) (Storage, error) {
 			config.FilePrefix = "db_" // Default prefix
 		}
 
-		return NewJSONStorage(config.DataDir, config.FilePrefix)
+		jsonStorage, err := NewJSONStorage(config.DataDir, config.FilePrefix)
+		if err != nil {
+			return nil, err
+		}
+		jsonStorage.SetStrict(config.Strict)
+		return jsonStorage, nil
 	case BTreeStorageType:
 		if config.FilePath == "" {
 			return nil, fmt.Errorf("file path is required for B-tree storage")
 		}
-		return NewBTreeStorage(config.FilePath)
+		return openBTreeStorage(config)
 	case ParquetStorageType:
 		if config.DataDir == "" {
 			return nil, fmt.Errorf("data directory is required for Parquet storage")
@@ -106,6 +137,21 @@ func NewStorage(config StorageConfig) (Storage, error) {
 	}
 }
 
+// openBTreeStorage opens the BTree file of config with its page cache
+func openBTreeStorage(config StorageConfig) (*BTreeStorage, error) {
+	s, err := OpenBTreeStorage(config.FilePath, config.PageSize, config.Recovery)
+	if err != nil {
+		return nil, err
+	}
+	if config.PageCacheSize > 0 {
+		if err := s.SetPageCacheSize(config.PageCacheSize); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
 // CreateHybridStorage creates a hybrid storage system with BTree for OLTP and Parquet for OLAP.
 // This provides a complete storage solution that automatically routes queries to the optimal
 // storage engine based on the query patterns. It also sets up background synchronization to
@@ -119,7 +165,7 @@ func CreateHybridStorage(config StorageConfig) (*HybridStorage, error) {
 	}
 
 	// Create BTree storage
-	bTreeStorage, err := NewBTreeStorage(config.FilePath)
+	bTreeStorage, err := openBTreeStorage(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create BTree storage: %w", err)
 	}
@@ -143,7 +189,8 @@ func CreateHybridStorage(config StorageConfig) (*HybridStorage, error) {
 
 	// Create hybrid storage
 	return &HybridStorage{
-		oltp: bTreeStorage,
-		olap: parquetStorage,
+		oltp:    bTreeStorage,
+		olap:    parquetStorage,
+		history: newRoutingHistory(config.RoutingHistorySize),
 	}, nil
 }
@@ -1,14 +1,29 @@
 package storage_test
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zakazai/ulin-db/internal/storage"
 	"github.com/zakazai/ulin-db/internal/types"
 )
 
+// rowsAffected returns a function that checks a write succeeded and
+// returns the number of rows it changed, as in rowsAffected(t)(s.Delete(...))
+func rowsAffected(t testing.TB) func(int, error) int {
+	return func(n int, err error) int {
+		t.Helper()
+		assert.NoError(t, err)
+		return n
+	}
+}
+
 func TestInMemoryStorage(t *testing.T) {
 	s := storage.NewInMemoryStorage()
 
@@ -42,28 +57,35 @@ func TestInMemoryStorage(t *testing.T) {
 	rows, err := s.Select("test", []string{"*"}, nil)
 	assert.NoError(t, err)
 	assert.Len(t, rows, 1)
-	assert.Equal(t, 1, rows[0]["id"])
+	assert.Equal(t, int64(1), rows[0]["id"])
 	assert.Equal(t, "test1", rows[0]["name"])
 
 	// Test Select with where
-	rows, err = s.Select("test", []string{"*"}, map[string]interface{}{"id": 1})
+	rows, err = s.Select("test", []string{"*"}, types.WhereAll(map[string]interface{}{"id": 1}))
 	assert.NoError(t, err)
 	assert.Len(t, rows, 1)
 
 	// Test Update
-	err = s.Update("test", map[string]interface{}{
+	affected, err := s.Update("test", map[string]interface{}{
 		"name": "test2",
-	}, map[string]interface{}{"id": 1})
+	}, types.WhereAll(map[string]interface{}{"id": 1}))
 	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
 
 	rows, err = s.Select("test", []string{"*"}, nil)
 	assert.NoError(t, err)
 	assert.Len(t, rows, 1)
 	assert.Equal(t, "test2", rows[0]["name"])
 
+	// Matching no row is not an error
+	affected, err = s.Update("test", map[string]interface{}{"name": "test3"}, types.WhereAll(map[string]interface{}{"id": 2}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, affected)
+
 	// Test Delete
-	err = s.Delete("test", map[string]interface{}{"id": 1})
+	affected, err = s.Delete("test", types.WhereAll(map[string]interface{}{"id": 1}))
 	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
 
 	rows, err = s.Select("test", []string{"*"}, nil)
 	assert.NoError(t, err)
@@ -110,22 +132,13 @@ func TestJSONStorage(t *testing.T) {
 	rows, err := s.Select("test", []string{"*"}, nil)
 	assert.NoError(t, err)
 	assert.Len(t, rows, 1)
-	// Use type assertion to check the value type
-	idValue := rows[0]["id"]
-	switch v := idValue.(type) {
-	case int:
-		assert.Equal(t, 1, v)
-	case float64:
-		assert.Equal(t, float64(1), v)
-	default:
-		assert.Fail(t, "unexpected type for id")
-	}
+	assert.Equal(t, int64(1), rows[0]["id"])
 	assert.Equal(t, "test1", rows[0]["name"])
 
 	// Test Update
-	err = s.Update("test", map[string]interface{}{
+	_, err = s.Update("test", map[string]interface{}{
 		"name": "test2",
-	}, map[string]interface{}{"id": 1})
+	}, types.WhereAll(map[string]interface{}{"id": 1}))
 	assert.NoError(t, err)
 
 	// Close storage again
@@ -143,7 +156,7 @@ func TestJSONStorage(t *testing.T) {
 	assert.Equal(t, "test2", rows[0]["name"])
 
 	// Test Delete
-	err = s.Delete("test", map[string]interface{}{"id": 1})
+	_, err = s.Delete("test", types.WhereAll(map[string]interface{}{"id": 1}))
 	assert.NoError(t, err)
 
 	// Close storage
@@ -168,11 +181,11 @@ func TestStorageEdgeCases(t *testing.T) {
 	assert.Error(t, err)
 
 	// Test Update non-existent table
-	err = s.Update("nonexistent", map[string]interface{}{}, nil)
+	_, err = s.Update("nonexistent", map[string]interface{}{}, nil)
 	assert.Error(t, err)
 
 	// Test Delete from non-existent table
-	err = s.Delete("nonexistent", nil)
+	_, err = s.Delete("nonexistent", nil)
 	assert.Error(t, err)
 
 	// Test Insert with missing columns
@@ -207,18 +220,77 @@ func TestStorageEdgeCases(t *testing.T) {
 	assert.Contains(t, err.Error(), "invalid column name: nonexistent")
 
 	// Test Update with non-existent column
-	err = s.Update("test", map[string]interface{}{
+	_, err = s.Update("test", map[string]interface{}{
 		"nonexistent": "value",
 	}, nil)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid column name: nonexistent")
 
 	// Test complex where conditions
-	rows, err = s.Select("test", []string{"*"}, map[string]interface{}{"id": 1, "name": "test"})
+	rows, err = s.Select("test", []string{"*"}, types.WhereAll(map[string]interface{}{"id": 1, "name": "test"}))
 	assert.NoError(t, err)
 	assert.Len(t, rows, 1) // Should find the row since we set name = "test"
 }
 
+func TestStrictMode(t *testing.T) {
+	jsonDir := t.TempDir()
+	jsonStorage, err := storage.NewJSONStorage(jsonDir, "strict_")
+	assert.NoError(t, err)
+
+	backends := map[string]interface {
+		storage.Storage
+		SetStrict(bool)
+	}{
+		"memory": storage.NewInMemoryStorage(),
+		"json":   jsonStorage,
+	}
+
+	for name, s := range backends {
+		t.Run(name, func(t *testing.T) {
+			err := s.CreateTable(&types.Table{
+				Name: "addresses",
+				Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT", Nullable: true},
+					{Name: "zip", Type: "STRING", Nullable: true},
+				},
+			})
+			assert.NoError(t, err)
+
+			// Lenient by default: a numeric zip code is silently accepted,
+			// which is how leading zeros get lost
+			err = s.Insert("addresses", map[string]interface{}{"id": 1, "zip": 2134})
+			assert.NoError(t, err)
+			err = s.Insert("addresses", map[string]interface{}{"id": "2", "zip": "02134"})
+			assert.NoError(t, err)
+
+			s.SetStrict(true)
+
+			err = s.Insert("addresses", map[string]interface{}{"id": 3, "zip": float64(2134)})
+			var coercion *types.CoercionError
+			if assert.ErrorAs(t, err, &coercion) {
+				assert.Equal(t, "zip", coercion.Column)
+				assert.Equal(t, "STRING", coercion.ExpectedType)
+				assert.Equal(t, float64(2134), coercion.Value)
+			}
+
+			err = s.Insert("addresses", map[string]interface{}{"id": "4", "zip": "02134"})
+			if assert.ErrorAs(t, err, &coercion) {
+				assert.Equal(t, "id", coercion.Column)
+				assert.Equal(t, "INT", coercion.ExpectedType)
+			}
+
+			_, err = s.Update("addresses", map[string]interface{}{"zip": 2134}, types.WhereAll(map[string]interface{}{"id": 1}))
+			assert.ErrorAs(t, err, &coercion)
+
+			// Values of the right type are unaffected
+			err = s.Insert("addresses", map[string]interface{}{"id": float64(5), "zip": "02134"})
+			assert.NoError(t, err)
+			_, err = s.Update("addresses", map[string]interface{}{"zip": "02135"}, types.WhereAll(map[string]interface{}{"id": 1}))
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestCreateTable(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir, err := os.MkdirTemp("", "testdb_create")
@@ -283,7 +355,7 @@ func TestInsert(t *testing.T) {
 	rows, err := s.Select("test_table", []string{"*"}, nil)
 	assert.NoError(t, err)
 	assert.Len(t, rows, 1)
-	assert.Equal(t, 1, rows[0]["id"])
+	assert.Equal(t, int64(1), rows[0]["id"])
 	assert.Equal(t, "test", rows[0]["name"])
 }
 
@@ -320,12 +392,13 @@ func TestUpdate(t *testing.T) {
 	set := map[string]interface{}{
 		"name": "updated",
 	}
-	where := map[string]interface{}{
+	where := types.WhereAll(map[string]interface{}{
 		"id": 1,
-	}
+	})
 
-	err = s.Update("test_table", set, where)
+	affected, err := s.Update("test_table", set, where)
 	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
 
 	// Verify update
 	rows, err := s.Select("test_table", []string{"*"}, nil)
@@ -364,12 +437,13 @@ func TestDelete(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Delete the row
-	where := map[string]interface{}{
+	where := types.WhereAll(map[string]interface{}{
 		"id": 1,
-	}
+	})
 
-	err = s.Delete("test_table", where)
+	affected, err := s.Delete("test_table", where)
 	assert.NoError(t, err)
+	assert.Equal(t, 1, affected)
 
 	// Verify deletion
 	rows, err := s.Select("test_table", []string{"*"}, nil)
@@ -377,6 +451,66 @@ func TestDelete(t *testing.T) {
 	assert.Len(t, rows, 0)
 }
 
+func TestBTreeUpdateDelete(t *testing.T) {
+	filePath := t.TempDir() + "/rows.btree"
+	s, err := storage.NewBTreeStorage(filePath)
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "items",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", Nullable: false},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	}))
+	for i, name := range []string{"first", "second", "third"} {
+		assert.NoError(t, s.Insert("items", map[string]interface{}{"id": i + 1, "name": name}))
+	}
+
+	names := func(s *storage.BTreeStorage) map[string]string {
+		rows, err := s.Select("items", []string{"*"}, nil)
+		assert.NoError(t, err)
+		byID := make(map[string]string)
+		for _, row := range rows {
+			byID[fmt.Sprint(row["id"])] = row["name"].(string)
+		}
+		return byID
+	}
+
+	// A float64 WHERE value matches the INT id it equals
+	assert.Equal(t, 1, rowsAffected(t)(s.Update("items", map[string]interface{}{"name": "updated"}, types.WhereAll(map[string]interface{}{"id": float64(1)}))))
+	assert.Equal(t, map[string]string{"1": "updated", "2": "second", "3": "third"}, names(s))
+
+	assert.Equal(t, 1, rowsAffected(t)(s.Delete("items", types.WhereAll(map[string]interface{}{"id": float64(2)}))))
+	assert.Equal(t, map[string]string{"1": "updated", "3": "third"}, names(s))
+
+	// Matching no row changes nothing and is not an error
+	assert.Equal(t, 0, rowsAffected(t)(s.Update("items", map[string]interface{}{"name": "x"}, types.WhereAll(map[string]interface{}{"id": float64(2)}))))
+	assert.Equal(t, 0, rowsAffected(t)(s.Delete("items", types.WhereAll(map[string]interface{}{"id": float64(2)}))))
+	assert.Equal(t, map[string]string{"1": "updated", "3": "third"}, names(s))
+
+	// Rejected statements leave the rows as they were
+	_, err = s.Update("items", map[string]interface{}{"id": "one"}, nil)
+	assert.EqualError(t, err, "invalid data type for column id: value one is not an integer")
+	_, err = s.Update("items", map[string]interface{}{"colour": "red"}, nil)
+	assert.EqualError(t, err, "invalid column name: colour")
+	_, err = s.Delete("items", types.WhereAll(map[string]interface{}{"colour": "red"}))
+	assert.EqualError(t, err, "invalid column name in WHERE clause: colour")
+	assert.Equal(t, map[string]string{"1": "updated", "3": "third"}, names(s))
+
+	// The rewritten rows are on disk
+	assert.NoError(t, s.Close())
+	reopened, err := storage.NewBTreeStorage(filePath)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, map[string]string{"1": "updated", "3": "third"}, names(reopened))
+
+	// Rows read back from disk match WHERE values of any numeric type
+	assert.Equal(t, 1, rowsAffected(t)(reopened.Update("items", map[string]interface{}{"name": "three"}, types.WhereAll(map[string]interface{}{"id": int64(3)}))))
+	assert.Equal(t, 1, rowsAffected(t)(reopened.Update("items", map[string]interface{}{"name": "one"}, types.WhereAll(map[string]interface{}{"id": 1}))))
+	assert.Equal(t, map[string]string{"1": "one", "3": "three"}, names(reopened))
+}
+
 func TestMultipleInserts(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir, err := os.MkdirTemp("", "testdb_multiple_inserts")
@@ -481,10 +615,530 @@ func TestCountAggregation(t *testing.T) {
 	assert.Equal(t, 5, countRows[0]["count"], "COUNT(*) should return 5 for total row count")
 
 	// Test COUNT(*) with WHERE clause - should count matching rows
-	countWithWhere, err := s.Select("test_count", []string{"COUNT(*)"}, map[string]interface{}{
+	countWithWhere, err := s.Select("test_count", []string{"COUNT(*)"}, types.WhereAll(map[string]interface{}{
 		"category": "A",
-	})
+	}))
 	assert.NoError(t, err)
 	assert.Len(t, countWithWhere, 1)
 	assert.Equal(t, 3, countWithWhere[0]["count"], "COUNT(*) with WHERE should return 3 for category A")
 }
+
+func TestComparisonOperators(t *testing.T) {
+	s := storage.NewInMemoryStorage()
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "people",
+		Columns: []types.ColumnDefinition{
+			{Name: "name", Type: "STRING"},
+			{Name: "age", Type: "INT", Nullable: true},
+		},
+	}))
+	for _, row := range []map[string]interface{}{
+		{"name": "ann", "age": 25},
+		{"name": "bob", "age": 30},
+		{"name": "cy", "age": 35},
+		{"name": "dee"},
+	} {
+		assert.NoError(t, s.Insert("people", row))
+	}
+
+	names := func(where *types.WhereExpr) []string {
+		rows, err := s.Select("people", []string{"name"}, where)
+		assert.NoError(t, err)
+		var names []string
+		for _, row := range rows {
+			names = append(names, row["name"].(string))
+		}
+		return names
+	}
+
+	tests := []struct {
+		op    string
+		value interface{}
+		want  []string
+	}{
+		{">", float64(30), []string{"cy"}},
+		{">=", float64(30), []string{"bob", "cy"}},
+		{"<", float64(30), []string{"ann"}},
+		{"<=", float64(30), []string{"ann", "bob"}},
+		{"!=", float64(30), []string{"ann", "cy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			where := types.WhereAll(map[string]interface{}{"age": types.Comparison{Operator: tt.op, Value: tt.value}})
+			assert.Equal(t, tt.want, names(where))
+		})
+	}
+
+	// Strings compare lexically, and plain values still mean equality
+	assert.Equal(t, []string{"cy", "dee"}, names(types.WhereAll(map[string]interface{}{"name": types.Comparison{Operator: ">", Value: "bob"}})))
+	assert.Equal(t, []string{"cy"}, names(types.WhereAll(map[string]interface{}{
+		"name": types.Comparison{Operator: ">", Value: "bob"},
+		"age":  float64(35),
+	})))
+
+	// Updates and deletes honor the operator too
+	assert.Equal(t, 1, rowsAffected(t)(s.Update("people", map[string]interface{}{"age": 40}, types.WhereAll(map[string]interface{}{"age": types.Comparison{Operator: ">=", Value: float64(35)}}))))
+	assert.Equal(t, []string{"cy"}, names(types.WhereAll(map[string]interface{}{"age": float64(40)})))
+	assert.Equal(t, 2, rowsAffected(t)(s.Delete("people", types.WhereAll(map[string]interface{}{"age": types.Comparison{Operator: "<", Value: float64(40)}}))))
+	assert.Equal(t, []string{"cy", "dee"}, names(nil))
+}
+
+func TestDateColumns(t *testing.T) {
+	jsonStore, err := storage.NewJSONStorage(t.TempDir(), "dates")
+	assert.NoError(t, err)
+	btree, err := storage.NewBTreeStorage(filepath.Join(t.TempDir(), "dates.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+
+	for name, s := range map[string]storage.Storage{"InMemory": storage.NewInMemoryStorage(), "JSON": jsonStore, "BTree": btree} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.CreateTable(&types.Table{
+				Name: "events",
+				Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT"},
+					{Name: "occurred", Type: "DATE", Nullable: true},
+					{Name: "logged", Type: "TIMESTAMP", Nullable: true},
+				},
+			}))
+			for _, row := range []map[string]interface{}{
+				{"id": 1, "occurred": "2023-12-31", "logged": "2023-12-31 23:59:59"},
+				{"id": 2, "occurred": "2024-01-15", "logged": "2024-01-15T10:30:00+02:00"},
+				{"id": 3, "occurred": "2024-02-01", "logged": time.Date(2024, 2, 1, 9, 0, 0, 500, time.UTC)},
+				{"id": 4},
+			} {
+				assert.NoError(t, s.Insert("events", row))
+			}
+
+			// Values are stored in canonical form, timestamps in UTC
+			rows, err := s.Select("events", []string{"occurred", "logged"}, types.WhereAll(map[string]interface{}{"id": float64(2)}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"occurred": "2024-01-15", "logged": "2024-01-15T08:30:00Z"}}, rows)
+			rows, err = s.Select("events", []string{"logged"}, types.WhereAll(map[string]interface{}{"id": float64(3)}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"logged": "2024-02-01T09:00:00Z"}}, rows)
+
+			ids := func(where *types.WhereExpr) []string {
+				rows, err := s.Select("events", []string{"id"}, where)
+				assert.NoError(t, err)
+				var ids []string
+				for _, row := range rows {
+					ids = append(ids, fmt.Sprint(row["id"]))
+				}
+				sort.Strings(ids)
+				return ids
+			}
+
+			// Comparisons are chronological, and TIMESTAMP values given as
+			// dates or in another zone are converted first
+			assert.Equal(t, []string{"2", "3"}, ids(types.WhereAll(map[string]interface{}{"occurred": types.Comparison{Operator: ">", Value: "2024-01-01"}})))
+			assert.Equal(t, []string{"1", "2"}, ids(types.WhereAll(map[string]interface{}{"occurred": types.Comparison{Operator: "BETWEEN", Value: []interface{}{"2023-12-31", "2024-01-31"}}})))
+			assert.Equal(t, []string{"2", "3"}, ids(types.WhereAll(map[string]interface{}{"logged": types.Comparison{Operator: ">=", Value: "2024-01-01"}})))
+			assert.Equal(t, []string{"2"}, ids(types.WhereAll(map[string]interface{}{"logged": "2024-01-15T03:30:00-05:00"})))
+			assert.Equal(t, []string{"1", "3"}, ids(types.Not(types.WhereAll(map[string]interface{}{"occurred": types.Comparison{Operator: "IN", Value: []interface{}{"2024-01-15"}}}))))
+
+			// Invalid dates are rejected on write and in WHERE clauses
+			err = s.Insert("events", map[string]interface{}{"id": 5, "occurred": "2024-02-30"})
+			assert.EqualError(t, err, "invalid data type for column occurred: value 2024-02-30 is not a date (expected YYYY-MM-DD)")
+			err = s.Insert("events", map[string]interface{}{"id": 5, "logged": "yesterday"})
+			assert.EqualError(t, err, "invalid data type for column logged: value yesterday is not a timestamp (expected YYYY-MM-DD HH:MM:SS or RFC 3339)")
+			_, err = s.Update("events", map[string]interface{}{"occurred": float64(20240101)}, nil)
+			assert.EqualError(t, err, "invalid data type for column occurred: value 2.0240101e+07 is not a date (expected YYYY-MM-DD)")
+			_, err = s.Select("events", []string{"id"}, types.WhereAll(map[string]interface{}{"occurred": types.Comparison{Operator: "<", Value: "01/02/2024"}}))
+			assert.EqualError(t, err, "invalid value for column occurred in WHERE clause: value 01/02/2024 is not a date (expected YYYY-MM-DD)")
+
+			assert.Equal(t, 1, rowsAffected(t)(s.Update("events", map[string]interface{}{"occurred": "2024-03-01"}, types.WhereAll(map[string]interface{}{"occurred": "2024-02-01"}))))
+			assert.Equal(t, 2, rowsAffected(t)(s.Delete("events", types.WhereAll(map[string]interface{}{"occurred": types.Comparison{Operator: "<", Value: "2024-02-01"}}))))
+			assert.Equal(t, []string{"3", "4"}, ids(nil))
+		})
+	}
+}
+
+func TestFloatAndBooleanColumns(t *testing.T) {
+	jsonStore, err := storage.NewJSONStorage(t.TempDir(), "readings")
+	assert.NoError(t, err)
+	btree, err := storage.NewBTreeStorage(filepath.Join(t.TempDir(), "readings.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+
+	for name, s := range map[string]storage.Storage{"InMemory": storage.NewInMemoryStorage(), "JSON": jsonStore, "BTree": btree} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.CreateTable(&types.Table{
+				Name: "readings",
+				Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT"},
+					{Name: "value", Type: "FLOAT", Nullable: true},
+					{Name: "valid", Type: "BOOLEAN", Nullable: true},
+				},
+			}))
+			for _, row := range []map[string]interface{}{
+				{"id": 1, "value": 19.99, "valid": true},
+				{"id": 2, "value": 3, "valid": false},
+				{"id": 3, "value": -0.5, "valid": true},
+				{"id": 4},
+			} {
+				assert.NoError(t, s.Insert("readings", row))
+			}
+
+			// Integers given for a FLOAT column are stored as float64
+			rows, err := s.Select("readings", []string{"value", "valid"}, types.WhereAll(map[string]interface{}{"id": int64(2)}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"value": float64(3), "valid": false}}, rows)
+
+			ids := func(where *types.WhereExpr) []string {
+				rows, err := s.Select("readings", []string{"id"}, where)
+				assert.NoError(t, err)
+				var ids []string
+				for _, row := range rows {
+					ids = append(ids, fmt.Sprint(row["id"]))
+				}
+				sort.Strings(ids)
+				return ids
+			}
+
+			assert.Equal(t, []string{"1"}, ids(types.WhereAll(map[string]interface{}{"value": 19.99})))
+			assert.Equal(t, []string{"1", "2"}, ids(types.WhereAll(map[string]interface{}{"value": types.Comparison{Operator: ">", Value: int64(0)}})))
+			assert.Equal(t, []string{"2", "3"}, ids(types.WhereAll(map[string]interface{}{"value": types.Comparison{Operator: "BETWEEN", Value: []interface{}{-1.0, int64(3)}}})))
+			assert.Equal(t, []string{"1", "3"}, ids(types.WhereAll(map[string]interface{}{"valid": true})))
+			assert.Equal(t, []string{"2"}, ids(types.WhereAll(map[string]interface{}{"valid": false})))
+
+			// Values of another type are rejected
+			err = s.Insert("readings", map[string]interface{}{"id": 5, "value": "warm"})
+			assert.EqualError(t, err, "invalid data type for column value: value warm is not a number")
+			err = s.Insert("readings", map[string]interface{}{"id": 5, "valid": "yes"})
+			assert.EqualError(t, err, "invalid data type for column valid: value yes is not a boolean")
+			_, err = s.Update("readings", map[string]interface{}{"valid": int64(1)}, nil)
+			assert.EqualError(t, err, "invalid data type for column valid: value 1 is not a boolean")
+
+			assert.Equal(t, 2, rowsAffected(t)(s.Update("readings", map[string]interface{}{"value": 0.25}, types.WhereAll(map[string]interface{}{"valid": true}))))
+			assert.Equal(t, []string{"1", "3"}, ids(types.WhereAll(map[string]interface{}{"value": 0.25})))
+		})
+	}
+}
+
+func TestNullValues(t *testing.T) {
+	jsonDir := t.TempDir()
+	btreePath := filepath.Join(t.TempDir(), "nulls.db")
+	open := map[string]func() storage.Storage{
+		"JSON": func() storage.Storage {
+			s, err := storage.NewJSONStorage(jsonDir, "nulls")
+			assert.NoError(t, err)
+			return s
+		},
+		"BTree": func() storage.Storage {
+			s, err := storage.NewBTreeStorage(btreePath)
+			assert.NoError(t, err)
+			return s
+		},
+	}
+	inMemory := storage.NewInMemoryStorage()
+	open["InMemory"] = func() storage.Storage { return inMemory }
+
+	for name, open := range open {
+		t.Run(name, func(t *testing.T) {
+			s := open()
+			assert.NoError(t, s.CreateTable(&types.Table{
+				Name: "people",
+				Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT"},
+					{Name: "email", Type: "STRING", Nullable: true},
+					{Name: "age", Type: "INT", Nullable: true},
+				},
+			}))
+			assert.NoError(t, s.Insert("people", map[string]interface{}{"id": 1, "email": nil, "age": 30}))
+			assert.NoError(t, s.Insert("people", map[string]interface{}{"id": 2, "email": "NULL", "age": nil}))
+			assert.NoError(t, s.Insert("people", map[string]interface{}{"id": 3}))
+
+			if name != "InMemory" {
+				assert.NoError(t, s.Close())
+				s = open()
+				defer s.Close()
+			}
+
+			// NULL is kept as nil rather than replaced by a zero value, and
+			// the string 'NULL' is a string
+			rows, err := s.Select("people", []string{"email", "age"}, types.WhereAll(map[string]interface{}{"id": 1}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"email": nil, "age": int64(30)}}, rows)
+			rows, err = s.Select("people", []string{"email"}, types.WhereAll(map[string]interface{}{"id": 2}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"email": "NULL"}}, rows)
+
+			ids := func(where *types.WhereExpr) []string {
+				rows, err := s.Select("people", []string{"id"}, where)
+				assert.NoError(t, err)
+				var ids []string
+				for _, row := range rows {
+					ids = append(ids, fmt.Sprint(row["id"]))
+				}
+				sort.Strings(ids)
+				return ids
+			}
+
+			// A column a row omits is NULL too, and only IS [NOT] NULL
+			// matches NULL
+			isNull := types.Comparison{Operator: "IS NULL"}
+			assert.Equal(t, []string{"1", "3"}, ids(types.WhereAll(map[string]interface{}{"email": isNull})))
+			assert.Equal(t, []string{"2", "3"}, ids(types.WhereAll(map[string]interface{}{"age": isNull})))
+			assert.Equal(t, []string{"1"}, ids(types.WhereAll(map[string]interface{}{"age": types.Comparison{Operator: "IS NOT NULL"}})))
+			assert.Equal(t, []string{"2"}, ids(types.Not(types.WhereAll(map[string]interface{}{"email": isNull}))))
+			assert.Equal(t, []string{"1"}, ids(types.Not(types.WhereAll(map[string]interface{}{"age": types.Comparison{Operator: "<", Value: int64(18)}}))))
+
+			assert.Equal(t, 2, rowsAffected(t)(s.Update("people", map[string]interface{}{"age": 0}, types.WhereAll(map[string]interface{}{"age": isNull}))))
+			assert.Equal(t, 1, rowsAffected(t)(s.Delete("people", types.WhereAll(map[string]interface{}{"email": types.Comparison{Operator: "IS NOT NULL"}}))))
+			assert.Equal(t, []string{"1", "3"}, ids(types.WhereAll(map[string]interface{}{"age": types.Comparison{Operator: "IS NOT NULL"}})))
+		})
+	}
+}
+
+func TestColumnValueTypes(t *testing.T) {
+	jsonDir := t.TempDir()
+	btreePath := filepath.Join(t.TempDir(), "types.db")
+	open := map[string]func() storage.Storage{
+		"JSON": func() storage.Storage {
+			s, err := storage.NewJSONStorage(jsonDir, "types")
+			assert.NoError(t, err)
+			return s
+		},
+		"BTree": func() storage.Storage {
+			s, err := storage.NewBTreeStorage(btreePath)
+			assert.NoError(t, err)
+			return s
+		},
+	}
+	inMemory := storage.NewInMemoryStorage()
+	open["InMemory"] = func() storage.Storage { return inMemory }
+
+	// INT values are int64, FLOAT values float64 and STRING values strings
+	// whatever Go type they were inserted as, including after a round trip
+	// through the disk that keeps integers beyond 2^53 and fractions exact
+	want := []types.Row{
+		{"id": int64(1), "big": int64(9007199254740993), "ratio": 3.14, "label": "7"},
+		{"id": int64(2), "big": int64(5), "ratio": float64(2), "label": "2.5"},
+	}
+	for name, open := range open {
+		t.Run(name, func(t *testing.T) {
+			s := open()
+			assert.NoError(t, s.CreateTable(&types.Table{
+				Name: "nums",
+				Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT"},
+					{Name: "big", Type: "INT", Nullable: true},
+					{Name: "ratio", Type: "FLOAT", Nullable: true},
+					{Name: "label", Type: "STRING", Nullable: true},
+				},
+			}))
+			assert.NoError(t, s.Insert("nums", map[string]interface{}{"id": 1, "big": int64(9007199254740993), "ratio": 3.14, "label": 7}))
+			assert.NoError(t, s.Insert("nums", map[string]interface{}{"id": float64(2), "big": int32(5), "ratio": 2, "label": 2.5}))
+
+			// A fraction is rejected by an INT column rather than truncated
+			err := s.Insert("nums", map[string]interface{}{"id": 3, "big": 3.14})
+			assert.EqualError(t, err, "invalid data type for column big: value 3.14 is not an integer")
+
+			rows, err := s.Select("nums", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, want, rows)
+
+			// WHERE values compare as the stored values
+			rows, err = s.Select("nums", []string{"id"}, types.WhereAll(map[string]interface{}{"label": float64(7)}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"id": int64(1)}}, rows)
+			rows, err = s.Select("nums", []string{"id"}, types.WhereAll(map[string]interface{}{"ratio": types.Comparison{Operator: ">", Value: int64(3)}}))
+			assert.NoError(t, err)
+			assert.Equal(t, []types.Row{{"id": int64(1)}}, rows)
+
+			if name != "InMemory" {
+				assert.NoError(t, s.Close())
+				s = open()
+				defer s.Close()
+			}
+			rows, err = s.Select("nums", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, want, rows)
+		})
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	jsonStore, err := storage.NewJSONStorage(t.TempDir(), "pk")
+	assert.NoError(t, err)
+
+	for name, s := range map[string]storage.Storage{"InMemory": storage.NewInMemoryStorage(), "JSON": jsonStore} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.CreateTable(&types.Table{
+				Name: "users",
+				Columns: []types.ColumnDefinition{
+					{Name: "id", Type: "INT", PrimaryKey: true},
+					{Name: "name", Type: "STRING", Nullable: true},
+				},
+			}))
+			assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 1, "name": "Ann"}))
+			assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 2, "name": "Ann"}))
+
+			// The same value as a float64
+			err := s.Insert("users", map[string]interface{}{"id": float64(1), "name": "Bob"})
+			assert.EqualError(t, err, "duplicate primary key id = 1 in table users")
+			err = s.Insert("users", map[string]interface{}{"name": "Bob"})
+			assert.EqualError(t, err, "missing required column id")
+
+			rows, err := s.Select("users", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, rows, 2)
+			assert.Equal(t, "id", s.GetTable("users").PrimaryKey())
+		})
+	}
+
+	// A batch is rejected whole if it repeats a key
+	s := storage.NewInMemoryStorage()
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name:    "users",
+		Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", PrimaryKey: true}},
+	}))
+	err = s.InsertRows("users", []map[string]interface{}{{"id": 1}, {"id": 2}, {"id": float64(1)}})
+	assert.EqualError(t, err, "row 3: duplicate primary key id = 1 in table users")
+	rows, err := s.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rows)
+}
+
+func TestInsertRows(t *testing.T) {
+	btree, err := storage.NewBTreeStorage(t.TempDir() + "/rows.btree")
+	assert.NoError(t, err)
+	defer btree.Close()
+	jsonStore, err := storage.NewJSONStorage(t.TempDir(), "rows")
+	assert.NoError(t, err)
+
+	table := &types.Table{
+		Name: "items",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT"},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	}
+	rows := func(ids ...int) []map[string]interface{} {
+		var rows []map[string]interface{}
+		for _, id := range ids {
+			rows = append(rows, map[string]interface{}{"id": id, "name": fmt.Sprintf("item%d", id)})
+		}
+		return rows
+	}
+
+	for name, s := range map[string]types.Storage{"InMemory": storage.NewInMemoryStorage(), "BTree": btree} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.CreateTable(table))
+			assert.NoError(t, types.InsertRows(s, "items", rows(1, 2, 3, 4, 5)))
+			selected, err := s.Select("items", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, selected, 5)
+
+			// A row that fails validation inserts none of them
+			bad := append(rows(6, 7), map[string]interface{}{"name": "no id"})
+			assert.EqualError(t, types.InsertRows(s, "items", bad), "row 3: missing required column id")
+			selected, err = s.Select("items", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, selected, 5)
+		})
+	}
+
+	// Storages without batch inserts stop at the failing row
+	assert.NoError(t, jsonStore.CreateTable(table))
+	bad := append(rows(1, 2), map[string]interface{}{"name": "no id"})
+	assert.EqualError(t, types.InsertRows(jsonStore, "items", bad), "row 3: missing required column id (2 rows inserted)")
+}
+
+func TestBTreeFileHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := tmpDir + "/pages.btree"
+
+	// Create with 16KB pages
+	s, err := storage.NewStorage(storage.StorageConfig{
+		Type:     storage.BTreeStorageType,
+		FilePath: filePath,
+		PageSize: 16384,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 16384, s.(*storage.BTreeStorage).PageSize())
+
+	err = s.CreateTable(&types.Table{
+		Name: "items",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", Nullable: false},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, s.Insert("items", map[string]interface{}{"id": i, "name": fmt.Sprintf("item%d", i)}))
+	}
+	assert.NoError(t, s.Close())
+
+	// Reopen with the default page size: the header value wins
+	reopened, err := storage.NewBTreeStorage(filePath)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, 16384, reopened.PageSize())
+
+	assert.NoError(t, reopened.Insert("items", map[string]interface{}{"id": 20, "name": "item20"}))
+	rows, err := reopened.Select("items", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 21)
+	rows, err = reopened.Select("items", []string{"name"}, types.WhereAll(map[string]interface{}{"id": float64(7)}))
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"name": "item7"}}, rows)
+
+	// Garbage file
+	garbagePath := tmpDir + "/garbage.btree"
+	assert.NoError(t, os.WriteFile(garbagePath, []byte("this is definitely not a database file"), 0644))
+	_, err = storage.NewBTreeStorage(garbagePath)
+	assert.EqualError(t, err, garbagePath+" is not a ulindb file")
+
+	// Valid magic but a newer format version
+	header, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	header[11] = 99
+	futurePath := tmpDir + "/future.btree"
+	assert.NoError(t, os.WriteFile(futurePath, header, 0644))
+	_, err = storage.NewBTreeStorage(futurePath)
+	assert.EqualError(t, err, futurePath+" has unsupported format version 99 (supported: 2)")
+
+	// Invalid configured page size
+	_, err = storage.NewBTreeStorageWithPageSize(tmpDir+"/bad.btree", 3000)
+	assert.Error(t, err)
+}
+
+// captureStdout returns what fn prints to stdout, directly or through
+// types.GlobalLogger set to level
+func captureStdout(t *testing.T, level types.LogLevel, fn func()) string {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	logger, stdout := types.GlobalLogger, os.Stdout
+	os.Stdout = w
+	types.GlobalLogger = types.InitLogger(level, w)
+	defer func() { types.GlobalLogger, os.Stdout = logger, stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestStorageLogsThroughLogger(t *testing.T) {
+	insert := func() {
+		s, err := storage.NewBTreeStorage(filepath.Join(t.TempDir(), "log.db"))
+		assert.NoError(t, err)
+		defer s.Close()
+		assert.NoError(t, s.CreateTable(&types.Table{
+			Name:    "users",
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}, {Name: "name", Type: "STRING"}},
+		}))
+		assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 1, "name": "Ann"}))
+		_, err = s.Select("users", []string{"*"}, nil)
+		assert.NoError(t, err)
+	}
+
+	assert.NotContains(t, captureStdout(t, types.LogLevelWarning, insert), "DEBUG:")
+	assert.Contains(t, captureStdout(t, types.LogLevelDebug, insert), "DEBUG:")
+}
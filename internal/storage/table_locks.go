@@ -0,0 +1,46 @@
+package storage
+
+import "sync"
+
+// tableLocks is a registry of per-table read/write locks, so that a long
+// scan of one table never blocks writers of another.
+//
+// Storages that use it split locking in two levels:
+//   - a catalog lock (the storage's own mutex), held only briefly to look
+//     up or change the set of tables (CreateTable, DropTable, GetTable,
+//     ShowTables)
+//   - one lock per table, held for the duration of a row operation
+//
+// Lock ordering, which every operation must follow to stay deadlock free:
+//  1. The catalog lock is never held while waiting for a table lock;
+//     operations look the table up, release the catalog lock, then lock
+//     the table.
+//  2. An operation that touches several tables (INSERT ... SELECT, joins,
+//     foreign key checks) locks them in ascending name order, taking the
+//     write lock for every table it modifies and the read lock for the
+//     rest, and never locks a table it already holds.
+//  3. Locks below the table level (such as BTreeStorage's page lock) are
+//     taken last and never held while calling back into user code.
+type tableLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+func newTableLocks() *tableLocks {
+	return &tableLocks{locks: make(map[string]*sync.RWMutex)}
+}
+
+// get returns the lock of a table, creating it on first use. Locks are
+// kept for the lifetime of the storage, so a table that is dropped and
+// created again keeps the lock its earlier operations may still hold.
+func (l *tableLocks) get(tableName string) *sync.RWMutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[tableName]
+	if !ok {
+		lock = &sync.RWMutex{}
+		l.locks[tableName] = lock
+	}
+	return lock
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// lockTestTimeout bounds how long a write may take while another table is
+// being scanned before the test treats it as blocked
+const lockTestTimeout = 5 * time.Second
+
+func createLockTestTables(t *testing.T, s types.Storage) {
+	t.Helper()
+	for _, name := range []string{"events", "users"} {
+		err := s.CreateTable(&types.Table{
+			Name:    name,
+			Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: true}},
+		})
+		assert.NoError(t, err)
+	}
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, s.Insert("events", map[string]interface{}{"id": i}))
+	}
+}
+
+// assertWriteNotBlocked fails the test if write does not return in time
+func assertWriteNotBlocked(t *testing.T, write func() error) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- write() }()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(lockTestTimeout):
+		t.Fatal("write to another table was blocked by a scan")
+	}
+}
+
+// assertWriteWaits checks that write only completes after release is closed
+func assertWriteWaits(t *testing.T, release chan struct{}, write func() error) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- write() }()
+	select {
+	case <-done:
+		t.Fatal("write to the scanned table did not wait for the scan")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestBTreeSlowScanDoesNotBlockOtherTables(t *testing.T) {
+	s, err := NewBTreeStorage(filepath.Join(t.TempDir(), "locks.db"))
+	assert.NoError(t, err)
+	defer s.Close()
+	createLockTestTables(t, s)
+
+	// A throttled scan of events, holding the table lock like Select does,
+	// that pauses on its first row until released
+	started := make(chan struct{})
+	release := make(chan struct{})
+	scanned := make(chan int, 1)
+	go func() {
+		lock := s.locks.get("events")
+		lock.RLock()
+		defer lock.RUnlock()
+
+		count := 0
+		err := s.scanRows("events", func(key string, row types.Row) error {
+			if count == 0 {
+				close(started)
+				<-release
+			}
+			count++
+			return nil
+		})
+		assert.NoError(t, err)
+		scanned <- count
+	}()
+	<-started
+
+	assertWriteNotBlocked(t, func() error {
+		return s.Insert("users", map[string]interface{}{"id": 1})
+	})
+	rows, err := s.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+
+	assertWriteWaits(t, release, func() error {
+		return s.Insert("events", map[string]interface{}{"id": 4})
+	})
+	assert.Equal(t, 3, <-scanned)
+}
+
+func TestInMemorySlowScanDoesNotBlockOtherTables(t *testing.T) {
+	s := NewInMemoryStorage()
+	createLockTestTables(t, s)
+
+	// Hold the read lock of events as a long running scan would
+	lock := s.locks.get("events")
+	lock.RLock()
+	release := make(chan struct{})
+	go func() {
+		<-release
+		lock.RUnlock()
+	}()
+
+	assertWriteNotBlocked(t, func() error {
+		return s.Insert("users", map[string]interface{}{"id": 1})
+	})
+	assertWriteNotBlocked(t, func() error {
+		return s.CreateTable(&types.Table{Name: "audit", Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}}})
+	})
+
+	// Readers of the same table are not blocked either
+	rows, err := s.Select("events", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+
+	assertWriteWaits(t, release, func() error {
+		_, err := s.Delete("events", types.WhereAll(map[string]interface{}{"id": 1}))
+		return err
+	})
+}
+
+func TestBTreeShowTablesConcurrentWithCreateTable(t *testing.T) {
+	s, err := NewBTreeStorage(filepath.Join(t.TempDir(), "catalog.db"))
+	assert.NoError(t, err)
+	defer s.Close()
+
+	// Force the reload path, which used to write the catalog under a read lock
+	s.catalogLoaded = false
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, s.CreateTable(&types.Table{
+				Name:    fmt.Sprintf("t%d", i),
+				Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: true}},
+			}))
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := s.ShowTables()
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	tables, err := s.ShowTables()
+	assert.NoError(t, err)
+	assert.Len(t, tables, 8)
+}
+
+func TestBTreeShowTablesReadsNoPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.db")
+	s, err := NewBTreeStorage(path)
+	assert.NoError(t, err)
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name:    "events",
+		Columns: []types.ColumnDefinition{{Name: "id", Type: "INT", Nullable: true}},
+	}))
+	assert.NoError(t, s.Close())
+
+	s, err = NewBTreeStorage(path)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	reads := s.PageReads()
+	for i := 0; i < 3; i++ {
+		tables, err := s.ShowTables()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"events"}, tables)
+	}
+	assert.Equal(t, reads, s.PageReads())
+
+	// If the catalog was not loaded at open, it is reread once
+	s.catalogLoaded = false
+	for i := 0; i < 3; i++ {
+		tables, err := s.ShowTables()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"events"}, tables)
+	}
+	assert.Equal(t, reads+1, s.PageReads())
+}
@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// Transaction buffers the writes of a BEGIN ... COMMIT block on top of a
+// storage. The first write to a table copies it into an in-memory overlay,
+// where the write is validated and applied; reads of a written table see
+// the overlay, and reads of other tables go to the storage. Commit replays
+// the buffered writes on the storage, and Rollback discards them.
+//
+// Transaction implements types.Storage, so statements run inside the
+// transaction by executing against it. Tables cannot be created or dropped
+// inside a transaction.
+type Transaction struct {
+	mu      sync.Mutex
+	base    types.Storage
+	overlay *InMemoryStorage
+	ops     []txOp
+	done    bool
+}
+
+// txOp is a buffered write. Rows is set for an insert, Set for an update,
+// and Where for an update or delete.
+type txOp struct {
+	table string
+	rows  []map[string]interface{}
+	set   map[string]interface{}
+	where *types.WhereExpr
+}
+
+// NewTransaction starts a transaction on base
+func NewTransaction(base types.Storage) *Transaction {
+	return &Transaction{
+		base:    base,
+		overlay: NewInMemoryStorage(),
+	}
+}
+
+// load copies a table from the storage into the overlay, once. The caller
+// must hold t.mu.
+func (t *Transaction) load(tableName string) error {
+	if t.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	if t.overlay.GetTable(tableName) != nil {
+		return nil
+	}
+	table := t.base.GetTable(tableName)
+	if table == nil {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+	rows, err := t.base.Select(tableName, []string{"*"}, nil)
+	if err != nil {
+		return err
+	}
+
+	// The copy keeps the columns, with their constraints, but not the
+	// quota: rows are only evicted when the writes reach the storage
+	columns := make([]types.ColumnDefinition, len(table.Columns))
+	copy(columns, table.Columns)
+	if err := t.overlay.CreateTable(&types.Table{Name: tableName, Columns: columns}); err != nil {
+		return err
+	}
+	values := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row
+	}
+	if len(values) > 0 {
+		return t.overlay.InsertRows(tableName, values)
+	}
+	return nil
+}
+
+// write loads tableName, applies op to the overlay with apply and buffers
+// op if it succeeded
+func (t *Transaction) write(op txOp, apply func() error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.load(op.table); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+// Insert implements Storage.Insert
+func (t *Transaction) Insert(tableName string, values map[string]interface{}) error {
+	return t.write(txOp{table: tableName, rows: []map[string]interface{}{values}}, func() error {
+		return t.overlay.Insert(tableName, values)
+	})
+}
+
+// InsertRows implements BatchInserter, so a failing row of a multi-row
+// INSERT leaves the transaction unchanged
+func (t *Transaction) InsertRows(tableName string, rows []map[string]interface{}) error {
+	return t.write(txOp{table: tableName, rows: rows}, func() error {
+		return t.overlay.InsertRows(tableName, rows)
+	})
+}
+
+// Update implements Storage.Update, counting the rows of the overlay it
+// changes
+func (t *Transaction) Update(tableName string, set map[string]interface{}, where *types.WhereExpr) (int, error) {
+	var updated int
+	err := t.write(txOp{table: tableName, set: set, where: where}, func() (err error) {
+		updated, err = t.overlay.Update(tableName, set, where)
+		return err
+	})
+	return updated, err
+}
+
+// Delete implements Storage.Delete, counting the rows of the overlay it
+// removes
+func (t *Transaction) Delete(tableName string, where *types.WhereExpr) (int, error) {
+	var deleted int
+	err := t.write(txOp{table: tableName, where: where}, func() (err error) {
+		deleted, err = t.overlay.Delete(tableName, where)
+		return err
+	})
+	return deleted, err
+}
+
+// Select implements Storage.Select, seeing the writes of the transaction
+func (t *Transaction) Select(tableName string, columns []string, where *types.WhereExpr) ([]types.Row, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.overlay.GetTable(tableName) != nil {
+		return t.overlay.Select(tableName, columns, where)
+	}
+	return t.base.Select(tableName, columns, where)
+}
+
+// GetTable implements Storage.GetTable
+func (t *Transaction) GetTable(tableName string) *types.Table {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if table := t.overlay.GetTable(tableName); table != nil {
+		return table
+	}
+	return t.base.GetTable(tableName)
+}
+
+// ShowTables implements Storage.ShowTables
+func (t *Transaction) ShowTables() ([]string, error) {
+	return t.base.ShowTables()
+}
+
+// CreateTable implements Storage.CreateTable. It always fails.
+func (t *Transaction) CreateTable(table *types.Table) error {
+	return fmt.Errorf("CREATE TABLE is not supported inside a transaction")
+}
+
+// DropTable implements Storage.DropTable. It always fails.
+func (t *Transaction) DropTable(tableName string) error {
+	return fmt.Errorf("DROP TABLE is not supported inside a transaction")
+}
+
+// Capabilities implements Storage.Capabilities
+func (t *Transaction) Capabilities() types.Capabilities {
+	return t.base.Capabilities()
+}
+
+// commitMu serializes the commits of transactions on storages that are
+// not types.ExclusiveWriters
+var commitMu sync.Mutex
+
+// Commit applies the buffered writes to the storage in order, under the
+// storage's write lock if it is a types.ExclusiveWriter. The writes were
+// already validated against the overlay, so they only fail if the storage
+// changed underneath the transaction; the writes applied so far are then
+// undone one by one, leaving the rows other sessions wrote in place.
+func (t *Transaction) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	t.done = true
+
+	replay := func(s types.Storage) error {
+		var undo []func(s types.Storage) error
+		for i, op := range t.ops {
+			u, err := applyOp(s, op)
+			if err != nil {
+				for j := len(undo) - 1; j >= 0; j-- {
+					if err := undo[j](s); err != nil {
+						types.GlobalLogger.Error("failed to undo write %d of a failed commit: %v", j+1, err)
+					}
+				}
+				return fmt.Errorf("commit failed at write %d of %d, transaction rolled back: %w", i+1, len(t.ops), err)
+			}
+			undo = append(undo, u)
+		}
+		return nil
+	}
+	if writer, ok := t.base.(types.ExclusiveWriter); ok {
+		return writer.WriteExclusive(replay)
+	}
+	commitMu.Lock()
+	defer commitMu.Unlock()
+	return replay(t.base)
+}
+
+// applyOp applies a buffered write to s and returns the function that
+// undoes it. Updated and deleted rows are read first so they can be put
+// back.
+func applyOp(s types.Storage, op txOp) (func(s types.Storage) error, error) {
+	if op.rows != nil {
+		if err := types.InsertRows(s, op.table, op.rows); err != nil {
+			return nil, err
+		}
+		return func(s types.Storage) error {
+			for i := len(op.rows) - 1; i >= 0; i-- {
+				if err := removeRow(s, op.table, op.rows[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	}
+
+	before, err := s.Select(op.table, []string{"*"}, op.where)
+	if err != nil {
+		return nil, err
+	}
+	old := make([]map[string]interface{}, len(before))
+	for i, row := range before {
+		old[i] = row
+	}
+
+	if op.set == nil {
+		if _, err := s.Delete(op.table, op.where); err != nil {
+			return nil, err
+		}
+		return func(s types.Storage) error {
+			if len(old) == 0 {
+				return nil
+			}
+			return types.InsertRows(s, op.table, old)
+		}, nil
+	}
+
+	table := s.GetTable(op.table)
+	if table == nil {
+		return nil, fmt.Errorf("table %s does not exist", op.table)
+	}
+	set, err := types.CanonicalValues(table, op.set)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.Update(op.table, op.set, op.where); err != nil {
+		return nil, err
+	}
+	return func(s types.Storage) error {
+		for _, row := range old {
+			updated := make(map[string]interface{}, len(row))
+			for col, val := range row {
+				updated[col] = val
+			}
+			for col, val := range set {
+				updated[col] = val
+			}
+			if err := removeRow(s, op.table, updated); err != nil {
+				return err
+			}
+		}
+		if len(old) == 0 {
+			return nil
+		}
+		return types.InsertRows(s, op.table, old)
+	}, nil
+}
+
+// removeRow deletes one row of a table holding the values of row, which
+// may leave columns out. Rows with the same values in every column cannot
+// be told apart, so the others deleted with it are inserted again.
+func removeRow(s types.Storage, tableName string, row map[string]interface{}) error {
+	matches, err := s.Select(tableName, []string{"*"}, rowWhere(row))
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("row %v of table %s is gone", row, tableName)
+	}
+	where := rowWhere(matches[0])
+	same, err := s.Select(tableName, []string{"*"}, where)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Delete(tableName, where); err != nil {
+		return err
+	}
+	if len(same) <= 1 {
+		return nil
+	}
+	rest := make([]map[string]interface{}, len(same)-1)
+	for i, r := range same[1:] {
+		rest[i] = r
+	}
+	return types.InsertRows(s, tableName, rest)
+}
+
+// rowWhere returns the WHERE clause matching rows with the values of row
+func rowWhere(row map[string]interface{}) *types.WhereExpr {
+	conditions := make(map[string]interface{}, len(row))
+	for col, val := range row {
+		if val == nil {
+			conditions[col] = types.Comparison{Operator: "IS NULL"}
+			continue
+		}
+		conditions[col] = val
+	}
+	return types.WhereAll(conditions)
+}
+
+// Rollback discards the buffered writes
+func (t *Transaction) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return fmt.Errorf("transaction is already finished")
+	}
+	t.done = true
+	t.ops = nil
+	t.overlay = NewInMemoryStorage()
+	return nil
+}
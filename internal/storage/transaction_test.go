@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+func TestTransaction(t *testing.T) {
+	dir := t.TempDir()
+	btree, err := NewBTreeStorage(filepath.Join(dir, "tx.db"))
+	assert.NoError(t, err)
+	defer btree.Close()
+	jsonStore, err := NewJSONStorage(filepath.Join(dir, "json"), "test_")
+	assert.NoError(t, err)
+
+	for name, s := range map[string]Storage{"InMemory": NewInMemoryStorage(), "JSON": jsonStore, "BTree": btree} {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, s.CreateTable(eventsTable()))
+			for _, row := range eventRows(3) {
+				assert.NoError(t, s.Insert("events", row))
+			}
+
+			// Rolled back writes never reach the storage, even after a
+			// write in the transaction failed
+			tx := NewTransaction(s)
+			assert.NoError(t, tx.Insert("events", map[string]interface{}{"id": 3, "kind": "click"}))
+			assert.Equal(t, 1, rowsAffected(t)(tx.Update("events", map[string]interface{}{"kind": "view"}, types.WhereAll(map[string]interface{}{"id": 0}))))
+			assert.Error(t, tx.Insert("events", map[string]interface{}{"id": 4, "size": 1}))
+			rows, err := tx.Select("events", []string{"*"}, types.WhereAll(map[string]interface{}{"kind": "view"}))
+			assert.NoError(t, err)
+			assert.Len(t, rows, 2)
+			rows, err = s.Select("events", []string{"*"}, types.WhereAll(map[string]interface{}{"kind": "view"}))
+			assert.NoError(t, err)
+			assert.Len(t, rows, 1)
+			assert.NoError(t, tx.Rollback())
+			rows, err = s.Select("events", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, rows, 3)
+			assert.EqualError(t, tx.Commit(), "transaction is already finished")
+
+			// Committed writes are applied in order
+			tx = NewTransaction(s)
+			assert.NoError(t, tx.InsertRows("events", []map[string]interface{}{{"id": 3, "kind": "click"}, {"id": 4, "kind": "view"}}))
+			assert.Equal(t, 3, rowsAffected(t)(tx.Delete("events", types.WhereAll(map[string]interface{}{"kind": "click"}))))
+			assert.Equal(t, 1, rowsAffected(t)(tx.Update("events", map[string]interface{}{"kind": "buy"}, types.WhereAll(map[string]interface{}{"id": 4}))))
+			rows, err = s.Select("events", []string{"*"}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, rows, 3)
+			assert.NoError(t, tx.Commit())
+			rows, err = s.Select("events", []string{"kind"}, nil)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []types.Row{{"kind": "view"}, {"kind": "buy"}}, rows)
+
+			assert.EqualError(t, NewTransaction(s).CreateTable(eventsTable()), "CREATE TABLE is not supported inside a transaction")
+		})
+	}
+}
+
+func TestTransactionCommitFailureUndoesItsWrites(t *testing.T) {
+	s := NewInMemoryStorage()
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "users",
+		Columns: []types.ColumnDefinition{
+			{Name: "id", Type: "INT", PrimaryKey: true},
+			{Name: "name", Type: "STRING", Nullable: true},
+		},
+	}))
+	assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 1, "name": "Ann"}))
+
+	assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 4, "name": nil}))
+
+	tx := NewTransaction(s)
+	assert.Equal(t, 1, rowsAffected(t)(tx.Update("users", map[string]interface{}{"name": "Anne"}, types.WhereAll(map[string]interface{}{"id": 1}))))
+	assert.Equal(t, 1, rowsAffected(t)(tx.Delete("users", types.WhereAll(map[string]interface{}{"id": 4}))))
+	assert.NoError(t, tx.Insert("users", map[string]interface{}{"id": 5, "name": "Eve"}))
+	assert.NoError(t, tx.Insert("users", map[string]interface{}{"id": 2, "name": "Bob"}))
+
+	// The storage changes underneath the transaction, so its last insert
+	// fails on commit after its other writes were applied; undoing them
+	// keeps the rows written outside the transaction
+	assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 2, "name": "Cy"}))
+	assert.NoError(t, s.Insert("users", map[string]interface{}{"id": 3, "name": "Dan"}))
+	assert.EqualError(t, tx.Commit(), "commit failed at write 4 of 4, transaction rolled back: duplicate primary key id = 2 in table users")
+
+	rows, err := s.Select("users", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []types.Row{
+		{"id": int64(1), "name": "Ann"},
+		{"id": int64(2), "name": "Cy"},
+		{"id": int64(3), "name": "Dan"},
+		{"id": int64(4), "name": nil},
+	}, rows)
+}
+
+func TestRemoveRowKeepsDuplicates(t *testing.T) {
+	s := NewInMemoryStorage()
+	assert.NoError(t, s.CreateTable(&types.Table{
+		Name: "tags",
+		Columns: []types.ColumnDefinition{
+			{Name: "tag", Type: "STRING"},
+			{Name: "n", Type: "INT", Nullable: true},
+		},
+	}))
+	assert.NoError(t, s.InsertRows("tags", []map[string]interface{}{
+		{"tag": "a", "n": 1}, {"tag": "a", "n": 1}, {"tag": "a", "n": 1}, {"tag": "b"},
+	}))
+
+	assert.NoError(t, removeRow(s, "tags", map[string]interface{}{"tag": "a"}))
+	assert.NoError(t, removeRow(s, "tags", map[string]interface{}{"tag": "b", "n": nil}))
+	rows, err := s.Select("tags", []string{"*"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"tag": "a", "n": int64(1)}, {"tag": "a", "n": int64(1)}}, rows)
+}
+
+func TestHybridWriteExclusiveBlocksWrites(t *testing.T) {
+	olap, err := NewParquetStorage(t.TempDir())
+	assert.NoError(t, err)
+	s := &HybridStorage{oltp: NewInMemoryStorage(), olap: olap, history: newRoutingHistory(10)}
+	defer s.Close()
+	assert.NoError(t, s.CreateTable(&types.Table{Name: "items", Columns: []types.ColumnDefinition{{Name: "id", Type: "INT"}}}))
+
+	// A write outside the lock waits for the writes inside it
+	inside := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- s.WriteExclusive(func(w types.Storage) error {
+			close(inside)
+			<-release
+			return w.Insert("items", map[string]interface{}{"id": 1})
+		})
+	}()
+	<-inside
+	inserted := make(chan error)
+	go func() { inserted <- s.Insert("items", map[string]interface{}{"id": 2}) }()
+	select {
+	case <-inserted:
+		t.Fatal("insert ran while the write lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-done)
+	assert.NoError(t, <-inserted)
+
+	rows, err := s.oltp.Select("items", []string{"id"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Row{{"id": int64(1)}, {"id": int64(2)}}, rows)
+}
@@ -0,0 +1,250 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// distinctEntryOverhead approximates the bytes a Go map spends per string
+// key besides the key itself
+const distinctEntryOverhead = 48
+
+// AggregateCall is an aggregate function in a SELECT list:
+//
+//	COUNT(*)                    rows
+//	COUNT(col)                  non-NULL values
+//	COUNT(DISTINCT col)         distinct non-NULL values, held exactly
+//	APPROX_COUNT_DISTINCT(col)  distinct non-NULL values, estimated with a
+//	                            HyperLogLog sketch (standard error ~0.8%)
+//	SUM(col), AVG(col)          sum and mean of the non-NULL numbers
+//	MIN(col), MAX(col)          smallest and largest non-NULL value
+//
+// Over no values SUM, AVG, MIN and MAX are NULL.
+type AggregateCall struct {
+	Func     string // COUNT, APPROX_COUNT_DISTINCT, SUM, AVG, MIN or MAX
+	Column   string // * for COUNT(*)
+	Distinct bool
+}
+
+func (c AggregateCall) String() string {
+	if c.Distinct {
+		return fmt.Sprintf("%s(DISTINCT %s)", c.Func, c.Column)
+	}
+	return fmt.Sprintf("%s(%s)", c.Func, c.Column)
+}
+
+// New returns an empty aggregate for the call
+func (c AggregateCall) New() Aggregate {
+	switch {
+	case c.Func == "APPROX_COUNT_DISTINCT":
+		return &approxCountDistinct{sketch: NewHyperLogLog()}
+	case c.Func == "SUM" || c.Func == "AVG":
+		return &sum{avg: c.Func == "AVG", ints: true}
+	case c.Func == "MIN" || c.Func == "MAX":
+		return &extreme{max: c.Func == "MAX"}
+	case c.Distinct:
+		return &countDistinct{seen: make(map[string]struct{})}
+	}
+	return &count{all: c.Column == "*"}
+}
+
+// Numeric reports whether the call only accepts numbers
+func (c AggregateCall) Numeric() bool {
+	return c.Func == "SUM" || c.Func == "AVG"
+}
+
+// ResultType returns the column type of the call's result, given the type
+// of the column it aggregates. AVG is fractional, so its result is a
+// FLOAT whatever the column.
+func (c AggregateCall) ResultType(columnType string) string {
+	switch c.Func {
+	case "AVG":
+		return "FLOAT"
+	case "SUM", "MIN", "MAX":
+		return columnType
+	}
+	return "INT"
+}
+
+// Aggregate accumulates the values of one column over a set of rows
+type Aggregate interface {
+	// Add adds a value, or fails if the aggregate cannot take it
+	Add(value interface{}) error
+	Result() interface{}
+
+	// Memory returns the bytes held by the aggregate's state and the
+	// bytes an exact evaluation would need
+	Memory() (used, exact int)
+}
+
+// AggregateRows evaluates the calls over rows and returns the results as a
+// single row keyed by name, along with the aggregates for their memory use
+func AggregateRows(calls map[string]AggregateCall, rows []Row) (Row, map[string]Aggregate, error) {
+	aggs := make(map[string]Aggregate, len(calls))
+	for name, call := range calls {
+		aggs[name] = call.New()
+	}
+	for _, row := range rows {
+		for name, call := range calls {
+			var value interface{} = true
+			if call.Column != "*" {
+				value = row[call.Column]
+			}
+			if err := aggs[name].Add(value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", call, err)
+			}
+		}
+	}
+
+	result := make(Row, len(aggs))
+	for name, agg := range aggs {
+		result[name] = agg.Result()
+	}
+	return result, aggs, nil
+}
+
+type count struct {
+	all bool
+	n   int
+}
+
+func (a *count) Add(value interface{}) error {
+	if a.all || value != nil {
+		a.n++
+	}
+	return nil
+}
+
+func (a *count) Result() interface{} { return a.n }
+
+func (a *count) Memory() (int, int) { return 8, 8 }
+
+type countDistinct struct {
+	seen  map[string]struct{}
+	bytes int
+}
+
+func (a *countDistinct) Add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	key := fmt.Sprint(value)
+	if _, ok := a.seen[key]; !ok {
+		a.seen[key] = struct{}{}
+		a.bytes += len(key) + distinctEntryOverhead
+	}
+	return nil
+}
+
+func (a *countDistinct) Result() interface{} { return len(a.seen) }
+
+func (a *countDistinct) Memory() (int, int) { return a.bytes, a.bytes }
+
+type approxCountDistinct struct {
+	sketch *HyperLogLog
+	values int
+	bytes  int // total length of the values added, to estimate exact memory
+}
+
+func (a *approxCountDistinct) Add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	key := fmt.Sprint(value)
+	a.sketch.Add(key)
+	a.values++
+	a.bytes += len(key)
+	return nil
+}
+
+func (a *approxCountDistinct) Result() interface{} { return a.sketch.Estimate() }
+
+// Memory estimates the exact variant's memory from the estimated distinct
+// count and the average value length
+func (a *approxCountDistinct) Memory() (int, int) {
+	if a.values == 0 {
+		return a.sketch.Memory(), 0
+	}
+	avg := a.bytes / a.values
+	return a.sketch.Memory(), int(a.sketch.Estimate()) * (avg + distinctEntryOverhead)
+}
+
+// sum adds up numbers for SUM and AVG. The sum stays an int while every
+// value is one, as the values of INT columns are.
+type sum struct {
+	avg   bool
+	ints  bool
+	total float64
+	n     int
+}
+
+func (a *sum) Add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	f, ok := toFloat(value)
+	if !ok {
+		return fmt.Errorf("value %#v is not a number", value)
+	}
+	switch value.(type) {
+	case int, int32, int64:
+	default:
+		a.ints = false
+	}
+	a.total += f
+	a.n++
+	return nil
+}
+
+func (a *sum) Result() interface{} {
+	switch {
+	case a.n == 0:
+		return nil
+	case a.avg:
+		return a.total / float64(a.n)
+	case a.ints:
+		return int(a.total)
+	}
+	return a.total
+}
+
+func (a *sum) Memory() (int, int) { return 16, 16 }
+
+// extreme keeps the smallest value for MIN or the largest for MAX. Values
+// compare as CompareValues orders them, so numbers and strings cannot be
+// mixed.
+type extreme struct {
+	max   bool
+	value interface{}
+}
+
+func (a *extreme) Add(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	if a.value == nil {
+		a.value = value
+		return nil
+	}
+	cmp, ok := CompareValues(value, a.value)
+	if !ok {
+		return fmt.Errorf("cannot compare %#v with %#v", value, a.value)
+	}
+	if a.max && cmp > 0 || !a.max && cmp < 0 {
+		a.value = value
+	}
+	return nil
+}
+
+func (a *extreme) Result() interface{} { return a.value }
+
+func (a *extreme) Memory() (int, int) { return 16, 16 }
+
+// IsAggregateFunc reports whether name is an aggregate function
+func IsAggregateFunc(name string) bool {
+	switch strings.ToUpper(name) {
+	case "COUNT", "APPROX_COUNT_DISTINCT", "SUM", "AVG", "MIN", "MAX":
+		return true
+	}
+	return false
+}
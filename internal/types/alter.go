@@ -0,0 +1,149 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// CheckColumnTypeChange validates changing a column from one type to
+// another. Widening conversions are always allowed: any type to
+// STRING/TEXT, INT to FLOAT and DATE to TIMESTAMP. Every other change is
+// narrowing and requires a USING clause. Either way every stored value
+// must convert (see ConvertColumnValue), so an INT beyond 2^53 that FLOAT
+// cannot hold exactly fails the change.
+func CheckColumnTypeChange(column, from, to string, using bool) error {
+	switch to {
+	case "INT", "FLOAT", "STRING", "TEXT", "BOOLEAN", "DATE", "TIMESTAMP":
+	default:
+		return fmt.Errorf("unsupported column type %s", to)
+	}
+	widening := from == to || to == "STRING" || to == "TEXT" ||
+		from == "INT" && to == "FLOAT" || from == "DATE" && to == "TIMESTAMP"
+	if !widening && !using {
+		return fmt.Errorf("changing column %s from %s to %s is a narrowing conversion; add USING %s to convert and validate existing values", column, from, to, column)
+	}
+	return nil
+}
+
+// ConvertColumnValue converts a stored value, or a DEFAULT, to a column's
+// new type. NULL stays NULL. Converting to STRING/TEXT formats any value;
+// converting to another type fails for values that do not hold one, such
+// as 1.5 for an INT or 'yes' for a BOOLEAN, and for integers a FLOAT would
+// round. A TIMESTAMP converted to a DATE keeps its day.
+func ConvertColumnValue(column, newType string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch newType {
+	case "STRING", "TEXT":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int:
+			return strconv.Itoa(v), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case time.Time:
+			return v.UTC().Format(TimestampLayout), nil
+		}
+	case "INT":
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if float64(int64(v)) == v {
+				return int64(v), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case "FLOAT":
+		switch v := value.(type) {
+		case int:
+			if f, ok := exactFloat(int64(v)); ok {
+				return f, nil
+			}
+		case int64:
+			if f, ok := exactFloat(v); ok {
+				return f, nil
+			}
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case "BOOLEAN":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case "DATE", "TIMESTAMP":
+		if t, err := ParseTime("TIMESTAMP", value); err == nil {
+			if newType == "DATE" {
+				return t.Format(DateLayout), nil
+			}
+			return t.UTC().Format(TimestampLayout), nil
+		}
+	}
+	return nil, fmt.Errorf("column %s: value %#v cannot be converted to %s", column, value, newType)
+}
+
+// exactFloat converts n to a float64, reporting whether it converts back
+// to n rather than being rounded
+func exactFloat(n int64) (float64, bool) {
+	f := float64(n)
+	return f, f < math.MaxInt64 && int64(f) == n
+}
+
+// ColumnTypeChanger is implemented by storages that can change the type of
+// a column (ALTER TABLE ... ALTER COLUMN ... TYPE). Every stored row is
+// converted with ConvertColumnValue before the new type is written to the
+// table metadata, and a value that fails to convert leaves the table
+// unchanged. progress, if not nil, is called periodically with the number
+// of rows converted so far.
+type ColumnTypeChanger interface {
+	AlterColumnType(tableName, column, newType string, progress func(converted int)) error
+}
+
+// CheckAddColumn validates adding col to table (ALTER TABLE ... ADD
+// COLUMN). Existing rows get the column's DEFAULT, so a NOT NULL column
+// needs one, and a primary key cannot be added since the existing rows
+// would all share the same value.
+func CheckAddColumn(table *Table, col ColumnDefinition) error {
+	for _, existing := range table.Columns {
+		if existing.Name == col.Name {
+			return fmt.Errorf("column %s already exists in table %s", col.Name, table.Name)
+		}
+	}
+	if col.PrimaryKey {
+		return fmt.Errorf("cannot add PRIMARY KEY column %s to existing table %s", col.Name, table.Name)
+	}
+	if !col.Nullable && col.Default == nil {
+		return fmt.Errorf("NOT NULL column %s needs a DEFAULT for the existing rows of table %s", col.Name, table.Name)
+	}
+	return CheckDefault(col)
+}
+
+// ColumnAdder is implemented by storages that can add a column to a table
+// (ALTER TABLE ... ADD COLUMN). The column is checked with CheckAddColumn,
+// and existing rows get its DEFAULT, or NULL without one.
+type ColumnAdder interface {
+	AddColumn(tableName string, col ColumnDefinition) error
+}
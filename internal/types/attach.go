@@ -0,0 +1,10 @@
+package types
+
+// ParquetAttacher is implemented by storages that can query a Parquet file
+// in place as a read-only table (ATTACH PARQUET 'events.parquet' AS
+// events). The table schema is inferred from the file's own schema.
+// DetachParquet forgets the table and leaves the file alone.
+type ParquetAttacher interface {
+	AttachParquet(tableName, path string) (*Table, error)
+	DetachParquet(tableName string) error
+}
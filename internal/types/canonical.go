@@ -0,0 +1,220 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CanonicalValue returns a value of a column in the Go type every storage
+// holds it as: int64 for INT, float64 for FLOAT, string for STRING and
+// TEXT, bool for BOOLEAN, and for DATE and TIMESTAMP a string in
+// DateLayout or TimestampLayout, fractional seconds dropped. Values that do
+// not convert, such as 1.5 or 'abc' for an INT, are returned unchanged for
+// the caller to validate, except for an invalid DATE or TIMESTAMP, which is
+// an error. NULL stays NULL, and values of
+// other column types are unchanged.
+func CanonicalValue(columnType string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch columnType {
+	case "INT":
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case float64:
+			if v == float64(int64(v)) {
+				return int64(v), nil
+			}
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return n, nil
+			}
+			if f, err := v.Float64(); err == nil {
+				return f, nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case "FLOAT":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f, nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case "STRING", "TEXT":
+		switch v := value.(type) {
+		case int:
+			return strconv.Itoa(v), nil
+		case int32:
+			return strconv.FormatInt(int64(v), 10), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case json.Number:
+			return v.String(), nil
+		}
+	case "DATE", "TIMESTAMP":
+		t, err := ParseTime(columnType, value)
+		if err != nil {
+			return nil, err
+		}
+		if columnType == "DATE" {
+			return t.Format(DateLayout), nil
+		}
+		return t.UTC().Format(TimestampLayout), nil
+	}
+	return value, nil
+}
+
+// CanonicalValues returns the values of an INSERT or UPDATE, or a row read
+// back from disk, with the values of the columns of table in their
+// canonical type (see CanonicalValue). Fields that are not columns are
+// left alone. values itself is not modified; it is returned as is if
+// nothing changes.
+func CanonicalValues(table *Table, values map[string]interface{}) (map[string]interface{}, error) {
+	var canonical map[string]interface{}
+	for _, col := range table.Columns {
+		val, ok := values[col.Name]
+		if !ok {
+			continue
+		}
+		converted, err := CanonicalValue(col.Type, val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data type for column %s: %w", col.Name, err)
+		}
+		if sameValue(converted, val) {
+			continue
+		}
+		if canonical == nil {
+			canonical = make(map[string]interface{}, len(values))
+			for k, v := range values {
+				canonical[k] = v
+			}
+		}
+		canonical[col.Name] = converted
+	}
+	if canonical == nil {
+		return values, nil
+	}
+	return canonical, nil
+}
+
+// sameValue reports whether CanonicalValue returned its argument as is.
+// Values of uncomparable types, such as a []byte, are never converted.
+func sameValue(converted, value interface{}) bool {
+	switch value.(type) {
+	case []byte, []interface{}, map[string]interface{}:
+		return true
+	}
+	return converted == value
+}
+
+// CanonicalWhere returns where with the values compared to the columns of
+// table in their canonical type (see CanonicalValue), including the lists
+// of IN and BETWEEN, so that they compare as the stored values do: dates
+// chronologically and numbers given for a STRING column as strings. LIKE
+// patterns and row conditions are left alone. where itself is not
+// modified.
+func CanonicalWhere(table *Table, where *WhereExpr) (*WhereExpr, error) {
+	if table == nil || where == nil {
+		return where, nil
+	}
+	columnTypes := make(map[string]string, len(table.Columns))
+	for _, col := range table.Columns {
+		columnTypes[col.Name] = col.Type
+	}
+	return where.Rewrite(func(cond *WhereExpr) (*WhereExpr, error) {
+		columnType, ok := columnTypes[cond.Column]
+		if cond.Row != nil || !ok {
+			return cond, nil
+		}
+		converted, err := canonicalCondition(columnType, cond.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for column %s in WHERE clause: %w", cond.Column, err)
+		}
+		return Condition(cond.Column, converted), nil
+	})
+}
+
+// canonicalCondition converts the value or values of a condition on a
+// column
+func canonicalCondition(columnType string, value interface{}) (interface{}, error) {
+	c, ok := value.(Comparison)
+	if !ok {
+		return CanonicalValue(columnType, value)
+	}
+	switch c.Operator {
+	case "LIKE", "NOT LIKE":
+		return c, nil
+	case "IN", "NOT IN", "BETWEEN":
+		list, _ := c.Value.([]interface{})
+		converted := make([]interface{}, len(list))
+		for i, item := range list {
+			var err error
+			if converted[i], err = CanonicalValue(columnType, item); err != nil {
+				return nil, err
+			}
+		}
+		return Comparison{Operator: c.Operator, Value: converted}, nil
+	}
+	converted, err := CanonicalValue(columnType, c.Value)
+	if err != nil {
+		return nil, err
+	}
+	return Comparison{Operator: c.Operator, Value: converted}, nil
+}
+
+// DecodeRow decodes a row stored as JSON, giving the values of the columns
+// of table their canonical type (see CanonicalRow). Numbers are decoded as
+// json.Number first, so INT values beyond 2^53 keep their precision.
+// table may be nil, as for a table being dropped.
+func DecodeRow(data []byte, table *Table) (Row, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var row Row
+	if err := dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	CanonicalRow(table, row)
+	return row, nil
+}
+
+// CanonicalRow converts in place the values of a row read back from disk
+// to the canonical type of their column (see CanonicalValue). A stored
+// value that does not convert is kept as it is, for CHECK TABLE to report,
+// and numbers decoded as json.Number in fields that are not columns become
+// float64, as encoding/json would have decoded them.
+func CanonicalRow(table *Table, row Row) {
+	if table != nil {
+		for _, col := range table.Columns {
+			if converted, err := CanonicalValue(col.Type, row[col.Name]); err == nil && converted != nil {
+				row[col.Name] = converted
+			}
+		}
+	}
+	for name, val := range row {
+		if n, ok := val.(json.Number); ok {
+			row[name], _ = n.Float64()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotSupported is returned for a statement that needs a feature the
+// storage backend does not have (see Capabilities)
+var ErrNotSupported = errors.New("not supported by this storage backend")
+
+// Capabilities lists the features a storage backend supports, so that
+// callers can reject a statement up front instead of failing inside the
+// backend. Each flag must match what the backend actually does.
+type Capabilities struct {
+	SupportsTransactions bool // BEGIN, COMMIT and ROLLBACK
+	SupportsIndexes      bool // CREATE INDEX and DROP INDEX (IndexManager)
+	SupportsTTL          bool
+
+	// SupportsStreaming is set if rows can be read without materializing
+	// the whole result
+	SupportsStreaming bool
+
+	// ReadOnly is set if rows cannot be inserted, updated or deleted and
+	// tables cannot be created or altered, whatever the flags below say
+	ReadOnly bool
+
+	// Persistent is set if the data survives closing the storage
+	Persistent bool
+
+	SupportsTableCheck      bool // CHECK TABLE (TableChecker)
+	SupportsQuotas          bool // MAX_ROWS and MAX_BYTES (QuotaManager)
+	SupportsAlterColumnType bool // ALTER COLUMN ... TYPE (ColumnTypeChanger)
+	SupportsColumnMasks     bool // ALTER COLUMN ... SET MASKED (ColumnMasker)
+	SupportsAddColumn       bool // ADD COLUMN (ColumnAdder)
+	SupportsAttachParquet   bool // ATTACH PARQUET (ParquetAttacher)
+}
+
+// Unsupported returns an ErrNotSupported error naming the feature, e.g.
+// "CHECK TABLE is not supported by this storage backend"
+func Unsupported(feature string) error {
+	return fmt.Errorf("%s is %w", feature, ErrNotSupported)
+}
+
+// Rows returns one result row per capability for SHOW CAPABILITIES
+func (c Capabilities) Rows() []map[string]interface{} {
+	features := []struct {
+		name string
+		set  bool
+	}{
+		{"transactions", c.SupportsTransactions},
+		{"indexes", c.SupportsIndexes},
+		{"ttl", c.SupportsTTL},
+		{"streaming", c.SupportsStreaming},
+		{"read_only", c.ReadOnly},
+		{"persistent", c.Persistent},
+		{"check_table", c.SupportsTableCheck},
+		{"quotas", c.SupportsQuotas},
+		{"alter_column_type", c.SupportsAlterColumnType},
+		{"column_masks", c.SupportsColumnMasks},
+		{"add_column", c.SupportsAddColumn},
+		{"attach_parquet", c.SupportsAttachParquet},
+	}
+	rows := make([]map[string]interface{}, len(features))
+	for i, f := range features {
+		rows[i] = map[string]interface{}{"capability": f.name, "value": f.set}
+	}
+	return rows
+}
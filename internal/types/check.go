@@ -0,0 +1,116 @@
+package types
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaxCheckSamples is the number of offending row keys a CheckReport keeps
+const MaxCheckSamples = 10
+
+// RowDrift describes how a stored row differs from its table's schema
+type RowDrift struct {
+	Unknown    []string // fields that are not columns of the table
+	Missing    []string // NOT NULL columns without a value
+	Mismatched []string // columns whose value does not fit the column type
+}
+
+// Empty reports whether the row matches the schema
+func (d RowDrift) Empty() bool {
+	return len(d.Unknown) == 0 && len(d.Missing) == 0 && len(d.Mismatched) == 0
+}
+
+// CheckRowSchema validates a stored row against the table's current schema.
+// Types are checked with the same lenient rules used on insert.
+func CheckRowSchema(table *Table, row Row) RowDrift {
+	var drift RowDrift
+
+	columns := make(map[string]bool, len(table.Columns))
+	for _, col := range table.Columns {
+		columns[col.Name] = true
+
+		val, ok := row[col.Name]
+		if !ok || val == nil {
+			if !col.Nullable {
+				drift.Missing = append(drift.Missing, col.Name)
+			}
+			continue
+		}
+		if err := CheckValueType(col.Name, col.Type, val, false); err != nil {
+			drift.Mismatched = append(drift.Mismatched, col.Name)
+		}
+	}
+
+	for field := range row {
+		if !columns[field] {
+			drift.Unknown = append(drift.Unknown, field)
+		}
+	}
+	sort.Strings(drift.Unknown)
+
+	return drift
+}
+
+// CheckReport summarizes a CHECK TABLE scan. Each counter is the number of
+// rows with at least one problem of that kind.
+type CheckReport struct {
+	Table          string
+	RowsScanned    int
+	UnknownFields  int
+	MissingColumns int
+	TypeMismatches int
+	Repaired       int
+	Samples        []string // keys of the first offending rows
+}
+
+// Add records the result of checking one row
+func (r *CheckReport) Add(key string, drift RowDrift) {
+	r.RowsScanned++
+	if drift.Empty() {
+		return
+	}
+	if len(drift.Unknown) > 0 {
+		r.UnknownFields++
+	}
+	if len(drift.Missing) > 0 {
+		r.MissingColumns++
+	}
+	if len(drift.Mismatched) > 0 {
+		r.TypeMismatches++
+	}
+	if len(r.Samples) < MaxCheckSamples {
+		r.Samples = append(r.Samples, key)
+	}
+}
+
+// OK reports whether every row matched the schema
+func (r *CheckReport) OK() bool {
+	return r.UnknownFields == 0 && r.MissingColumns == 0 && r.TypeMismatches == 0
+}
+
+// Row returns the report as a single result row
+func (r *CheckReport) Row() Row {
+	status := "OK"
+	if !r.OK() {
+		status = "DRIFT"
+	}
+	return Row{
+		"table":            r.Table,
+		"status":           status,
+		"rows_scanned":     r.RowsScanned,
+		"unknown_fields":   r.UnknownFields,
+		"missing_required": r.MissingColumns,
+		"type_mismatches":  r.TypeMismatches,
+		"repaired":         r.Repaired,
+		"sample_keys":      strings.Join(r.Samples, ", "),
+	}
+}
+
+// TableChecker is implemented by storages that can validate stored rows
+// against the table schema (CHECK TABLE). With repair set, unknown fields
+// are dropped from the offending rows and missing values filled with their
+// column's DEFAULT. progress, if not nil, is called
+// periodically with the number of rows scanned so far.
+type TableChecker interface {
+	CheckTable(tableName string, repair bool, progress func(scanned int)) (*CheckReport, error)
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CoercionError reports a value that only fits its column through a silent
+// type conversion, which strict mode rejects.
+type CoercionError struct {
+	Column       string
+	ExpectedType string
+	Value        interface{}
+}
+
+func (e *CoercionError) Error() string {
+	return fmt.Sprintf("strict mode: column %s expects %s, got %T value %#v", e.Column, e.ExpectedType, e.Value, e.Value)
+}
+
+// CheckValueType validates value against the column's type. In lenient mode
+// a numeric value is accepted for a STRING/TEXT column and a numeric string
+// for an INT or FLOAT column; in strict mode those are rejected with a
+// *CoercionError. Integral float64 values are always valid for INT columns,
+// since encoding/json and Go callers often represent integers that way.
+// DATE and TIMESTAMP values must parse (see ParseTime).
+func CheckValueType(column, columnType string, value interface{}, strict bool) error {
+	if value == nil {
+		return nil // NULL values are allowed for any type
+	}
+
+	switch columnType {
+	case "INT":
+		switch v := value.(type) {
+		case int, int32, int64:
+			return nil
+		case float64:
+			if float64(int(v)) == v {
+				return nil
+			}
+		case string:
+			if _, err := strconv.Atoi(v); err == nil {
+				if strict {
+					return &CoercionError{Column: column, ExpectedType: columnType, Value: value}
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("value %v is not an integer", value)
+	case "STRING", "TEXT":
+		switch value.(type) {
+		case string:
+			return nil
+		case int, int32, int64, float64:
+			if strict {
+				return &CoercionError{Column: column, ExpectedType: columnType, Value: value}
+			}
+			// Numeric values are converted to string
+			return nil
+		}
+		return fmt.Errorf("value %v is not a string", value)
+	case "FLOAT":
+		switch v := value.(type) {
+		case int, int32, int64, float64:
+			return nil
+		case string:
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				if strict {
+					return &CoercionError{Column: column, ExpectedType: columnType, Value: value}
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("value %v is not a number", value)
+	case "BOOLEAN":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("value %v is not a boolean", value)
+		}
+		return nil
+	case "DATE", "TIMESTAMP":
+		_, err := ParseTime(columnType, value)
+		return err
+	}
+	return nil
+}
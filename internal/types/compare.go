@@ -0,0 +1,182 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Comparison is a WHERE value compared with an operator other than =, e.g.
+// Comparison{">", 30.0} for age > 30 or Comparison{"LIKE", "Al%"} for
+// name LIKE 'Al%'. For IN and NOT IN, Value is a []interface{} of the
+// listed values, for BETWEEN the low and high bounds, and for IS NULL and
+// IS NOT NULL nil. Plain values in a WHERE condition are compared for
+// equality.
+type Comparison struct {
+	Operator string // >, <, >=, <=, !=, LIKE, NOT LIKE, IN, NOT IN, BETWEEN, IS NULL or IS NOT NULL
+	Value    interface{}
+}
+
+// Format renders the condition on column, e.g. age > 30
+func (c Comparison) Format(column string) string {
+	if c.Operator == "IS NULL" || c.Operator == "IS NOT NULL" {
+		return column + " " + c.Operator
+	}
+	if bounds, ok := c.Value.([]interface{}); ok && c.Operator == "BETWEEN" && len(bounds) == 2 {
+		return fmt.Sprintf("%s BETWEEN %s AND %s", column, formatOperand(bounds[0]), formatOperand(bounds[1]))
+	}
+	return fmt.Sprintf("%s %s %s", column, c.Operator, formatOperand(c.Value))
+}
+
+// formatOperand renders a compared value as SQL: strings quoted and lists
+// in parentheses
+func formatOperand(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return "'" + v + "'"
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = formatOperand(item)
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Matches reports whether a stored value satisfies the comparison. NULL
+// matches only IS NULL, and values that cannot be ordered against each
+// other (a number and a string) only match !=.
+func (c Comparison) Matches(value interface{}) bool {
+	switch c.Operator {
+	case "IS NULL":
+		return value == nil
+	case "IS NOT NULL":
+		return value != nil
+	}
+	if value == nil || c.Value == nil {
+		return false
+	}
+	switch c.Operator {
+	case "LIKE":
+		return matchesLike(value, c.Value)
+	case "NOT LIKE":
+		return !matchesLike(value, c.Value)
+	case "IN":
+		return matchesIn(value, c.Value)
+	case "NOT IN":
+		return !matchesIn(value, c.Value)
+	case "BETWEEN":
+		return matchesBetween(value, c.Value)
+	}
+	cmp, ok := CompareValues(value, c.Value)
+	if !ok {
+		return c.Operator == "!="
+	}
+	switch c.Operator {
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// IsComparisonOperator reports whether op is an operator a Comparison
+// accepts
+func IsComparisonOperator(op string) bool {
+	switch op {
+	case "!=", ">", "<", ">=", "<=", "LIKE", "NOT LIKE", "IN", "NOT IN", "BETWEEN", "IS NULL", "IS NOT NULL":
+		return true
+	}
+	return false
+}
+
+// ValuesEqual reports whether a stored value equals a WHERE value. Numbers
+// are equal if their values are, whatever their types, since INT columns
+// hold int64 (see CanonicalValue) but Go callers may pass int or float64.
+func ValuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+// matchesIn reports whether value equals one of the values of an IN list
+func matchesIn(value, list interface{}) bool {
+	values, _ := list.([]interface{})
+	for _, v := range values {
+		if ValuesEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBetween reports whether value lies within the inclusive bounds
+// of a BETWEEN. Like the other orderings, it is false for a value that
+// cannot be ordered against the bounds.
+func matchesBetween(value, bounds interface{}) bool {
+	b, _ := bounds.([]interface{})
+	if len(b) != 2 {
+		return false
+	}
+	low, ok := CompareValues(value, b[0])
+	if !ok || low < 0 {
+		return false
+	}
+	high, ok := CompareValues(value, b[1])
+	return ok && high <= 0
+}
+
+// CompareValues orders two values, numerically if both are numbers and
+// lexically if both are strings. It returns false if they are of kinds
+// that cannot be ordered against each other.
+func CompareValues(a, b interface{}) (int, bool) {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, ok := a.(string)
+	if !ok {
+		return 0, false
+	}
+	y, ok := b.(string)
+	if !ok {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
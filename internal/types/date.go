@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// DATE and TIMESTAMP columns store their values as strings: a DATE as
+// 2024-01-15 and a TIMESTAMP as RFC 3339 in UTC to the second,
+// 2024-01-15T09:30:00Z. Both forms have a fixed width, so they order
+// chronologically when compared as strings, and WHERE conditions on such
+// columns compare correctly once their values are in the same form (see
+// CanonicalWhere).
+const (
+	DateLayout      = "2006-01-02"
+	TimestampLayout = "2006-01-02T15:04:05Z"
+)
+
+// timestampLayouts are the forms a TIMESTAMP string can take. Those
+// without a zone are UTC, and a date alone is its midnight.
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", DateLayout}
+
+// IsTimeType reports whether columnType is DATE or TIMESTAMP
+func IsTimeType(columnType string) bool {
+	return columnType == "DATE" || columnType == "TIMESTAMP"
+}
+
+// ParseTime parses a value of a DATE or TIMESTAMP column: a time.Time, or
+// a string in the column's stored form or, for a TIMESTAMP, another of
+// timestampLayouts
+func ParseTime(columnType string, value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if columnType == "DATE" {
+			if t, err := time.Parse(DateLayout, v); err == nil {
+				return t, nil
+			}
+			break
+		}
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	if columnType == "DATE" {
+		return time.Time{}, fmt.Errorf("value %v is not a date (expected YYYY-MM-DD)", value)
+	}
+	return time.Time{}, fmt.Errorf("value %v is not a timestamp (expected YYYY-MM-DD HH:MM:SS or RFC 3339)", value)
+}
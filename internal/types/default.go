@@ -0,0 +1,39 @@
+package types
+
+import "fmt"
+
+// CheckDefault returns an error if col's DEFAULT value does not fit its
+// type. Defaults are checked strictly, so DEFAULT '0' on an INT column is
+// rejected rather than converted.
+func CheckDefault(col ColumnDefinition) error {
+	if err := CheckValueType(col.Name, col.Type, col.Default, true); err != nil {
+		return fmt.Errorf("invalid DEFAULT %v for %s column %s", col.Default, col.Type, col.Name)
+	}
+	return nil
+}
+
+// WithDefaults returns values with the DEFAULT of each column it omits
+// filled in. values itself is not modified; it is returned as is if no
+// default applies.
+func WithDefaults(table *Table, values map[string]interface{}) map[string]interface{} {
+	var filled map[string]interface{}
+	for _, col := range table.Columns {
+		if col.Default == nil {
+			continue
+		}
+		if _, ok := values[col.Name]; ok {
+			continue
+		}
+		if filled == nil {
+			filled = make(map[string]interface{}, len(table.Columns))
+			for k, v := range values {
+				filled[k] = v
+			}
+		}
+		filled[col.Name] = col.Default
+	}
+	if filled == nil {
+		return values
+	}
+	return filled
+}
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DistinctRows returns rows without those equal to an earlier row, keeping
+// the order. Numbers are equal if their values are, whatever their Go
+// type, since Go callers and computed values may use int or float64.
+func DistinctRows(rows []Row) []Row {
+	seen := make(map[string]bool, len(rows))
+	distinct := rows[:0:0]
+	for _, row := range rows {
+		key := rowKey(row)
+		if !seen[key] {
+			seen[key] = true
+			distinct = append(distinct, row)
+		}
+	}
+	return distinct
+}
+
+// rowKey encodes a row so that equal rows have equal keys
+func rowKey(row Row) string {
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	var b strings.Builder
+	for _, col := range columns {
+		val := row[col]
+		if f, ok := toFloat(val); ok {
+			val = f
+		}
+		// The type keeps the string "1" apart from the number 1
+		fmt.Fprintf(&b, "%q=%T:%#v;", col, val, val)
+	}
+	return b.String()
+}
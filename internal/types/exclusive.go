@@ -0,0 +1,11 @@
+package types
+
+// ExclusiveWriter is implemented by storages that can run a series of
+// writes while every other write to the storage waits, as COMMIT does to
+// apply a transaction
+type ExclusiveWriter interface {
+	// WriteExclusive calls fn with a storage to write through while the
+	// write lock is held. Writes to the storage itself block until fn
+	// returns, so fn must only write through the storage it is given.
+	WriteExclusive(fn func(s Storage) error) error
+}
@@ -0,0 +1,24 @@
+package types
+
+// GroupRows splits rows into groups of rows with equal values in columns,
+// in the order each group first appears. Numbers are equal if their values
+// are, as in DistinctRows, so a group does not split on int and float64.
+func GroupRows(rows []Row, columns []string) [][]Row {
+	index := make(map[string]int)
+	var groups [][]Row
+	for _, row := range rows {
+		key := make(Row, len(columns))
+		for _, col := range columns {
+			key[col] = row[col]
+		}
+		k := rowKey(key)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], row)
+	}
+	return groups
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of hash bits that pick a register. 2^14
+// one-byte registers use 16 KiB and give a standard error of
+// 1.04/sqrt(2^14), about 0.8%.
+const hllPrecision = 14
+
+// HyperLogLog estimates the number of distinct values added to it in a
+// fixed amount of memory
+type HyperLogLog struct {
+	registers []uint8
+}
+
+// NewHyperLogLog returns an empty sketch
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// Add adds the string form of a value to the sketch
+func (h *HyperLogLog) Add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	// The guard bit bounds the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Estimate returns the estimated number of distinct values. Small counts
+// use linear counting, which is more accurate while registers are empty.
+func (h *HyperLogLog) Estimate() int64 {
+	m := float64(len(h.registers))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// Memory returns the size of the sketch in bytes
+func (h *HyperLogLog) Memory() int {
+	return len(h.registers)
+}
+
+// mix64 spreads the bits of an FNV hash, whose high bits vary little
+// between similar short strings (the splitmix64 finalizer)
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,18 @@
+package types
+
+// IndexDefinition describes a secondary index on one column of a table
+// (CREATE INDEX idx_dept ON employees (department)). Index names are
+// unique across the tables of a storage.
+type IndexDefinition struct {
+	Name   string
+	Column string
+}
+
+// IndexManager is implemented by storages that keep secondary indexes, so
+// that a SELECT with an equality on an indexed column reads only the rows
+// holding the value. The definitions are part of the table metadata (see
+// Table.Indexes); the indexes are maintained by every write.
+type IndexManager interface {
+	CreateIndex(tableName string, index IndexDefinition) error
+	DropIndex(indexName string) error
+}
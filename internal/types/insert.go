@@ -0,0 +1,28 @@
+package types
+
+import "fmt"
+
+// BatchInserter is implemented by storages that can insert several rows
+// at once (INSERT ... VALUES (...), (...)). All rows are validated before
+// any is written, so a row that fails validation inserts nothing.
+type BatchInserter interface {
+	InsertRows(tableName string, rows []map[string]interface{}) error
+}
+
+// InsertRows inserts rows through s.InsertRows if s is a BatchInserter and
+// one at a time otherwise. Inserting one at a time stops at the first row
+// that fails, and the error says how many rows were inserted before it.
+func InsertRows(s Storage, tableName string, rows []map[string]interface{}) error {
+	if len(rows) == 1 {
+		return s.Insert(tableName, rows[0])
+	}
+	if batch, ok := s.(BatchInserter); ok {
+		return batch.InsertRows(tableName, rows)
+	}
+	for i, row := range rows {
+		if err := s.Insert(tableName, row); err != nil {
+			return fmt.Errorf("row %d: %w (%d rows inserted)", i+1, err, i)
+		}
+	}
+	return nil
+}
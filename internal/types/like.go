@@ -0,0 +1,54 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// likePatterns caches the regexps of LIKE patterns, which are matched
+// against every row a query scans
+var likePatterns sync.Map // string -> *regexp.Regexp
+
+// likeRegexp translates a LIKE pattern into an anchored regexp: % matches
+// any sequence of characters, _ any single character, and everything else
+// itself
+func likeRegexp(pattern string) *regexp.Regexp {
+	if re, ok := likePatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re := regexp.MustCompile(b.String())
+	likePatterns.Store(pattern, re)
+	return re
+}
+
+// matchesLike reports whether value matches a LIKE pattern. Numbers are
+// matched by their text, so id LIKE '1%' finds 1, 10 and 12.
+func matchesLike(value, pattern interface{}) bool {
+	return likeRegexp(likeText(pattern)).MatchString(likeText(value))
+}
+
+func likeText(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	if f, ok := toFloat(v); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
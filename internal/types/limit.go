@@ -0,0 +1,59 @@
+package types
+
+import "fmt"
+
+// NoLimit is the Count of a LimitSpec with OFFSET but no LIMIT
+const NoLimit = -1
+
+// LimitSpec is a LIMIT and OFFSET clause: skip Offset rows, then return at
+// most Count rows. LIMIT 10 OFFSET 20 returns rows 21 to 30.
+type LimitSpec struct {
+	Count  int
+	Offset int
+}
+
+func (l LimitSpec) String() string {
+	switch {
+	case l.Count == NoLimit:
+		return fmt.Sprintf("OFFSET %d", l.Offset)
+	case l.Offset > 0:
+		return fmt.Sprintf("LIMIT %d OFFSET %d", l.Count, l.Offset)
+	}
+	return fmt.Sprintf("LIMIT %d", l.Count)
+}
+
+// Apply returns the rows the clause keeps
+func (l LimitSpec) Apply(rows []Row) []Row {
+	if l.Offset >= len(rows) {
+		return nil
+	}
+	rows = rows[l.Offset:]
+	if l.Count != NoLimit && l.Count < len(rows) {
+		rows = rows[:l.Count]
+	}
+	return rows
+}
+
+// Done reports whether a scan that has matched n rows can stop
+func (l LimitSpec) Done(n int) bool {
+	return l.Count != NoLimit && n >= l.Offset+l.Count
+}
+
+// Limiter is implemented by storages that can stop reading a table once
+// a LIMIT is satisfied. Rows are returned in the order Select returns them.
+type Limiter interface {
+	SelectLimit(tableName string, columns []string, where *WhereExpr, limit LimitSpec) ([]Row, error)
+}
+
+// SelectLimit runs SELECT ... LIMIT on storage. Storages that are not
+// Limiters are read in full and the limit is applied afterwards.
+func SelectLimit(storage Storage, tableName string, columns []string, where *WhereExpr, limit LimitSpec) ([]Row, error) {
+	if limiter, ok := storage.(Limiter); ok {
+		return limiter.SelectLimit(tableName, columns, where, limit)
+	}
+	rows, err := storage.Select(tableName, columns, where)
+	if err != nil {
+		return nil, err
+	}
+	return limit.Apply(rows), nil
+}
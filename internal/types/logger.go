@@ -1,9 +1,11 @@
 package types
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 )
 
 // LogLevel represents the logging level
@@ -45,6 +47,24 @@ func InitLogger(level LogLevel, output io.Writer) *Logger {
 	}
 }
 
+// ParseLogLevel parses a level name: debug, info, warn (or warning), error
+// or none
+func ParseLogLevel(level string) (LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "info":
+		return LogLevelInfo, nil
+	case "warn", "warning":
+		return LogLevelWarning, nil
+	case "error":
+		return LogLevelError, nil
+	case "none":
+		return LogLevelNone, nil
+	}
+	return 0, fmt.Errorf("must be debug, info, warn, error or none, got %q", level)
+}
+
 // SetLevel changes the logging level
 func (l *Logger) SetLevel(level LogLevel) {
 	l.currentLevel = level
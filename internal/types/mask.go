@@ -0,0 +1,92 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maskFill replaces the hidden part of a masked string. It has a fixed
+// length so the mask does not reveal the length of the value.
+const maskFill = "*****"
+
+// ParseMaskPolicy validates a column masking policy and returns it in
+// canonical form. The policies are
+//
+//	full        strings become *****, numbers 0
+//	partial(n)  the first n characters are kept: abc*****, or
+//	            abc*****@***** for an email address
+func ParseMaskPolicy(policy string) (string, error) {
+	p := strings.ToLower(strings.ReplaceAll(policy, " ", ""))
+	if p == "full" {
+		return p, nil
+	}
+	if strings.HasPrefix(p, "partial(") && strings.HasSuffix(p, ")") {
+		n, err := strconv.Atoi(p[len("partial(") : len(p)-1])
+		if err == nil && n >= 0 {
+			return fmt.Sprintf("partial(%d)", n), nil
+		}
+	}
+	return "", fmt.Errorf("unknown masking policy %q (expected full or partial(n))", policy)
+}
+
+// MaskValue applies a policy accepted by ParseMaskPolicy to a value. NULL
+// stays NULL.
+func MaskValue(policy string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	var keep int
+	if _, err := fmt.Sscanf(policy, "partial(%d)", &keep); err != nil {
+		if _, ok := value.(string); ok {
+			return maskFill
+		}
+		return 0
+	}
+
+	s := fmt.Sprint(value)
+	local, _, email := strings.Cut(s, "@")
+	if runes := []rune(local); len(runes) > keep {
+		local = string(runes[:keep])
+	}
+	if email {
+		return local + maskFill + "@" + maskFill
+	}
+	return local + maskFill
+}
+
+// MaskRows returns rows with the masked columns of table masked. Rows are
+// copied rather than changed, since storages may return their own rows.
+func MaskRows(table *Table, rows []Row) []Row {
+	if table == nil {
+		return rows
+	}
+	masks := make(map[string]string)
+	for _, col := range table.Columns {
+		if col.Mask != "" {
+			masks[col.Name] = col.Mask
+		}
+	}
+	if len(masks) == 0 {
+		return rows
+	}
+
+	masked := make([]Row, len(rows))
+	for i, row := range rows {
+		masked[i] = make(Row, len(row))
+		for col, val := range row {
+			if policy, ok := masks[col]; ok {
+				val = MaskValue(policy, val)
+			}
+			masked[i][col] = val
+		}
+	}
+	return masked
+}
+
+// ColumnMasker is implemented by storages that can store a masking policy
+// with a column (ALTER TABLE ... ALTER COLUMN ... SET MASKED). An empty
+// policy removes the mask.
+type ColumnMasker interface {
+	SetColumnMask(tableName, column, policy string) error
+}
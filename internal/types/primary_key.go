@@ -0,0 +1,31 @@
+package types
+
+import "fmt"
+
+// PrimaryKey returns the name of the table's primary key column, or ""
+// if it has none
+func (t *Table) PrimaryKey() string {
+	for _, col := range t.Columns {
+		if col.PrimaryKey {
+			return col.Name
+		}
+	}
+	return ""
+}
+
+// CheckPrimaryKey returns an error if row's primary key value is already
+// held by one of rows. Numbers are equal if their values are, as in
+// DistinctRows.
+func CheckPrimaryKey(table *Table, rows []Row, row Row) error {
+	key := table.PrimaryKey()
+	if key == "" {
+		return nil
+	}
+	value := rowKey(Row{key: row[key]})
+	for _, existing := range rows {
+		if rowKey(Row{key: existing[key]}) == value {
+			return fmt.Errorf("duplicate primary key %s = %v in table %s", key, row[key], table.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned (wrapped in a *QuotaError) when an insert
+// would grow a table past its quota
+var ErrQuotaExceeded = errors.New("table quota exceeded")
+
+// QuotaError reports which limit of a table's quota an insert exceeded.
+// errors.Is(err, ErrQuotaExceeded) matches it.
+type QuotaError struct {
+	Table string
+	Limit string // MAX_ROWS or MAX_BYTES
+	Max   int64
+	Used  int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("table %s is full: %s = %d, %d in use", e.Table, e.Limit, e.Max, e.Used)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// TableQuota caps how large a table can grow. A zero limit is unlimited.
+type TableQuota struct {
+	MaxRows  int64
+	MaxBytes int64
+
+	// EvictOldest deletes the oldest rows to make room for an insert
+	// (ON FULL DELETE OLDEST) instead of rejecting it
+	EvictOldest bool
+}
+
+// Limited reports whether the quota sets any limit
+func (q TableQuota) Limited() bool {
+	return q.MaxRows > 0 || q.MaxBytes > 0
+}
+
+// QuotaUsage is the current size of a table, measured the way quotas are
+type QuotaUsage struct {
+	Rows  int64
+	Bytes int64
+}
+
+// RowSize returns the size of a row counted against MAX_BYTES, which is
+// the length of its JSON encoding
+func RowSize(row Row) int64 {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// MakeRoom decides whether a table with the given usage can take a new row
+// of rowBytes. If the quota is full and evicts, it asks oldest for the size
+// of the next oldest row (false when there are none left) until the new row
+// fits, and returns how many of the oldest rows the caller must delete
+// first. Otherwise a full quota returns a *QuotaError.
+func (q TableQuota) MakeRoom(table string, usage QuotaUsage, rowBytes int64, oldest func() (int64, bool)) (int, error) {
+	if q.MaxBytes > 0 && rowBytes > q.MaxBytes {
+		// Evicting every row would not make room either
+		return 0, &QuotaError{Table: table, Limit: "MAX_BYTES", Max: q.MaxBytes, Used: rowBytes}
+	}
+
+	evict := 0
+	for {
+		err := q.admit(table, usage, rowBytes)
+		if err == nil || !q.EvictOldest {
+			return evict, err
+		}
+		size, ok := oldest()
+		if !ok {
+			return 0, err
+		}
+		usage.Rows--
+		usage.Bytes -= size
+		evict++
+	}
+}
+
+// admit returns a *QuotaError if one more row of rowBytes does not fit
+func (q TableQuota) admit(table string, usage QuotaUsage, rowBytes int64) error {
+	if q.MaxRows > 0 && usage.Rows+1 > q.MaxRows {
+		return &QuotaError{Table: table, Limit: "MAX_ROWS", Max: q.MaxRows, Used: usage.Rows}
+	}
+	if q.MaxBytes > 0 && usage.Bytes+rowBytes > q.MaxBytes {
+		return &QuotaError{Table: table, Limit: "MAX_BYTES", Max: q.MaxBytes, Used: usage.Bytes}
+	}
+	return nil
+}
+
+// QuotaManager is implemented by storages that enforce table quotas (ALTER
+// TABLE ... SET MAX_ROWS / MAX_BYTES). The quota is stored with the table
+// metadata. Lowering it below the current usage keeps the existing rows;
+// the next insert is then rejected, or evicts down to the new limit.
+type QuotaManager interface {
+	SetQuota(tableName string, quota TableQuota) error
+	QuotaUsage(tableName string) (QuotaUsage, error)
+}
@@ -0,0 +1,128 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// sampleMinBlocks is how many pages or row groups a block-level sample
+// keeps at least, so that small tables are not sampled all-or-nothing
+const sampleMinBlocks = 16
+
+// SampleSpec is a TABLESAMPLE clause: (10 PERCENT) or (1000 ROWS), with
+// REPEATABLE (seed) for a deterministic sample. Both forms keep each row
+// independently with the same probability, so the sample size is
+// approximate; ROWS n uses the probability n / table rows.
+type SampleSpec struct {
+	Percent    float64
+	Rows       int
+	Repeatable bool
+	Seed       int64
+}
+
+func (s SampleSpec) String() string {
+	var b strings.Builder
+	if s.Rows > 0 {
+		fmt.Fprintf(&b, "%d ROWS", s.Rows)
+	} else {
+		fmt.Fprintf(&b, "%g PERCENT", s.Percent)
+	}
+	if s.Repeatable {
+		fmt.Fprintf(&b, " REPEATABLE (%d)", s.Seed)
+	}
+	return b.String()
+}
+
+// Rand returns the random source for one sample, seeded by Seed when the
+// sample is repeatable
+func (s SampleSpec) Rand() *rand.Rand {
+	seed := s.Seed
+	if !s.Repeatable {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// Fraction returns the probability of keeping a row of a table with total
+// rows
+func (s SampleSpec) Fraction(total int) float64 {
+	if s.Rows == 0 {
+		return s.Percent / 100
+	}
+	if total <= s.Rows {
+		return 1
+	}
+	return float64(s.Rows) / float64(total)
+}
+
+// BlockFraction splits a row fraction into the fraction of blocks (pages
+// or row groups) to read, out of blocks. Skipping blocks saves reading
+// them, but makes the sample lumpier, so at least sampleMinBlocks are kept.
+// The rows of a kept block are then sampled with fraction / BlockFraction.
+func BlockFraction(fraction float64, blocks int) float64 {
+	if blocks <= sampleMinBlocks {
+		return 1
+	}
+	return math.Min(1, math.Max(fraction, float64(sampleMinBlocks)/float64(blocks)))
+}
+
+// ProjectRow returns the requested columns of a row; * or no columns
+// return the whole row
+func ProjectRow(row Row, columns []string) Row {
+	if len(columns) == 0 || (len(columns) == 1 && columns[0] == "*") {
+		return row
+	}
+	projected := make(Row, len(columns))
+	for _, col := range columns {
+		if val, ok := row[col]; ok {
+			projected[col] = val
+		}
+	}
+	return projected
+}
+
+// Sampler is implemented by storages that can sample a table without
+// reading all of it. WHERE filters the sampled rows.
+type Sampler interface {
+	SelectSample(tableName string, columns []string, where *WhereExpr, spec SampleSpec) ([]Row, error)
+}
+
+// SampleSelect runs SELECT ... TABLESAMPLE on storage. Storages that are
+// not Samplers are read in full and sampled afterwards; filtering before
+// sampling gives the same result, since every row is kept independently.
+func SampleSelect(storage Storage, tableName string, columns []string, where *WhereExpr, spec SampleSpec) ([]Row, error) {
+	for _, col := range columns {
+		if strings.HasPrefix(strings.ToUpper(col), "COUNT(") {
+			return nil, fmt.Errorf("TABLESAMPLE does not support %s", col)
+		}
+	}
+	if sampler, ok := storage.(Sampler); ok {
+		return sampler.SelectSample(tableName, columns, where, spec)
+	}
+
+	rows, err := storage.Select(tableName, columns, where)
+	if err != nil {
+		return nil, err
+	}
+	total := len(rows)
+	if spec.Rows > 0 && where != nil {
+		all, err := storage.Select(tableName, []string{"*"}, nil)
+		if err != nil {
+			return nil, err
+		}
+		total = len(all)
+	}
+
+	fraction := spec.Fraction(total)
+	rng := spec.Rand()
+	sampled := make([]Row, 0, int(float64(len(rows))*fraction)+1)
+	for _, row := range rows {
+		if rng.Float64() < fraction {
+			sampled = append(sampled, row)
+		}
+	}
+	return sampled, nil
+}
@@ -0,0 +1,27 @@
+package types
+
+// Scanner is implemented by storages that can pass the rows a SELECT
+// matches to a callback one at a time instead of collecting them, so a
+// large result is never held in memory. Rows are passed in the order
+// Select returns them; an error from fn stops the scan and is returned.
+type Scanner interface {
+	SelectEach(tableName string, columns []string, where *WhereExpr, fn func(row Row) error) error
+}
+
+// SelectEach runs SELECT on storage and passes each row to fn. Storages
+// that are not Scanners are read in full first.
+func SelectEach(storage Storage, tableName string, columns []string, where *WhereExpr, fn func(row Row) error) error {
+	if scanner, ok := storage.(Scanner); ok {
+		return scanner.SelectEach(tableName, columns, where, fn)
+	}
+	rows, err := storage.Select(tableName, columns, where)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package types
+
+import "errors"
+
+// Transaction is a storage that buffers writes until Commit applies them
+// to the storage it was started on, or Rollback discards them
+type Transaction interface {
+	Storage
+	Commit() error
+	Rollback() error
+}
+
+// Scratch makes the storages a statement keeps transient rows in: the
+// materialized CTEs of a query and the buffered writes of a transaction.
+// The storage package registers its in-memory implementation when it is
+// linked in, so the packages that run statements need not import it.
+type Scratch struct {
+	// NewStorage returns an empty storage
+	NewStorage func() Storage
+
+	// NewTransaction starts a transaction on base
+	NewTransaction func(base Storage) Transaction
+}
+
+var scratch Scratch
+
+// ErrNoScratch is returned for a statement that needs a scratch storage
+// when none is registered
+var ErrNoScratch = errors.New("no scratch storage registered (import internal/storage)")
+
+// RegisterScratch sets the scratch storages. It is meant to be called from
+// an init function.
+func RegisterScratch(s Scratch) {
+	scratch = s
+}
+
+// NewScratchStorage returns an empty scratch storage
+func NewScratchStorage() (Storage, error) {
+	if scratch.NewStorage == nil {
+		return nil, ErrNoScratch
+	}
+	return scratch.NewStorage(), nil
+}
+
+// BeginTransaction starts a transaction on base
+func BeginTransaction(base Storage) (Transaction, error) {
+	if scratch.NewTransaction == nil {
+		return nil, ErrNoScratch
+	}
+	return scratch.NewTransaction(base), nil
+}
@@ -1,5 +1,10 @@
 package types
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Row represents a single row in a table with column names as keys and column values as values.
 type Row map[string]interface{}
 
@@ -8,20 +13,31 @@ type Storage interface {
 	// CreateTable creates a new table with the given table definition.
 	CreateTable(table *Table) error
 
+	// DropTable removes a table and all of its rows.
+	DropTable(tableName string) error
+
 	// Insert adds a new row to the specified table with the given values.
 	Insert(tableName string, values map[string]interface{}) error
 
-	// Update modifies existing rows in the table that match the where condition.
-	Update(tableName string, set map[string]interface{}, where map[string]interface{}) error
+	// Update modifies existing rows in the table that match the where condition
+	// and returns how many it modified. Matching no row is not an error.
+	Update(tableName string, set map[string]interface{}, where *WhereExpr) (int, error)
 
-	// Delete removes rows from the table that match the where condition.
-	Delete(tableName string, where map[string]interface{}) error
+	// Delete removes rows from the table that match the where condition and
+	// returns how many it removed. Matching no row is not an error.
+	Delete(tableName string, where *WhereExpr) (int, error)
 
 	// Select retrieves rows from the table, optionally filtered by where condition.
-	Select(tableName string, columns []string, where map[string]interface{}) ([]Row, error)
+	Select(tableName string, columns []string, where *WhereExpr) ([]Row, error)
 
 	// ShowTables returns a list of all table names in the database.
 	ShowTables() ([]string, error)
+
+	// GetTable returns the table definition, or nil if the table does not exist.
+	GetTable(tableName string) *Table
+
+	// Capabilities returns the features the storage supports.
+	Capabilities() Capabilities
 }
 
 // Table represents a database table with its schema and data.
@@ -34,6 +50,12 @@ type Table struct {
 
 	// Rows contains the data stored in the table.
 	Rows []Row
+
+	// Quota limits how large the table can grow, or is nil for no limit.
+	Quota *TableQuota `json:",omitempty"`
+
+	// Indexes lists the secondary indexes of the table (see IndexManager).
+	Indexes []IndexDefinition `json:",omitempty"`
 }
 
 // ColumnDefinition represents a column in a table schema.
@@ -46,4 +68,75 @@ type ColumnDefinition struct {
 
 	// Nullable indicates whether the column can contain NULL values.
 	Nullable bool
+
+	// Mask is the masking policy applied to the column in query results
+	// (see ParseMaskPolicy), or empty for none.
+	Mask string `json:",omitempty"`
+
+	// PrimaryKey marks the column whose values identify rows. It is not
+	// nullable, and inserting a value that is already stored fails.
+	PrimaryKey bool `json:",omitempty"`
+
+	// Default is the value stored when an insert omits the column, or nil
+	// for none (see WithDefaults).
+	Default interface{} `json:",omitempty"`
+}
+
+// SchemaDiff describes how the columns of two table definitions differ.
+// It returns nil when both tables declare the same columns in the same order
+// with the same types, nullability, primary key and default.
+func SchemaDiff(existing, requested *Table) []string {
+	var diffs []string
+
+	existingCols := make(map[string]ColumnDefinition, len(existing.Columns))
+	for _, col := range existing.Columns {
+		existingCols[col.Name] = col
+	}
+	requestedCols := make(map[string]ColumnDefinition, len(requested.Columns))
+	for _, col := range requested.Columns {
+		requestedCols[col.Name] = col
+	}
+
+	for i, col := range requested.Columns {
+		old, ok := existingCols[col.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("column %s does not exist in the current table", col.Name))
+			continue
+		}
+		if !strings.EqualFold(old.Type, col.Type) {
+			diffs = append(diffs, fmt.Sprintf("column %s has type %s, requested %s", col.Name, old.Type, col.Type))
+		}
+		if old.Nullable != col.Nullable {
+			diffs = append(diffs, fmt.Sprintf("column %s has nullable=%t, requested nullable=%t", col.Name, old.Nullable, col.Nullable))
+		}
+		if old.PrimaryKey != col.PrimaryKey {
+			diffs = append(diffs, fmt.Sprintf("column %s has primary key=%t, requested primary key=%t", col.Name, old.PrimaryKey, col.PrimaryKey))
+		}
+		if rowKey(Row{col.Name: old.Default}) != rowKey(Row{col.Name: col.Default}) {
+			diffs = append(diffs, fmt.Sprintf("column %s has default %v, requested default %v", col.Name, old.Default, col.Default))
+		}
+		if i < len(existing.Columns) && existing.Columns[i].Name != col.Name {
+			diffs = append(diffs, fmt.Sprintf("column %s is at a different position", col.Name))
+		}
+	}
+
+	for _, col := range existing.Columns {
+		if _, ok := requestedCols[col.Name]; !ok {
+			diffs = append(diffs, fmt.Sprintf("column %s is missing from the requested definition", col.Name))
+		}
+	}
+
+	return diffs
+}
+
+// CheckSchemaCompatible backs CREATE TABLE IF NOT EXISTS: re-creating a table
+// with the same definition is a no-op, while a conflicting definition is
+// reported instead of being silently ignored.
+func CheckSchemaCompatible(existing, requested *Table) error {
+	diffs := SchemaDiff(existing, requested)
+	if len(diffs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("table %s already exists with a different schema: %s",
+		existing.Name, strings.Join(diffs, "; "))
 }
@@ -0,0 +1,302 @@
+package types
+
+import (
+	"sort"
+	"strings"
+)
+
+// WhereExpr is a WHERE clause: a tree of AND, OR and NOT nodes whose leaves
+// are conditions. A condition tests one column against Value, which is a
+// value the column must equal or a Comparison, or it is a RowCondition on
+// values computed from the whole row. A nil *WhereExpr is no WHERE clause
+// and matches every row.
+type WhereExpr struct {
+	// Op is AND, OR or NOT for a node, and empty for a condition
+	Op string
+
+	// Args are the operands of AND and OR, or the one operand of NOT
+	Args []*WhereExpr
+
+	// Column and Value are a condition on a column
+	Column string
+	Value  interface{}
+
+	// Row is a condition on the whole row, set instead of Column and Value
+	Row RowCondition
+}
+
+// RowCondition is a WHERE condition that a column and a value cannot
+// express, such as first_name || last_name = 'AdaLovelace'
+type RowCondition interface {
+	// MatchRow reports whether row satisfies the condition. ok is false if
+	// that is unknown because a value the condition compares is NULL.
+	MatchRow(row Row) (match, ok bool)
+
+	// Columns returns the columns the condition reads
+	Columns() []string
+
+	// String returns the condition as SQL
+	String() string
+}
+
+// Condition returns the WHERE condition on column, e.g. Condition("age",
+// Comparison{">", 30}) for age > 30
+func Condition(column string, value interface{}) *WhereExpr {
+	return &WhereExpr{Column: column, Value: value}
+}
+
+// RowWhere returns the WHERE condition on the whole row cond
+func RowWhere(cond RowCondition) *WhereExpr {
+	return &WhereExpr{Row: cond}
+}
+
+// And returns the WHERE clause that holds when all of args do. Nil
+// operands, which match every row, are left out, and operands that are
+// themselves ANDs are merged into the result.
+func And(args ...*WhereExpr) *WhereExpr {
+	return join("AND", args)
+}
+
+// Or returns the WHERE clause that holds when any of args does. It is nil
+// if an operand is, since that operand matches every row.
+func Or(args ...*WhereExpr) *WhereExpr {
+	for _, arg := range args {
+		if arg == nil {
+			return nil
+		}
+	}
+	return join("OR", args)
+}
+
+func join(op string, args []*WhereExpr) *WhereExpr {
+	var joined []*WhereExpr
+	for _, arg := range args {
+		switch {
+		case arg == nil:
+		case arg.Op == op:
+			joined = append(joined, arg.Args...)
+		default:
+			joined = append(joined, arg)
+		}
+	}
+	switch len(joined) {
+	case 0:
+		return nil
+	case 1:
+		return joined[0]
+	}
+	return &WhereExpr{Op: op, Args: joined}
+}
+
+// Not returns the WHERE clause that holds when arg does not
+func Not(arg *WhereExpr) *WhereExpr {
+	return &WhereExpr{Op: "NOT", Args: []*WhereExpr{arg}}
+}
+
+// WhereAll returns the WHERE clause that holds when every condition of
+// conditions, keyed by column, does, e.g. WhereAll(map[string]interface{}{
+// "id": 1}) for id = 1. It is nil if there are no conditions.
+func WhereAll(conditions map[string]interface{}) *WhereExpr {
+	columns := make([]string, 0, len(conditions))
+	for col := range conditions {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	args := make([]*WhereExpr, len(columns))
+	for i, col := range columns {
+		args[i] = Condition(col, conditions[col])
+	}
+	return And(args...)
+}
+
+// Matches reports whether row satisfies the WHERE clause; a column the row
+// omits is NULL. It is the evaluator every storage filters rows with, and
+// follows SQL's three-valued logic: a condition comparing a NULL, other
+// than IS [NOT] NULL, is unknown, NOT of unknown is unknown, and only rows
+// for which the clause is true match. So a NULL matches neither a
+// condition nor its negation.
+func (e *WhereExpr) Matches(row Row) bool {
+	match, ok := e.eval(row)
+	return match && ok
+}
+
+// eval returns the truth of e for row; ok is false if it is unknown
+func (e *WhereExpr) eval(row Row) (match, ok bool) {
+	if e == nil {
+		return true, true
+	}
+	switch e.Op {
+	case "AND":
+		// False if an operand is, and otherwise unknown if one is
+		ok = true
+		for _, arg := range e.Args {
+			m, k := arg.eval(row)
+			if k && !m {
+				return false, true
+			}
+			ok = ok && k
+		}
+		return ok, ok
+	case "OR":
+		// True if an operand is, and otherwise unknown if one is
+		ok = true
+		for _, arg := range e.Args {
+			m, k := arg.eval(row)
+			if k && m {
+				return true, true
+			}
+			ok = ok && k
+		}
+		return false, ok
+	case "NOT":
+		m, k := e.Args[0].eval(row)
+		return !m, k
+	}
+	if e.Row != nil {
+		return e.Row.MatchRow(row)
+	}
+	return matchCondition(row[e.Column], e.Value)
+}
+
+// matchCondition returns the truth of a condition on a column holding
+// value
+func matchCondition(value, cond interface{}) (match, ok bool) {
+	c, isCmp := cond.(Comparison)
+	if isCmp && (c.Operator == "IS NULL" || c.Operator == "IS NOT NULL") {
+		return c.Matches(value), true
+	}
+	if isCmp {
+		cond = c.Value
+	}
+	if value == nil || cond == nil {
+		return false, false
+	}
+	if isCmp {
+		return c.Matches(value), true
+	}
+	return ValuesEqual(value, cond), true
+}
+
+// Conditions returns the conditions of the WHERE clause, the leaves of its
+// tree, in the order they were written
+func (e *WhereExpr) Conditions() []*WhereExpr {
+	if e == nil {
+		return nil
+	}
+	if e.Op == "" {
+		return []*WhereExpr{e}
+	}
+	var conditions []*WhereExpr
+	for _, arg := range e.Args {
+		conditions = append(conditions, arg.Conditions()...)
+	}
+	return conditions
+}
+
+// Conjuncts returns the conditions every row matching the WHERE clause
+// satisfies: the conditions ANDed at its top, or the clause itself if it
+// is a single condition. Storages use them to narrow the rows they read,
+// e.g. through an index on a column a conjunct tests for equality.
+func (e *WhereExpr) Conjuncts() []*WhereExpr {
+	switch {
+	case e == nil:
+		return nil
+	case e.Op == "":
+		return []*WhereExpr{e}
+	case e.Op != "AND":
+		return nil
+	}
+	var conjuncts []*WhereExpr
+	for _, arg := range e.Args {
+		if arg.Op == "" {
+			conjuncts = append(conjuncts, arg)
+		}
+	}
+	return conjuncts
+}
+
+// Equality returns the value the WHERE clause requires column to equal,
+// if one of its conjuncts is such an equality
+func (e *WhereExpr) Equality(column string) (interface{}, bool) {
+	for _, cond := range e.Conjuncts() {
+		if cond.Row != nil || cond.Column != column || cond.Value == nil {
+			continue
+		}
+		if _, isCmp := cond.Value.(Comparison); !isCmp {
+			return cond.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Rewrite returns a copy of the WHERE clause with each condition replaced
+// by what fn returns for it. The clause itself is not modified.
+func (e *WhereExpr) Rewrite(fn func(cond *WhereExpr) (*WhereExpr, error)) (*WhereExpr, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if e.Op == "" {
+		return fn(e)
+	}
+	rewritten := &WhereExpr{Op: e.Op, Args: make([]*WhereExpr, len(e.Args))}
+	for i, arg := range e.Args {
+		var err error
+		if rewritten.Args[i], err = arg.Rewrite(fn); err != nil {
+			return nil, err
+		}
+	}
+	return rewritten, nil
+}
+
+// WhereColumns returns the sorted names of the columns a WHERE clause
+// reads, including those of its row conditions
+func WhereColumns(where *WhereExpr) []string {
+	seen := make(map[string]bool)
+	for _, cond := range where.Conditions() {
+		if cond.Row != nil {
+			for _, col := range cond.Row.Columns() {
+				seen[col] = true
+			}
+			continue
+		}
+		seen[cond.Column] = true
+	}
+
+	columns := make([]string, 0, len(seen))
+	for col := range seen {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// FormatWhere renders a WHERE clause as SQL, e.g. age > 30 AND (id = 1 OR
+// id = 2), with condition rendering each condition on a column. Operands
+// are parenthesized where the precedence of NOT over AND over OR needs it.
+func FormatWhere(where *WhereExpr, condition func(column string, value interface{}) string) string {
+	if where == nil {
+		return ""
+	}
+	switch where.Op {
+	case "AND", "OR":
+		parts := make([]string, len(where.Args))
+		for i, arg := range where.Args {
+			parts[i] = FormatWhere(arg, condition)
+			if where.Op == "AND" && arg.Op == "OR" {
+				parts[i] = "(" + parts[i] + ")"
+			}
+		}
+		return strings.Join(parts, " "+where.Op+" ")
+	case "NOT":
+		arg := where.Args[0]
+		if arg != nil && arg.Op == "" {
+			return "NOT " + FormatWhere(arg, condition)
+		}
+		return "NOT (" + FormatWhere(arg, condition) + ")"
+	}
+	if where.Row != nil {
+		return where.Row.String()
+	}
+	return condition(where.Column, where.Value)
+}
@@ -0,0 +1,195 @@
+package ulindb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zakazai/ulin-db/internal/lexer"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// ColumnType is the SQL type of a column
+type ColumnType string
+
+// Column types, as normalized by CREATE TABLE
+const (
+	Int       ColumnType = "INT"
+	Float     ColumnType = "FLOAT"
+	Boolean   ColumnType = "BOOLEAN"
+	String    ColumnType = "STRING"
+	Text      ColumnType = "TEXT"
+	Date      ColumnType = "DATE"
+	Timestamp ColumnType = "TIMESTAMP"
+
+	// Double is FLOAT, which CREATE TABLE reads DOUBLE as
+	Double = Float
+)
+
+// ColumnOption sets a constraint on a column in TableBuilder.Column
+type ColumnOption func(*columnSpec)
+
+type columnSpec struct {
+	notNull    bool
+	nullable   bool
+	primaryKey bool
+	hasDefault bool
+	def        interface{}
+}
+
+// NotNull rejects NULL and missing values for the column
+var NotNull ColumnOption = func(c *columnSpec) { c.notNull = true }
+
+// Nullable allows NULL values for the column. This is the default, as with
+// CREATE TABLE; it conflicts with NotNull.
+var Nullable ColumnOption = func(c *columnSpec) { c.nullable = true }
+
+// PrimaryKey makes the column the table's primary key, which implies
+// NotNull. A table has at most one.
+var PrimaryKey ColumnOption = func(c *columnSpec) { c.primaryKey = true }
+
+// Default sets the value stored when an insert omits the column. It must
+// be of the column's type, as with DEFAULT in CREATE TABLE; a time.Time is
+// stored in the form of a DATE or TIMESTAMP column.
+func Default(value interface{}) ColumnOption {
+	return func(c *columnSpec) { c.hasDefault, c.def = true, value }
+}
+
+// TableBuilder builds a table schema without generating SQL text. Errors
+// are collected and returned by Build.
+type TableBuilder struct {
+	table *Table
+	err   error
+}
+
+// NewTable starts building a schema for the named table:
+//
+//	schema, err := ulindb.NewTable("events").
+//		Column("id", ulindb.Int, ulindb.NotNull).
+//		Column("payload", ulindb.String).
+//		Build()
+func NewTable(name string) *TableBuilder {
+	b := &TableBuilder{table: &Table{Name: name}}
+	if !validIdentifier(name) {
+		b.err = fmt.Errorf("invalid table name %q", name)
+	}
+	return b
+}
+
+// Column appends a column to the schema
+func (b *TableBuilder) Column(name string, typ ColumnType, opts ...ColumnOption) *TableBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	if !validIdentifier(name) {
+		b.err = fmt.Errorf("invalid column name %q", name)
+		return b
+	}
+	for _, col := range b.table.Columns {
+		if col.Name == name {
+			b.err = fmt.Errorf("duplicate column name: %s", name)
+			return b
+		}
+	}
+	switch typ {
+	case Int, Float, Boolean, String, Text, Date, Timestamp:
+	default:
+		b.err = fmt.Errorf("column %s: unsupported type %q", name, typ)
+		return b
+	}
+
+	var spec columnSpec
+	for _, opt := range opts {
+		opt(&spec)
+	}
+	if spec.notNull && spec.nullable {
+		b.err = fmt.Errorf("column %s: NotNull conflicts with Nullable", name)
+		return b
+	}
+	if spec.primaryKey && spec.nullable {
+		b.err = fmt.Errorf("column %s: PrimaryKey conflicts with Nullable", name)
+		return b
+	}
+	if spec.primaryKey {
+		for _, col := range b.table.Columns {
+			if col.PrimaryKey {
+				b.err = fmt.Errorf("table %s has more than one primary key: %s and %s", b.table.Name, col.Name, name)
+				return b
+			}
+		}
+	}
+
+	col := ColumnDefinition{
+		Name:       name,
+		Type:       string(typ),
+		Nullable:   !spec.notNull && !spec.primaryKey,
+		PrimaryKey: spec.primaryKey,
+	}
+	if spec.hasDefault {
+		col.Default = defaultValue(typ, spec.def)
+		if err := types.CheckDefault(col); err != nil {
+			b.err = err
+			return b
+		}
+	}
+	b.table.Columns = append(b.table.Columns, col)
+	return b
+}
+
+// defaultValue converts a Default value to the type CREATE TABLE parses
+// the literal to: integers are int64, other numbers float64, and times
+// the column's stored form
+func defaultValue(typ ColumnType, value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		if typ == Date {
+			return v.Format(types.DateLayout)
+		}
+		return v.UTC().Format(types.TimestampLayout)
+	}
+	return value
+}
+
+// Build returns the schema, or the first error found while building it
+func (b *TableBuilder) Build() (*Table, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.table.Columns) == 0 {
+		return nil, fmt.Errorf("table %s has no columns", b.table.Name)
+	}
+	return b.table, nil
+}
+
+// validIdentifier reports whether name would lex as a single SQL
+// identifier, i.e. a non-keyword word
+func validIdentifier(name string) bool {
+	if name == "" || lexer.LookupIdent(name) != lexer.IDENTIFIER {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
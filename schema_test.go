@@ -0,0 +1,97 @@
+package ulindb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zakazai/ulin-db/internal/parser"
+)
+
+func TestNewTableMatchesCreateTable(t *testing.T) {
+	tests := []struct {
+		sql     string
+		builder *TableBuilder
+	}{
+		{
+			"CREATE TABLE events (id INT NOT NULL, payload STRING)",
+			NewTable("events").Column("id", Int, NotNull).Column("payload", String),
+		},
+		{
+			"CREATE TABLE notes (id INT, body TEXT NOT NULL, author string)",
+			NewTable("notes").Column("id", Int, Nullable).Column("body", Text, NotNull).Column("author", String),
+		},
+		{
+			"CREATE TABLE readings (score FLOAT, ratio DOUBLE NOT NULL, ok BOOLEAN)",
+			NewTable("readings").Column("score", Float).Column("ratio", Double, NotNull).Column("ok", Boolean),
+		},
+		{
+			"CREATE TABLE users (id INT PRIMARY KEY, name STRING DEFAULT 'anon', level INT NOT NULL DEFAULT 1, ratio FLOAT DEFAULT 0.5, active BOOLEAN DEFAULT TRUE)",
+			NewTable("users").Column("id", Int, PrimaryKey).Column("name", String, Default("anon")).
+				Column("level", Int, NotNull, Default(1)).Column("ratio", Float, Default(float32(0.5))).Column("active", Boolean, Default(true)),
+		},
+		{
+			"CREATE TABLE events (day DATE DEFAULT '2024-05-01', at TIMESTAMP DEFAULT '2024-05-01T10:30:00Z')",
+			NewTable("events").Column("day", Date, Default(time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC))).
+				Column("at", Timestamp, Default(time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)))),
+		},
+	}
+
+	for _, tt := range tests {
+		stmt, err := parser.Parse(tt.sql)
+		if !assert.NoError(t, err, tt.sql) {
+			continue
+		}
+		schema, err := tt.builder.Build()
+		assert.NoError(t, err, tt.sql)
+		assert.Equal(t, stmt.CreateStatement.Schema(), schema, tt.sql)
+	}
+}
+
+func TestNewTableErrors(t *testing.T) {
+	tests := map[string]*TableBuilder{
+		`duplicate column name: id`:                          NewTable("t").Column("id", Int).Column("id", String),
+		`invalid table name "2fast"`:                         NewTable("2fast").Column("id", Int),
+		`invalid column name "first name"`:                   NewTable("t").Column("first name", String),
+		`invalid column name "select"`:                       NewTable("t").Column("select", String),
+		`column id: unsupported type "UUID"`:                 NewTable("t").Column("id", ColumnType("UUID")),
+		`column id: NotNull conflicts with Nullable`:         NewTable("t").Column("id", Int, NotNull, Nullable),
+		`column id: PrimaryKey conflicts with Nullable`:      NewTable("t").Column("id", Int, PrimaryKey, Nullable),
+		`table t has more than one primary key: id and code`: NewTable("t").Column("id", Int, PrimaryKey).Column("code", String, PrimaryKey),
+		`invalid DEFAULT one for INT column id`:              NewTable("t").Column("id", Int, Default("one")),
+		`table t has no columns`:                             NewTable("t"),
+	}
+	for want, builder := range tests {
+		_, err := builder.Build()
+		assert.EqualError(t, err, want)
+	}
+}
+
+func TestDBCreateTable(t *testing.T) {
+	db, err := Open(Config{Type: MemoryStorage})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+
+	schema, err := NewTable("events").Column("id", Int, NotNull).Column("payload", String).Build()
+	assert.NoError(t, err)
+	assert.NoError(t, db.CreateTable(schema))
+	assert.Equal(t, schema, db.GetTable("events"))
+
+	assert.Error(t, db.Insert("events", map[string]interface{}{"payload": "no id"}))
+	assert.NoError(t, db.Insert("events", map[string]interface{}{"id": 1, "payload": "ok"}))
+	rows, err := db.Select("events", []string{"payload"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Row{{"payload": "ok"}}, rows)
+
+	// Defaults fill omitted columns, and the primary key rejects repeats
+	schema, err = NewTable("users").Column("id", Int, PrimaryKey).Column("level", Int, Default(1)).Build()
+	assert.NoError(t, err)
+	assert.NoError(t, db.CreateTable(schema))
+	assert.NoError(t, db.Insert("users", map[string]interface{}{"id": 1}))
+	assert.Error(t, db.Insert("users", map[string]interface{}{"id": 1}))
+	rows, err = db.Select("users", []string{"id", "level"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Row{{"id": int64(1), "level": int64(1)}}, rows)
+}
@@ -0,0 +1,135 @@
+// Package ulindb is the public Go API for embedding UlinDB.
+package ulindb
+
+import (
+	"errors"
+
+	"github.com/zakazai/ulin-db/internal/storage"
+	"github.com/zakazai/ulin-db/internal/types"
+)
+
+// Config selects and configures the storage backend
+type Config = storage.StorageConfig
+
+// Table is a table schema as produced by NewTable or CREATE TABLE
+type Table = types.Table
+
+// ColumnDefinition describes a single column of a Table
+type ColumnDefinition = types.ColumnDefinition
+
+// Row is a single result row keyed by column name
+type Row = types.Row
+
+// Capabilities lists the features of the storage backend
+type Capabilities = types.Capabilities
+
+// Storage backends accepted in Config.Type
+const (
+	MemoryStorage  = storage.InMemoryStorageType
+	JSONStorage    = storage.JSONStorageType
+	BTreeStorage   = storage.BTreeStorageType
+	ParquetStorage = storage.ParquetStorageType
+)
+
+// ErrReadOnly is returned by writes to a database opened with readonly=true
+var ErrReadOnly = errors.New("database is read-only")
+
+// DB is an open UlinDB database
+type DB struct {
+	store    storage.Storage
+	readOnly bool
+}
+
+// Open opens a database with the given configuration
+func Open(config Config) (*DB, error) {
+	store, err := storage.NewStorage(config)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{store: store}, nil
+}
+
+// OpenDSN opens a database from a connection string (see DSN)
+func OpenDSN(dsn string) (*DB, error) {
+	d, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	var store storage.Storage
+	if d.Hybrid {
+		store, err = storage.CreateHybridStorage(d.Config)
+	} else {
+		store, err = storage.NewStorage(d.Config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &DB{store: store, readOnly: d.ReadOnly}, nil
+}
+
+// CreateTable creates a table from a schema built with NewTable
+func (db *DB) CreateTable(table *Table) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	return db.store.CreateTable(table)
+}
+
+// GetTable returns the schema of a table, or nil if it does not exist
+func (db *DB) GetTable(name string) *Table {
+	return db.store.GetTable(name)
+}
+
+// Insert adds a row to a table. Values of Go types registered with
+// RegisterValueCodec are encoded for their column.
+func (db *DB) Insert(table string, values map[string]interface{}) error {
+	if db.readOnly {
+		return ErrReadOnly
+	}
+	values, err := encodeValues(db.store.GetTable(table), values)
+	if err != nil {
+		return err
+	}
+	return db.store.Insert(table, values)
+}
+
+// Update sets columns of the rows matching where and returns how many
+// there were
+func (db *DB) Update(table string, set map[string]interface{}, where map[string]interface{}) (int, error) {
+	if db.readOnly {
+		return 0, ErrReadOnly
+	}
+	schema := db.store.GetTable(table)
+	set, err := encodeValues(schema, set)
+	if err != nil {
+		return 0, err
+	}
+	if where, err = encodeValues(schema, where); err != nil {
+		return 0, err
+	}
+	return db.store.Update(table, set, types.WhereAll(where))
+}
+
+// Select returns the given columns of the rows matching where. Use
+// ScanStruct to read a row back into Go types.
+func (db *DB) Select(table string, columns []string, where map[string]interface{}) ([]Row, error) {
+	where, err := encodeValues(db.store.GetTable(table), where)
+	if err != nil {
+		return nil, err
+	}
+	return db.store.Select(table, columns, types.WhereAll(where))
+}
+
+// Capabilities returns the features of the storage backend. A database
+// opened with readonly=true is always read-only.
+func (db *DB) Capabilities() Capabilities {
+	caps := db.store.Capabilities()
+	caps.ReadOnly = caps.ReadOnly || db.readOnly
+	return caps
+}
+
+// Close closes the database
+func (db *DB) Close() error {
+	return db.store.Close()
+}